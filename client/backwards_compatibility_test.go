@@ -3,6 +3,7 @@
 package client
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	canonicaljson "github.com/docker/go/canonical/json"
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/passphrase"
@@ -362,3 +364,78 @@ func TestDownloading0Dot3RepoFormat(t *testing.T) {
 	err = repo.updateTUF(true)
 	require.NoError(t, err, "error updating repo: %s", err)
 }
+
+// When publishing for an older server release, metadata with fields it does
+// not know about is not published, rather than losing the fields, and
+// metadata without them is published as usual
+func TestPublishForOlderServerVersion(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	custom := canonicaljson.RawMessage(`{"key": "value"}`)
+	addTargetCustom := func(repo *repository) {
+		target, err := NewTarget("latest", "../fixtures/intermediate-ca.crt", &custom)
+		require.NoError(t, err)
+		require.NoError(t, repo.AddTarget(target, data.CanonicalTargetsRole))
+	}
+	addDelegationCustom := func(repo *repository) {
+		delgKey, err := repo.GetCryptoService().Create("targets/a", repo.gun, data.ECDSAKey)
+		require.NoError(t, err)
+		require.NoError(t, repo.AddDelegation("targets/a", []data.PublicKey{delgKey}, []string{""}))
+		require.NoError(t, repo.AddDelegationCustom("targets/a", &custom))
+	}
+	addPlain := func(repo *repository) {
+		target, err := NewTarget("plain", "../fixtures/intermediate-ca.crt", nil)
+		require.NoError(t, err)
+		require.NoError(t, repo.AddTarget(target, data.CanonicalTargetsRole))
+	}
+
+	for i, testCase := range []struct {
+		version     string
+		add         func(*repository)
+		unsupported bool
+	}{
+		{version: "", add: addTargetCustom},
+		{version: "", add: addDelegationCustom},
+		{version: "0.6", add: addTargetCustom},
+		{version: "0.7.0", add: addDelegationCustom, unsupported: true},
+		{version: "0.5", add: addTargetCustom, unsupported: true},
+		{version: "0.5", add: addDelegationCustom, unsupported: true},
+		{version: "0.3", add: addPlain},
+	} {
+		gun := data.GUN(fmt.Sprintf("docker.com/notary%d", i))
+		repo, _, baseDir := initializeRepo(t, data.ECDSAKey, gun.String(), ts.URL, false)
+		require.NoError(t, repo.SetServerVersion(testCase.version))
+		testCase.add(repo)
+
+		err := repo.Publish()
+		if testCase.unsupported {
+			require.IsType(t, ErrUnsupportedByServer{}, err, "server version %q", testCase.version)
+			// the changes are still staged, and nothing was published
+			changes := getChanges(t, repo)
+			require.NotEmpty(t, changes)
+			resp, err := http.Get(ts.URL + "/v2/" + gun.String() + "/_trust/tuf/targets.json")
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		} else {
+			require.NoError(t, err, "server version %q", testCase.version)
+		}
+		os.RemoveAll(baseDir)
+	}
+}
+
+// Server versions must be releases no older than the oldest supported one
+func TestSetServerVersionValidation(t *testing.T) {
+	repo := &repository{}
+	for _, version := range []string{"0.3", "0.6.1", "v0.7", "1.0"} {
+		require.NoError(t, repo.SetServerVersion(version))
+		require.NotNil(t, repo.serverVersion)
+	}
+	require.NoError(t, repo.SetServerVersion(""))
+	require.Nil(t, repo.serverVersion)
+
+	for _, version := range []string{"0", "latest", "0.x", "-1.5", "0.2", "0.1.9"} {
+		require.Error(t, repo.SetServerVersion(version), version)
+	}
+}
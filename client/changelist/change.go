@@ -1,6 +1,7 @@
 package changelist
 
 import (
+	"github.com/docker/go/canonical/json"
 	"github.com/theupdateframework/notary/tuf/data"
 )
 
@@ -81,13 +82,17 @@ func (c TUFChange) Content() []byte {
 // this includes creating a delegations. This format is used to avoid
 // unexpected race conditions between humans modifying the same delegation
 type TUFDelegation struct {
-	NewName       data.RoleName `json:"new_name,omitempty"`
-	NewThreshold  int           `json:"threshold,omitempty"`
-	AddKeys       data.KeyList  `json:"add_keys,omitempty"`
-	RemoveKeys    []string      `json:"remove_keys,omitempty"`
-	AddPaths      []string      `json:"add_paths,omitempty"`
-	RemovePaths   []string      `json:"remove_paths,omitempty"`
-	ClearAllPaths bool          `json:"clear_paths,omitempty"`
+	NewName       data.RoleName    `json:"new_name,omitempty"`
+	NewThreshold  int              `json:"threshold,omitempty"`
+	AddKeys       data.KeyList     `json:"add_keys,omitempty"`
+	RemoveKeys    []string         `json:"remove_keys,omitempty"`
+	AddPaths      []string         `json:"add_paths,omitempty"`
+	RemovePaths   []string         `json:"remove_paths,omitempty"`
+	ClearAllPaths bool             `json:"clear_paths,omitempty"`
+	Custom        *json.RawMessage `json:"custom,omitempty"`
+	// Replace sets the keys and paths of the delegation to exactly AddKeys
+	// and AddPaths, rather than adding them to those it already has
+	Replace bool `json:"replace,omitempty"`
 }
 
 // ToNewRole creates a fresh role object from the TUFDelegation data
@@ -1,7 +1,13 @@
 package changelist
 
-// memChangeList implements a simple in memory change list.
+import "sync"
+
+var _ Changelist = &memChangelist{}
+
+// memChangeList implements a simple in memory change list, which is safe for
+// concurrent use.
 type memChangelist struct {
+	mu      sync.Mutex
 	changes []Change
 }
 
@@ -11,23 +17,29 @@ func NewMemChangelist() Changelist {
 }
 
 // List returns a list of Changes
-func (cl memChangelist) List() []Change {
-	return cl.changes
+func (cl *memChangelist) List() []Change {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return append([]Change(nil), cl.changes...)
 }
 
 // Add adds a change to the in-memory change list
 func (cl *memChangelist) Add(c Change) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
 	cl.changes = append(cl.changes, c)
 	return nil
 }
 
 // Location returns the string "memory"
-func (cl memChangelist) Location() string {
+func (cl *memChangelist) Location() string {
 	return "memory"
 }
 
 // Remove deletes the changes found at the given indices
 func (cl *memChangelist) Remove(idxs []int) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
 	remove := make(map[int]struct{})
 	for _, i := range idxs {
 		remove[i] = struct{}{}
@@ -44,8 +56,11 @@ func (cl *memChangelist) Remove(idxs []int) error {
 	return nil
 }
 
-// Clear empties the changelist file.
+// Clear empties the changelist.  Archiving is not supported, so archive is
+// ignored.
 func (cl *memChangelist) Clear(archive string) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
 	// appending to a nil list initializes it.
 	cl.changes = nil
 	return nil
@@ -56,8 +71,9 @@ func (cl *memChangelist) Close() error {
 	return nil
 }
 
+// NewIterator returns an iterator over a snapshot of the current changes
 func (cl *memChangelist) NewIterator() (ChangeIterator, error) {
-	return &MemChangeListIterator{index: 0, collection: cl.changes}, nil
+	return &MemChangeListIterator{index: 0, collection: cl.List()}, nil
 }
 
 // MemChangeListIterator is a concrete instance of ChangeIterator
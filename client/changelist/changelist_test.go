@@ -87,3 +87,42 @@ func TestMemChangelistRemove(t *testing.T) {
 	require.Len(t, chs, 1)
 	require.EqualValues(t, "t3", chs[0].Scope())
 }
+
+// The in-memory changelist supports the full Changelist lifecycle, and the
+// changes it lists are not affected by later modifications
+func TestNewMemChangelist(t *testing.T) {
+	cl := NewMemChangelist()
+	require.Equal(t, "memory", cl.Location())
+	require.Empty(t, cl.List())
+
+	c1 := NewTUFChange(ActionCreate, "targets", "target", "test/targ1", []byte{1})
+	c2 := NewTUFChange(ActionUpdate, "targets", "target", "test/targ2", []byte{2})
+	c3 := NewTUFChange(ActionDelete, "targets", "target", "test/targ3", nil)
+	for _, c := range []Change{c1, c2, c3} {
+		require.NoError(t, cl.Add(c))
+	}
+	listed := cl.List()
+	require.Equal(t, []Change{c1, c2, c3}, listed)
+
+	it, err := cl.NewIterator()
+	require.NoError(t, err)
+
+	require.NoError(t, cl.Remove([]int{1}))
+	require.Equal(t, []Change{c1, c3}, cl.List())
+	require.Equal(t, []Change{c1, c2, c3}, listed)
+
+	// the iterator was created before the removal
+	var iterated []Change
+	for it.HasNext() {
+		c, err := it.Next()
+		require.NoError(t, err)
+		iterated = append(iterated, c)
+	}
+	require.Equal(t, []Change{c1, c2, c3}, iterated)
+
+	require.NoError(t, cl.Clear(""))
+	require.Empty(t, cl.List())
+	require.NoError(t, cl.Add(c2))
+	require.Equal(t, []Change{c2}, cl.List())
+	require.NoError(t, cl.Close())
+}
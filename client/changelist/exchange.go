@@ -0,0 +1,157 @@
+package changelist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// ExportedChange is a staged change in the documented form that notary
+// exports changelists in, and that other tools may generate changelists in
+// to be imported.  Its fields match those of Change, except that the content
+// is JSON rather than bytes, and is left out if there is none.
+type ExportedChange struct {
+	// Action is one of "create", "update" or "delete"
+	Action string `json:"action"`
+	// Scope is the role the change is made to: "root", "targets" or a
+	// delegation role such as "targets/releases"
+	Scope data.RoleName `json:"scope"`
+	// Type is one of "target", "delegation", "role" or "witness"
+	Type string `json:"type"`
+	// Path is the name of the target for target changes, and empty otherwise
+	Path string `json:"path"`
+	// Content is the target's data.FileMeta for a new target, a TUFDelegation
+	// for a delegation or a TUFRootData for the keys of a base role
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+// ExportChanges returns the changes staged in the changelist, in order, in
+// their exported form
+func ExportChanges(cl Changelist) ([]ExportedChange, error) {
+	exported := []ExportedChange{}
+	for i, c := range cl.List() {
+		content := c.Content()
+		if len(content) == 0 {
+			content = nil
+		} else if !json.Valid(content) {
+			return nil, fmt.Errorf("change %d: content is not JSON", i)
+		}
+		exported = append(exported, ExportedChange{
+			Action:  c.Action(),
+			Scope:   c.Scope(),
+			Type:    c.Type(),
+			Path:    c.Path(),
+			Content: content,
+		})
+	}
+	return exported, nil
+}
+
+// ImportChanges reads a JSON array of exported changes and stages them, in
+// order, in the changelist.  Every change is validated before any is staged,
+// so that either all or none of them are.  It returns how many changes were
+// staged.
+func ImportChanges(cl Changelist, r io.Reader) (int, error) {
+	var exported []ExportedChange
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&exported); err != nil {
+		return 0, fmt.Errorf("invalid changelist: %v", err)
+	}
+
+	changes := make([]*TUFChange, 0, len(exported))
+	for i, e := range exported {
+		if err := e.validate(); err != nil {
+			return 0, fmt.Errorf("change %d: %v", i, err)
+		}
+		var content []byte
+		if len(e.Content) > 0 {
+			compacted := &bytes.Buffer{}
+			if err := json.Compact(compacted, e.Content); err != nil {
+				return 0, fmt.Errorf("change %d: %v", i, err)
+			}
+			content = compacted.Bytes()
+		}
+		changes = append(changes, NewTUFChange(e.Action, e.Scope, e.Type, e.Path, content))
+	}
+
+	for i, c := range changes {
+		if err := cl.Add(c); err != nil {
+			return i, err
+		}
+	}
+	return len(changes), nil
+}
+
+// validate checks that the change is one which can be applied at publish time
+func (e ExportedChange) validate() error {
+	switch e.Action {
+	case ActionCreate, ActionUpdate, ActionDelete:
+	default:
+		return fmt.Errorf("unknown action %q", e.Action)
+	}
+
+	isDelegation := data.IsDelegation(e.Scope) || data.IsWildDelegation(e.Scope)
+	switch e.Type {
+	case TypeTargetsTarget:
+		if e.Scope != ScopeTargets && !isDelegation {
+			return fmt.Errorf("targets cannot be changed in %q", e.Scope)
+		}
+		if e.Path == "" {
+			return fmt.Errorf("target change must have a path")
+		}
+		switch e.Action {
+		case ActionCreate:
+			var meta data.FileMeta
+			if err := json.Unmarshal(e.Content, &meta); err != nil {
+				return fmt.Errorf("invalid target content: %v", err)
+			}
+			if meta.Length < 0 {
+				return fmt.Errorf("invalid target length %d", meta.Length)
+			}
+			return data.CheckValidHashStructures(meta.Hashes)
+		case ActionDelete:
+			return nil
+		}
+	case TypeTargetsDelegation:
+		if !isDelegation {
+			return fmt.Errorf("%q is not a delegation role", e.Scope)
+		}
+		if e.Action == ActionDelete {
+			return nil
+		}
+		var td TUFDelegation
+		if err := json.Unmarshal(e.Content, &td); err != nil {
+			return fmt.Errorf("invalid delegation content: %v", err)
+		}
+		return nil
+	case TypeBaseRole:
+		if e.Scope != ScopeRoot {
+			return fmt.Errorf("base roles can only be changed in %q", ScopeRoot)
+		}
+		if e.Action != ActionCreate {
+			break
+		}
+		var rd TUFRootData
+		if err := json.Unmarshal(e.Content, &rd); err != nil {
+			return fmt.Errorf("invalid role content: %v", err)
+		}
+		if !data.IsBaseRole(rd.RoleName) {
+			return fmt.Errorf("%q is not a base role", rd.RoleName)
+		}
+		return nil
+	case TypeWitness:
+		if e.Scope != ScopeTargets && !data.IsDelegation(e.Scope) {
+			return fmt.Errorf("%q cannot be witnessed", e.Scope)
+		}
+		if e.Action == ActionUpdate {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown type %q", e.Type)
+	}
+	return fmt.Errorf("%s is not supported for %s changes", e.Action, e.Type)
+}
@@ -0,0 +1,101 @@
+package changelist
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func exchangeTestChanges(t *testing.T) []Change {
+	meta, err := json.Marshal(data.FileMeta{Length: 3, Hashes: data.Hashes{"sha256": make([]byte, 32)}})
+	require.NoError(t, err)
+	key := data.NewPublicKey(data.ECDSAKey, []byte("key"))
+	delegation, err := json.Marshal(TUFDelegation{NewThreshold: 1, AddKeys: data.KeyList{key}, AddPaths: []string{""}})
+	require.NoError(t, err)
+	rootData, err := json.Marshal(TUFRootData{RoleName: data.CanonicalTargetsRole, Keys: data.KeyList{key}})
+	require.NoError(t, err)
+
+	return []Change{
+		NewTUFChange(ActionCreate, "targets", TypeTargetsTarget, "latest", meta),
+		NewTUFChange(ActionDelete, "targets/releases", TypeTargetsTarget, "old", nil),
+		NewTUFChange(ActionCreate, "targets/releases", TypeTargetsDelegation, "", delegation),
+		NewTUFChange(ActionDelete, "targets/old", TypeTargetsDelegation, "", nil),
+		NewTUFChange(ActionCreate, "root", TypeBaseRole, "targets", rootData),
+		NewTUFChange(ActionUpdate, "targets", TypeWitness, "", nil),
+	}
+}
+
+// A changelist exported, pretty-printed and imported again is staged exactly
+// as it was
+func TestExportImportChanges(t *testing.T) {
+	original := NewMemChangelist()
+	for _, c := range exchangeTestChanges(t) {
+		require.NoError(t, original.Add(c))
+	}
+
+	exported, err := ExportChanges(original)
+	require.NoError(t, err)
+	require.Len(t, exported, len(original.List()))
+	require.Nil(t, exported[1].Content)
+	serialized, err := json.MarshalIndent(exported, "", "  ")
+	require.NoError(t, err)
+
+	imported := NewMemChangelist()
+	count, err := ImportChanges(imported, bytes.NewReader(serialized))
+	require.NoError(t, err)
+	require.Equal(t, len(original.List()), count)
+	require.Equal(t, original.List(), imported.List())
+
+	// an empty changelist is exported as an empty array
+	exported, err = ExportChanges(NewMemChangelist())
+	require.NoError(t, err)
+	serialized, err = json.Marshal(exported)
+	require.NoError(t, err)
+	require.Equal(t, "[]", string(serialized))
+}
+
+// Changes which could not be applied are rejected, and then none of the
+// changes are staged
+func TestImportChangesInvalid(t *testing.T) {
+	validTarget := `{"action": "create", "scope": "targets", "type": "target", "path": "latest", "content": {"length": 3, "hashes": {"sha256": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}}`
+	for _, invalid := range []string{
+		`not json`,
+		`{"action": "create"}`,
+		`[{"action": "create", "scope": "targets", "type": "target", "path": "latest", "data": "AQ=="}]`,
+		`[{"action": "move", "scope": "targets", "type": "target", "path": "latest"}]`,
+		`[{"action": "delete", "scope": "snapshot", "type": "target", "path": "latest"}]`,
+		`[{"action": "delete", "scope": "targets", "type": "target", "path": ""}]`,
+		`[{"action": "update", "scope": "targets", "type": "target", "path": "latest"}]`,
+		`[{"action": "create", "scope": "targets", "type": "target", "path": "latest", "content": {"length": 3, "hashes": {}}}]`,
+		`[{"action": "create", "scope": "targets", "type": "target", "path": "latest"}]`,
+		`[{"action": "create", "scope": "targets", "type": "delegation", "path": "", "content": {}}]`,
+		`[{"action": "create", "scope": "targets/releases", "type": "delegation", "path": "", "content": {"threshold": "one"}}]`,
+		`[{"action": "create", "scope": "root", "type": "role", "path": "", "content": {"role": "targets/releases", "keys": []}}]`,
+		`[{"action": "delete", "scope": "root", "type": "role", "path": ""}]`,
+		`[{"action": "update", "scope": "root", "type": "witness", "path": ""}]`,
+		`[{"action": "update", "scope": "targets", "type": "unknown", "path": ""}]`,
+		`[` + validTarget + `, {"action": "delete", "scope": "targets", "type": "target", "path": ""}]`,
+	} {
+		cl := NewMemChangelist()
+		_, err := ImportChanges(cl, strings.NewReader(invalid))
+		require.Error(t, err, invalid)
+		require.Empty(t, cl.List(), invalid)
+	}
+
+	cl := NewMemChangelist()
+	count, err := ImportChanges(cl, strings.NewReader(`[`+validTarget+`]`))
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+// Content which is not JSON can't be exported
+func TestExportChangesNotJSON(t *testing.T) {
+	cl := NewMemChangelist()
+	require.NoError(t, cl.Add(NewTUFChange(ActionCreate, "targets", TypeTargetsTarget, "latest", []byte{1})))
+	_, err := ExportChanges(cl)
+	require.Error(t, err)
+}
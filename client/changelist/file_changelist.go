@@ -13,6 +13,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+var _ Changelist = &FileChangelist{}
+
 // FileChangelist stores all the changes as files
 type FileChangelist struct {
 	dir string
@@ -2,7 +2,10 @@ package changelist
 
 import "github.com/theupdateframework/notary/tuf/data"
 
-// Changelist is the interface for all TUF change lists
+// Changelist is the interface for all TUF change lists.  It is the storage
+// for a repository's staged changes, so implementations other than the
+// default FileChangelist may be used to keep changes in memory or in a
+// database; see NewMemChangelist for an in-memory implementation.
 type Changelist interface {
 	// List returns the ordered list of changes
 	// currently stored
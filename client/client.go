@@ -3,12 +3,16 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	canonicaljson "github.com/docker/go/canonical/json"
@@ -17,6 +21,8 @@ import (
 	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/cryptoservice"
 	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tracing"
+	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -29,10 +35,15 @@ const (
 
 	// SignWithAllOldVersions is a sentinel constant for LegacyVersions flag
 	SignWithAllOldVersions = -1
+
+	// verificationCacheSize bounds how many verified signatures are cached,
+	// since the same metadata is verified again on every update
+	verificationCacheSize = 1024
 )
 
 func init() {
 	data.SetDefaultExpiryTimes(data.NotaryDefaultExpiries)
+	signed.SetVerificationCacheSize(verificationCacheSize)
 }
 
 // repository stores all the information needed to operate on a notary repository.
@@ -47,6 +58,13 @@ type repository struct {
 	invalid        *tuf.Repo // known data that was parsable but deemed invalid
 	trustPinning   trustpinning.TrustPinConfig
 	LegacyVersions int // number of versions back to fetch roots to sign with
+
+	publishProgress    PublishProgressFunc
+	clockSkewThreshold time.Duration  // how far ahead the local clock may be before expiry is blamed on it
+	serverVersion      *serverVersion // release of an old server to publish compatible metadata for
+
+	signatureAlgorithms signed.AlgorithmPolicy // algorithms that roles must be signed with
+	clock               data.Clock             // tells the time that metadata expires and is signed from
 }
 
 // NewFileCachedRepository is a wrapper for NewRepository that initializes
@@ -59,20 +77,23 @@ type repository struct {
 func NewFileCachedRepository(baseDir string, gun data.GUN, baseURL string, rt http.RoundTripper,
 	retriever notary.PassRetriever, trustPinning trustpinning.TrustPinConfig) (Repository, error) {
 
-	cache, err := store.NewFileStore(
-		filepath.Join(baseDir, tufDir, filepath.FromSlash(gun.String()), "metadata"),
-		"json",
-	)
+	cl, err := changelist.NewFileChangelist(filepath.Join(
+		filepath.Join(baseDir, tufDir, filepath.FromSlash(gun.String()), "changelist"),
+	))
 	if err != nil {
 		return nil, err
 	}
 
-	keyStores, err := getKeyStores(baseDir, retriever)
-	if err != nil {
-		return nil, err
-	}
+	return NewFileCachedRepositoryWithChangelist(baseDir, gun, baseURL, rt, retriever, trustPinning, cl)
+}
 
-	cryptoService := cryptoservice.NewCryptoService(keyStores...)
+// NewFileCachedRepositoryWithChangelist is like NewFileCachedRepository, but
+// stages unpublished changes in the given changelist instead of on disk under
+// the base directory.  This allows callers to keep the changelist in memory,
+// using changelist.NewMemChangelist, or in any other storage which implements
+// changelist.Changelist.
+func NewFileCachedRepositoryWithChangelist(baseDir string, gun data.GUN, baseURL string, rt http.RoundTripper,
+	retriever notary.PassRetriever, trustPinning trustpinning.TrustPinConfig, cl changelist.Changelist) (Repository, error) {
 
 	remoteStore, err := getRemoteStore(baseURL, gun, rt)
 	if err != nil {
@@ -80,6 +101,16 @@ func NewFileCachedRepository(baseDir string, gun data.GUN, baseURL string, rt ht
 		return nil, err
 	}
 
+	return newFileCachedRepository(baseDir, gun, baseURL, remoteStore, retriever, trustPinning, cl)
+}
+
+// NewFileCachedRepositoryWithRemoteStore is like NewFileCachedRepository, but
+// downloads and publishes trust data through the given remote store, such as a
+// store.OCIStore, instead of talking to a notary server at baseURL.  baseURL is
+// only used to describe where the trust data comes from.
+func NewFileCachedRepositoryWithRemoteStore(baseDir string, gun data.GUN, baseURL string, remoteStore store.RemoteStore,
+	retriever notary.PassRetriever, trustPinning trustpinning.TrustPinConfig) (Repository, error) {
+
 	cl, err := changelist.NewFileChangelist(filepath.Join(
 		filepath.Join(baseDir, tufDir, filepath.FromSlash(gun.String()), "changelist"),
 	))
@@ -87,9 +118,58 @@ func NewFileCachedRepository(baseDir string, gun data.GUN, baseURL string, rt ht
 		return nil, err
 	}
 
+	return newFileCachedRepository(baseDir, gun, baseURL, remoteStore, retriever, trustPinning, cl)
+}
+
+func newFileCachedRepository(baseDir string, gun data.GUN, baseURL string, remoteStore store.RemoteStore,
+	retriever notary.PassRetriever, trustPinning trustpinning.TrustPinConfig, cl changelist.Changelist) (Repository, error) {
+
+	if cl == nil {
+		return nil, fmt.Errorf("got an invalid changelist (nil changelist)")
+	}
+
+	fileCache, err := store.NewFileStore(
+		filepath.Join(baseDir, tufDir, filepath.FromSlash(gun.String()), "metadata"),
+		"json",
+	)
+	if err != nil {
+		return nil, err
+	}
+	// compression is off until SetCacheCompression turns it on, but metadata
+	// which was cached compressed can always be read
+	cache := store.NewCompressedStore(fileCache, false)
+
+	keyStores, err := getKeyStores(baseDir, retriever)
+	if err != nil {
+		return nil, err
+	}
+
+	cryptoService := cryptoservice.NewCryptoService(keyStores...)
+
 	return NewRepository(gun, baseURL, remoteStore, cache, trustPinning, cryptoService, cl)
 }
 
+// NewInMemoryRepository is a wrapper for NewRepository that keeps private keys,
+// cached TUF metadata and unpublished changes entirely in memory.  Nothing is
+// written to disk, which makes it convenient for testing code that drives a
+// notary repository.  All state is lost once the repository is discarded.
+//
+// In case of a nil RoundTripper, a default offline store is used instead.
+func NewInMemoryRepository(gun data.GUN, baseURL string, rt http.RoundTripper,
+	retriever notary.PassRetriever, trustPinning trustpinning.TrustPinConfig) (Repository, error) {
+
+	cryptoService := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(retriever))
+
+	remoteStore, err := getRemoteStore(baseURL, gun, rt)
+	if err != nil {
+		// baseURL is syntactically invalid
+		return nil, err
+	}
+
+	return NewRepository(gun, baseURL, remoteStore, store.NewMemoryStore(nil), trustPinning,
+		cryptoService, changelist.NewMemChangelist())
+}
+
 // NewRepository is the base method that returns a new notary repository.
 // It expects an initialized cache. In case of a nil remote store, a default
 // offline store is used.
@@ -125,6 +205,18 @@ func (r *repository) GetGUN() data.GUN {
 }
 
 func (r *repository) updateTUF(forWrite bool) error {
+	return r.updateTUFContext(context.Background(), forWrite)
+}
+
+// updateTUFContext is updateTUF, traced as a span within the one held by the
+// context
+func (r *repository) updateTUFContext(ctx context.Context, forWrite bool) (err error) {
+	_, span := tracing.Start(ctx, "notary.client.fetch")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	repo, invalid, err := LoadTUFRepo(TUFLoadOptions{
 		GUN:                    r.gun,
 		TrustPinning:           r.trustPinning,
@@ -132,6 +224,9 @@ func (r *repository) updateTUF(forWrite bool) error {
 		Cache:                  r.cache,
 		RemoteStore:            r.remoteStore,
 		AlwaysCheckInitialized: forWrite,
+		ClockSkewThreshold:     r.clockSkewThreshold,
+		SignatureAlgorithms:    r.signatureAlgorithms,
+		Clock:                  r.clock,
 	})
 	if err != nil {
 		return err
@@ -141,6 +236,47 @@ func (r *repository) updateTUF(forWrite bool) error {
 	return nil
 }
 
+// Rebuild clears the cached metadata of the repository, then downloads and
+// verifies it afresh from the remote server.  The cached root is kept as the
+// trust anchor if it is intact, so that trust is not reset by a cache which
+// is otherwise corrupted; if it is not, trust is bootstrapped from the server
+// again, subject to the trust pinning configuration.  Keys and staged changes
+// are left untouched.
+func (r *repository) Rebuild() error {
+	rootJSON, err := r.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	if err == nil {
+		// expired roots are still an intact trust anchor, from which the
+		// update rotates to the current root
+		builder := tuf.NewRepoBuilder(r.gun, r.cryptoService, trustpinning.TrustPinConfig{})
+		if err := builder.Load(data.CanonicalRootRole, rootJSON, 1, true); err != nil {
+			logrus.Warnf("cached root for %s is invalid, so trust will be bootstrapped from the server: %v", r.gun, err)
+			rootJSON = nil
+		}
+	} else {
+		rootJSON = nil
+	}
+
+	// the time the root was trusted on first use goes along with the root
+	pin, pinErr := r.cache.GetSized(tofuPinRecord, store.NoSizeLimit)
+
+	if err := r.cache.RemoveAll(); err != nil {
+		return fmt.Errorf("error clearing cached metadata: %v", err)
+	}
+	if rootJSON != nil {
+		if err := r.cache.Set(data.CanonicalRootRole.String(), rootJSON); err != nil {
+			return err
+		}
+		if pinErr == nil {
+			if err := r.cache.Set(tofuPinRecord, pin); err != nil {
+				return err
+			}
+		}
+	}
+	r.tufRepo = nil
+	r.invalid = nil
+	return r.updateTUF(true)
+}
+
 // ListTargets calls update first before listing targets
 func (r *repository) ListTargets(roles ...data.RoleName) ([]*TargetWithRole, error) {
 	if err := r.updateTUF(false); err != nil {
@@ -174,6 +310,47 @@ func (r *repository) ListRoles() ([]RoleWithSignatures, error) {
 	return NewReadOnly(r.tufRepo).ListRoles()
 }
 
+// ListRoleExpiries loads the latest metadata, even if it has expired, and
+// returns when the metadata of each role expires: root, targets, the
+// delegations by name, snapshot and then timestamp.  The metadata is only
+// inspected, and is not kept as the repository's trusted metadata.
+func (r *repository) ListRoleExpiries() ([]RoleExpiry, error) {
+	repo, _, err := LoadTUFRepo(TUFLoadOptions{
+		GUN:                 r.gun,
+		TrustPinning:        r.trustPinning,
+		CryptoService:       r.cryptoService,
+		Cache:               r.cache,
+		RemoteStore:         r.remoteStore,
+		ClockSkewThreshold:  r.clockSkewThreshold,
+		AllowExpired:        true,
+		SignatureAlgorithms: r.signatureAlgorithms,
+		Clock:               r.clock,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := func(role data.RoleName, common data.SignedCommon) RoleExpiry {
+		return RoleExpiry{Role: role, Version: common.Version, Expires: common.Expires}
+	}
+	expiries := []RoleExpiry{expiry(data.CanonicalRootRole, repo.Root.Signed.SignedCommon)}
+	targetsRoles := make([]string, 0, len(repo.Targets))
+	for role := range repo.Targets {
+		targetsRoles = append(targetsRoles, role.String())
+	}
+	sort.Strings(targetsRoles)
+	for _, role := range targetsRoles {
+		expiries = append(expiries, expiry(data.RoleName(role), repo.Targets[data.RoleName(role)].Signed.SignedCommon))
+	}
+	if repo.Snapshot != nil {
+		expiries = append(expiries, expiry(data.CanonicalSnapshotRole, repo.Snapshot.Signed.SignedCommon))
+	}
+	if repo.Timestamp != nil {
+		expiries = append(expiries, expiry(data.CanonicalTimestampRole, repo.Timestamp.Signed.SignedCommon))
+	}
+	return expiries, nil
+}
+
 // GetDelegationRoles calls update first before getting all delegation roles
 func (r *repository) GetDelegationRoles() ([]data.Role, error) {
 	if err := r.updateTUF(false); err != nil {
@@ -182,14 +359,36 @@ func (r *repository) GetDelegationRoles() ([]data.Role, error) {
 	return NewReadOnly(r.tufRepo).GetDelegationRoles()
 }
 
-// NewTarget is a helper method that returns a Target
-func NewTarget(targetName, targetPath string, targetCustom *canonicaljson.RawMessage) (*Target, error) {
+// GetDelegationKeys calls update first before getting the keys of a delegation role
+func (r *repository) GetDelegationKeys(name data.RoleName) (map[string]data.PublicKey, error) {
+	if err := r.updateTUF(false); err != nil {
+		return nil, err
+	}
+	return NewReadOnly(r.tufRepo).GetDelegationKeys(name)
+}
+
+// VerifyDetachedSignature calls update first before verifying the signatures
+// against the role's keys
+func (r *repository) VerifyDetachedSignature(role data.RoleName, msg []byte, sigs []data.Signature) ([]string, error) {
+	if err := r.updateTUF(false); err != nil {
+		return nil, err
+	}
+	return NewReadOnly(r.tufRepo).VerifyDetachedSignature(role, msg, sigs)
+}
+
+// NewTarget is a helper method that returns a Target.  The hashes of the file
+// are computed with the given hash algorithms, or with data.NotaryDefaultHashes
+// if none are given.
+func NewTarget(targetName, targetPath string, targetCustom *canonicaljson.RawMessage, hashAlgorithms ...string) (*Target, error) {
+	if len(hashAlgorithms) == 0 {
+		hashAlgorithms = data.NotaryDefaultHashes
+	}
 	b, err := ioutil.ReadFile(targetPath)
 	if err != nil {
 		return nil, err
 	}
 
-	meta, err := data.NewFileMeta(bytes.NewBuffer(b), data.NotaryDefaultHashes...)
+	meta, err := data.NewFileMeta(bytes.NewBuffer(b), hashAlgorithms...)
 	if err != nil {
 		return nil, err
 	}
@@ -197,10 +396,40 @@ func NewTarget(targetName, targetPath string, targetCustom *canonicaljson.RawMes
 	return &Target{Name: targetName, Hashes: meta.Hashes, Length: meta.Length, Custom: targetCustom}, nil
 }
 
-// rootCertKey generates the corresponding certificate for the private key given the privKey and repo's GUN
-func rootCertKey(gun data.GUN, privKey data.PrivateKey) (data.PublicKey, error) {
+// NewTargetFromReader is a helper method that returns a Target for the content
+// read from r, such as a pipe or network stream.  The content is hashed as it
+// is read, so it is never held in memory or written to a file.  If size is not
+// negative, r must give exactly that many bytes; otherwise the length is that
+// of whatever r gives.  The hashes are computed with the given hash algorithms,
+// or with data.NotaryDefaultHashes if none are given.
+func NewTargetFromReader(targetName string, r io.Reader, size int64, targetCustom *canonicaljson.RawMessage, hashAlgorithms ...string) (*Target, error) {
+	if len(hashAlgorithms) == 0 {
+		hashAlgorithms = data.NotaryDefaultHashes
+	}
+	if size >= 0 {
+		// read at most one byte more than expected, to tell that there was
+		// more without reading the rest of a long stream
+		r = io.LimitReader(r, size+1)
+	}
+
+	meta, err := data.NewFileMeta(r, hashAlgorithms...)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && meta.Length != size {
+		if meta.Length > size {
+			return nil, fmt.Errorf("target \"%s\" is longer than the expected %d bytes", targetName, size)
+		}
+		return nil, fmt.Errorf("target \"%s\" is %d bytes rather than the expected %d bytes", targetName, meta.Length, size)
+	}
+
+	return &Target{Name: targetName, Hashes: meta.Hashes, Length: meta.Length, Custom: targetCustom}, nil
+}
+
+// rootCertKey generates the corresponding certificate for the private key given the privKey and repo's GUN,
+// valid from startTime
+func rootCertKey(gun data.GUN, privKey data.PrivateKey, startTime time.Time) (data.PublicKey, error) {
 	// Hard-coded policy: the generated certificate expires in 10 years.
-	startTime := time.Now()
 	cert, err := cryptoservice.GenerateCertificate(
 		privKey, gun, startTime, startTime.Add(notary.Year*10))
 	if err != nil {
@@ -220,8 +449,29 @@ func (r *repository) GetCryptoService() signed.CryptoService {
 	return r.cryptoService
 }
 
+// InitOptions are the optional choices made when initializing a repository
+type InitOptions struct {
+	// RootCerts are the certificates of the root keys, in the same order as
+	// their key IDs.  If no root key IDs are given, the keys are looked up by
+	// the certificates instead.
+	RootCerts []data.PublicKey
+	// RemoteKeyAlgorithm is the algorithm the remote server is asked to use
+	// when it generates the keys of server-managed roles.  An empty algorithm
+	// leaves the choice to the server.
+	RemoteKeyAlgorithm string
+	// TargetsKeyID is the ID of a targets key, already in the repository's
+	// crypto service, to initialize the targets role with instead of
+	// generating a new key, for instance when migrating an existing
+	// repository
+	TargetsKeyID string
+	// RootExpiry is how long the root is valid for.  Zero uses the default
+	// expiry of the root role.
+	RootExpiry time.Duration
+}
+
 // initialize initializes the notary repository with a set of rootkeys, root certificates and roles.
-func (r *repository) initialize(rootKeyIDs []string, rootCerts []data.PublicKey, serverManagedRoles ...data.RoleName) error {
+func (r *repository) initialize(rootKeyIDs []string, opts InitOptions, serverManagedRoles ...data.RoleName) error {
+	rootCerts := opts.RootCerts
 
 	// currently we only support server managing timestamps and snapshots, and
 	// nothing else - timestamps are always managed by the server, and implicit
@@ -267,12 +517,14 @@ func (r *repository) initialize(rootKeyIDs []string, rootCerts []data.PublicKey,
 		publicKeys,
 		locallyManagedKeys,
 		remotelyManagedKeys,
+		opts,
 	)
 	if err != nil {
 		return err
 	}
 
 	r.tufRepo = tuf.NewRepo(r.GetCryptoService())
+	r.tufRepo.SetSignatureAlgorithms(r.signatureAlgorithms)
 
 	if err := r.tufRepo.InitRoot(
 		rootRole,
@@ -293,7 +545,7 @@ func (r *repository) initialize(rootKeyIDs []string, rootCerts []data.PublicKey,
 		return err
 	}
 
-	return r.saveMetadata(serverManagesSnapshot)
+	return r.saveMetadata(serverManagesSnapshot, opts.RootExpiry)
 }
 
 // createNewPublicKeyFromKeyIDs generates a set of public keys corresponding to the given list of
@@ -308,7 +560,7 @@ func (r *repository) createNewPublicKeyFromKeyIDs(keyIDs []string) ([]data.Publi
 	}
 
 	for _, privKey := range privKeys {
-		rootKey, err := rootCertKey(r.gun, privKey)
+		rootKey, err := rootCertKey(r.gun, privKey, r.now())
 		if err != nil {
 			return nil, err
 		}
@@ -356,7 +608,7 @@ func matchKeyIdsWithPubKeys(r *repository, ids []string, pubKeys []data.PublicKe
 // result is only stored on local disk, not published to the server. To do that,
 // use r.Publish() eventually.
 func (r *repository) Initialize(rootKeyIDs []string, serverManagedRoles ...data.RoleName) error {
-	return r.initialize(rootKeyIDs, nil, serverManagedRoles...)
+	return r.initialize(rootKeyIDs, InitOptions{}, serverManagedRoles...)
 }
 
 type errKeyNotFound struct{}
@@ -381,16 +633,23 @@ func keyExistsInList(cert data.PublicKey, ids map[string]bool) error {
 // InitializeWithCertificate initializes the repository with root keys and their corresponding certificates
 func (r *repository) InitializeWithCertificate(rootKeyIDs []string, rootCerts []data.PublicKey,
 	serverManagedRoles ...data.RoleName) error {
+	return r.InitializeWithOptions(rootKeyIDs, InitOptions{RootCerts: rootCerts}, serverManagedRoles...)
+}
+
+// InitializeWithOptions initializes the repository with root keys, making
+// the optional choices in opts
+func (r *repository) InitializeWithOptions(rootKeyIDs []string, opts InitOptions,
+	serverManagedRoles ...data.RoleName) error {
 
 	// If we explicitly pass in certificate(s) but not key, then look keys up using certificate
-	if len(rootKeyIDs) == 0 && len(rootCerts) != 0 {
+	if len(rootKeyIDs) == 0 && len(opts.RootCerts) != 0 {
 		rootKeyIDs = []string{}
 		availableRootKeyIDs := make(map[string]bool)
 		for _, k := range r.GetCryptoService().ListKeys(data.CanonicalRootRole) {
 			availableRootKeyIDs[k] = true
 		}
 
-		for _, cert := range rootCerts {
+		for _, cert := range opts.RootCerts {
 			if err := keyExistsInList(cert, availableRootKeyIDs); err != nil {
 				return fmt.Errorf("error initializing repository with certificate: %v", err)
 			}
@@ -398,10 +657,10 @@ func (r *repository) InitializeWithCertificate(rootKeyIDs []string, rootCerts []
 			rootKeyIDs = append(rootKeyIDs, keyID)
 		}
 	}
-	return r.initialize(rootKeyIDs, rootCerts, serverManagedRoles...)
+	return r.initialize(rootKeyIDs, opts, serverManagedRoles...)
 }
 
-func (r *repository) initializeRoles(rootKeys []data.PublicKey, localRoles, remoteRoles []data.RoleName) (
+func (r *repository) initializeRoles(rootKeys []data.PublicKey, localRoles, remoteRoles []data.RoleName, opts InitOptions) (
 	root, targets, snapshot, timestamp data.BaseRole, err error) {
 	root = data.NewBaseRole(
 		data.CanonicalRootRole,
@@ -412,9 +671,13 @@ func (r *repository) initializeRoles(rootKeys []data.PublicKey, localRoles, remo
 	// we want to create all the local keys first so we don't have to
 	// make unnecessary network calls
 	for _, role := range localRoles {
-		// This is currently hardcoding the keys to ECDSA.
 		var key data.PublicKey
-		key, err = r.GetCryptoService().Create(role, r.gun, data.ECDSAKey)
+		if role == data.CanonicalTargetsRole && opts.TargetsKeyID != "" {
+			key, err = r.existingTargetsKey(opts.TargetsKeyID)
+		} else {
+			// This is currently hardcoding the keys to ECDSA.
+			key, err = r.GetCryptoService().Create(role, r.gun, data.ECDSAKey)
+		}
 		if err != nil {
 			return
 		}
@@ -439,7 +702,7 @@ func (r *repository) initializeRoles(rootKeys []data.PublicKey, localRoles, remo
 	for _, role := range remoteRoles {
 		// This key is generated by the remote server.
 		var key data.PublicKey
-		key, err = getRemoteKey(role, remote)
+		key, err = getRemoteKey(role, remote, opts.RemoteKeyAlgorithm)
 		if err != nil {
 			return
 		}
@@ -518,6 +781,18 @@ func (r *repository) AddTarget(target *Target, roles ...data.RoleName) error {
 	return addChange(r.changelist, template, roles...)
 }
 
+// AddTargetWithReader creates new changelist entries to add a target, whose
+// content is read from the reader and hashed as it is read, to the given roles.
+// If size is negative, the size of the target is not known in advance.
+// If roles are unspecified, the default role is "targets"
+func (r *repository) AddTargetWithReader(targetName string, reader io.Reader, size int64, roles ...data.RoleName) error {
+	target, err := NewTargetFromReader(targetName, reader, size, nil)
+	if err != nil {
+		return err
+	}
+	return r.AddTarget(target, roles...)
+}
+
 // RemoveTarget creates new changelist entries to remove a target from the given
 // roles in the repository when the changelist gets applied at publish time.
 // If roles are unspecified, the default role is "target".
@@ -545,6 +820,17 @@ func (r *repository) getRemoteStore() store.RemoteStore {
 	return r.remoteStore
 }
 
+// setMultiContext uploads the metadata to the remote store, propagating the
+// trace of the span held by the context to the server if the store supports it
+func setMultiContext(ctx context.Context, remote store.RemoteStore, metas map[string][]byte) error {
+	if traced, ok := remote.(interface {
+		SetMultiContext(context.Context, map[string][]byte) error
+	}); ok {
+		return traced.SetMultiContext(ctx, metas)
+	}
+	return remote.SetMulti(metas)
+}
+
 // Publish pushes the local changes in signed material to the remote notary-server
 // Conceptually it performs an operation similar to a `git rebase`
 func (r *repository) Publish() error {
@@ -560,12 +846,69 @@ func (r *repository) Publish() error {
 	return nil
 }
 
+// PublishRoles pushes only the staged changes to the given roles to the remote
+// notary-server, leaving changes to other roles staged.  A change belongs to
+// the role it is scoped to, so changes to a delegation, such as adding its
+// keys, belong to the delegation rather than to its parent.  The snapshot is
+// re-signed as for any publish.  If no roles are given, every staged change
+// is published.
+func (r *repository) PublishRoles(roles ...data.RoleName) error {
+	if len(roles) == 0 {
+		return r.Publish()
+	}
+	selected := make(map[data.RoleName]bool, len(roles))
+	for _, role := range roles {
+		if role != data.CanonicalRootRole && role != data.CanonicalTargetsRole &&
+			!data.IsDelegation(role) && !data.IsWildDelegation(role) {
+			return data.ErrInvalidRole{
+				Role:   role,
+				Reason: "changes can only be staged for the root, targets or delegation roles",
+			}
+		}
+		selected[role] = true
+	}
+
+	cl := changelist.NewMemChangelist()
+	var published []int
+	for i, c := range r.changelist.List() {
+		if !selected[c.Scope()] {
+			continue
+		}
+		if err := cl.Add(c); err != nil {
+			return err
+		}
+		published = append(published, i)
+	}
+	if len(published) == 0 {
+		return fmt.Errorf("no staged changes to publish for %s", strings.Join(data.RolesListToStringList(roles), ", "))
+	}
+
+	if err := r.publish(cl); err != nil {
+		return err
+	}
+	if err := r.changelist.Remove(published); err != nil {
+		// As when publishing everything, the published changes would be
+		// applied again by the next publish.
+		logrus.Warn("Unable to remove published changes from the changelist. You may want to manually remove them from ", r.changelist.Location())
+	}
+	return nil
+}
+
 // publish pushes the changes in the given changelist to the remote notary-server
 // Conceptually it performs an operation similar to a `git rebase`
-func (r *repository) publish(cl changelist.Changelist) error {
+func (r *repository) publish(cl changelist.Changelist) (err error) {
+	ctx, span := tracing.Start(context.Background(), "notary.client.publish")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	event := PublishEvent{Stage: PublishLoadingChangelist, Changes: len(cl.List())}
+	r.reportPublishProgress(event)
+
 	var initialPublish bool
 	// update first before publishing
-	if err := r.updateTUF(true); err != nil {
+	if err := r.updateTUFContext(ctx, true); err != nil {
 		// If the remote is not aware of the repo, then this is being published
 		// for the first time.  Try to initialize the repository before publishing.
 		if _, ok := err.(ErrRepositoryNotExist); ok {
@@ -591,46 +934,94 @@ func (r *repository) publish(cl changelist.Changelist) error {
 			return err
 		}
 	}
+	event.Stage = PublishBuildingMetadata
+	r.reportPublishProgress(event)
+
 	// apply the changelist to the repo
 	if err := applyChangelist(r.tufRepo, r.invalid, cl); err != nil {
 		logrus.Debug("Error applying changelist")
 		return err
 	}
 
+	// Fetch old keys to support old clients
+	legacyKeys, err := r.oldKeysForLegacyClientSupport(r.LegacyVersions, initialPublish)
+	if err != nil {
+		return err
+	}
+
+	if err := checkLegacyFields(r.tufRepo, r.serverVersion); err != nil {
+		return err
+	}
 	// these are the TUF files we will need to update, serialized as JSON before
 	// we send anything to remote
-	updatedFiles := make(map[data.RoleName][]byte)
+	_, signSpan := tracing.Start(ctx, "notary.client.sign")
+	updatedFiles, err := signUpdatedMetadata(r.tufRepo, legacyKeys, initialPublish, r.now())
+	signSpan.SetError(err)
+	signSpan.End()
+	if err != nil {
+		return err
+	}
 
-	// Fetch old keys to support old clients
-	legacyKeys, err := r.oldKeysForLegacyClientSupport(r.LegacyVersions, initialPublish)
+	event.Stage = PublishUploading
+	for role := range updatedFiles {
+		event.Roles = append(event.Roles, role)
+	}
+	sort.Slice(event.Roles, func(i, j int) bool { return event.Roles[i] < event.Roles[j] })
+	r.reportPublishProgress(event)
+
+	uploadCtx, uploadSpan := tracing.Start(ctx, "notary.client.upload")
+	err = setMultiContext(uploadCtx, r.getRemoteStore(), data.MetadataRoleMapToStringMap(updatedFiles))
+	uploadSpan.SetError(err)
+	uploadSpan.End()
 	if err != nil {
 		return err
 	}
 
+	event.Stage = PublishConfirming
+	r.reportPublishProgress(event)
+	return nil
+}
+
+// signUpdatedMetadata signs the roles which have changed in the repo, as well
+// as the snapshot if a key for it is available, and returns them serialized
+// as JSON by role.  The signed metadata is valid from now.
+func signUpdatedMetadata(repo *tuf.Repo, legacyKeys data.KeyList, initialPublish bool, now time.Time) (map[data.RoleName][]byte, error) {
+	updatedFiles := make(map[data.RoleName][]byte)
+
 	// check if our root file is nearing expiry or dirty. Resign if it is.  If
 	// root is not dirty but we are publishing for the first time, then just
 	// publish the existing root we have.
-	if err := signRootIfNecessary(updatedFiles, r.tufRepo, legacyKeys, initialPublish); err != nil {
-		return err
+	if err := signRootIfNecessary(updatedFiles, repo, legacyKeys, initialPublish, now); err != nil {
+		return nil, err
 	}
 
-	if err := signTargets(updatedFiles, r.tufRepo, initialPublish); err != nil {
-		return err
+	if err := signTargets(updatedFiles, repo, initialPublish, now); err != nil {
+		return nil, err
 	}
 
+	if err := signSnapshotIfPossible(updatedFiles, repo, now); err != nil {
+		return nil, err
+	}
+	return updatedFiles, nil
+}
+
+// signSnapshotIfPossible signs the snapshot if a key for it is available, and
+// adds it to updates.  If no snapshot key is available, the server is assumed
+// to sign the snapshot.
+func signSnapshotIfPossible(updates map[data.RoleName][]byte, repo *tuf.Repo, now time.Time) error {
 	// if we initialized the repo while designating the server as the snapshot
 	// signer, then there won't be a snapshots file.  However, we might now
 	// have a local key (if there was a rotation), so initialize one.
-	if r.tufRepo.Snapshot == nil {
-		if err := r.tufRepo.InitSnapshot(); err != nil {
+	if repo.Snapshot == nil {
+		if err := repo.InitSnapshot(); err != nil {
 			return err
 		}
 	}
 
 	if snapshotJSON, err := serializeCanonicalRole(
-		r.tufRepo, data.CanonicalSnapshotRole, nil); err == nil {
+		repo, data.CanonicalSnapshotRole, nil, now); err == nil {
 		// Only update the snapshot if we've successfully signed it.
-		updatedFiles[data.CanonicalSnapshotRole] = snapshotJSON
+		updates[data.CanonicalSnapshotRole] = snapshotJSON
 	} else if signErr, ok := err.(signed.ErrInsufficientSignatures); ok && signErr.FoundKeys == 0 {
 		// If signing fails due to us not having the snapshot key, then
 		// assume the server is going to sign, and do not include any snapshot
@@ -641,18 +1032,15 @@ func (r *repository) publish(cl changelist.Changelist) error {
 		logrus.Debugf("Client was unable to sign the snapshot: %s", err.Error())
 		return err
 	}
-
-	remote := r.getRemoteStore()
-
-	return remote.SetMulti(data.MetadataRoleMapToStringMap(updatedFiles))
+	return nil
 }
 
-func signRootIfNecessary(updates map[data.RoleName][]byte, repo *tuf.Repo, extraSigningKeys data.KeyList, initialPublish bool) error {
+func signRootIfNecessary(updates map[data.RoleName][]byte, repo *tuf.Repo, extraSigningKeys data.KeyList, initialPublish bool, now time.Time) error {
 	if len(extraSigningKeys) > 0 {
 		repo.Root.Dirty = true
 	}
-	if nearExpiry(repo.Root.Signed.SignedCommon) || repo.Root.Dirty {
-		rootJSON, err := serializeCanonicalRole(repo, data.CanonicalRootRole, extraSigningKeys)
+	if nearExpiry(repo.Root.Signed.SignedCommon, now) || repo.Root.Dirty {
+		rootJSON, err := serializeCanonicalRole(repo, data.CanonicalRootRole, extraSigningKeys, now)
 		if err != nil {
 			return err
 		}
@@ -747,11 +1135,11 @@ func getOldRootPublicKeys(root *data.SignedRoot) data.KeyList {
 	return rootRole.ListKeys()
 }
 
-func signTargets(updates map[data.RoleName][]byte, repo *tuf.Repo, initialPublish bool) error {
+func signTargets(updates map[data.RoleName][]byte, repo *tuf.Repo, initialPublish bool, now time.Time) error {
 	// iterate through all the targets files - if they are dirty, sign and update
 	for roleName, roleObj := range repo.Targets {
 		if roleObj.Dirty || (roleName == data.CanonicalTargetsRole && initialPublish) {
-			targetsJSON, err := serializeCanonicalRole(repo, roleName, nil)
+			targetsJSON, err := serializeCanonicalRole(repo, roleName, nil, now)
 			if err != nil {
 				return err
 			}
@@ -768,6 +1156,7 @@ func signTargets(updates map[data.RoleName][]byte, repo *tuf.Repo, initialPublis
 // This assumes that bootstrapRepo is only used by Publish() or RotateKey()
 func (r *repository) bootstrapRepo() error {
 	b := tuf.NewRepoBuilder(r.gun, r.GetCryptoService(), r.trustPinning)
+	b.SetClock(r.clock)
 
 	logrus.Debugf("Loading trusted collection.")
 
@@ -790,17 +1179,31 @@ func (r *repository) bootstrapRepo() error {
 
 	tufRepo, _, err := b.Finish()
 	if err == nil {
+		// the local metadata is about to be re-signed, so the signature
+		// algorithms only apply to signing it
+		tufRepo.SetSignatureAlgorithms(r.signatureAlgorithms)
 		r.tufRepo = tufRepo
 	}
 	return nil
 }
 
 // saveMetadata saves contents of r.tufRepo onto the local disk, creating
-// signatures as necessary, possibly prompting for passphrases.
-func (r *repository) saveMetadata(ignoreSnapshot bool) error {
+// signatures as necessary, possibly prompting for passphrases.  The root
+// expires after rootExpiry, or the default expiry of the root role if it is
+// zero.
+func (r *repository) saveMetadata(ignoreSnapshot bool, rootExpiry time.Duration) error {
 	logrus.Debugf("Saving changes to Trusted Collection.")
 
-	rootJSON, err := serializeCanonicalRole(r.tufRepo, data.CanonicalRootRole, nil)
+	now := r.now()
+	rootExpires := data.DefaultExpiresAt(data.CanonicalRootRole, now)
+	if rootExpiry > 0 {
+		rootExpires = now.Add(rootExpiry)
+	}
+	signedRoot, err := r.tufRepo.SignRoot(rootExpires, nil)
+	if err != nil {
+		return err
+	}
+	rootJSON, err := json.Marshal(signedRoot)
 	if err != nil {
 		return err
 	}
@@ -811,7 +1214,7 @@ func (r *repository) saveMetadata(ignoreSnapshot bool) error {
 
 	targetsToSave := make(map[data.RoleName][]byte)
 	for t := range r.tufRepo.Targets {
-		signedTargets, err := r.tufRepo.SignTargets(t, data.DefaultExpires(data.CanonicalTargetsRole))
+		signedTargets, err := r.tufRepo.SignTargets(t, data.DefaultExpiresAt(data.CanonicalTargetsRole, now))
 		if err != nil {
 			return err
 		}
@@ -831,7 +1234,7 @@ func (r *repository) saveMetadata(ignoreSnapshot bool) error {
 		return nil
 	}
 
-	snapshotJSON, err := serializeCanonicalRole(r.tufRepo, data.CanonicalSnapshotRole, nil)
+	snapshotJSON, err := serializeCanonicalRole(r.tufRepo, data.CanonicalSnapshotRole, nil, now)
 	if err != nil {
 		return err
 	}
@@ -861,6 +1264,93 @@ func (r *repository) RotateKey(role data.RoleName, serverManagesKey bool, keyLis
 	return r.publish(cl)
 }
 
+// ReclaimKey rotates a role whose key is managed by the server back to a key
+// generated and held locally, and publishes the change.  Only roles which can
+// be managed by either the server or the client can be reclaimed, and the latest
+// metadata is fetched to check that none of the role's current keys is held
+// locally.
+func (r *repository) ReclaimKey(role data.RoleName) error {
+	if err := checkRotationInput(role, true); err != nil {
+		return err
+	}
+	if err := checkRotationInput(role, false); err != nil {
+		return err
+	}
+	if err := r.updateTUF(true); err != nil {
+		return err
+	}
+	baseRole, err := r.tufRepo.GetBaseRole(role)
+	if err != nil {
+		return err
+	}
+	for _, keyID := range baseRole.ListKeyIDs() {
+		if _, _, err := r.GetCryptoService().GetPrivateKey(keyID); err == nil {
+			return ErrKeyNotServerManaged{Role: role}
+		}
+	}
+	return r.RotateKey(role, false, nil)
+}
+
+// KeyRotationPlan describes the change that RotateKey would make to a role
+type KeyRotationPlan struct {
+	// Role is the role whose keys would be rotated
+	Role data.RoleName
+	// Threshold is the number of signatures the role requires, which rotation
+	// does not change
+	Threshold int
+	// OldKeyIDs are the IDs of the keys currently associated with the role
+	OldKeyIDs []string
+	// NewKeyIDs are the IDs of the keys the role would be rotated to.  It is
+	// empty if a new key would be generated instead.
+	NewKeyIDs []string
+	// ServerManaged is true if the new key would be generated and held by the server
+	ServerManaged bool
+}
+
+// NewKeyCount returns the number of keys the role would have after rotation
+func (p KeyRotationPlan) NewKeyCount() int {
+	if len(p.NewKeyIDs) == 0 {
+		return 1
+	}
+	return len(p.NewKeyIDs)
+}
+
+// PlanKeyRotation describes the effect RotateKey would have if called with the
+// same arguments, without generating, importing or removing any keys, or staging
+// or publishing any changes.  The keys in keyList need not be in the repository's
+// CryptoService yet.
+func (r *repository) PlanKeyRotation(role data.RoleName, serverManagesKey bool, keyList []string) (*KeyRotationPlan, error) {
+	if err := checkRotationInput(role, serverManagesKey); err != nil {
+		return nil, err
+	}
+	if err := r.updateTUF(true); err != nil {
+		if _, ok := err.(ErrRepositoryNotExist); !ok {
+			return nil, err
+		}
+		// the repository has not been published yet, so, like publish, plan
+		// against the locally initialized metadata
+		if err := r.bootstrapRepo(); err != nil {
+			return nil, err
+		}
+	}
+	baseRole, err := r.tufRepo.GetBaseRole(role)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &KeyRotationPlan{
+		Role:          role,
+		Threshold:     baseRole.Threshold,
+		OldKeyIDs:     baseRole.ListKeyIDs(),
+		ServerManaged: serverManagesKey,
+	}
+	sort.Strings(plan.OldKeyIDs)
+	if !serverManagesKey {
+		plan.NewKeyIDs = append(plan.NewKeyIDs, keyList...)
+	}
+	return plan, nil
+}
+
 // Given a set of new keys to rotate to and a set of keys to drop, returns the list of current keys to use
 func (r *repository) pubKeyListForRotation(role data.RoleName, serverManaged bool, newKeys []string) (pubKeyList data.KeyList, err error) {
 	var pubKey data.PublicKey
@@ -921,7 +1411,7 @@ func (r *repository) pubKeysToCerts(role data.RoleName, pubKeyList data.KeyList)
 		if loadedRole != role {
 			return nil, fmt.Errorf("attempted to load root key but given %s key instead", loadedRole)
 		}
-		pubKey, err = rootCertKey(r.gun, privKey)
+		pubKey, err = rootCertKey(r.gun, privKey, r.now())
 		if err != nil {
 			return nil, err
 		}
@@ -990,6 +1480,75 @@ func DeleteTrustData(baseDir string, gun data.GUN, URL string, rt http.RoundTrip
 	return nil
 }
 
+// existingTargetsKey returns the public key of the targets key with the given
+// ID, which must be stored as a targets key
+func (r *repository) existingTargetsKey(keyID string) (data.PublicKey, error) {
+	privKey, role, err := r.GetCryptoService().GetPrivateKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("targets key %s is not available: %w", keyID, err)
+	}
+	if role != data.CanonicalTargetsRole {
+		return nil, fmt.Errorf("key %s is a %s key, not a targets key", keyID, role)
+	}
+	return data.PublicKeyFromPrivate(privKey), nil
+}
+
+// SetClockSkewThreshold sets how far the local clock may be ahead of the remote
+// server's before metadata which appears expired is reported as likely being
+// caused by the local clock.  Zero restores notary.DefaultClockSkewThreshold.
+func (r *repository) SetClockSkewThreshold(threshold time.Duration) {
+	r.clockSkewThreshold = threshold
+}
+
+// SetClock sets the clock which tells the time that metadata is checked for
+// expiry against, and that metadata signed by the repository is valid from.  A
+// nil clock restores the real clock.
+func (r *repository) SetClock(clock data.Clock) {
+	r.clock = clock
+}
+
+func (r *repository) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+// SetSignatureAlgorithms sets the signature algorithm that each role in the
+// policy must be signed with.  Only the role's keys which sign with that
+// algorithm are used to sign it, and metadata for the role which doesn't have
+// enough valid signatures made with it is rejected.
+func (r *repository) SetSignatureAlgorithms(policy signed.AlgorithmPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	r.signatureAlgorithms = policy
+	return nil
+}
+
+// SetStatusMapping sets how the HTTP statuses returned by the remote server
+// are interpreted, overriding store.DefaultStatusMapping for the statuses it
+// maps.  It has no effect on remote stores which are not HTTP stores.
+func (r *repository) SetStatusMapping(mapping store.StatusMapping) error {
+	if s, ok := r.remoteStore.(*store.HTTPStore); ok {
+		return s.SetStatusMapping(mapping)
+	}
+	return mapping.Validate()
+}
+
+// SetCacheCompression sets whether metadata is gzip-compressed when it is
+// cached, trading CPU for space.  Cached metadata is decompressed when it is
+// read whether or not compression is on.
+func (r *repository) SetCacheCompression(compress bool) {
+	if cache, ok := r.cache.(*store.CompressedStore); ok {
+		cache.SetCompression(compress)
+		return
+	}
+	if compress {
+		r.cache = store.NewCompressedStore(r.cache, true)
+	}
+}
+
 // SetLegacyVersions allows the number of legacy versions of the root
 // to be inspected for old signing keys to be configured.
 func (r *repository) SetLegacyVersions(n int) {
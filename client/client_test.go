@@ -2,11 +2,15 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -18,6 +22,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	ctxu "github.com/docker/distribution/context"
@@ -29,10 +34,14 @@ import (
 	"github.com/theupdateframework/notary/cryptoservice"
 	"github.com/theupdateframework/notary/passphrase"
 	"github.com/theupdateframework/notary/server"
+	"github.com/theupdateframework/notary/server/handlers"
 	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/server/timestamp"
 	store "github.com/theupdateframework/notary/storage"
 	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tsa"
+	tsatestutils "github.com/theupdateframework/notary/tsa/testutils"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 	testutils "github.com/theupdateframework/notary/tuf/testutils/keys"
@@ -125,10 +134,25 @@ func simpleTestServer(t *testing.T, roles ...string) (
 	return ts, mux, keys
 }
 
-func fullTestServer(t *testing.T) *httptest.Server {
+func fullTestServer(t testing.TB) *httptest.Server {
+	return fullTestServerWithAuthority(t, nil)
+}
+
+// fullTestServerWithAuthority is a fullTestServer which attaches tokens from
+// the timestamping authority, if not nil, to the timestamps it generates
+func fullTestServerWithAuthority(t testing.TB, authority *timestamp.Authority) *httptest.Server {
+	ctx := context.Background()
+	if authority != nil {
+		ctx = context.WithValue(ctx, notary.CtxKeyTimestampAuthority, authority)
+	}
+	return fullTestServerWithContext(t, ctx)
+}
+
+// fullTestServerWithContext is a fullTestServer whose handlers are passed a
+// context derived from ctx, with which further server options can be set
+func fullTestServerWithContext(t testing.TB, ctx context.Context) *httptest.Server {
 	// Set up server
-	ctx := context.WithValue(
-		context.Background(), notary.CtxKeyMetaStore, storage.NewMemStorage())
+	ctx = context.WithValue(ctx, notary.CtxKeyMetaStore, storage.NewMemStorage())
 
 	// Do not pass one of the const KeyAlgorithms here as the value! Passing a
 	// string is in itself good test that we are handling it correctly as we
@@ -385,7 +409,7 @@ func TestInitRepositoryWithCerts(t *testing.T) {
 				iDs = []string{}
 			}
 
-			err = repo.initialize(iDs, pubKeys, data.CanonicalTimestampRole)
+			err = repo.initialize(iDs, InitOptions{RootCerts: pubKeys}, data.CanonicalTimestampRole)
 			if len(iDs) == len(pubKeys) || // case: 2 keys 2 certs
 				(len(iDs) != 0 && len(pubKeys) == 0) || // case: 1 key and 0 cert
 				(len(iDs) == 0 && len(pubKeys) != 0) { // case: 0 keys and 1 cert
@@ -397,7 +421,7 @@ func TestInitRepositoryWithCerts(t *testing.T) {
 			}
 			// implicit else case: 2 keys 1 cert
 		} else { // unmatched key pairs case
-			err = repo.initialize(pubKeyIDs[1:], pubKeys[:1])
+			err = repo.initialize(pubKeyIDs[1:], InitOptions{RootCerts: pubKeys[:1]})
 		}
 		require.Error(t, err, tc.expectedError, tc.name)
 		require.Nil(t, repo.tufRepo)
@@ -525,6 +549,80 @@ func TestInitRepoServerManagesTimestampAndSnapshotKeys(t *testing.T) {
 	}
 }
 
+// The root created during initialization expires after the root expiry in the
+// initialization options, without changing the default expiry of the root role
+func TestInitRepoWithRootExpiry(t *testing.T) {
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	repo, _, rootPubKeyID := createRepoAndKey(t, data.ECDSAKey, tempBaseDir, "docker.com/notary", ts.URL)
+	require.NoError(t, repo.InitializeWithOptions([]string{rootPubKeyID}, InitOptions{RootExpiry: 730 * notary.Day}))
+
+	rootJSON, err := repo.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+	signedRoot := &data.Signed{}
+	require.NoError(t, json.Unmarshal(rootJSON, signedRoot))
+	root, err := data.RootFromSigned(signedRoot)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().AddDate(0, 0, 730), root.Signed.Expires, time.Minute)
+	require.WithinDuration(t, time.Now().Add(notary.NotaryRootExpiry), data.DefaultExpires(data.CanonicalRootRole), time.Minute)
+}
+
+// The remote server is asked to generate the keys of server-managed roles
+// with the algorithm in the initialization options
+func TestInitRepoWithRemoteKeyAlgorithm(t *testing.T) {
+	key, err := utils.GenerateED25519Key(rand.Reader)
+	require.NoError(t, err)
+	pubKey := data.PublicKeyFromPrivate(key)
+	keyJSON, err := json.MarshalCanonical(&pubKey)
+	require.NoError(t, err)
+
+	var requested []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/docker.com/notary/_trust/tuf/timestamp.key", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Query().Get("algorithm"))
+		w.Write(keyJSON)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	repo, _, rootPubKeyID := createRepoAndKey(t, data.ECDSAKey, tempBaseDir, "docker.com/notary", ts.URL)
+	require.NoError(t, repo.InitializeWithOptions([]string{rootPubKeyID}, InitOptions{RemoteKeyAlgorithm: data.ED25519Key}))
+	require.Equal(t, []string{data.ED25519Key}, requested)
+
+	timestampKeys := repo.tufRepo.Root.Signed.Roles[data.CanonicalTimestampRole].KeyIDs
+	require.Equal(t, []string{pubKey.ID()}, timestampKeys)
+}
+
+// The targets role is initialized with the existing targets key in the
+// initialization options, which must be a targets key
+func TestInitRepoWithTargetsKey(t *testing.T) {
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	repo, _, rootPubKeyID := createRepoAndKey(t, data.ECDSAKey, tempBaseDir, "docker.com/notary", ts.URL)
+	err = repo.InitializeWithOptions([]string{rootPubKeyID}, InitOptions{TargetsKeyID: rootPubKeyID})
+	require.Error(t, err)
+
+	targetsKey, err := repo.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.InitializeWithOptions([]string{rootPubKeyID}, InitOptions{TargetsKeyID: targetsKey.ID()}))
+	require.Equal(t, []string{targetsKey.ID()}, repo.tufRepo.Root.Signed.Roles[data.CanonicalTargetsRole].KeyIDs)
+	require.Len(t, repo.GetCryptoService().ListKeys(data.CanonicalTargetsRole), 1)
+}
+
 // This creates a new KeyFileStore in the repo's base directory and makes sure
 // the repo has the right number of keys
 func requireRepoHasExpectedKeys(t *testing.T, repo *repository,
@@ -810,6 +908,51 @@ func testAddTargetToTargetRoleByDefault(t *testing.T, clearCache bool) {
 	}
 }
 
+// Metadata is cached gzip-compressed when cache compression is on, and is
+// identical to the server's metadata once decompressed.  The compressed cache
+// can be read back, and verified against the cached snapshot and timestamp,
+// by a repository which does not compress its cache.
+func TestPublishWithCompressedCache(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	repo, _, rootPubKeyID := createRepoAndKey(t, data.ECDSAKey, tempBaseDir, "docker.com/notary", ts.URL)
+	repo.SetCacheCompression(true)
+	require.NoError(t, repo.Initialize([]string{rootPubKeyID}))
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, repo.Publish())
+	// updating caches the metadata the server has after the publish
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+
+	for _, role := range data.BaseRoles {
+		onDisk, err := ioutil.ReadFile(filepath.Join(tempBaseDir, tufDir,
+			filepath.FromSlash(repo.gun.String()), "metadata", role.String()+".json"))
+		require.NoError(t, err)
+		zr, err := gzip.NewReader(bytes.NewReader(onDisk))
+		require.NoError(t, err, "%s was not cached compressed", role)
+		cached, err := ioutil.ReadAll(zr)
+		require.NoError(t, err)
+
+		fromServer, err := repo.remoteStore.GetSized(role.String(), store.NoSizeLimit)
+		require.NoError(t, err)
+		require.Equal(t, fromServer, cached, "cached %s differs from the server's", role)
+	}
+
+	// an offline repository can only use the cache
+	r, err := NewFileCachedRepository(tempBaseDir, repo.gun, ts.URL, nil,
+		passphrase.ConstantRetriever(password), trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	targets, err := r.ListTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	require.Equal(t, "current", targets[0].Name)
+}
+
 // Tests that adding a target to a repo or deleting a target from a repo,
 // with the given roles, makes a change to the expected scopes
 func testAddOrDeleteTarget(t *testing.T, repo *repository, action string,
@@ -1005,6 +1148,52 @@ func testErrorWritingChangefiles(t *testing.T, writeChangeFile func(*repository)
 	require.IsType(t, &os.PathError{}, err)
 }
 
+// AddTargetWithReader stages a target read from an in-memory reader, with
+// the same hashes and length as the same content added from a file, whether or
+// not its size is known in advance
+func TestAddTargetWithReader(t *testing.T) {
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	content, err := ioutil.ReadFile("../fixtures/intermediate-ca.crt")
+	require.NoError(t, err)
+	fromFile, err := NewTarget("latest", "../fixtures/intermediate-ca.crt", nil)
+	require.NoError(t, err)
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	require.Equal(t, sha256Sum[:], []byte(fromFile.Hashes[notary.SHA256]))
+	require.Equal(t, sha512Sum[:], []byte(fromFile.Hashes[notary.SHA512]))
+
+	for i, size := range []int64{int64(len(content)), -1} {
+		// the reader returns a byte at a time and can't seek, like a pipe
+		reader := iotest.OneByteReader(bytes.NewReader(content))
+		require.NoError(t, repo.AddTargetWithReader("latest", reader, size, data.CanonicalTargetsRole))
+
+		changes := getChanges(t, repo)
+		require.Len(t, changes, i+1)
+		c := changes[i]
+		require.EqualValues(t, changelist.ActionCreate, c.Action())
+		require.Equal(t, data.CanonicalTargetsRole, c.Scope())
+		require.Equal(t, "latest", c.Path())
+
+		var meta data.FileMeta
+		require.NoError(t, json.Unmarshal(c.Content(), &meta))
+		require.Equal(t, fromFile.Length, meta.Length)
+		require.Equal(t, fromFile.Hashes, meta.Hashes)
+	}
+
+	// content that doesn't match the expected size isn't staged
+	for _, size := range []int64{int64(len(content)) - 1, int64(len(content)) + 1} {
+		err := repo.AddTargetWithReader("latest", bytes.NewReader(content), size)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "expected")
+	}
+	require.Len(t, getChanges(t, repo), 2)
+}
+
 // Ensures that AddTarget errors on invalid target input (no hashes)
 func TestAddTargetWithInvalidTarget(t *testing.T) {
 	ts, _, _ := simpleTestServer(t)
@@ -1819,6 +2008,342 @@ func TestPublishUninitializedRepo(t *testing.T) {
 	requireRepoHasExpectedMetadata(t, repo, data.CanonicalTargetsRole, true, tempBaseDir)
 }
 
+// A repository can stage changes in a custom changelist rather than on disk,
+// and publishes and clears them as usual
+func TestPublishWithMemChangelist(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	tempBaseDir, err := ioutil.TempDir("", "notary-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	_, err = NewFileCachedRepositoryWithChangelist(tempBaseDir, gun, ts.URL,
+		http.DefaultTransport, passphraseRetriever, trustpinning.TrustPinConfig{}, nil)
+	require.Error(t, err)
+
+	cl := changelist.NewMemChangelist()
+	r, err := NewFileCachedRepositoryWithChangelist(tempBaseDir, gun, ts.URL,
+		http.DefaultTransport, passphraseRetriever, trustpinning.TrustPinConfig{}, cl)
+	require.NoError(t, err, "error creating repository: %s", err)
+	repo := r.(*repository)
+
+	rootPubKey, err := testutils.CreateOrAddKey(repo.GetCryptoService(), data.CanonicalRootRole, gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.Initialize([]string{rootPubKey.ID()}))
+
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	require.Len(t, cl.List(), 1)
+	repoCl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Equal(t, cl, repoCl)
+
+	require.NoError(t, repo.Publish())
+	require.Empty(t, cl.List())
+
+	// nothing was staged on disk
+	_, err = os.Stat(filepath.Join(tempBaseDir, tufDir, filepath.FromSlash(gun.String()), "changelist"))
+	require.True(t, os.IsNotExist(err))
+
+	// the published target is visible to a fresh repository
+	freshRepo, _, freshDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(freshDir)
+	target, err := freshRepo.GetTargetByName("latest")
+	require.NoError(t, err)
+	require.Equal(t, "latest", target.Name)
+}
+
+// Publishing reports each of its stages, in order, to the progress function
+func TestPublishReportsProgress(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+
+	var events []PublishEvent
+	repo.SetPublishProgress(func(event PublishEvent) {
+		events = append(events, event)
+	})
+	require.NoError(t, repo.Publish())
+
+	require.Len(t, events, 4)
+	for i, stage := range []PublishStage{
+		PublishLoadingChangelist, PublishBuildingMetadata, PublishUploading, PublishConfirming,
+	} {
+		require.Equal(t, stage, events[i].Stage)
+		require.Equal(t, 2, events[i].Changes)
+	}
+	require.Empty(t, events[0].Roles)
+	require.Equal(t, []data.RoleName{data.CanonicalRootRole, data.CanonicalSnapshotRole, data.CanonicalTargetsRole},
+		events[2].Roles)
+
+	// a failed upload is not confirmed
+	events = nil
+	addTarget(t, repo, "next", "../fixtures/intermediate-ca.crt")
+	ts.Close()
+	require.Error(t, repo.Publish())
+	for _, event := range events {
+		require.NotEqual(t, PublishConfirming, event.Stage)
+	}
+
+	// and progress is no longer reported once the function is unset
+	events = nil
+	repo.SetPublishProgress(nil)
+	repo.Publish()
+	require.Empty(t, events)
+}
+
+// Publishing only some roles publishes just the staged changes to those roles,
+// along with a re-signed snapshot, and leaves the rest of the changes staged
+func TestPublishRoles(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	_, err := repo.ListTargets()
+	require.NoError(t, err)
+	snapshotVersion := repo.tufRepo.Snapshot.Signed.Version
+
+	delgKey, err := repo.GetCryptoService().Create("targets/releases", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, repo.AddDelegation("targets/releases", []data.PublicKey{delgKey}, []string{""}))
+	staged := getChanges(t, repo)
+	require.Len(t, staged, 3)
+
+	require.IsType(t, data.ErrInvalidRole{}, repo.PublishRoles(data.CanonicalSnapshotRole))
+	require.Error(t, repo.PublishRoles("targets/other"))
+	require.Len(t, getChanges(t, repo), 3)
+
+	var events []PublishEvent
+	repo.SetPublishProgress(func(event PublishEvent) {
+		events = append(events, event)
+	})
+	require.NoError(t, repo.PublishRoles(data.CanonicalTargetsRole))
+	require.Equal(t, 1, events[0].Changes)
+	require.Contains(t, events[2].Roles, data.CanonicalSnapshotRole)
+	require.Contains(t, events[2].Roles, data.CanonicalTargetsRole)
+
+	// the delegation changes are still staged
+	remaining := getChanges(t, repo)
+	require.Len(t, remaining, 2)
+	for _, c := range remaining {
+		require.Equal(t, data.RoleName("targets/releases"), c.Scope())
+	}
+
+	// and are not on the server, although the target and snapshot are
+	checker, _, checkerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(checkerDir)
+	targets, err := checker.ListTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	require.Equal(t, "current", targets[0].Name)
+	delegations, err := checker.GetDelegationRoles()
+	require.NoError(t, err)
+	require.Empty(t, delegations)
+	require.Equal(t, snapshotVersion+1, checker.tufRepo.Snapshot.Signed.Version)
+
+	require.NoError(t, repo.PublishRoles("targets/releases"))
+	require.Empty(t, getChanges(t, repo))
+	delegations, err = repo.GetDelegationRoles()
+	require.NoError(t, err)
+	require.Len(t, delegations, 1)
+	require.Equal(t, data.RoleName("targets/releases"), delegations[0].Name)
+}
+
+// A repository backed entirely by memory can be initialized, have targets
+// added to it and be published without touching the filesystem
+func TestPublishInMemoryRepository(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	_, err := NewInMemoryRepository(gun, "%%%", http.DefaultTransport,
+		passphraseRetriever, trustpinning.TrustPinConfig{})
+	require.Error(t, err)
+
+	r, err := NewInMemoryRepository(gun, ts.URL, http.DefaultTransport,
+		passphraseRetriever, trustpinning.TrustPinConfig{})
+	require.NoError(t, err, "error creating repository: %s", err)
+	repo := r.(*repository)
+
+	rootPubKey, err := testutils.CreateOrAddKey(repo.GetCryptoService(), data.CanonicalRootRole, gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.Initialize([]string{rootPubKey.ID()}))
+
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+
+	require.NoError(t, repo.Publish())
+	require.Empty(t, cl.List())
+
+	// metadata was cached in memory
+	for _, role := range []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole} {
+		_, err := repo.cache.GetSized(role.String(), store.NoSizeLimit)
+		require.NoError(t, err, "missing cached metadata for %s", role)
+	}
+
+	// a second in-memory repository shares nothing with the first, but can
+	// see the published target on the server
+	r2, err := NewInMemoryRepository(gun, ts.URL, http.DefaultTransport,
+		passphraseRetriever, trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	target, err := r2.GetTargetByName("latest")
+	require.NoError(t, err)
+	require.Equal(t, "latest", target.Name)
+
+	keys := r2.GetCryptoService().ListAllKeys()
+	require.Empty(t, keys)
+}
+
+// If a timestamping authority CA is pinned, the client only accepts timestamps
+// whose snapshot was countersigned by a timestamping authority trusted by that CA
+func TestTimestampAuthorityVerification(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	fake, err := tsatestutils.NewFakeTSA()
+	require.NoError(t, err)
+	tsaServer := httptest.NewServer(fake)
+	defer tsaServer.Close()
+
+	otherTSA, err := tsatestutils.NewFakeTSA()
+	require.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	caFile := filepath.Join(tempDir, "tsa-ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile, utils.CertToPEM(fake.Cert), 0644))
+	otherCAFile := filepath.Join(tempDir, "other-tsa-ca.crt")
+	require.NoError(t, ioutil.WriteFile(otherCAFile, utils.CertToPEM(otherTSA.Cert), 0644))
+
+	publish := func(ts *httptest.Server) {
+		r, err := NewInMemoryRepository(gun, ts.URL, http.DefaultTransport,
+			passphraseRetriever, trustpinning.TrustPinConfig{})
+		require.NoError(t, err)
+		rootPubKey, err := testutils.CreateOrAddKey(r.GetCryptoService(), data.CanonicalRootRole, gun, data.ECDSAKey)
+		require.NoError(t, err)
+		require.NoError(t, r.Initialize([]string{rootPubKey.ID()}))
+		addTarget(t, r.(*repository), "latest", "../fixtures/intermediate-ca.crt")
+		require.NoError(t, r.Publish())
+	}
+	lookup := func(ts *httptest.Server, tsaCA string) error {
+		r, err := NewInMemoryRepository(gun, ts.URL, http.DefaultTransport,
+			passphraseRetriever, trustpinning.TrustPinConfig{TSACA: tsaCA})
+		require.NoError(t, err)
+		_, err = r.GetTargetByName("latest")
+		return err
+	}
+
+	ts := fullTestServerWithAuthority(t, &timestamp.Authority{
+		Client: &tsa.Client{URL: tsaServer.URL}, Required: true})
+	defer ts.Close()
+	publish(ts)
+
+	require.NoError(t, lookup(ts, ""))
+	require.NoError(t, lookup(ts, caFile))
+	err = lookup(ts, otherCAFile)
+	require.Error(t, err)
+	require.IsType(t, ErrTimestampAuthority{}, err)
+	require.Error(t, lookup(ts, filepath.Join(tempDir, "nonexistent.crt")))
+
+	// timestamps without a token are rejected if a timestamping authority CA is pinned
+	noTSA := fullTestServer(t)
+	defer noTSA.Close()
+	publish(noTSA)
+
+	require.NoError(t, lookup(noTSA, ""))
+	err = lookup(noTSA, caFile)
+	require.Error(t, err)
+	require.IsType(t, ErrTimestampAuthority{}, err)
+}
+
+// A server's claim that a repository does not exist is only believed if it
+// is backed by a fresh statement for the GUN, signed with the key pinned for
+// it, whereas without a pinned key a plain 404 still suffices
+func TestSignedNotFound(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	writePubKey := func(name string) (string, data.PrivateKey) {
+		key, err := utils.GenerateECDSAKey(rand.Reader)
+		require.NoError(t, err)
+		keyFile := filepath.Join(tempDir, name)
+		pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: key.Public()})
+		require.NoError(t, ioutil.WriteFile(keyFile, pemBytes, 0644))
+		return keyFile, key
+	}
+	keyFile, key := writePubKey("not-found.pub")
+	otherKeyFile, _ := writePubKey("other.pub")
+
+	ts := fullTestServerWithContext(t, context.WithValue(context.Background(), notary.CtxKeyNotFoundSigner,
+		&handlers.NotFoundSigner{GUNs: []string{"docker.com/signed/*"}, Key: key}))
+	defer ts.Close()
+
+	lookup := func(url string, gun data.GUN, pinned map[string]string) error {
+		r, err := NewInMemoryRepository(gun, url, http.DefaultTransport,
+			passphraseRetriever, trustpinning.TrustPinConfig{NotFound: pinned})
+		require.NoError(t, err)
+		_, err = r.ListTargets()
+		return err
+	}
+	pinned := map[string]string{"docker.com/signed/": keyFile}
+
+	err = lookup(ts.URL, "docker.com/signed/missing", pinned)
+	require.IsType(t, ErrRepositoryNotExist{}, err)
+
+	// the statement must be signed by the pinned key
+	err = lookup(ts.URL, "docker.com/signed/missing", map[string]string{"docker.com/signed/": otherKeyFile})
+	require.IsType(t, ErrUnverifiedNotFound{}, err)
+	require.Error(t, lookup(ts.URL, "docker.com/signed/missing",
+		map[string]string{"docker.com/signed/": filepath.Join(tempDir, "nonexistent.pub")}))
+
+	// a plain 404 is believed unless a key is pinned for the GUN
+	require.IsType(t, ErrRepositoryNotExist{}, lookup(ts.URL, "docker.com/unsigned/missing", nil))
+	require.IsType(t, ErrRepositoryNotExist{}, lookup(ts.URL, "docker.com/unsigned/missing", pinned))
+	err = lookup(ts.URL, "docker.com/unsigned/missing", map[string]string{"docker.com/": keyFile})
+	require.IsType(t, ErrUnverifiedNotFound{}, err)
+
+	// a statement replayed from an earlier request, or for another GUN, is rejected
+	replay := func(gun data.GUN) *httptest.Server {
+		req, err := http.NewRequest("GET", ts.URL+"/v2/"+gun.String()+"/_trust/tuf/root.json", nil)
+		require.NoError(t, err)
+		req.Header.Set(notary.NotFoundNonceHeader, "earlier")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(body)
+		}))
+	}
+	replayed := replay("docker.com/signed/missing")
+	defer replayed.Close()
+	err = lookup(replayed.URL, "docker.com/signed/missing", pinned)
+	require.IsType(t, ErrUnverifiedNotFound{}, err)
+	require.Contains(t, err.Error(), "nonce")
+	err = lookup(replayed.URL, "docker.com/signed/other", pinned)
+	require.IsType(t, ErrUnverifiedNotFound{}, err)
+	require.Contains(t, err.Error(), "docker.com/signed/missing")
+
+	// a spoofed plain 404 is rejected
+	spoofed := errorTestServer(t, http.StatusNotFound)
+	defer spoofed.Close()
+	require.IsType(t, ErrUnverifiedNotFound{}, lookup(spoofed.URL, "docker.com/signed/exists", pinned))
+}
+
 // Create a repo, instantiate a notary server, and publish the repo with
 // some targets to the server, signing all the non-timestamp metadata.
 // We test this with both an RSA and ECDSA root key
@@ -2642,6 +3167,45 @@ func TestPublishRemoveDelegation(t *testing.T) {
 	require.Error(t, delgRepo.Publish())
 }
 
+// Removing a key from a delegation and clearing its paths is staged as a single
+// change, and both are reflected in the delegation once published
+func TestPublishRemoveDelegationKeyAndPaths(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	aKey1, err := repo.GetCryptoService().Create("targets/a", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	aKey2, err := repo.GetCryptoService().Create("targets/a", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddDelegation("targets/a", []data.PublicKey{aKey1, aKey2}, []string{"a", "b"}))
+	require.NoError(t, repo.Publish())
+
+	aKey1CanonicalID, err := utils.CanonicalKeyID(aKey1)
+	require.NoError(t, err)
+	require.NoError(t, repo.RemoveDelegationKeyAndPaths("targets/a", []string{aKey1CanonicalID}))
+	changes := getChanges(t, repo)
+	require.Len(t, changes, 1)
+	require.Equal(t, changelist.ActionUpdate, changes[0].Action())
+
+	// wildcard roles can't have their paths cleared
+	require.Error(t, repo.RemoveDelegationKeyAndPaths("targets/*", []string{aKey1CanonicalID}))
+	require.Len(t, getChanges(t, repo), 1)
+
+	require.NoError(t, repo.Publish())
+	require.Empty(t, getChanges(t, repo))
+
+	delegations, err := repo.GetDelegationRoles()
+	require.NoError(t, err)
+	require.Len(t, delegations, 1)
+	require.EqualValues(t, "targets/a", delegations[0].Name)
+	require.Empty(t, delegations[0].Paths)
+	require.Len(t, delegations[0].KeyIDs, 1)
+	require.Equal(t, aKey2.ID(), delegations[0].KeyIDs[0])
+}
+
 // If the delegation data is corrupt or unreadable, it doesn't matter because
 // all the delegation information is just re-downloaded.  When bootstrapping
 // the repository from disk, we just don't load the data from disk because
@@ -2776,6 +3340,47 @@ func TestRemoteRotationNoInit(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// A server-managed snapshot key can be rotated back to a local key, which is
+// then used to sign the snapshot.  Only server-managed snapshot keys can be
+// reclaimed.
+func TestReclaimSnapshotKey(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	require.IsType(t, ErrInvalidLocalRole{}, repo.ReclaimKey(data.CanonicalTimestampRole))
+	require.IsType(t, ErrInvalidRemoteRole{}, repo.ReclaimKey(data.CanonicalRootRole))
+
+	require.Empty(t, repo.GetCryptoService().ListKeys(data.CanonicalSnapshotRole))
+	require.NoError(t, repo.ReclaimKey(data.CanonicalSnapshotRole))
+
+	snapshotKeys := repo.GetCryptoService().ListKeys(data.CanonicalSnapshotRole)
+	require.Len(t, snapshotKeys, 1)
+	snapshotRole, err := repo.tufRepo.GetBaseRole(data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Equal(t, snapshotKeys, snapshotRole.ListKeyIDs())
+
+	// the snapshot key is now held locally, so it cannot be reclaimed again
+	err = repo.ReclaimKey(data.CanonicalSnapshotRole)
+	require.Error(t, err)
+	require.IsType(t, ErrKeyNotServerManaged{}, err)
+
+	// publishing signs the snapshot with the local key
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, repo.Publish())
+
+	newRepo, _, baseDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(baseDir)
+	_, err = newRepo.GetTargetByName("latest")
+	require.NoError(t, err)
+	signedSnapshot := newRepo.tufRepo.Snapshot.Signatures
+	require.Len(t, signedSnapshot, 1)
+	require.Equal(t, snapshotKeys[0], signedSnapshot[0].KeyID)
+}
+
 // Rotates the keys.  After the rotation, downloading the latest metadata
 // and require that the keys have changed
 func requireRotationSuccessful(t *testing.T, repo1 *repository, keysToRotate map[data.RoleName]bool) {
@@ -2857,6 +3462,57 @@ func requireRotationSuccessful(t *testing.T, repo1 *repository, keysToRotate map
 	}
 }
 
+// Planning a key rotation describes the rotation without changing any keys or
+// metadata, whether or not the repository has been published yet
+func TestPlanKeyRotation(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	requirePlanMakesNoChanges := func() {
+		keys := repo.GetCryptoService().ListAllKeys()
+		cl, err := repo.GetChangelist()
+		require.NoError(t, err)
+		changes := len(cl.List())
+
+		plan, err := repo.PlanKeyRotation(data.CanonicalTargetsRole, false, nil)
+		require.NoError(t, err)
+		require.Equal(t, data.CanonicalTargetsRole, plan.Role)
+		require.Equal(t, 1, plan.Threshold)
+		require.Len(t, plan.OldKeyIDs, 1)
+		require.Empty(t, plan.NewKeyIDs)
+		require.False(t, plan.ServerManaged)
+		require.Equal(t, 1, plan.NewKeyCount())
+
+		plan, err = repo.PlanKeyRotation(data.CanonicalSnapshotRole, false, []string{"abc", "def"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"abc", "def"}, plan.NewKeyIDs)
+		require.Equal(t, 2, plan.NewKeyCount())
+
+		plan, err = repo.PlanKeyRotation(data.CanonicalTimestampRole, true, []string{"abc"})
+		require.NoError(t, err)
+		require.True(t, plan.ServerManaged)
+		require.Empty(t, plan.NewKeyIDs)
+
+		_, err = repo.PlanKeyRotation(data.CanonicalTargetsRole, true, nil)
+		require.IsType(t, ErrInvalidRemoteRole{}, err)
+		_, err = repo.PlanKeyRotation(data.CanonicalTimestampRole, false, nil)
+		require.IsType(t, ErrInvalidLocalRole{}, err)
+
+		require.Equal(t, keys, repo.GetCryptoService().ListAllKeys())
+		require.Len(t, cl.List(), changes)
+	}
+
+	// before the repository has been published
+	requirePlanMakesNoChanges()
+
+	// and after
+	require.NoError(t, repo.Publish())
+	requirePlanMakesNoChanges()
+}
+
 // Initialize repo to have the server sign snapshots (remote snapshot key)
 // Without downloading a server-signed snapshot file, rotate keys so that
 //    snapshots are locally signed (local snapshot key)
@@ -3389,6 +4045,45 @@ func TestAddDelegationChangefileApplicable(t *testing.T) {
 	require.EqualValues(t, "targets/a", newDelegationRole.Name)
 }
 
+// ReplaceDelegation stages its keys and paths together in a single change,
+// whereas AddDelegation stages a change for the keys and another for the paths
+func TestReplaceDelegationChangefileValid(t *testing.T) {
+	gun := "docker.com/notary"
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, gun, ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	targetKeyIds := repo.GetCryptoService().ListKeys(data.CanonicalTargetsRole)
+	require.NotEmpty(t, targetKeyIds)
+	targetPubKey := repo.GetCryptoService().GetKey(targetKeyIds[0])
+	require.NotNil(t, targetPubKey)
+
+	err := repo.ReplaceDelegation(data.CanonicalRootRole, []data.PublicKey{targetPubKey}, []string{""})
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	err = repo.ReplaceDelegation("targets/a", nil, []string{""})
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	require.Empty(t, getChanges(t, repo))
+
+	err = repo.ReplaceDelegation("targets/a", []data.PublicKey{targetPubKey}, []string{"path"})
+	require.NoError(t, err)
+
+	changes := getChanges(t, repo)
+	require.Len(t, changes, 1)
+	require.Equal(t, changelist.ActionCreate, changes[0].Action())
+	require.EqualValues(t, "targets/a", changes[0].Scope())
+	require.Equal(t, changelist.TypeTargetsDelegation, changes[0].Type())
+
+	td := changelist.TUFDelegation{}
+	require.NoError(t, json.Unmarshal(changes[0].Content(), &td))
+	require.True(t, td.Replace)
+	require.Len(t, td.AddKeys, 1)
+	require.Equal(t, []string{"path"}, td.AddPaths)
+}
+
 // TestAddDelegationErrorWritingChanges expects errors writing a change to file
 // to be propagated.
 func TestAddDelegationErrorWritingChanges(t *testing.T) {
@@ -3725,6 +4420,68 @@ func TestDeleteRepo(t *testing.T) {
 	requireRepoHasExpectedKeys(t, repo, rootKeyID, true, baseDir)
 }
 
+// Rebuild recovers from a corrupted metadata cache, keeping the keys and the
+// staged changes, and keeps an intact cached root as the trust anchor
+func TestRebuild(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, rootKeyID, baseDir := initializeRepo(t, data.ECDSAKey, gun.String(), ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, repo.Publish())
+	addTarget(t, repo, "staged", "../fixtures/intermediate-ca.crt")
+
+	metadataDir := filepath.Join(baseDir, tufDir, filepath.FromSlash(gun.String()), "metadata")
+	corrupt := func(roles ...data.RoleName) {
+		for _, role := range roles {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(metadataDir, role.String()+".json"), []byte("corrupted"), 0644))
+		}
+	}
+	corrupt(data.BaseRoles...)
+
+	// a corrupted root can't be recovered from by updating
+	repo, _, _ = newRepoToTestRepo(t, repo, baseDir)
+	_, err := repo.ListTargets()
+	require.Error(t, err)
+
+	require.NoError(t, repo.Rebuild())
+	targets, err := repo.ListTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	require.Equal(t, "latest", targets[0].Name)
+	for _, role := range data.BaseRoles {
+		requireRepoHasExpectedMetadata(t, repo, role, true, baseDir)
+	}
+	requireRepoHasExpectedKeys(t, repo, rootKeyID, true, baseDir)
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+
+	// subsequent operations work, including publishing with the same keys
+	require.NoError(t, repo.Publish())
+	targets, err = repo.ListTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+
+	// if the cached root is intact, it is kept as the trust anchor, so a
+	// server whose root it doesn't trust is rejected
+	corrupt(data.CanonicalTargetsRole, data.CanonicalSnapshotRole, data.CanonicalTimestampRole)
+	otherDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(otherDir)
+	require.NoError(t, DeleteTrustData(otherDir, gun, ts.URL, http.DefaultTransport, true))
+	other, _, otherBaseDir := initializeRepo(t, data.ECDSAKey, gun.String(), ts.URL, false)
+	defer os.RemoveAll(otherBaseDir)
+	require.NoError(t, other.Publish())
+
+	err = repo.Rebuild()
+	require.Error(t, err)
+	require.IsType(t, &trustpinning.ErrRootRotationFail{}, err)
+}
+
 // TestDeleteRemoteRepo tests that local and remote repo data is deleted from the client library call
 func TestDeleteRemoteRepo(t *testing.T) {
 	var gun data.GUN = "docker.com/notary"
@@ -4138,3 +4895,43 @@ func checkSignatures(t *testing.T, targetSignatureData []TargetSignedStruct, exp
 type expectation struct {
 	role, target string
 }
+
+// A signature algorithm policy restricts the keys a role is signed with when
+// publishing, and rejects metadata for a role which isn't signed with the
+// required algorithm when reading
+func TestSignatureAlgorithmPolicy(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	require.Error(t, repo.SetSignatureAlgorithms(signed.AlgorithmPolicy{data.CanonicalTargetsRole: "dsa"}))
+
+	// the targets key is an ECDSA key, so targets can't be signed with EdDSA
+	require.NoError(t, repo.SetSignatureAlgorithms(signed.AlgorithmPolicy{data.CanonicalTargetsRole: data.EDDSASignature}))
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+	err := repo.Publish()
+	require.Error(t, err)
+	var algErr signed.ErrSignatureAlgorithm
+	require.True(t, errors.As(err, &algErr), "unexpected error: %v", err)
+	require.Equal(t, data.CanonicalTargetsRole, algErr.Role)
+
+	require.NoError(t, repo.SetSignatureAlgorithms(signed.AlgorithmPolicy{
+		data.CanonicalRootRole:    data.ECDSASignature,
+		data.CanonicalTargetsRole: data.ECDSASignature,
+	}))
+	require.NoError(t, repo.Publish())
+
+	reader, _, readerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(readerDir)
+
+	require.NoError(t, reader.SetSignatureAlgorithms(signed.AlgorithmPolicy{data.CanonicalTargetsRole: data.EDDSASignature}))
+	_, err = reader.GetTargetByName("current")
+	require.Error(t, err)
+	require.True(t, errors.As(err, &algErr), "unexpected error: %v", err)
+
+	require.NoError(t, reader.SetSignatureAlgorithms(signed.AlgorithmPolicy{data.CanonicalTargetsRole: data.ECDSASignature}))
+	_, err = reader.GetTargetByName("current")
+	require.NoError(t, err)
+}
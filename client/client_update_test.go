@@ -1995,3 +1995,89 @@ func TestLoadTUFRepoBadURL(t *testing.T) {
 	// value
 	require.EqualError(t, err1, err2.Error())
 }
+
+// Whether the timestamp has expired is decided by the clock, so an update
+// succeeds just before the timestamp expires and fails just after
+func TestUpdateFailsOnceTimestampExpires(t *testing.T) {
+	serverMeta, _, err := testutils.NewRepoMetadata("docker.com/notary", metadataDelegations...)
+	require.NoError(t, err)
+
+	ts := readOnlyServer(t, store.NewMemoryStore(serverMeta), http.StatusNotFound, "docker.com/notary")
+	defer ts.Close()
+
+	timestamp := &data.SignedTimestamp{}
+	require.NoError(t, json.Unmarshal(serverMeta[data.CanonicalTimestampRole], timestamp))
+	expires := timestamp.Signed.Expires
+
+	for _, testCase := range []struct {
+		now     time.Time
+		expired bool
+	}{
+		{now: expires.Add(-time.Second), expired: false},
+		{now: expires.Add(time.Second), expired: true},
+	} {
+		repo, baseDir := newBlankRepo(t, ts.URL)
+		repo.SetClock(data.FixedClock(testCase.now))
+		err := repo.updateTUF(false)
+		if testCase.expired {
+			require.Error(t, err)
+			require.IsType(t, signed.ErrExpired{}, err)
+		} else {
+			require.NoError(t, err)
+		}
+		os.RemoveAll(baseDir)
+	}
+}
+
+// If metadata appears expired while the local clock is further ahead of the
+// server's than the threshold, the expiry is blamed on the local clock
+func TestUpdateReportsClockSkewOnExpiry(t *testing.T) {
+	serverMeta, _, err := testutils.NewRepoMetadata("docker.com/notary", metadataDelegations...)
+	require.NoError(t, err)
+
+	timestamp := &data.SignedTimestamp{}
+	require.NoError(t, json.Unmarshal(serverMeta[data.CanonicalTimestampRole], timestamp))
+	// the Date header only has a resolution of a second
+	expires := timestamp.Signed.Expires.Truncate(time.Second)
+
+	// the local clock is just past the timestamp's expiry
+	localTime := expires.Add(time.Hour)
+
+	for _, testCase := range []struct {
+		serverTime time.Time
+		threshold  time.Duration
+		skew       time.Duration
+	}{
+		// the server's clock says the timestamp is still valid
+		{serverTime: expires.Add(-7 * notary.Day), skew: 7*notary.Day + time.Hour},
+		{serverTime: expires.Add(-7 * notary.Day), threshold: 10 * time.Minute, skew: 7*notary.Day + time.Hour},
+		// the clocks are close enough for the timestamp to really have expired
+		{serverTime: localTime.Add(-time.Minute)},
+		{serverTime: localTime.Add(-9 * time.Minute), threshold: 10 * time.Minute},
+		// the skew is within a generous threshold
+		{serverTime: expires.Add(-7 * notary.Day), threshold: 30 * notary.Day},
+	} {
+		readOnly := readOnlyServer(t, store.NewMemoryStore(serverMeta), http.StatusNotFound, "docker.com/notary")
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", testCase.serverTime.UTC().Format(http.TimeFormat))
+			readOnly.Config.Handler.ServeHTTP(w, r)
+		}))
+
+		repo, baseDir := newBlankRepo(t, ts.URL)
+		repo.SetClock(data.FixedClock(localTime))
+		repo.SetClockSkewThreshold(testCase.threshold)
+		err := repo.updateTUF(false)
+		require.Error(t, err)
+		require.IsType(t, signed.ErrExpired{}, err)
+		require.Equal(t, testCase.skew, err.(signed.ErrExpired).ClockSkew)
+		if testCase.skew > 0 {
+			require.Contains(t, err.Error(), "check the local clock is correct")
+		} else {
+			require.NotContains(t, err.Error(), "local clock")
+		}
+
+		os.RemoveAll(baseDir)
+		ts.Close()
+		readOnly.Close()
+	}
+}
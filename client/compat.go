@@ -0,0 +1,164 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// serverVersion is the major and minor version of a notary-server release
+type serverVersion struct {
+	major, minor int
+}
+
+func (v serverVersion) before(o serverVersion) bool {
+	return v.major < o.major || v.major == o.major && v.minor < o.minor
+}
+
+func (v serverVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// oldestCompatibleServer is the oldest notary-server release the client can
+// publish to.  Earlier releases predate root rotation and the repo builder,
+// both added in 0.3.0 according to the CHANGELOG.
+var oldestCompatibleServer = serverVersion{0, 3}
+
+// legacyFields are the fields of targets metadata which older notary-server
+// releases do not know about, with the first release which does, as recorded
+// in the CHANGELOG.  set returns whether the field is set in the given
+// metadata.  Only fields whose release is known belong here, since metadata
+// with the field can't be published to any older server.
+var legacyFields = []struct {
+	since serverVersion
+	name  string
+	set   func(*data.SignedTargets) bool
+}{
+	{
+		// #1146 in 0.6.0
+		since: serverVersion{0, 6},
+		name:  "custom data on targets",
+		set: func(tgts *data.SignedTargets) bool {
+			for _, meta := range tgts.Signed.Targets {
+				if meta.Custom != nil {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		// not in any release up to and including 0.7.0
+		since: serverVersion{0, 8},
+		name:  "custom data on delegation roles",
+		set: func(tgts *data.SignedTargets) bool {
+			for _, role := range tgts.Signed.Delegations.Roles {
+				if role.Custom != nil {
+					return true
+				}
+			}
+			return false
+		},
+	},
+}
+
+// parseServerVersion parses a notary-server release such as "0.5" or "0.5.1".
+// Only the major and minor versions are significant.
+func parseServerVersion(version string) (serverVersion, error) {
+	invalid := fmt.Errorf("invalid server version %q: must be a release such as 0.6", version)
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return serverVersion{}, invalid
+	}
+	var (
+		v   serverVersion
+		err error
+	)
+	if v.major, err = strconv.Atoi(parts[0]); err != nil || v.major < 0 {
+		return serverVersion{}, invalid
+	}
+	if v.minor, err = strconv.Atoi(parts[1]); err != nil || v.minor < 0 {
+		return serverVersion{}, invalid
+	}
+	if v.before(oldestCompatibleServer) {
+		return serverVersion{}, fmt.Errorf("notary-server %s is not supported: the oldest supported release is %s",
+			v, oldestCompatibleServer)
+	}
+	return v, nil
+}
+
+// SetServerVersion constrains the metadata published by the repository to the
+// fields understood by the given notary-server release, such as "0.5", for
+// interoperating with old servers.  Metadata without the fields the release
+// does not know about already has the shape it accepts, so publishing
+// metadata with them fails with ErrUnsupportedByServer, rather than dropping
+// data the user asked to sign.  An empty version publishes metadata with every
+// field the client supports.
+func (r *repository) SetServerVersion(version string) error {
+	if version == "" {
+		r.serverVersion = nil
+		return nil
+	}
+	v, err := parseServerVersion(version)
+	if err != nil {
+		return err
+	}
+	r.serverVersion = &v
+	return nil
+}
+
+// checkLegacyFields returns an error if targets metadata which is about to be
+// signed has a field which the server does not know about, rather than
+// publishing it or silently dropping it
+func checkLegacyFields(repo *tuf.Repo, version *serverVersion) error {
+	if version == nil {
+		return nil
+	}
+	for roleName, tgts := range repo.Targets {
+		if !tgts.Dirty {
+			continue
+		}
+		if err := checkTargetsLegacyFields(roleName, tgts, *version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSignedLegacyFields is checkLegacyFields for metadata which has already
+// been signed, such as that of an offline bundle, and is about to be published
+func checkSignedLegacyFields(files map[data.RoleName][]byte, version *serverVersion) error {
+	if version == nil {
+		return nil
+	}
+	for roleName, meta := range files {
+		if roleName != data.CanonicalTargetsRole && !data.IsDelegation(roleName) {
+			continue
+		}
+		s := &data.Signed{}
+		if err := json.Unmarshal(meta, s); err != nil {
+			return err
+		}
+		tgts, err := data.TargetsFromSigned(s, roleName)
+		if err != nil {
+			return err
+		}
+		if err := checkTargetsLegacyFields(roleName, tgts, *version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTargetsLegacyFields(roleName data.RoleName, tgts *data.SignedTargets, version serverVersion) error {
+	for _, field := range legacyFields {
+		if version.before(field.since) && field.set(tgts) {
+			return ErrUnsupportedByServer{Role: roleName, Field: field.name, Version: version.String()}
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	canonicaljson "github.com/docker/go/canonical/json"
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/client/changelist"
@@ -75,6 +76,57 @@ func (r *repository) AddDelegationPaths(name data.RoleName, paths []string) erro
 	return addChange(r.changelist, template, name)
 }
 
+// ReplaceDelegation creates a single changelist entry which sets the keys and paths of a delegation
+// to exactly those provided, removing any others it has, or creates the delegation if it does not exist.
+// The delegation keeps its threshold, which must not be more than the number of keys provided when the
+// change is applied.
+func (r *repository) ReplaceDelegation(name data.RoleName, delegationKeys []data.PublicKey, paths []string) error {
+
+	if !data.IsDelegation(name) {
+		return data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
+	}
+	if len(delegationKeys) == 0 {
+		return data.ErrInvalidRole{Role: name, Reason: "a delegation's keys cannot be replaced with no keys"}
+	}
+
+	logrus.Debugf(`Replacing the keys of delegation "%s" with %d keys, and its paths with %s\n`,
+		name, len(delegationKeys), paths)
+
+	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+		NewThreshold: notary.MinThreshold,
+		AddKeys:      data.KeyList(delegationKeys),
+		AddPaths:     paths,
+		Replace:      true,
+	})
+	if err != nil {
+		return err
+	}
+
+	template := newCreateDelegationChange(name, tdJSON)
+	return addChange(r.changelist, template, name)
+}
+
+// AddDelegationCustom creates a changelist entry to set custom metadata on an existing delegation,
+// replacing any custom metadata it already has.
+func (r *repository) AddDelegationCustom(name data.RoleName, custom *canonicaljson.RawMessage) error {
+
+	if !data.IsDelegation(name) {
+		return data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
+	}
+
+	logrus.Debugf(`Adding custom metadata to delegation %s\n`, name)
+
+	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+		Custom: custom,
+	})
+	if err != nil {
+		return err
+	}
+
+	template := newCreateDelegationChange(name, tdJSON)
+	return addChange(r.changelist, template, name)
+}
+
 // RemoveDelegationKeysAndPaths creates changelist entries to remove provided delegation key IDs and paths.
 // This method composes RemoveDelegationPaths and RemoveDelegationKeys (each creates one changelist entry if called).
 func (r *repository) RemoveDelegationKeysAndPaths(name data.RoleName, keyIDs, paths []string) error {
@@ -170,6 +222,54 @@ func (r *repository) ClearDelegationPaths(name data.RoleName) error {
 	return addChange(r.changelist, template, name)
 }
 
+// RemoveDelegationKeyAndPaths creates a single changelist entry to remove provided keys from an existing
+// delegation and clear all of its paths.  Because both changes are in one entry, they are applied together,
+// so the delegation is never left with the keys removed but the paths still in place, or the other way round.
+func (r *repository) RemoveDelegationKeyAndPaths(name data.RoleName, keyIDs []string) error {
+
+	if !data.IsDelegation(name) {
+		return data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
+	}
+
+	logrus.Debugf(`Removing %s keys and all paths from delegation "%s"\n`, keyIDs, name)
+
+	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+		RemoveKeys:    keyIDs,
+		ClearAllPaths: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	template := newUpdateDelegationChange(name, tdJSON)
+	return addChange(r.changelist, template, name)
+}
+
+// SetDelegationThreshold creates a changelist entry to change the number of signatures an existing
+// delegation requires.  When the change is applied, the threshold must be at most the number of keys
+// the delegation has.
+func (r *repository) SetDelegationThreshold(name data.RoleName, threshold int) error {
+
+	if !data.IsDelegation(name) {
+		return data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
+	}
+	if threshold < notary.MinThreshold {
+		return data.ErrInvalidRole{Role: name, Reason: fmt.Sprintf("threshold must be at least %d", notary.MinThreshold)}
+	}
+
+	logrus.Debugf(`Setting the threshold of delegation "%s" to %d\n`, name, threshold)
+
+	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+		NewThreshold: threshold,
+	})
+	if err != nil {
+		return err
+	}
+
+	template := newUpdateDelegationChange(name, tdJSON)
+	return addChange(r.changelist, template, name)
+}
+
 func newUpdateDelegationChange(name data.RoleName, content []byte) *changelist.TUFChange {
 	return changelist.NewTUFChange(
 		changelist.ActionUpdate,
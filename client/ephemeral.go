@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	canonicaljson "github.com/docker/go/canonical/json"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// RemoveAfterField is the field of a delegation's custom data which records
+// when the delegation is meant to be removed.  TUF has no expiry for a single
+// delegation, so it is up to the client to remove delegations which are past
+// their time, such as with StaleDelegations.
+const RemoveAfterField = "notary_remove_after"
+
+// WithRemoveAfter returns the custom data of a delegation with the time after
+// which it should be removed recorded in it, alongside any other custom data.
+// The custom data must be nil or a JSON object.
+func WithRemoveAfter(custom *canonicaljson.RawMessage, removeAfter time.Time) (*canonicaljson.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if custom != nil {
+		if err := json.Unmarshal(*custom, &fields); err != nil || fields == nil {
+			return nil, fmt.Errorf("custom data must be a JSON object to record when the delegation should be removed")
+		}
+	}
+	stamp, err := json.Marshal(removeAfter.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	fields[RemoveAfterField] = stamp
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	withRemoveAfter := canonicaljson.RawMessage(raw)
+	return &withRemoveAfter, nil
+}
+
+// RemoveAfter returns the time recorded in the delegation's custom data after
+// which it should be removed, and whether one is recorded
+func RemoveAfter(role data.Role) (time.Time, bool) {
+	if role.Custom == nil {
+		return time.Time{}, false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(*role.Custom, &fields); err != nil {
+		return time.Time{}, false
+	}
+	var stamp string
+	if err := json.Unmarshal(fields[RemoveAfterField], &stamp); err != nil {
+		return time.Time{}, false
+	}
+	removeAfter, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return removeAfter, true
+}
+
+// StaleDelegations returns the delegations which are past the time recorded in
+// their custom data after which they should be removed
+func StaleDelegations(roles []data.Role, now time.Time) []data.Role {
+	var stale []data.Role
+	for _, role := range roles {
+		if removeAfter, ok := RemoveAfter(role); ok && !now.Before(removeAfter) {
+			stale = append(stale, role)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	canonicaljson "github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func rawCustom(s string) *canonicaljson.RawMessage {
+	raw := canonicaljson.RawMessage(s)
+	return &raw
+}
+
+// The time a delegation should be removed after is recorded alongside its
+// other custom data, and read back from it
+func TestWithRemoveAfter(t *testing.T) {
+	removeAfter := time.Date(2026, 10, 15, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	custom, err := WithRemoveAfter(nil, removeAfter)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"notary_remove_after": "2026-10-15T10:00:00Z"}`, string(*custom))
+
+	custom, err = WithRemoveAfter(rawCustom(`{"ticket": "CI-7", "notary_remove_after": "2020-01-01T00:00:00Z"}`), removeAfter)
+	require.NoError(t, err)
+	var fields map[string]string
+	require.NoError(t, json.Unmarshal(*custom, &fields))
+	require.Equal(t, map[string]string{"ticket": "CI-7", RemoveAfterField: "2026-10-15T10:00:00Z"}, fields)
+
+	recorded, ok := RemoveAfter(data.Role{Custom: custom})
+	require.True(t, ok)
+	require.True(t, removeAfter.Equal(recorded))
+
+	for _, invalid := range []string{`["CI-7"]`, `"CI-7"`, `null`, `{`} {
+		_, err := WithRemoveAfter(rawCustom(invalid), removeAfter)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestStaleDelegations(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	roles := []data.Role{
+		{Name: "targets/past", Custom: rawCustom(`{"notary_remove_after": "2026-10-15T11:00:00Z"}`)},
+		{Name: "targets/now", Custom: rawCustom(`{"notary_remove_after": "2026-10-15T12:00:00Z"}`)},
+		{Name: "targets/future", Custom: rawCustom(`{"notary_remove_after": "2026-10-15T13:00:00Z"}`)},
+		{Name: "targets/none"},
+		{Name: "targets/other", Custom: rawCustom(`{"ticket": "CI-7"}`)},
+		{Name: "targets/array", Custom: rawCustom(`["CI-7"]`)},
+		{Name: "targets/invalid", Custom: rawCustom(`{"notary_remove_after": "yesterday"}`)},
+		{Name: "targets/number", Custom: rawCustom(`{"notary_remove_after": 1}`)},
+	}
+
+	var names []data.RoleName
+	for _, role := range StaleDelegations(roles, now) {
+		names = append(names, role.Name)
+	}
+	require.Equal(t, []data.RoleName{"targets/past", "targets/now"}, names)
+	require.Empty(t, StaleDelegations(roles, now.Add(-2*time.Hour)))
+}
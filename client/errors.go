@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/theupdateframework/notary/tuf/data"
 )
@@ -36,6 +37,17 @@ func (err ErrInvalidLocalRole) Error() string {
 		"notary does not permit the client managing the %s key", err.Role)
 }
 
+// ErrKeyNotServerManaged is returned when reclaiming a key from the server
+// for a role whose key is already held locally
+type ErrKeyNotServerManaged struct {
+	Role data.RoleName
+}
+
+func (err ErrKeyNotServerManaged) Error() string {
+	return fmt.Sprintf(
+		"the %s key is not managed by the server, since it is held locally", err.Role)
+}
+
 // ErrRepositoryNotExist is returned when an action is taken on a remote
 // repository that doesn't exist
 type ErrRepositoryNotExist struct {
@@ -46,3 +58,66 @@ type ErrRepositoryNotExist struct {
 func (err ErrRepositoryNotExist) Error() string {
 	return fmt.Sprintf("%s does not have trust data for %s", err.remote, err.gun.String())
 }
+
+// ErrUnverifiedNotFound is returned when the server claims that a repository
+// doesn't exist, but a key is pinned for the GUN with which the server must
+// sign such claims and the claim doesn't come with a valid signed statement
+type ErrUnverifiedNotFound struct {
+	gun data.GUN
+	msg string
+}
+
+func (err ErrUnverifiedNotFound) Error() string {
+	return fmt.Sprintf("could not verify the server's claim that %s does not exist: %s", err.gun, err.msg)
+}
+
+// ErrTimestampAuthority is returned when the snapshot referenced by the
+// timestamp was not countersigned by a trusted timestamping authority
+type ErrTimestampAuthority struct {
+	msg string
+}
+
+func (err ErrTimestampAuthority) Error() string {
+	return fmt.Sprintf("could not verify timestamping authority token: %s", err.msg)
+}
+
+// ErrTOFUPinExpired is returned when the cached root of a GUN was trusted on
+// first use longer ago than the maximum age allowed by the trust pinning
+// configuration, so the GUN must be re-pinned before it is trusted again
+type ErrTOFUPinExpired struct {
+	gun      data.GUN
+	pinnedAt time.Time
+	maxAge   time.Duration
+}
+
+func (err ErrTOFUPinExpired) Error() string {
+	return fmt.Sprintf("the root of %s was trusted on first use at %s, more than %s ago, so it must be re-pinned with --repin",
+		err.gun, err.pinnedAt.Format(time.RFC3339), err.maxAge)
+}
+
+// ErrSnapshotVersionUnavailable is returned when the server can't provide
+// the snapshot of a repository with a particular version, either because
+// there has been no such version or because the server no longer has it
+type ErrSnapshotVersionUnavailable struct {
+	gun     data.GUN
+	version int
+	msg     string
+}
+
+func (err ErrSnapshotVersionUnavailable) Error() string {
+	return fmt.Sprintf("version %d of the snapshot of %s is not available: %s", err.version, err.gun, err.msg)
+}
+
+// ErrUnsupportedByServer is returned when metadata which is about to be
+// published has a field which the notary-server release it is published for
+// does not know about.  Publishing is refused, rather than dropping the field
+// from signed metadata, and the changes are left staged.
+type ErrUnsupportedByServer struct {
+	Role    data.RoleName
+	Field   string
+	Version string
+}
+
+func (err ErrUnsupportedByServer) Error() string {
+	return fmt.Sprintf("refusing to publish %s with %s, which notary-server %s does not support", err.Role, err.Field, err.Version)
+}
@@ -1,14 +1,19 @@
 package client
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
+	canonicaljson "github.com/docker/go/canonical/json"
 	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/client/changelist"
 	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tsa"
 	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
@@ -82,13 +87,21 @@ func changeTargetsDelegation(repo *tuf.Repo, c changelist.Change) error {
 			return err
 		}
 
-		// Try to create brand new role or update one
-		// First add the keys, then the paths.  We can only add keys and paths in this scenario
-		err = repo.UpdateDelegationKeys(c.Scope(), td.AddKeys, []string{}, td.NewThreshold)
-		if err != nil {
+		if td.Replace {
+			// Set the keys and the paths together, so that the role never has a mix of old and new ones
+			err = repo.ReplaceDelegationKeysAndPaths(c.Scope(), td.AddKeys, td.AddPaths)
+		} else {
+			// Try to create brand new role or update one
+			// First add the keys, then the paths.  We can only add keys and paths in this scenario
+			err = repo.UpdateDelegationKeys(c.Scope(), td.AddKeys, []string{}, td.NewThreshold)
+			if err == nil {
+				err = repo.UpdateDelegationPaths(c.Scope(), td.AddPaths, []string{}, false)
+			}
+		}
+		if err != nil || td.Custom == nil {
 			return err
 		}
-		return repo.UpdateDelegationPaths(c.Scope(), td.AddPaths, []string{}, false)
+		return repo.UpdateDelegationCustom(c.Scope(), td.Custom)
 	case changelist.ActionUpdate:
 		td := changelist.TUFDelegation{}
 		err := json.Unmarshal(c.Content(), &td)
@@ -119,11 +132,20 @@ func changeTargetsDelegation(repo *tuf.Repo, c changelist.Change) error {
 			removeTUFKeyIDs = append(removeTUFKeyIDs, canonicalToTUFID[canonID])
 		}
 
-		err = repo.UpdateDelegationKeys(c.Scope(), td.AddKeys, removeTUFKeyIDs, td.NewThreshold)
+		// Update the keys and the paths together, so that a change to both is never half applied
+		err = repo.UpdateDelegationKeysAndPaths(c.Scope(), td.AddKeys, removeTUFKeyIDs, td.AddPaths, td.RemovePaths, td.ClearAllPaths)
 		if err != nil {
 			return err
 		}
-		return repo.UpdateDelegationPaths(c.Scope(), td.AddPaths, td.RemovePaths, td.ClearAllPaths)
+		if td.NewThreshold > 0 {
+			if err := repo.UpdateDelegationThreshold(c.Scope(), td.NewThreshold); err != nil {
+				return err
+			}
+		}
+		if td.Custom == nil {
+			return nil
+		}
+		return repo.UpdateDelegationCustom(c.Scope(), td.Custom)
 	case changelist.ActionDelete:
 		return repo.DeleteDelegation(c.Scope())
 	default:
@@ -193,34 +215,119 @@ func applyRootRoleChange(repo *tuf.Repo, c changelist.Change) error {
 	return nil
 }
 
-func nearExpiry(r data.SignedCommon) bool {
-	plus6mo := time.Now().AddDate(0, 6, 0)
+func nearExpiry(r data.SignedCommon, now time.Time) bool {
+	plus6mo := now.AddDate(0, 6, 0)
 	return r.Expires.Before(plus6mo)
 }
 
-func warnRolesNearExpiry(r *tuf.Repo) {
+func warnRolesNearExpiry(r *tuf.Repo, now time.Time) {
 	//get every role and its respective signed common and call nearExpiry on it
 	//Root check
-	if nearExpiry(r.Root.Signed.SignedCommon) {
+	if nearExpiry(r.Root.Signed.SignedCommon, now) {
 		logrus.Warn("root is nearing expiry, you should re-sign the role metadata")
 	}
 	//Targets and delegations check
 	for role, signedTOrD := range r.Targets {
 		//signedTOrD is of type *data.SignedTargets
-		if nearExpiry(signedTOrD.Signed.SignedCommon) {
+		if nearExpiry(signedTOrD.Signed.SignedCommon, now) {
 			logrus.Warn(role, " metadata is nearing expiry, you should re-sign the role metadata")
 		}
 	}
 	//Snapshot check
-	if nearExpiry(r.Snapshot.Signed.SignedCommon) {
+	if nearExpiry(r.Snapshot.Signed.SignedCommon, now) {
 		logrus.Warn("snapshot is nearing expiry, you should re-sign the role metadata")
 	}
 	//do not need to worry about Timestamp, notary signer will re-sign with the timestamp key
 }
 
-// Fetches a public key from a remote store, given a gun and role
-func getRemoteKey(role data.RoleName, remote store.RemoteStore) (data.PublicKey, error) {
-	rawPubKey, err := remote.GetKey(role)
+// verifyTimestampAuthority checks that the snapshot referenced by the timestamp
+// was countersigned by a timestamping authority whose certificate chains up to
+// one of the CAs in caFile
+func verifyTimestampAuthority(r *tuf.Repo, caFile string) error {
+	if r.Timestamp == nil {
+		return ErrTimestampAuthority{msg: "no timestamp loaded"}
+	}
+	caCerts, err := utils.LoadCertBundleFromFile(caFile)
+	if err != nil {
+		return fmt.Errorf("could not load timestamping authority CA file %s: %v", caFile, err)
+	}
+	roots := x509.NewCertPool()
+	for _, cert := range caCerts {
+		roots.AddCert(cert)
+	}
+
+	snapshotMeta, ok := r.Timestamp.Signed.Meta[data.CanonicalSnapshotRole.String()]
+	if !ok {
+		return ErrTimestampAuthority{msg: "timestamp does not reference a snapshot"}
+	}
+	token, err := tsa.TokenFromCustom(snapshotMeta.Custom)
+	if err != nil {
+		return ErrTimestampAuthority{msg: err.Error()}
+	}
+	genTime, err := tsa.Verify(token, snapshotMeta.Hashes[notary.SHA256], roots)
+	if err != nil {
+		return ErrTimestampAuthority{msg: err.Error()}
+	}
+	logrus.Debugf("snapshot was countersigned by the timestamping authority at %s", genTime)
+	return nil
+}
+
+// verifyNotFound checks the remote store's claim that the GUN does not exist
+// against the key pinned for the GUN with which the server must sign such
+// claims, if any is pinned.  The signed statement must be for the GUN, and
+// must echo the nonce of the request so that it can't have been replayed.
+func verifyNotFound(gun data.GUN, trustPinning trustpinning.TrustPinConfig, notFound store.ErrMetaNotFound) error {
+	key, err := trustpinning.PinnedNotFoundKey(trustPinning, gun)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+	if notFound.NotFound == nil {
+		return ErrUnverifiedNotFound{gun: gun, msg: "the server gave no signed statement"}
+	}
+
+	var decoded map[string]interface{}
+	if err := canonicaljson.Unmarshal(*notFound.NotFound.Signed, &decoded); err != nil {
+		return ErrUnverifiedNotFound{gun: gun, msg: err.Error()}
+	}
+	msg, err := canonicaljson.MarshalCanonical(decoded)
+	if err != nil {
+		return ErrUnverifiedNotFound{gun: gun, msg: err.Error()}
+	}
+	pinned := data.BaseRole{Keys: data.Keys{key.ID(): key}, Threshold: 1}
+	if _, err := signed.VerifyDetached(msg, notFound.NotFound.Signatures, pinned); err != nil {
+		return ErrUnverifiedNotFound{gun: gun, msg: "the statement is not signed by the pinned key"}
+	}
+
+	statement, err := data.NotFoundFromSigned(notFound.NotFound)
+	if err != nil {
+		return ErrUnverifiedNotFound{gun: gun, msg: err.Error()}
+	}
+	if statement.Signed.GUN != gun {
+		return ErrUnverifiedNotFound{gun: gun, msg: fmt.Sprintf("the statement is for %s", statement.Signed.GUN)}
+	}
+	if notFound.Nonce == "" || statement.Signed.Nonce != notFound.Nonce {
+		return ErrUnverifiedNotFound{gun: gun, msg: "the statement does not echo the nonce of the request"}
+	}
+	return nil
+}
+
+// Fetches a public key from a remote store, given a gun and role, asking for
+// it to be generated with the given algorithm if one is provided
+func getRemoteKey(role data.RoleName, remote store.RemoteStore, algorithm string) (data.PublicKey, error) {
+	var (
+		rawPubKey []byte
+		err       error
+	)
+	if algorithm == "" {
+		rawPubKey, err = remote.GetKey(role)
+	} else if keyStore, ok := remote.(store.KeyAlgorithmStore); ok {
+		rawPubKey, err = keyStore.GetKeyWithAlgorithm(role, algorithm)
+	} else {
+		return nil, fmt.Errorf("remote store cannot generate %s keys with a requested algorithm", role)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -248,17 +355,18 @@ func rotateRemoteKey(role data.RoleName, remote store.RemoteStore) (data.PublicK
 	return pubKey, nil
 }
 
-// signs and serializes the metadata for a canonical role in a TUF repo to JSON
-func serializeCanonicalRole(tufRepo *tuf.Repo, role data.RoleName, extraSigningKeys data.KeyList) (out []byte, err error) {
+// signs and serializes the metadata for a canonical role in a TUF repo to JSON,
+// valid from now
+func serializeCanonicalRole(tufRepo *tuf.Repo, role data.RoleName, extraSigningKeys data.KeyList, now time.Time) (out []byte, err error) {
 	var s *data.Signed
 	switch {
 	case role == data.CanonicalRootRole:
-		s, err = tufRepo.SignRoot(data.DefaultExpires(role), extraSigningKeys)
+		s, err = tufRepo.SignRoot(data.DefaultExpiresAt(role, now), extraSigningKeys)
 	case role == data.CanonicalSnapshotRole:
-		s, err = tufRepo.SignSnapshot(data.DefaultExpires(role))
+		s, err = tufRepo.SignSnapshot(data.DefaultExpiresAt(role, now))
 	case tufRepo.Targets[role] != nil:
 		s, err = tufRepo.SignTargets(
-			role, data.DefaultExpires(data.CanonicalTargetsRole))
+			role, data.DefaultExpiresAt(data.CanonicalTargetsRole, now))
 	default:
 		err = fmt.Errorf("%s not supported role to sign on the client", role)
 	}
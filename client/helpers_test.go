@@ -571,6 +571,44 @@ func TestApplyTargetsDelegationAlreadyExistingMergePaths(t *testing.T) {
 	require.Contains(t, delegation.Paths, "level1")
 }
 
+func TestApplyTargetsDelegationAlreadyExistingReplace(t *testing.T) {
+	repo, cs, err := testutils.EmptyRepo("docker.com/notary")
+	require.NoError(t, err)
+
+	oldKey, err := cs.Create("targets/level1", "docker.com/notary", data.ED25519Key)
+	require.NoError(t, err)
+	newKey, err := cs.Create("targets/level1", "docker.com/notary", data.ED25519Key)
+	require.NoError(t, err)
+
+	applyDelegation := func(td *changelist.TUFDelegation) {
+		tdJSON, err := json.Marshal(td)
+		require.NoError(t, err)
+		ch := changelist.NewTUFChange(
+			changelist.ActionCreate,
+			"targets/level1",
+			changelist.TypeTargetsDelegation,
+			"",
+			tdJSON,
+		)
+		require.NoError(t, applyTargetsChange(repo, nil, ch))
+	}
+
+	// adding a different key and path merges them with the previous ones
+	applyDelegation(&changelist.TUFDelegation{NewThreshold: 1, AddKeys: data.KeyList{oldKey}, AddPaths: []string{"level1"}})
+	applyDelegation(&changelist.TUFDelegation{NewThreshold: 1, AddKeys: data.KeyList{newKey}, AddPaths: []string{"level2"}})
+	delegation, err := repo.GetDelegationRole("targets/level1")
+	require.NoError(t, err)
+	require.Len(t, delegation.ListKeyIDs(), 2)
+	require.Len(t, delegation.Paths, 2)
+
+	// replacing them leaves only the new key and path
+	applyDelegation(&changelist.TUFDelegation{NewThreshold: 1, AddKeys: data.KeyList{newKey}, AddPaths: []string{"level3"}, Replace: true})
+	delegation, err = repo.GetDelegationRole("targets/level1")
+	require.NoError(t, err)
+	require.Equal(t, []string{newKey.ID()}, delegation.ListKeyIDs())
+	require.Equal(t, []string{"level3"}, delegation.Paths)
+}
+
 func TestApplyTargetsDelegationInvalidRole(t *testing.T) {
 	repo, cs, err := testutils.EmptyRepo("docker.com/notary")
 	require.NoError(t, err)
@@ -991,7 +1029,7 @@ func TestAllNearExpiry(t *testing.T) {
 	defer log.SetLevel(orgLevel)
 	b := bytes.NewBuffer(nil)
 	log.SetOutput(b)
-	warnRolesNearExpiry(repo)
+	warnRolesNearExpiry(repo, time.Now())
 	require.Contains(t, b.String(), "targets metadata is nearing expiry, you should re-sign the role metadata", "targets should show near expiry")
 	require.Contains(t, b.String(), "targets/exp metadata is nearing expiry, you should re-sign the role metadata", "targets/exp should show near expiry")
 	require.Contains(t, b.String(), "root is nearing expiry, you should re-sign the role metadata", "Root should show near expiry")
@@ -1015,7 +1053,7 @@ func TestAllNotNearExpiry(t *testing.T) {
 	defer log.SetLevel(orgLevel)
 	a := bytes.NewBuffer(nil)
 	log.SetOutput(a)
-	warnRolesNearExpiry(repo)
+	warnRolesNearExpiry(repo, time.Now())
 	require.NotContains(t, a.String(), "targets metadata is nearing expiry, you should re-sign the role metadata", "targets should not show near expiry")
 	require.NotContains(t, a.String(), "targets/noexp metadata is nearing expiry, you should re-sign the role metadata", "targets/noexp should not show near expiry")
 	require.NotContains(t, a.String(), "root is nearing expiry, you should re-sign the role metadata", "Root should not show near expiry")
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+// AtSnapshotVersion returns the targets of the repository as they were when
+// its snapshot had the given version.  The historical snapshot, and the
+// targets and delegations it lists, are downloaded from the server by version
+// and checksum and verified against the root which the snapshot lists, which
+// must itself lead to the repository's current root by a chain of valid root
+// rotations.  Historical metadata is allowed to have expired.
+func (r *repository) AtSnapshotVersion(version int) (ReadOnly, error) {
+	if version < 1 {
+		return nil, ErrSnapshotVersionUnavailable{gun: r.gun, version: version, msg: "versions start at 1"}
+	}
+	if err := r.updateTUF(false); err != nil {
+		return nil, err
+	}
+	if current := r.tufRepo.Snapshot.Signed.Version; version > current {
+		return nil, ErrSnapshotVersionUnavailable{gun: r.gun, version: version,
+			msg: fmt.Sprintf("the current version is %d", current)}
+	}
+
+	snapshotRole := fmt.Sprintf("%d.%s", version, data.CanonicalSnapshotRole)
+	snapshotJSON, err := r.remoteStore.GetSized(snapshotRole, store.NoSizeLimit)
+	if err != nil {
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			return nil, ErrSnapshotVersionUnavailable{gun: r.gun, version: version, msg: "the server does not have it"}
+		}
+		return nil, err
+	}
+
+	// the snapshot can only be verified once its root is, so the root it
+	// lists is found without verifying it first
+	unverified := &data.SignedSnapshot{}
+	if err := json.Unmarshal(snapshotJSON, unverified); err != nil {
+		return nil, fmt.Errorf("invalid snapshot version %d: %v", version, err)
+	}
+	rootMeta, ok := unverified.Signed.Meta[data.CanonicalRootRole.String()]
+	if !ok {
+		return nil, fmt.Errorf("snapshot version %d does not list a root", version)
+	}
+	rootName := utils.ConsistentName(data.CanonicalRootRole.String(), rootMeta.Hashes[notary.SHA256])
+	rootJSON, err := r.remoteStore.GetSized(rootName, rootMeta.Length)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkRootInChain(rootJSON); err != nil {
+		return nil, err
+	}
+
+	builder := tuf.NewRepoBuilder(r.gun, r.cryptoService, trustpinning.TrustPinConfig{})
+	if err := builder.Load(data.CanonicalRootRole, rootJSON, 1, true); err != nil {
+		return nil, err
+	}
+	if err := builder.Load(data.CanonicalSnapshotRole, snapshotJSON, version, true); err != nil {
+		return nil, err
+	}
+	if loaded := builder.GetLoadedVersion(data.CanonicalSnapshotRole); loaded != version {
+		return nil, fmt.Errorf("the server returned version %d of the snapshot when asked for version %d", loaded, version)
+	}
+
+	// the targets and delegations are loaded into the builder in the same way
+	// as an update does, but without touching the repository's cache
+	historical := &tufClient{
+		remote:       r.remoteStore,
+		cache:        store.NewMemoryStore(nil),
+		oldBuilder:   tuf.NewRepoBuilder(r.gun, nil, trustpinning.TrustPinConfig{}),
+		newBuilder:   builder,
+		allowExpired: true,
+	}
+	if err := historical.downloadTargets(); err != nil {
+		return nil, err
+	}
+	repo, _, err := builder.Finish()
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("loaded %s as of snapshot version %d", r.gun, version)
+	return NewReadOnly(repo), nil
+}
+
+// checkRootInChain checks that a historical root leads to the repository's
+// current trusted root, in that each later version of the root is signed by
+// the keys of the one before it
+func (r *repository) checkRootInChain(rootJSON []byte) error {
+	trustedJSON, err := r.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	if err != nil {
+		return err
+	}
+	unverified := &data.SignedRoot{}
+	if err := json.Unmarshal(rootJSON, unverified); err != nil {
+		return fmt.Errorf("invalid historical root: %v", err)
+	}
+	from, to := unverified.Signed.Version, r.tufRepo.Root.Signed.Version
+	if from > to {
+		return fmt.Errorf("historical root version %d is newer than the trusted root version %d", from, to)
+	}
+
+	builder := tuf.NewRepoBuilder(r.gun, nil, trustpinning.TrustPinConfig{})
+	if err := builder.LoadRootForUpdate(rootJSON, from, false); err != nil {
+		return err
+	}
+	for v := from + 1; v <= to; v++ {
+		versionedRole := fmt.Sprintf("%d.%s", v, data.CanonicalRootRole)
+		if rootJSON, err = r.remoteStore.GetSized(versionedRole, store.NoSizeLimit); err != nil {
+			return err
+		}
+		if err := builder.LoadRootForUpdate(rootJSON, v, false); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(rootJSON, trustedJSON) {
+		return fmt.Errorf("historical root version %d does not lead to the trusted root", from)
+	}
+	return nil
+}
+
+// RootVersion describes the keys of a version of a repository's root role,
+// and which of them were added and removed by that version.  Key IDs are
+// those listed in the root metadata, and are sorted.
+type RootVersion struct {
+	Version   int
+	Threshold int
+	KeyIDs    []string
+	Added     []string
+	Removed   []string
+}
+
+// RootHistory returns the versions of the repository's root, oldest first,
+// up to its current version.  The historical roots are downloaded from the
+// server by version, back to the oldest version it still has, and each is
+// verified to be signed by the keys of the version before it, so that the
+// chain leads to the current trusted root.  Since the keys of the version
+// before the oldest one are not known, its keys are only reported as added
+// if it is the first version.
+func (r *repository) RootHistory() ([]RootVersion, error) {
+	if err := r.updateTUF(false); err != nil {
+		return nil, err
+	}
+	trustedJSON, err := r.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	current := r.tufRepo.Root.Signed.Version
+
+	roots := [][]byte{trustedJSON}
+	for v := current - 1; v >= 1; v-- {
+		versionedRole := fmt.Sprintf("%d.%s", v, data.CanonicalRootRole)
+		rootJSON, err := r.remoteStore.GetSized(versionedRole, store.NoSizeLimit)
+		if err != nil {
+			if _, ok := err.(store.ErrMetaNotFound); ok {
+				logrus.Debugf("the server no longer has version %d of the root of %s", v, r.gun)
+				break
+			}
+			return nil, err
+		}
+		roots = append([][]byte{rootJSON}, roots...)
+	}
+
+	builder := tuf.NewRepoBuilder(r.gun, nil, trustpinning.TrustPinConfig{})
+	history := make([]RootVersion, 0, len(roots))
+	var previous map[string]bool
+	for i, rootJSON := range roots {
+		version := current - len(roots) + 1 + i
+		if err := builder.LoadRootForUpdate(rootJSON, version, false); err != nil {
+			return nil, fmt.Errorf("invalid root version %d: %v", version, err)
+		}
+		signedObj := &data.Signed{}
+		if err := json.Unmarshal(rootJSON, signedObj); err != nil {
+			return nil, err
+		}
+		root, err := data.RootFromSigned(signedObj)
+		if err != nil {
+			return nil, err
+		}
+		if root.Signed.Version != version {
+			return nil, fmt.Errorf("the server returned version %d of the root when asked for version %d", root.Signed.Version, version)
+		}
+		rootRole, err := root.BuildBaseRole(data.CanonicalRootRole)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := RootVersion{Version: version, Threshold: rootRole.Threshold, KeyIDs: rootRole.ListKeyIDs()}
+		sort.Strings(entry.KeyIDs)
+		keys := make(map[string]bool, len(entry.KeyIDs))
+		for _, keyID := range entry.KeyIDs {
+			keys[keyID] = true
+			if (previous == nil && version == 1) || (previous != nil && !previous[keyID]) {
+				entry.Added = append(entry.Added, keyID)
+			}
+		}
+		for keyID := range previous {
+			if !keys[keyID] {
+				entry.Removed = append(entry.Removed, keyID)
+			}
+		}
+		sort.Strings(entry.Removed)
+		history = append(history, entry)
+		previous = keys
+	}
+	return history, nil
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// A target can be read as it was at a past snapshot version, after it has
+// changed and the root has been rotated since
+func TestAtSnapshotVersion(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	old := addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, repo.Publish())
+	require.NoError(t, repo.updateTUF(false))
+	oldVersion := repo.tufRepo.Snapshot.Signed.Version
+
+	updated := addTarget(t, repo, "current", "../fixtures/root-ca.crt")
+	require.NoError(t, repo.Publish())
+	require.NoError(t, repo.RotateKey(data.CanonicalRootRole, false, nil))
+	require.NoError(t, repo.Publish())
+	require.NotEqual(t, old.Hashes, updated.Hashes)
+
+	// a client which has only ever trusted the current root
+	reader, _, readerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(readerDir)
+
+	current, err := reader.GetTargetByName("current")
+	require.NoError(t, err)
+	require.Equal(t, updated.Hashes, current.Hashes)
+
+	past, err := reader.AtSnapshotVersion(oldVersion)
+	require.NoError(t, err)
+	target, err := past.GetTargetByName("current")
+	require.NoError(t, err)
+	require.Equal(t, old.Hashes, target.Hashes)
+	require.Equal(t, data.CanonicalTargetsRole, target.Role)
+
+	// versions the server doesn't have are reported as unavailable
+	require.NoError(t, reader.updateTUF(false))
+	for _, version := range []int{0, reader.tufRepo.Snapshot.Signed.Version + 1} {
+		_, err = reader.AtSnapshotVersion(version)
+		require.IsType(t, ErrSnapshotVersionUnavailable{}, err)
+	}
+}
+
+// currentRootKeyIDs gets the sorted IDs of the keys of the repository's
+// current root role
+func currentRootKeyIDs(t *testing.T, repo *repository) []string {
+	require.NoError(t, repo.updateTUF(false))
+	rootRole, err := repo.tufRepo.Root.BuildBaseRole(data.CanonicalRootRole)
+	require.NoError(t, err)
+	keyIDs := rootRole.ListKeyIDs()
+	sort.Strings(keyIDs)
+	return keyIDs
+}
+
+func TestRootHistory(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	keys := [][]string{currentRootKeyIDs(t, repo)}
+
+	// the root key is rotated twice
+	for i := 0; i < 2; i++ {
+		require.NoError(t, repo.RotateKey(data.CanonicalRootRole, false, nil))
+		require.NoError(t, repo.Publish())
+		keys = append(keys, currentRootKeyIDs(t, repo))
+	}
+	require.Len(t, keys[0], 1)
+	require.NotEqual(t, keys[0], keys[1])
+	require.NotEqual(t, keys[1], keys[2])
+
+	// a client which has only ever trusted the current root
+	reader, _, readerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(readerDir)
+
+	history, err := reader.RootHistory()
+	require.NoError(t, err)
+	require.Equal(t, []RootVersion{
+		{Version: 1, Threshold: 1, KeyIDs: keys[0], Added: keys[0]},
+		{Version: 2, Threshold: 1, KeyIDs: keys[1], Added: keys[1], Removed: keys[0]},
+		{Version: 3, Threshold: 1, KeyIDs: keys[2], Added: keys[2], Removed: keys[1]},
+	}, history)
+}
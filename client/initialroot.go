@@ -0,0 +1,103 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// parseRootBundle splits a root bundle into the roots it contains.  A bundle
+// is either a single signed root.json, or a JSON array of signed root.json
+// files ordered from the oldest version to the newest, each of which is
+// signed by the keys of the root before it.
+func parseRootBundle(bundle []byte) ([][]byte, error) {
+	bundle = bytes.TrimSpace(bundle)
+	if !bytes.HasPrefix(bundle, []byte("[")) {
+		return [][]byte{bundle}, nil
+	}
+	var roots []json.RawMessage
+	if err := json.Unmarshal(bundle, &roots); err != nil {
+		return nil, fmt.Errorf("invalid root bundle: %w", err)
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("invalid root bundle: no roots")
+	}
+	chain := make([][]byte, 0, len(roots))
+	for _, root := range roots {
+		chain = append(chain, []byte(root))
+	}
+	return chain, nil
+}
+
+// SeedRoot validates a root bundle, either a single signed root.json or a
+// chain of them, and caches the newest root as the trusted root of the
+// repository, so that trust is bootstrapped from the bundle rather than on
+// first use.
+//
+// If no root is cached yet, the oldest root in the bundle must satisfy the
+// trust pinning configuration.  Otherwise the cached root is what pins trust,
+// so the bundle must rotate from it.  Every later root in the bundle must be
+// signed by the root before it, and the newest root must not be expired.
+// Nothing is cached unless the whole bundle is valid.
+func (r *repository) SeedRoot(bundle []byte) (*data.SignedRoot, error) {
+	chain, err := parseRootBundle(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := tuf.NewRepoBuilder(r.gun, r.cryptoService, r.trustPinning)
+	builder.SetClock(r.clock)
+	minVersion := 1
+	cached, err := r.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	if err == nil {
+		// the cached root is the source of trust pinning, as when bootstrapping
+		// a client, so it need not satisfy the trust pinning configuration
+		builder = tuf.NewRepoBuilder(r.gun, r.cryptoService, trustpinning.TrustPinConfig{})
+		builder.SetClock(r.clock)
+		if err := builder.LoadRootForUpdate(cached, minVersion, false); err != nil {
+			return nil, fmt.Errorf("cached root is invalid: %w", err)
+		}
+		minVersion = builder.GetLoadedVersion(data.CanonicalRootRole)
+	}
+
+	for i, raw := range chain {
+		isFinal := i == len(chain)-1
+		if err := builder.LoadRootForUpdate(raw, minVersion, isFinal); err != nil {
+			logrus.Debugf("root %d of the bundle for %s is invalid: %s", i+1, r.gun, err)
+			return nil, err
+		}
+		minVersion = builder.GetLoadedVersion(data.CanonicalRootRole) + 1
+		if i == 0 && len(chain) > 1 {
+			// later roots in the bundle are trusted because they are signed
+			// by the root before them, not because of trust pinning
+			builder = builder.BootstrapNewBuilderWithNewTrustpin(trustpinning.TrustPinConfig{})
+		}
+	}
+
+	newest := chain[len(chain)-1]
+	signedRoot, err := rootFromBytes(newest)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.cache.Set(data.CanonicalRootRole.String(), newest); err != nil {
+		return nil, err
+	}
+	if cached == nil && trustpinning.UsesTOFU(r.trustPinning, r.gun) {
+		recordTOFUPin(r.cache, r.gun, r.now())
+	}
+	return signedRoot, nil
+}
+
+func rootFromBytes(raw []byte) (*data.SignedRoot, error) {
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return data.RootFromSigned(s)
+}
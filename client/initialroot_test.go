@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/passphrase"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// newPinnedRepo returns a repository with an empty cache which pins the
+// certificate of the root key of the given root, and doesn't trust on first use
+func newPinnedRepo(t *testing.T, gun data.GUN, url string, rootJSON []byte) (*repository, string) {
+	root, err := rootFromBytes(rootJSON)
+	require.NoError(t, err)
+	pins := trustpinning.TrustPinConfig{
+		Certs:       map[string][]string{gun.String(): root.Signed.Roles[data.CanonicalRootRole].KeyIDs},
+		DisableTOFU: true,
+	}
+
+	dir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	r, err := NewFileCachedRepository(dir, gun, url, http.DefaultTransport,
+		passphrase.ConstantRetriever(password), pins)
+	require.NoError(t, err)
+	return r.(*repository), dir
+}
+
+// A root bundle which satisfies the trust pinning configuration is cached, so
+// that the first fetch of the repository trusts it.  A bundle which has been
+// tampered with is rejected, and nothing is cached.
+func TestSeedRoot(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	authorRepo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	addTarget(t, authorRepo, "current", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, authorRepo.Publish())
+	rootJSON, err := authorRepo.remoteStore.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+
+	tampered := bytes.Replace(rootJSON, []byte(`"consistent_snapshot":false`), []byte(`"consistent_snapshot":true`), 1)
+	require.NotEqual(t, rootJSON, tampered)
+
+	repo, dir := newPinnedRepo(t, authorRepo.gun, ts.URL, rootJSON)
+	defer os.RemoveAll(dir)
+
+	_, err = repo.SeedRoot(tampered)
+	require.Error(t, err)
+	_, err = repo.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.IsType(t, store.ErrMetaNotFound{}, err)
+
+	root, err := repo.SeedRoot(rootJSON)
+	require.NoError(t, err)
+	require.Equal(t, 1, root.Signed.Version)
+	cached, err := repo.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, rootJSON, cached)
+
+	targets, err := repo.ListTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	require.Equal(t, "current", targets[0].Name)
+
+	// once a root is cached, a tampered bundle can't replace it either
+	_, err = repo.SeedRoot(tampered)
+	require.Error(t, err)
+	cached, err = repo.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, rootJSON, cached)
+}
+
+// A chain of roots is trusted if its oldest root satisfies the trust pinning
+// configuration and every later root is signed by the root before it
+func TestSeedRootChain(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	authorRepo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, authorRepo.Publish())
+	require.NoError(t, authorRepo.RotateKey(data.CanonicalRootRole, false, nil))
+	require.NoError(t, authorRepo.Publish())
+
+	v1, err := authorRepo.remoteStore.GetSized("1."+data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+	v2, err := authorRepo.remoteStore.GetSized("2."+data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+
+	bundle := func(roots ...[]byte) []byte {
+		raw := make([]json.RawMessage, 0, len(roots))
+		for _, r := range roots {
+			raw = append(raw, r)
+		}
+		b, err := json.Marshal(raw)
+		require.NoError(t, err)
+		return b
+	}
+
+	repo, dir := newPinnedRepo(t, authorRepo.gun, ts.URL, v1)
+	defer os.RemoveAll(dir)
+
+	// the newest root doesn't satisfy the pins by itself, and the chain
+	// must be ordered by version
+	for _, invalid := range [][]byte{v2, bundle(v2), bundle(v2, v1), []byte(`[]`)} {
+		_, err := repo.SeedRoot(invalid)
+		require.Error(t, err)
+	}
+	_, err = repo.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.IsType(t, store.ErrMetaNotFound{}, err)
+
+	root, err := repo.SeedRoot(bundle(v1, v2))
+	require.NoError(t, err)
+	require.Equal(t, 2, root.Signed.Version)
+	cached, err := repo.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, v2, cached)
+
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+}
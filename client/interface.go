@@ -1,7 +1,12 @@
 package client
 
 import (
+	"io"
+	"time"
+
+	canonicaljson "github.com/docker/go/canonical/json"
 	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 )
@@ -42,6 +47,17 @@ type ReadOnly interface {
 	// GetDelegationRoles returns the keys and roles of the repository's delegations
 	// Also converts key IDs to canonical key IDs to keep consistent with signing prompts
 	GetDelegationRoles() ([]data.Role, error)
+
+	// GetDelegationKeys returns the public keys of a delegation role by key ID,
+	// without validating them.  Key IDs the role lists whose keys are missing
+	// map to nil.
+	GetDelegationKeys(name data.RoleName) (map[string]data.PublicKey, error)
+
+	// VerifyDetachedSignature checks signatures over arbitrary data, rather
+	// than over TUF metadata, against the keys of a role, and returns the IDs
+	// of the keys whose signatures are valid.  An error is returned if they
+	// don't meet the role's threshold.
+	VerifyDetachedSignature(role data.RoleName, msg []byte, sigs []data.Signature) ([]string, error)
 }
 
 // Repository represents the set of options that must be supported over a TUF repo
@@ -57,8 +73,55 @@ type Repository interface {
 	// SetLegacyVersion sets the number of versions back to fetch roots to sign with
 	SetLegacyVersions(int)
 
+	// SetPublishProgress sets a function to be called as each stage of
+	// publishing is reached
+	SetPublishProgress(PublishProgressFunc)
+
+	// SetCacheCompression sets whether metadata is gzip-compressed when it
+	// is cached
+	SetCacheCompression(bool)
+
+	// SetClockSkewThreshold sets how far the local clock may be ahead of the
+	// remote server's before expired metadata is blamed on the local clock
+	SetClockSkewThreshold(time.Duration)
+
+	// SetClock sets the clock which tells the time that metadata is checked
+	// for expiry against, and that metadata signed by the repository is valid
+	// from.  A nil clock restores the real clock.
+	SetClock(data.Clock)
+
+	// SetSignatureAlgorithms sets the signature algorithm that each role in
+	// the policy must be signed with, both when signing and when verifying
+	SetSignatureAlgorithms(signed.AlgorithmPolicy) error
+
+	// SetServerVersion constrains the published metadata to the fields
+	// understood by an older notary-server release, by refusing to publish
+	// metadata with any other field
+	SetServerVersion(string) error
+
+	// SetStatusMapping sets how the HTTP statuses returned by the remote
+	// server are interpreted, for servers behind gateways that rewrite them
+	SetStatusMapping(store.StatusMapping) error
+
 	// ----- General management operations -----
 
+	// Rebuild clears the cached metadata of the repository, then downloads
+	// and verifies it afresh from the remote server.  Keys and staged changes
+	// are left untouched.
+	Rebuild() error
+
+	// AtSnapshotVersion returns the targets of the repository as they were
+	// when its snapshot had the given version, verified against the root of
+	// that time, which must lead to the current root by valid rotations.
+	// ErrSnapshotVersionUnavailable is returned if the server can't provide
+	// the snapshot.
+	AtSnapshotVersion(version int) (ReadOnly, error)
+
+	// RootHistory returns the versions of the repository's root, oldest
+	// first, with the keys each added and removed, back to the oldest version
+	// the server has.  Each version must lead to the next by a valid rotation.
+	RootHistory() ([]RootVersion, error)
+
 	// Initialize creates a new repository by using rootKey as the root Key for the
 	// TUF repository. The remote store/server must be reachable (and is asked to
 	// generate a timestamp key and possibly other serverManagedRoles), but the
@@ -70,10 +133,40 @@ type Repository interface {
 	// corresponding certificates
 	InitializeWithCertificate(rootKeyIDs []string, rootCerts []data.PublicKey, serverManagedRoles ...data.RoleName) error
 
+	// InitializeWithOptions initializes the repository with root keys, making
+	// the optional choices in opts, such as the root certificates
+	InitializeWithOptions(rootKeyIDs []string, opts InitOptions, serverManagedRoles ...data.RoleName) error
+
+	// SeedRoot validates a root bundle, either a signed root.json or a chain
+	// of them ordered by version, and caches its newest root as the trusted
+	// root of the repository, rather than trusting the server's on first use
+	SeedRoot(bundle []byte) (*data.SignedRoot, error)
+
 	// Publish pushes the local changes in signed material to the remote notary-server
 	// Conceptually it performs an operation similar to a `git rebase`
 	Publish() error
 
+	// PublishRoles pushes only the staged changes to the given roles to the
+	// remote notary-server, leaving changes to other roles staged
+	PublishRoles(roles ...data.RoleName) error
+
+	// ExportOfflineBundle bundles the staged changes with the repository's
+	// current metadata, so that they can be signed on a machine which holds
+	// the keys but cannot reach the server
+	ExportOfflineBundle() (*OfflineBundle, error)
+
+	// SignOfflineBundle applies and signs the changes of a bundle with the
+	// local keys, without contacting the server
+	SignOfflineBundle(bundle *OfflineBundle) error
+
+	// PublishOfflineBundle publishes the metadata of a signed bundle, and
+	// removes its changes from those staged
+	PublishOfflineBundle(bundle *OfflineBundle) error
+
+	// PublishRoot publishes a root which has already been signed, such as
+	// one combined from partial signatures with CombineRootSignatures
+	PublishRoot(root []byte) error
+
 	// ----- Target Operations -----
 
 	// AddTarget creates new changelist entries to add a target to the given roles
@@ -81,6 +174,12 @@ type Repository interface {
 	// If roles are unspecified, the default role is "targets"
 	AddTarget(target *Target, roles ...data.RoleName) error
 
+	// AddTargetWithReader creates new changelist entries to add a target, whose
+	// content is read from the reader rather than a file, to the given roles.
+	// If size is negative, the size of the target is not known in advance.
+	// If roles are unspecified, the default role is "targets"
+	AddTargetWithReader(targetName string, reader io.Reader, size int64, roles ...data.RoleName) error
+
 	// RemoveTarget creates new changelist entries to remove a target from the given
 	// roles in the repository when the changelist gets applied at publish time.
 	// If roles are unspecified, the default role is "target".
@@ -107,6 +206,19 @@ type Repository interface {
 	// creation.
 	AddDelegationPaths(name data.RoleName, paths []string) error
 
+	// ReplaceDelegation creates a single changelist entry to set the keys and paths of a delegation to
+	// exactly those provided, creating the delegation if it does not exist.  Its threshold must not be
+	// more than the number of keys provided.
+	ReplaceDelegation(name data.RoleName, delegationKeys []data.PublicKey, paths []string) error
+
+	// AddDelegationCustom creates a changelist entry to set custom metadata on an existing delegation,
+	// replacing any custom metadata it already has.
+	AddDelegationCustom(name data.RoleName, custom *canonicaljson.RawMessage) error
+
+	// SetDelegationThreshold creates a changelist entry to change the number of signatures an existing
+	// delegation requires, which must be at most the number of keys it has when the change is applied.
+	SetDelegationThreshold(name data.RoleName, threshold int) error
+
 	// RemoveDelegationKeysAndPaths creates changelist entries to remove provided delegation key IDs and
 	// paths. This method composes RemoveDelegationPaths and RemoveDelegationKeys (each creates one
 	// changelist entry if called).
@@ -129,8 +241,17 @@ type Repository interface {
 	// ClearDelegationPaths creates a changelist entry to remove all paths from an existing delegation.
 	ClearDelegationPaths(name data.RoleName) error
 
+	// RemoveDelegationKeyAndPaths creates a single changelist entry to remove provided keys from an
+	// existing delegation and clear all of its paths, so that both are applied together.
+	RemoveDelegationKeyAndPaths(name data.RoleName, keyIDs []string) error
+
 	// ----- Witness and other re-signing operations -----
 
+	// ListRoleExpiries returns when the latest metadata of each role expires,
+	// including metadata which has already expired, so that the roles which
+	// need re-signing can be found
+	ListRoleExpiries() ([]RoleExpiry, error)
+
 	// Witness creates change objects to witness (i.e. re-sign) the given
 	// roles on the next publish. One change is created per role
 	Witness(roles ...data.RoleName) ([]data.RoleName, error)
@@ -144,6 +265,14 @@ type Repository interface {
 	// These changes are staged in a changelist until publish is called.
 	RotateKey(role data.RoleName, serverManagesKey bool, keyList []string) error
 
+	// ReclaimKey rotates a role whose key is currently managed by the server
+	// back to a new key generated and held locally, and publishes the change.
+	ReclaimKey(role data.RoleName) error
+
+	// PlanKeyRotation describes the effect RotateKey would have if called with the
+	// same arguments, without changing any keys or metadata.
+	PlanKeyRotation(role data.RoleName, serverManagesKey bool, keyList []string) (*KeyRotationPlan, error)
+
 	// GetCryptoService is the getter for the repository's CryptoService, which is used
 	// to sign all updates.
 	GetCryptoService() signed.CryptoService
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// OfflineBundle carries staged changes between a machine which can reach the
+// notary server but holds no signing keys, and an offline machine which holds
+// the keys but cannot reach the server.  It is exported with the unsigned
+// changes and the repository's current metadata, signed offline, and then
+// published from the online machine.
+type OfflineBundle struct {
+	GUN data.GUN `json:"gun"`
+	// Metadata is the repository's metadata, by role, when the bundle was
+	// exported, which the changes are applied to when signing
+	Metadata map[data.RoleName][]byte `json:"metadata"`
+	// Changes are the staged changes, in the order they were staged
+	Changes []*changelist.TUFChange `json:"changes"`
+	// Signed is the metadata, by role, produced by signing the changes, which
+	// is empty until the bundle has been signed
+	Signed map[data.RoleName][]byte `json:"signed,omitempty"`
+}
+
+// ExportOfflineBundle bundles the staged changes with the repository's
+// current metadata, downloaded from the server, so that they can be signed
+// on another machine.  The repository must already have been published, and
+// the changes stay staged until the signed bundle is published.
+func (r *repository) ExportOfflineBundle() (*OfflineBundle, error) {
+	changes := r.changelist.List()
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("no staged changes to export for %s", r.gun)
+	}
+	if err := r.updateTUF(true); err != nil {
+		return nil, err
+	}
+
+	roles := []data.RoleName{data.CanonicalRootRole, data.CanonicalSnapshotRole, data.CanonicalTimestampRole}
+	for role := range r.tufRepo.Targets {
+		roles = append(roles, role)
+	}
+	bundle := &OfflineBundle{
+		GUN:      r.gun,
+		Metadata: make(map[data.RoleName][]byte, len(roles)),
+		Changes:  make([]*changelist.TUFChange, 0, len(changes)),
+	}
+	for _, role := range roles {
+		meta, err := r.cache.GetSized(role.String(), store.NoSizeLimit)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Metadata[role] = meta
+	}
+	for _, c := range changes {
+		bundle.Changes = append(bundle.Changes, changelist.NewTUFChange(c.Action(), c.Scope(), c.Type(), c.Path(), c.Content()))
+	}
+	return bundle, nil
+}
+
+// SignOfflineBundle applies the bundle's changes to its metadata and signs
+// the result with the local keys, without contacting the server.  The
+// metadata is validated as if it had been downloaded, using the trust pinning
+// configuration rather than any root cached on this machine.  Since the
+// server can't be asked for older roots, a root is only signed with the keys
+// of its current version.
+func (r *repository) SignOfflineBundle(bundle *OfflineBundle) error {
+	if bundle.GUN != r.gun {
+		return fmt.Errorf("bundle is for %s, not %s", bundle.GUN, r.gun)
+	}
+	if len(bundle.Signed) > 0 {
+		return fmt.Errorf("bundle for %s has already been signed", bundle.GUN)
+	}
+
+	repo, invalid, err := LoadTUFRepo(TUFLoadOptions{
+		GUN:                 r.gun,
+		TrustPinning:        r.trustPinning,
+		CryptoService:       r.cryptoService,
+		RemoteStore:         bundleStore{store.NewMemoryStore(bundle.Metadata)},
+		SignatureAlgorithms: r.signatureAlgorithms,
+		Clock:               r.clock,
+	})
+	if err != nil {
+		return err
+	}
+
+	cl := changelist.NewMemChangelist()
+	for _, c := range bundle.Changes {
+		if err := cl.Add(c); err != nil {
+			return err
+		}
+	}
+	if err := applyChangelist(repo, invalid, cl); err != nil {
+		return err
+	}
+	if err := checkLegacyFields(repo, r.serverVersion); err != nil {
+		return err
+	}
+
+	signedFiles, err := signUpdatedMetadata(repo, nil, false, r.now())
+	if err != nil {
+		return err
+	}
+	bundle.Signed = signedFiles
+	return nil
+}
+
+// PublishOfflineBundle publishes the metadata of a signed bundle, and removes
+// the bundle's changes from those staged.  Publishing fails if the root,
+// targets or delegations have been published again since the bundle was
+// exported, as the signed metadata would undo those changes.
+func (r *repository) PublishOfflineBundle(bundle *OfflineBundle) error {
+	if bundle.GUN != r.gun {
+		return fmt.Errorf("bundle is for %s, not %s", bundle.GUN, r.gun)
+	}
+	if len(bundle.Signed) == 0 {
+		return fmt.Errorf("bundle for %s has not been signed", bundle.GUN)
+	}
+	for role := range bundle.Signed {
+		if role == data.CanonicalTimestampRole || !data.ValidRole(role) {
+			return data.ErrInvalidRole{Role: role, Reason: "cannot be published from a bundle"}
+		}
+	}
+
+	if err := r.updateTUF(true); err != nil {
+		return err
+	}
+	for role, exported := range bundle.Metadata {
+		if role == data.CanonicalSnapshotRole || role == data.CanonicalTimestampRole {
+			// these may be re-signed by the server at any time, and the server
+			// rejects a snapshot which doesn't follow the current one
+			continue
+		}
+		current, err := r.cache.GetSized(role.String(), store.NoSizeLimit)
+		if err != nil || !bytes.Equal(current, exported) {
+			return fmt.Errorf("%s of %s has changed since the bundle was exported, so it must be exported and signed again", role, r.gun)
+		}
+	}
+
+	if err := checkSignedLegacyFields(bundle.Signed, r.serverVersion); err != nil {
+		return err
+	}
+	if err := r.getRemoteStore().SetMulti(data.MetadataRoleMapToStringMap(bundle.Signed)); err != nil {
+		return err
+	}
+
+	// only remove the bundle's changes if they are still the first staged
+	// changes, since the changelist may have been reset and staged again
+	staged := r.changelist.List()
+	published := make([]int, 0, len(bundle.Changes))
+	for i, c := range bundle.Changes {
+		if i >= len(staged) || !sameChange(staged[i], c) {
+			logrus.Warnf("The staged changes of %s no longer begin with those of the bundle, so they were left staged", r.gun)
+			return nil
+		}
+		published = append(published, i)
+	}
+	if err := r.changelist.Remove(published); err != nil {
+		logrus.Warn("Unable to remove published changes from the changelist. You may want to manually remove them from ", r.changelist.Location())
+	}
+	return nil
+}
+
+// bundleStore serves a bundle's metadata in place of the server, which can't
+// be asked for keys
+type bundleStore struct {
+	*store.MemoryStore
+}
+
+// GetKey returns ErrOffline
+func (bundleStore) GetKey(data.RoleName) ([]byte, error) {
+	return nil, store.ErrOffline{}
+}
+
+// RotateKey returns ErrOffline
+func (bundleStore) RotateKey(data.RoleName) ([]byte, error) {
+	return nil, store.ErrOffline{}
+}
+
+func sameChange(a, b changelist.Change) bool {
+	return a.Action() == b.Action() && a.Scope() == b.Scope() && a.Type() == b.Type() &&
+		a.Path() == b.Path() && bytes.Equal(a.Content(), b.Content())
+}
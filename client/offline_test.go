@@ -0,0 +1,141 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	canonicaljson "github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// roundTripBundle serializes and deserializes the bundle, as happens when it
+// is carried between machines
+func roundTripBundle(t *testing.T, bundle *OfflineBundle) *OfflineBundle {
+	serialized, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	var copied OfflineBundle
+	require.NoError(t, json.Unmarshal(serialized, &copied))
+	return &copied
+}
+
+// Changes staged on a machine without keys can be exported, signed on a
+// machine without access to the server, and published from the first machine
+func TestOfflineBundle(t *testing.T) {
+	testOfflineBundle(t, false)
+	testOfflineBundle(t, true)
+}
+
+func testOfflineBundle(t *testing.T, serverManagesSnapshot bool) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	signer, _, signerDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, serverManagesSnapshot)
+	defer os.RemoveAll(signerDir)
+	require.NoError(t, signer.Publish())
+
+	// the online repository has none of the keys
+	online, _, onlineDir := newRepoToTestRepo(t, signer, "")
+	defer os.RemoveAll(onlineDir)
+	addTarget(t, online, "current", "../fixtures/intermediate-ca.crt")
+	require.Error(t, online.Publish())
+	require.Len(t, getChanges(t, online), 1)
+
+	bundle, err := online.ExportOfflineBundle()
+	require.NoError(t, err)
+	require.Len(t, bundle.Changes, 1)
+	require.Contains(t, bundle.Metadata, data.CanonicalRootRole)
+	require.Contains(t, bundle.Metadata, data.CanonicalTargetsRole)
+	require.Error(t, online.PublishOfflineBundle(bundle), "the bundle has not been signed")
+	require.Error(t, online.SignOfflineBundle(roundTripBundle(t, bundle)), "the keys are not online")
+
+	// the offline repository can't reach the server
+	r, err := NewFileCachedRepository(signerDir, signer.gun, ts.URL, nil, passphraseRetriever, trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	offline := r.(*repository)
+	bundle = roundTripBundle(t, bundle)
+	require.NoError(t, offline.SignOfflineBundle(bundle))
+	require.Contains(t, bundle.Signed, data.CanonicalTargetsRole)
+	if serverManagesSnapshot {
+		require.NotContains(t, bundle.Signed, data.CanonicalSnapshotRole)
+	} else {
+		require.Contains(t, bundle.Signed, data.CanonicalSnapshotRole)
+	}
+	require.Error(t, offline.SignOfflineBundle(bundle), "the bundle has already been signed")
+
+	require.NoError(t, online.PublishOfflineBundle(roundTripBundle(t, bundle)))
+	require.Empty(t, getChanges(t, online))
+
+	checker, _, checkerDir := newRepoToTestRepo(t, signer, "")
+	defer os.RemoveAll(checkerDir)
+	targets, err := checker.ListTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	require.Equal(t, "current", targets[0].Name)
+}
+
+// A signed bundle can't be published once the roles it changes have been
+// published again, since it would undo those changes
+func TestOfflineBundleStale(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	signer, _, signerDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(signerDir)
+	require.NoError(t, signer.Publish())
+
+	online, _, onlineDir := newRepoToTestRepo(t, signer, "")
+	defer os.RemoveAll(onlineDir)
+	addTarget(t, online, "current", "../fixtures/intermediate-ca.crt")
+	bundle, err := online.ExportOfflineBundle()
+	require.NoError(t, err)
+	require.NoError(t, signer.SignOfflineBundle(bundle))
+
+	addTarget(t, signer, "other", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, signer.Publish())
+
+	err = online.PublishOfflineBundle(bundle)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "changed since the bundle was exported")
+	require.Len(t, getChanges(t, online), 1)
+
+	bundle.GUN = "docker.com/other"
+	require.Error(t, online.PublishOfflineBundle(bundle), "the bundle is for another GUN")
+}
+
+// Like publishing, signing and publishing a bundle for an older server release
+// refuses metadata with fields it does not know about
+func TestOfflineBundleForOlderServerVersion(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	signer, _, signerDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(signerDir)
+	require.NoError(t, signer.Publish())
+
+	online, _, onlineDir := newRepoToTestRepo(t, signer, "")
+	defer os.RemoveAll(onlineDir)
+	custom := canonicaljson.RawMessage(`{"key": "value"}`)
+	target, err := NewTarget("current", "../fixtures/intermediate-ca.crt", &custom)
+	require.NoError(t, err)
+	require.NoError(t, online.AddTarget(target, data.CanonicalTargetsRole))
+	bundle, err := online.ExportOfflineBundle()
+	require.NoError(t, err)
+
+	require.NoError(t, signer.SetServerVersion("0.5"))
+	require.IsType(t, ErrUnsupportedByServer{}, signer.SignOfflineBundle(bundle))
+	require.Empty(t, bundle.Signed)
+
+	// a bundle signed without the server version still isn't published
+	require.NoError(t, signer.SetServerVersion(""))
+	require.NoError(t, signer.SignOfflineBundle(bundle))
+	require.NoError(t, online.SetServerVersion("0.5"))
+	require.IsType(t, ErrUnsupportedByServer{}, online.PublishOfflineBundle(roundTripBundle(t, bundle)))
+	require.Len(t, getChanges(t, online), 1)
+
+	require.NoError(t, online.SetServerVersion("0.6"))
+	require.NoError(t, online.PublishOfflineBundle(roundTripBundle(t, bundle)))
+	require.Empty(t, getChanges(t, online))
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// defaultVerifyWorkers is how many repositories VerifyTargetsParallel
+// verifies at once if no bound is given
+const defaultVerifyWorkers = 8
+
+// TargetLookup names a target to look up, and optionally the hashes it is
+// expected to have, in the trusted collection of a GUN
+type TargetLookup struct {
+	GUN  data.GUN
+	Name string
+	// Roles are the roles to look the target up in, in order of preference,
+	// as for GetTargetByName
+	Roles []data.RoleName
+	// Hashes, if not empty, must match the hashes of the trusted target
+	Hashes data.Hashes
+}
+
+// TargetVerification is the result of a TargetLookup.  Exactly one of
+// Target and Err is set.
+type TargetVerification struct {
+	TargetLookup
+	Target *TargetWithRole
+	Err    error
+}
+
+// ParallelVerifyOptions configures VerifyTargetsParallel
+type ParallelVerifyOptions struct {
+	// Workers bounds how many repositories are verified at once.  It defaults
+	// to 8 if not positive.
+	Workers int
+	// Timeout, if not zero, bounds how long the lookups of each GUN may take
+	// altogether, including fetching and verifying its metadata
+	Timeout time.Duration
+}
+
+// VerifyTargetsParallel looks up and verifies targets across many GUNs at
+// once, using a bounded pool of workers.  Each GUN's lookups are made in turn
+// by a single worker, with a single repository created by newRepo, so that a
+// repository and its cache are never used concurrently; repositories for
+// different GUNs must not share a cache.  The verifications are returned in
+// the order of the lookups.
+//
+// Each GUN is given its own context, derived from ctx and bounded by the
+// Timeout option.  Once it is done the GUN's remaining lookups fail with the
+// context's error, and any metadata request in flight is abandoned, though
+// it runs on in the background until the transport gives up on it.
+func VerifyTargetsParallel(ctx context.Context, newRepo func(data.GUN) (Repository, error), lookups []TargetLookup, opts ParallelVerifyOptions) []TargetVerification {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultVerifyWorkers
+	}
+
+	// group the lookups by GUN, keeping the GUNs in the order they first appear
+	var guns []data.GUN
+	indices := make(map[data.GUN][]int)
+	for i, lookup := range lookups {
+		if _, ok := indices[lookup.GUN]; !ok {
+			guns = append(guns, lookup.GUN)
+		}
+		indices[lookup.GUN] = append(indices[lookup.GUN], i)
+	}
+	if workers > len(guns) {
+		workers = len(guns)
+	}
+
+	results := make([]TargetVerification, len(lookups))
+	pending := make(chan data.GUN)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for gun := range pending {
+				gunLookups := make([]TargetLookup, 0, len(indices[gun]))
+				for _, i := range indices[gun] {
+					gunLookups = append(gunLookups, lookups[i])
+				}
+				// each worker only writes the results of its own GUNs
+				for j, verification := range verifyGUNWithContext(ctx, opts.Timeout, newRepo, gun, gunLookups) {
+					results[indices[gun][j]] = verification
+				}
+			}
+		}()
+	}
+	for _, gun := range guns {
+		pending <- gun
+	}
+	close(pending)
+	wg.Wait()
+	return results
+}
+
+// verifyGUNWithContext verifies the lookups of a single GUN, failing those
+// which haven't completed by the time its context is done
+func verifyGUNWithContext(ctx context.Context, timeout time.Duration, newRepo func(data.GUN) (Repository, error), gun data.GUN, lookups []TargetLookup) []TargetVerification {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// the repository doesn't take a context, so the lookups run in their own
+	// goroutine, which reports each verification as it completes
+	completed := make(chan TargetVerification, len(lookups))
+	go verifyGUN(ctx, newRepo, gun, lookups, completed)
+
+	verifications := make([]TargetVerification, 0, len(lookups))
+	for len(verifications) < len(lookups) {
+		select {
+		case verification := <-completed:
+			verifications = append(verifications, verification)
+		case <-ctx.Done():
+			for _, lookup := range lookups[len(verifications):] {
+				verifications = append(verifications, TargetVerification{TargetLookup: lookup, Err: ctx.Err()})
+			}
+		}
+	}
+	return verifications
+}
+
+// verifyGUN makes the lookups of a single GUN in order, sending each
+// verification to completed, and stops early once the context is done
+func verifyGUN(ctx context.Context, newRepo func(data.GUN) (Repository, error), gun data.GUN, lookups []TargetLookup, completed chan<- TargetVerification) {
+	repo, err := newRepo(gun)
+	for _, lookup := range lookups {
+		if ctx.Err() != nil {
+			return
+		}
+		verification := TargetVerification{TargetLookup: lookup, Err: err}
+		if err == nil {
+			verification.Target, verification.Err = verifyTarget(repo, lookup)
+		}
+		completed <- verification
+	}
+}
+
+// verifyTarget looks up the trusted target, and checks it has the expected
+// hashes if any were given
+func verifyTarget(repo Repository, lookup TargetLookup) (*TargetWithRole, error) {
+	target, err := repo.GetTargetByName(lookup.Name, lookup.Roles...)
+	if err != nil {
+		return nil, err
+	}
+	if len(lookup.Hashes) > 0 {
+		if err := data.CompareMultiHashes(lookup.Hashes, target.Hashes); err != nil {
+			return nil, err
+		}
+	}
+	return target, nil
+}
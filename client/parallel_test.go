@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	testutils "github.com/theupdateframework/notary/tuf/testutils/keys"
+)
+
+// publishTestGUNs publishes the given number of repositories to the server,
+// each with a single target, and returns their GUNs and the target
+func publishTestGUNs(tb testing.TB, url string, count int) ([]data.GUN, *Target) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(tb, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	target, err := NewTarget("latest", "../fixtures/intermediate-ca.crt", nil)
+	require.NoError(tb, err)
+
+	guns := make([]data.GUN, 0, count)
+	for i := 0; i < count; i++ {
+		gun := data.GUN(fmt.Sprintf("docker.com/notary/parallel%d", i))
+		r, err := NewFileCachedRepository(tempBaseDir, gun, url, http.DefaultTransport, passphraseRetriever, trustpinning.TrustPinConfig{})
+		require.NoError(tb, err)
+		rootPubKey, err := testutils.CreateOrAddKey(r.GetCryptoService(), data.CanonicalRootRole, gun, data.ECDSAKey)
+		require.NoError(tb, err)
+		require.NoError(tb, r.Initialize([]string{rootPubKey.ID()}, data.CanonicalSnapshotRole))
+		require.NoError(tb, r.AddTarget(target))
+		require.NoError(tb, r.Publish())
+		guns = append(guns, gun)
+	}
+	return guns, target
+}
+
+// fileCachedRepoFactory creates repositories for GUNs of the server, all
+// cached under the same directory
+func fileCachedRepoFactory(baseDir, url string) func(data.GUN) (Repository, error) {
+	return func(gun data.GUN) (Repository, error) {
+		return NewFileCachedRepository(baseDir, gun, url, http.DefaultTransport, passphraseRetriever, trustpinning.TrustPinConfig{})
+	}
+}
+
+// Targets across several GUNs are verified concurrently, with each lookup's
+// result in the position of the lookup
+func TestVerifyTargetsParallel(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	guns, target := publishTestGUNs(t, ts.URL, 5)
+
+	// the verification cache is shared by all the repositories
+	signed.SetVerificationCacheSize(100)
+	defer signed.SetVerificationCacheSize(0)
+
+	var lookups []TargetLookup
+	for _, gun := range guns {
+		lookups = append(lookups,
+			TargetLookup{GUN: gun, Name: "latest", Hashes: target.Hashes},
+			TargetLookup{GUN: gun, Name: "missing"},
+		)
+	}
+	wrongHashes := data.Hashes{"sha256": make([]byte, 32)}
+	lookups = append(lookups,
+		TargetLookup{GUN: guns[0], Name: "latest", Hashes: wrongHashes},
+		TargetLookup{GUN: "docker.com/notary/unpublished", Name: "latest"},
+	)
+
+	cacheDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	verifications := VerifyTargetsParallel(context.Background(), fileCachedRepoFactory(cacheDir, ts.URL), lookups, ParallelVerifyOptions{Workers: 3})
+	require.Len(t, verifications, len(lookups))
+	for i, verification := range verifications {
+		require.Equal(t, lookups[i].GUN, verification.GUN)
+		require.Equal(t, lookups[i].Name, verification.Name)
+	}
+	for i := range guns {
+		found, missing := verifications[2*i], verifications[2*i+1]
+		require.NoError(t, found.Err)
+		require.Equal(t, target.Hashes, found.Target.Hashes)
+		require.Equal(t, data.CanonicalTargetsRole, found.Target.Role)
+		require.Nil(t, missing.Target)
+		require.IsType(t, ErrNoSuchTarget(""), missing.Err)
+	}
+	require.Error(t, verifications[len(lookups)-2].Err, "the hashes do not match")
+	require.IsType(t, ErrRepositoryNotExist{}, verifications[len(lookups)-1].Err)
+}
+
+// Once the context of a GUN is done its remaining lookups fail, without
+// holding up the lookups of other GUNs
+func TestVerifyTargetsParallelTimeout(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	guns, _ := publishTestGUNs(t, ts.URL, 2)
+
+	cacheDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	newRepo := fileCachedRepoFactory(cacheDir, ts.URL)
+	verifications := VerifyTargetsParallel(context.Background(), func(gun data.GUN) (Repository, error) {
+		if gun == guns[0] {
+			<-stuck
+		}
+		return newRepo(gun)
+	}, []TargetLookup{
+		{GUN: guns[0], Name: "latest"},
+		{GUN: guns[1], Name: "latest"},
+		{GUN: guns[0], Name: "latest"},
+	}, ParallelVerifyOptions{Workers: 1, Timeout: 100 * time.Millisecond})
+
+	require.Equal(t, context.DeadlineExceeded, verifications[0].Err)
+	require.Equal(t, context.DeadlineExceeded, verifications[2].Err)
+	require.NoError(t, verifications[1].Err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	verifications = VerifyTargetsParallel(ctx, newRepo, []TargetLookup{{GUN: guns[1], Name: "latest"}}, ParallelVerifyOptions{})
+	require.Equal(t, context.Canceled, verifications[0].Err)
+}
+
+// With more workers, the metadata requests of different GUNs overlap
+func BenchmarkVerifyTargetsParallel(b *testing.B) {
+	ts := fullTestServer(b)
+	defer ts.Close()
+
+	guns, target := publishTestGUNs(b, ts.URL, 16)
+	lookups := make([]TargetLookup, 0, len(guns))
+	for _, gun := range guns {
+		lookups = append(lookups, TargetLookup{GUN: gun, Name: "latest", Hashes: target.Hashes})
+	}
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cacheDir, err := ioutil.TempDir("", "notary-test-")
+			require.NoError(b, err)
+			defer os.RemoveAll(cacheDir)
+			newRepo := fileCachedRepoFactory(cacheDir, ts.URL)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, verification := range VerifyTargetsParallel(context.Background(), newRepo, lookups, ParallelVerifyOptions{Workers: workers}) {
+					if verification.Err != nil {
+						b.Fatal(verification.Err)
+					}
+				}
+			}
+		})
+	}
+}
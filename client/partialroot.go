@@ -0,0 +1,183 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/docker/go/canonical/json"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+)
+
+// PartialRootSignature holds the signatures that one holder of offline root
+// keys made over a root.  When a root's threshold is more than any one holder
+// has keys for, each holder signs the same root separately, and the partial
+// signatures are combined with CombineRootSignatures before publishing.
+type PartialRootSignature struct {
+	// Checksum is the hex SHA256 of the signed portion of the root, so that
+	// signatures over different roots are never combined
+	Checksum   string           `json:"sha256"`
+	Signatures []data.Signature `json:"signatures"`
+}
+
+// SignRootPartial signs the root with every key held by the crypto service
+// that the root's root role trusts.  If the root rotates the root keys, the
+// previous root must be given too, so that its keys are also signed with;
+// otherwise previous may be nil.  It is an error for the crypto service to
+// hold none of the keys.
+func SignRootPartial(cs signed.CryptoService, root, previous []byte) (*PartialRootSignature, error) {
+	s, roles, err := rootSigningRoles(root, previous)
+	if err != nil {
+		return nil, err
+	}
+	var signingKeys []data.PublicKey
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		for _, key := range role.ListKeys() {
+			if !seen[key.ID()] {
+				seen[key.ID()] = true
+				signingKeys = append(signingKeys, key)
+			}
+		}
+	}
+
+	unsigned := &data.Signed{Signed: s.Signed}
+	if err := signed.Sign(cs, unsigned, signingKeys, 1, nil); err != nil {
+		return nil, err
+	}
+	sortSignatures(unsigned.Signatures)
+	return &PartialRootSignature{
+		Checksum:   rootChecksum(s),
+		Signatures: unsigned.Signatures,
+	}, nil
+}
+
+// CombineRootSignatures adds the partial signatures to the root, and returns
+// the signed root if it then meets the threshold of its root role, and of the
+// previous root's root role if one is given.  Any signatures the root already
+// has are kept.
+func CombineRootSignatures(root, previous []byte, partials ...*PartialRootSignature) ([]byte, error) {
+	s, roles, err := rootSigningRoles(root, previous)
+	if err != nil {
+		return nil, err
+	}
+	checksum := rootChecksum(s)
+
+	sigs := make(map[string]data.Signature, len(s.Signatures))
+	for _, sig := range s.Signatures {
+		sigs[sig.KeyID] = sig
+	}
+	for i, partial := range partials {
+		if partial.Checksum != checksum {
+			return nil, fmt.Errorf("partial signature %d is over a different root", i+1)
+		}
+		for _, sig := range partial.Signatures {
+			sigs[sig.KeyID] = sig
+		}
+	}
+	s.Signatures = make([]data.Signature, 0, len(sigs))
+	for _, sig := range sigs {
+		s.Signatures = append(s.Signatures, sig)
+	}
+	sortSignatures(s.Signatures)
+
+	for _, role := range roles {
+		if err := signed.VerifySignatures(s, role); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(s)
+}
+
+// PublishRoot publishes a root which has already been signed, such as one
+// whose partial signatures were combined with CombineRootSignatures.  The
+// root must be a later version of the trusted root, and meet the thresholds of
+// both its own root role and the trusted one.  The snapshot is signed again to
+// include the root if its key is held locally; otherwise the server signs it.
+func (r *repository) PublishRoot(root []byte) error {
+	if err := r.updateTUF(true); err != nil {
+		return err
+	}
+	trusted, err := r.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	if err != nil {
+		return err
+	}
+	builder := tuf.NewRepoBuilder(r.gun, nil, trustpinning.TrustPinConfig{})
+	builder.SetClock(r.clock)
+	version := r.tufRepo.Root.Signed.Version
+	if err := builder.LoadRootForUpdate(trusted, version, false); err != nil {
+		return err
+	}
+	if err := builder.LoadRootForUpdate(root, version+1, true); err != nil {
+		return err
+	}
+
+	s := &data.Signed{}
+	if err := json.Unmarshal(root, s); err != nil {
+		return err
+	}
+	signedRoot, err := data.RootFromSigned(s)
+	if err != nil {
+		return err
+	}
+	r.tufRepo.Root = signedRoot
+
+	updatedFiles := map[data.RoleName][]byte{data.CanonicalRootRole: root}
+	if err := signSnapshotIfPossible(updatedFiles, r.tufRepo, r.now()); err != nil {
+		return err
+	}
+	if err := checkSignedLegacyFields(updatedFiles, r.serverVersion); err != nil {
+		return err
+	}
+	return r.getRemoteStore().SetMulti(data.MetadataRoleMapToStringMap(updatedFiles))
+}
+
+// rootSigningRoles parses the root, and returns it with the root roles whose
+// thresholds its signatures must meet
+func rootSigningRoles(root, previous []byte) (*data.Signed, []data.BaseRole, error) {
+	s := &data.Signed{}
+	if err := json.Unmarshal(root, s); err != nil {
+		return nil, nil, err
+	}
+	role, err := rootRole(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	roles := []data.BaseRole{role}
+	if previous != nil {
+		prev := &data.Signed{}
+		if err := json.Unmarshal(previous, prev); err != nil {
+			return nil, nil, err
+		}
+		prevRole, err := rootRole(prev)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !prevRole.Equals(role) {
+			roles = append(roles, prevRole)
+		}
+	}
+	return s, roles, nil
+}
+
+func rootRole(s *data.Signed) (data.BaseRole, error) {
+	signedRoot, err := data.RootFromSigned(s)
+	if err != nil {
+		return data.BaseRole{}, err
+	}
+	return signedRoot.BuildBaseRole(data.CanonicalRootRole)
+}
+
+func rootChecksum(s *data.Signed) string {
+	checksum := sha256.Sum256(*s.Signed)
+	return hex.EncodeToString(checksum[:])
+}
+
+func sortSignatures(sigs []data.Signature) {
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i].KeyID < sigs[j].KeyID })
+}
@@ -0,0 +1,212 @@
+package client
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/cryptoservice"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/testutils"
+)
+
+// newThresholdRoot returns an unsigned root whose root role needs a signature
+// from each of the root keys, along with a crypto service holding each key
+func newThresholdRoot(t *testing.T, version int, numKeys int) ([]byte, []signed.CryptoService) {
+	var (
+		services []signed.CryptoService
+		keyIDs   []string
+	)
+	keys := make(map[string]data.PublicKey)
+	for i := 0; i < numKeys; i++ {
+		cs := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphraseRetriever))
+		key, err := testutils.CreateKey(cs, "docker.com/notary", data.CanonicalRootRole, data.ECDSAKey)
+		require.NoError(t, err)
+		services = append(services, cs)
+		keys[key.ID()] = key
+		keyIDs = append(keyIDs, key.ID())
+	}
+	roles := map[data.RoleName]*data.RootRole{
+		data.CanonicalRootRole: {KeyIDs: keyIDs, Threshold: numKeys},
+	}
+	for _, role := range []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole, data.CanonicalTimestampRole} {
+		roles[role] = &data.RootRole{KeyIDs: keyIDs[:1], Threshold: 1}
+	}
+	root, err := data.NewRoot(keys, roles, false)
+	require.NoError(t, err)
+	root.Signed.Version = version
+	s, err := root.ToSigned()
+	require.NoError(t, err)
+	rootJSON, err := json.Marshal(s)
+	require.NoError(t, err)
+	return rootJSON, services
+}
+
+// Neither holder of a threshold 2 root's keys can sign it alone, but their
+// partial signatures combine into a valid root
+func TestCombineRootSignatures(t *testing.T) {
+	root, services := newThresholdRoot(t, 1, 2)
+
+	first, err := SignRootPartial(services[0], root, nil)
+	require.NoError(t, err)
+	require.Len(t, first.Signatures, 1)
+	second, err := SignRootPartial(services[1], root, nil)
+	require.NoError(t, err)
+	require.Len(t, second.Signatures, 1)
+
+	_, err = CombineRootSignatures(root, nil, first)
+	require.IsType(t, signed.ErrRoleThreshold{}, err)
+	// signing twice with the same key doesn't count twice
+	_, err = CombineRootSignatures(root, nil, first, first)
+	require.IsType(t, signed.ErrRoleThreshold{}, err)
+
+	combined, err := CombineRootSignatures(root, nil, first, second)
+	require.NoError(t, err)
+
+	s := &data.Signed{}
+	require.NoError(t, json.Unmarshal(combined, s))
+	require.Len(t, s.Signatures, 2)
+	signedRoot, err := data.RootFromSigned(s)
+	require.NoError(t, err)
+	rootRole, err := signedRoot.BuildBaseRole(data.CanonicalRootRole)
+	require.NoError(t, err)
+	require.NoError(t, signed.VerifySignatures(s, rootRole))
+
+	// a holder with none of the keys can't sign
+	other := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphraseRetriever))
+	_, err = SignRootPartial(other, root, nil)
+	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
+}
+
+// Partial signatures over one root can't be combined into another
+func TestCombineRootSignaturesDifferentRoot(t *testing.T) {
+	root, services := newThresholdRoot(t, 1, 2)
+	first, err := SignRootPartial(services[0], root, nil)
+	require.NoError(t, err)
+	second, err := SignRootPartial(services[1], root, nil)
+	require.NoError(t, err)
+
+	s := &data.Signed{}
+	require.NoError(t, json.Unmarshal(root, s))
+	signedRoot, err := data.RootFromSigned(s)
+	require.NoError(t, err)
+	signedRoot.Signed.Version++
+	s, err = signedRoot.ToSigned()
+	require.NoError(t, err)
+	bumped, err := json.Marshal(s)
+	require.NoError(t, err)
+
+	_, err = CombineRootSignatures(bumped, nil, first, second)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "over a different root")
+}
+
+// When the root keys are rotated, the previous root's keys must also meet
+// their threshold
+func TestCombineRootSignaturesRotation(t *testing.T) {
+	previous, oldServices := newThresholdRoot(t, 1, 2)
+	root, newServices := newThresholdRoot(t, 2, 2)
+
+	var partials []*PartialRootSignature
+	for _, cs := range newServices {
+		partial, err := SignRootPartial(cs, root, previous)
+		require.NoError(t, err)
+		partials = append(partials, partial)
+	}
+	_, err := CombineRootSignatures(root, previous, partials...)
+	require.IsType(t, signed.ErrRoleThreshold{}, err)
+
+	partial, err := SignRootPartial(oldServices[0], root, previous)
+	require.NoError(t, err)
+	_, err = CombineRootSignatures(root, previous, append(partials, partial)...)
+	require.IsType(t, signed.ErrRoleThreshold{}, err)
+
+	partial, err = SignRootPartial(oldServices[1], root, previous)
+	require.NoError(t, err)
+	_, err = CombineRootSignatures(root, previous, append(partials, partial)...)
+	require.IsType(t, signed.ErrRoleThreshold{}, err)
+
+	first, err := SignRootPartial(oldServices[0], root, previous)
+	require.NoError(t, err)
+	combined, err := CombineRootSignatures(root, previous, append(partials, first, partial)...)
+	require.NoError(t, err)
+	require.NotEmpty(t, combined)
+}
+
+// A threshold 2 root, combined from the partial signatures of the holders of
+// its keys and of the previous root key, can be published, and is trusted by
+// other clients
+func TestPublishCombinedRoot(t *testing.T) {
+	testPublishCombinedRoot(t, false)
+	testPublishCombinedRoot(t, true)
+}
+
+func testPublishCombinedRoot(t *testing.T, serverManagesSnapshot bool) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, serverManagesSnapshot)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	previous, err := repo.cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+
+	// the next root needs signatures from two new keys, each held separately
+	var (
+		services []signed.CryptoService
+		keyIDs   []string
+	)
+	next := &data.SignedRoot{}
+	require.NoError(t, json.Unmarshal(previous, next))
+	for i := 0; i < 2; i++ {
+		cs := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphraseRetriever))
+		key, err := testutils.CreateKey(cs, repo.gun, data.CanonicalRootRole, data.ECDSAKey)
+		require.NoError(t, err)
+		services = append(services, cs)
+		next.Signed.Keys[key.ID()] = key
+		keyIDs = append(keyIDs, key.ID())
+	}
+	next.Signed.Roles[data.CanonicalRootRole] = &data.RootRole{KeyIDs: keyIDs, Threshold: 2}
+	next.Signed.Version++
+	next.Signatures = nil
+	s, err := next.ToSigned()
+	require.NoError(t, err)
+	root, err := json.Marshal(s)
+	require.NoError(t, err)
+
+	partials := make([]*PartialRootSignature, 0, len(services)+1)
+	for _, cs := range append(services, repo.cryptoService) {
+		partial, err := SignRootPartial(cs, root, previous)
+		require.NoError(t, err)
+		partials = append(partials, partial)
+	}
+
+	// a root short of its new threshold is rejected by the client, and one
+	// missing the previous root key's signature by the client and server
+	underSigned, err := json.Marshal(&data.Signed{Signed: s.Signed, Signatures: append(partials[0].Signatures, partials[2].Signatures...)})
+	require.NoError(t, err)
+	require.Error(t, repo.PublishRoot(underSigned))
+	unrotated, err := CombineRootSignatures(root, nil, partials[:2]...)
+	require.NoError(t, err)
+	require.Error(t, repo.PublishRoot(unrotated))
+
+	combined, err := CombineRootSignatures(root, previous, partials...)
+	require.NoError(t, err)
+	require.NoError(t, repo.PublishRoot(combined))
+
+	checker, _, checkerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(checkerDir)
+	require.NoError(t, checker.updateTUF(false))
+	require.Equal(t, 2, checker.tufRepo.Root.Signed.Version)
+	rootRole, err := checker.tufRepo.GetBaseRole(data.CanonicalRootRole)
+	require.NoError(t, err)
+	require.Equal(t, 2, rootRole.Threshold)
+	require.ElementsMatch(t, keyIDs, rootRole.ListKeyIDs())
+
+	// the same root can't be published twice
+	require.Error(t, repo.PublishRoot(combined))
+}
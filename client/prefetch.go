@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// maxPrefetchBackoffFactor bounds how many refresh intervals a failing GUN
+// will wait before being retried
+const maxPrefetchBackoffFactor = 32
+
+// Prefetcher keeps the locally cached trusted metadata for a set of
+// repositories warm, by periodically fetching and verifying it in the
+// background.  This avoids paying the latency of a full metadata update the
+// first time a long-running service needs to verify content for a GUN.
+//
+// A Repository is not safe for concurrent use, so the Prefetcher creates and
+// uses its own repositories.  Repositories which share their cache with them,
+// such as file cached repositories with the same base directory, read the
+// prefetched metadata.
+type Prefetcher struct {
+	repos    []Repository
+	interval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPrefetcher returns a Prefetcher which refreshes the metadata for each of
+// the given GUNs once every interval, using a repository created for it by
+// newRepo.  Repositories whose refresh fails are retried with an exponential
+// backoff, capped at a multiple of the interval.
+func NewPrefetcher(interval time.Duration, newRepo func(data.GUN) (Repository, error), guns ...data.GUN) (*Prefetcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid prefetch interval %s: must be positive", interval)
+	}
+	repos := make([]Repository, 0, len(guns))
+	for _, gun := range guns {
+		repo, err := newRepo(gun)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create repository to prefetch %s: %v", gun, err)
+		}
+		repos = append(repos, repo)
+	}
+	return &Prefetcher{
+		repos:    repos,
+		interval: interval,
+	}, nil
+}
+
+// Start begins refreshing metadata in the background, starting immediately.
+// The refresh loop runs until Stop is called or the context is cancelled.
+// Calling Start on a Prefetcher which is already running is a no-op.
+func (p *Prefetcher) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	go p.run(ctx, p.done)
+}
+
+// Stop halts the background refresh and waits for any in-progress refresh
+// to complete.  Calling Stop on a Prefetcher which is not running is a no-op.
+func (p *Prefetcher) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (p *Prefetcher) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	failures := make(map[data.GUN]int)
+	nextAttempt := make(map[data.GUN]time.Time)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		for _, repo := range p.repos {
+			if ctx.Err() != nil {
+				return
+			}
+			gun := repo.GetGUN()
+			if now.Before(nextAttempt[gun]) {
+				continue
+			}
+			if err := prefetch(repo); err != nil {
+				failures[gun]++
+				delay := p.backoff(failures[gun])
+				logrus.Warnf("unable to prefetch trust data for %s, retrying in %s: %v", gun, delay, err)
+				// the fetch may have been slow to fail, so the backoff starts
+				// from when it did
+				nextAttempt[gun] = time.Now().Add(delay)
+				continue
+			}
+			logrus.Debugf("prefetched trust data for %s", gun)
+			delete(failures, gun)
+			delete(nextAttempt, gun)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying a repository which has
+// failed to refresh the given number of consecutive times
+func (p *Prefetcher) backoff(failures int) time.Duration {
+	factor := 1
+	for i := 1; i < failures && factor < maxPrefetchBackoffFactor; i++ {
+		factor *= 2
+	}
+	return time.Duration(factor) * p.interval
+}
+
+// prefetch updates and verifies all the metadata for the repository, which
+// has the side effect of writing it to the repository's cache
+func prefetch(repo Repository) error {
+	_, err := repo.ListRoles()
+	return err
+}
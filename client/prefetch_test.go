@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// countingRepo is a Repository which only counts how many times its metadata
+// has been refreshed, optionally failing every refresh
+type countingRepo struct {
+	Repository
+	gun data.GUN
+	err error
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingRepo) GetGUN() data.GUN {
+	return c.gun
+}
+
+func (c *countingRepo) ListRoles() ([]RoleWithSignatures, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return nil, c.err
+}
+
+// slowRepo is a countingRepo whose refreshes take a while, and which records
+// when each refresh starts and ends
+type slowRepo struct {
+	countingRepo
+	delay    time.Duration
+	attempts []time.Time
+	failures []time.Time
+}
+
+func (s *slowRepo) GetGUN() data.GUN {
+	return s.gun
+}
+
+func (s *slowRepo) ListRoles() ([]RoleWithSignatures, error) {
+	s.mu.Lock()
+	s.attempts = append(s.attempts, time.Now())
+	s.mu.Unlock()
+	time.Sleep(s.delay)
+	_, err := s.countingRepo.ListRoles()
+	s.mu.Lock()
+	s.failures = append(s.failures, time.Now())
+	s.mu.Unlock()
+	return nil, err
+}
+
+func (c *countingRepo) numCalls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// countingRepos returns a function to create repositories for a Prefetcher,
+// which returns the given countingRepos by GUN
+func countingRepos(repos ...*countingRepo) func(data.GUN) (Repository, error) {
+	return func(gun data.GUN) (Repository, error) {
+		for _, repo := range repos {
+			if repo.gun == gun {
+				return repo, nil
+			}
+		}
+		return nil, fmt.Errorf("no repository for %s", gun)
+	}
+}
+
+// Prefetching writes the verified metadata from the server into a repository's
+// empty cache, without any explicit call on the repository
+func TestPrefetcherPopulatesCache(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	freshRepo, _, freshDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(freshDir)
+	_, err := freshRepo.cache.GetSized(data.CanonicalRootRole.String(), -1)
+	require.Error(t, err)
+
+	// the prefetcher uses its own repository, sharing the cache directory
+	p, err := NewPrefetcher(time.Hour, func(gun data.GUN) (Repository, error) {
+		prefetchRepo, _, _ := newRepoToTestRepo(t, repo, freshDir)
+		require.NotEqual(t, freshRepo, prefetchRepo)
+		return prefetchRepo, nil
+	}, repo.gun)
+	require.NoError(t, err)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	require.Eventually(t, func() bool {
+		for _, role := range data.BaseRoles {
+			if _, err := freshRepo.cache.GetSized(role.String(), -1); err != nil {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+// A repository which fails to refresh is retried with a backoff, and does not
+// stop the other repositories from being refreshed
+func TestPrefetcherContinuesAfterErrors(t *testing.T) {
+	failing := &countingRepo{gun: "failing", err: errors.New("server unavailable")}
+	working := &countingRepo{gun: "working"}
+
+	p, err := NewPrefetcher(5*time.Millisecond, countingRepos(failing, working), "failing", "working")
+	require.NoError(t, err)
+	p.Start(context.Background())
+
+	require.Eventually(t, func() bool {
+		return failing.numCalls() >= 3 && working.numCalls() >= 10
+	}, 10*time.Second, 5*time.Millisecond)
+	p.Stop()
+
+	// the failing repository is backed off, so is refreshed less often
+	require.Less(t, failing.numCalls(), working.numCalls())
+
+	// no more refreshes happen once stopped
+	stoppedAt := working.numCalls()
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, stoppedAt, working.numCalls())
+
+	// stopping again is a no-op
+	p.Stop()
+}
+
+// Cancelling the context passed to Start stops the background refresh
+func TestPrefetcherRespectsContextCancellation(t *testing.T) {
+	repo := &countingRepo{gun: "gun"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := NewPrefetcher(5*time.Millisecond, countingRepos(repo), "gun")
+	require.NoError(t, err)
+	p.Start(ctx)
+	// starting again while running is a no-op
+	p.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return repo.numCalls() >= 2
+	}, 10*time.Second, 5*time.Millisecond)
+	cancel()
+
+	// Stop still waits for the loop to exit after cancellation
+	p.Stop()
+	stoppedAt := repo.numCalls()
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, stoppedAt, repo.numCalls())
+}
+
+// The interval must be positive, and a repository must be created for every GUN
+func TestNewPrefetcherInvalid(t *testing.T) {
+	repo := &countingRepo{gun: "gun"}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		_, err := NewPrefetcher(interval, countingRepos(repo), "gun")
+		require.Error(t, err)
+	}
+	_, err := NewPrefetcher(time.Second, countingRepos(repo), "gun", "missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing")
+}
+
+// A repository which is slow to fail is backed off from when the failure
+// happened, not from when the refresh round started
+func TestPrefetcherBackoffStartsAfterFailure(t *testing.T) {
+	slow := &slowRepo{countingRepo: countingRepo{gun: "slow", err: errors.New("server unavailable")}, delay: 30 * time.Millisecond}
+	p, err := NewPrefetcher(10*time.Millisecond, func(data.GUN) (Repository, error) { return slow, nil }, "slow")
+	require.NoError(t, err)
+	p.Start(context.Background())
+	require.Eventually(t, func() bool {
+		return slow.numCalls() >= 2
+	}, 10*time.Second, time.Millisecond)
+	p.Stop()
+
+	// after the first failure, the retry waits the full interval after the
+	// failure, so the refreshes are at least the delay plus the interval apart
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+	require.GreaterOrEqual(t, slow.attempts[1].Sub(slow.failures[0]), 10*time.Millisecond)
+}
+
+func TestPrefetcherBackoff(t *testing.T) {
+	p, err := NewPrefetcher(time.Second, countingRepos())
+	require.NoError(t, err)
+	require.Equal(t, time.Second, p.backoff(1))
+	require.Equal(t, 2*time.Second, p.backoff(2))
+	require.Equal(t, 8*time.Second, p.backoff(4))
+	require.Equal(t, maxPrefetchBackoffFactor*time.Second, p.backoff(100))
+}
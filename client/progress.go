@@ -0,0 +1,49 @@
+package client
+
+import (
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// PublishStage is a stage of publishing changes to the remote server
+type PublishStage string
+
+// The stages of publishing, in the order in which they are reported
+const (
+	// PublishLoadingChangelist is reported when the changes to publish are loaded
+	PublishLoadingChangelist PublishStage = "loading changelist"
+	// PublishBuildingMetadata is reported when the changes are applied to the
+	// latest metadata and the updated roles are signed
+	PublishBuildingMetadata PublishStage = "building metadata"
+	// PublishUploading is reported when the signed metadata is sent to the
+	// remote server
+	PublishUploading PublishStage = "uploading"
+	// PublishConfirming is reported once the remote server has validated and
+	// accepted the uploaded metadata
+	PublishConfirming PublishStage = "confirming"
+)
+
+// PublishEvent reports that publishing has reached a stage
+type PublishEvent struct {
+	Stage PublishStage
+	// Changes is the number of changes being published
+	Changes int
+	// Roles are the roles whose metadata is uploaded, set from the uploading
+	// stage on
+	Roles []data.RoleName
+}
+
+// PublishProgressFunc is called with each stage of a publish as it is reached
+type PublishProgressFunc func(PublishEvent)
+
+// SetPublishProgress sets a function to be called as each stage of publishing
+// is reached.  A nil function stops progress being reported.
+func (r *repository) SetPublishProgress(progress PublishProgressFunc) {
+	r.publishProgress = progress
+}
+
+// reportPublishProgress calls the publish progress function, if there is one
+func (r *repository) reportPublishProgress(event PublishEvent) {
+	if r.publishProgress != nil {
+		r.publishProgress(event)
+	}
+}
@@ -2,11 +2,13 @@ package client
 
 import (
 	"fmt"
+	"time"
 
 	canonicaljson "github.com/docker/go/canonical/json"
 	store "github.com/theupdateframework/notary/storage"
 	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
 	"github.com/theupdateframework/notary/tuf/utils"
 )
 
@@ -46,6 +48,18 @@ type RoleWithSignatures struct {
 	data.Role
 }
 
+// RoleExpiry is when the latest metadata of a role expires
+type RoleExpiry struct {
+	Role    data.RoleName
+	Version int
+	Expires time.Time
+}
+
+// Expired reports whether the metadata has expired by the given time
+func (r RoleExpiry) Expired(at time.Time) bool {
+	return !r.Expires.After(at)
+}
+
 // NewReadOnly is the base method that returns a new notary repository for reading.
 // It expects an initialized cache. In case of a nil remote store, a default
 // offline store is used.
@@ -255,3 +269,60 @@ func (r *reader) GetDelegationRoles() ([]data.Role, error) {
 	}
 	return allDelegations, nil
 }
+
+// GetDelegationKeys returns the public keys the delegation role with the given
+// name lists as its signing keys, by key ID.  The keys are not validated, and
+// key IDs whose keys are missing from the delegating metadata map to nil.
+func (r *reader) GetDelegationKeys(name data.RoleName) (map[string]data.PublicKey, error) {
+	if !data.IsDelegation(name) {
+		return nil, data.ErrInvalidRole{Role: name, Reason: "invalid delegation name"}
+	}
+	if _, ok := r.tufRepo.Targets[data.CanonicalTargetsRole]; !ok {
+		return nil, store.ErrMetaNotFound{Resource: data.CanonicalTargetsRole.String()}
+	}
+
+	var keys map[string]data.PublicKey
+	delegationKeysVisitor := func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		for _, role := range tgt.Signed.Delegations.Roles {
+			if role.Name != name {
+				continue
+			}
+			keys = make(map[string]data.PublicKey, len(role.KeyIDs))
+			for _, keyID := range role.KeyIDs {
+				keys[keyID] = tgt.Signed.Delegations.Keys[keyID]
+			}
+			return tuf.StopWalk{}
+		}
+		return nil
+	}
+	// the role's keys are in the metadata of its parent
+	if err := r.tufRepo.WalkTargets("", name.Parent(), delegationKeysVisitor); err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, data.ErrNoSuchRole{Role: name}
+	}
+	return keys, nil
+}
+
+// VerifyDetachedSignature checks signatures over arbitrary data, such as a
+// file signed with a delegation key, against the keys and threshold of the
+// given base or delegation role, and returns the IDs of the keys whose
+// signatures are valid
+func (r *reader) VerifyDetachedSignature(role data.RoleName, msg []byte, sigs []data.Signature) ([]string, error) {
+	var roleData data.BaseRole
+	if data.IsDelegation(role) {
+		delgRole, err := r.tufRepo.GetDelegationRole(role)
+		if err != nil {
+			return nil, err
+		}
+		roleData = delgRole.BaseRole
+	} else {
+		baseRole, err := r.tufRepo.GetBaseRole(role)
+		if err != nil {
+			return nil, err
+		}
+		roleData = baseRole
+	}
+	return signed.VerifyDetached(msg, sigs, roleData)
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// tofuPinRecord is the name under which the time that a GUN's root was
+// trusted on first use is cached, alongside the root itself
+const tofuPinRecord = "tofu_pin"
+
+type tofuPin struct {
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// recordTOFUPin caches now as the time at which the GUN's root was trusted on
+// first use.  Failing to record it is only logged, since the root is still
+// trusted.
+func recordTOFUPin(cache store.MetadataStore, gun data.GUN, now time.Time) {
+	record, err := json.Marshal(tofuPin{PinnedAt: now.UTC()})
+	if err == nil {
+		err = cache.Set(tofuPinRecord, record)
+	}
+	if err != nil {
+		logrus.Errorf("could not record when the root of %s was trusted on first use: %s", gun, err)
+	}
+}
+
+// tofuPinnedAt returns the time at which the cached root of the GUN was
+// trusted on first use, or the zero time if it wasn't, such as when the root
+// was created by this client when initializing the repository
+func tofuPinnedAt(cache store.MetadataStore) time.Time {
+	raw, err := cache.GetSized(tofuPinRecord, store.NoSizeLimit)
+	if err != nil {
+		return time.Time{}
+	}
+	var pin tofuPin
+	if err := json.Unmarshal(raw, &pin); err != nil {
+		return time.Time{}
+	}
+	return pin.PinnedAt
+}
+
+// checkTOFUPin returns whether the cached root should be discarded so that
+// the server's root is trusted on first use again.  That is only the case if
+// the cached root was trusted on first use more than the maximum age ago and
+// re-pinning was asked for; if it wasn't, ErrTOFUPinExpired is returned.
+// Roots which weren't trusted on first use are not subject to the maximum age.
+func checkTOFUPin(l TUFLoadOptions) (bool, error) {
+	maxAge := l.TrustPinning.TOFUMaxAge
+	if maxAge <= 0 || !trustpinning.UsesTOFU(l.TrustPinning, l.GUN) {
+		return false, nil
+	}
+	pinnedAt := tofuPinnedAt(l.Cache)
+	if pinnedAt.IsZero() || l.Clock.Now().Sub(pinnedAt) <= maxAge {
+		return false, nil
+	}
+	if !l.TrustPinning.Repin {
+		return false, ErrTOFUPinExpired{gun: l.GUN, pinnedAt: pinnedAt, maxAge: maxAge}
+	}
+	logrus.Warnf("the root of %s was trusted on first use more than %s ago, so the server's root will be trusted on first use again", l.GUN, maxAge)
+	return true, nil
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/passphrase"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func setTOFUPinnedAt(t *testing.T, repo *repository, pinnedAt time.Time) {
+	record, err := json.Marshal(tofuPin{PinnedAt: pinnedAt})
+	require.NoError(t, err)
+	require.NoError(t, repo.cache.Set(tofuPinRecord, record))
+}
+
+// A root trusted on first use is trusted until it is older than the maximum
+// age, after which it must be re-pinned
+func TestTOFUMaxAge(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	authorRepo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, authorRepo.Publish())
+
+	dir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	r, err := NewFileCachedRepository(dir, authorRepo.gun, ts.URL, http.DefaultTransport,
+		passphrase.ConstantRetriever(password), trustpinning.TrustPinConfig{TOFUMaxAge: time.Hour})
+	require.NoError(t, err)
+	repo := r.(*repository)
+
+	// the first fetch trusts the root on first use, and records when
+	before := time.Now()
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+	pinnedAt := tofuPinnedAt(repo.cache)
+	require.False(t, pinnedAt.Before(before.Add(-time.Second)))
+
+	// a fresh pin is trusted
+	setTOFUPinnedAt(t, repo, time.Now().Add(-59*time.Minute))
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+
+	// an aged pin is not, until it is re-pinned
+	aged := time.Now().Add(-61 * time.Minute)
+	setTOFUPinnedAt(t, repo, aged)
+	_, err = repo.ListTargets()
+	require.IsType(t, ErrTOFUPinExpired{}, err)
+	require.Contains(t, err.Error(), "--repin")
+	require.Equal(t, aged.Unix(), tofuPinnedAt(repo.cache).Unix())
+
+	repo.trustPinning.Repin = true
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+	require.True(t, tofuPinnedAt(repo.cache).After(aged.Add(time.Hour)))
+
+	// once re-pinned, the pin is fresh without needing to re-pin again
+	repo.trustPinning.Repin = false
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+
+	// rebuilding the cache keeps the time of the pin
+	setTOFUPinnedAt(t, repo, aged)
+	require.IsType(t, ErrTOFUPinExpired{}, repo.Rebuild())
+	require.Equal(t, aged.Unix(), tofuPinnedAt(repo.cache).Unix())
+}
+
+// Roots which weren't trusted on first use are not subject to the maximum age
+func TestTOFUMaxAgeNotTOFU(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	// the repository's own root was created rather than trusted on first use
+	authorRepo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, authorRepo.Publish())
+	authorRepo.trustPinning.TOFUMaxAge = time.Nanosecond
+	_, err := authorRepo.ListTargets()
+	require.NoError(t, err)
+
+	// a pinned root is trusted because of the pinning, however old its record
+	rootJSON, err := authorRepo.cache.GetSized(data.CanonicalRootRole.String(), -1)
+	require.NoError(t, err)
+	repo, dir := newPinnedRepo(t, authorRepo.gun, ts.URL, rootJSON)
+	defer os.RemoveAll(dir)
+	repo.trustPinning.TOFUMaxAge = time.Nanosecond
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+	setTOFUPinnedAt(t, repo, time.Now().Add(-time.Hour))
+	_, err = repo.ListTargets()
+	require.NoError(t, err)
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tracing"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// A publish is traced from the client through to the server's signing of
+// the snapshot, with the trace propagated to the server in the upload
+func TestPublishTracing(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+
+	recorder := tracing.NewRecorder()
+	tracing.SetTracer(recorder)
+	defer tracing.SetTracer(nil)
+	require.NoError(t, repo.Publish())
+
+	byName := make(map[string][]tracing.RecordedSpan)
+	var publish tracing.RecordedSpan
+	for _, span := range recorder.Spans() {
+		if span.Name == "notary.client.publish" {
+			publish = span
+		}
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	require.Equal(t, "notary.client.publish", publish.Name)
+	require.False(t, publish.Parent.IsValid())
+	require.NoError(t, publish.Err)
+
+	// the client's spans are the children of the publish
+	for _, name := range []string{"notary.client.fetch", "notary.client.sign", "notary.client.upload"} {
+		require.Len(t, byName[name], 1, name)
+		require.Equal(t, publish.SpanContext, byName[name][0].Parent, name)
+		require.NoError(t, byName[name][0].Err, name)
+	}
+
+	// the server's handling of the upload is the child of the upload, and
+	// the server signing the snapshot is the child of that
+	update := byName["notary.server.UpdateTUF"]
+	require.Len(t, update, 1)
+	require.Equal(t, byName["notary.client.upload"][0].SpanContext, update[0].Parent)
+	require.NotEmpty(t, byName["notary.server.sign"])
+	for _, sign := range byName["notary.server.sign"] {
+		require.Equal(t, update[0].SpanContext, sign.Parent)
+		require.Equal(t, publish.SpanContext.TraceID, sign.SpanContext.TraceID)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary"
@@ -21,6 +22,9 @@ type tufClient struct {
 	cache      store.MetadataStore
 	oldBuilder tuf.RepoBuilder
 	newBuilder tuf.RepoBuilder
+	// allowExpired accepts metadata which has expired, see
+	// TUFLoadOptions.AllowExpired
+	allowExpired bool
 }
 
 // Update performs an update to the TUF repo as defined by the TUF spec
@@ -189,7 +193,7 @@ func (c *tufClient) downloadTimestamp() error {
 	}
 
 	logrus.Warn("Error while downloading remote metadata, using cached timestamp - this might not be the latest version available remotely")
-	err := c.newBuilder.Load(role, cachedTS, 1, false)
+	err := c.newBuilder.Load(role, cachedTS, 1, c.allowExpired)
 	if err == nil {
 		logrus.Debug("successfully verified cached timestamp")
 	}
@@ -282,7 +286,7 @@ func (c *tufClient) tryLoadCacheThenRemote(consistentInfo tuf.ConsistentInfo) ([
 		return c.tryLoadRemote(consistentInfo, nil)
 	}
 
-	if err = c.newBuilder.Load(consistentInfo.RoleName, cachedTS, 1, false); err == nil {
+	if err = c.newBuilder.Load(consistentInfo.RoleName, cachedTS, 1, c.allowExpired); err == nil {
 		logrus.Debugf("successfully verified cached %s", consistentInfo.RoleName)
 		return cachedTS, nil
 	}
@@ -304,7 +308,7 @@ func (c *tufClient) tryLoadRemote(consistentInfo tuf.ConsistentInfo, old []byte)
 	// will be 1
 	c.oldBuilder.Load(consistentInfo.RoleName, old, 1, true)
 	minVersion := c.oldBuilder.GetLoadedVersion(consistentInfo.RoleName)
-	if err := c.newBuilder.Load(consistentInfo.RoleName, raw, minVersion, false); err != nil {
+	if err := c.newBuilder.Load(consistentInfo.RoleName, raw, minVersion, c.allowExpired); err != nil {
 		logrus.Debugf("downloaded %s is invalid: %s", consistentName, err)
 		return raw, err
 	}
@@ -324,6 +328,23 @@ type TUFLoadOptions struct {
 	Cache                  store.MetadataStore
 	RemoteStore            store.RemoteStore
 	AlwaysCheckInitialized bool
+	// ClockSkewThreshold is how far the local clock may be ahead of the
+	// remote server's before metadata which appears expired is reported as
+	// likely being caused by the local clock.  Zero means
+	// notary.DefaultClockSkewThreshold.
+	ClockSkewThreshold time.Duration
+	// AllowExpired loads metadata even if it has expired, which is only
+	// useful for inspecting the metadata, such as to find the roles which
+	// need re-signing.  A repo loaded this way must not be trusted for its
+	// targets.
+	AllowExpired bool
+	// SignatureAlgorithms are the signature algorithms that roles must be
+	// signed with, when the metadata is verified and when the loaded repo
+	// signs it.
+	SignatureAlgorithms signed.AlgorithmPolicy
+	// Clock tells the time that the metadata is checked for expiry against.
+	// Nil means data.RealClock.
+	Clock data.Clock
 }
 
 // bootstrapClient attempts to bootstrap a root.json to be used as the trust
@@ -350,15 +371,28 @@ func bootstrapClient(l TUFLoadOptions) (*tufClient, error) {
 	// the old root on disk should not be validated against any trust pinning configuration
 	// because if we have an old root, it itself is the thing that pins trust
 	oldBuilder := tuf.NewRepoBuilder(l.GUN, l.CryptoService, trustpinning.TrustPinConfig{})
+	oldBuilder.SetClock(l.Clock)
 
 	// by default, we want to use the trust pinning configuration on any new root that we download
 	newBuilder := tuf.NewRepoBuilder(l.GUN, l.CryptoService, l.TrustPinning)
+	newBuilder.SetSignatureAlgorithms(l.SignatureAlgorithms)
+	newBuilder.SetClock(l.Clock)
 
 	// Try to read root from cache first. We will trust this root until we detect a problem
 	// during update which will cause us to download a new root and perform a rotation.
 	// If we have an old root, and it's valid, then we overwrite the newBuilder to be one
 	// preloaded with the old root or one which uses the old root for trust bootstrapping.
-	if rootJSON, err := l.Cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit); err == nil {
+	rootJSON, err := l.Cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	if err == nil {
+		repin, err := checkTOFUPin(l)
+		if err != nil {
+			return nil, err
+		}
+		if repin {
+			rootJSON = nil
+		}
+	}
+	if rootJSON != nil {
 		// if we can't load the cached root, fail hard because that is how we pin trust
 		if err := oldBuilder.Load(data.CanonicalRootRole, rootJSON, minVersion, true); err != nil {
 			return nil, err
@@ -367,6 +401,8 @@ func bootstrapClient(l TUFLoadOptions) (*tufClient, error) {
 		// again, the root on disk is the source of trust pinning, so use an empty trust
 		// pinning configuration
 		newBuilder = tuf.NewRepoBuilder(l.GUN, l.CryptoService, trustpinning.TrustPinConfig{})
+		newBuilder.SetSignatureAlgorithms(l.SignatureAlgorithms)
+		newBuilder.SetClock(l.Clock)
 
 		if err := newBuilder.Load(data.CanonicalRootRole, rootJSON, minVersion, false); err != nil {
 			// Ok, the old root is expired - we want to download a new one.  But we want to use the
@@ -374,6 +410,7 @@ func bootstrapClient(l TUFLoadOptions) (*tufClient, error) {
 			// but use the trustpinning to validate the new root
 			minVersion = oldBuilder.GetLoadedVersion(data.CanonicalRootRole)
 			newBuilder = oldBuilder.BootstrapNewBuilderWithNewTrustpin(l.TrustPinning)
+			newBuilder.SetSignatureAlgorithms(l.SignatureAlgorithms)
 		}
 	}
 
@@ -392,7 +429,7 @@ func bootstrapClient(l TUFLoadOptions) (*tufClient, error) {
 
 		if !newBuilder.IsLoaded(data.CanonicalRootRole) {
 			// we always want to use the downloaded root if we couldn't load from cache
-			if err := newBuilder.Load(data.CanonicalRootRole, tmpJSON, minVersion, false); err != nil {
+			if err := newBuilder.Load(data.CanonicalRootRole, tmpJSON, minVersion, l.AllowExpired); err != nil {
 				return nil, err
 			}
 
@@ -400,6 +437,8 @@ func bootstrapClient(l TUFLoadOptions) (*tufClient, error) {
 			if err != nil {
 				// if we can't write cache we should still continue, just log error
 				logrus.Errorf("could not save root to cache: %s", err.Error())
+			} else if trustpinning.UsesTOFU(l.TrustPinning, l.GUN) {
+				recordTOFUPin(l.Cache, l.GUN, l.Clock.Now())
 			}
 		}
 	}
@@ -411,10 +450,11 @@ func bootstrapClient(l TUFLoadOptions) (*tufClient, error) {
 	}
 
 	return &tufClient{
-		oldBuilder: oldBuilder,
-		newBuilder: newBuilder,
-		remote:     l.RemoteStore,
-		cache:      l.Cache,
+		oldBuilder:   oldBuilder,
+		newBuilder:   newBuilder,
+		remote:       l.RemoteStore,
+		cache:        l.Cache,
+		allowExpired: l.AllowExpired,
 	}, nil
 }
 
@@ -432,31 +472,76 @@ func LoadTUFRepo(options TUFLoadOptions) (*tuf.Repo, *tuf.Repo, error) {
 	if options.CryptoService == nil {
 		options.CryptoService = cryptoservice.EmptyService
 	}
+	if options.Clock == nil {
+		options.Clock = data.RealClock{}
+	}
 
 	c, err := bootstrapClient(options)
 	if err != nil {
-		if _, ok := err.(store.ErrMetaNotFound); ok {
-			return nil, nil, ErrRepositoryNotExist{
-				remote: options.RemoteStore.Location(),
-				gun:    options.GUN,
-			}
+		err = blameClockSkew(err, options.RemoteStore, options.ClockSkewThreshold, options.Clock.Now())
+		if notFound, ok := err.(store.ErrMetaNotFound); ok {
+			return nil, nil, repositoryNotExist(options, notFound)
 		}
 		return nil, nil, err
 	}
 	repo, invalid, err := c.Update()
 	if err != nil {
+		err = blameClockSkew(err, options.RemoteStore, options.ClockSkewThreshold, options.Clock.Now())
 		// notFound.Resource may include a version or checksum so when the role is root,
 		// it will be root, <version>.root or root.<checksum>.
 		notFound, ok := err.(store.ErrMetaNotFound)
 		isRoot, _ := regexp.MatchString(`\.?`+data.CanonicalRootRole.String()+`\.?`, notFound.Resource)
 		if ok && isRoot {
-			return nil, nil, ErrRepositoryNotExist{
-				remote: options.RemoteStore.Location(),
-				gun:    options.GUN,
-			}
+			return nil, nil, repositoryNotExist(options, notFound)
 		}
 		return nil, nil, err
 	}
-	warnRolesNearExpiry(repo)
+	if options.TrustPinning.TSACA != "" {
+		if err := verifyTimestampAuthority(repo, options.TrustPinning.TSACA); err != nil {
+			return nil, nil, err
+		}
+	}
+	warnRolesNearExpiry(repo, options.Clock.Now())
 	return repo, invalid, nil
 }
+
+// repositoryNotExist returns ErrRepositoryNotExist for the remote store's
+// claim that the GUN has no root, as long as the claim is backed by a signed
+// statement whenever a key to sign such statements is pinned for the GUN
+func repositoryNotExist(options TUFLoadOptions, notFound store.ErrMetaNotFound) error {
+	if err := verifyNotFound(options.GUN, options.TrustPinning, notFound); err != nil {
+		return err
+	}
+	return ErrRepositoryNotExist{
+		remote: options.RemoteStore.Location(),
+		gun:    options.GUN,
+	}
+}
+
+// blameClockSkew points an expiry error at the local clock, which tells the
+// time now, if the clock is more than threshold ahead of the remote server's,
+// since fresh metadata then appears expired
+func blameClockSkew(err error, remote store.RemoteStore, threshold time.Duration, now time.Time) error {
+	expired, ok := err.(signed.ErrExpired)
+	if !ok {
+		return err
+	}
+	reporter, ok := remote.(store.ServerTimeReporter)
+	if !ok {
+		return err
+	}
+	if threshold == 0 {
+		threshold = notary.DefaultClockSkewThreshold
+	}
+	serverTime, known := reporter.ServerTime()
+	if !known {
+		return err
+	}
+	// the server's time only has a resolution of a second
+	if skew := now.Sub(serverTime).Round(time.Second); skew > threshold {
+		logrus.Warnf("the local clock is %s ahead of the server's", skew)
+		expired.ClockSkew = skew
+		return expired
+	}
+	return err
+}
@@ -21,22 +21,24 @@ func parseConfig(path string) (*viper.Viper, error) {
 	return v, v.ReadInConfig()
 }
 
-func setupGRPCServer(v *viper.Viper) (*grpc.Server, error) {
+// setupGRPCServer returns the server, and a function which stops reloading its
+// TLS certificate once it has stopped
+func setupGRPCServer(v *viper.Viper) (*grpc.Server, func(), error) {
 	storage, err := setupStorage(v)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	tlsConfig, err := utils.ParseServerTLS(v, !v.GetBool("server.insecure"))
+	tlsConfig, stopTLSReload, err := utils.ParseServerTLS(v, !v.GetBool("server.insecure"))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	creds := credentials.NewTLS(tlsConfig)
 	opts := []grpc.ServerOption{grpc.Creds(creds)}
 	server := grpc.NewServer(opts...)
 	keyStore := remoteks.NewGRPCStorage(storage)
 	remoteks.RegisterStoreServer(server, keyStore)
-	return server, nil
+	return server, stopTLSReload, nil
 }
 
 func setupStorage(v *viper.Viper) (trustmanager.Storage, error) {
@@ -20,13 +20,13 @@ func TestSetupGRPCServer(t *testing.T) {
 	v := viper.New()
 	v.SetDefault("storage.backend", notary.MemoryBackend)
 	v.SetDefault("server.insecure", true)
-	s, err := setupGRPCServer(v)
+	s, _, err := setupGRPCServer(v)
 	require.NoError(t, err)
 	require.IsType(t, grpc.NewServer(), s)
 
 	v = viper.New()
 	v.SetDefault("storage.backend", "not recognized")
-	_, err = setupGRPCServer(v)
+	_, _, err = setupGRPCServer(v)
 	require.Error(t, err)
 }
 
@@ -25,10 +25,11 @@ func main() {
 	if err != nil {
 		logrus.Fatalf("could not parse config file (%s): %s", configPath, err)
 	}
-	s, err := setupGRPCServer(v)
+	s, stopTLSReload, err := setupGRPCServer(v)
 	if err != nil {
 		logrus.Fatalf("failed to initialize GRPC server: %s", err)
 	}
+	defer stopTLSReload()
 	l, err := setupNetListener(v)
 	if err != nil {
 		logrus.Fatalf("failed to create net.Listener: %s", err)
@@ -3,7 +3,11 @@ package main
 import (
 	"crypto/tls"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -18,11 +22,19 @@ import (
 	"github.com/spf13/viper"
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/server"
+	"github.com/theupdateframework/notary/server/auth/authz"
+	"github.com/theupdateframework/notary/server/auth/clientcert"
+	"github.com/theupdateframework/notary/server/handlers"
+	"github.com/theupdateframework/notary/server/signlimit"
 	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/server/timestamp"
+	"github.com/theupdateframework/notary/server/webhook"
 	"github.com/theupdateframework/notary/signer/client"
 	"github.com/theupdateframework/notary/storage/rethinkdb"
+	"github.com/theupdateframework/notary/tsa"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
+	tufutils "github.com/theupdateframework/notary/tuf/utils"
 	"github.com/theupdateframework/notary/utils"
 	"golang.org/x/net/context"
 	gorethink "gopkg.in/rethinkdb/rethinkdb-go.v6"
@@ -40,24 +52,238 @@ func getRequiredGunPrefixes(configuration *viper.Viper) ([]string, error) {
 	return prefixes, nil
 }
 
+// gets the patterns of the GUNs whose snapshots must be managed by the server.
+// Each pattern is either a GUN, or a GUN prefix followed by a "*" wildcard.
+func getServerManagedSnapshotGUNs(configuration *viper.Viper) ([]string, error) {
+	patterns := configuration.GetStringSlice("repositories.server_managed_snapshot")
+	for _, pattern := range patterns {
+		if !utils.ValidGUNPattern(pattern) {
+			return nil, fmt.Errorf("invalid server managed snapshot GUN pattern %q", pattern)
+		}
+	}
+	return patterns, nil
+}
+
+// gets the schemas which the custom metadata of targets must conform to, for
+// the GUNs matching their patterns - if none are specified, custom metadata
+// isn't validated
+func getCustomSchemas(configuration *viper.Viper) ([]handlers.CustomSchemaRule, error) {
+	if !configuration.IsSet("repositories.custom_schemas") {
+		return nil, nil
+	}
+	var schemaConfigs []struct {
+		GUNPatterns []string `mapstructure:"gun_patterns"`
+		SchemaFile  string   `mapstructure:"schema_file"`
+	}
+	if err := configuration.MarshalKey("repositories.custom_schemas", &schemaConfigs); err != nil {
+		return nil, fmt.Errorf("invalid custom schemas: %v", err)
+	}
+	rules := make([]handlers.CustomSchemaRule, 0, len(schemaConfigs))
+	for _, schemaConfig := range schemaConfigs {
+		if len(schemaConfig.GUNPatterns) == 0 {
+			return nil, fmt.Errorf("must specify the GUN patterns a custom schema applies to")
+		}
+		for _, pattern := range schemaConfig.GUNPatterns {
+			if !utils.ValidGUNPattern(pattern) {
+				return nil, fmt.Errorf("invalid custom schema GUN pattern %q", pattern)
+			}
+		}
+		schemaFile := schemaConfig.SchemaFile
+		if schemaFile == "" {
+			return nil, fmt.Errorf("must specify the schema_file of a custom schema")
+		}
+		if !filepath.IsAbs(schemaFile) {
+			schemaFile = filepath.Join(filepath.Dir(configuration.ConfigFileUsed()), schemaFile)
+		}
+		raw, err := ioutil.ReadFile(schemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read custom schema: %v", err)
+		}
+		schema, err := handlers.ParseCustomSchema(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid custom schema %s: %v", schemaFile, err)
+		}
+		rules = append(rules, handlers.CustomSchemaRule{GUNs: schemaConfig.GUNPatterns, Schema: schema})
+	}
+	return rules, nil
+}
+
+// gets the signer of statements that GUNs matching its patterns do not exist
+// - if it isn't configured, a GUN which does not exist gets a plain 404
+func getNotFoundSigner(configuration *viper.Viper) (*handlers.NotFoundSigner, error) {
+	if !configuration.IsSet("repositories.signed_not_found") {
+		return nil, nil
+	}
+	patterns := configuration.GetStringSlice("repositories.signed_not_found.gun_patterns")
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("must specify the GUN patterns to sign not-found statements for")
+	}
+	for _, pattern := range patterns {
+		if !utils.ValidGUNPattern(pattern) {
+			return nil, fmt.Errorf("invalid signed not-found GUN pattern %q", pattern)
+		}
+	}
+	keyFile := utils.GetPathRelativeToConfig(configuration, "repositories.signed_not_found.key_file")
+	if keyFile == "" {
+		return nil, fmt.Errorf("must specify the key_file to sign not-found statements with")
+	}
+	pemBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read not-found signing key: %v", err)
+	}
+	key, err := tufutils.ParsePEMPrivateKey(pemBytes, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid not-found signing key %s: %v", keyFile, err)
+	}
+	return &handlers.NotFoundSigner{GUNs: patterns, Key: key}, nil
+}
+
+// gets the authorizer which decides which operations authenticated callers may
+// perform on which GUNs - if none is configured, authentication alone decides
+func getAuthorizer(configuration *viper.Viper) (authz.Authorizer, error) {
+	if !configuration.IsSet("authorization") {
+		return nil, nil
+	}
+	if authType := configuration.GetString("auth.type"); authType != "token" && authType != clientcert.Name {
+		return nil, fmt.Errorf("authorization requires token or client certificate auth to identify callers")
+	}
+	options, ok := configuration.Get("authorization.options").(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("authorization.options must be a map[string]interface{}")
+	}
+	authorizer, err := authz.New(configuration.GetString("authorization.type"), options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization: %v", err)
+	}
+	return authorizer, nil
+}
+
+// gets the notifier for the optional webhooks which are sent a POST request
+// for every change to the metadata on this server - if none are specified,
+// there is no notifier
+func getWebhookNotifier(configuration *viper.Viper) (*webhook.Notifier, error) {
+	if !configuration.IsSet("webhooks") {
+		return nil, nil
+	}
+	var hookConfigs []struct {
+		URL         string   `mapstructure:"url"`
+		GUNPatterns []string `mapstructure:"gun_patterns"`
+		Secret      string   `mapstructure:"secret"`
+	}
+	if err := configuration.MarshalKey("webhooks.hooks", &hookConfigs); err != nil {
+		return nil, fmt.Errorf("invalid webhooks: %v", err)
+	}
+	if len(hookConfigs) == 0 {
+		return nil, fmt.Errorf("must specify at least one webhook")
+	}
+	hooks := make([]webhook.Hook, 0, len(hookConfigs))
+	for _, hookConfig := range hookConfigs {
+		u, err := url.Parse(hookConfig.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook url %q", hookConfig.URL)
+		}
+		for _, pattern := range hookConfig.GUNPatterns {
+			if !utils.ValidGUNPattern(pattern) {
+				return nil, fmt.Errorf("invalid webhook GUN pattern %q", pattern)
+			}
+		}
+		hooks = append(hooks, webhook.Hook{
+			URL:    hookConfig.URL,
+			GUNs:   hookConfig.GUNPatterns,
+			Secret: hookConfig.Secret,
+		})
+	}
+
+	maxAttempts := configuration.GetInt("webhooks.max_attempts")
+	if maxAttempts < 0 {
+		return nil, fmt.Errorf("must specify a webhook max_attempts of at least 1")
+	}
+	var backoff time.Duration
+	if configuration.IsSet("webhooks.backoff") {
+		var err error
+		backoff, err = time.ParseDuration(configuration.GetString("webhooks.backoff"))
+		if err != nil || backoff <= 0 {
+			return nil, fmt.Errorf("invalid webhook backoff %q", configuration.GetString("webhooks.backoff"))
+		}
+	}
+	return webhook.NewNotifier(hooks, maxAttempts, backoff), nil
+}
+
 // get the address for the HTTP server, and parses the optional TLS
 // configuration for the server - if no TLS configuration is specified,
-// TLS is not enabled.
-func getAddrAndTLSConfig(configuration *viper.Viper) (string, *tls.Config, error) {
+// TLS is not enabled.  The returned function stops reloading the TLS
+// certificate once the server has stopped.
+func getAddrAndTLSConfig(configuration *viper.Viper) (string, *tls.Config, func(), error) {
 	httpAddr := configuration.GetString("server.http_addr")
 	if httpAddr == "" {
-		return "", nil, fmt.Errorf("http listen address required for server")
+		return "", nil, nil, fmt.Errorf("http listen address required for server")
 	}
 
-	tlsConfig, err := utils.ParseServerTLS(configuration, false)
+	tlsConfig, stopTLSReload, err := utils.ParseServerTLS(configuration, false)
 	if err != nil {
-		return "", nil, fmt.Errorf(err.Error())
+		return "", nil, nil, fmt.Errorf(err.Error())
+	}
+	// client certificate auth can only work if client certificates are verified
+	if configuration.GetString("auth.type") == clientcert.Name && (tlsConfig == nil || tlsConfig.ClientCAs == nil) {
+		stopTLSReload()
+		return "", nil, nil, fmt.Errorf("a client CA file is required for client certificate auth")
+	}
+	return httpAddr, tlsConfig, stopTLSReload, nil
+}
+
+// gets the maximum size, in bytes, of the body of a metadata update request
+// accepted by this server - if none is specified, the default limit is used
+func getMaxRequestBodySize(configuration *viper.Viper) (int64, error) {
+	m := configuration.GetString("server.max_request_body_size")
+	if m == "" {
+		return notary.DefaultMaxRequestBodySize, nil
+	}
+	size, err := strconv.ParseInt(m, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("must specify a max request body size greater than 0 bytes")
+	}
+	return size, nil
+}
+
+// timestampAuthorityTimeout bounds how long timestamp generation waits on the
+// timestamping authority, so that an unresponsive one is treated as unreachable
+const timestampAuthorityTimeout = 10 * time.Second
+
+// gets the optional external timestamping authority which countersigns the
+// snapshot referenced by each generated timestamp - if none is specified,
+// timestamps are generated without a timestamping authority token.
+func getTimestampAuthority(configuration *viper.Viper) (*timestamp.Authority, error) {
+	if !configuration.IsSet("timestamp_authority") {
+		return nil, nil
+	}
+	tsaURL := configuration.GetString("timestamp_authority.url")
+	if tsaURL == "" {
+		return nil, fmt.Errorf("must specify a url for the timestamp authority")
+	}
+	u, err := url.Parse(tsaURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid timestamp authority url %s", tsaURL)
 	}
-	return httpAddr, tlsConfig, nil
+	return &timestamp.Authority{
+		Client: &tsa.Client{
+			URL:        tsaURL,
+			HTTPClient: &http.Client{Timeout: timestampAuthorityTimeout},
+		},
+		Required: configuration.GetBool("timestamp_authority.required"),
+	}, nil
 }
 
-// sets up TLS for the GRPC connection to notary-signer
+// sets up TLS for the GRPC connection to notary-signer - SPIFFE SVIDs are used
+// if configured, and the static certificates otherwise
 func grpcTLS(configuration *viper.Viper) (*tls.Config, error) {
+	spiffeTLS, err := utils.ParseSPIFFETLS(configuration, "trust_service", false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure SPIFFE TLS to the trust service: %s", err.Error())
+	}
+	if spiffeTLS != nil {
+		return spiffeTLS, nil
+	}
+
 	rootCA := utils.GetPathRelativeToConfig(configuration, "trust_service.tls_ca_file")
 	clientCert := utils.GetPathRelativeToConfig(configuration, "trust_service.tls_client_cert")
 	clientKey := utils.GetPathRelativeToConfig(configuration, "trust_service.tls_client_key")
@@ -98,6 +324,21 @@ func getStore(configuration *viper.Viper, hRegister healthRegister, doBootstrap
 		if err != nil {
 			return nil, fmt.Errorf("error starting %s driver: %s", backend, err.Error())
 		}
+		if storeConfig.ReplicaSource != "" {
+			replica, err := storage.NewSQLStorage(storeConfig.Backend, storeConfig.ReplicaSource)
+			if err != nil {
+				return nil, fmt.Errorf("error starting %s driver for the replica: %s", backend, err.Error())
+			}
+			s.SetReplica(replica.DB)
+			preference := storage.ReadReplica
+			if storeConfig.ReadPreference != "" {
+				preference = storage.ReadPreference(storeConfig.ReadPreference)
+			}
+			if err := s.SetReadPreference(preference); err != nil {
+				return nil, err
+			}
+			logrus.Infof("Using a %s read replica, with read preference %s", backend, preference)
+		}
 		store = *storage.NewTUFMetaStorage(s)
 		hRegister("DB operational", 10*time.Second, s.CheckHealth)
 	case notary.RethinkDBBackend:
@@ -140,6 +381,10 @@ func getNotarySigner(hostname, port string, tlsConfig *tls.Config) (*client.Nota
 	return client.NewNotarySigner(conn), nil
 }
 
+// defaultSigningQueueTimeout is how long a signing operation waits for others
+// to finish when the signing concurrency is limited, unless configured
+const defaultSigningQueueTimeout = 10 * time.Second
+
 // parses the configuration and determines which trust service and key algorithm
 // to return
 func getTrustService(configuration *viper.Viper, sFactory signerFactory,
@@ -190,7 +435,24 @@ func getTrustService(configuration *viper.Viper, sFactory signerFactory,
 			return err
 		},
 	)
-	return notarySigner, keyAlgo, nil
+
+	// the signing concurrency is only limited if a limit is configured
+	limit := configuration.GetInt("trust_service.max_concurrent_signing")
+	if limit == 0 {
+		return notarySigner, keyAlgo, nil
+	}
+	queueTimeout := defaultSigningQueueTimeout
+	if t := configuration.GetString("trust_service.signing_queue_timeout"); t != "" {
+		if queueTimeout, err = time.ParseDuration(t); err != nil {
+			return nil, "", fmt.Errorf("invalid trust_service.signing_queue_timeout: %v", err)
+		}
+	}
+	limited, err := signlimit.NewCryptoService(notarySigner, limit, queueTimeout)
+	if err != nil {
+		return nil, "", err
+	}
+	logrus.Infof("Making at most %d signing operations at once, queuing others for up to %s", limit, queueTimeout)
+	return limited, keyAlgo, nil
 }
 
 // Parse the cache configurations for GET-ting current and checksummed metadata,
@@ -267,14 +529,73 @@ func parseServerConfig(configFilePath string, hRegister healthRegister, doBootst
 	if err != nil {
 		return nil, server.Config{}, err
 	}
-	ctx = context.WithValue(ctx, notary.CtxKeyMetaStore, store)
+	// observe how long the operations of the store take, in the server metrics
+	ctx = context.WithValue(ctx, notary.CtxKeyMetaStore, storage.NewMeteredMetaStore(store))
+
+	maxBodySize, err := getMaxRequestBodySize(config)
+	if err != nil {
+		return nil, server.Config{}, err
+	}
+	ctx = context.WithValue(ctx, notary.CtxKeyMaxRequestBodySize, maxBodySize)
+
+	serverManagedSnapshot, err := getServerManagedSnapshotGUNs(config)
+	if err != nil {
+		return nil, server.Config{}, err
+	}
+	ctx = context.WithValue(ctx, notary.CtxKeyServerManagedSnapshot, serverManagedSnapshot)
+
+	customSchemas, err := getCustomSchemas(config)
+	if err != nil {
+		return nil, server.Config{}, err
+	}
+	if customSchemas != nil {
+		ctx = context.WithValue(ctx, notary.CtxKeyCustomSchemas, customSchemas)
+	}
+
+	notFoundSigner, err := getNotFoundSigner(config)
+	if err != nil {
+		return nil, server.Config{}, err
+	}
+	if notFoundSigner != nil {
+		ctx = context.WithValue(ctx, notary.CtxKeyNotFoundSigner, notFoundSigner)
+	}
+
+	authorizer, err := getAuthorizer(config)
+	if err != nil {
+		return nil, server.Config{}, err
+	}
+	if authorizer != nil {
+		ctx = context.WithValue(ctx, notary.CtxKeyAuthorizer, authorizer)
+	}
+
+	notifier, err := getWebhookNotifier(config)
+	if err != nil {
+		return nil, server.Config{}, err
+	}
+	if notifier != nil {
+		ctx = context.WithValue(ctx, notary.CtxKeyWebhooks, notifier)
+	}
+
+	// the effective configuration is served to admins, with secrets redacted
+	ctx = context.WithValue(ctx, notary.CtxKeyServerConfig, config.AllSettings())
+
+	// serving root.json without authentication is off unless turned on
+	ctx = context.WithValue(ctx, notary.CtxKeyPublicRoot, config.GetBool("server.public_root"))
+
+	authority, err := getTimestampAuthority(config)
+	if err != nil {
+		return nil, server.Config{}, err
+	}
+	if authority != nil {
+		ctx = context.WithValue(ctx, notary.CtxKeyTimestampAuthority, authority)
+	}
 
 	currentCache, consistentCache, err := getCacheConfig(config)
 	if err != nil {
 		return nil, server.Config{}, err
 	}
 
-	httpAddr, tlsConfig, err := getAddrAndTLSConfig(config)
+	httpAddr, tlsConfig, stopTLSReload, err := getAddrAndTLSConfig(config)
 	if err != nil {
 		return nil, server.Config{}, err
 	}
@@ -282,6 +603,7 @@ func parseServerConfig(configFilePath string, hRegister healthRegister, doBootst
 	return ctx, server.Config{
 		Addr:                         httpAddr,
 		TLSConfig:                    tlsConfig,
+		StopTLSReload:                stopTLSReload,
 		Trust:                        trust,
 		AuthMethod:                   config.GetString("auth.type"),
 		AuthOpts:                     config.Get("auth.options"),
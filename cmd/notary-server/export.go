@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+func getMetaStore(ctx context.Context) (storage.MetaStore, error) {
+	s := ctx.Value(notary.CtxKeyMetaStore)
+	if s == nil {
+		return nil, fmt.Errorf("no store set")
+	}
+	store, ok := s.(storage.MetaStore)
+	if !ok {
+		return nil, fmt.Errorf("store is not a metadata store")
+	}
+	return store, nil
+}
+
+// exportMeta writes all the metadata in the configured storage backend to the
+// file at path, as written by storage.ExportMeta
+func exportMeta(ctx context.Context, path string) error {
+	store, err := getMetaStore(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, notary.PrivNoExecPerms)
+	if err != nil {
+		return err
+	}
+	count, err := storage.ExportMeta(store, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("export of metadata failed after %d record(s): %v", count, err)
+	}
+	fmt.Printf("Exported %d metadata record(s) to %s\n", count, path)
+	return nil
+}
+
+// importMeta adds the metadata in the file at path, as written by
+// storage.ExportMeta, directly to the configured storage backend.  This is
+// deliberately only possible offline, by an operator with access to the
+// server's configuration, since the metadata is not validated as TUF.
+func importMeta(ctx context.Context, path string) error {
+	store, err := getMetaStore(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	count, err := storage.ImportMeta(store, f)
+	if err != nil {
+		return fmt.Errorf("import of metadata failed after %d record(s): %v", count, err)
+	}
+	fmt.Printf("Imported %d metadata record(s) from %s\n", count, path)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+func TestExportImportMeta(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "notary-server-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	exportFile := filepath.Join(tempDir, "export.json")
+
+	// there must be a store to export from or import into
+	ctx := context.Background()
+	require.Error(t, exportMeta(ctx, exportFile))
+	require.Error(t, importMeta(ctx, exportFile))
+	ctx = context.WithValue(ctx, notary.CtxKeyMetaStore, 1)
+	require.Error(t, exportMeta(ctx, exportFile))
+	require.Error(t, importMeta(ctx, exportFile))
+
+	from := storage.NewMemStorage()
+	require.NoError(t, from.UpdateMany("gun", []storage.MetaUpdate{
+		{Role: "targets", Version: 1, Data: []byte("1")},
+		{Role: "targets", Version: 2, Data: []byte("2")},
+	}))
+	require.NoError(t, exportMeta(context.WithValue(context.Background(), notary.CtxKeyMetaStore, from), exportFile))
+
+	to := storage.NewMemStorage()
+	toCtx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, to)
+	require.NoError(t, importMeta(toCtx, exportFile))
+	_, data, err := to.GetVersion("gun", "targets", 2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), data)
+
+	// importing the same versions again conflicts
+	require.Error(t, importMeta(toCtx, exportFile))
+	// and the file to import must exist
+	require.Error(t, importMeta(toCtx, filepath.Join(tempDir, "missing.json")))
+}
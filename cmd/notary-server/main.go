@@ -29,6 +29,8 @@ type cmdFlags struct {
 	logFormat   string
 	configFile  string
 	doBootstrap bool
+	exportFile  string
+	importFile  string
 	version     bool
 }
 
@@ -38,6 +40,8 @@ func setupFlags(flagStorage *cmdFlags) {
 	flag.BoolVar(&flagStorage.debug, "debug", false, "Enable the debugging server on localhost:8080")
 	flag.StringVar(&flagStorage.logFormat, "logf", "json", "Set the format of the logs. Only 'json' and 'logfmt' are supported at the moment.")
 	flag.BoolVar(&flagStorage.doBootstrap, "bootstrap", false, "Do any necessary setup of configured backend storage services")
+	flag.StringVar(&flagStorage.exportFile, "export", "", "Export all metadata in the configured backend storage to this file")
+	flag.StringVar(&flagStorage.importFile, "import", "", "Import metadata exported with -export from this file into the configured backend storage")
 	flag.BoolVar(&flagStorage.version, "version", false, "Print the version number of notary-server")
 
 	// this needs to be in init so that _ALL_ logs are in the correct format
@@ -78,6 +82,10 @@ func main() {
 
 	if flagStorage.doBootstrap {
 		err = bootstrap(ctx)
+	} else if flagStorage.exportFile != "" {
+		err = exportMeta(ctx, flagStorage.exportFile)
+	} else if flagStorage.importFile != "" {
+		err = importMeta(ctx, flagStorage.importFile)
 	} else {
 		logrus.Info("Starting Server")
 		err = server.Run(ctx, serverConfig)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -16,6 +17,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/signlimit"
 	"github.com/theupdateframework/notary/server/storage"
 	"github.com/theupdateframework/notary/signer/client"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -45,13 +47,13 @@ func TestGetAddrAndTLSConfigInvalidTLS(t *testing.T) {
 		}}`,
 	}
 	for _, configJSON := range invalids {
-		_, _, err := getAddrAndTLSConfig(configure(configJSON))
+		_, _, _, err := getAddrAndTLSConfig(configure(configJSON))
 		require.Error(t, err)
 	}
 }
 
 func TestGetAddrAndTLSConfigNoHTTPAddr(t *testing.T) {
-	_, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
+	_, _, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
 		"server": {
 			"tls_cert_file": "%s",
 			"tls_key_file": "%s"
@@ -62,7 +64,7 @@ func TestGetAddrAndTLSConfigNoHTTPAddr(t *testing.T) {
 }
 
 func TestGetAddrAndTLSConfigSuccessWithTLS(t *testing.T) {
-	httpAddr, tlsConf, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
+	httpAddr, tlsConf, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
 		"server": {
 			"http_addr": ":2345",
 			"tls_cert_file": "%s",
@@ -75,7 +77,7 @@ func TestGetAddrAndTLSConfigSuccessWithTLS(t *testing.T) {
 }
 
 func TestGetAddrAndTLSConfigSuccessWithoutTLS(t *testing.T) {
-	httpAddr, tlsConf, err := getAddrAndTLSConfig(configure(
+	httpAddr, tlsConf, _, err := getAddrAndTLSConfig(configure(
 		`{"server": {"http_addr": ":2345"}}`))
 	require.NoError(t, err)
 	require.Equal(t, ":2345", httpAddr)
@@ -83,7 +85,7 @@ func TestGetAddrAndTLSConfigSuccessWithoutTLS(t *testing.T) {
 }
 
 func TestGetAddrAndTLSConfigWithClientTLS(t *testing.T) {
-	httpAddr, tlsConf, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
+	httpAddr, tlsConf, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
 		"server": {
 			"http_addr": ":2345",
 			"tls_cert_file": "%s",
@@ -96,6 +98,31 @@ func TestGetAddrAndTLSConfigWithClientTLS(t *testing.T) {
 	require.NotNil(t, tlsConf.ClientCAs)
 }
 
+// Client certificate auth requires client certificates to be verified
+func TestGetAddrAndTLSConfigClientCertAuth(t *testing.T) {
+	_, tlsConf, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
+		"server": {
+			"http_addr": ":2345",
+			"tls_cert_file": "%s",
+			"tls_key_file": "%s",
+			"client_ca_file": "%s",
+			"client_auth": "verify_if_given"
+		},
+		"auth": {"type": "client_cert"}
+	}`, Cert, Key, Root)))
+	require.NoError(t, err)
+	require.Equal(t, tls.VerifyClientCertIfGiven, tlsConf.ClientAuth)
+
+	for _, serverJSON := range []string{
+		`{"http_addr": ":2345"}`,
+		fmt.Sprintf(`{"http_addr": ":2345", "tls_cert_file": "%s", "tls_key_file": "%s"}`, Cert, Key),
+	} {
+		_, _, _, err := getAddrAndTLSConfig(configure(`{"server": ` + serverJSON + `, "auth": {"type": "client_cert"}}`))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "client CA file is required")
+	}
+}
+
 func fakeRegisterer(callCount *int) healthRegister {
 	return func(_ string, _ time.Duration, _ health.CheckFunc) {
 		(*callCount)++
@@ -234,6 +261,50 @@ func TestGetTrustServiceNoTLSConfig(t *testing.T) {
 	require.Equal(t, 1, registerCalled)
 }
 
+// A remote trust service is only wrapped with a signing concurrency limit if
+// one is configured
+func TestGetTrustServiceSigningLimit(t *testing.T) {
+	var fakeNewSigner = func(_, _ string, _ *tls.Config) (*client.NotarySigner, error) {
+		return &client.NotarySigner{}, nil
+	}
+	template := `{
+		"trust_service": {
+			"type": "remote",
+			"hostname": "notary-signer",
+			"port": "1234",
+			"key_algorithm": "ecdsa"%s
+		}
+	}`
+
+	trust, _, err := getTrustService(configure(fmt.Sprintf(template, "")),
+		fakeNewSigner, fakeRegisterer(new(int)))
+	require.NoError(t, err)
+	require.IsType(t, &client.NotarySigner{}, trust)
+
+	for _, limit := range []string{
+		`, "max_concurrent_signing": 4`,
+		`, "max_concurrent_signing": 4, "signing_queue_timeout": "2s"`,
+	} {
+		var registerCalled = 0
+		trust, algo, err := getTrustService(configure(fmt.Sprintf(template, limit)),
+			fakeNewSigner, fakeRegisterer(&registerCalled))
+		require.NoError(t, err, limit)
+		require.IsType(t, &signlimit.CryptoService{}, trust)
+		require.Equal(t, "ecdsa", algo)
+		require.Equal(t, 1, registerCalled)
+	}
+
+	for _, invalid := range []string{
+		`, "max_concurrent_signing": -1`,
+		`, "max_concurrent_signing": 4, "signing_queue_timeout": "soon"`,
+		`, "max_concurrent_signing": 4, "signing_queue_timeout": "-2s"`,
+	} {
+		_, _, err := getTrustService(configure(fmt.Sprintf(template, invalid)),
+			fakeNewSigner, fakeRegisterer(new(int)))
+		require.Error(t, err, invalid)
+	}
+}
+
 // The rest of the functionality of getTrustService depends upon
 // utils.ConfigureClientTLS, so this test just asserts that if successful,
 // the correct tls.Config is returned based on all the configuration parameters
@@ -318,6 +389,30 @@ func TestGetStoreDBStore(t *testing.T) {
 	require.Equal(t, 1, registerCalled)
 }
 
+func TestGetStoreDBStoreWithReplica(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sqlite3")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	for _, preference := range []string{"", "primary", "replica"} {
+		config := fmt.Sprintf(`{"storage": {"backend": "%s", "db_url": "%s", "replica_db_url": "%s", "read_preference": "%s"}}`,
+			notary.SQLiteBackend, filepath.Join(tmpDir, "primary"), filepath.Join(tmpDir, "replica"), preference)
+
+		var registerCalled = 0
+
+		store, err := getStore(configure(config), fakeRegisterer(&registerCalled), false)
+		require.NoError(t, err, preference)
+		_, ok := store.(storage.TUFMetaStorage)
+		require.True(t, ok)
+		require.Equal(t, 1, registerCalled)
+	}
+
+	config := fmt.Sprintf(`{"storage": {"backend": "%s", "db_url": "%s", "read_preference": "replica"}}`,
+		notary.SQLiteBackend, filepath.Join(tmpDir, "primary"))
+	_, err = getStore(configure(config), fakeRegisterer(new(int)), false)
+	require.Error(t, err)
+}
+
 func TestGetStoreRethinkDBStoreConnectionFails(t *testing.T) {
 	config := fmt.Sprintf(
 		`{"storage": {
@@ -378,6 +473,58 @@ func TestGetCacheConfig(t *testing.T) {
 	}
 }
 
+func TestGetMaxRequestBodySize(t *testing.T) {
+	valids := map[string]int64{
+		`{}`:             notary.DefaultMaxRequestBodySize,
+		`{"server": {}}`: notary.DefaultMaxRequestBodySize,
+		`{"server": {"max_request_body_size": 1024}}`:   1024,
+		`{"server": {"max_request_body_size": "2048"}}`: 2048,
+	}
+	invalids := []string{
+		`{"server": {"max_request_body_size": 0}}`,
+		`{"server": {"max_request_body_size": -1}}`,
+		`{"server": {"max_request_body_size": "1MB"}}`,
+	}
+
+	for valid, expected := range valids {
+		size, err := getMaxRequestBodySize(configure(valid))
+		require.NoError(t, err)
+		require.Equal(t, expected, size)
+	}
+	for _, invalid := range invalids {
+		_, err := getMaxRequestBodySize(configure(invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
+func TestGetTimestampAuthority(t *testing.T) {
+	authority, err := getTimestampAuthority(configure(`{}`))
+	require.NoError(t, err)
+	require.Nil(t, authority)
+
+	authority, err = getTimestampAuthority(configure(
+		`{"timestamp_authority": {"url": "https://tsa.example.com/tsr"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "https://tsa.example.com/tsr", authority.Client.URL)
+	require.False(t, authority.Required)
+
+	authority, err = getTimestampAuthority(configure(
+		`{"timestamp_authority": {"url": "http://tsa.example.com", "required": true}}`))
+	require.NoError(t, err)
+	require.True(t, authority.Required)
+
+	invalids := []string{
+		`{"timestamp_authority": {}}`,
+		`{"timestamp_authority": {"required": true}}`,
+		`{"timestamp_authority": {"url": "tsa.example.com"}}`,
+		`{"timestamp_authority": {"url": "ftp://tsa.example.com"}}`,
+	}
+	for _, invalid := range invalids {
+		_, err := getTimestampAuthority(configure(invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
 func TestGetGUNPRefixes(t *testing.T) {
 	valids := map[string][]string{
 		`{}`:                                     nil,
@@ -404,6 +551,147 @@ func TestGetGUNPRefixes(t *testing.T) {
 	}
 }
 
+func TestGetServerManagedSnapshotGUNs(t *testing.T) {
+	valids := map[string][]string{
+		`{}`:                   nil,
+		`{"repositories": {}}`: nil,
+		`{"repositories": {"server_managed_snapshot": ["docker.io/library/*", "example.com/app"]}}`: {"docker.io/library/*", "example.com/app"},
+	}
+	invalids := []string{
+		`{"repositories": {"server_managed_snapshot": [""]}}`,
+		`{"repositories": {"server_managed_snapshot": ["docker.io/*/app"]}}`,
+	}
+
+	for valid, expected := range valids {
+		patterns, err := getServerManagedSnapshotGUNs(configure(valid))
+		require.NoError(t, err)
+		require.Equal(t, expected, patterns)
+	}
+	for _, invalid := range invalids {
+		_, err := getServerManagedSnapshotGUNs(configure(invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
+func TestGetCustomSchemas(t *testing.T) {
+	rules, err := getCustomSchemas(configure(`{}`))
+	require.NoError(t, err)
+	require.Nil(t, rules)
+
+	schemaFile, err := ioutil.TempFile("", "schema")
+	require.NoError(t, err)
+	defer os.Remove(schemaFile.Name())
+	_, err = schemaFile.WriteString(`{"type": "object", "required": ["sbom"]}`)
+	require.NoError(t, err)
+	schemaFile.Close()
+
+	rules, err = getCustomSchemas(configure(fmt.Sprintf(`{"repositories": {"custom_schemas": [
+		{"gun_patterns": ["docker.io/library/*", "example.com/app"], "schema_file": %q}
+	]}}`, schemaFile.Name())))
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.Equal(t, []string{"docker.io/library/*", "example.com/app"}, rules[0].GUNs)
+	require.Error(t, rules[0].Schema.Validate([]byte(`{}`)))
+
+	invalids := []string{
+		fmt.Sprintf(`{"repositories": {"custom_schemas": [{"schema_file": %q}]}}`, schemaFile.Name()),
+		fmt.Sprintf(`{"repositories": {"custom_schemas": [{"gun_patterns": ["docker.io/*/app"], "schema_file": %q}]}}`, schemaFile.Name()),
+		fmt.Sprintf(`{"repositories": {"custom_schemas": [{"gun_patterns": ["docker.io/library/*"], "schema_file": %q}]}}`, schemaFile.Name()+".missing"),
+		fmt.Sprintf(`{"repositories": {"custom_schemas": [{"gun_patterns": ["docker.io/library/*"], "schema_file": %q}]}}`, Cert),
+		`{"repositories": {"custom_schemas": [{"gun_patterns": ["docker.io/library/*"]}]}}`,
+	}
+	for _, invalid := range invalids {
+		_, err := getCustomSchemas(configure(invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
+func TestGetNotFoundSigner(t *testing.T) {
+	signer, err := getNotFoundSigner(configure(`{}`))
+	require.NoError(t, err)
+	require.Nil(t, signer)
+
+	signer, err = getNotFoundSigner(configure(fmt.Sprintf(`{"repositories": {"signed_not_found": {
+		"gun_patterns": ["docker.io/library/*", "example.com/app"], "key_file": %q}}}`, Key)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"docker.io/library/*", "example.com/app"}, signer.GUNs)
+	require.NotNil(t, signer.Key)
+
+	invalids := []string{
+		fmt.Sprintf(`{"repositories": {"signed_not_found": {"key_file": %q}}}`, Key),
+		fmt.Sprintf(`{"repositories": {"signed_not_found": {"gun_patterns": ["docker.io/*/app"], "key_file": %q}}}`, Key),
+		fmt.Sprintf(`{"repositories": {"signed_not_found": {"gun_patterns": ["docker.io/library/*"], "key_file": %q}}}`, Key+".missing"),
+		fmt.Sprintf(`{"repositories": {"signed_not_found": {"gun_patterns": ["docker.io/library/*"], "key_file": %q}}}`, Cert),
+		`{"repositories": {"signed_not_found": {"gun_patterns": ["docker.io/library/*"]}}}`,
+	}
+	for _, invalid := range invalids {
+		_, err := getNotFoundSigner(configure(invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
+func TestGetWebhookNotifier(t *testing.T) {
+	notifier, err := getWebhookNotifier(configure(`{}`))
+	require.NoError(t, err)
+	require.Nil(t, notifier)
+
+	valids := []string{
+		`{"webhooks": {"hooks": [{"url": "https://hooks.example.com/notary"}]}}`,
+		`{"webhooks": {"max_attempts": 3, "backoff": "500ms", "hooks": [
+			{"url": "https://hooks.example.com/notary", "gun_patterns": ["docker.io/library/*", "example.com/app"], "secret": "s3cr3t"},
+			{"url": "http://localhost:8080/hook"}
+		]}}`,
+	}
+	invalids := []string{
+		`{"webhooks": {}}`,
+		`{"webhooks": {"hooks": []}}`,
+		`{"webhooks": {"hooks": [{"url": "ftp://hooks.example.com/notary"}]}}`,
+		`{"webhooks": {"hooks": [{"url": "hooks.example.com/notary"}]}}`,
+		`{"webhooks": {"hooks": [{"url": "https://hooks.example.com/notary", "gun_patterns": ["docker.io/*/app"]}]}}`,
+		`{"webhooks": {"hooks": [{"url": "https://hooks.example.com/notary", "gun_patterns": [""]}]}}`,
+		`{"webhooks": {"max_attempts": -1, "hooks": [{"url": "https://hooks.example.com/notary"}]}}`,
+		`{"webhooks": {"backoff": "soon", "hooks": [{"url": "https://hooks.example.com/notary"}]}}`,
+	}
+
+	for _, valid := range valids {
+		notifier, err := getWebhookNotifier(configure(valid))
+		require.NoError(t, err, valid)
+		require.NotNil(t, notifier)
+	}
+	for _, invalid := range invalids {
+		_, err := getWebhookNotifier(configure(invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
+func TestGetAuthorizer(t *testing.T) {
+	authorizer, err := getAuthorizer(configure(`{}`))
+	require.NoError(t, err)
+	require.Nil(t, authorizer)
+
+	authorizer, err = getAuthorizer(configure(`{"auth": {"type": "client_cert"}, "authorization": {"type": "rbac", "options": {
+		"roles": {"reader": ["GetRole"]},
+		"bindings": [{"identities": ["*"], "guns": ["*"], "roles": ["reader"]}]}}}`))
+	require.NoError(t, err)
+	require.NotNil(t, authorizer)
+
+	invalids := []string{
+		// callers can't be identified without auth
+		`{"authorization": {"type": "rbac", "options": {
+			"roles": {"reader": ["GetRole"]},
+			"bindings": [{"identities": ["*"], "guns": ["*"], "roles": ["reader"]}]}}}`,
+		`{"auth": {"type": "client_cert"}, "authorization": {"type": "rbac"}}`,
+		`{"auth": {"type": "client_cert"}, "authorization": {"type": "unknown", "options": {}}}`,
+		`{"auth": {"type": "client_cert"}, "authorization": {"type": "rbac", "options": {
+			"roles": {"reader": ["GetRole"]},
+			"bindings": [{"identities": ["*"], "guns": ["*"], "roles": ["writer"]}]}}}`,
+	}
+	for _, invalid := range invalids {
+		_, err := getAuthorizer(configure(invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
 // For sanity, make sure we can always parse the sample config
 func TestSampleConfig(t *testing.T) {
 	var registerCalled = 0
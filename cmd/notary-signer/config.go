@@ -64,7 +64,7 @@ func parseSignerConfig(configFilePath string, doBootstrap bool) (signer.Config,
 	utils.SetUpBugsnag(bugsnagConf)
 
 	// parse server config
-	grpcAddr, tlsConfig, err := getAddrAndTLSConfig(config)
+	grpcAddr, tlsConfig, stopTLSReload, err := getAddrAndTLSConfig(config)
 	if err != nil {
 		return signer.Config{}, err
 	}
@@ -72,12 +72,16 @@ func parseSignerConfig(configFilePath string, doBootstrap bool) (signer.Config,
 	// setup the cryptoservices
 	cryptoServices, err := setUpCryptoservices(config, notary.NotarySupportedBackends, doBootstrap)
 	if err != nil {
+		if stopTLSReload != nil {
+			stopTLSReload()
+		}
 		return signer.Config{}, err
 	}
 
 	return signer.Config{
 		GRPCAddr:       grpcAddr,
 		TLSConfig:      tlsConfig,
+		StopTLSReload:  stopTLSReload,
 		CryptoServices: cryptoServices,
 	}, nil
 }
@@ -228,18 +232,28 @@ func setupGRPCServer(signerConfig signer.Config) (*grpc.Server, net.Listener, er
 	return grpcServer, lis, nil
 }
 
-func getAddrAndTLSConfig(configuration *viper.Viper) (string, *tls.Config, error) {
-	tlsConfig, err := utils.ParseServerTLS(configuration, true)
-	if err != nil {
-		return "", nil, fmt.Errorf("unable to set up TLS: %s", err.Error())
-	}
-
+// gets the GRPC listen address, and the TLS configuration of the server - SPIFFE
+// SVIDs are used if configured, and the static certificates otherwise.  The
+// returned function, if any, stops reloading the static certificates once the
+// server has stopped.
+func getAddrAndTLSConfig(configuration *viper.Viper) (string, *tls.Config, func(), error) {
 	grpcAddr := configuration.GetString("server.grpc_addr")
 	if grpcAddr == "" {
-		return "", nil, fmt.Errorf("grpc listen address required for server")
+		return "", nil, nil, fmt.Errorf("grpc listen address required for server")
 	}
 
-	return grpcAddr, tlsConfig, nil
+	tlsConfig, err := utils.ParseSPIFFETLS(configuration, "server", true)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("unable to set up SPIFFE TLS: %s", err.Error())
+	}
+	if tlsConfig != nil {
+		return grpcAddr, tlsConfig, nil, nil
+	}
+	tlsConfig, stopTLSReload, err := utils.ParseServerTLS(configuration, true)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("unable to set up TLS: %s", err.Error())
+	}
+	return grpcAddr, tlsConfig, stopTLSReload, nil
 }
 
 func bootstrap(s interface{}) error {
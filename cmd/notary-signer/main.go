@@ -89,6 +89,9 @@ func main() {
 	}
 
 	grpcServer.Serve(lis)
+	if signerConfig.StopTLSReload != nil {
+		signerConfig.StopTLSReload()
+	}
 }
 
 func usage() {
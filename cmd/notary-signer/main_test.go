@@ -47,7 +47,7 @@ func TestGetAddrAndTLSConfigInvalidTLS(t *testing.T) {
 		}}`,
 	}
 	for _, configJSON := range invalids {
-		_, _, err := getAddrAndTLSConfig(configure(configJSON))
+		_, _, _, err := getAddrAndTLSConfig(configure(configJSON))
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "unable to set up TLS")
 	}
@@ -55,7 +55,7 @@ func TestGetAddrAndTLSConfigInvalidTLS(t *testing.T) {
 
 // If a GRPC address is not provided, an error is returned.
 func TestGetAddrAndTLSConfigNoGRPCAddr(t *testing.T) {
-	_, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
+	_, _, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
 		"server": {
 			"tls_cert_file": "%s",
 			"tls_key_file": "%s"
@@ -67,7 +67,7 @@ func TestGetAddrAndTLSConfigNoGRPCAddr(t *testing.T) {
 
 // Success parsing a valid TLS config, HTTP address, and GRPC address.
 func TestGetAddrAndTLSConfigSuccess(t *testing.T) {
-	grpcAddr, tlsConf, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
+	grpcAddr, tlsConf, _, err := getAddrAndTLSConfig(configure(fmt.Sprintf(`{
 		"server": {
 			"grpc_addr": ":1234",
 			"tls_cert_file": "%s",
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+var cmdCacheTemplate = usageTemplate{
+	Use:   "cache",
+	Short: "Operates on the local cache of trusted metadata.",
+	Long:  "Operates on the metadata cached locally for Globally Unique Names, which is the trusted state of their repositories.",
+}
+
+var cmdCacheRebuildTemplate = usageTemplate{
+	Use:   "rebuild [ GUN ]",
+	Short: "Rebuilds the cached metadata of a GUN from the trust server.",
+	Long:  "Clears the metadata cached locally for a Globally Unique Name, then downloads and verifies it afresh from the trust server, to recover from a corrupted cache. The cached root is kept as the trust anchor if it is intact. Keys and staged changes are left untouched.",
+}
+
+type cacheCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+}
+
+func (c *cacheCommander) GetCommand() *cobra.Command {
+	cmd := cmdCacheTemplate.ToCommand(nil)
+	cmd.AddCommand(cmdCacheRebuildTemplate.ToCommand(c.cacheRebuild))
+	return cmd
+}
+
+func (c *cacheCommander) cacheRebuild(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("must specify a GUN")
+	}
+	config, err := c.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+	nRepo, err := ConfigureRepo(config, c.retriever, true, readOnly)(gun)
+	if err != nil {
+		return err
+	}
+	if err := nRepo.Rebuild(); err != nil {
+		return err
+	}
+	cmd.Printf("Rebuilt the cached metadata for %s\n", gun)
+	return nil
+}
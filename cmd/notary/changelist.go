@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+var cmdChangelistTemplate = usageTemplate{
+	Use:   "changelist",
+	Short: "Exchanges staged changes with other tools.",
+	Long:  "Exports and imports the unpublished changes staged for Globally Unique Names as JSON, so that other tools can read them or generate changes to be published.",
+}
+
+var cmdChangelistExportTemplate = usageTemplate{
+	Use:   "export [ GUN ]",
+	Short: "Exports the staged changes of a GUN as JSON.",
+	Long:  "Prints the unpublished changes staged for a Globally Unique Name, in order, as a JSON array of objects with the action, scope, type, path and content of each change.  The changes are left staged.",
+}
+
+var cmdChangelistImportTemplate = usageTemplate{
+	Use:   "import [ GUN ] <file>",
+	Short: "Stages the changes in a JSON file for a GUN.",
+	Long:  "Reads a JSON array of changes in the form written by export, from a file or \"-\" for STDIN, and stages them in order for the next publish of a Globally Unique Name.  Every change is validated before any is staged, so either all or none of them are.",
+}
+
+type changelistCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+	input        io.Reader
+
+	output string
+}
+
+func (c *changelistCommander) GetCommand() *cobra.Command {
+	cmd := cmdChangelistTemplate.ToCommand(nil)
+
+	cmdExport := cmdChangelistExportTemplate.ToCommand(c.changelistExport)
+	cmdExport.Flags().StringVarP(&c.output, "output", "o", "", "Write the changes to a file, instead of STDOUT")
+	cmd.AddCommand(cmdExport)
+
+	cmd.AddCommand(cmdChangelistImportTemplate.ToCommand(c.changelistImport))
+	return cmd
+}
+
+// getChangelist returns the changelist of the GUN's repository
+func (c *changelistCommander) getChangelist(gun data.GUN) (changelist.Changelist, error) {
+	config, err := c.configGetter()
+	if err != nil {
+		return nil, err
+	}
+	nRepo, err := ConfigureRepo(config, c.retriever, false, readOnly)(gun)
+	if err != nil {
+		return nil, err
+	}
+	return nRepo.GetChangelist()
+}
+
+func (c *changelistCommander) changelistExport(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("must specify a GUN")
+	}
+	cl, err := c.getChangelist(data.GUN(args[0]))
+	if err != nil {
+		return err
+	}
+	changes, err := changelist.ExportChanges(cl)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if c.output != "" {
+		f, err := os.OpenFile(c.output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, notary.PrivNoExecPerms)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(changes); err != nil {
+		return err
+	}
+	if c.output != "" {
+		cmd.Printf("Exported %d change(s) for %s to %s\n", len(changes), args[0], c.output)
+	}
+	return nil
+}
+
+func (c *changelistCommander) changelistImport(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		cmd.Usage()
+		return fmt.Errorf("must specify a GUN and the file of changes to import")
+	}
+	gun := data.GUN(args[0])
+
+	in := c.input
+	if args[1] != "-" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	cl, err := c.getChangelist(gun)
+	if err != nil {
+		return err
+	}
+	count, err := changelist.ImportChanges(cl, in)
+	if err != nil {
+		return fmt.Errorf("could not import changes for %s: %w", gun, err)
+	}
+	cmd.Printf("Staged %d change(s) for %s. Use \"notary publish %s\" to publish them.\n", count, gun, gun)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// credentialHelperPrefix is prepended to the name of the configured credential
+// helper to find its binary, following the same convention as docker so that
+// existing docker credential helpers can be reused
+const credentialHelperPrefix = "docker-credential-"
+
+// helperCredentials is the response of a credential helper's "get" command
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// getHelperCredentials invokes the named credential helper to look up the
+// username and password for the host of the given URL
+func getHelperCredentials(helper string, u *url.URL) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(credentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(u.Host)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stdout.String() + stderr.String())
+		if msg == "" {
+			return "", "", fmt.Errorf("credential helper %s failed: %w", helper, err)
+		}
+		return "", "", fmt.Errorf("credential helper %s failed: %s", helper, msg)
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", fmt.Errorf("invalid response from credential helper %s: %w", helper, err)
+	}
+	if creds.Username == "" {
+		return "", "", fmt.Errorf("credential helper %s returned an empty username", helper)
+	}
+	return creds.Username, creds.Secret, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// installFakeCredentialHelper writes a credential helper script with the given
+// body to a temporary directory and prepends that directory to the PATH.  It
+// returns a function which restores the PATH and removes the directory.
+func installFakeCredentialHelper(t *testing.T, name, body string) func() {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake credential helpers are shell scripts")
+	}
+	tempDir, err := ioutil.TempDir("", "notary-credhelper-")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(tempDir, credentialHelperPrefix+name), []byte("#!/bin/sh\n"+body), 0755))
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", tempDir+string(os.PathListSeparator)+oldPath)
+	return func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(tempDir)
+	}
+}
+
+func TestGetHelperCredentials(t *testing.T) {
+	// the helper echoes back the host it was asked about, as the username
+	cleanup := installFakeCredentialHelper(t, "fake", `
+[ "$1" = "get" ] || exit 1
+read host
+echo "{\"ServerURL\": \"$host\", \"Username\": \"$host\", \"Secret\": \"sekrit\"}"
+`)
+	defer cleanup()
+
+	myurl, err := url.Parse("https://notary.example.com:4443/v2/")
+	require.NoError(t, err)
+
+	username, passwd, err := getHelperCredentials("fake", myurl)
+	require.NoError(t, err)
+	require.Equal(t, "notary.example.com:4443", username)
+	require.Equal(t, "sekrit", passwd)
+
+	// a helper which does not exist
+	_, _, err = getHelperCredentials("nonexistent", myurl)
+	require.Error(t, err)
+}
+
+func TestGetHelperCredentialsInvalidResponses(t *testing.T) {
+	cleanup := installFakeCredentialHelper(t, "notfound", `
+echo "credentials not found in native keychain"
+exit 1
+`)
+	defer cleanup()
+	cleanup = installFakeCredentialHelper(t, "garbage", `echo "not json"`)
+	defer cleanup()
+	cleanup = installFakeCredentialHelper(t, "nousername", `echo "{\"Secret\": \"sekrit\"}"`)
+	defer cleanup()
+
+	myurl, err := url.Parse("https://notary.example.com")
+	require.NoError(t, err)
+
+	_, _, err = getHelperCredentials("notfound", myurl)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "credentials not found in native keychain")
+
+	_, _, err = getHelperCredentials("garbage", myurl)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid response")
+
+	_, _, err = getHelperCredentials("nousername", myurl)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "empty username")
+}
+
+func TestPasswordStoreWithCredentialHelper(t *testing.T) {
+	cleanup := installFakeCredentialHelper(t, "fake",
+		`echo "{\"Username\": \"helperuser\", \"Secret\": \"helperpassword\"}"`)
+	defer cleanup()
+	cleanup = installFakeCredentialHelper(t, "failing", "exit 1")
+	defer cleanup()
+
+	oldAuth := os.Getenv("NOTARY_AUTH")
+	defer os.Setenv("NOTARY_AUTH", oldAuth)
+	os.Setenv("NOTARY_AUTH", base64.StdEncoding.EncodeToString([]byte("envuser:envpassword")))
+
+	myurl, err := url.Parse("https://docker.io")
+	require.NoError(t, err)
+
+	// the credential helper takes precedence over the environment
+	username, passwd := passwordStore{credentialHelper: "fake"}.Basic(myurl)
+	require.Equal(t, "helperuser", username)
+	require.Equal(t, "helperpassword", passwd)
+
+	// but the environment is used if the helper fails
+	username, passwd = passwordStore{credentialHelper: "failing"}.Basic(myurl)
+	require.Equal(t, "envuser", username)
+	require.Equal(t, "envpassword", passwd)
+
+	// anonymous stores never consult the credential helper
+	username, passwd = passwordStore{anonymous: true, credentialHelper: "fake"}.Basic(myurl)
+	require.Equal(t, "", username)
+	require.Equal(t, "", passwd)
+}
@@ -1,17 +1,29 @@
 package main
 
 import (
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/docker/go-connections/tlsconfig"
+	canonicaljson "github.com/docker/go/canonical/json"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/theupdateframework/notary"
 	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/cryptoservice"
+	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/utils"
+	"golang.org/x/crypto/ed25519"
 )
 
 var cmdDelegationTemplate = usageTemplate{
@@ -44,21 +56,64 @@ var cmdDelegationAddTemplate = usageTemplate{
 	Long:  "Add a keys to delegation using the provided public key PEM encoded X509 certificates in a specific Global Unique Name.",
 }
 
+var cmdDelegationSetThresholdTemplate = usageTemplate{
+	Use:   "set-threshold [ GUN ] [ Role ] [ Threshold ]",
+	Short: "Sets the number of signatures a delegation requires.",
+	Long:  "Sets the number of signatures the specified Role delegation in a specific Global Unique Name requires, which must be at most the number of keys it has.",
+}
+
+var cmdDelegationExpireStaleTemplate = usageTemplate{
+	Use:   "expire-stale [ GUN ]",
+	Short: "Removes the delegations which are past the time they were added for.",
+	Long:  "Stages the removal of every delegation in a specific Global Unique Name whose custom data records a time to remove it after, such as those added with `--valid-for`, once that time has passed.",
+}
+
+var cmdDelegationVerifyKeysTemplate = usageTemplate{
+	Use:   "verify-keys [ GUN ] [ Role ]",
+	Short: "Checks the keys of a delegation are present and valid.",
+	Long:  "Checks that each key of the specified Role delegation in a specific Global Unique Name is present and well-formed and, for keys backed by X509 certificates, that the certificate is currently valid. Exits with an error if any key is not valid.",
+}
+
 type delegationCommander struct {
 	// these need to be set
 	configGetter func() (*viper.Viper, error)
 	retriever    notary.PassRetriever
+	clock        data.Clock
 
 	paths                         []string
 	allPaths, removeAll, forceYes bool
 	keyIDs                        []string
+	custom                        string
+	fromJWKS                      string
+	fromJWKSCA                    string
+	certsURL                      string
+	certsURLHeaders               []string
+	certsURLPins                  []string
+	certsURLCA                    string
+	role                          string
+	recursive                     bool
+	requirePath, allowAllPaths    bool
+	inheritPaths                  bool
+	replace                       bool
+	validFor                      time.Duration
+	keysOnly, pathsOnly           bool
+	short                         bool
 
 	autoPublish bool
 }
 
 func (d *delegationCommander) GetCommand() *cobra.Command {
 	cmd := cmdDelegationTemplate.ToCommand(nil)
-	cmd.AddCommand(cmdDelegationListTemplate.ToCommand(d.delegationsList))
+
+	cmdListDelg := cmdDelegationListTemplate.ToCommand(d.delegationsList)
+	cmdListDelg.Flags().StringVar(&d.role, "role", "", "Only list the delegation role with this name")
+	cmdListDelg.Flags().BoolVar(&d.recursive, "recursive", false, "Also list all delegation roles beneath the role given by --role")
+	cmdListDelg.Flags().BoolVar(&d.keysOnly, "keys-only", false, "Only list the key IDs of each delegation role")
+	cmdListDelg.Flags().BoolVar(&d.pathsOnly, "paths-only", false, "Only list the paths of each delegation role")
+	cmdListDelg.Flags().BoolVar(&d.short, "short", false, "Show the shortest prefix of each key ID, of at least 7 characters, which tells it apart from the others listed")
+	cmd.AddCommand(cmdListDelg)
+
+	cmd.AddCommand(cmdDelegationVerifyKeysTemplate.ToCommand(d.delegationVerifyKeys))
 
 	cmdPurgeDelgKeys := cmdDelegationPurgeKeysTemplate.ToCommand(d.delegationPurgeKeys)
 	cmdPurgeDelgKeys.Flags().StringSliceVar(&d.keyIDs, "key", nil, "Delegation key IDs to be removed from the GUN")
@@ -75,11 +130,97 @@ func (d *delegationCommander) GetCommand() *cobra.Command {
 	cmdAddDelg := cmdDelegationAddTemplate.ToCommand(d.delegationAdd)
 	cmdAddDelg.Flags().StringSliceVar(&d.paths, "paths", nil, "List of paths to add")
 	cmdAddDelg.Flags().BoolVar(&d.allPaths, "all-paths", false, "Add all paths to this delegation")
+	cmdAddDelg.Flags().BoolVar(&d.requirePath, "require-path", false, "Refuse to add all paths to this delegation unless --allow-all-paths is also given")
+	cmdAddDelg.Flags().BoolVar(&d.allowAllPaths, "allow-all-paths", false, "Allow all paths to be added to this delegation when paths are required")
+	cmdAddDelg.Flags().BoolVar(&d.inheritPaths, "inherit-paths", false, "Add the paths the parent delegation role can sign for, as published on the server, to this delegation")
+	cmdAddDelg.Flags().BoolVar(&d.replace, "replace", false, "Replace the keys and paths of this delegation with those given, rather than adding to them")
+	cmdAddDelg.Flags().StringVar(&d.custom, "custom", "", "Path to the file containing custom JSON data for this delegation")
+	cmdAddDelg.Flags().StringSliceVar(&d.keyIDs, "key-id", nil, "ID of a local key, such as one generated by \"notary key generate\" for this delegation role, whose public key is added to this delegation")
+	cmdAddDelg.Flags().StringVar(&d.fromJWKS, "from-jwks", "", "Path or HTTPS URL of a JWKS document whose EC and RSA keys are added to this delegation")
+	cmdAddDelg.Flags().StringVar(&d.fromJWKSCA, "from-jwks-ca", "", "Path to a CA certificate to trust for the server of a --from-jwks URL, as well as the system's")
+	cmdAddDelg.Flags().StringVar(&d.certsURL, "certs-url", "", "HTTPS URL of a PEM bundle of certificates whose public keys are added to this delegation")
+	cmdAddDelg.Flags().StringSliceVar(&d.certsURLHeaders, "certs-url-header", nil, "Header to send when fetching from --certs-url, in the form \"Name: value\", e.g. for authorization")
+	cmdAddDelg.Flags().StringSliceVar(&d.certsURLPins, "certs-url-pin", nil, "Base64 encoded SHA-256 hash of a SubjectPublicKeyInfo which the server of --certs-url must present")
+	cmdAddDelg.Flags().StringVar(&d.certsURLCA, "certs-url-ca", "", "Path to a CA certificate to trust for the server of --certs-url, as well as the system's")
+	cmdAddDelg.Flags().DurationVar(&d.validFor, "valid-for", 0, "Record in the custom data of this delegation that it should be removed after this duration, such as 24h, by \"notary delegation expire-stale\"")
 	cmdAddDelg.Flags().BoolVarP(&d.autoPublish, "publish", "p", false, htAutoPublish)
 	cmd.AddCommand(cmdAddDelg)
+
+	cmdExpireStaleDelg := cmdDelegationExpireStaleTemplate.ToCommand(d.delegationExpireStale)
+	cmdExpireStaleDelg.Flags().BoolVarP(&d.autoPublish, "publish", "p", false, htAutoPublish)
+	cmd.AddCommand(cmdExpireStaleDelg)
+
+	cmdSetThresholdDelg := cmdDelegationSetThresholdTemplate.ToCommand(d.delegationSetThreshold)
+	cmdSetThresholdDelg.Flags().BoolVarP(&d.autoPublish, "publish", "p", false, htAutoPublish)
+	cmd.AddCommand(cmdSetThresholdDelg)
 	return cmd
 }
 
+// delegationSetThreshold stages a change to the threshold of an existing delegation
+func (d *delegationCommander) delegationSetThreshold(cmd *cobra.Command, args []string) error {
+	if len(args) != 3 {
+		cmd.Usage()
+		return fmt.Errorf("must specify the Global Unique Name, the role of the delegation and its new threshold")
+	}
+
+	threshold, err := strconv.Atoi(args[2])
+	if err != nil || threshold < notary.MinThreshold {
+		return fmt.Errorf("threshold must be a number of at least %d, not %q", notary.MinThreshold, args[2])
+	}
+
+	config, err := d.configGetter()
+	if err != nil {
+		return err
+	}
+
+	gun := data.GUN(args[0])
+	role := data.RoleName(args[1])
+
+	rt, err := getTransport(config, gun, readOnly, d.retriever)
+	if err != nil {
+		return err
+	}
+
+	trustPin, err := getTrustPinning(config)
+	if err != nil {
+		return err
+	}
+
+	// initialize repo with transport to check the threshold against the latest keys of the delegation
+	nRepo, err := notaryclient.NewFileCachedRepository(
+		config.GetString("trust_dir"), gun, getRemoteTrustServer(config), rt, d.retriever, trustPin)
+	if err != nil {
+		return err
+	}
+	if err := applyRepoConfig(config, nRepo); err != nil {
+		return err
+	}
+	nRepo.SetClock(d.clock)
+
+	// a delegation which hasn't been published yet is checked when the change is applied instead
+	delegationRoles, err := nRepo.GetDelegationRoles()
+	if _, ok := err.(notaryclient.ErrRepositoryNotExist); err != nil && !ok {
+		return fmt.Errorf("error retrieving delegation roles for repository %s: %w", gun, err)
+	}
+	for _, delgRole := range delegationRoles {
+		if delgRole.Name == role && threshold > len(delgRole.KeyIDs) {
+			return fmt.Errorf("threshold %d is more than the %d key(s) of delegation %s", threshold, len(delgRole.KeyIDs), role)
+		}
+	}
+
+	if err := nRepo.SetDelegationThreshold(role, threshold); err != nil {
+		return fmt.Errorf("failed to set delegation threshold: %v", err)
+	}
+
+	cmd.Println("")
+	cmd.Printf(
+		"Threshold of delegation role %s set to %d in repository \"%s\", staged for next publish.\n",
+		role, threshold, gun)
+	cmd.Println("")
+
+	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever, d.clock)
+}
+
 func (d *delegationCommander) delegationPurgeKeys(cmd *cobra.Command, args []string) error {
 	if len(args) != 1 {
 		cmd.Usage()
@@ -124,7 +265,7 @@ func (d *delegationCommander) delegationPurgeKeys(cmd *cobra.Command, args []str
 		gun,
 		strings.Join(d.keyIDs, "\n\t- "),
 	)
-	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever)
+	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever, d.clock)
 }
 
 // delegationsList lists all the delegations for a particular GUN
@@ -135,6 +276,15 @@ func (d *delegationCommander) delegationsList(cmd *cobra.Command, args []string)
 			"please provide a Global Unique Name as an argument to list")
 	}
 
+	if d.recursive && d.role == "" {
+		cmd.Usage()
+		return fmt.Errorf("--recursive can only be used along with --role")
+	}
+	if d.keysOnly && d.pathsOnly {
+		cmd.Usage()
+		return fmt.Errorf("--keys-only and --paths-only cannot be used together")
+	}
+
 	config, err := d.configGetter()
 	if err != nil {
 		return err
@@ -142,7 +292,7 @@ func (d *delegationCommander) delegationsList(cmd *cobra.Command, args []string)
 
 	gun := data.GUN(args[0])
 
-	rt, err := getTransport(config, gun, readOnly)
+	rt, err := getTransport(config, gun, readOnly, d.retriever)
 	if err != nil {
 		return err
 	}
@@ -158,18 +308,183 @@ func (d *delegationCommander) delegationsList(cmd *cobra.Command, args []string)
 	if err != nil {
 		return err
 	}
+	if err := applyRepoConfig(config, nRepo); err != nil {
+		return err
+	}
+	nRepo.SetClock(d.clock)
 
 	delegationRoles, err := nRepo.GetDelegationRoles()
 	if err != nil {
 		return fmt.Errorf("error retrieving delegation roles for repository %s: %w", gun, err)
 	}
 
+	if d.role != "" {
+		delegationRoles, err = filterDelegationRoles(delegationRoles, data.RoleName(d.role), d.recursive)
+		if err != nil {
+			return fmt.Errorf("%w in repository %s", err, gun)
+		}
+	}
+
+	if useShortKeyIDs(cmd, d.short, config) {
+		delegationRoles = shortenRoleKeyIDs(delegationRoles)
+	}
+
 	cmd.Println("")
-	prettyPrintRoles(delegationRoles, cmd.OutOrStdout(), "delegations")
+	switch {
+	case d.keysOnly:
+		prettyPrintRoleColumn(delegationRoles, cmd.OutOrStdout(), "delegations", "KEY IDS",
+			func(r data.Role) []string { return r.KeyIDs })
+	case d.pathsOnly:
+		prettyPrintRoleColumn(delegationRoles, cmd.OutOrStdout(), "delegations", "PATHS",
+			func(r data.Role) []string { return prettyPaths(r.Paths) })
+	default:
+		prettyPrintRoles(delegationRoles, cmd.OutOrStdout(), "delegations")
+	}
 	cmd.Println("")
 	return nil
 }
 
+// delegationVerifyKeys reports on the validity of each key of a delegation
+func (d *delegationCommander) delegationVerifyKeys(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		cmd.Usage()
+		return fmt.Errorf(
+			"must specify the Global Unique Name and the role of the delegation to verify")
+	}
+
+	config, err := d.configGetter()
+	if err != nil {
+		return err
+	}
+
+	gun := data.GUN(args[0])
+	role := data.RoleName(args[1])
+
+	rt, err := getTransport(config, gun, readOnly, d.retriever)
+	if err != nil {
+		return err
+	}
+
+	trustPin, err := getTrustPinning(config)
+	if err != nil {
+		return err
+	}
+
+	nRepo, err := notaryclient.NewFileCachedRepository(
+		config.GetString("trust_dir"), gun, getRemoteTrustServer(config), rt, d.retriever, trustPin)
+	if err != nil {
+		return err
+	}
+	if err := applyRepoConfig(config, nRepo); err != nil {
+		return err
+	}
+	nRepo.SetClock(d.clock)
+
+	keys, err := nRepo.GetDelegationKeys(role)
+	if err != nil {
+		return fmt.Errorf("error retrieving keys of delegation %s for repository %s: %w", role, gun, err)
+	}
+
+	statuses := make([]delegationKeyStatus, 0, len(keys))
+	invalid := 0
+	for keyID, key := range keys {
+		status := verifyDelegationKey(keyID, key, d.clock.Now())
+		if status.problem != "" {
+			invalid++
+		}
+		statuses = append(statuses, status)
+	}
+
+	cmd.Println("")
+	prettyPrintDelegationKeys(statuses, cmd.OutOrStdout())
+	cmd.Println("")
+	if invalid > 0 {
+		return fmt.Errorf("%d of the %d keys of delegation %s are not valid", invalid, len(keys), role)
+	}
+	return nil
+}
+
+// delegationKeyStatus describes the validity of a key of a delegation.  The
+// validity window is only set for keys backed by certificates, and problem is
+// empty if the key is valid.
+type delegationKeyStatus struct {
+	keyID     string
+	algorithm string
+	notBefore time.Time
+	notAfter  time.Time
+	problem   string
+}
+
+// verifyDelegationKey checks that a key of a delegation is present and can be
+// parsed and, if it is backed by a certificate, that the certificate is valid
+// at now.  The key is identified by its canonical key ID, as in the delegation
+// listing, where it can be parsed.
+func verifyDelegationKey(keyID string, key data.PublicKey, now time.Time) delegationKeyStatus {
+	status := delegationKeyStatus{keyID: keyID}
+	if key == nil {
+		status.problem = "missing"
+		return status
+	}
+	status.algorithm = key.Algorithm()
+	if canonicalID, err := utils.CanonicalKeyID(key); err == nil {
+		status.keyID = canonicalID
+	}
+
+	switch key.Algorithm() {
+	case data.ECDSAx509Key, data.RSAx509Key:
+		cert, err := utils.LoadCertFromPEM(key.Public())
+		if err != nil {
+			status.problem = "malformed certificate"
+			break
+		}
+		status.notBefore, status.notAfter = cert.NotBefore, cert.NotAfter
+		if err := utils.ValidateCertificate(cert, false); err != nil {
+			status.problem = err.Error()
+			break
+		}
+		switch {
+		case now.Before(cert.NotBefore):
+			status.problem = "certificate not yet valid"
+		case now.After(cert.NotAfter):
+			status.problem = "certificate expired"
+		}
+	case data.ECDSAKey, data.RSAKey:
+		if _, err := x509.ParsePKIXPublicKey(key.Public()); err != nil {
+			status.problem = "malformed key"
+		}
+	case data.ED25519Key:
+		if len(key.Public()) != ed25519.PublicKeySize {
+			status.problem = "malformed key"
+		}
+	default:
+		status.problem = "unsupported algorithm"
+	}
+	return status
+}
+
+// filterDelegationRoles returns only the delegation role with the given name
+// and, if recursive is set, all of the delegation roles beneath it.  It errors
+// if there is no delegation role with that name.
+func filterDelegationRoles(roles []data.Role, name data.RoleName, recursive bool) ([]data.Role, error) {
+	var (
+		filtered []data.Role
+		found    bool
+	)
+	for _, r := range roles {
+		switch {
+		case r.Name == name:
+			found = true
+			filtered = append(filtered, r)
+		case recursive && strings.HasPrefix(r.Name.String(), name.String()+"/"):
+			filtered = append(filtered, r)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no delegation role %s found", name)
+	}
+	return filtered, nil
+}
+
 // delegationRemove removes a public key from a specific role in a GUN
 func (d *delegationCommander) delegationRemove(cmd *cobra.Command, args []string) error {
 	config, gun, role, keyIDs, err := delegationAddInput(d, cmd, args)
@@ -222,7 +537,7 @@ func (d *delegationCommander) delegationRemove(cmd *cobra.Command, args []string
 
 	delegationRemoveOutput(cmd, d, gun, role, keyIDs)
 
-	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever)
+	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever, d.clock)
 }
 
 func delegationAddInput(d *delegationCommander, cmd *cobra.Command, args []string) (
@@ -286,10 +601,19 @@ func delegationRemoveOutput(cmd *cobra.Command, d *delegationCommander, gun data
 
 // delegationAdd creates a new delegation by adding a public key from a certificate to a specific role in a GUN
 func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) error {
-	// We must have at least the gun and role name, and at least one key or path (or the --all-paths flag) to add
-	if len(args) < 2 || len(args) < 3 && d.paths == nil && !d.allPaths {
+	// We must have at least the gun and role name, and at least one key, path (or the --all-paths flag) or custom data to add
+	if len(args) < 2 || len(args) < 3 && d.paths == nil && !d.allPaths && !d.inheritPaths && d.custom == "" && len(d.keyIDs) == 0 && d.fromJWKS == "" && d.certsURL == "" && d.validFor == 0 {
 		cmd.Usage()
-		return fmt.Errorf("must specify the Global Unique Name and the role of the delegation along with the public key certificate paths and/or a list of paths to add")
+		return fmt.Errorf("must specify the Global Unique Name and the role of the delegation along with the public key certificate paths, local key IDs, JWKS or certificate bundle URL, a list of paths and/or custom data to add")
+	}
+	if d.certsURL == "" && (len(d.certsURLHeaders) > 0 || len(d.certsURLPins) > 0 || d.certsURLCA != "") {
+		return fmt.Errorf("--certs-url-header, --certs-url-pin and --certs-url-ca can only be used with --certs-url")
+	}
+	if d.fromJWKSCA != "" && !strings.HasPrefix(d.fromJWKS, "https://") {
+		return fmt.Errorf("--from-jwks-ca can only be used with an https --from-jwks URL")
+	}
+	if d.inheritPaths && (d.paths != nil || d.allPaths) {
+		return fmt.Errorf("--inherit-paths cannot be used along with --paths or --all-paths")
 	}
 
 	config, err := d.configGetter()
@@ -304,14 +628,61 @@ func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) e
 	if err != nil {
 		return err
 	}
-
-	checkAllPaths(d)
+	if d.fromJWKS != "" {
+		jwksKeys, err := ingestJWKS(d.fromJWKS, d.fromJWKSCA)
+		if err != nil {
+			return err
+		}
+		pubKeys = append(pubKeys, jwksKeys...)
+	}
+	if len(d.keyIDs) > 0 {
+		localKeys, err := ingestLocalKeys(config.GetString("trust_dir"), d.retriever, gun, role, d.keyIDs)
+		if err != nil {
+			return err
+		}
+		pubKeys = append(pubKeys, localKeys...)
+	}
+	if d.certsURL != "" {
+		bundleKeys, err := ingestCertsURL(d.certsURL, d.certsURLHeaders, d.certsURLPins, d.certsURLCA)
+		if err != nil {
+			return err
+		}
+		pubKeys = append(pubKeys, bundleKeys...)
+	}
 
 	trustPin, err := getTrustPinning(config)
 	if err != nil {
 		return err
 	}
 
+	if d.inheritPaths {
+		if d.paths, err = d.parentPaths(config, gun, role, trustPin); err != nil {
+			return err
+		}
+	}
+	checkAllPaths(d)
+	if d.allPaths && !d.allowAllPaths && (d.requirePath || config.GetBool("delegations.require_path")) {
+		return fmt.Errorf("refusing to add all paths to delegation %s, since paths are required: pass --allow-all-paths to add them anyway", role)
+	}
+
+	var custom *canonicaljson.RawMessage
+	if d.custom != "" {
+		custom, err = getDelegationCustom(d.custom)
+		if err != nil {
+			return err
+		}
+	}
+	var removeAfter time.Time
+	if d.validFor < 0 {
+		return fmt.Errorf("--valid-for must be a positive duration")
+	}
+	if d.validFor > 0 {
+		removeAfter = d.clock.Now().Add(d.validFor)
+		if custom, err = notaryclient.WithRemoveAfter(custom, removeAfter); err != nil {
+			return err
+		}
+	}
+
 	// no online operations are performed by add so the transport argument
 	// should be nil
 	nRepo, err := notaryclient.NewFileCachedRepository(
@@ -320,11 +691,23 @@ func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) e
 		return err
 	}
 
-	// Add the delegation to the repository
-	err = nRepo.AddDelegation(role, pubKeys, d.paths)
+	// Add the delegation to the repository, or replace its keys and paths
+	if d.replace {
+		if len(pubKeys) == 0 {
+			return fmt.Errorf("--replace requires at least one key to replace the keys of delegation %s with", role)
+		}
+		err = nRepo.ReplaceDelegation(role, pubKeys, d.paths)
+	} else {
+		err = nRepo.AddDelegation(role, pubKeys, d.paths)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create delegation: %v", err)
 	}
+	if custom != nil {
+		if err = nRepo.AddDelegationCustom(role, custom); err != nil {
+			return fmt.Errorf("failed to add custom data to delegation: %v", err)
+		}
+	}
 
 	// Make keyID slice for better CLI print
 	pubKeyIDs := []string{}
@@ -347,12 +730,147 @@ func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) e
 			strings.Join(prettyPaths(d.paths), "\n"),
 		)
 	}
+	if !removeAfter.IsZero() {
+		addingItems = addingItems + fmt.Sprintf("to be removed after %s, ", removeAfter.UTC().Format(time.RFC3339))
+	} else if custom != nil {
+		addingItems = addingItems + "with custom data, "
+	}
+	action := "Addition"
+	if d.replace {
+		action = "Replacement of the keys and paths"
+	}
 	cmd.Printf(
-		"Addition of delegation role %s %sto repository \"%s\" staged for next publish.\n",
-		role, addingItems, gun)
+		"%s of delegation role %s %sto repository \"%s\" staged for next publish.\n",
+		action, role, addingItems, gun)
 	cmd.Println("")
 
-	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever)
+	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever, d.clock)
+}
+
+// delegationExpireStale stages the removal of the delegations which are past
+// the time recorded in their custom data after which they should be removed
+func (d *delegationCommander) delegationExpireStale(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("must specify the Global Unique Name to remove stale delegations from")
+	}
+
+	config, err := d.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	rt, err := getTransport(config, gun, readOnly, d.retriever)
+	if err != nil {
+		return err
+	}
+	trustPin, err := getTrustPinning(config)
+	if err != nil {
+		return err
+	}
+
+	// the delegations are fetched from the server, so that those added
+	// elsewhere are also removed
+	nRepo, err := notaryclient.NewFileCachedRepository(
+		config.GetString("trust_dir"), gun, getRemoteTrustServer(config), rt, d.retriever, trustPin)
+	if err != nil {
+		return err
+	}
+	if err := applyRepoConfig(config, nRepo); err != nil {
+		return err
+	}
+	nRepo.SetClock(d.clock)
+
+	delegationRoles, err := nRepo.GetDelegationRoles()
+	if err != nil {
+		return fmt.Errorf("error retrieving delegation roles for repository %s: %w", gun, err)
+	}
+
+	stale := notaryclient.StaleDelegations(delegationRoles, d.clock.Now())
+	if len(stale) == 0 {
+		cmd.Printf("No delegations of repository \"%s\" are past the time they were added for.\n", gun)
+		return nil
+	}
+	for _, role := range stale {
+		if err := nRepo.RemoveDelegationRole(role.Name); err != nil {
+			return fmt.Errorf("failed to remove delegation %s: %v", role.Name, err)
+		}
+		removeAfter, _ := notaryclient.RemoveAfter(role)
+		cmd.Printf("Removal of delegation role %s, which was to be removed after %s, to repository \"%s\" staged for next publish.\n",
+			role.Name, removeAfter.UTC().Format(time.RFC3339), gun)
+	}
+
+	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever, d.clock)
+}
+
+// Open and read a file containing custom data for a delegation, which must be valid JSON
+func getDelegationCustom(customFilename string) (*canonicaljson.RawMessage, error) {
+	custom, err := getTargetCustom(customFilename)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(*custom) {
+		return nil, fmt.Errorf("custom data in %s is not valid JSON", customFilename)
+	}
+	return custom, nil
+}
+
+// parentPaths fetches the delegation roles of the GUN from the server, and
+// returns the paths that the parent of the given delegation role can sign for:
+// its own paths, restricted to those its ancestors can sign for
+func (d *delegationCommander) parentPaths(config *viper.Viper, gun data.GUN, role data.RoleName, trustPin trustpinning.TrustPinConfig) ([]string, error) {
+	parent := role.Parent()
+	if !data.IsDelegation(role) || parent == data.CanonicalTargetsRole {
+		return nil, fmt.Errorf("--inherit-paths can only be used for a delegation role nested under another delegation role, such as targets/a/b")
+	}
+
+	rt, err := getTransport(config, gun, readOnly, d.retriever)
+	if err != nil {
+		return nil, err
+	}
+	nRepo, err := notaryclient.NewFileCachedRepository(
+		config.GetString("trust_dir"), gun, getRemoteTrustServer(config), rt, d.retriever, trustPin)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRepoConfig(config, nRepo); err != nil {
+		return nil, err
+	}
+	nRepo.SetClock(d.clock)
+	roles, err := nRepo.GetDelegationRoles()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving delegation roles for repository %s: %w", gun, err)
+	}
+	return inheritedPaths(roles, parent)
+}
+
+// inheritedPaths returns the paths that the given delegation role can sign for,
+// which are its own paths restricted to those each of its ancestors can sign for
+func inheritedPaths(roles []data.Role, name data.RoleName) ([]string, error) {
+	byName := make(map[data.RoleName]data.Role, len(roles))
+	for _, r := range roles {
+		byName[r.Name] = r
+	}
+
+	// walk up to the top-level delegation, then restrict the paths on the way
+	// back down
+	var chain []data.Role
+	for ancestor := name; ancestor != data.CanonicalTargetsRole; ancestor = ancestor.Parent() {
+		r, ok := byName[ancestor]
+		if !ok {
+			return nil, fmt.Errorf("parent delegation role %s does not exist", ancestor)
+		}
+		chain = append(chain, r)
+	}
+	paths := chain[len(chain)-1].Paths
+	for i := len(chain) - 2; i >= 0; i-- {
+		paths = data.RestrictDelegationPathPrefixes(paths, chain[i].Paths)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("parent delegation role %s has no paths to inherit", name)
+	}
+	return paths, nil
 }
 
 func checkAllPaths(d *delegationCommander) {
@@ -392,3 +910,161 @@ func ingestPublicKeys(args []string) ([]data.PublicKey, error) {
 	}
 	return pubKeys, nil
 }
+
+// shortenRoleKeyIDs returns copies of the roles with their key IDs shortened
+// to the shortest prefix which tells apart all the key IDs of all the roles
+func shortenRoleKeyIDs(roles []data.Role) []data.Role {
+	var keyIDs []string
+	for _, r := range roles {
+		keyIDs = append(keyIDs, r.KeyIDs...)
+	}
+	length := shortKeyIDLength(keyIDs)
+
+	shortened := make([]data.Role, 0, len(roles))
+	for _, r := range roles {
+		short := make([]string, 0, len(r.KeyIDs))
+		for _, keyID := range r.KeyIDs {
+			short = append(short, shortKeyID(keyID, length))
+		}
+		r.KeyIDs = short
+		shortened = append(shortened, r)
+	}
+	return shortened
+}
+
+// ingestLocalKeys returns the public keys of local keys by their IDs, or
+// unique prefixes of their IDs.  Each key must have been generated for the
+// delegation role and, if it was generated for a GUN, for the GUN of the
+// delegation.
+func ingestLocalKeys(trustDir string, retriever notary.PassRetriever, gun data.GUN, role data.RoleName, keyIDs []string) ([]data.PublicKey, error) {
+	fileKeyStore, err := trustmanager.NewKeyFileStore(trustDir, retriever)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create private key store in directory: %s", trustDir)
+	}
+	cs := cryptoservice.NewCryptoService(fileKeyStore)
+
+	var stored []string
+	for keyID := range fileKeyStore.ListKeys() {
+		stored = append(stored, keyID)
+	}
+
+	pubKeys := []data.PublicKey{}
+	for _, prefix := range keyIDs {
+		keyID, err := resolveKeyID(prefix, stored)
+		if err != nil {
+			return nil, err
+		}
+		keyInfo, err := cs.GetKeyInfo(keyID)
+		if err != nil {
+			return nil, fmt.Errorf("no local key with ID %s", keyID)
+		}
+		if keyInfo.Role != role {
+			return nil, fmt.Errorf("key %s was generated for role %s, not %s", keyID, keyInfo.Role, role)
+		}
+		if keyInfo.Gun != "" && keyInfo.Gun != gun {
+			return nil, fmt.Errorf("key %s was generated for %s, not %s", keyID, keyInfo.Gun, gun)
+		}
+		privKey, _, err := cs.GetPrivateKey(keyID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read local key %s: %v", keyID, err)
+		}
+		pubKeys = append(pubKeys, data.PublicKeyFromPrivate(privKey))
+	}
+	return pubKeys, nil
+}
+
+// ingestJWKS reads the public keys from a JWKS document in a file, or at an
+// https URL whose server is trusted by the system or the given CA
+func ingestJWKS(location, caFile string) ([]data.PublicKey, error) {
+	var (
+		jwks []byte
+		err  error
+	)
+	switch {
+	case strings.HasPrefix(location, "http://"):
+		return nil, fmt.Errorf("JWKS URL must use https: %s", location)
+	case strings.HasPrefix(location, "https://"):
+		jwks, err = fetchHTTPS(location, nil, nil, caFile)
+	default:
+		jwks, err = ioutil.ReadFile(location)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("JWKS file does not exist: %s", location)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read JWKS from %s: %v", location, err)
+	}
+
+	pubKeys, err := utils.ParseJWKS(jwks)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse keys from %s: %v", location, err)
+	}
+	return pubKeys, nil
+}
+
+// ingestCertsURL fetches a PEM bundle of certificates over HTTPS, sending the
+// given "Name: value" headers, and returns the public keys of all of them.
+// The server's certificate must be trusted by the system or the given CA, and
+// if any SPKI hashes are pinned, have a public key matching one of them.
+func ingestCertsURL(url string, headers, pins []string, caFile string) ([]data.PublicKey, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("certificate bundle URL must use https: %s", url)
+	}
+	bundle, err := fetchHTTPS(url, headers, pins, caFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch certificates from %s: %v", url, err)
+	}
+
+	certs, err := utils.LoadCertBundleFromPEM(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificates from %s: %v", url, err)
+	}
+	pubKeys := make([]data.PublicKey, 0, len(certs))
+	for _, cert := range certs {
+		if err := utils.ValidateCertificate(cert, true); err != nil {
+			return nil, fmt.Errorf("invalid certificate %s from %s: %v", cert.Subject.CommonName, url, err)
+		}
+		pubKeys = append(pubKeys, utils.CertToKey(cert))
+	}
+	return pubKeys, nil
+}
+
+// fetchHTTPS fetches the content at an https URL, up to notary.MaxDownloadSize,
+// sending the given "Name: value" headers.  The server's certificate must be
+// trusted by the system or the given CA, and if any SPKI hashes are pinned,
+// have a public key matching one of them.
+func fetchHTTPS(url string, headers, pins []string, caFile string) ([]byte, error) {
+	tlsConfig, err := tlsconfig.Client(tlsconfig.Options{CAFile: caFile})
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure TLS: %v", err)
+	}
+	if len(pins) > 0 {
+		if tlsConfig.VerifyPeerCertificate, err = pinnedSPKIVerifier(pins); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := addHeaders(req, headers); err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, notary.MaxDownloadSize))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// minGuidedRootExpiry is the shortest root expiry the guided setup accepts,
+// since a root which is already nearing expiry is re-signed, with the default
+// expiry, on every publish
+const minGuidedRootExpiry = notary.Year
+
+// initChoices are the answers given during the guided setup of `notary init`
+type initChoices struct {
+	// rootKey and rootCert are the files to import the root key and its
+	// certificate from, if any
+	rootKey  string
+	rootCert string
+	// newRootKey is set if a new root key is to be generated even though the
+	// keystore already has one
+	newRootKey  bool
+	rootExpiry  time.Duration
+	delegations []initDelegation
+	publish     bool
+}
+
+type initDelegation struct {
+	role    data.RoleName
+	pubKeys []data.PublicKey
+	paths   []string
+}
+
+// errGuidedSetupEnded is returned when the input runs out before every
+// question of the guided setup has been answered
+var errGuidedSetupEnded = fmt.Errorf("guided setup ended before every question was answered")
+
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints the question and returns the trimmed line answering it
+func (p *prompter) ask(question string) (string, error) {
+	fmt.Fprint(p.out, question)
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", errGuidedSetupEnded
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// confirm asks a yes or no question until it gets one of those answers
+func (p *prompter) confirm(question string) (bool, error) {
+	for {
+		answer, err := p.ask(question + " (yes/no) ")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(p.out, "Please answer yes or no.")
+	}
+}
+
+// promptInit walks through the choices of initializing a repository one
+// question at a time.  The root key, root certificate and publishing
+// questions are skipped if they were already answered on the command line.
+func promptInit(gun data.GUN, existingRootKeys []string, t *tufCommander, in io.Reader, out io.Writer) (*initChoices, error) {
+	p := &prompter{in: bufio.NewReader(in), out: out}
+	choices := &initChoices{rootKey: t.rootKey, rootCert: t.rootCert, publish: t.autoPublish}
+	fmt.Fprintf(out, "Setting up the trusted collection %s\n", gun)
+
+	if t.rootKey == "" && t.rootCert == "" {
+		reuse := false
+		if len(existingRootKeys) > 0 {
+			var err error
+			reuse, err = p.confirm(fmt.Sprintf("Reuse the root key %s from the keystore?", existingRootKeys[0]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !reuse {
+			for {
+				rootKey, err := p.ask("Root key file to import, or leave empty to generate a new root key: ")
+				if err != nil {
+					return nil, err
+				}
+				if rootKey == "" {
+					choices.newRootKey = len(existingRootKeys) > 0
+					break
+				}
+				if _, err := os.Stat(rootKey); err != nil {
+					fmt.Fprintf(out, "Unable to read %s: %v\n", rootKey, err)
+					continue
+				}
+				choices.rootKey = rootKey
+				break
+			}
+		}
+	}
+	if choices.rootKey != "" && t.rootCert == "" {
+		for {
+			rootCert, err := p.ask("Root certificate file matching the root key, or leave empty to generate one: ")
+			if err != nil {
+				return nil, err
+			}
+			if rootCert != "" {
+				if _, err := os.Stat(rootCert); err != nil {
+					fmt.Fprintf(out, "Unable to read %s: %v\n", rootCert, err)
+					continue
+				}
+			}
+			choices.rootCert = rootCert
+			break
+		}
+	}
+
+	defaultDays := int(notary.NotaryRootExpiry / notary.Day)
+	for {
+		answer, err := p.ask(fmt.Sprintf("Days until the root expires [%d]: ", defaultDays))
+		if err != nil {
+			return nil, err
+		}
+		days := defaultDays
+		if answer != "" {
+			days, err = strconv.Atoi(answer)
+			if err != nil || time.Duration(days)*notary.Day < minGuidedRootExpiry {
+				fmt.Fprintf(out, "Please enter a number of days of at least %d.\n", minGuidedRootExpiry/notary.Day)
+				continue
+			}
+		}
+		choices.rootExpiry = time.Duration(days) * notary.Day
+		break
+	}
+
+	question := "Add a delegation?"
+	for {
+		add, err := p.confirm(question)
+		if err != nil {
+			return nil, err
+		}
+		if !add {
+			break
+		}
+		delegation, err := promptDelegation(p, gun)
+		if err != nil {
+			return nil, err
+		}
+		choices.delegations = append(choices.delegations, delegation)
+		question = "Add another delegation?"
+	}
+
+	if !t.autoPublish {
+		publish, err := p.confirm("Publish the trusted collection now?")
+		if err != nil {
+			return nil, err
+		}
+		choices.publish = publish
+	}
+	return choices, nil
+}
+
+func promptDelegation(p *prompter, gun data.GUN) (initDelegation, error) {
+	var delegation initDelegation
+	for {
+		role, err := p.ask("Delegation role name, such as targets/releases: ")
+		if err != nil {
+			return delegation, err
+		}
+		if !data.IsDelegation(data.RoleName(role)) {
+			fmt.Fprintf(p.out, "%q is not a valid delegation role name.\n", role)
+			continue
+		}
+		delegation.role = data.RoleName(role)
+		break
+	}
+	for {
+		answer, err := p.ask("Public key or certificate files of the delegation, separated by commas: ")
+		if err != nil {
+			return delegation, err
+		}
+		keyFiles := splitList(answer)
+		if len(keyFiles) == 0 {
+			fmt.Fprintln(p.out, "A delegation needs at least one key.")
+			continue
+		}
+		pubKeys, err := ingestPublicKeys(append([]string{gun.String(), delegation.role.String()}, keyFiles...))
+		if err != nil {
+			fmt.Fprintln(p.out, err)
+			continue
+		}
+		delegation.pubKeys = pubKeys
+		break
+	}
+	answer, err := p.ask("Paths the delegation may sign targets under, separated by commas, or leave empty for all paths: ")
+	if err != nil {
+		return delegation, err
+	}
+	delegation.paths = splitList(answer)
+	if len(delegation.paths) == 0 {
+		delegation.paths = []string{""}
+	}
+	return delegation, nil
+}
+
+// splitList splits a comma separated answer, dropping empty items
+func splitList(answer string) []string {
+	var items []string
+	for _, item := range strings.Split(answer, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -8,15 +8,20 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/passphrase"
+	"github.com/theupdateframework/notary/tuf/data"
 )
 
 func init() {
-	NewNotaryCommand = func() *cobra.Command {
+	newNotaryCommandAt = func(clock data.Clock) *cobra.Command {
 		commander := &notaryCommander{
 			getRetriever: func() notary.PassRetriever { return passphrase.ConstantRetriever(testPassphrase) },
+			clock:        clock,
 		}
 		return commander.GetCommand()
 	}
+	NewNotaryCommand = func() *cobra.Command {
+		return newNotaryCommandAt(nil)
+	}
 }
 
 func rootOnHardware() bool {
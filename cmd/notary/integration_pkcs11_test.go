@@ -34,12 +34,16 @@ func init() {
 		}
 	}
 
-	NewNotaryCommand = func() *cobra.Command {
+	newNotaryCommandAt = func(clock data.Clock) *cobra.Command {
 		commander := &notaryCommander{
 			getRetriever: func() notary.PassRetriever { return _retriever },
+			clock:        clock,
 		}
 		return commander.GetCommand()
 	}
+	NewNotaryCommand = func() *cobra.Command {
+		return newNotaryCommandAt(nil)
+	}
 }
 
 var rootOnHardware = yubikey.IsAccessible
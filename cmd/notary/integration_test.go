@@ -20,6 +20,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -36,26 +37,41 @@ import (
 	"github.com/theupdateframework/notary/cryptoservice"
 	"github.com/theupdateframework/notary/passphrase"
 	"github.com/theupdateframework/notary/server"
+	"github.com/theupdateframework/notary/server/handlers"
 	"github.com/theupdateframework/notary/server/storage"
 	nstorage "github.com/theupdateframework/notary/storage"
+	ocitestutils "github.com/theupdateframework/notary/storage/testutils"
 	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf/data"
 	testutils "github.com/theupdateframework/notary/tuf/testutils/keys"
 	"github.com/theupdateframework/notary/tuf/utils"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
 	"golang.org/x/net/context"
 )
 
 var testPassphrase = "passphrase"
 var NewNotaryCommand func() *cobra.Command
 
+// newNotaryCommandAt is NewNotaryCommand, with the commands telling the time
+// by the given clock instead of the real one if it is not nil
+var newNotaryCommandAt func(clock data.Clock) *cobra.Command
+
 // run a command and return the output as a string
 func runCommand(t *testing.T, tempDir string, args ...string) (string, error) {
+	return runCommandAt(t, nil, tempDir, args...)
+}
+
+// run a command which tells the time by the given clock and return the output
+// as a string
+func runCommandAt(t *testing.T, clock data.Clock, tempDir string, args ...string) (string, error) {
 	b := new(bytes.Buffer)
 
 	// Create an empty config file so we don't load the default on ~/.notary/config.json
 	configFile := filepath.Join(tempDir, "config.json")
 
-	cmd := NewNotaryCommand()
+	cmd := newNotaryCommandAt(clock)
 	cmd.SetArgs(append([]string{"-c", configFile, "-d", tempDir}, args...))
 	cmd.SetOutput(b)
 	retErr := cmd.Execute()
@@ -70,6 +86,37 @@ func runCommand(t *testing.T, tempDir string, args ...string) (string, error) {
 	return string(output), retErr
 }
 
+// run a command, returning what it wrote to STDOUT, whether through the
+// command's output or to the process's STDOUT, separately from what it wrote to
+// the command's error output
+func runCommandStdio(t *testing.T, tempDir string, args ...string) (string, string, error) {
+	outR, outW, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = outW
+	outC := make(chan string, 1)
+	go func() {
+		defer outR.Close()
+		b, _ := ioutil.ReadAll(outR)
+		outC <- string(b)
+	}()
+
+	var cmdOut, cmdErr bytes.Buffer
+	configFile := filepath.Join(tempDir, "config.json")
+	cmd := newNotaryCommandAt(nil)
+	cmd.SetArgs(append([]string{"-c", configFile, "-d", tempDir}, args...))
+	cmd.SetOut(&cmdOut)
+	cmd.SetErr(&cmdErr)
+	retErr := cmd.Execute()
+	for _, command := range cmd.Commands() {
+		command.ResetFlags()
+	}
+
+	os.Stdout = stdout
+	require.NoError(t, outW.Close())
+	return cmdOut.String() + <-outC, cmdErr.String(), retErr
+}
+
 func setupServerHandler(metaStore storage.MetaStore) http.Handler {
 	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, metaStore)
 
@@ -185,6 +232,83 @@ func TestInitWithRootKey(t *testing.T) {
 	require.Error(t, err, "Init with wrong role should error")
 }
 
+// Initializes a repo with an existing targets key, and checks that it is the
+// key the targets role is created with and signed by
+func TestInitWithTargetsKey(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	metaStore := storage.NewMemStorage()
+	server := httptest.NewServer(setupServerHandler(metaStore))
+	defer server.Close()
+
+	writeKey := func(name string, role data.RoleName, gun data.GUN, passphrase string) (data.PrivateKey, string) {
+		privKey, err := utils.GenerateECDSAKey(rand.Reader)
+		require.NoError(t, err)
+		pemPrivKey, err := utils.ConvertPrivateKeyToPKCS8(privKey, role, gun, passphrase)
+		require.NoError(t, err)
+		filename := filepath.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(filename, pemPrivKey, 0644))
+		return privKey, filename
+	}
+
+	targetsKey, targetsKeyFilename := writeKey("targets.key", data.CanonicalTargetsRole, "gun", testPassphrase)
+	output, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "--targetskey", targetsKeyFilename, "-p")
+	require.NoError(t, err)
+	require.Contains(t, output, "Targets key found, using: "+targetsKey.ID())
+
+	// the root lists the key for the targets role, and it signs the targets
+	_, rootJSON, err := metaStore.GetCurrent("gun", data.CanonicalRootRole)
+	require.NoError(t, err)
+	decodedRoot := &data.SignedRoot{}
+	require.NoError(t, json.Unmarshal(rootJSON, decodedRoot))
+	require.Equal(t, []string{targetsKey.ID()}, decodedRoot.Signed.Roles[data.CanonicalTargetsRole].KeyIDs)
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "v1", tempFile.Name(), "-p")
+	require.NoError(t, err)
+
+	_, targetsJSON, err := metaStore.GetCurrent("gun", data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	decodedTargets := &data.Signed{}
+	require.NoError(t, json.Unmarshal(targetsJSON, decodedTargets))
+	require.Len(t, decodedTargets.Signatures, 1)
+	require.Equal(t, targetsKey.ID(), decodedTargets.Signatures[0].KeyID)
+
+	// an unencrypted key without a role or GUN is accepted too
+	unlabelledKey, unlabelledKeyFilename := writeKey("unlabelled.key", "", "", "")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun2", "--targetskey", unlabelledKeyFilename)
+	require.NoError(t, err)
+	require.Contains(t, output, "Targets key found, using: "+unlabelledKey.ID())
+
+	// check error if file doesn't exist
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun3", "--targetskey", "bad_file")
+	require.Error(t, err, "Init with nonexistent key file should error")
+
+	// check error if file is invalid format
+	badKeyFilename := filepath.Join(tempDir, "bad_key.key")
+	require.NoError(t, ioutil.WriteFile(badKeyFilename, []byte("thisisnotapemkey"), 0644))
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun3", "--targetskey", badKeyFilename)
+	require.Error(t, err, "Init with non-PEM key should error")
+
+	// check error if wrong role specified
+	_, snapshotKeyFilename := writeKey("snapshot.key", data.CanonicalSnapshotRole, "gun3", "")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun3", "--targetskey", snapshotKeyFilename)
+	require.Error(t, err, "Init with wrong role should error")
+	require.Contains(t, err.Error(), "not a targets key")
+
+	// check error if the key is for another GUN
+	_, otherGUNKeyFilename := writeKey("other.key", data.CanonicalTargetsRole, "other", "")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun3", "--targetskey", otherGUNKeyFilename)
+	require.Error(t, err, "Init with another GUN's key should error")
+	require.Contains(t, err.Error(), "not gun3")
+}
+
 func TestInitWithRootCert(t *testing.T) {
 	setUp(t)
 
@@ -440,6 +564,49 @@ func TestClientTUFInteraction(t *testing.T) {
 	require.Contains(t, output, target2)
 }
 
+// Listing targets sorts them by the requested field, and rejects unknown fields
+func TestClientTUFListSort(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	// the order of the targets by name differs from their order by size
+	for name, size := range map[string]int{"small": 1, "tiny-but-not": 10, "large": 100} {
+		targetFile := filepath.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(targetFile, bytes.Repeat([]byte("a"), size), 0644))
+		_, err = runCommand(t, tempDir, "add", "gun", name, targetFile)
+		require.NoError(t, err)
+	}
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	listedNames := func(args ...string) []string {
+		output, err := runCommand(t, tempDir, append([]string{"-s", server.URL, "list", "gun"}, args...)...)
+		require.NoError(t, err)
+		var names []string
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n")[2:] {
+			names = append(names, strings.Fields(line)[0])
+		}
+		return names
+	}
+
+	require.Equal(t, []string{"large", "small", "tiny-but-not"}, listedNames())
+	require.Equal(t, []string{"tiny-but-not", "small", "large"}, listedNames("--reverse"))
+	require.Equal(t, []string{"small", "tiny-but-not", "large"}, listedNames("--sort", "size"))
+	require.Equal(t, []string{"large", "tiny-but-not", "small"}, listedNames("--sort", "size", "--reverse"))
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--sort", "digest")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must be one of name, size or role")
+}
+
 func TestClientDeleteTUFInteraction(t *testing.T) {
 	// -- setup --
 	setUp(t)
@@ -583,6 +750,180 @@ func assertLocalMetadataForGun(t *testing.T, configDir, gun string, shouldExist
 	}
 }
 
+// Publishing reports the progress of each stage, unless --quiet is given
+func TestClientPublishProgress(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "target", tempFile.Name())
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	stages := []string{
+		"Loading changelist: 1 change(s) to publish",
+		"Building metadata",
+		"Uploading metadata for root, snapshot, targets",
+		"Confirming publish",
+		"Successfully published",
+	}
+	last := -1
+	for _, stage := range stages {
+		i := strings.Index(output, stage)
+		require.True(t, i > last, "%q is missing or out of order in:\n%s", stage, output)
+		last = i
+	}
+
+	_, err = runCommand(t, tempDir, "add", "gun", "target2", tempFile.Name())
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--quiet")
+	require.NoError(t, err)
+	require.NotContains(t, output, "Loading changelist")
+	require.NotContains(t, output, "Confirming publish")
+	require.Contains(t, output, "Successfully published")
+}
+
+// Publishing with --roles publishes only the staged changes to those roles,
+// leaving the rest staged
+func TestClientPublishRoles(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	certFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = certFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	certFile.Close()
+	defer os.Remove(certFile.Name())
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "target", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", certFile.Name(), "--all-paths")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--roles", "targets/other")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no staged changes to publish for targets/other")
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--roles", "targets")
+	require.NoError(t, err)
+	require.Contains(t, output, "Loading changelist: 1 change(s) to publish")
+	require.Contains(t, output, "Successfully published")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "target")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No delegations present in this repository.")
+
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+	require.NotContains(t, output, "target ")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
+}
+
+// Lists the targets as they would be after publishing, by applying the staged
+// changes to the published targets
+func TestClientStatusDiffRemote(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	hashes := map[string]string{
+		"kept":    strings.Repeat("1", 64),
+		"removed": strings.Repeat("2", 64),
+		"changed": strings.Repeat("3", 64),
+		"new":     strings.Repeat("4", 64),
+		"updated": strings.Repeat("5", 64),
+	}
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	// before anything is published, only the staged changes take effect
+	_, err = runCommand(t, tempDir, "addhash", "gun", "kept", "10", "--sha256", hashes["kept"])
+	require.NoError(t, err)
+	output, err := runCommand(t, tempDir, "-s", server.URL, "status", "gun", "--diff-remote")
+	require.NoError(t, err)
+	require.Contains(t, output, "Targets of gun after publishing:")
+	require.Regexp(t, "kept +"+hashes["kept"]+" +10 +targets +unpublished", output)
+
+	for _, name := range []string{"removed", "changed"} {
+		_, err = runCommand(t, tempDir, "addhash", "gun", name, "10", "--sha256", hashes[name])
+		require.NoError(t, err)
+	}
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "status", "gun", "--diff-remote")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
+	for _, name := range []string{"kept", "removed", "changed"} {
+		require.Regexp(t, name+" +"+hashes[name]+" +10 +targets +published", output)
+	}
+
+	_, err = runCommand(t, tempDir, "remove", "gun", "removed")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "addhash", "gun", "changed", "20", "--sha256", hashes["updated"])
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "addhash", "gun", "new", "30", "--sha256", hashes["new"])
+	require.NoError(t, err)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "status", "gun", "--diff-remote")
+	require.NoError(t, err)
+	require.Contains(t, output, "Unpublished changes for gun:")
+	require.Regexp(t, "kept +"+hashes["kept"]+" +10 +targets +published", output)
+	require.Regexp(t, "changed +"+hashes["updated"]+" +20 +targets +unpublished", output)
+	require.Regexp(t, "new +"+hashes["new"]+" +30 +targets +unpublished", output)
+	require.NotContains(t, output, hashes["removed"])
+	require.NotContains(t, output, hashes["changed"])
+
+	// without the flag, only the changes are listed
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "after publishing")
+	require.NotContains(t, output, hashes["kept"])
+}
+
 // Initializes a repo, adds a target, publishes the target by hash, lists the target,
 // verifies the target, and then removes the target.
 func TestClientTUFAddByHashInteraction(t *testing.T) {
@@ -782,971 +1123,3136 @@ func TestClientTUFAddByHashInteraction(t *testing.T) {
 	require.Contains(t, output, target4)
 }
 
-// Initialize repo and test delegations commands by adding, listing, and removing delegations
-func TestClientDelegationsInteraction(t *testing.T) {
+// With --no-tofu, a GUN with no local trust data can only be downloaded if its
+// root of trust is pinned in the configuration
+func TestClientNoTOFU(t *testing.T) {
 	setUp(t)
 
-	tempDir := tempDirWithConfig(t, "{}")
-	defer os.RemoveAll(tempDir)
-
 	server := setupServer()
 	defer server.Close()
 
-	// Setup certificate
-	tempFile, err := ioutil.TempFile("", "pemfile")
-	require.NoError(t, err)
-	cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
-	_, err = tempFile.Write(utils.CertToPEM(cert))
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	// init and publish repo, which trusts its own root
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-	tempFile.Close()
-	defer os.Remove(tempFile.Name())
 
-	var output string
+	rootJSON, err := ioutil.ReadFile(filepath.Join(tempDir, "tuf", "gun", "metadata", "root.json"))
+	require.NoError(t, err)
+	root := &data.SignedRoot{}
+	require.NoError(t, json.Unmarshal(rootJSON, root))
+	rootKeyIDs := root.Signed.Roles[data.CanonicalRootRole].KeyIDs
+	require.Len(t, rootKeyIDs, 1)
 
-	// -- tests --
+	// an un-pinned GUN cannot be bootstrapped
+	unpinnedDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(unpinnedDir)
+	_, err = runCommand(t, unpinnedDir, "-s", server.URL, "--no-tofu", "list", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "trust on first use is disabled")
 
-	// init repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	// without the flag, the same GUN is trusted on first use
+	_, err = runCommand(t, unpinnedDir, "-s", server.URL, "list", "gun")
 	require.NoError(t, err)
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	// a GUN pinned to its root certificate can be bootstrapped
+	pinnedDir := tempDirWithConfig(t, fmt.Sprintf(`{
+		"trust_pinning": {
+		    "certs": {
+		        "gun": ["%s"]
+		    }
+		}
+	}`, rootKeyIDs[0]))
+	defer os.RemoveAll(pinnedDir)
+	_, err = runCommand(t, pinnedDir, "-s", server.URL, "--no-tofu", "list", "gun")
 	require.NoError(t, err)
+}
 
-	// list delegations - none yet
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "No delegations present in this repository.")
+// With trust_pinning.tofu_max_age, a root trusted on first use is only
+// trusted until it is older than the maximum age, after which it must be
+// re-pinned with --repin
+func TestClientTOFUMaxAge(t *testing.T) {
+	setUp(t)
 
-	// add new valid delegation with single new cert, and no path
-	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name())
-	require.NoError(t, err)
-	require.Contains(t, output, "Addition of delegation role")
-	require.Contains(t, output, keyID)
-	require.NotContains(t, output, "path")
+	server := setupServer()
+	defer server.Close()
 
-	// check status - see delegation
-	output, err = runCommand(t, tempDir, "status", "gun")
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-	require.Contains(t, output, "Unpublished changes for gun")
 
-	// list delegations - none yet because still unpublished
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	readerDir := tempDirWithConfig(t, `{"trust_pinning": {"tofu_max_age": "1h"}}`)
+	defer os.RemoveAll(readerDir)
+	_, err = runCommand(t, readerDir, "-s", server.URL, "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "No delegations present in this repository.")
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	pinPath := filepath.Join(readerDir, "tuf", "gun", "metadata", "tofu_pin.json")
+	setPinnedAt := func(pinnedAt time.Time) {
+		record, err := json.Marshal(map[string]time.Time{"pinned_at": pinnedAt})
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(pinPath, record, 0644))
+	}
 
-	// check status - no changelist
-	output, err = runCommand(t, tempDir, "status", "gun")
+	// a fresh pin is trusted
+	setPinnedAt(time.Now().Add(-59 * time.Minute))
+	_, err = runCommand(t, readerDir, "-s", server.URL, "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "No unpublished changes for gun")
 
-	// list delegations - we should see our added delegation, with no paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "targets/delegation")
-	require.Contains(t, output, keyID)
-	require.NotContains(t, output, "\"\"")
+	// an aged pin must be re-pinned
+	setPinnedAt(time.Now().Add(-61 * time.Minute))
+	_, err = runCommand(t, readerDir, "-s", server.URL, "list", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must be re-pinned with --repin")
 
-	// add all paths to this delegation
-	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--all-paths")
+	_, err = runCommand(t, readerDir, "-s", server.URL, "--repin", "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "Addition of delegation role")
-	require.Contains(t, output, "\"\"")
-	require.Contains(t, output, "<all paths>")
-
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	_, err = runCommand(t, readerDir, "-s", server.URL, "list", "gun")
 	require.NoError(t, err)
 
-	// list delegations - we should see our added delegation, with no paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "targets/delegation")
-	require.Contains(t, output, "\"\"")
-	require.Contains(t, output, "<all paths>")
+	// the maximum age must be a positive duration
+	invalidDir := tempDirWithConfig(t, `{"trust_pinning": {"tofu_max_age": "a month"}}`)
+	defer os.RemoveAll(invalidDir)
+	_, err = runCommand(t, invalidDir, "-s", server.URL, "list", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid trust_pinning.tofu_max_age")
+}
 
-	// Setup another certificate
-	tempFile2, err := ioutil.TempFile("", "pemfile2")
-	require.NoError(t, err)
+// Initializing with an initial root bundle which satisfies the trust pinning
+// configuration trusts it for the existing repository, without trusting the
+// server's root on first use.  A bundle which has been tampered with is rejected.
+func TestClientInitWithInitialRoot(t *testing.T) {
+	setUp(t)
 
-	cert2, _, keyID2 := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
-	_, err = tempFile2.Write(utils.CertToPEM(cert2))
-	require.NoError(t, err)
-	tempFile2.Close()
-	defer os.Remove(tempFile2.Name())
+	server := setupServer()
+	defer server.Close()
 
-	// add to the delegation by specifying the same role, this time add a scoped path
-	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile2.Name(), "--paths", "path")
-	require.NoError(t, err)
-	require.Contains(t, output, "Addition of delegation role")
-	require.Contains(t, output, keyID2)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
 
-	// list delegations - we should see two keys
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	rootJSON, err := ioutil.ReadFile(filepath.Join(tempDir, "tuf", "gun", "metadata", "root.json"))
 	require.NoError(t, err)
-	require.Contains(t, output, "path")
-	require.Contains(t, output, keyID)
-	require.Contains(t, output, keyID2)
+	root := &data.SignedRoot{}
+	require.NoError(t, json.Unmarshal(rootJSON, root))
+	rootKeyIDs := root.Signed.Roles[data.CanonicalRootRole].KeyIDs
+	require.Len(t, rootKeyIDs, 1)
 
-	// remove the delegation's first key
-	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", keyID)
-	require.NoError(t, err)
-	require.Contains(t, output, "Removal of delegation role")
+	bundleFile := filepath.Join(tempDir, "initial-root.json")
+	require.NoError(t, ioutil.WriteFile(bundleFile, rootJSON, 0644))
+	tamperedFile := filepath.Join(tempDir, "tampered-root.json")
+	tampered := bytes.Replace(rootJSON, []byte(`"consistent_snapshot":false`), []byte(`"consistent_snapshot":true`), 1)
+	require.NotEqual(t, rootJSON, tampered)
+	require.NoError(t, ioutil.WriteFile(tamperedFile, tampered, 0644))
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	pinnedDir := tempDirWithConfig(t, fmt.Sprintf(`{
+		"trust_pinning": {
+		    "certs": {
+		        "gun": ["%s"]
+		    },
+		    "disable_tofu": true
+		}
+	}`, rootKeyIDs[0]))
+	defer os.RemoveAll(pinnedDir)
 
-	// list delegations - we should see the delegation but with only the second key
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.NotContains(t, output, keyID)
-	require.Contains(t, output, keyID2)
+	// the initial root can't be combined with creating a new root
+	_, err = runCommand(t, pinnedDir, "-s", server.URL, "init", "gun", "--initial-root", bundleFile, "-p")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--initial-root cannot be used with")
 
-	// remove the delegation's second key
-	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", keyID2)
-	require.NoError(t, err)
-	require.Contains(t, output, "Removal of delegation role")
+	_, err = runCommand(t, pinnedDir, "-s", server.URL, "init", "gun", "--initial-root", tamperedFile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not trusted for gun")
+	_, err = os.Stat(filepath.Join(pinnedDir, "tuf", "gun", "metadata", "root.json"))
+	require.True(t, os.IsNotExist(err))
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	// seeding is offline, so the server isn't needed
+	output, err := runCommand(t, pinnedDir, "init", "gun", "--initial-root", bundleFile)
 	require.NoError(t, err)
-
-	// list delegations - we should see no delegations
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.Contains(t, output, "Trusting version 1 of the root of gun")
+	cached, err := ioutil.ReadFile(filepath.Join(pinnedDir, "tuf", "gun", "metadata", "root.json"))
 	require.NoError(t, err)
-	require.NotContains(t, output, keyID)
-	require.NotContains(t, output, keyID2)
+	require.Equal(t, rootJSON, cached)
 
-	// add delegation with multiple certs and multiple paths
-	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), tempFile2.Name(), "--paths", "path1,path2")
+	_, err = runCommand(t, pinnedDir, "-s", server.URL, "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "Addition of delegation role")
-	require.Contains(t, output, keyID)
-	require.Contains(t, output, keyID2)
+}
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+// Verifying from a URL streams the remote object through the hashers and
+// checks it against the trusted hashes
+func TestClientVerifyFromURL(t *testing.T) {
+	setUp(t)
 
-	// list delegations - we should see two keys
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "path1")
-	require.Contains(t, output, "path2")
-	require.Contains(t, output, keyID)
-	require.Contains(t, output, keyID2)
+	server := setupServer()
+	defer server.Close()
 
-	// add delegation with multiple certs and multiple paths
-	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "path3")
-	require.NoError(t, err)
-	require.Contains(t, output, "Addition of delegation role")
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	content := []byte("trusted content")
+	tempFile, err := ioutil.TempFile("", "targetfile")
 	require.NoError(t, err)
-
-	// list delegations - we should see two keys
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	_, err = tempFile.Write(content)
 	require.NoError(t, err)
-	require.Contains(t, output, "path1")
-	require.Contains(t, output, "path2")
-	require.Contains(t, output, "path3")
-	require.Contains(t, output, keyID)
-	require.Contains(t, output, keyID2)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// just remove two paths from this delegation
-	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "path2,path3")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "Removal of delegation role")
-
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	_, err = runCommand(t, tempDir, "add", "gun", "target", tempFile.Name(), "-p", "-s", server.URL)
 	require.NoError(t, err)
 
-	// list delegations - we should see the same two keys, and only path1
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "path1")
-	require.NotContains(t, output, "path2")
-	require.NotContains(t, output, "path3")
-	require.Contains(t, output, keyID)
-	require.Contains(t, output, keyID2)
+	contentStore := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/match":
+			w.Write(content)
+		case "/mismatch":
+			w.Write([]byte("untrusted content"))
+		case "/auth":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer contentStore.Close()
 
-	// remove the remaining path, should not remove the delegation entirely
-	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "path1")
+	output, err := runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/match")
 	require.NoError(t, err)
-	require.Contains(t, output, "Removal of delegation role")
+	require.Contains(t, output, "matches target in gun")
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/match", "-q")
 	require.NoError(t, err)
+	require.Empty(t, output)
 
-	// list delegations - we should see the same two keys, and no paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.NotContains(t, output, "path1")
-	require.NotContains(t, output, "path2")
-	require.NotContains(t, output, "path3")
-	require.Contains(t, output, keyID)
-	require.Contains(t, output, keyID2)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/mismatch")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "data not present in the trusted collection")
 
-	// Add a bunch of individual paths so we can test a delegation remove --all-paths
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "abcdef,123456")
-	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "404")
 
-	// Add more individual paths so we can test a delegation remove --all-paths
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "banana/split,apple/crumble/pie,orange.peel,kiwi")
+	// auth headers are passed through to the content store
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/auth")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/auth",
+		"-H", "Authorization: Bearer token")
 	require.NoError(t, err)
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/auth",
+		"-H", "not a header")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid header")
 
-	// list delegations - we should see all of our paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "abcdef")
-	require.Contains(t, output, "123456")
-	require.Contains(t, output, "banana/split")
-	require.Contains(t, output, "apple/crumble/pie")
-	require.Contains(t, output, "orange.peel")
-	require.Contains(t, output, "kiwi")
+	// --from-url replaces reading from a file
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "--from-url", contentStore.URL+"/match",
+		"-i", tempFile.Name())
+	require.Error(t, err)
+}
 
-	// Try adding "", and check that adding it with other paths clears out the others
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "\"\",grapefruit,pomegranate")
-	require.NoError(t, err)
+// Verifying a manifest checks every target it lists against the trusted
+// collection, and reports each one which is missing or has mismatched hashes
+func TestClientVerifyManifest(t *testing.T) {
+	setUp(t)
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	server := setupServer()
+	defer server.Close()
 
-	// list delegations - we should see all of our old paths, and ""
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "abcdef")
-	require.Contains(t, output, "123456")
-	require.Contains(t, output, "banana/split")
-	require.Contains(t, output, "apple/crumble/pie")
-	require.Contains(t, output, "orange.peel")
-	require.Contains(t, output, "kiwi")
-	require.Contains(t, output, "\"\"")
-	require.NotContains(t, output, "grapefruit")
-	require.NotContains(t, output, "pomegranate")
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	// Try removing just ""
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "\"\"")
+	contents := map[string][]byte{
+		"app":    []byte("app content"),
+		"config": []byte("config content"),
+	}
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
 	require.NoError(t, err)
-
-	// publish repo
+	for name, content := range contents {
+		file := filepath.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(file, content, 0644))
+		_, err = runCommand(t, tempDir, "add", "gun", name, file)
+		require.NoError(t, err)
+	}
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// list delegations - we should see all of our old paths without ""
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "abcdef")
-	require.Contains(t, output, "123456")
-	require.Contains(t, output, "banana/split")
-	require.Contains(t, output, "apple/crumble/pie")
-	require.Contains(t, output, "orange.peel")
-	require.Contains(t, output, "kiwi")
-	require.NotContains(t, output, "\"\"")
+	sha256Hex := func(content []byte) string {
+		digest := sha256.Sum256(content)
+		return hex.EncodeToString(digest[:])
+	}
+	writeManifest := func(name, manifest string) string {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(manifest), 0644))
+		return path
+	}
 
-	// Remove --all-paths to clear out all paths from this delegation
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths")
+	matching := writeManifest("matching.json", fmt.Sprintf(`{
+		"app": {"sha256": "%s"},
+		"config": {"sha256": "%s"}
+	}`, sha256Hex(contents["app"]), sha256Hex(contents["config"])))
+	output, err := runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "--manifest", matching)
 	require.NoError(t, err)
-
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.Contains(t, output, "verified")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "--manifest", matching, "-q")
 	require.NoError(t, err)
+	require.Empty(t, strings.TrimSpace(output))
 
-	// list delegations - we should see all of our paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.NotContains(t, output, "abcdef")
-	require.NotContains(t, output, "123456")
-	require.NotContains(t, output, "banana/split")
-	require.NotContains(t, output, "apple/crumble/pie")
-	require.NotContains(t, output, "orange.peel")
-	require.NotContains(t, output, "kiwi")
+	// sha512 hashes aren't listed, so the manifest can't be strictly verified
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "--manifest", matching, "--strict-hashes")
+	require.Error(t, err)
 
-	// Check that we ignore other --paths if we pass in --all-paths on an add
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--all-paths", "--paths", "grapefruit,pomegranate")
-	require.NoError(t, err)
+	mismatching := writeManifest("mismatching.json", fmt.Sprintf(`{
+		"app": {"sha256": "%s"},
+		"config": {"sha256": "%s"},
+		"missing": {"sha256": "%s"}
+	}`, sha256Hex(contents["app"]), sha256Hex([]byte("tampered")), sha256Hex(contents["app"])))
+	output, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "--manifest", mismatching, "-q")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "2 of the 3 targets")
+	require.Contains(t, output, "mismatched sha256 checksum")
+	require.Contains(t, output, "not present in the trusted collection")
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	for _, invalid := range []string{`[]`, `{}`, `{"app": {"sha256": "nothex"}}`, `{"app": {"md5": "00"}}`} {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "--manifest", writeManifest("invalid.json", invalid))
+		require.Error(t, err)
+	}
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "app", "--manifest", matching)
+	require.Error(t, err)
+}
 
-	// list delegations - we should only see "", and not the other paths specified
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "\"\"")
-	require.NotContains(t, output, "grapefruit")
-	require.NotContains(t, output, "pomegranate")
+// A target can be verified as it was at a past version of the snapshot,
+// when its content was different from what it is now
+func TestClientVerifyAtVersion(t *testing.T) {
+	setUp(t)
 
-	// Add those extra paths we ignored to set up the next test
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "grapefruit,pomegranate")
-	require.NoError(t, err)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	server := setupServer()
+	defer server.Close()
 
-	// Check that we ignore other --paths if we pass in --all-paths on a remove
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths", "--paths", "pomegranate")
-	require.NoError(t, err)
+	writeFile := func(content string) string {
+		tempFile, err := ioutil.TempFile("", "targetfile")
+		require.NoError(t, err)
+		_, err = tempFile.WriteString(content)
+		require.NoError(t, err)
+		tempFile.Close()
+		return tempFile.Name()
+	}
+	oldFile, newFile := writeFile("old content"), writeFile("new content")
+	defer os.Remove(oldFile)
+	defer os.Remove(newFile)
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	// the initial publish is snapshot version 2, and each publish after it adds one
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-
-	// list delegations - we should see no paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "target", oldFile, "-p")
 	require.NoError(t, err)
-	require.NotContains(t, output, "\"\"")
-	require.NotContains(t, output, "grapefruit")
-	require.NotContains(t, output, "pomegranate")
-
-	// remove by force to delete the delegation entirely
-	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "-y")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "target", newFile, "-p")
 	require.NoError(t, err)
-	require.Contains(t, output, "Forced removal (including all keys and paths) of delegation role")
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", oldFile, "-q")
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", newFile, "-q")
 	require.NoError(t, err)
 
-	// list delegations - we should see no delegations
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", oldFile, "-q", "--at-version", "3")
 	require.NoError(t, err)
-	require.Contains(t, output, "No delegations present in this repository.")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", newFile, "-q", "--at-version", "3")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "data not present in the trusted collection")
+
+	// the target didn't exist when the repository was initialized
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", oldFile, "-q", "--at-version", "2")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error retrieving target by name")
+
+	// versions which don't exist are reported as unavailable
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", oldFile, "-q", "--at-version", "5")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "version 5 of the snapshot of gun is not available")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", oldFile, "-q", "--at-version", "1")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "version 1 of the snapshot of gun is not available")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", oldFile, "--at-version", "-1")
+	require.Error(t, err)
 }
 
-// Initialize repo and test publishing targets with delegation roles
-func TestClientDelegationsPublishing(t *testing.T) {
+// Verifying with --strict-hashes requires the target to have both a sha256 and a
+// sha512 hash, and every hash to match
+func TestClientVerifyStrictHashes(t *testing.T) {
 	setUp(t)
 
-	tempDir := tempDirWithConfig(t, "{}")
-	defer os.RemoveAll(tempDir)
-
 	server := setupServer()
 	defer server.Close()
 
-	// Setup certificate for delegation role
-	tempFile, err := ioutil.TempFile("", "pemfile")
-	require.NoError(t, err)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	cert, privKey, canonicalKeyID := generateCertPrivKeyPair(t, "gun", data.RSAKey)
-	_, err = tempFile.Write(utils.CertToPEM(cert))
+	content := []byte("trusted content")
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	_, err = tempFile.Write(content)
 	require.NoError(t, err)
 	tempFile.Close()
 	defer os.Remove(tempFile.Name())
+	untrustedFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	_, err = untrustedFile.Write([]byte("untrusted content"))
+	require.NoError(t, err)
+	untrustedFile.Close()
+	defer os.Remove(untrustedFile.Name())
 
-	privKeyBytesNoRole, err := utils.ConvertPrivateKeyToPKCS8(privKey, "", "", "")
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
 	require.NoError(t, err)
-	privKeyBytesWithRole, err := utils.ConvertPrivateKeyToPKCS8(privKey, "user", "", "")
+	_, err = runCommand(t, tempDir, "add", "gun", "full", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "addhash", "gun", "only256", fmt.Sprint(len(content)),
+		"--sha256", hex.EncodeToString(sha256Sum[:]))
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "addhash", "gun", "only512", fmt.Sprint(len(content)),
+		"--sha512", hex.EncodeToString(sha512Sum[:]))
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// Set up targets for publishing
-	tempTargetFile, err := ioutil.TempFile("", "targetfile")
+	// a target with both hashes verifies either way
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "full", "-i", tempFile.Name())
 	require.NoError(t, err)
-	tempTargetFile.Close()
-	defer os.Remove(tempTargetFile.Name())
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "full", "-i", tempFile.Name(), "--strict-hashes")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "full", "-i", untrustedFile.Name(), "--strict-hashes")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "did not match")
 
-	var target = "sdgkadga"
+	// a target with only one of the hashes only verifies without it
+	for target, missing := range map[string]string{"only256": "sha512", "only512": "sha256"} {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", target, "-i", tempFile.Name())
+		require.NoError(t, err)
+		_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", target, "-i", tempFile.Name(), "--strict-hashes")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no "+missing+" checksum")
+	}
+}
 
-	var output string
+// Targets whose hashes, recorded by other tooling, include SHA3 or BLAKE2b
+// checksums are verified against those checksums as well
+func TestClientVerifyOtherHashAlgorithms(t *testing.T) {
+	setUp(t)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	content := []byte("trusted content")
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	_, err = tempFile.Write(content)
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// init repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
 	require.NoError(t, err)
 
-	// publish repo
+	sha256Sum := sha256.Sum256(content)
+	sha3Sum := sha3.Sum256(content)
+	blake2bSum := blake2b.Sum512(content)
+	repo, err := client.NewFileCachedRepository(tempDir, "gun", server.URL, nil,
+		passphrase.ConstantRetriever(testPassphrase), trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	for name, hashes := range map[string]data.Hashes{
+		"sha3":     {notary.SHA256: sha256Sum[:], notary.SHA3_256: sha3Sum[:]},
+		"blake2b":  {notary.BLAKE2b512: blake2bSum[:]},
+		"tampered": {notary.SHA256: sha256Sum[:], notary.BLAKE2b512: make([]byte, len(blake2bSum))},
+	} {
+		require.NoError(t, repo.AddTarget(&client.Target{Name: name, Hashes: hashes, Length: int64(len(content))}))
+	}
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// list delegations - none yet
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, "No delegations present in this repository.")
+	for _, target := range []string{"sha3", "blake2b"} {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", target, "-i", tempFile.Name())
+		require.NoError(t, err, target)
+	}
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "tampered", "-i", tempFile.Name())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "blake2b-512 checksum for tampered did not match")
+}
 
-	// validate that we have all keys, including snapshot
-	assertNumKeys(t, tempDir, 1, 2, true)
+// Verifying an input file whose length doesn't match the target's fails on
+// the length, before the file is hashed
+func TestClientVerifyLength(t *testing.T) {
+	setUp(t)
 
-	// rotate the snapshot key to server
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", "snapshot", "-r")
-	require.NoError(t, err)
+	server := setupServer()
+	defer server.Close()
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	// validate that we lost the snapshot signing key
-	_, signingKeyIDs := assertNumKeys(t, tempDir, 1, 1, true)
-	targetKeyID := signingKeyIDs[0]
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+		return filename
+	}
+	trusted := writeFile("trusted", "trusted content")
+	sameLength := writeFile("samelength", "tampered content"[:len("trusted content")])
+	longer := writeFile("longer", "trusted content, and more")
+	empty := writeFile("empty", "")
 
-	// add new valid delegation with single new cert
-	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", tempFile.Name(), "--paths", "\"\"")
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "target", trusted)
 	require.NoError(t, err)
-	require.Contains(t, output, "Addition of delegation role")
-	require.Contains(t, output, canonicalKeyID)
-
-	// publish repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// list delegations - we should see our one delegation
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", trusted)
 	require.NoError(t, err)
-	require.NotContains(t, output, "No delegations present in this repository.")
 
-	// remove the targets key to demonstrate that delegates don't need this key
-	keyDir := filepath.Join(tempDir, notary.PrivDir)
-	require.NoError(t, os.Remove(filepath.Join(keyDir, targetKeyID+".key")))
+	for _, wrongLength := range []string{longer, empty} {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", wrongLength)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "length of "+wrongLength+" did not match")
+		require.Contains(t, err.Error(), fmt.Sprintf("expected %d bytes", len("trusted content")))
+	}
 
-	// Note that we need to use the canonical key ID, followed by the base of the role here
-	// Since, for a delegation- the filename is the canonical key ID. We have no role header in the PEM
-	err = ioutil.WriteFile(filepath.Join(keyDir, canonicalKeyID+".key"), privKeyBytesNoRole, 0700)
-	require.NoError(t, err)
+	// a file of the right length is still hashed
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", sameLength)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "length of")
+	require.Contains(t, err.Error(), "checksum")
 
-	// add a target using the delegation -- will only add to targets/releases
-	_, err = runCommand(t, tempDir, "add", "gun", target, tempTargetFile.Name(), "--roles", "targets/releases")
-	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "target", "-i", filepath.Join(tempDir, "missing"))
+	require.Error(t, err)
+}
 
-	// list targets for targets/releases - we should see no targets until we publish
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
-	require.NoError(t, err)
-	require.Contains(t, output, "No targets")
+// Publishing custom data to a server release which predates it is refused,
+// explaining that the changes are still staged
+func TestClientPublishToOlderServerVersion(t *testing.T) {
+	setUp(t)
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "status", "gun")
-	require.NoError(t, err)
+	server := setupServer()
+	defer server.Close()
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	tempDir := tempDirWithConfig(t, `{"remote_server": {"version": "0.5"}}`)
+	defer os.RemoveAll(tempDir)
 
-	// list targets for targets/releases - we should see our target!
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
-	require.NoError(t, err)
-	require.Contains(t, output, "targets/releases")
+	content := filepath.Join(tempDir, "content")
+	require.NoError(t, ioutil.WriteFile(content, []byte("content"), 0644))
+	custom := filepath.Join(tempDir, "custom.json")
+	require.NoError(t, ioutil.WriteFile(custom, []byte(`{"build": 1}`), 0644))
 
-	// remove the target for this role only
-	_, err = runCommand(t, tempDir, "remove", "gun", target, "--roles", "targets/releases")
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "target", content, "--custom", custom)
 	require.NoError(t, err)
 
-	// publish repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "refusing to publish targets with custom data on targets, which notary-server 0.5 does not support")
+	require.Contains(t, err.Error(), "the changes are still staged")
 
-	// list targets for targets/releases - we should see no targets
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	output, err := runCommand(t, tempDir, "status", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "No targets present")
+	require.Contains(t, output, "target")
+}
 
-	// Try adding a target with a different key style - private/tuf_keys/canonicalKeyID.key with "user" set as the "role" PEM header
-	// First remove the old key and add the new style
-	require.NoError(t, os.Remove(filepath.Join(keyDir, canonicalKeyID+".key")))
-	err = ioutil.WriteFile(filepath.Join(keyDir, canonicalKeyID+".key"), privKeyBytesWithRole, 0700)
-	require.NoError(t, err)
+// Verifying with --print-role reports the role that the target was published
+// to, whether that is the base targets role or a delegation
+func TestClientVerifyPrintRole(t *testing.T) {
+	setUp(t)
 
-	// add a target using the delegation -- will only add to targets/releases
-	_, err = runCommand(t, tempDir, "add", "gun", target, tempTargetFile.Name(), "--roles", "targets/releases")
-	require.NoError(t, err)
+	server := setupServer()
+	defer server.Close()
 
-	// list targets for targets/releases - we should see no targets until we publish
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	// Setup certificate and key for the delegation role
+	certFile, err := ioutil.TempFile("", "pemfile")
 	require.NoError(t, err)
-	require.Contains(t, output, "No targets")
+	cert, privKey, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = certFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	certFile.Close()
+	defer os.Remove(certFile.Name())
 
-	// publish repo
+	baseContent := filepath.Join(tempDir, "base")
+	require.NoError(t, ioutil.WriteFile(baseContent, []byte("base content"), 0644))
+	delegatedContent := filepath.Join(tempDir, "delegated")
+	require.NoError(t, ioutil.WriteFile(delegatedContent, []byte("delegated content"), 0644))
+	outFile := filepath.Join(tempDir, "out")
+
+	// publish one target to the base targets role, and another to a delegation
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", certFile.Name(), "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "basetarget", baseContent)
+	require.NoError(t, err)
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// list targets for targets/releases - we should see our target!
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	privKeyBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, "", "", "")
 	require.NoError(t, err)
-	require.Contains(t, output, "targets/releases")
-
-	// remove the target for this role only
-	_, err = runCommand(t, tempDir, "remove", "gun", target, "--roles", "targets/releases")
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(tempDir, notary.PrivDir, keyID+".key"), privKeyBytes, 0700))
+	_, err = runCommand(t, tempDir, "add", "gun", "delegatedtarget", delegatedContent, "--roles", "targets/releases")
 	require.NoError(t, err)
-
-	// publish repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// add a target using the delegation -- will only add to targets/releases
-	_, err = runCommand(t, tempDir, "add", "gun", target, tempTargetFile.Name(), "--roles", "targets/releases")
+	// lookup includes the role
+	output, err := runCommand(t, tempDir, "-s", server.URL, "lookup", "gun", "basetarget")
 	require.NoError(t, err)
+	require.Equal(t, data.CanonicalTargetsRole.String(), strings.Fields(output)[3])
+	output, err = runCommand(t, tempDir, "-s", server.URL, "lookup", "gun", "delegatedtarget")
+	require.NoError(t, err)
+	require.Equal(t, "targets/releases", strings.Fields(output)[3])
 
-	// list targets for targets/releases - we should see no targets until we publish
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	// the role is only reported when asked for
+	_, stderr, err := runCommandStdio(t, tempDir, "-s", server.URL, "verify", "gun", "basetarget", "-i", baseContent, "-o", outFile)
 	require.NoError(t, err)
-	require.Contains(t, output, "No targets")
+	require.NotContains(t, stderr, "authorized by")
 
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	_, stderr, err = runCommandStdio(t, tempDir, "-s", server.URL, "verify", "gun", "basetarget", "-i", baseContent, "-o", outFile, "--print-role")
 	require.NoError(t, err)
+	require.Equal(t, "basetarget authorized by role targets\n", stderr)
 
-	// list targets for targets/releases - we should see our target!
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	// the role is reported even when quiet
+	stdout, stderr, err := runCommandStdio(t, tempDir, "-s", server.URL, "verify", "gun", "delegatedtarget", "-i", delegatedContent, "-q", "--print-role")
 	require.NoError(t, err)
-	require.Contains(t, output, "targets/releases")
+	require.Empty(t, stdout)
+	require.Equal(t, "delegatedtarget authorized by role targets/releases\n", stderr)
 
-	// Setup another certificate
-	tempFile2, err := ioutil.TempFile("", "pemfile2")
+	// the role is kept out of the verified payload written to STDOUT
+	stdout, stderr, err = runCommandStdio(t, tempDir, "-s", server.URL, "verify", "gun", "delegatedtarget", "-i", delegatedContent, "--print-role")
 	require.NoError(t, err)
-	cert2, _, keyID2 := generateCertPrivKeyPair(t, "gun", data.RSAKey)
-	_, err = tempFile2.Write(utils.CertToPEM(cert2))
+	expected, err := ioutil.ReadFile(delegatedContent)
 	require.NoError(t, err)
-	tempFile2.Close()
-	defer os.Remove(tempFile2.Name())
+	require.Equal(t, string(expected), stdout)
+	require.Equal(t, "delegatedtarget authorized by role targets/releases\n", stderr)
 
-	// add a nested delegation under this releases role
-	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases/nested", tempFile2.Name(), "--paths", "nested/path")
+	// no role is reported if verification fails
+	_, stderr, err = runCommandStdio(t, tempDir, "-s", server.URL, "verify", "gun", "delegatedtarget", "-i", baseContent, "-q", "--print-role")
+	require.Error(t, err)
+	require.NotContains(t, stderr, "authorized by")
+}
+
+// Verifying with --output-role-chain records the root and every role from the
+// base targets role to the one that vouched for the target
+func TestClientVerifyOutputRoleChain(t *testing.T) {
+	setUp(t)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	// Setup certificate and key for the delegation roles
+	certFile, err := ioutil.TempFile("", "pemfile")
 	require.NoError(t, err)
-	require.Contains(t, output, "Addition of delegation role")
-	require.Contains(t, output, keyID2)
+	cert, privKey, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = certFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	certFile.Close()
+	defer os.Remove(certFile.Name())
 
-	// publish repo
+	baseContent := filepath.Join(tempDir, "base")
+	require.NoError(t, ioutil.WriteFile(baseContent, []byte("base content"), 0644))
+	delegatedContent := filepath.Join(tempDir, "delegated")
+	require.NoError(t, ioutil.WriteFile(delegatedContent, []byte("delegated content"), 0644))
+	outFile := filepath.Join(tempDir, "out")
+	chainFile := filepath.Join(tempDir, "chain.json")
+
+	// publish one target to the base targets role, and another to a nested
+	// delegation
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", certFile.Name(), "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "basetarget", baseContent)
+	require.NoError(t, err)
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// list delegations - we should see two roles
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	privKeyBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, "", "", "")
 	require.NoError(t, err)
-	require.Contains(t, output, "targets/releases")
-	require.Contains(t, output, "targets/releases/nested")
-	require.Contains(t, output, canonicalKeyID)
-	require.Contains(t, output, keyID2)
-	require.Contains(t, output, "nested/path")
-	require.Contains(t, output, "\"\"")
-	require.Contains(t, output, "<all paths>")
-
-	// remove by force to delete the nested delegation entirely
-	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/releases/nested", "-y")
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(tempDir, notary.PrivDir, keyID+".key"), privKeyBytes, 0700))
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases/stable", certFile.Name(), "--paths", "delegated")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "delegatedtarget", delegatedContent, "--roles", "targets/releases/stable")
 	require.NoError(t, err)
-	require.Contains(t, output, "Forced removal (including all keys and paths) of delegation role")
-
-	// publish repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
+	readChain := func() roleChain {
+		raw, err := ioutil.ReadFile(chainFile)
+		require.NoError(t, err)
+		var chain roleChain
+		require.NoError(t, json.Unmarshal(raw, &chain))
+		return chain
+	}
+	requireSignedByAll := func(link roleChainLink, role data.RoleName) {
+		require.Equal(t, role, link.Role)
+		require.Len(t, link.KeyIDs, 1)
+		require.Equal(t, 1, link.Threshold)
+		require.Equal(t, link.KeyIDs, link.SignedBy)
+	}
+
+	// a target in the base targets role is vouched for by it directly
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "basetarget", "-i", baseContent, "-o", outFile, "--output-role-chain", chainFile)
+	require.NoError(t, err)
+	chain := readChain()
+	require.Equal(t, data.GUN("gun"), chain.GUN)
+	require.Equal(t, "basetarget", chain.Target)
+	require.Equal(t, int64(len("base content")), chain.Length)
+	require.Equal(t, data.CanonicalTargetsRole, chain.VouchingRole)
+	requireSignedByAll(chain.Root, data.CanonicalRootRole)
+	require.Len(t, chain.Chain, 1)
+	requireSignedByAll(chain.Chain[0], data.CanonicalTargetsRole)
+	rootKeyIDs, targetsKeyIDs := chain.Root.KeyIDs, chain.Chain[0].KeyIDs
+
+	// the delegations trust the key of the certificate
+	certKeyID := utils.CertToKey(cert).ID()
+
+	// a delegated target is vouched for by the delegation, which is reached
+	// through the delegations it is nested in
+	require.NoError(t, os.Remove(chainFile))
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "delegatedtarget", "-i", delegatedContent, "-q", "--output-role-chain", chainFile)
+	require.NoError(t, err)
+	chain = readChain()
+	require.Equal(t, "delegatedtarget", chain.Target)
+	require.Equal(t, data.RoleName("targets/releases/stable"), chain.VouchingRole)
+	require.Equal(t, rootKeyIDs, chain.Root.KeyIDs)
+	require.Len(t, chain.Chain, 3)
+	requireSignedByAll(chain.Chain[0], data.CanonicalTargetsRole)
+	require.Equal(t, targetsKeyIDs, chain.Chain[0].KeyIDs)
+	require.Equal(t, data.RoleName("targets/releases"), chain.Chain[1].Role)
+	require.Equal(t, []string{certKeyID}, chain.Chain[1].KeyIDs)
+	require.Equal(t, []string{certKeyID}, chain.Chain[1].SignedBy)
+	require.Equal(t, []string{""}, chain.Chain[1].Paths)
+	require.Equal(t, data.RoleName("targets/releases/stable"), chain.Chain[2].Role)
+	require.Equal(t, []string{certKeyID}, chain.Chain[2].KeyIDs)
+	require.Equal(t, []string{certKeyID}, chain.Chain[2].SignedBy)
+	require.Equal(t, []string{"delegated"}, chain.Chain[2].Paths)
+
+	// no chain is written if verification fails
+	require.NoError(t, os.Remove(chainFile))
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "delegatedtarget", "-i", baseContent, "-q", "--output-role-chain", chainFile)
+	require.Error(t, err)
+	_, err = os.Stat(chainFile)
+	require.True(t, os.IsNotExist(err))
+
+	// nor can one be written for a manifest
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "--manifest", baseContent, "--output-role-chain", chainFile)
+	require.Error(t, err)
 }
 
-// Splits a string into lines, and returns any lines that are not empty (
-// striped of whitespace)
-func splitLines(chunk string) []string {
-	splitted := strings.Split(strings.TrimSpace(chunk), "\n")
-	var results []string
+// Trust data published as OCI artifacts can be read by configuring the remote
+// server as an OCI registry
+func TestClientListFromOCIRegistry(t *testing.T) {
+	setUp(t)
 
-	for _, line := range splitted {
-		line := strings.TrimSpace(line)
-		if line != "" {
-			results = append(results, line)
-		}
-	}
+	server := setupServer()
+	defer server.Close()
 
-	return results
-}
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-// List keys, parses the output, and returns the unique key IDs as an array
-// of root key IDs and an array of signing key IDs.  Output expected looks like:
-//     ROLE      GUN          KEY ID                   LOCATION
-// ----------------------------------------------------------------
-//   root               8bd63a896398b558ac...   file (.../private)
-//   snapshot   repo    e9e9425cd9a85fc7a5...   file (.../private)
-//   targets    repo    f5b84e2d92708c5acb...   file (.../private)
-func getUniqueKeys(t *testing.T, tempDir string) ([]string, []string) {
-	output, err := runCommand(t, tempDir, "key", "list")
+	tempFile, err := ioutil.TempFile("", "targetfile")
 	require.NoError(t, err)
-	lines := splitLines(output)
-	if len(lines) == 1 && lines[0] == "No signing keys found." {
-		return []string{}, []string{}
-	}
-	if len(lines) < 3 { // 2 lines of header, at least 1 line with keys
-		t.Logf("This output is not what is expected by the test:\n%s", output)
-	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	var (
-		rootMap    = make(map[string]bool)
-		nonrootMap = make(map[string]bool)
-		root       []string
-		nonroot    []string
-	)
-	// first two lines are header
-	for _, line := range lines[2:] {
-		parts := strings.Fields(line)
-		var (
-			placeToGo map[string]bool
-			keyID     string
-		)
-		if strings.TrimSpace(parts[0]) == data.CanonicalRootRole.String() {
-			// no gun, so there are only 3 fields
-			placeToGo, keyID = rootMap, parts[1]
-		} else {
-			// gun comes between role and key ID
-			if len(parts) == 3 {
-				// gun is empty as this may be a delegation key
-				placeToGo, keyID = nonrootMap, parts[1]
-			} else {
-				placeToGo, keyID = nonrootMap, parts[2]
-			}
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "ocitarget", tempFile.Name(), "-p")
+	require.NoError(t, err)
 
-		}
-		// keys are 32-chars long (32 byte shasum, hex-encoded)
-		require.Len(t, keyID, 64)
-		placeToGo[keyID] = true
-	}
-	for k := range rootMap {
-		root = append(root, k)
-	}
-	for k := range nonrootMap {
-		nonroot = append(nonroot, k)
+	// push the published metadata to a registry, under both its plain and its
+	// consistent names
+	registry := ocitestutils.NewFakeOCIRegistry()
+	ociServer := httptest.NewServer(registry)
+	defer ociServer.Close()
+	subject := registry.Tag("gun", nstorage.DefaultOCISubjectTag)
+	for _, role := range data.BaseRoles {
+		resp, err := http.Get(server.URL + "/v2/gun/_trust/tuf/" + role.String() + ".json")
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		checksum := sha256.Sum256(content)
+		registry.PushAll("gun", subject, map[string][]byte{
+			role.String(): content,
+			role.String() + "." + hex.EncodeToString(checksum[:]): content,
+		}, time.Now())
 	}
 
-	return root, nonroot
-}
+	ociDir := tempDirWithConfig(t, fmt.Sprintf(
+		`{"remote_server": {"type": "oci", "url": "%s"}}`, ociServer.URL))
+	defer os.RemoveAll(ociDir)
 
-// List keys, parses the output, and asserts something about the number of root
-// keys and number of signing keys, as well as returning them.
-func assertNumKeys(t *testing.T, tempDir string, numRoot, numSigning int,
-	rootOnDisk bool) ([]string, []string) {
+	output, err := runCommand(t, ociDir, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "ocitarget")
 
-	root, signing := getUniqueKeys(t, tempDir)
-	require.Len(t, root, numRoot)
-	require.Len(t, signing, numSigning)
-	for _, rootKeyID := range root {
-		_, err := os.Stat(filepath.Join(
-			tempDir, notary.PrivDir, rootKeyID+".key"))
-		// os.IsExist checks to see if the error is because a file already
-		// exists, and hence it isn't actually the right function to use here
-		require.Equal(t, rootOnDisk, !os.IsNotExist(err))
+	// the registry is read-only
+	_, err = runCommand(t, ociDir, "add", "gun", "other", tempFile.Name(), "-p")
+	require.Error(t, err)
 
-		// this function is declared is in the build-tagged setup files
-		verifyRootKeyOnHardware(t, rootKeyID)
-	}
-	return root, signing
+	// and unknown remote server types are rejected
+	badDir := tempDirWithConfig(t, `{"remote_server": {"type": "ftp"}}`)
+	defer os.RemoveAll(badDir)
+	_, err = runCommand(t, badDir, "list", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown remote_server.type")
 }
 
-// Adds the given target to the gun, publishes it, and lists it to ensure that
-// it appears.  Returns the listing output.
-func assertSuccessfullyPublish(
-	t *testing.T, tempDir, url, gun, target, fname string) string {
+// The server gc command reports orphaned metadata on a dry run, and only
+// removes it otherwise
+func TestClientServerGC(t *testing.T) {
+	setUp(t)
 
-	_, err := runCommand(t, tempDir, "add", gun, target, fname)
+	metaStore := storage.NewMemStorage()
+	server := httptest.NewServer(setupServerHandler(metaStore))
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
 
-	_, err = runCommand(t, tempDir, "-s", url, "publish", gun)
+	// nothing to collect from a freshly published repo
+	output, err := runCommand(t, tempDir, "-s", server.URL, "server", "gc")
 	require.NoError(t, err)
+	require.Contains(t, output, "Removed 0 orphaned metadata record(s)")
 
-	output, err := runCommand(t, tempDir, "-s", url, "list", gun)
+	// metadata for a delegation which the snapshot doesn't reference
+	orphan := []byte("orphaned delegation")
+	require.NoError(t, metaStore.UpdateCurrent("gun", storage.MetaUpdate{Role: "targets/gone", Version: 1, Data: orphan}))
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "server", "gc", "--dry-run")
+	require.NoError(t, err)
+	require.Contains(t, output, "Would remove 1 orphaned metadata record(s)")
+	require.Contains(t, output, "targets/gone")
+	_, _, err = metaStore.GetCurrent("gun", "targets/gone")
 	require.NoError(t, err)
-	require.Contains(t, output, target)
 
-	return output
+	output, err = runCommand(t, tempDir, "-s", server.URL, "server", "gc")
+	require.NoError(t, err)
+	require.Contains(t, output, "Removed 1 orphaned metadata record(s)")
+	_, _, err = metaStore.GetCurrent("gun", "targets/gone")
+	require.IsType(t, storage.ErrNotFound{}, err)
+
+	// the repo is still intact
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+
+	// arguments are not accepted
+	_, err = runCommand(t, tempDir, "-s", server.URL, "server", "gc", "gun")
+	require.Error(t, err)
 }
 
-// Tests root key generation and key rotation
-func TestClientKeyGenerationRotation(t *testing.T) {
-	// -- setup --
+// The server sizes command reports the size of each role of each GUN, and
+// the totals
+func TestClientServerSizes(t *testing.T) {
 	setUp(t)
 
+	metaStore := storage.NewMemStorage()
+	server := httptest.NewServer(setupServerHandler(metaStore))
+	defer server.Close()
+
 	tempDir := tempDirWithConfig(t, "{}")
 	defer os.RemoveAll(tempDir)
 
-	tempfiles := make([]string, 2)
-	for i := 0; i < 2; i++ {
-		tempFile, err := ioutil.TempFile("", "targetfile")
-		require.NoError(t, err)
-		tempFile.Close()
-		tempfiles[i] = tempFile.Name()
-		defer os.Remove(tempFile.Name())
-	}
+	output, err := runCommand(t, tempDir, "-s", server.URL, "server", "sizes")
+	require.NoError(t, err)
+	require.Contains(t, output, "No metadata present on the server.")
 
-	server := setupServer()
-	defer server.Close()
+	require.NoError(t, metaStore.UpdateMany("gun", []storage.MetaUpdate{
+		{Role: data.CanonicalRootRole, Version: 1, Data: []byte("root")},
+		{Role: data.CanonicalTargetsRole, Version: 1, Data: []byte("targets")},
+		{Role: data.CanonicalTargetsRole, Version: 2, Data: []byte("targets 2")},
+	}))
 
-	var target = "sdgkadga"
+	output, err = runCommand(t, tempDir, "-s", server.URL, "server", "sizes")
+	require.NoError(t, err)
+	require.Regexp(t, `gun\s+root\s+1\s+4\s+4\n`, output)
+	require.Regexp(t, `gun\s+targets\s+2\s+9\s+16\n`, output)
+	require.Regexp(t, `gun\s+\(all roles\)\s+13\s+20\n`, output)
+	require.Regexp(t, `\(all GUNs\)\s+13\s+20\n`, output)
 
-	// -- tests --
+	// arguments are not accepted
+	_, err = runCommand(t, tempDir, "-s", server.URL, "server", "sizes", "gun")
+	require.Error(t, err)
+}
 
-	// starts out with no keys
-	assertNumKeys(t, tempDir, 0, 0, true)
+// The server metrics snapshot command prints the server's operational metrics
+// as JSON
+func TestClientServerMetricsSnapshot(t *testing.T) {
+	setUp(t)
 
-	// generate root key produces a single root key and no other keys
-	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey)
+	server := httptest.NewServer(setupServerHandler(storage.NewMeteredMetaStore(storage.NewMemStorage())))
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-	assertNumKeys(t, tempDir, 1, 0, true)
 
-	// initialize a repo, should have signing keys and no new root key
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	output, err := runCommand(t, tempDir, "-s", server.URL, "server", "metrics", "snapshot")
 	require.NoError(t, err)
-	origRoot, origSign := assertNumKeys(t, tempDir, 1, 2, true)
+	var snapshot handlers.MetricsSnapshot
+	require.NoError(t, json.Unmarshal([]byte(output), &snapshot))
+	require.True(t, snapshot.ActiveGUNs >= 1)
 
-	// publish using the original keys
-	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", target, tempfiles[0])
+	operations := make(map[string]handlers.RequestStats)
+	for _, stats := range snapshot.Requests {
+		operations[stats.Operation] = stats
+	}
+	require.Contains(t, operations, "UpdateTUF")
+	require.True(t, operations["UpdateTUF"].Count >= 1)
+	require.NotEmpty(t, snapshot.Storage)
 
-	// rotate the signing keys
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalSnapshotRole.String())
+	// arguments are not accepted
+	_, err = runCommand(t, tempDir, "-s", server.URL, "server", "metrics", "snapshot", "extra")
+	require.Error(t, err)
+}
+
+// The server reindex command reports how the changefeed would be rebuilt on a
+// dry run, and only rebuilds it otherwise
+func TestClientServerReindex(t *testing.T) {
+	setUp(t)
+
+	metaStore := storage.NewMemStorage()
+	server := httptest.NewServer(setupServerHandler(metaStore))
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String())
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "server", "reindex")
 	require.NoError(t, err)
-	root, sign := assertNumKeys(t, tempDir, 1, 2, true)
-	require.Equal(t, origRoot[0], root[0])
+	require.Contains(t, output, "Reindexed changefeed of 1 change(s): 0 renumbered, 0 added, 0 duplicate(s) removed")
 
-	// just do a cursory rotation check that the keys aren't equal anymore
-	for _, origKey := range origSign {
-		for _, key := range sign {
-			require.NotEqual(
-				t, key, origKey, "One of the signing keys was not removed")
-		}
-	}
+	// a consistent changefeed, including a deletion, is left as it is
+	require.NoError(t, metaStore.UpdateMany("other", []storage.MetaUpdate{{Role: data.CanonicalTimestampRole, Version: 1, Data: []byte("1")}}))
+	require.NoError(t, metaStore.Delete("gun"))
+	changes, err := metaStore.GetChanges("0", 10, "")
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
 
-	// publish using the new keys
-	output := assertSuccessfullyPublish(
-		t, tempDir, server.URL, "gun", target+"2", tempfiles[1])
-	// assert that the previous target is still there
-	require.True(t, strings.Contains(string(output), target))
+	output, err = runCommand(t, tempDir, "-s", server.URL, "server", "reindex", "--dry-run")
+	require.NoError(t, err)
+	require.Contains(t, output, "Would reindex changefeed of 3 change(s): 0 renumbered, 0 added, 0 duplicate(s) removed")
+	reindexed, err := metaStore.GetChanges("0", 10, "")
+	require.NoError(t, err)
+	require.Equal(t, changes, reindexed)
 
-	// rotate the snapshot and timestamp keys on the server, multiple times
-	for i := 0; i < 10; i++ {
-		_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalSnapshotRole.String(), "-r")
-		require.NoError(t, err)
-		_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTimestampRole.String(), "-r")
-		require.NoError(t, err)
-	}
+	// arguments are not accepted
+	_, err = runCommand(t, tempDir, "-s", server.URL, "server", "reindex", "gun")
+	require.Error(t, err)
 }
 
-// Tests key rotation
-func TestKeyRotation(t *testing.T) {
-	// -- setup --
+// All of a server's metadata can be exported, and imported into another server
+// from which the repository can then be read
+// Tests that the server's effective configuration is printed, with the
+// secrets the server redacted left redacted
+func TestClientServerConfigDump(t *testing.T) {
 	setUp(t)
 
+	// without any configuration to serve, the server returns an error
+	ts := setupServer()
 	tempDir := tempDirWithConfig(t, "{}")
 	defer os.RemoveAll(tempDir)
+	_, err := runCommand(t, tempDir, "-s", ts.URL, "server", "config", "dump")
+	require.Error(t, err)
+	ts.Close()
 
-	tempfiles := make([]string, 2)
-	for i := 0; i < 2; i++ {
-		tempFile, err := ioutil.TempFile("", "targetfile")
-		require.NoError(t, err)
-		tempFile.Close()
-		tempfiles[i] = tempFile.Name()
-		defer os.Remove(tempFile.Name())
-	}
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, storage.NewMemStorage())
+	ctx = context.WithValue(ctx, notary.CtxKeyServerConfig, map[string]interface{}{
+		"storage": map[string]interface{}{"backend": "mysql", "password": "hunter2"},
+	})
+	cryptoService := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("pass")))
+	ts = httptest.NewServer(server.RootHandler(ctx, nil, cryptoService, nil, nil, nil))
+	defer ts.Close()
 
-	server := setupServer()
-	defer server.Close()
+	output, err := runCommand(t, tempDir, "-s", ts.URL, "server", "config", "dump")
+	require.NoError(t, err)
+	require.NotContains(t, output, "hunter2")
+	var config map[string]map[string]string
+	require.NoError(t, json.Unmarshal([]byte(output), &config))
+	require.Equal(t, "mysql", config["storage"]["backend"])
+	require.Equal(t, "xxxxx", config["storage"]["password"])
 
-	var target = "sdgkadga"
+	_, err = runCommand(t, tempDir, "-s", ts.URL, "server", "config", "dump", "extra")
+	require.Error(t, err)
+}
 
-	// -- tests --
+func TestClientServerExportDB(t *testing.T) {
+	setUp(t)
 
-	// starts out with no keys
-	assertNumKeys(t, tempDir, 0, 0, true)
+	fromStore := storage.NewMemStorage()
+	fromServer := httptest.NewServer(setupServerHandler(fromStore))
+	defer fromServer.Close()
+	toStore := storage.NewMemStorage()
+	toServer := httptest.NewServer(setupServerHandler(toStore))
+	defer toServer.Close()
 
-	// generate root key produces a single root key and no other keys
-	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey)
-	require.NoError(t, err)
-	assertNumKeys(t, tempDir, 1, 0, true)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	// initialize a repo, should have signing keys and no new root key
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	tempFile, err := ioutil.TempFile("", "targetfile")
 	require.NoError(t, err)
-	assertNumKeys(t, tempDir, 1, 2, true)
-
-	// publish using the original keys
-	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", target, tempfiles[0])
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// invalid keys
-	badKeyFile, err := ioutil.TempFile("", "badKey")
+	_, err = runCommand(t, tempDir, "-s", fromServer.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-	defer os.Remove(badKeyFile.Name())
-	_, err = badKeyFile.Write([]byte{0, 0, 0, 0})
+	_, err = runCommand(t, tempDir, "-s", fromServer.URL, "add", "gun", "exported", tempFile.Name(), "-p")
 	require.NoError(t, err)
-	badKeyFile.Close()
-
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String(), "--key", "123")
-	require.Error(t, err)
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String(), "--key", badKeyFile.Name())
-	require.Error(t, err)
 
-	// create encrypted root keys
-	rootPrivKey1, err := utils.GenerateECDSAKey(rand.Reader)
+	exportFile := filepath.Join(tempDir, "export.json")
+	output, err := runCommand(t, tempDir, "-s", fromServer.URL, "server", "export-db", "-o", exportFile)
 	require.NoError(t, err)
-	encryptedPEMPrivKey1, err := utils.ConvertPrivateKeyToPKCS8(rootPrivKey1, data.CanonicalRootRole, "", testPassphrase)
-	require.NoError(t, err)
-	encryptedPEMKeyFilename1 := filepath.Join(tempDir, "encrypted_key.key")
-	err = ioutil.WriteFile(encryptedPEMKeyFilename1, encryptedPEMPrivKey1, 0644)
+	expected, err := storage.ExportMeta(fromStore, ioutil.Discard)
 	require.NoError(t, err)
+	require.Contains(t, output, fmt.Sprintf("Exported %d metadata record(s)", expected))
 
-	rootPrivKey2, err := utils.GenerateECDSAKey(rand.Reader)
+	// the export can be imported into another server's storage offline
+	f, err := os.Open(exportFile)
 	require.NoError(t, err)
-	encryptedPEMPrivKey2, err := utils.ConvertPrivateKeyToPKCS8(rootPrivKey2, data.CanonicalRootRole, "", testPassphrase)
+	imported, err := storage.ImportMeta(toStore, f)
+	f.Close()
 	require.NoError(t, err)
-	encryptedPEMKeyFilename2 := filepath.Join(tempDir, "encrypted_key2.key")
-	err = ioutil.WriteFile(encryptedPEMKeyFilename2, encryptedPEMPrivKey2, 0644)
+	require.Equal(t, expected, imported)
+
+	// every version is the same on both servers
+	var fromExport, toExport bytes.Buffer
+	_, err = storage.ExportMeta(fromStore, &fromExport)
+	require.NoError(t, err)
+	_, err = storage.ExportMeta(toStore, &toExport)
 	require.NoError(t, err)
+	require.Equal(t, fromExport.String(), toExport.String())
 
-	// rotate the root key
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String(), "--key", encryptedPEMKeyFilename1, "--key", encryptedPEMKeyFilename2)
+	// and a fresh client can read the repository from the new server
+	freshDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(freshDir)
+	output, err = runCommand(t, freshDir, "-s", toServer.URL, "list", "gun")
 	require.NoError(t, err)
-	// 3 root keys - 1 prev, 1 new
-	assertNumKeys(t, tempDir, 3, 2, true)
+	require.Contains(t, output, "exported")
 
-	// rotate the root key again
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String())
+	// the pretty-printed export is labelled, and its metadata compacts back
+	// to exactly the signed bytes, but it cannot be imported
+	prettyFile := filepath.Join(tempDir, "export-pretty.json")
+	_, err = runCommand(t, tempDir, "-s", fromServer.URL, "server", "export-db", "--pretty", "-o", prettyFile)
 	require.NoError(t, err)
-	// 3 root keys, 2 prev, 1 new
-	assertNumKeys(t, tempDir, 3, 2, true)
+	prettyExport, err := ioutil.ReadFile(prettyFile)
+	require.NoError(t, err)
+	exported := json.NewDecoder(&fromExport)
+	pretty := json.NewDecoder(bytes.NewReader(prettyExport))
+	for i := 0; i < expected; i++ {
+		var meta storage.ExportedMeta
+		require.NoError(t, exported.Decode(&meta))
+		var record prettyMeta
+		require.NoError(t, pretty.Decode(&record))
+		require.Equal(t, prettyNotice, record.Notice)
+		require.Equal(t, meta.Record, record.Record)
+		require.NotEqual(t, meta.Data, []byte(record.Metadata))
+		var compacted bytes.Buffer
+		require.NoError(t, json.Compact(&compacted, record.Metadata))
+		require.Equal(t, meta.Data, compacted.Bytes())
+	}
+	require.False(t, pretty.More())
+	_, err = storage.ImportMeta(storage.NewMemStorage(), bytes.NewReader(prettyExport))
+	require.Error(t, err)
 
-	// publish using the new keys
-	output := assertSuccessfullyPublish(
-		t, tempDir, server.URL, "gun", target+"2", tempfiles[1])
-	// assert that the previous target is still there
-	require.True(t, strings.Contains(string(output), target))
+	_, err = runCommand(t, tempDir, "-s", toServer.URL, "server", "export-db", "gun")
+	require.Error(t, err)
 }
 
-// Tests rotating non-root keys
-func TestKeyRotationNonRoot(t *testing.T) {
-	// -- setup --
+// Initialize repo and test delegations commands by adding, listing, and removing delegations
+func TestClientDelegationsInteraction(t *testing.T) {
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
 	defer os.RemoveAll(tempDir)
 
-	tempfiles := make([]string, 2)
-	for i := 0; i < 2; i++ {
-		tempFile, err := ioutil.TempFile("", "targetfile")
-		require.NoError(t, err)
-		tempFile.Close()
-		tempfiles[i] = tempFile.Name()
-		defer os.Remove(tempFile.Name())
-	}
-
 	server := setupServer()
 	defer server.Close()
 
-	var target = "sdgkadgad"
+	// Setup certificate
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	var output string
 
 	// -- tests --
 
-	// starts out with no keys
-	assertNumKeys(t, tempDir, 0, 0, true)
+	// init repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
 
-	// generate root key produces a single root key and no other keys
-	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey)
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
-	assertNumKeys(t, tempDir, 1, 0, true)
 
-	// initialize a repo, should have signing keys and no new root key
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	// list delegations - none yet
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	assertNumKeys(t, tempDir, 1, 2, true)
+	require.Contains(t, output, "No delegations present in this repository.")
 
-	// publish using the original keys
-	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", target, tempfiles[0])
+	// add new valid delegation with single new cert, and no path
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name())
+	require.NoError(t, err)
+	require.Contains(t, output, "Addition of delegation role")
+	require.Contains(t, output, keyID)
+	require.NotContains(t, output, "path")
 
-	// create new target keys
-	tempFile, err := ioutil.TempFile("", "pemfile")
+	// check status - see delegation
+	output, err = runCommand(t, tempDir, "status", "gun")
 	require.NoError(t, err)
-	defer os.Remove(tempFile.Name())
+	require.Contains(t, output, "Unpublished changes for gun")
 
-	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	// list delegations - none yet because still unpublished
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "No delegations present in this repository.")
 
-	pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalTargetsRole, "", testPassphrase)
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	nBytes, err := tempFile.Write(pemBytes)
+	// check status - no changelist
+	output, err = runCommand(t, tempDir, "status", "gun")
 	require.NoError(t, err)
-	tempFile.Close()
-	require.Equal(t, len(pemBytes), nBytes)
+	require.Contains(t, output, "No unpublished changes for gun")
+
+	// list delegations - we should see our added delegation, with no paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/delegation")
+	require.Contains(t, output, keyID)
+	require.NotContains(t, output, "\"\"")
+
+	// add all paths to this delegation
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--all-paths")
+	require.NoError(t, err)
+	require.Contains(t, output, "Addition of delegation role")
+	require.Contains(t, output, "\"\"")
+	require.Contains(t, output, "<all paths>")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see our added delegation, with no paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/delegation")
+	require.Contains(t, output, "\"\"")
+	require.Contains(t, output, "<all paths>")
 
+	// Setup another certificate
 	tempFile2, err := ioutil.TempFile("", "pemfile2")
 	require.NoError(t, err)
+
+	cert2, _, keyID2 := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile2.Write(utils.CertToPEM(cert2))
+	require.NoError(t, err)
+	tempFile2.Close()
 	defer os.Remove(tempFile2.Name())
 
-	privKey2, err := utils.GenerateECDSAKey(rand.Reader)
+	// add to the delegation by specifying the same role, this time add a scoped path
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile2.Name(), "--paths", "path")
 	require.NoError(t, err)
+	require.Contains(t, output, "Addition of delegation role")
+	require.Contains(t, output, keyID2)
 
-	pemBytes2, err := utils.ConvertPrivateKeyToPKCS8(privKey2, data.CanonicalTargetsRole, "", "")
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	nBytes2, err := tempFile2.Write(pemBytes2)
+	// list delegations - we should see two keys
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	tempFile2.Close()
-	require.Equal(t, len(pemBytes2), nBytes2)
+	require.Contains(t, output, "path")
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, keyID2)
 
-	// rotate the targets key
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String(), "--key", tempFile.Name(), "--key", tempFile2.Name())
+	// remove the delegation's first key
+	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", keyID)
 	require.NoError(t, err)
+	require.Contains(t, output, "Removal of delegation role")
 
-	// publish using the new keys
-	output := assertSuccessfullyPublish(
-		t, tempDir, server.URL, "gun", target+"2", tempfiles[1])
-	// assert that the previous target is still there
-	require.True(t, strings.Contains(string(output), target))
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
 
-	// rotate to nonexistant key
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String(), "--key", "nope.pem")
-	require.Error(t, err)
-}
+	// list delegations - we should see the delegation but with only the second key
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, keyID)
+	require.Contains(t, output, keyID2)
 
-// Tests default root key generation
-func TestDefaultRootKeyGeneration(t *testing.T) {
-	// -- setup --
-	setUp(t)
+	// remove the delegation's second key
+	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", keyID2)
+	require.NoError(t, err)
+	require.Contains(t, output, "Removal of delegation role")
 
-	tempDir := tempDirWithConfig(t, "{}")
-	defer os.RemoveAll(tempDir)
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
 
-	// -- tests --
+	// list delegations - we should see no delegations
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, keyID)
+	require.NotContains(t, output, keyID2)
 
-	// starts out with no keys
-	assertNumKeys(t, tempDir, 0, 0, true)
+	// add delegation with multiple certs and multiple paths
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), tempFile2.Name(), "--paths", "path1,path2")
+	require.NoError(t, err)
+	require.Contains(t, output, "Addition of delegation role")
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, keyID2)
 
-	// generate root key with no algorithm produces a single ECDSA root key and no other keys
-	_, err := runCommand(t, tempDir, "key", "generate")
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
-	assertNumKeys(t, tempDir, 1, 0, true)
-}
 
-// Tests the interaction with the verbose and log-level flags
-func TestLogLevelFlags(t *testing.T) {
-	// Test default to fatal
-	n := notaryCommander{}
-	n.setVerbosityLevel()
-	require.Equal(t, "warning", logrus.GetLevel().String())
+	// list delegations - we should see two keys
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "path1")
+	require.Contains(t, output, "path2")
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, keyID2)
 
-	// Test that verbose (-v) sets to error
-	n.verbose = true
-	n.setVerbosityLevel()
-	require.Equal(t, "info", logrus.GetLevel().String())
+	// add delegation with multiple certs and multiple paths
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "path3")
+	require.NoError(t, err)
+	require.Contains(t, output, "Addition of delegation role")
 
-	// Test that debug (-D) sets to debug
-	n.debug = true
-	n.setVerbosityLevel()
-	require.Equal(t, "debug", logrus.GetLevel().String())
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
 
-	// Test that unsetting verboseError still uses verboseDebug
-	n.verbose = false
-	n.setVerbosityLevel()
-	require.Equal(t, "debug", logrus.GetLevel().String())
+	// list delegations - we should see two keys
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "path1")
+	require.Contains(t, output, "path2")
+	require.Contains(t, output, "path3")
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, keyID2)
+
+	// just remove two paths from this delegation
+	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "path2,path3")
+	require.NoError(t, err)
+	require.Contains(t, output, "Removal of delegation role")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see the same two keys, and only path1
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "path1")
+	require.NotContains(t, output, "path2")
+	require.NotContains(t, output, "path3")
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, keyID2)
+
+	// remove the remaining path, should not remove the delegation entirely
+	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "path1")
+	require.NoError(t, err)
+	require.Contains(t, output, "Removal of delegation role")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see the same two keys, and no paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "path1")
+	require.NotContains(t, output, "path2")
+	require.NotContains(t, output, "path3")
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, keyID2)
+
+	// Add a bunch of individual paths so we can test a delegation remove --all-paths
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "abcdef,123456")
+	require.NoError(t, err)
+
+	// Add more individual paths so we can test a delegation remove --all-paths
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "banana/split,apple/crumble/pie,orange.peel,kiwi")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see all of our paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "abcdef")
+	require.Contains(t, output, "123456")
+	require.Contains(t, output, "banana/split")
+	require.Contains(t, output, "apple/crumble/pie")
+	require.Contains(t, output, "orange.peel")
+	require.Contains(t, output, "kiwi")
+
+	// Try adding "", and check that adding it with other paths clears out the others
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "\"\",grapefruit,pomegranate")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see all of our old paths, and ""
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "abcdef")
+	require.Contains(t, output, "123456")
+	require.Contains(t, output, "banana/split")
+	require.Contains(t, output, "apple/crumble/pie")
+	require.Contains(t, output, "orange.peel")
+	require.Contains(t, output, "kiwi")
+	require.Contains(t, output, "\"\"")
+	require.NotContains(t, output, "grapefruit")
+	require.NotContains(t, output, "pomegranate")
+
+	// Try removing just ""
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "\"\"")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see all of our old paths without ""
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "abcdef")
+	require.Contains(t, output, "123456")
+	require.Contains(t, output, "banana/split")
+	require.Contains(t, output, "apple/crumble/pie")
+	require.Contains(t, output, "orange.peel")
+	require.Contains(t, output, "kiwi")
+	require.NotContains(t, output, "\"\"")
+
+	// Remove --all-paths to clear out all paths from this delegation
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see all of our paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "abcdef")
+	require.NotContains(t, output, "123456")
+	require.NotContains(t, output, "banana/split")
+	require.NotContains(t, output, "apple/crumble/pie")
+	require.NotContains(t, output, "orange.peel")
+	require.NotContains(t, output, "kiwi")
+
+	// Check that we ignore other --paths if we pass in --all-paths on an add
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--all-paths", "--paths", "grapefruit,pomegranate")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should only see "", and not the other paths specified
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "\"\"")
+	require.NotContains(t, output, "grapefruit")
+	require.NotContains(t, output, "pomegranate")
+
+	// Add those extra paths we ignored to set up the next test
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "grapefruit,pomegranate")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// Check that we ignore other --paths if we pass in --all-paths on a remove
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths", "--paths", "pomegranate")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see no paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "\"\"")
+	require.NotContains(t, output, "grapefruit")
+	require.NotContains(t, output, "pomegranate")
+
+	// remove by force to delete the delegation entirely
+	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "-y")
+	require.NoError(t, err)
+	require.Contains(t, output, "Forced removal (including all keys and paths) of delegation role")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see no delegations
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No delegations present in this repository.")
+}
+
+// Tests that verify-keys reports on each key of a delegation, and fails if
+// any of them is backed by a certificate which has expired
+func TestClientDelegationVerifyKeys(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	validCert, _, validKeyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	_, err = tempFile.Write(utils.CertToPEM(validCert))
+	require.NoError(t, err)
+	tempFile.Close()
+	validFile := tempFile.Name()
+	defer os.Remove(validFile)
+
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	startTime := time.Now().AddDate(-2, 0, 0)
+	expiredCert, err := cryptoservice.GenerateCertificate(privKey, "gun", startTime, startTime.AddDate(1, 0, 0))
+	require.NoError(t, err)
+	expiredKeyID, err := utils.CanonicalKeyID(utils.CertToKey(expiredCert))
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", validFile, "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// every key is valid
+	output, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "verify-keys", "gun", "targets/delegation")
+	require.NoError(t, err)
+	require.Contains(t, output, validKeyID)
+	require.Contains(t, output, data.ECDSAx509Key)
+	require.Contains(t, output, validCert.NotAfter.UTC().Format(time.RFC3339))
+	require.Contains(t, output, "valid")
+
+	// certificates can't be added on the command line once they have expired,
+	// so add the expired one through the library
+	repo, err := client.NewFileCachedRepository(tempDir, "gun", server.URL, nil,
+		passphrase.ConstantRetriever(testPassphrase), trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	require.NoError(t, repo.AddDelegationRoleAndKeys("targets/delegation", []data.PublicKey{utils.CertToKey(expiredCert)}))
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "verify-keys", "gun", "targets/delegation")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 of the 2 keys of delegation targets/delegation are not valid")
+	var validLine, expiredLine string
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, validKeyID):
+			validLine = line
+		case strings.HasPrefix(line, expiredKeyID):
+			expiredLine = line
+		}
+	}
+	require.True(t, strings.HasSuffix(strings.TrimSpace(validLine), "valid"), validLine)
+	require.Contains(t, expiredLine, expiredCert.NotBefore.UTC().Format(time.RFC3339))
+	require.Contains(t, expiredLine, expiredCert.NotAfter.UTC().Format(time.RFC3339))
+	require.Contains(t, expiredLine, "certificate expired")
+
+	// the delegation must exist
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "verify-keys", "gun", "targets/missing")
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "verify-keys", "gun")
+	require.Error(t, err)
+}
+
+// A nested delegation can be added with the published paths of its parent
+// delegation, which must exist
+func TestClientDelegationAddInheritPaths(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, privKey, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+
+	// the same key signs every delegation, so that each can delegate further
+	privKeyBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, "", "", "")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(tempDir, notary.PrivDir, keyID+".key"), privKeyBytes, 0700))
+
+	// the parent must exist on the server
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/a/b", tempFile.Name(), "--inherit-paths")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "targets/a does not exist")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/a", tempFile.Name(), "--paths", "apps/,libs/", "-p")
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/a/b", tempFile.Name(), "--inherit-paths", "-p")
+	require.NoError(t, err)
+	require.Contains(t, output, "apps/")
+	require.Contains(t, output, "libs/")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/a/b", "--paths-only")
+	require.NoError(t, err)
+	require.Regexp(t, "targets/a/b +apps/\\n +libs/\\n", output)
+
+	// once the parent no longer has a path, a grandchild doesn't inherit it
+	// from the child
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "remove", "gun", "targets/a", "--paths", "libs/", "-p")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/a/b/c", tempFile.Name(), "--inherit-paths")
+	require.NoError(t, err)
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, "apps/")
+	require.NotContains(t, output, "libs/")
+}
+
+// The configured signature algorithms are honored both when publishing and when
+// reading the published metadata
+func TestClientSignatureAlgorithms(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+	setAlgorithms := func(algorithms string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "config.json"),
+			[]byte(fmt.Sprintf(`{"signature_algorithms": %s}`, algorithms)), 0644))
+	}
+
+	server := setupServer()
+	defer server.Close()
+
+	const target = "sdgkadga"
+
+	// new keys are ECDSA keys, so the targets can't be signed with EdDSA
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", target, tempDir+"/config.json")
+	require.NoError(t, err)
+	setAlgorithms(`{"targets": "eddsa"}`)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not enough signing keys sign with eddsa, as required for targets")
+
+	setAlgorithms(`{"root": "ecdsa", "targets": "ecdsa"}`)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	output, err := runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, target)
+
+	setAlgorithms(`{"targets": "eddsa"}`)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "valid signatures with eddsa, as required for targets, did not meet threshold")
+}
+
+// Adding to an existing delegation accumulates its keys and paths, whereas
+// --replace leaves it with exactly the keys and paths given
+func TestClientDelegationAddReplace(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	keyIDs := []string{}
+	certFiles := []string{}
+	for i := 0; i < 2; i++ {
+		tempFile, err := ioutil.TempFile("", "pemfile")
+		require.NoError(t, err)
+		cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+		_, err = tempFile.Write(utils.CertToPEM(cert))
+		require.NoError(t, err)
+		tempFile.Close()
+		defer os.Remove(tempFile.Name())
+		keyIDs = append(keyIDs, keyID)
+		certFiles = append(certFiles, tempFile.Name())
+	}
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/releases", certFiles[0], "--paths", "a/", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/releases", certFiles[1], "--paths", "b/", "-p")
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, keyIDs[0])
+	require.Contains(t, output, keyIDs[1])
+	require.Contains(t, output, "a/")
+	require.Contains(t, output, "b/")
+
+	// there must be keys to replace the delegation's keys with
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/releases", "--paths", "c/", "--replace")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--replace requires at least one key")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/releases", certFiles[1], "--paths", "c/", "--replace", "-p")
+	require.NoError(t, err)
+	require.Contains(t, output, "Replacement of the keys and paths of delegation role targets/releases")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/releases")
+	require.NoError(t, err)
+	require.NotContains(t, output, keyIDs[0])
+	require.Contains(t, output, keyIDs[1])
+	require.NotContains(t, output, "a/")
+	require.NotContains(t, output, "b/")
+	require.Contains(t, output, "c/")
+}
+
+// When paths are required, either by flag or by config, a delegation can only be
+// given all paths if --allow-all-paths is passed
+func TestClientDelegationsRequirePath(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, `{"delegations": {"require_path": true}}`)
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	// all paths, given either way, are rejected by default
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), "--all-paths")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--allow-all-paths")
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), "--paths", "path,")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--allow-all-paths")
+
+	output, err := runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
+
+	// specific paths are fine
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), "--paths", "path")
+	require.NoError(t, err)
+
+	// and all paths are allowed with the override
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--all-paths", "--allow-all-paths")
+	require.NoError(t, err)
+	require.Contains(t, output, "<all paths>")
+
+	// the policy can also be asked for with a flag
+	tempDir2 := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir2)
+	_, err = runCommand(t, tempDir2, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir2, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), "--all-paths", "--require-path")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--allow-all-paths")
+	_, err = runCommand(t, tempDir2, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), "--all-paths")
+	require.NoError(t, err)
+}
+
+// The threshold of a published delegation can be raised and lowered, but not
+// beyond the number of keys it has
+func TestClientDelegationsSetThreshold(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	var certFiles []string
+	for i := 0; i < 2; i++ {
+		tempFile, err := ioutil.TempFile("", "pemfile")
+		require.NoError(t, err)
+		cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+		_, err = tempFile.Write(utils.CertToPEM(cert))
+		require.NoError(t, err)
+		tempFile.Close()
+		defer os.Remove(tempFile.Name())
+		certFiles = append(certFiles, tempFile.Name())
+	}
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", certFiles[0], certFiles[1], "--all-paths", "-s", server.URL, "-p")
+	require.NoError(t, err)
+
+	thresholdRow := func(threshold int) string {
+		return fmt.Sprintf(`(?m)^\s*targets/delegation\s.*\s%d\s*$`, threshold)
+	}
+	output, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Regexp(t, thresholdRow(1), output)
+
+	// raise the threshold to the number of keys
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "set-threshold", "gun", "targets/delegation", "2")
+	require.NoError(t, err)
+	require.Contains(t, output, "set to 2")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Regexp(t, thresholdRow(2), output)
+
+	// a threshold beyond the number of keys, or below 1, is refused
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "set-threshold", "gun", "targets/delegation", "3")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "more than the 2 key(s)")
+	for _, invalid := range []string{"0", "-1", "two"} {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "set-threshold", "gun", "targets/delegation", invalid)
+		require.Error(t, err, invalid)
+	}
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "set-threshold", "gun", "targets", "1")
+	require.Error(t, err)
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
+
+	// and lower it again, publishing straight away
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "set-threshold", "gun", "targets/delegation", "1", "-p")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Regexp(t, thresholdRow(1), output)
+}
+
+// Detached signatures over a file are checked against the keys and threshold
+// of a delegation role
+func TestClientVerifySignature(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	dataFile := filepath.Join(tempDir, "release.txt")
+	require.NoError(t, ioutil.WriteFile(dataFile, []byte("release notes"), 0644))
+
+	var certFiles []string
+	var sigs []data.Signature
+	for i := 0; i < 3; i++ {
+		cert, privKey, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+		certFile := filepath.Join(tempDir, fmt.Sprintf("cert%d.pem", i))
+		require.NoError(t, ioutil.WriteFile(certFile, utils.CertToPEM(cert), 0644))
+		certFiles = append(certFiles, certFile)
+
+		sig, err := privKey.Sign(rand.Reader, []byte("release notes"), nil)
+		require.NoError(t, err)
+		sigs = append(sigs, data.Signature{KeyID: privKey.ID(), Method: privKey.SignatureAlgorithm(), Signature: sig})
+	}
+	writeSigs := func(sigs ...data.Signature) string {
+		serialized, err := json.Marshal(sigs)
+		require.NoError(t, err)
+		sigFile := filepath.Join(tempDir, "release.sig")
+		require.NoError(t, ioutil.WriteFile(sigFile, serialized, 0644))
+		return sigFile
+	}
+	verify := func(role string, sigFile string) (string, error) {
+		return runCommand(t, tempDir, "-s", server.URL, "verify-signature", "gun", role, "--data", dataFile, "--sig", sigFile)
+	}
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/single", certFiles[0], "--all-paths", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/multi", certFiles[1], certFiles[2], "--all-paths", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "set-threshold", "gun", "targets/multi", "2", "-p")
+	require.NoError(t, err)
+
+	// a single signature, not in an array, for a single-key role
+	singleSig, err := json.Marshal(sigs[0])
+	require.NoError(t, err)
+	sigFile := filepath.Join(tempDir, "single.sig")
+	require.NoError(t, ioutil.WriteFile(sigFile, singleSig, 0644))
+	output, err := verify("targets/single", sigFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "is valid for targets/single")
+
+	// signatures by keys outside the role, or over other data, are not valid
+	_, err = verify("targets/single", writeSigs(sigs[1]))
+	require.Error(t, err)
+	corrupted := sigs[0]
+	corrupted.Signature = append([]byte{}, corrupted.Signature...)
+	corrupted.Signature[len(corrupted.Signature)-1] ^= 0xff
+	_, err = verify("targets/single", writeSigs(corrupted))
+	require.Error(t, err)
+
+	// the multi-key role needs signatures by both of its keys
+	output, err = verify("targets/multi", writeSigs(sigs...))
+	require.NoError(t, err)
+	require.Contains(t, output, "is valid for targets/multi")
+	_, err = verify("targets/multi", writeSigs(sigs[1]))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "found 1 of the 2 valid signatures")
+	_, err = verify("targets/multi", writeSigs(sigs[1], sigs[1]))
+	require.Error(t, err)
+
+	_, err = verify("targets/missing", writeSigs(sigs...))
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify-signature", "gun", "targets/single", "--data", dataFile)
+	require.Error(t, err)
+}
+
+// Initialize repo and test publishing targets with delegation roles
+func TestClientDelegationsPublishing(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	// Setup certificate for delegation role
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+
+	cert, privKey, canonicalKeyID := generateCertPrivKeyPair(t, "gun", data.RSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	privKeyBytesNoRole, err := utils.ConvertPrivateKeyToPKCS8(privKey, "", "", "")
+	require.NoError(t, err)
+	privKeyBytesWithRole, err := utils.ConvertPrivateKeyToPKCS8(privKey, "user", "", "")
+	require.NoError(t, err)
+
+	// Set up targets for publishing
+	tempTargetFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempTargetFile.Close()
+	defer os.Remove(tempTargetFile.Name())
+
+	var target = "sdgkadga"
+
+	var output string
+
+	// init repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - none yet
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No delegations present in this repository.")
+
+	// validate that we have all keys, including snapshot
+	assertNumKeys(t, tempDir, 1, 2, true)
+
+	// rotate the snapshot key to server
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", "snapshot", "-r")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// validate that we lost the snapshot signing key
+	_, signingKeyIDs := assertNumKeys(t, tempDir, 1, 1, true)
+	targetKeyID := signingKeyIDs[0]
+
+	// add new valid delegation with single new cert
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", tempFile.Name(), "--paths", "\"\"")
+	require.NoError(t, err)
+	require.Contains(t, output, "Addition of delegation role")
+	require.Contains(t, output, canonicalKeyID)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see our one delegation
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "No delegations present in this repository.")
+
+	// remove the targets key to demonstrate that delegates don't need this key
+	keyDir := filepath.Join(tempDir, notary.PrivDir)
+	require.NoError(t, os.Remove(filepath.Join(keyDir, targetKeyID+".key")))
+
+	// Note that we need to use the canonical key ID, followed by the base of the role here
+	// Since, for a delegation- the filename is the canonical key ID. We have no role header in the PEM
+	err = ioutil.WriteFile(filepath.Join(keyDir, canonicalKeyID+".key"), privKeyBytesNoRole, 0700)
+	require.NoError(t, err)
+
+	// add a target using the delegation -- will only add to targets/releases
+	_, err = runCommand(t, tempDir, "add", "gun", target, tempTargetFile.Name(), "--roles", "targets/releases")
+	require.NoError(t, err)
+
+	// list targets for targets/releases - we should see no targets until we publish
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "No targets")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "status", "gun")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list targets for targets/releases - we should see our target!
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+
+	// remove the target for this role only
+	_, err = runCommand(t, tempDir, "remove", "gun", target, "--roles", "targets/releases")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list targets for targets/releases - we should see no targets
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "No targets present")
+
+	// Try adding a target with a different key style - private/tuf_keys/canonicalKeyID.key with "user" set as the "role" PEM header
+	// First remove the old key and add the new style
+	require.NoError(t, os.Remove(filepath.Join(keyDir, canonicalKeyID+".key")))
+	err = ioutil.WriteFile(filepath.Join(keyDir, canonicalKeyID+".key"), privKeyBytesWithRole, 0700)
+	require.NoError(t, err)
+
+	// add a target using the delegation -- will only add to targets/releases
+	_, err = runCommand(t, tempDir, "add", "gun", target, tempTargetFile.Name(), "--roles", "targets/releases")
+	require.NoError(t, err)
+
+	// list targets for targets/releases - we should see no targets until we publish
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "No targets")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list targets for targets/releases - we should see our target!
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+
+	// remove the target for this role only
+	_, err = runCommand(t, tempDir, "remove", "gun", target, "--roles", "targets/releases")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// add a target using the delegation -- will only add to targets/releases
+	_, err = runCommand(t, tempDir, "add", "gun", target, tempTargetFile.Name(), "--roles", "targets/releases")
+	require.NoError(t, err)
+
+	// list targets for targets/releases - we should see no targets until we publish
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "No targets")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list targets for targets/releases - we should see our target!
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+
+	// Setup another certificate
+	tempFile2, err := ioutil.TempFile("", "pemfile2")
+	require.NoError(t, err)
+	cert2, _, keyID2 := generateCertPrivKeyPair(t, "gun", data.RSAKey)
+	_, err = tempFile2.Write(utils.CertToPEM(cert2))
+	require.NoError(t, err)
+	tempFile2.Close()
+	defer os.Remove(tempFile2.Name())
+
+	// add a nested delegation under this releases role
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases/nested", tempFile2.Name(), "--paths", "nested/path")
+	require.NoError(t, err)
+	require.Contains(t, output, "Addition of delegation role")
+	require.Contains(t, output, keyID2)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see two roles
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+	require.Contains(t, output, "targets/releases/nested")
+	require.Contains(t, output, canonicalKeyID)
+	require.Contains(t, output, keyID2)
+	require.Contains(t, output, "nested/path")
+	require.Contains(t, output, "\"\"")
+	require.Contains(t, output, "<all paths>")
+
+	// remove by force to delete the nested delegation entirely
+	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/releases/nested", "-y")
+	require.NoError(t, err)
+	require.Contains(t, output, "Forced removal (including all keys and paths) of delegation role")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+}
+
+// Splits a string into lines, and returns any lines that are not empty (
+// striped of whitespace)
+func splitLines(chunk string) []string {
+	splitted := strings.Split(strings.TrimSpace(chunk), "\n")
+	var results []string
+
+	for _, line := range splitted {
+		line := strings.TrimSpace(line)
+		if line != "" {
+			results = append(results, line)
+		}
+	}
+
+	return results
+}
+
+// List keys, parses the output, and returns the unique key IDs as an array
+// of root key IDs and an array of signing key IDs.  Output expected looks like:
+//     ROLE      GUN          KEY ID                   LOCATION
+// ----------------------------------------------------------------
+//   root               8bd63a896398b558ac...   file (.../private)
+//   snapshot   repo    e9e9425cd9a85fc7a5...   file (.../private)
+//   targets    repo    f5b84e2d92708c5acb...   file (.../private)
+func getUniqueKeys(t *testing.T, tempDir string) ([]string, []string) {
+	output, err := runCommand(t, tempDir, "key", "list")
+	require.NoError(t, err)
+	lines := splitLines(output)
+	if len(lines) == 1 && lines[0] == "No signing keys found." {
+		return []string{}, []string{}
+	}
+	if len(lines) < 3 { // 2 lines of header, at least 1 line with keys
+		t.Logf("This output is not what is expected by the test:\n%s", output)
+	}
+
+	var (
+		rootMap    = make(map[string]bool)
+		nonrootMap = make(map[string]bool)
+		root       []string
+		nonroot    []string
+	)
+	// first two lines are header
+	for _, line := range lines[2:] {
+		parts := strings.Fields(line)
+		var (
+			placeToGo map[string]bool
+			keyID     string
+		)
+		if strings.TrimSpace(parts[0]) == data.CanonicalRootRole.String() {
+			// no gun, so there are only 3 fields
+			placeToGo, keyID = rootMap, parts[1]
+		} else {
+			// gun comes between role and key ID
+			if len(parts) == 3 {
+				// gun is empty as this may be a delegation key
+				placeToGo, keyID = nonrootMap, parts[1]
+			} else {
+				placeToGo, keyID = nonrootMap, parts[2]
+			}
+
+		}
+		// keys are 32-chars long (32 byte shasum, hex-encoded)
+		require.Len(t, keyID, 64)
+		placeToGo[keyID] = true
+	}
+	for k := range rootMap {
+		root = append(root, k)
+	}
+	for k := range nonrootMap {
+		nonroot = append(nonroot, k)
+	}
+
+	return root, nonroot
+}
+
+// List keys, parses the output, and asserts something about the number of root
+// keys and number of signing keys, as well as returning them.
+func assertNumKeys(t *testing.T, tempDir string, numRoot, numSigning int,
+	rootOnDisk bool) ([]string, []string) {
+
+	root, signing := getUniqueKeys(t, tempDir)
+	require.Len(t, root, numRoot)
+	require.Len(t, signing, numSigning)
+	for _, rootKeyID := range root {
+		_, err := os.Stat(filepath.Join(
+			tempDir, notary.PrivDir, rootKeyID+".key"))
+		// os.IsExist checks to see if the error is because a file already
+		// exists, and hence it isn't actually the right function to use here
+		require.Equal(t, rootOnDisk, !os.IsNotExist(err))
+
+		// this function is declared is in the build-tagged setup files
+		verifyRootKeyOnHardware(t, rootKeyID)
+	}
+	return root, signing
+}
+
+// Adds the given target to the gun, publishes it, and lists it to ensure that
+// it appears.  Returns the listing output.
+func assertSuccessfullyPublish(
+	t *testing.T, tempDir, url, gun, target, fname string) string {
+
+	_, err := runCommand(t, tempDir, "add", gun, target, fname)
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", url, "publish", gun)
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "-s", url, "list", gun)
+	require.NoError(t, err)
+	require.Contains(t, output, target)
+
+	return output
+}
+
+// Tests root key generation and key rotation
+func TestClientKeyGenerationRotation(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	tempfiles := make([]string, 2)
+	for i := 0; i < 2; i++ {
+		tempFile, err := ioutil.TempFile("", "targetfile")
+		require.NoError(t, err)
+		tempFile.Close()
+		tempfiles[i] = tempFile.Name()
+		defer os.Remove(tempFile.Name())
+	}
+
+	server := setupServer()
+	defer server.Close()
+
+	var target = "sdgkadga"
+
+	// -- tests --
+
+	// starts out with no keys
+	assertNumKeys(t, tempDir, 0, 0, true)
+
+	// generate root key produces a single root key and no other keys
+	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey)
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 1, 0, true)
+
+	// initialize a repo, should have signing keys and no new root key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	origRoot, origSign := assertNumKeys(t, tempDir, 1, 2, true)
+
+	// publish using the original keys
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", target, tempfiles[0])
+
+	// rotate the signing keys
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalSnapshotRole.String())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String())
+	require.NoError(t, err)
+	root, sign := assertNumKeys(t, tempDir, 1, 2, true)
+	require.Equal(t, origRoot[0], root[0])
+
+	// just do a cursory rotation check that the keys aren't equal anymore
+	for _, origKey := range origSign {
+		for _, key := range sign {
+			require.NotEqual(
+				t, key, origKey, "One of the signing keys was not removed")
+		}
+	}
+
+	// publish using the new keys
+	output := assertSuccessfullyPublish(
+		t, tempDir, server.URL, "gun", target+"2", tempfiles[1])
+	// assert that the previous target is still there
+	require.True(t, strings.Contains(string(output), target))
+
+	// rotate the snapshot and timestamp keys on the server, multiple times
+	for i := 0; i < 10; i++ {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalSnapshotRole.String(), "-r")
+		require.NoError(t, err)
+		_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTimestampRole.String(), "-r")
+		require.NoError(t, err)
+	}
+}
+
+// Tests rotating the snapshot key to the server and then reclaiming it back to
+// a local key
+func TestClientKeyRotationReclaim(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	server := setupServer()
+	defer server.Close()
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	_, origSign := assertNumKeys(t, tempDir, 1, 2, true)
+
+	// a snapshot key that is held locally cannot be reclaimed
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", "snapshot", "--reclaim")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not managed by the server")
+
+	// rotate the snapshot key to the server, losing the local snapshot key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", "snapshot", "-r")
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 1, 1, true)
+
+	// the timestamp key can only be managed by the server
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", "timestamp", "--reclaim")
+	require.Error(t, err)
+
+	// --reclaim cannot be combined with --server-managed
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", "snapshot", "--reclaim", "-r")
+	require.Error(t, err)
+
+	// reclaim the snapshot key, which generates a new local snapshot key
+	output, err := runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", "snapshot", "--reclaim")
+	require.NoError(t, err)
+	require.Contains(t, output, "back to a local key")
+	_, sign := assertNumKeys(t, tempDir, 1, 2, true)
+	newKeys := 0
+	for _, key := range sign {
+		if key != origSign[0] && key != origSign[1] {
+			newKeys++
+		}
+	}
+	require.Equal(t, 1, newKeys, "the reclaimed snapshot key should be a new key")
+
+	// publish using the local snapshot key
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", "sdgkadga", tempFile.Name())
+}
+
+// The server generates the keys for a new repo with the algorithm requested
+// on init, and unsupported algorithms are rejected
+func TestClientTUFInitKeyAlgorithm(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	getTimestampKey := func(gun string) data.PublicKey {
+		resp, err := http.Get(server.URL + "/v2/" + gun + "/_trust/tuf/timestamp.key")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		key, err := data.UnmarshalPublicKey(body)
+		require.NoError(t, err)
+		return key
+	}
+
+	// the server is configured to generate ECDSA keys by default
+	for _, algorithm := range []string{data.ED25519Key, ""} {
+		gun := "gun-" + algorithm
+		args := []string{"-s", server.URL, "init", gun, "-p"}
+		if algorithm != "" {
+			args = append(args, "--key-algorithm", strings.ToUpper(algorithm))
+		} else {
+			algorithm = data.ECDSAKey
+		}
+		_, err := runCommand(t, tempDir, args...)
+		require.NoError(t, err)
+		require.Equal(t, algorithm, getTimestampKey(gun).Algorithm())
+	}
+
+	// the client refuses to request an unsupported algorithm, and so does the
+	// server, without generating a key
+	for _, algorithm := range []string{data.RSAKey, "dsa"} {
+		_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun-invalid", "--key-algorithm", algorithm)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid key algorithm")
+
+		resp, err := http.Get(server.URL + "/v2/gun-invalid/_trust/tuf/timestamp.key?algorithm=" + algorithm)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+// Tests key rotation
+func TestKeyRotation(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	tempfiles := make([]string, 2)
+	for i := 0; i < 2; i++ {
+		tempFile, err := ioutil.TempFile("", "targetfile")
+		require.NoError(t, err)
+		tempFile.Close()
+		tempfiles[i] = tempFile.Name()
+		defer os.Remove(tempFile.Name())
+	}
+
+	server := setupServer()
+	defer server.Close()
+
+	var target = "sdgkadga"
+
+	// -- tests --
+
+	// starts out with no keys
+	assertNumKeys(t, tempDir, 0, 0, true)
+
+	// generate root key produces a single root key and no other keys
+	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey)
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 1, 0, true)
+
+	// initialize a repo, should have signing keys and no new root key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 1, 2, true)
+
+	// publish using the original keys
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", target, tempfiles[0])
+
+	// invalid keys
+	badKeyFile, err := ioutil.TempFile("", "badKey")
+	require.NoError(t, err)
+	defer os.Remove(badKeyFile.Name())
+	_, err = badKeyFile.Write([]byte{0, 0, 0, 0})
+	require.NoError(t, err)
+	badKeyFile.Close()
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String(), "--key", "123")
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String(), "--key", badKeyFile.Name())
+	require.Error(t, err)
+
+	// create encrypted root keys
+	rootPrivKey1, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	encryptedPEMPrivKey1, err := utils.ConvertPrivateKeyToPKCS8(rootPrivKey1, data.CanonicalRootRole, "", testPassphrase)
+	require.NoError(t, err)
+	encryptedPEMKeyFilename1 := filepath.Join(tempDir, "encrypted_key.key")
+	err = ioutil.WriteFile(encryptedPEMKeyFilename1, encryptedPEMPrivKey1, 0644)
+	require.NoError(t, err)
+
+	rootPrivKey2, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	encryptedPEMPrivKey2, err := utils.ConvertPrivateKeyToPKCS8(rootPrivKey2, data.CanonicalRootRole, "", testPassphrase)
+	require.NoError(t, err)
+	encryptedPEMKeyFilename2 := filepath.Join(tempDir, "encrypted_key2.key")
+	err = ioutil.WriteFile(encryptedPEMKeyFilename2, encryptedPEMPrivKey2, 0644)
+	require.NoError(t, err)
+
+	// rotate the root key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String(), "--key", encryptedPEMKeyFilename1, "--key", encryptedPEMKeyFilename2)
+	require.NoError(t, err)
+	// 3 root keys - 1 prev, 1 new
+	assertNumKeys(t, tempDir, 3, 2, true)
+
+	// rotate the root key again
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalRootRole.String())
+	require.NoError(t, err)
+	// 3 root keys, 2 prev, 1 new
+	assertNumKeys(t, tempDir, 3, 2, true)
+
+	// publish using the new keys
+	output := assertSuccessfullyPublish(
+		t, tempDir, server.URL, "gun", target+"2", tempfiles[1])
+	// assert that the previous target is still there
+	require.True(t, strings.Contains(string(output), target))
+}
+
+// Tests that the root history shows the keys added and removed by each
+// rotation of the root key
+func TestClientRootHistory(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "root-history", "gun")
+	require.Error(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+
+	// the root key is rotated twice, without being asked to confirm
+	repo, err := client.NewFileCachedRepository(tempDir, "gun", server.URL, http.DefaultTransport,
+		passphrase.ConstantRetriever(testPassphrase), trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, repo.RotateKey(data.CanonicalRootRole, false, nil))
+	}
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "root-history", "gun")
+	require.NoError(t, err)
+	for version := 1; version <= 3; version++ {
+		require.Regexp(t, fmt.Sprintf(`(?m)^%d\s+1\s+[0-9a-f]{64}\s+added$`, version), output)
+	}
+	require.Regexp(t, `(?m)^2\s+1\s+[0-9a-f]{64}\s+removed$`, output)
+	require.Regexp(t, `(?m)^3\s+1\s+[0-9a-f]{64}\s+removed$`, output)
+	require.Equal(t, 3, strings.Count(output, "added"))
+	require.Equal(t, 2, strings.Count(output, "removed"))
+	require.NotContains(t, output, "no longer available")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "root-history")
+	require.Error(t, err)
+}
+
+// Tests rotating non-root keys
+func TestKeyRotationNonRoot(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	tempfiles := make([]string, 2)
+	for i := 0; i < 2; i++ {
+		tempFile, err := ioutil.TempFile("", "targetfile")
+		require.NoError(t, err)
+		tempFile.Close()
+		tempfiles[i] = tempFile.Name()
+		defer os.Remove(tempFile.Name())
+	}
+
+	server := setupServer()
+	defer server.Close()
+
+	var target = "sdgkadgad"
+
+	// -- tests --
+
+	// starts out with no keys
+	assertNumKeys(t, tempDir, 0, 0, true)
+
+	// generate root key produces a single root key and no other keys
+	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey)
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 1, 0, true)
+
+	// initialize a repo, should have signing keys and no new root key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 1, 2, true)
+
+	// publish using the original keys
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", target, tempfiles[0])
+
+	// create new target keys
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+
+	pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalTargetsRole, "", testPassphrase)
+	require.NoError(t, err)
+
+	nBytes, err := tempFile.Write(pemBytes)
+	require.NoError(t, err)
+	tempFile.Close()
+	require.Equal(t, len(pemBytes), nBytes)
+
+	tempFile2, err := ioutil.TempFile("", "pemfile2")
+	require.NoError(t, err)
+	defer os.Remove(tempFile2.Name())
+
+	privKey2, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+
+	pemBytes2, err := utils.ConvertPrivateKeyToPKCS8(privKey2, data.CanonicalTargetsRole, "", "")
+	require.NoError(t, err)
+
+	nBytes2, err := tempFile2.Write(pemBytes2)
+	require.NoError(t, err)
+	tempFile2.Close()
+	require.Equal(t, len(pemBytes2), nBytes2)
+
+	// rotate the targets key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String(), "--key", tempFile.Name(), "--key", tempFile2.Name())
+	require.NoError(t, err)
+
+	// publish using the new keys
+	output := assertSuccessfullyPublish(
+		t, tempDir, server.URL, "gun", target+"2", tempfiles[1])
+	// assert that the previous target is still there
+	require.True(t, strings.Contains(string(output), target))
+
+	// rotate to nonexistant key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String(), "--key", "nope.pem")
+	require.Error(t, err)
+}
+
+// Tests default root key generation
+func TestDefaultRootKeyGeneration(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	// -- tests --
+
+	// starts out with no keys
+	assertNumKeys(t, tempDir, 0, 0, true)
+
+	// generate root key with no algorithm produces a single ECDSA root key and no other keys
+	_, err := runCommand(t, tempDir, "key", "generate")
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 1, 0, true)
+}
+
+// Tests the interaction with the verbose and log-level flags
+func TestLogLevelFlags(t *testing.T) {
+	// Test default to fatal
+	n := notaryCommander{}
+	n.setVerbosityLevel()
+	require.Equal(t, "warning", logrus.GetLevel().String())
+
+	// Test that verbose (-v) sets to error
+	n.verbose = true
+	n.setVerbosityLevel()
+	require.Equal(t, "info", logrus.GetLevel().String())
+
+	// Test that debug (-D) sets to debug
+	n.debug = true
+	n.setVerbosityLevel()
+	require.Equal(t, "debug", logrus.GetLevel().String())
+
+	// Test that unsetting verboseError still uses verboseDebug
+	n.verbose = false
+	n.setVerbosityLevel()
+	require.Equal(t, "debug", logrus.GetLevel().String())
+}
+
+// Removing the keys of a GUN leaves the keys of other GUNs, and the root key
+// unless --include-root is given
+func TestClientKeyRemoveGUN(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	// both GUNs share the root key
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun1")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun2")
+	require.NoError(t, err)
+	rootKeyIDs, _ := assertNumKeys(t, tempDir, 1, 4, true)
+
+	// the GUN's key and --gun cannot be given together
+	_, err = runCommand(t, tempDir, "key", "remove", rootKeyIDs[0], "--gun", "gun1", "-y")
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "key", "remove", rootKeyIDs[0], "--include-root")
+	require.Error(t, err)
+
+	output, err := runCommand(t, tempDir, "key", "remove", "--gun", "gun1", "-y")
+	require.NoError(t, err)
+	require.Contains(t, output, "Deleted 2 key(s) for gun1")
+	assertNumKeys(t, tempDir, 1, 2, true)
+	output, err = runCommand(t, tempDir, "key", "list")
+	require.NoError(t, err)
+	require.NotContains(t, output, "gun1")
+	require.Contains(t, output, "gun2")
+
+	// --include-root removes the root key of the GUN too
+	output, err = runCommand(t, tempDir, "key", "remove", "--gun", "gun2", "--include-root", "-y")
+	require.NoError(t, err)
+	require.Contains(t, output, "Deleted 3 key(s) for gun2")
+	assertNumKeys(t, tempDir, 0, 0, true)
+
+	// which requires the GUN's root metadata to identify it
+	_, err = runCommand(t, tempDir, "key", "remove", "--gun", "gun3", "--include-root", "-y")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to find the root keys of gun3")
+}
+
+func TestClientKeyPassphraseChange(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	target := "sdgkadga"
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	// -- tests --
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun1")
+	require.NoError(t, err)
+
+	// we should have three keys stored locally in total: root, targets, snapshot
+	rootIDs, signingIDs := assertNumKeys(t, tempDir, 1, 2, true)
+	for _, keyID := range signingIDs {
+		// try changing the private key passphrase
+		_, err = runCommand(t, tempDir, "-s", server.URL, "key", "passwd", keyID)
+		require.NoError(t, err)
+
+		// assert that the signing keys (number and IDs) didn't change
+		_, signingIDs = assertNumKeys(t, tempDir, 1, 2, true)
+		require.Contains(t, signingIDs, keyID)
+
+		// make sure we can still publish with this signing key
+		assertSuccessfullyPublish(t, tempDir, server.URL, "gun1", target, tempFile.Name())
+	}
+
+	// only one rootID, try changing the private key passphrase
+	rootID := rootIDs[0]
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "passwd", rootID)
+	require.NoError(t, err)
+
+	// make sure we can init a new repo with this key
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun2")
+	require.NoError(t, err)
+
+	// assert that the root key ID didn't change
+	rootIDs, _ = assertNumKeys(t, tempDir, 1, 4, true)
+	require.Equal(t, rootID, rootIDs[0])
+}
+
+func tempDirWithConfig(t *testing.T, config string) string {
+	tempDir, err := ioutil.TempDir("", "repo")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(tempDir, "config.json"), []byte(config), 0644)
+	require.NoError(t, err)
+	return tempDir
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() {
+		// skip
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestPurgeSingleKey(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	// Setup certificates
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+
+	cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	// Setup another certificate
+	tempFile2, err := ioutil.TempFile("", "pemfile2")
+	require.NoError(t, err)
+
+	cert2, _, keyID2 := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile2.Write(utils.CertToPEM(cert2))
+	require.NoError(t, err)
+	tempFile2.Close()
+	defer os.Remove(tempFile2.Name())
+
+	delgName := "targets/delegation1"
+	delgName2 := "targets/delegation2"
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// Add two delegations with two keys
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile.Name(), tempFile2.Name(), "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName2, tempFile.Name(), tempFile2.Name(), "--all-paths")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	out, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, out, delgName)
+	require.Contains(t, out, delgName2)
+	require.Contains(t, out, keyID)
+	require.Contains(t, out, keyID2)
+
+	// auto-publish doesn't error because purge only updates the roles we have signing keys for
+	_, err = runCommand(t, tempDir, "delegation", "purge", "-s", server.URL, "-p", "gun", "--key", keyID)
+	require.NoError(t, err)
+
+	// check the delegations weren't removed, and that the key we purged isn't present
+	out, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, out, keyID)
+	require.Contains(t, out, delgName)
+	require.Contains(t, out, delgName2)
+	require.Contains(t, out, keyID2)
+}
+
+// Initialize repo and test witnessing. The following steps are performed:
+//   1. init a repo
+//   2. add a delegation with a key and --all-paths
+//   3. add a target to the delegation
+//   4. list targets and ensure it really is in the delegation
+//   5  witness the valid delegation, make sure everything is successful
+//   6. add a new (different) key to the delegation
+//   7. remove the key from the delegation
+//   8. list targets and ensure the target is no longer visible
+//   9. witness the delegation
+//  10. list targets and ensure target is visible again
+//  11. witness an invalid role and check for error on publish
+//  12. check non-targets base roles all fail
+//  13. test auto-publish functionality
+//  14. remove all keys from the delegation and publish
+//  15. witnessing the delegation should now fail
+func TestWitness(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	// Setup certificates
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+
+	cert, privKey, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	// Setup another certificate
+	tempFile2, err := ioutil.TempFile("", "pemfile2")
+	require.NoError(t, err)
+
+	cert2, privKey2, keyID2 := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile2.Write(utils.CertToPEM(cert2))
+	require.NoError(t, err)
+	tempFile2.Close()
+	defer os.Remove(tempFile2.Name())
+
+	delgName := "targets/delegation"
+	targetName := "test_target"
+	targetHash := "9d9e890af64dd0f44b8a1538ff5fa0511cc31bf1ab89f3a3522a9a581a70fad8" // sha256 of README.md at time of writing test
+
+	keyStore, err := trustmanager.NewKeyFileStore(tempDir, passphrase.ConstantRetriever(testPassphrase))
+	require.NoError(t, err)
+	err = keyStore.AddKey(
+		trustmanager.KeyInfo{
+			Gun:  "gun",
+			Role: data.RoleName(delgName),
+		},
+		privKey,
+	)
+	require.NoError(t, err)
+
+	// 1. init a repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// 2. add a delegation with a key and --all-paths
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile.Name(), "--all-paths")
+	require.NoError(t, err)
+
+	// 3. add a target to the delegation
+	_, err = runCommand(t, tempDir, "addhash", "gun", targetName, "100", "--sha256", targetHash, "-r", delgName)
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// 4. list targets and ensure it really is in the delegation
+	output, err := runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, targetName)
+	require.Contains(t, output, targetHash)
+
+	// 5. witness the valid delegation, make sure everything is successful
+	_, err = runCommand(t, tempDir, "witness", "gun", delgName)
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, targetName)
+	require.Contains(t, output, targetHash)
+
+	// 6. add a new (different) key to the delegation
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile2.Name(), "--all-paths")
+	require.NoError(t, err)
+
+	// 7. remove the key from the delegation
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", delgName, keyID)
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// 8. list targets and ensure the target is no longer visible
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, targetName)
+	require.NotContains(t, output, targetHash)
+
+	err = keyStore.AddKey(
+		trustmanager.KeyInfo{
+			Gun:  "gun",
+			Role: data.RoleName(delgName),
+		},
+		privKey2,
+	)
+	require.NoError(t, err)
+
+	// 9. witness the delegation
+	_, err = runCommand(t, tempDir, "witness", "gun", delgName)
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// 10. list targets and ensure target is visible again
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, targetName)
+	require.Contains(t, output, targetHash)
+
+	// 11. witness an invalid role and check for error on publish
+	_, err = runCommand(t, tempDir, "witness", "gun", "targets/made/up")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.Error(t, err)
+
+	// 12. check non-targets base roles all fail
+	for _, role := range []string{data.CanonicalRootRole.String(), data.CanonicalSnapshotRole.String(), data.CanonicalTimestampRole.String()} {
+		// clear any pending changes to ensure errors are only related to the specific role we're trying to witness
+		_, err = runCommand(t, tempDir, "reset", "gun", "--all")
+		require.NoError(t, err)
+
+		_, err = runCommand(t, tempDir, "witness", "gun", role)
+		require.NoError(t, err)
+
+		_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+		require.Error(t, err)
+	}
+
+	// 13. test auto-publish functionality (just for witness)
+
+	// purge the old staged witness
+	_, err = runCommand(t, tempDir, "reset", "gun", "--all")
+	require.NoError(t, err)
+
+	// remove key2 and add back key1
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile.Name(), "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", delgName, keyID2)
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// the role now won't show its target because it's invalid
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, targetName)
+	require.NotContains(t, output, targetHash)
+
+	// auto-publish with witness, check that the target is back
+	_, err = runCommand(t, tempDir, "-s", server.URL, "witness", "-p", "gun", delgName)
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, targetName)
+	require.Contains(t, output, targetHash)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "remove", "-p", "gun", delgName, keyID, keyID2)
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "witness", "-p", "gun", delgName)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "role does not specify enough valid signing keys to meet its required threshold")
+}
+
+func generateCertPrivKeyPair(t *testing.T, gun, keyAlgorithm string) (*x509.Certificate, data.PrivateKey, string) {
+	// Setup certificate
+	var privKey data.PrivateKey
+	var err error
+	switch keyAlgorithm {
+	case data.ECDSAKey:
+		privKey, err = utils.GenerateECDSAKey(rand.Reader)
+	case data.RSAKey:
+		privKey, err = testutils.GetRSAKey(4096)
+	default:
+		err = fmt.Errorf("invalid key algorithm provided: %s", keyAlgorithm)
+	}
+	require.NoError(t, err)
+	startTime := time.Now()
+	endTime := startTime.AddDate(10, 0, 0)
+	cert, err := cryptoservice.GenerateCertificate(privKey, data.GUN(gun), startTime, endTime)
+	require.NoError(t, err)
+	parsedPubKey, _ := utils.ParsePEMPublicKey(utils.CertToPEM(cert))
+	keyID, err := utils.CanonicalKeyID(parsedPubKey)
+	require.NoError(t, err)
+	return cert, privKey, keyID
+}
+
+func TestClientTUFInitWithAutoPublish(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	var (
+		gun          = "MistsOfPandaria"
+		gunNoPublish = "Legion"
+
+		// This might be changed via the implementation, please be careful.
+		emptyList = "\nNo targets present in this repository.\n\n"
+	)
+	// -- tests --
+
+	// init repo with auto publish being enabled but with a malformed URL.
+	_, err = runCommand(t, tempDir, "-s", "For the Horde!", "init", "-p", gun)
+	require.Error(t, err, "Trust server url has to be in the form of http(s)://URL:PORT.")
+	// init repo with auto publish being enabled but with an unaccessible URL.
+	_, err = runCommand(t, tempDir, "-s", "https://notary-server-on-the-moon:12306", "init", "-p", gun)
+	require.NotNil(t, err)
+	require.Equal(t, err, nstorage.ErrOffline{})
+
+	// init repo with auto publish being enabled
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "-p", gun)
+	require.NoError(t, err)
+	// list repo - expect empty list
+	output, err := runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	require.NoError(t, err)
+	require.Equal(t, output, emptyList)
+
+	// init repo without auto publish being enabled
+	//
+	// Use this test to guarantee that we won't break the normal init process.
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", gunNoPublish)
+	require.NoError(t, err)
+	// list repo - expect error
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", gunNoPublish)
+	require.NotNil(t, err)
+	require.IsType(t, client.ErrRepositoryNotExist{}, err)
+}
+
+func TestClientTUFAddWithAutoPublish(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	var (
+		target          = "ShangXi"
+		target2         = "ChenStormstout"
+		targetNoPublish = "Shen-zinSu"
+		gun             = "MistsOfPandaria"
+	)
+	// -- tests --
+
+	// init repo with auto publish being enabled
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "-p", gun)
+	require.NoError(t, err)
+
+	// add a target with auto publish being enabled, but without the server URL
+	_, err = runCommand(t, tempDir, "add", "-p", gun, target, tempFile.Name())
+	require.NotNil(t, err)
+	require.Equal(t, err, nstorage.ErrOffline{})
+	// check status, since we only fail the auto publishment in the previous step,
+	// the change should still exists.
+	output, err := runCommand(t, tempDir, "status", gun)
+	require.NoError(t, err)
+	require.Contains(t, output, target)
+
+	// add a target with auto publish being enabled but with a malformed URL.
+	_, err = runCommand(t, tempDir, "-s", "For the Horde!", "add", "-p", gun, target, tempFile.Name())
+	require.Error(t, err, "Trust server url has to be in the form of http(s)://URL:PORT.")
+	// add a target with auto publish being enabled but with an unaccessible URL.
+	_, err = runCommand(t, tempDir, "-s", "https://notary-server-on-the-moon:12306", "add", "-p", gun, target, tempFile.Name())
+	require.NotNil(t, err)
+	require.Equal(t, err, nstorage.ErrOffline{})
+
+	// add a target with auto publish being enabled, and with the server URL
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "-p", gun, target2, tempFile.Name())
+	require.NoError(t, err)
+	// list repo, since the auto publish flag will try to publish all the staged changes,
+	// so the target and target2 should be in the list.
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	require.NoError(t, err)
+	require.Contains(t, output, target)
+	require.Contains(t, output, target2)
+
+	// add a target without auto publish being enabled
+	//
+	// Use this test to guarantee that we won't break the normal add process.
+	_, err = runCommand(t, tempDir, "add", gun, targetNoPublish, tempFile.Name())
+	require.NoError(t, err)
+	// check status - expect the targetNoPublish
+	output, err = runCommand(t, tempDir, "status", gun)
+	require.NoError(t, err)
+	require.Contains(t, output, targetNoPublish)
+	// list repo - expect only the target, not the targetNoPublish
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	require.NoError(t, err)
+	require.Contains(t, output, target)
+	require.False(t, strings.Contains(output, targetNoPublish))
 }
 
-func TestClientKeyPassphraseChange(t *testing.T) {
-	// -- setup --
+// Custom data given with --custom-merge is deep merged into the custom data of
+// the published target, rather than replacing it
+func TestClientTUFAddWithCustomMerge(t *testing.T) {
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
@@ -1755,63 +4261,74 @@ func TestClientKeyPassphraseChange(t *testing.T) {
 	server := setupServer()
 	defer server.Close()
 
-	target := "sdgkadga"
 	tempFile, err := ioutil.TempFile("", "targetfile")
 	require.NoError(t, err)
 	tempFile.Close()
 	defer os.Remove(tempFile.Name())
 
-	// -- tests --
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun1")
-	require.NoError(t, err)
-
-	// we should have three keys stored locally in total: root, targets, snapshot
-	rootIDs, signingIDs := assertNumKeys(t, tempDir, 1, 2, true)
-	for _, keyID := range signingIDs {
-		// try changing the private key passphrase
-		_, err = runCommand(t, tempDir, "-s", server.URL, "key", "passwd", keyID)
+	writeCustom := func(name, content string) string {
+		customFile := filepath.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(customFile, []byte(content), 0644))
+		return customFile
+	}
+	publishedCustom := func() string {
+		resp, err := http.Get(server.URL + "/v2/gun/_trust/tuf/targets.json")
 		require.NoError(t, err)
-
-		// assert that the signing keys (number and IDs) didn't change
-		_, signingIDs = assertNumKeys(t, tempDir, 1, 2, true)
-		require.Contains(t, signingIDs, keyID)
-
-		// make sure we can still publish with this signing key
-		assertSuccessfullyPublish(t, tempDir, server.URL, "gun1", target, tempFile.Name())
+		defer resp.Body.Close()
+		rawTargets, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		parsedTargets := data.SignedTargets{}
+		require.NoError(t, json.Unmarshal(rawTargets, &parsedTargets))
+		return string(*parsedTargets.Signed.Targets["merged"].Custom)
 	}
 
-	// only one rootID, try changing the private key passphrase
-	rootID := rootIDs[0]
-	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "passwd", rootID)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
 
-	// make sure we can init a new repo with this key
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun2")
+	// merging into a target which does not exist yet just adds the custom data
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "merged", tempFile.Name(), "-p",
+		"--custom-merge", "--custom", writeCustom("first.json", `{"build":{"id":1,"os":"linux"},"team":"release"}`))
 	require.NoError(t, err)
+	require.Equal(t, `{"build":{"id":1,"os":"linux"},"team":"release"}`, publishedCustom())
 
-	// assert that the root key ID didn't change
-	rootIDs, _ = assertNumKeys(t, tempDir, 1, 4, true)
-	require.Equal(t, rootID, rootIDs[0])
-}
+	// new keys, including nested ones, are merged in
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "merged", tempFile.Name(), "-p",
+		"--custom-merge", "--custom", writeCustom("second.json", `{"build":{"arch":"amd64"},"ticket":"REL-42"}`))
+	require.NoError(t, err)
+	require.Equal(t, `{"build":{"arch":"amd64","id":1,"os":"linux"},"team":"release","ticket":"REL-42"}`, publishedCustom())
 
-func tempDirWithConfig(t *testing.T, config string) string {
-	tempDir, err := ioutil.TempDir("", "repo")
+	// as they are when adding by hash
+	_, err = runCommand(t, tempDir, "-s", server.URL, "addhash", "gun", "merged", "0", "-p",
+		"--sha256", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"--custom-merge", "--custom", writeCustom("third.json", `{"team":"release","signed":true}`))
 	require.NoError(t, err)
-	err = ioutil.WriteFile(filepath.Join(tempDir, "config.json"), []byte(config), 0644)
+	require.Equal(t, `{"build":{"arch":"amd64","id":1,"os":"linux"},"signed":true,"team":"release","ticket":"REL-42"}`, publishedCustom())
+
+	// conflicting values which are not both objects are an error
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "merged", tempFile.Name(),
+		"--custom-merge", "--custom", writeCustom("conflict.json", `{"build":{"id":2}}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/build/id conflict")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "merged", tempFile.Name(),
+		"--custom-merge", "--custom", writeCustom("notobject.json", `"just a string"`))
+	require.Error(t, err)
+	output, err := runCommand(t, tempDir, "status", "gun")
 	require.NoError(t, err)
-	return tempDir
-}
+	require.NotContains(t, output, "merged")
 
-func TestMain(m *testing.M) {
-	flag.Parse()
-	if testing.Short() {
-		// skip
-		os.Exit(0)
-	}
-	os.Exit(m.Run())
+	// there must be custom data to merge
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "merged", tempFile.Name(), "--custom-merge")
+	require.Error(t, err)
+
+	// without merging, the custom data is replaced
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "merged", tempFile.Name(), "-p",
+		"--custom", writeCustom("replace.json", `{"build":{"id":2}}`))
+	require.NoError(t, err)
+	require.Equal(t, `{"build":{"id":2}}`, publishedCustom())
 }
 
-func TestPurgeSingleKey(t *testing.T) {
+func TestClientTUFRemoveWithAutoPublish(t *testing.T) {
+	// -- setup --
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
@@ -1820,81 +4337,58 @@ func TestPurgeSingleKey(t *testing.T) {
 	server := setupServer()
 	defer server.Close()
 
-	// Setup certificates
-	tempFile, err := ioutil.TempFile("", "pemfile")
-	require.NoError(t, err)
-
-	cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
-	_, err = tempFile.Write(utils.CertToPEM(cert))
+	tempFile, err := ioutil.TempFile("", "targetfile")
 	require.NoError(t, err)
 	tempFile.Close()
 	defer os.Remove(tempFile.Name())
 
-	// Setup another certificate
-	tempFile2, err := ioutil.TempFile("", "pemfile2")
-	require.NoError(t, err)
+	var (
+		target              = "ShangXi"
+		targetWillBeRemoved = "Shen-zinSu"
+		gun                 = "MistsOfPandaria"
+	)
+	// -- tests --
 
-	cert2, _, keyID2 := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
-	_, err = tempFile2.Write(utils.CertToPEM(cert2))
+	// init repo with auto publish being enabled
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "-p", gun)
 	require.NoError(t, err)
-	tempFile2.Close()
-	defer os.Remove(tempFile2.Name())
-
-	delgName := "targets/delegation1"
-	delgName2 := "targets/delegation2"
-
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	// add a target with auto publish being enabled
+	_, err = runCommand(t, tempDir, "add", "-s", server.URL, "-p", gun, target, tempFile.Name())
 	require.NoError(t, err)
-
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	_, err = runCommand(t, tempDir, "add", "-s", server.URL, "-p", gun, targetWillBeRemoved, tempFile.Name())
 	require.NoError(t, err)
-
-	// Add two delegations with two keys
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile.Name(), tempFile2.Name(), "--all-paths")
+	// remove a target with auto publish being enabled
+	_, err = runCommand(t, tempDir, "remove", "-s", server.URL, "-p", gun, targetWillBeRemoved, tempFile.Name())
 	require.NoError(t, err)
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName2, tempFile.Name(), tempFile2.Name(), "--all-paths")
+	// list repo - expect target
+	output, err := runCommand(t, tempDir, "-s", server.URL, "list", gun)
 	require.NoError(t, err)
+	require.Contains(t, output, target)
+	require.False(t, strings.Contains(output, targetWillBeRemoved))
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	// remove a target without auto publish being enabled
+	//
+	// Use this test to guarantee that we won't break the normal remove process.
+	_, err = runCommand(t, tempDir, "add", "-s", server.URL, "-p", gun, targetWillBeRemoved, tempFile.Name())
 	require.NoError(t, err)
-
-	out, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	// remove the targetWillBeRemoved without auto publish being enabled
+	_, err = runCommand(t, tempDir, "remove", gun, targetWillBeRemoved, tempFile.Name())
 	require.NoError(t, err)
-	require.Contains(t, out, delgName)
-	require.Contains(t, out, delgName2)
-	require.Contains(t, out, keyID)
-	require.Contains(t, out, keyID2)
-
-	// auto-publish doesn't error because purge only updates the roles we have signing keys for
-	_, err = runCommand(t, tempDir, "delegation", "purge", "-s", server.URL, "-p", "gun", "--key", keyID)
+	// check status - expect the targetWillBeRemoved
+	output, err = runCommand(t, tempDir, "status", gun)
 	require.NoError(t, err)
-
-	// check the delegations weren't removed, and that the key we purged isn't present
-	out, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.Contains(t, output, targetWillBeRemoved)
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", gun)
 	require.NoError(t, err)
-	require.NotContains(t, out, keyID)
-	require.Contains(t, out, delgName)
-	require.Contains(t, out, delgName2)
-	require.Contains(t, out, keyID2)
+	// list repo - expect only the target, not the targetWillBeRemoved
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	require.NoError(t, err)
+	require.Contains(t, output, target)
+	require.False(t, strings.Contains(output, targetWillBeRemoved))
 }
 
-// Initialize repo and test witnessing. The following steps are performed:
-//   1. init a repo
-//   2. add a delegation with a key and --all-paths
-//   3. add a target to the delegation
-//   4. list targets and ensure it really is in the delegation
-//   5  witness the valid delegation, make sure everything is successful
-//   6. add a new (different) key to the delegation
-//   7. remove the key from the delegation
-//   8. list targets and ensure the target is no longer visible
-//   9. witness the delegation
-//  10. list targets and ensure target is visible again
-//  11. witness an invalid role and check for error on publish
-//  12. check non-targets base roles all fail
-//  13. test auto-publish functionality
-//  14. remove all keys from the delegation and publish
-//  15. witnessing the delegation should now fail
-func TestWitness(t *testing.T) {
+func TestClientDelegationAddWithAutoPublish(t *testing.T) {
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
@@ -1903,196 +4397,196 @@ func TestWitness(t *testing.T) {
 	server := setupServer()
 	defer server.Close()
 
-	// Setup certificates
+	// Setup certificate
 	tempFile, err := ioutil.TempFile("", "pemfile")
 	require.NoError(t, err)
 
-	cert, privKey, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	startTime := time.Now()
+	endTime := startTime.AddDate(10, 0, 0)
+	cert, err := cryptoservice.GenerateCertificate(privKey, "gun", startTime, endTime)
+	require.NoError(t, err)
+
 	_, err = tempFile.Write(utils.CertToPEM(cert))
 	require.NoError(t, err)
 	tempFile.Close()
 	defer os.Remove(tempFile.Name())
 
-	// Setup another certificate
-	tempFile2, err := ioutil.TempFile("", "pemfile2")
+	rawPubBytes, _ := ioutil.ReadFile(tempFile.Name())
+	parsedPubKey, _ := utils.ParsePEMPublicKey(rawPubBytes)
+	keyID, err := utils.CanonicalKeyID(parsedPubKey)
 	require.NoError(t, err)
 
-	cert2, privKey2, keyID2 := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
-	_, err = tempFile2.Write(utils.CertToPEM(cert2))
-	require.NoError(t, err)
-	tempFile2.Close()
-	defer os.Remove(tempFile2.Name())
+	var output string
 
-	delgName := "targets/delegation"
-	targetName := "test_target"
-	targetHash := "9d9e890af64dd0f44b8a1538ff5fa0511cc31bf1ab89f3a3522a9a581a70fad8" // sha256 of README.md at time of writing test
+	// -- tests --
 
-	keyStore, err := trustmanager.NewKeyFileStore(tempDir, passphrase.ConstantRetriever(testPassphrase))
-	require.NoError(t, err)
-	err = keyStore.AddKey(
-		trustmanager.KeyInfo{
-			Gun:  "gun",
-			Role: data.RoleName(delgName),
-		},
-		privKey,
-	)
+	// init and publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
 
-	// 1. init a repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	// list delegations - none yet
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "No delegations present in this repository.")
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	// add new valid delegation with single new cert, and no path
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "-p", "gun", "targets/delegation", tempFile.Name())
 	require.NoError(t, err)
 
-	// 2. add a delegation with a key and --all-paths
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile.Name(), "--all-paths")
+	// check status - no changelist
+	output, err = runCommand(t, tempDir, "status", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
 
-	// 3. add a target to the delegation
-	_, err = runCommand(t, tempDir, "addhash", "gun", targetName, "100", "--sha256", targetHash, "-r", delgName)
+	// list delegations - we should see our added delegation, with no paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "targets/delegation")
+	require.Contains(t, output, keyID)
+}
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+// Custom data added to a delegation is published along with the delegation and
+// is displayed when listing delegations
+func TestClientDelegationAddWithCustom(t *testing.T) {
+	setUp(t)
 
-	// 4. list targets and ensure it really is in the delegation
-	output, err := runCommand(t, tempDir, "-s", server.URL, "list", "gun")
-	require.NoError(t, err)
-	require.Contains(t, output, targetName)
-	require.Contains(t, output, targetHash)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-	// 5. witness the valid delegation, make sure everything is successful
-	_, err = runCommand(t, tempDir, "witness", "gun", delgName)
-	require.NoError(t, err)
+	server := setupServer()
+	defer server.Close()
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	// Setup certificate
+	tempFile, err := ioutil.TempFile("", "pemfile")
 	require.NoError(t, err)
-
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
 	require.NoError(t, err)
-	require.Contains(t, output, targetName)
-	require.Contains(t, output, targetHash)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// 6. add a new (different) key to the delegation
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile2.Name(), "--all-paths")
-	require.NoError(t, err)
+	customFile := filepath.Join(tempDir, "custom.json")
+	require.NoError(t, ioutil.WriteFile(customFile, []byte(`{"team":"release-eng","ticket":"REL-42"}`), 0644))
+	invalidCustomFile := filepath.Join(tempDir, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(invalidCustomFile, []byte(`{"team":`), 0644))
 
-	// 7. remove the key from the delegation
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", delgName, keyID)
-	require.NoError(t, err)
+	var output string
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.NoError(t, err)
+	// -- tests --
 
-	// 8. list targets and ensure the target is no longer visible
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	// init and publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-	require.NotContains(t, output, targetName)
-	require.NotContains(t, output, targetHash)
 
-	err = keyStore.AddKey(
-		trustmanager.KeyInfo{
-			Gun:  "gun",
-			Role: data.RoleName(delgName),
-		},
-		privKey2,
-	)
+	// invalid JSON is rejected before anything is staged
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name(), "--custom", invalidCustomFile)
+	require.Error(t, err)
+	output, err = runCommand(t, tempDir, "status", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
 
-	// 9. witness the delegation
-	_, err = runCommand(t, tempDir, "witness", "gun", delgName)
+	// add new valid delegation with custom data and publish it
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "-p", "gun", "targets/delegation", tempFile.Name(), "--all-paths", "--custom", customFile)
 	require.NoError(t, err)
+	require.Contains(t, output, "with custom data")
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	// list delegations from a fresh trust directory - the custom data came from the server
+	freshDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(freshDir)
+	output, err = runCommand(t, freshDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "targets/delegation")
+	require.Contains(t, output, keyID)
+	require.Contains(t, output, "REL-42")
 
-	// 10. list targets and ensure target is visible again
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	// updating keys on the delegation does not drop the custom data
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "remove", "-p", "gun", "targets/delegation", "--paths", "")
 	require.NoError(t, err)
-	require.Contains(t, output, targetName)
-	require.Contains(t, output, targetHash)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "REL-42")
 
-	// 11. witness an invalid role and check for error on publish
-	_, err = runCommand(t, tempDir, "witness", "gun", "targets/made/up")
+	// custom data can be replaced on an existing delegation on its own
+	require.NoError(t, ioutil.WriteFile(customFile, []byte(`{"team":"security"}`), 0644))
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "-p", "gun", "targets/delegation", "--custom", customFile)
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "security")
+	require.NotContains(t, output, "REL-42")
+}
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-	require.Error(t, err)
+// A delegation added with --valid-for is removed by expire-stale once it is
+// past the time it was added for, and delegations without one are kept
+func TestClientDelegationExpireStale(t *testing.T) {
+	setUp(t)
 
-	// 12. check non-targets base roles all fail
-	for _, role := range []string{data.CanonicalRootRole.String(), data.CanonicalSnapshotRole.String(), data.CanonicalTimestampRole.String()} {
-		// clear any pending changes to ensure errors are only related to the specific role we're trying to witness
-		_, err = runCommand(t, tempDir, "reset", "gun", "--all")
-		require.NoError(t, err)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
 
-		_, err = runCommand(t, tempDir, "witness", "gun", role)
-		require.NoError(t, err)
+	server := setupServer()
+	defer server.Close()
 
-		_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
-		require.Error(t, err)
-	}
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// 13. test auto-publish functionality (just for witness)
+	customFile := filepath.Join(tempDir, "custom.json")
+	require.NoError(t, ioutil.WriteFile(customFile, []byte(`{"ticket":"CI-7"}`), 0644))
+	arrayFile := filepath.Join(tempDir, "array.json")
+	require.NoError(t, ioutil.WriteFile(arrayFile, []byte(`["CI-7"]`), 0644))
 
-	// purge the old staged witness
-	_, err = runCommand(t, tempDir, "reset", "gun", "--all")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
 
-	// remove key2 and add back key1
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile.Name(), "--all-paths")
+	// the time can only be recorded alongside custom data which is an object
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/ci", tempFile.Name(), "--all-paths", "--valid-for", "1h", "--custom", arrayFile)
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/ci", tempFile.Name(), "--all-paths", "--valid-for", "-1h")
+	require.Error(t, err)
+
+	added := time.Now()
+	output, err := runCommand(t, tempDir, "delegation", "add", "gun", "targets/ci", tempFile.Name(), "--all-paths", "--valid-for", "1h", "--custom", customFile)
 	require.NoError(t, err)
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", delgName, keyID2)
+	require.Contains(t, output, "to be removed after")
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", tempFile.Name(), "--all-paths")
 	require.NoError(t, err)
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// the role now won't show its target because it's invalid
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	require.NotContains(t, output, targetName)
-	require.NotContains(t, output, targetHash)
+	require.Contains(t, output, client.RemoveAfterField)
+	require.Contains(t, output, "CI-7")
 
-	// auto-publish with witness, check that the target is back
-	_, err = runCommand(t, tempDir, "-s", server.URL, "witness", "-p", "gun", delgName)
-	require.NoError(t, err)
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	// within the window, nothing is removed
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "expire-stale", "gun", "-p")
 	require.NoError(t, err)
-	require.Contains(t, output, targetName)
-	require.Contains(t, output, targetHash)
+	require.Contains(t, output, "No delegations")
 
-	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "remove", "-p", "gun", delgName, keyID, keyID2)
+	// after it, only the time-limited delegation is removed
+	output, err = runCommandAt(t, data.FixedClock(added.Add(2*time.Hour)), tempDir, "-s", server.URL, "delegation", "expire-stale", "gun", "-p")
 	require.NoError(t, err)
-	_, err = runCommand(t, tempDir, "-s", server.URL, "witness", "-p", "gun", delgName)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "role does not specify enough valid signing keys to meet its required threshold")
-}
+	require.Contains(t, output, "Removal of delegation role targets/ci")
+	require.NotContains(t, output, "targets/releases")
 
-func generateCertPrivKeyPair(t *testing.T, gun, keyAlgorithm string) (*x509.Certificate, data.PrivateKey, string) {
-	// Setup certificate
-	var privKey data.PrivateKey
-	var err error
-	switch keyAlgorithm {
-	case data.ECDSAKey:
-		privKey, err = utils.GenerateECDSAKey(rand.Reader)
-	case data.RSAKey:
-		privKey, err = testutils.GetRSAKey(4096)
-	default:
-		err = fmt.Errorf("invalid key algorithm provided: %s", keyAlgorithm)
-	}
-	require.NoError(t, err)
-	startTime := time.Now()
-	endTime := startTime.AddDate(10, 0, 0)
-	cert, err := cryptoservice.GenerateCertificate(privKey, data.GUN(gun), startTime, endTime)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	parsedPubKey, _ := utils.ParsePEMPublicKey(utils.CertToPEM(cert))
-	keyID, err := utils.CanonicalKeyID(parsedPubKey)
+	require.NotContains(t, output, "targets/ci")
+	require.Contains(t, output, "targets/releases")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "expire-stale", "gun")
 	require.NoError(t, err)
-	return cert, privKey, keyID
+	require.Contains(t, output, "No delegations")
 }
 
-func TestClientTUFInitWithAutoPublish(t *testing.T) {
-	// -- setup --
+func TestClientDelegationListSingleRole(t *testing.T) {
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
@@ -2101,49 +4595,86 @@ func TestClientTUFInitWithAutoPublish(t *testing.T) {
 	server := setupServer()
 	defer server.Close()
 
-	tempFile, err := ioutil.TempFile("", "targetfile")
-	require.NoError(t, err)
-	tempFile.Close()
-	defer os.Remove(tempFile.Name())
-
+	// Setup certificates for three delegation roles
 	var (
-		gun          = "MistsOfPandaria"
-		gunNoPublish = "Legion"
-
-		// This might be changed via the implementation, please be careful.
-		emptyList = "\nNo targets present in this repository.\n\n"
+		certFiles []string
+		keyIDs    []string
+		privKeys  []data.PrivateKey
 	)
+	for i := 0; i < 3; i++ {
+		tempFile, err := ioutil.TempFile("", "pemfile")
+		require.NoError(t, err)
+		cert, privKey, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+		_, err = tempFile.Write(utils.CertToPEM(cert))
+		require.NoError(t, err)
+		tempFile.Close()
+		defer os.Remove(tempFile.Name())
+		certFiles = append(certFiles, tempFile.Name())
+		keyIDs = append(keyIDs, keyID)
+		privKeys = append(privKeys, privKey)
+	}
+
 	// -- tests --
 
-	// init repo with auto publish being enabled but with a malformed URL.
-	_, err = runCommand(t, tempDir, "-s", "For the Horde!", "init", "-p", gun)
-	require.Error(t, err, "Trust server url has to be in the form of http(s)://URL:PORT.")
-	// init repo with auto publish being enabled but with an unaccessible URL.
-	_, err = runCommand(t, tempDir, "-s", "https://notary-server-on-the-moon:12306", "init", "-p", gun)
-	require.NotNil(t, err)
-	require.Equal(t, err, nstorage.ErrOffline{})
+	// init and publish repo with targets/releases and targets/qa delegations
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", certFiles[0], "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/qa", certFiles[1], "--paths", "qa/path")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
 
-	// init repo with auto publish being enabled
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "-p", gun)
+	// the releases key is needed to add a delegation beneath targets/releases
+	privKeyBytes, err := utils.ConvertPrivateKeyToPKCS8(privKeys[0], "", "", "")
 	require.NoError(t, err)
-	// list repo - expect empty list
-	output, err := runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(tempDir, notary.PrivDir, keyIDs[0]+".key"), privKeyBytes, 0700))
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases/nested", certFiles[2], "--paths", "nested/path")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
-	require.Equal(t, output, emptyList)
 
-	// init repo without auto publish being enabled
-	//
-	// Use this test to guarantee that we won't break the normal init process.
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", gunNoPublish)
+	// listing all delegations shows all three roles
+	output, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	// list repo - expect error
-	_, err = runCommand(t, tempDir, "-s", server.URL, "list", gunNoPublish)
-	require.NotNil(t, err)
-	require.IsType(t, client.ErrRepositoryNotExist{}, err)
+	require.Contains(t, output, "targets/qa")
+	require.Contains(t, output, "targets/releases/nested")
+
+	// listing a single role shows only that role
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/qa")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/qa")
+	require.Contains(t, output, "qa/path")
+	require.Contains(t, output, keyIDs[1])
+	require.NotContains(t, output, "targets/releases")
+	require.NotContains(t, output, keyIDs[0])
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/releases")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+	require.Contains(t, output, keyIDs[0])
+	require.NotContains(t, output, "targets/releases/nested")
+	require.NotContains(t, output, "targets/qa")
+
+	// listing recursively also shows the roles beneath it
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/releases", "--recursive")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+	require.Contains(t, output, "targets/releases/nested")
+	require.Contains(t, output, keyIDs[2])
+	require.NotContains(t, output, "targets/qa")
+
+	// a role which does not exist is an error
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "targets/missing")
 }
 
-func TestClientTUFAddWithAutoPublish(t *testing.T) {
-	// -- setup --
+// --keys-only and --paths-only list only the key IDs or only the paths of
+// each delegation
+func TestClientDelegationListProjections(t *testing.T) {
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
@@ -2152,69 +4683,73 @@ func TestClientTUFAddWithAutoPublish(t *testing.T) {
 	server := setupServer()
 	defer server.Close()
 
-	tempFile, err := ioutil.TempFile("", "targetfile")
-	require.NoError(t, err)
-	tempFile.Close()
-	defer os.Remove(tempFile.Name())
-
 	var (
-		target          = "ShangXi"
-		target2         = "ChenStormstout"
-		targetNoPublish = "Shen-zinSu"
-		gun             = "MistsOfPandaria"
+		certFiles []string
+		keyIDs    []string
 	)
-	// -- tests --
+	for i := 0; i < 2; i++ {
+		tempFile, err := ioutil.TempFile("", "pemfile")
+		require.NoError(t, err)
+		cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+		_, err = tempFile.Write(utils.CertToPEM(cert))
+		require.NoError(t, err)
+		tempFile.Close()
+		defer os.Remove(tempFile.Name())
+		certFiles = append(certFiles, tempFile.Name())
+		keyIDs = append(keyIDs, keyID)
+	}
 
-	// init repo with auto publish being enabled
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "-p", gun)
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-
-	// add a target with auto publish being enabled, but without the server URL
-	_, err = runCommand(t, tempDir, "add", "-p", gun, target, tempFile.Name())
-	require.NotNil(t, err)
-	require.Equal(t, err, nstorage.ErrOffline{})
-	// check status, since we only fail the auto publishment in the previous step,
-	// the change should still exists.
-	output, err := runCommand(t, tempDir, "status", gun)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", certFiles[0], "--paths", "releases/a,releases/b")
 	require.NoError(t, err)
-	require.Contains(t, output, target)
-
-	// add a target with auto publish being enabled but with a malformed URL.
-	_, err = runCommand(t, tempDir, "-s", "For the Horde!", "add", "-p", gun, target, tempFile.Name())
-	require.Error(t, err, "Trust server url has to be in the form of http(s)://URL:PORT.")
-	// add a target with auto publish being enabled but with an unaccessible URL.
-	_, err = runCommand(t, tempDir, "-s", "https://notary-server-on-the-moon:12306", "add", "-p", gun, target, tempFile.Name())
-	require.NotNil(t, err)
-	require.Equal(t, err, nstorage.ErrOffline{})
-
-	// add a target with auto publish being enabled, and with the server URL
-	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "-p", gun, target2, tempFile.Name())
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/qa", certFiles[0], certFiles[1], "--all-paths")
 	require.NoError(t, err)
-	// list repo, since the auto publish flag will try to publish all the staged changes,
-	// so the target and target2 should be in the list.
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, target)
-	require.Contains(t, output, target2)
 
-	// add a target without auto publish being enabled
-	//
-	// Use this test to guarantee that we won't break the normal add process.
-	_, err = runCommand(t, tempDir, "add", gun, targetNoPublish, tempFile.Name())
-	require.NoError(t, err)
-	// check status - expect the targetNoPublish
-	output, err = runCommand(t, tempDir, "status", gun)
-	require.NoError(t, err)
-	require.Contains(t, output, targetNoPublish)
-	// list repo - expect only the target, not the targetNoPublish
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", gun)
-	require.NoError(t, err)
-	require.Contains(t, output, target)
-	require.False(t, strings.Contains(output, targetNoPublish))
+	rows := func(output string) [][]string {
+		var rows [][]string
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			rows = append(rows, strings.Fields(line))
+		}
+		return rows
+	}
+	output, err := runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--keys-only")
+	require.NoError(t, err)
+	listed := rows(output)
+	require.Len(t, listed, 5)
+	require.Equal(t, []string{"ROLE", "KEY", "IDS"}, listed[0])
+	require.Equal(t, "targets/qa", listed[2][0])
+	require.ElementsMatch(t, keyIDs, []string{listed[2][1], listed[3][0]})
+	require.Equal(t, []string{"targets/releases", keyIDs[0]}, listed[4])
+	require.NotContains(t, output, "releases/a")
+	require.NotContains(t, output, "THRESHOLD")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--paths-only")
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"ROLE", "PATHS"},
+		{"----", "-----"},
+		{"targets/qa", `""`, "<all", "paths>"},
+		{"targets/releases", "releases/a"},
+		{"releases/b"},
+	}, rows(output))
+	require.NotContains(t, output, keyIDs[0])
+
+	// the projections can be combined with --role, but not with each other
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--role", "targets/releases", "--keys-only")
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"ROLE", "KEY", "IDS"}, {"----", "-------"}, {"targets/releases", keyIDs[0]}}, rows(output))
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--keys-only", "--paths-only")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot be used together")
 }
 
-func TestClientTUFRemoveWithAutoPublish(t *testing.T) {
-	// -- setup --
+// A key generated for a delegation role and GUN can be added to the
+// delegation by its ID, and then signs the delegation's targets
+func TestClientDelegationAddLocalKey(t *testing.T) {
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
@@ -2223,58 +4758,58 @@ func TestClientTUFRemoveWithAutoPublish(t *testing.T) {
 	server := setupServer()
 	defer server.Close()
 
-	tempFile, err := ioutil.TempFile("", "targetfile")
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
-	tempFile.Close()
-	defer os.Remove(tempFile.Name())
 
-	var (
-		target              = "ShangXi"
-		targetWillBeRemoved = "Shen-zinSu"
-		gun                 = "MistsOfPandaria"
-	)
-	// -- tests --
+	generate := func(args ...string) string {
+		output, err := runCommand(t, tempDir, append([]string{"key", "generate", data.ECDSAKey}, args...)...)
+		require.NoError(t, err)
+		match := regexp.MustCompile("keyID: ([0-9a-f]{64})").FindStringSubmatch(output)
+		require.Len(t, match, 2)
+		return match[1]
+	}
+	keyID := generate("--role", "targets/releases", "--gun", "gun")
+	otherRole := generate("--role", "targets/qa", "--gun", "gun")
+	otherGUN := generate("--role", "targets/releases", "--gun", "othergun")
 
-	// init repo with auto publish being enabled
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "-p", gun)
-	require.NoError(t, err)
-	// add a target with auto publish being enabled
-	_, err = runCommand(t, tempDir, "add", "-s", server.URL, "-p", gun, target, tempFile.Name())
-	require.NoError(t, err)
-	_, err = runCommand(t, tempDir, "add", "-s", server.URL, "-p", gun, targetWillBeRemoved, tempFile.Name())
-	require.NoError(t, err)
-	// remove a target with auto publish being enabled
-	_, err = runCommand(t, tempDir, "remove", "-s", server.URL, "-p", gun, targetWillBeRemoved, tempFile.Name())
-	require.NoError(t, err)
-	// list repo - expect target
-	output, err := runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	output, err := runCommand(t, tempDir, "key", "list")
 	require.NoError(t, err)
-	require.Contains(t, output, target)
-	require.False(t, strings.Contains(output, targetWillBeRemoved))
+	require.Regexp(t, "targets/releases +gun +"+keyID, output)
 
-	// remove a target without auto publish being enabled
-	//
-	// Use this test to guarantee that we won't break the normal remove process.
-	_, err = runCommand(t, tempDir, "add", "-s", server.URL, "-p", gun, targetWillBeRemoved, tempFile.Name())
+	// the key must have been generated for the delegation
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", "--key-id", otherRole, "--all-paths")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "generated for role targets/qa")
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", "--key-id", otherGUN, "--all-paths")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "generated for othergun")
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", "--key-id", strings.Repeat("0", 64), "--all-paths")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no local key")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/releases", "--key-id", keyID, "--all-paths", "-p")
 	require.NoError(t, err)
-	// remove the targetWillBeRemoved without auto publish being enabled
-	_, err = runCommand(t, tempDir, "remove", gun, targetWillBeRemoved, tempFile.Name())
+	require.Contains(t, output, keyID)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	// check status - expect the targetWillBeRemoved
-	output, err = runCommand(t, tempDir, "status", gun)
+	require.Contains(t, output, keyID)
+
+	// the delegation's targets are signed with the key
+	tempFile, err := ioutil.TempFile("", "targetfile")
 	require.NoError(t, err)
-	require.Contains(t, output, targetWillBeRemoved)
-	// publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", gun)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "v1", tempFile.Name(), "--roles", "targets/releases", "-p")
 	require.NoError(t, err)
-	// list repo - expect only the target, not the targetWillBeRemoved
-	output, err = runCommand(t, tempDir, "-s", server.URL, "list", gun)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--roles", "targets/releases")
 	require.NoError(t, err)
-	require.Contains(t, output, target)
-	require.False(t, strings.Contains(output, targetWillBeRemoved))
+	require.Contains(t, output, "v1")
 }
 
-func TestClientDelegationAddWithAutoPublish(t *testing.T) {
+// Key IDs are listed in full unless --short, or the keys.short_ids
+// configuration, asks for them to be shortened, and commands taking the ID
+// of a local key accept a unique prefix of it
+func TestClientShortKeyIDs(t *testing.T) {
 	setUp(t)
 
 	tempDir := tempDirWithConfig(t, "{}")
@@ -2283,54 +4818,63 @@ func TestClientDelegationAddWithAutoPublish(t *testing.T) {
 	server := setupServer()
 	defer server.Close()
 
-	// Setup certificate
-	tempFile, err := ioutil.TempFile("", "pemfile")
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
 	require.NoError(t, err)
 
-	privKey, err := utils.GenerateECDSAKey(rand.Reader)
-	require.NoError(t, err)
-	startTime := time.Now()
-	endTime := startTime.AddDate(10, 0, 0)
-	cert, err := cryptoservice.GenerateCertificate(privKey, "gun", startTime, endTime)
+	output, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "targets/releases", "--gun", "gun")
 	require.NoError(t, err)
+	match := regexp.MustCompile("keyID: ([0-9a-f]{64})").FindStringSubmatch(output)
+	require.Len(t, match, 2)
+	keyID := match[1]
 
-	_, err = tempFile.Write(utils.CertToPEM(cert))
+	// the prefix length needed depends on all the keys listed
+	output, err = runCommand(t, tempDir, "key", "list")
 	require.NoError(t, err)
-	tempFile.Close()
-	defer os.Remove(tempFile.Name())
+	require.Contains(t, output, keyID)
+	listed := regexp.MustCompile("[0-9a-f]{64}").FindAllString(output, -1)
+	short := shortKeyID(keyID, shortKeyIDLength(listed))
 
-	rawPubBytes, _ := ioutil.ReadFile(tempFile.Name())
-	parsedPubKey, _ := utils.ParsePEMPublicKey(rawPubBytes)
-	keyID, err := utils.CanonicalKeyID(parsedPubKey)
+	output, err = runCommand(t, tempDir, "key", "list", "--short")
 	require.NoError(t, err)
+	require.NotContains(t, output, keyID)
+	require.Regexp(t, "targets/releases +gun +"+short+" ", output)
 
-	var output string
-
-	// -- tests --
-
-	// init and publish repo
-	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	// the configuration makes short key IDs the default, which the flag can
+	// turn off
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "config.json"), []byte(`{"keys": {"short_ids": true}}`), 0644))
+	output, err = runCommand(t, tempDir, "key", "list")
+	require.NoError(t, err)
+	require.NotContains(t, output, keyID)
+	require.Regexp(t, "targets/releases +gun +"+short+" ", output)
+	output, err = runCommand(t, tempDir, "key", "list", "--short=false")
 	require.NoError(t, err)
+	require.Contains(t, output, keyID)
 
-	// list delegations - none yet
+	// a delegation can be added by a prefix of the key ID, and its key IDs
+	// listed shortened
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "gun", "targets/releases", "--key-id", short, "--all-paths", "-p")
+	require.NoError(t, err)
+	require.Contains(t, output, keyID)
 	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "No delegations present in this repository.")
-
-	// add new valid delegation with single new cert, and no path
-	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "add", "-p", "gun", "targets/delegation", tempFile.Name())
+	require.NotContains(t, output, keyID)
+	require.Contains(t, output, short)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--short=false")
 	require.NoError(t, err)
+	require.Contains(t, output, keyID)
 
-	// check status - no changelist
-	output, err = runCommand(t, tempDir, "status", "gun")
+	// a key can be exported, and its passphrase changed, by a prefix of its ID
+	output, err = runCommand(t, tempDir, "key", "export", "--key", short)
 	require.NoError(t, err)
-	require.Contains(t, output, "No unpublished changes for gun")
-
-	// list delegations - we should see our added delegation, with no paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.Contains(t, output, "role: targets/releases")
+	output, err = runCommand(t, tempDir, "key", "passwd", short)
 	require.NoError(t, err)
-	require.Contains(t, output, "targets/delegation")
-	require.Contains(t, output, keyID)
+	require.Contains(t, output, "Successfully updated passphrase for key ID: "+keyID)
+
+	// a prefix which matches no key is reported as an invalid key ID
+	_, err = runCommand(t, tempDir, "key", "passwd", "ffffffffffff")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid key ID")
 }
 
 func TestClientDelegationRemoveWithAutoPublish(t *testing.T) {
@@ -2437,6 +4981,128 @@ func TestClientDelegationRemoveWithAutoPublish(t *testing.T) {
 
 // TestClientTUFAddByHashWithAutoPublish is similar to TestClientTUFAddByHashInteraction,
 // but with the auto publish flag "-p".
+// Only the hashes asked for with --hash-algos are computed and published for
+// a target added from a file, and by default all the supported ones are
+func TestClientTUFAddHashAlgos(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	targetData := []byte{'a', 'b', 'c'}
+	target256Bytes := sha256.Sum256(targetData)
+	tempFile := filepath.Join(tempDir, "tempfile")
+	require.NoError(t, ioutil.WriteFile(tempFile, targetData, 0644))
+
+	// -- tests --
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "add", "gun", "only256", tempFile, "--hash-algos", "SHA256")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "default", tempFile)
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "unsupported", tempFile, "--hash-algos", "sha256,md5")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported hash algorithm")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	repo, err := client.NewFileCachedRepository(tempDir, "gun", server.URL, http.DefaultTransport, nil, trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+
+	only256, err := repo.GetTargetByName("only256")
+	require.NoError(t, err)
+	require.Equal(t, data.Hashes{notary.SHA256: target256Bytes[:]}, only256.Hashes)
+
+	defaultTarget, err := repo.GetTargetByName("default")
+	require.NoError(t, err)
+	require.Len(t, defaultTarget.Hashes, len(data.NotaryDefaultHashes))
+	require.Equal(t, target256Bytes[:], []byte(defaultTarget.Hashes[notary.SHA256]))
+
+	_, err = repo.GetTargetByName("unsupported")
+	require.Error(t, err)
+}
+
+// status --expired-only lists only the roles whose published metadata has
+// expired, or expires within --expiring-within, even though the expired
+// metadata can't otherwise be read
+func TestClientTUFStatusExpiredOnly(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, privKey, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	delgName := "targets/releases"
+	keyStore, err := trustmanager.NewKeyFileStore(tempDir, passphrase.ConstantRetriever(testPassphrase))
+	require.NoError(t, err)
+	require.NoError(t, keyStore.AddKey(trustmanager.KeyInfo{Gun: "gun", Role: data.RoleName(delgName)}, privKey))
+
+	// publish the targets signed so long ago that they expire an hour from now
+	pastClock := data.FixedClock(time.Now().Add(-notary.NotaryTargetsExpiry + time.Hour))
+	_, err = runCommandAt(t, pastClock, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", delgName, tempFile.Name(), "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "addhash", "gun", "release", "100", "--sha256", strings.Repeat("a", 64), "-r", delgName)
+	require.NoError(t, err)
+	_, err = runCommandAt(t, pastClock, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// -- tests --
+	output, err := runCommand(t, tempDir, "-s", server.URL, "status", "gun", "--expired-only")
+	require.NoError(t, err)
+	require.Contains(t, output, "No roles of gun have expired")
+
+	// re-signing the delegation also re-signs the snapshot, and the server
+	// signs a new timestamp, so that only the targets go on to expire
+	_, err = runCommand(t, tempDir, "-s", server.URL, "witness", "-p", "gun", delgName)
+	require.NoError(t, err)
+
+	laterClock := data.FixedClock(time.Now().Add(2 * time.Hour))
+	_, err = runCommandAt(t, laterClock, tempDir, "-s", server.URL, "list", "gun")
+	require.Error(t, err)
+
+	output, err = runCommandAt(t, laterClock, tempDir, "-s", server.URL, "status", "gun", "--expired-only")
+	require.NoError(t, err)
+	require.Contains(t, output, "Roles of gun which need re-signing")
+	require.Regexp(t, `(?m)^\s*targets\s+\d+\s+\S+\s+expired\s*$`, output)
+	for _, fresh := range []string{delgName, data.CanonicalRootRole.String(), data.CanonicalSnapshotRole.String(), data.CanonicalTimestampRole.String()} {
+		require.NotRegexp(t, `(?m)^\s*`+fresh+`\s`, output)
+	}
+	require.NotContains(t, output, "Unpublished changes")
+
+	// the delegation expires a full targets expiry after it was re-signed,
+	// and the root long after that
+	output, err = runCommandAt(t, laterClock, tempDir, "-s", server.URL, "status", "gun", "--expired-only", "--expiring-within", "30000h")
+	require.NoError(t, err)
+	require.Regexp(t, `(?m)^\s*targets\s+\d+\s+\S+\s+expired\s*$`, output)
+	require.Regexp(t, `(?m)^\s*targets/releases\s+\d+\s+\S+\s+expiring\s*$`, output)
+	require.NotRegexp(t, `(?m)^\s*root\s`, output)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "status", "gun", "--expired-only", "--diff-remote")
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "status", "gun", "--expiring-within", "1h")
+	require.Error(t, err)
+}
+
 func TestClientTUFAddByHashWithAutoPublish(t *testing.T) {
 	// -- setup --
 	setUp(t)
@@ -3027,3 +5693,209 @@ func TestDelegationKeyImportExport(t *testing.T) {
 	_, err = runCommand(t, tempImportingDir, "key", "import", filepath.Join(tempExportedDir, "exported"))
 	require.NoError(t, err)
 }
+
+// Changes staged on a machine without keys are exported, signed on a machine
+// which holds the keys but never contacts the server, and published from the
+// machine without keys
+func TestClientOfflineSigningFlow(t *testing.T) {
+	setUp(t)
+
+	server := setupServer()
+	defer server.Close()
+
+	offlineDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(offlineDir)
+	onlineDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(onlineDir)
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+	bundleFile := filepath.Join(onlineDir, "bundle.json")
+
+	// the repository is created where the keys are, and staged where they aren't
+	_, err = runCommand(t, offlineDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, onlineDir, "-s", server.URL, "add", "gun", "v1", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, onlineDir, "-s", server.URL, "publish", "gun")
+	require.Error(t, err)
+
+	// nothing can be signed or published before the bundle is exported
+	_, err = runCommand(t, onlineDir, "-s", server.URL, "offline", "import", "gun", bundleFile)
+	require.Error(t, err)
+	output, err := runCommand(t, onlineDir, "-s", server.URL, "offline", "export", "gun", bundleFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "Exported 1 staged changes")
+	_, err = runCommand(t, onlineDir, "-s", server.URL, "offline", "import", "gun", bundleFile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "has not been signed")
+
+	// the server given to the offline machine is never contacted
+	output, err = runCommand(t, offlineDir, "-s", "https://unreachable.invalid", "offline", "sign", "gun", bundleFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "Signed 1 changes")
+	_, err = runCommand(t, offlineDir, "offline", "sign", "gun", bundleFile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already been signed")
+
+	output, err = runCommand(t, onlineDir, "-s", server.URL, "offline", "import", "gun", bundleFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "Published 1 changes")
+
+	output, err = runCommand(t, onlineDir, "-s", server.URL, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes")
+	output, err = runCommand(t, offlineDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v1")
+
+	// the keys never left the offline machine
+	output, err = runCommand(t, onlineDir, "key", "list")
+	require.NoError(t, err)
+	require.Contains(t, output, "No signing keys found")
+}
+
+// Rebuilding the cache of a GUN recovers from corrupted metadata, without
+// touching the keys or the staged changes
+func TestClientCacheRebuild(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "published", tempFile.Name(), "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "staged", tempFile.Name())
+	require.NoError(t, err)
+
+	metadataDir := filepath.Join(tempDir, "tuf", "gun", "metadata")
+	for _, role := range data.BaseRoles {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(metadataDir, role.String()+".json"), []byte("corrupted"), 0644))
+	}
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.Error(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "cache", "rebuild")
+	require.Error(t, err)
+	output, err := runCommand(t, tempDir, "-s", server.URL, "cache", "rebuild", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "Rebuilt the cached metadata for gun")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "published")
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "staged")
+
+	// the keys are intact, so the staged change can still be published
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "staged")
+}
+
+// Staged changes exported and imported again are staged exactly as they were,
+// and can be published
+func TestClientChangelistExportImport(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	certFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = certFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	certFile.Close()
+	defer os.Remove(certFile.Name())
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "old", tempFile.Name(), "-p")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "add", "gun", "new", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "remove", "gun", "old")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/releases", certFile.Name(), "--all-paths")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "witness", "gun", "targets")
+	require.NoError(t, err)
+
+	exported, err := runCommand(t, tempDir, "changelist", "export", "gun")
+	require.NoError(t, err)
+	var changes []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(exported), &changes))
+	require.Len(t, changes, 5)
+	require.Equal(t, "new", changes[0]["path"])
+	require.Equal(t, "target", changes[0]["type"])
+	require.Contains(t, changes[0]["content"], "hashes")
+
+	exportFile := filepath.Join(tempDir, "changes.json")
+	output, err := runCommand(t, tempDir, "changelist", "export", "gun", "-o", exportFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "Exported 5 change(s) for gun")
+	statusBefore, err := runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "reset", "gun", "--all")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
+
+	// invalid changes are rejected without staging anything
+	badFile := filepath.Join(tempDir, "bad.json")
+	require.NoError(t, ioutil.WriteFile(badFile, []byte(`[{"action": "create", "scope": "targets", "type": "target", "path": "bad"}]`), 0644))
+	_, err = runCommand(t, tempDir, "changelist", "import", "gun", badFile)
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "changelist", "import", "gun")
+	require.Error(t, err)
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes for gun")
+
+	output, err = runCommand(t, tempDir, "changelist", "import", "gun", exportFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "Staged 5 change(s) for gun")
+	reexported, err := runCommand(t, tempDir, "changelist", "export", "gun")
+	require.NoError(t, err)
+	require.Equal(t, exported, reexported)
+	statusAfter, err := runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Equal(t, statusBefore, statusAfter)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "new")
+	require.NotContains(t, output, "old")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+}
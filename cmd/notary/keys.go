@@ -1,6 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -8,8 +13,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -38,7 +45,7 @@ var cmdKeyListTemplate = usageTemplate{
 var cmdRotateKeyTemplate = usageTemplate{
 	Use:   "rotate [ GUN ] [ key role ]",
 	Short: "Rotate a signing (non-root) key of the given type for the given Globally Unique Name and role.",
-	Long:  `Generates a new key for the given Globally Unique Name and role (one of "snapshot", "targets", "root", or "timestamp").  If rotating to a server-managed key, a new key is requested from the server rather than generated.  If the generation or key request is successful, the key rotation is immediately published.  No other changes, even if they are staged, will be published.`,
+	Long:  `Generates a new key for the given Globally Unique Name and role (one of "snapshot", "targets", "root", or "timestamp").  If rotating to a server-managed key, a new key is requested from the server rather than generated.  If the generation or key request is successful, the key rotation is immediately published.  No other changes, even if they are staged, will be published.  With --all-local-to-server, instead rotates the snapshot key, and with --timestamp also the timestamp key, of every locally cached Globally Unique Name to a server-managed key.`,
 }
 
 var cmdKeyGenerateKeyTemplate = usageTemplate{
@@ -52,13 +59,21 @@ var cmdKeyGenerateKeyTemplate = usageTemplate{
 		"be written, <output>.pem and <output>-key.pem, containing the public" +
 		"and private keys respectively (the key will not be stored in Notary's " +
 		"key storage, including any connected hardware storage). If no `--role` " +
-		"is provided, \"root\" will be assumed.",
+		"is provided, \"root\" will be assumed. If `--paper` is provided, a " +
+		"printable backup of the encrypted private key is also written to stdout, " +
+		"which can be restored with `notary key recover`.",
+}
+
+var cmdKeyRecoverTemplate = usageTemplate{
+	Use:   "recover [ backup file ]",
+	Short: "Recovers a key from a paper backup.",
+	Long:  "Recovers a key from a paper backup created by `notary key generate --paper`, reading the backup from the given file or, if none is given, from stdin.  The key remains encrypted with the passphrase it was generated with, and is imported into the local keystore, or written to the file given by the `--output` flag.",
 }
 
 var cmdKeyRemoveTemplate = usageTemplate{
 	Use:   "remove [ keyID ]",
 	Short: "Removes the key with the given keyID.",
-	Long:  "Removes the key with the given keyID.  If the key is stored in more than one location, you will be asked which one to remove.",
+	Long:  "Removes the key with the given keyID.  If the key is stored in more than one location, you will be asked which one to remove.  With the `--gun` flag, instead removes all the keys for the given Global Unique Name, apart from its root keys unless `--include-root` is also given.",
 }
 
 var cmdKeyPasswdTemplate = usageTemplate{
@@ -88,20 +103,43 @@ type keyCommander struct {
 	rotateKeyRole          string
 	rotateKeyServerManaged bool
 	rotateKeyFiles         []string
+	rotateKeyDryRun        bool
+	rotateKeyReclaim       bool
+	rotateAllLocal         bool
+	rotateAllTimestamp     bool
+	rotateAllYes           bool
+	rotateAllConcurrency   int
 	legacyVersions         int
 	input                  io.Reader
 
 	importRole    string
 	generateRole  string
+	generateGUN   string
 	keysImportGUN string
 	exportGUNs    []string
 	exportKeyIDs  []string
 	outFile       string
+	paper         bool
+	generateCount int
+	passPerKey    bool
+	generateLabel string
+	stdoutPublic  bool
+	stdoutCSR     string
+
+	removeGUN         string
+	removeIncludeRoot bool
+	removeYes         bool
+
+	short bool
 }
 
 func (k *keyCommander) GetCommand() *cobra.Command {
 	cmd := cmdKeyTemplate.ToCommand(nil)
-	cmd.AddCommand(cmdKeyListTemplate.ToCommand(k.keysList))
+	cmdList := cmdKeyListTemplate.ToCommand(k.keysList)
+	cmdList.Flags().BoolVar(
+		&k.short, "short", false, "Show the shortest prefix of each key ID, of at least 7 characters, which tells it apart from the others listed",
+	)
+	cmd.AddCommand(cmdList)
 	cmdGenerate := cmdKeyGenerateKeyTemplate.ToCommand(k.keysGenerate)
 	cmdGenerate.Flags().StringVarP(
 		&k.outFile,
@@ -113,8 +151,45 @@ func (k *keyCommander) GetCommand() *cobra.Command {
 	cmdGenerate.Flags().StringVarP(
 		&k.generateRole, "role", "r", "root", "Role to generate key with, defaulting to \"root\".",
 	)
+	cmdGenerate.Flags().StringVarP(
+		&k.generateGUN, "gun", "g", "", "GUN the key is generated for, which can't be given for a root key",
+	)
+	cmdGenerate.Flags().BoolVar(
+		&k.paper, "paper", false, "Print a backup of the encrypted private key suitable for offline storage",
+	)
+	cmdGenerate.Flags().IntVar(
+		&k.generateCount, "count", 1, "Number of keys to generate. With --output, the files of each key are suffixed with its number",
+	)
+	cmdGenerate.Flags().BoolVar(
+		&k.passPerKey, "passphrase-per-key", false, "When generating more than one key, ask for a passphrase for each key rather than using the same one for all of them",
+	)
+	cmdGenerate.Flags().StringVar(
+		&k.generateLabel, "label", "", "Label noting what the key is for, stored with the key and shown when listing keys",
+	)
+	cmdGenerate.Flags().BoolVar(
+		&k.stdoutPublic, "stdout-public", false, "Print the PEM-encoded public key of the generated key, for enrolling it with an external service",
+	)
+	cmdGenerate.Flags().StringVar(
+		&k.stdoutCSR, "stdout-csr", "", "Print a PEM-encoded certificate signing request for the generated key, with this common name",
+	)
 	cmd.AddCommand(cmdGenerate)
-	cmd.AddCommand(cmdKeyRemoveTemplate.ToCommand(k.keyRemove))
+	cmdRecover := cmdKeyRecoverTemplate.ToCommand(k.keysRecover)
+	cmdRecover.Flags().StringVarP(
+		&k.outFile,
+		"output",
+		"o",
+		"",
+		"Filepath to write the recovered private key to, instead of importing it",
+	)
+	cmd.AddCommand(cmdRecover)
+	cmdRemove := cmdKeyRemoveTemplate.ToCommand(k.keyRemove)
+	cmdRemove.Flags().StringVarP(
+		&k.removeGUN, "gun", "g", "", "Remove all the keys for this GUN, instead of a single key")
+	cmdRemove.Flags().BoolVar(
+		&k.removeIncludeRoot, "include-root", false, "Also remove the root keys of the GUN given by --gun, which may be shared with other GUNs")
+	cmdRemove.Flags().BoolVarP(
+		&k.removeYes, "yes", "y", false, "Answer yes to the removal question (no confirmation)")
+	cmd.AddCommand(cmdRemove)
 	cmd.AddCommand(cmdKeyPasswdTemplate.ToCommand(k.keyPassphraseChange))
 	cmdRotateKey := cmdRotateKeyTemplate.ToCommand(k.keysRotate)
 	cmdRotateKey.Flags().BoolVarP(&k.rotateKeyServerManaged, "server-managed", "r",
@@ -129,6 +204,19 @@ func (k *keyCommander) GetCommand() *cobra.Command {
 		nil,
 		"New key(s) to rotate to. If not specified, one will be generated.",
 	)
+	cmdRotateKey.Flags().BoolVar(&k.rotateKeyDryRun, "dry-run", false,
+		"Print the change the rotation would make, without generating or importing any keys or publishing anything")
+	cmdRotateKey.Flags().BoolVar(&k.rotateKeyReclaim, "reclaim", false,
+		"Rotate a key currently managed by the remote server back to a key generated and stored locally. "+
+			"Only valid for the snapshot role")
+	cmdRotateKey.Flags().BoolVar(&k.rotateAllLocal, "all-local-to-server", false,
+		"Rotate the snapshot key of every locally cached GUN to a key managed by the remote server, instead of a single GUN's key")
+	cmdRotateKey.Flags().BoolVar(&k.rotateAllTimestamp, "timestamp", false,
+		"With --all-local-to-server, also rotate the timestamp key of every GUN")
+	cmdRotateKey.Flags().BoolVarP(&k.rotateAllYes, "yes", "y", false,
+		"Confirm the rotation of every GUN with --all-local-to-server; without it, the GUNs are only listed")
+	cmdRotateKey.Flags().IntVar(&k.rotateAllConcurrency, "concurrency", defaultRotateAllConcurrency,
+		"With --all-local-to-server, how many GUNs to rotate at once")
 	cmd.AddCommand(cmdRotateKey)
 
 	cmdKeysImport := cmdKeyImportTemplate.ToCommand(k.importKeys)
@@ -177,7 +265,7 @@ func (k *keyCommander) keysList(cmd *cobra.Command, args []string) error {
 	}
 
 	cmd.Println("")
-	prettyPrintKeys(ks, cmd.OutOrStdout())
+	prettyPrintKeys(ks, useShortKeyIDs(cmd, k.short, config), cmd.OutOrStdout())
 	cmd.Println("")
 	return nil
 }
@@ -207,6 +295,25 @@ func (k *keyCommander) keysGenerate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("algorithm not allowed, possible values are: ECDSA")
 	}
 
+	if k.generateCount < 1 {
+		return fmt.Errorf("must generate at least 1 key")
+	}
+	if err := tufutils.ValidateKeyLabel(k.generateLabel); err != nil {
+		return err
+	}
+	if err := validateGenerateRole(data.RoleName(k.generateRole), data.GUN(k.generateGUN)); err != nil {
+		return err
+	}
+	if k.generateCount > 1 {
+		if k.paper {
+			return fmt.Errorf("--paper can only be used when generating a single key")
+		}
+		if k.stdoutPublic || k.stdoutCSR != "" {
+			return fmt.Errorf("--stdout-public and --stdout-csr can only be used when generating a single key")
+		}
+		return k.generateKeyPool(cmd, algorithm)
+	}
+
 	config, err := k.configGetter()
 	if err != nil {
 		return err
@@ -218,29 +325,215 @@ func (k *keyCommander) keysGenerate(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
-		cs := cryptoservice.NewCryptoService(ks...)
-
-		pubKey, err := cs.Create(data.RoleName(k.generateRole), "", algorithm)
+		privKey, err := generateKeyToStores(cmd, ks, k.generateRole, k.generateGUN, algorithm, k.generateLabel)
 		if err != nil {
-			return fmt.Errorf("failed to create a new %s key: %v", k.generateRole, err)
+			return err
+		}
+		if err := k.printEnrollment(cmd, privKey); err != nil {
+			return err
+		}
+		if !k.paper {
+			return nil
 		}
 
-		cmd.Printf("Generated new %s %s key with keyID: %s\n", algorithm, k.generateRole, pubKey.ID())
-		return nil
+		// the key is backed up as it is stored on disk, so it stays encrypted
+		fileStore, err := store.NewPrivateKeyFileStorage(config.GetString("trust_dir"), notary.KeyExtension)
+		if err != nil {
+			return err
+		}
+		var pemBytes bytes.Buffer
+		if err := trustmanager.ExportKeysByID(&pemBytes, fileStore, []string{privKey.ID()}); err != nil {
+			return err
+		}
+		return printPaperBackup(cmd, pemBytes.Bytes())
 	}
 
 	// if we had an outfile set, we'll write 2 files with the given name, appending .pem and -key.pem for the
 	// public and private keys respectively
-	return generateKeyToFile(k.generateRole, algorithm, k.getRetriever(), k.outFile)
+	privKey, err := generateKeyToFile(k.generateRole, k.generateGUN, algorithm, k.generateLabel, k.getRetriever(), k.outFile)
+	if err != nil {
+		return err
+	}
+	if err := k.printEnrollment(cmd, privKey); err != nil || !k.paper {
+		return err
+	}
+
+	pemBytes, err := ioutil.ReadFile(k.outFile + "-key.pem")
+	if err != nil {
+		return err
+	}
+	// add the path header, as on export, so that the recovered key can be
+	// imported
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return fmt.Errorf("could not read generated private key")
+	}
+	block.Headers["path"] = privKey.ID()
+	return printPaperBackup(cmd, pem.EncodeToMemory(block))
 }
 
-func generateKeyToFile(role, algorithm string, retriever notary.PassRetriever, outFile string) error {
+// generateKeyPool generates a batch of keys in one go, for environments which
+// provision keys ahead of time.  The key stores, and so the passphrase
+// retriever, are shared by the whole batch unless a passphrase is asked for
+// each key, in which case every key gets its own retriever.
+func (k *keyCommander) generateKeyPool(cmd *cobra.Command, algorithm string) error {
+	config, err := k.configGetter()
+	if err != nil {
+		return err
+	}
+
+	var (
+		ks        []trustmanager.KeyStore
+		retriever notary.PassRetriever
+	)
+	for i := 1; i <= k.generateCount; i++ {
+		if i == 1 || k.passPerKey {
+			if k.outFile == "" {
+				if ks, err = k.getKeyStores(config, true, true); err != nil {
+					return err
+				}
+			} else {
+				retriever = k.getRetriever()
+			}
+		}
+
+		if k.outFile == "" {
+			if _, err := generateKeyToStores(cmd, ks, k.generateRole, k.generateGUN, algorithm, k.generateLabel); err != nil {
+				return err
+			}
+			continue
+		}
+		outFile := fmt.Sprintf("%s-%d", k.outFile, i)
+		privKey, err := generateKeyToFile(k.generateRole, k.generateGUN, algorithm, k.generateLabel, retriever, outFile)
+		if err != nil {
+			return err
+		}
+		cmd.Printf("Generated new %s %s key with keyID: %s\n", algorithm, k.generateRole, privKey.ID())
+	}
+	return nil
+}
+
+// validateGenerateRole checks that a key can be generated for the role, which
+// must be a canonical role or a delegation role, and for the GUN if one is
+// given.  Root keys may be shared between GUNs, so can't be generated for one.
+func validateGenerateRole(role data.RoleName, gun data.GUN) error {
+	if !data.ValidRole(role) {
+		return fmt.Errorf("invalid role %q: must be one of the canonical roles or a delegation role such as targets/releases", role)
+	}
+	if gun != "" && role == data.CanonicalRootRole {
+		return fmt.Errorf("--gun can't be given when generating a root key")
+	}
+	return nil
+}
+
+// generateKeyToStores creates a new key, with an optional label, in the first
+// of the given key stores which can hold it, and reports its ID
+func generateKeyToStores(cmd *cobra.Command, ks []trustmanager.KeyStore, role, gun, algorithm, label string) (data.PrivateKey, error) {
 	privKey, err := tufutils.GenerateKey(algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a new %s key: %v", role, err)
+	}
+	cs := cryptoservice.NewCryptoService(ks...)
+	if err := cs.AddKeyWithInfo(trustmanager.KeyInfo{Role: data.RoleName(role), Gun: data.GUN(gun), Label: label, KeepGun: gun != ""}, privKey); err != nil {
+		return nil, fmt.Errorf("failed to create a new %s key: %v", role, err)
+	}
+	cmd.Printf("Generated new %s %s key with keyID: %s\n", algorithm, role, privKey.ID())
+	return privKey, nil
+}
+
+// publicKeyPEM encodes the public part of a key as PEM, noting its role
+func publicKeyPEM(pubKey data.PublicKey, role string) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type: "PUBLIC KEY",
+		Headers: map[string]string{
+			"role": role,
+		},
+		Bytes: pubKey.Public(),
+	})
+}
+
+// printEnrollment prints the public key of a newly generated key, and a
+// certificate signing request for it, if they were asked for, so that the key
+// can be enrolled with an external service without exporting it
+func (k *keyCommander) printEnrollment(cmd *cobra.Command, privKey data.PrivateKey) error {
+	out := cmd.OutOrStdout()
+	if k.stdoutPublic {
+		if _, err := out.Write(publicKeyPEM(data.PublicKeyFromPrivate(privKey), k.generateRole)); err != nil {
+			return err
+		}
+	}
+	if k.stdoutCSR == "" {
+		return nil
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: k.stdoutCSR}}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, privKey.CryptoSigner())
+	if err != nil {
+		return fmt.Errorf("could not create a certificate signing request: %v", err)
+	}
+	_, err = out.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	return err
+}
+
+func printPaperBackup(cmd *cobra.Command, pemBytes []byte) error {
+	backup, err := trustmanager.EncodePaperBackup(pemBytes)
 	if err != nil {
 		return err
 	}
-	pubKey := data.PublicKeyFromPrivate(privKey)
+	cmd.Println("\nPaper backup of the encrypted private key, which can be restored with `notary key recover`.")
+	cmd.Print("The passphrase for the key is still needed to use it, and should be stored separately.\n\n")
+	cmd.Print(backup)
+	return nil
+}
+
+func (k *keyCommander) keysRecover(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		cmd.Usage()
+		return fmt.Errorf("must specify at most one backup file to recover the key from")
+	}
+
+	var from io.Reader = cmd.InOrStdin()
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		from = f
+	}
+	backup, err := ioutil.ReadAll(from)
+	if err != nil {
+		return err
+	}
+	pemBytes, err := trustmanager.DecodePaperBackup(string(backup))
+	if err != nil {
+		return err
+	}
+
+	if k.outFile != "" {
+		return ioutil.WriteFile(k.outFile, pemBytes, notary.PrivNoExecPerms)
+	}
+
+	config, err := k.configGetter()
+	if err != nil {
+		return err
+	}
+	importers, err := getImporters(config.GetString("trust_dir"), k.getRetriever())
+	if err != nil {
+		return err
+	}
+	if err := trustmanager.ImportKeys(bytes.NewReader(pemBytes), importers, "", "", k.getRetriever()); err != nil {
+		return err
+	}
+	block, _ := pem.Decode(pemBytes)
+	cmd.Printf("Recovered key with keyID: %s\n", block.Headers["path"])
+	return nil
+}
 
+func generateKeyToFile(role, gun, algorithm, label string, retriever notary.PassRetriever, outFile string) (data.PrivateKey, error) {
+	privKey, err := tufutils.GenerateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
 	var (
 		chosenPassphrase string
 		giveup           bool
@@ -253,17 +546,20 @@ func generateKeyToFile(role, algorithm string, retriever notary.PassRetriever, o
 			break
 		}
 		if giveup || attempts > 10 {
-			return trustmanager.ErrAttemptsExceeded{}
+			return nil, trustmanager.ErrAttemptsExceeded{}
 		}
 	}
 
 	if chosenPassphrase != "" {
-		pemPrivKey, err = tufutils.ConvertPrivateKeyToPKCS8(privKey, data.RoleName(role), "", chosenPassphrase)
+		pemPrivKey, err = tufutils.ConvertPrivateKeyToPKCS8(privKey, data.RoleName(role), data.GUN(gun), chosenPassphrase)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if pemPrivKey, err = tufutils.LabelPrivateKey(pemPrivKey, label); err != nil {
+			return nil, err
 		}
 	} else {
-		return errors.New("no password provided")
+		return nil, errors.New("no password provided")
 	}
 
 	privFileName := strings.Join([]string{outFile, "key"}, "-")
@@ -272,20 +568,15 @@ func generateKeyToFile(role, algorithm string, retriever notary.PassRetriever, o
 
 	err = ioutil.WriteFile(privFile, pemPrivKey, notary.PrivNoExecPerms)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	pubPEM := pem.Block{
-		Type: "PUBLIC KEY",
-		Headers: map[string]string{
-			"role": role,
-		},
-		Bytes: pubKey.Public(),
-	}
-	return ioutil.WriteFile(pubFile, pem.EncodeToMemory(&pubPEM), notary.PrivNoExecPerms)
+	return privKey, ioutil.WriteFile(pubFile, publicKeyPEM(data.PublicKeyFromPrivate(privKey), role), notary.PrivNoExecPerms)
 }
 
 func (k *keyCommander) keysRotate(cmd *cobra.Command, args []string) error {
+	if k.rotateAllLocal {
+		return k.keysRotateAllLocalToServer(cmd, args)
+	}
 	if len(args) < 2 {
 		cmd.Usage()
 		return fmt.Errorf("must specify a GUN and a key role to rotate")
@@ -299,21 +590,21 @@ func (k *keyCommander) keysRotate(cmd *cobra.Command, args []string) error {
 	gun := data.GUN(args[0])
 	rotateKeyRole := data.RoleName(args[1])
 
-	rt, err := getTransport(config, gun, admin)
-	if err != nil {
-		return err
+	if k.rotateKeyReclaim && (k.rotateKeyServerManaged || len(k.rotateKeyFiles) > 0 || k.rotateKeyDryRun) {
+		return fmt.Errorf("--reclaim cannot be used with --server-managed, --key or --dry-run")
 	}
 
-	trustPin, err := getTrustPinning(config)
+	nRepo, err := rotationRepo(config, gun, k.getRetriever())
 	if err != nil {
 		return err
 	}
 
-	nRepo, err := notaryclient.NewFileCachedRepository(
-		config.GetString("trust_dir"), gun, getRemoteTrustServer(config),
-		rt, k.getRetriever(), trustPin)
-	if err != nil {
-		return err
+	if k.rotateKeyReclaim {
+		if err := nRepo.ReclaimKey(rotateKeyRole); err != nil {
+			return err
+		}
+		cmd.Printf("Successfully rotated %s key for repository %s back to a local key\n", rotateKeyRole, gun)
+		return nil
 	}
 
 	var keyList []string
@@ -323,13 +614,24 @@ func (k *keyCommander) keysRotate(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
-		err = nRepo.GetCryptoService().AddKey(rotateKeyRole, gun, privKey)
-		if err != nil {
-			return fmt.Errorf("error importing key: %v", err)
+		if !k.rotateKeyDryRun {
+			err = nRepo.GetCryptoService().AddKey(rotateKeyRole, gun, privKey)
+			if err != nil {
+				return fmt.Errorf("error importing key: %v", err)
+			}
 		}
 		keyList = append(keyList, privKey.ID())
 	}
 
+	if k.rotateKeyDryRun {
+		plan, err := nRepo.PlanKeyRotation(rotateKeyRole, k.rotateKeyServerManaged, keyList)
+		if err != nil {
+			return err
+		}
+		printKeyRotationPlan(cmd, gun, plan)
+		return nil
+	}
+
 	if rotateKeyRole == data.CanonicalRootRole {
 		cmd.Print("Warning: you are about to rotate your root key.\n\n" +
 			"You must use your old key to sign this root rotation.\n" +
@@ -348,6 +650,265 @@ func (k *keyCommander) keysRotate(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// rotationRepo returns the repository of a GUN, with admin access to the
+// remote server, for rotating its keys
+func rotationRepo(config *viper.Viper, gun data.GUN, retriever notary.PassRetriever) (notaryclient.Repository, error) {
+	rt, err := getTransport(config, gun, admin, retriever)
+	if err != nil {
+		return nil, err
+	}
+
+	trustPin, err := getTrustPinning(config)
+	if err != nil {
+		return nil, err
+	}
+
+	nRepo, err := notaryclient.NewFileCachedRepository(
+		config.GetString("trust_dir"), gun, getRemoteTrustServer(config),
+		rt, retriever, trustPin)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRepoConfig(config, nRepo); err != nil {
+		return nil, err
+	}
+	return nRepo, nil
+}
+
+// defaultRotateAllConcurrency is how many GUNs are rotated at once with
+// --all-local-to-server, unless --concurrency is given
+const defaultRotateAllConcurrency = 4
+
+// gunRotation is the outcome of rotating the keys of one GUN to server-managed
+// keys: the roles which were rotated, and those which were skipped because
+// their keys were already managed by the server, until any error
+type gunRotation struct {
+	gun     data.GUN
+	rotated []data.RoleName
+	skipped []data.RoleName
+	err     error
+}
+
+// keysRotateAllLocalToServer rotates the snapshot key, and optionally the
+// timestamp key, of every GUN in the local cache to keys managed by the remote
+// server.  Each GUN is rotated and published on its own, a few at a time, so
+// that one failing does not stop the others, and every outcome is reported.
+func (k *keyCommander) keysRotateAllLocalToServer(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		cmd.Usage()
+		return fmt.Errorf("--all-local-to-server rotates every locally cached GUN, so a GUN and role cannot be given")
+	}
+	if k.rotateKeyReclaim || len(k.rotateKeyFiles) > 0 || k.rotateKeyDryRun || k.legacyVersions > 0 {
+		return fmt.Errorf("--all-local-to-server cannot be used with --reclaim, --key, --dry-run or --legacy")
+	}
+	if k.rotateAllConcurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+
+	config, err := k.configGetter()
+	if err != nil {
+		return err
+	}
+	guns, err := cachedGUNs(config.GetString("trust_dir"))
+	if err != nil {
+		return err
+	}
+	if len(guns) == 0 {
+		cmd.Println("No GUNs are cached locally.")
+		return nil
+	}
+
+	roles := []data.RoleName{data.CanonicalSnapshotRole}
+	if k.rotateAllTimestamp {
+		roles = append(roles, data.CanonicalTimestampRole)
+	}
+	cmd.Printf("The %s key(s) of the following %d GUN(s) will be rotated to keys managed by the remote server:\n",
+		strings.Join(data.RolesListToStringList(roles), " and "), len(guns))
+	for _, gun := range guns {
+		cmd.Printf("\t%s\n", gun)
+	}
+	if !k.rotateAllYes {
+		return fmt.Errorf("no keys were rotated: confirm the rotation of every GUN with --yes")
+	}
+
+	// the GUNs are rotated at once, but their passphrases are asked for in turn
+	retriever := serialRetriever(k.getRetriever())
+	results := rotateGUNsToServer(guns, roles, k.rotateAllConcurrency, func(gun data.GUN) (notaryclient.Repository, error) {
+		return rotationRepo(config, gun, retriever)
+	})
+
+	var failed int
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			cmd.Printf("%s: failed: %v\n", result.gun, result.err)
+			continue
+		}
+		var outcomes []string
+		if len(result.rotated) > 0 {
+			outcomes = append(outcomes, "rotated "+strings.Join(data.RolesListToStringList(result.rotated), ", "))
+		}
+		if len(result.skipped) > 0 {
+			outcomes = append(outcomes, strings.Join(data.RolesListToStringList(result.skipped), ", ")+" already server-managed")
+		}
+		cmd.Printf("%s: %s\n", result.gun, strings.Join(outcomes, "; "))
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to rotate the keys of %d of %d GUN(s)", failed, len(guns))
+	}
+	cmd.Printf("Successfully rotated the keys of %d GUN(s)\n", len(guns))
+	return nil
+}
+
+// rotateGUNsToServer rotates the keys of the given roles of each GUN to
+// server-managed keys, using at most workers goroutines, and returns the
+// outcome for each GUN in the order the GUNs were given.
+func rotateGUNsToServer(guns []data.GUN, roles []data.RoleName, workers int,
+	newRepo func(data.GUN) (notaryclient.Repository, error)) []gunRotation {
+
+	results := make([]gunRotation, len(guns))
+	pending := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(guns); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each worker only writes the results of its own GUNs
+			for j := range pending {
+				results[j] = rotateGUNToServer(guns[j], roles, newRepo)
+			}
+		}()
+	}
+	for j := range guns {
+		pending <- j
+	}
+	close(pending)
+	wg.Wait()
+	return results
+}
+
+// rotateGUNToServer rotates the keys of the given roles of a single GUN to
+// server-managed keys, in order, stopping at the first error.  A snapshot key
+// which is not held locally is already managed by the server, so it is
+// skipped.
+func rotateGUNToServer(gun data.GUN, roles []data.RoleName, newRepo func(data.GUN) (notaryclient.Repository, error)) gunRotation {
+	result := gunRotation{gun: gun}
+	nRepo, err := newRepo(gun)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	for _, role := range roles {
+		if role == data.CanonicalSnapshotRole {
+			local, err := hasLocalKey(nRepo, role)
+			if err != nil {
+				result.err = err
+				return result
+			}
+			if !local {
+				result.skipped = append(result.skipped, role)
+				continue
+			}
+		}
+		if err := nRepo.RotateKey(role, true, nil); err != nil {
+			result.err = fmt.Errorf("could not rotate the %s key: %v", role, err)
+			return result
+		}
+		result.rotated = append(result.rotated, role)
+	}
+	return result
+}
+
+// hasLocalKey returns whether any of the role's current keys, as listed in
+// the latest trusted metadata of the repository, is held in the local key
+// storage
+func hasLocalKey(nRepo notaryclient.Repository, role data.RoleName) (bool, error) {
+	roles, err := nRepo.ListRoles()
+	if err != nil {
+		return false, err
+	}
+	local := make(map[string]bool)
+	for _, keyID := range nRepo.GetCryptoService().ListKeys(role) {
+		local[keyID] = true
+	}
+	for _, r := range roles {
+		if r.Name != role {
+			continue
+		}
+		for _, keyID := range r.KeyIDs {
+			if local[keyID] {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// cachedGUNs returns the GUNs which have trusted metadata cached in the trust
+// directory, in lexical order
+func cachedGUNs(trustDir string) ([]data.GUN, error) {
+	tufDir := filepath.Join(trustDir, "tuf")
+	var guns []data.GUN
+	err := filepath.Walk(tufDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == tufDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.IsDir() || info.Name() != "metadata" {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, data.CanonicalRootRole.String()+".json")); err != nil {
+			return nil
+		}
+		gun, err := filepath.Rel(tufDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		guns = append(guns, data.GUN(filepath.ToSlash(gun)))
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return guns, nil
+}
+
+// serialRetriever wraps a passphrase retriever so that it is only ever asked
+// for one passphrase at a time, so that prompts are not interleaved
+func serialRetriever(retriever notary.PassRetriever) notary.PassRetriever {
+	var mu sync.Mutex
+	return func(keyName, alias string, createNew bool, attempts int) (string, bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return retriever(keyName, alias, createNew, attempts)
+	}
+}
+
+// printKeyRotationPlan prints the change a key rotation would make to a role
+func printKeyRotationPlan(cmd *cobra.Command, gun data.GUN, plan *notaryclient.KeyRotationPlan) {
+	cmd.Printf("Rotating the %s key for repository %s would:\n", plan.Role, gun)
+	for _, keyID := range plan.OldKeyIDs {
+		cmd.Printf("  remove key %s\n", keyID)
+	}
+	switch {
+	case plan.ServerManaged:
+		cmd.Println("  add a new key generated and managed by the remote server")
+	case len(plan.NewKeyIDs) == 0:
+		cmd.Println("  add a new key generated locally")
+	default:
+		for _, keyID := range plan.NewKeyIDs {
+			cmd.Printf("  add key %s\n", keyID)
+		}
+	}
+	cmd.Printf("  keep the threshold of %d, with %d key(s) able to sign\n", plan.Threshold, plan.NewKeyCount())
+	if plan.NewKeyCount() < plan.Threshold {
+		cmd.Printf("Warning: the %s role would not have enough keys to meet its threshold\n", plan.Role)
+	}
+	cmd.Println("No changes were made, since this was a dry run.")
+}
+
 func removeKeyInteractively(keyStores []trustmanager.KeyStore, keyID string,
 	in io.Reader, out io.Writer) error {
 
@@ -411,8 +972,142 @@ func removeKeyInteractively(keyStores []trustmanager.KeyStore, keyID string,
 	return nil
 }
 
+// removeGUNKeysInteractively removes all the keys for a GUN after asking for
+// confirmation, unless confirmed is set.  Root keys are not stored with a GUN,
+// so they are only removed if their IDs are in rootKeyIDs.
+func removeGUNKeysInteractively(cs *cryptoservice.CryptoService, gun data.GUN, rootKeyIDs []string,
+	confirmed bool, in io.Reader, out io.Writer) error {
+
+	removeRoot := make(map[string]bool)
+	for _, keyID := range rootKeyIDs {
+		removeRoot[keyID] = true
+	}
+
+	var keyIDs []string
+	roles := cs.ListAllKeys()
+	for keyID, role := range roles {
+		if role == data.CanonicalRootRole {
+			if removeRoot[keyID] {
+				keyIDs = append(keyIDs, keyID)
+			}
+			continue
+		}
+		keyInfo, err := cs.GetKeyInfo(keyID)
+		if err != nil {
+			return err
+		}
+		if keyInfo.Gun == gun {
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+
+	if len(keyIDs) == 0 {
+		return fmt.Errorf("no keys for %s found", gun)
+	}
+	sort.Strings(keyIDs)
+
+	fmt.Fprintf(out, "Found the following keys for %s:\n", gun)
+	for _, keyID := range keyIDs {
+		fmt.Fprintf(out, "\t%s (role %s)\n", keyID, roles[keyID])
+	}
+	if confirmed {
+		fmt.Fprintln(out, "Confirmed `yes` from flag")
+	} else {
+		fmt.Fprint(out, "Are you sure you want to remove all of them?  (yes/no)  ")
+		if !askConfirm(in) {
+			fmt.Fprintln(out, "\nAborting action.")
+			return nil
+		}
+	}
+
+	for _, keyID := range keyIDs {
+		if err := cs.RemoveKey(keyID); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "\nDeleted %d key(s) for %s.\n", len(keyIDs), gun)
+	return nil
+}
+
+// cachedRootKeyIDs returns the IDs of the private keys for the root keys in the
+// locally cached root metadata of the GUN.  These differ from the key IDs in
+// the root metadata, which are those of the root certificates.
+func cachedRootKeyIDs(trustDir string, gun data.GUN) ([]string, error) {
+	fileCache, err := store.NewFileStore(
+		filepath.Join(trustDir, "tuf", filepath.FromSlash(gun.String()), "metadata"), "json")
+	if err != nil {
+		return nil, err
+	}
+	// the metadata may have been cached compressed
+	cache := store.NewCompressedStore(fileCache, false)
+	raw, err := cache.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	signedRoot := &data.Signed{}
+	if err := json.Unmarshal(raw, signedRoot); err != nil {
+		return nil, err
+	}
+	root, err := data.RootFromSigned(signedRoot)
+	if err != nil {
+		return nil, err
+	}
+	rootRole, err := root.BuildBaseRole(data.CanonicalRootRole)
+	if err != nil {
+		return nil, err
+	}
+	var keyIDs []string
+	for _, cert := range rootRole.Keys {
+		keyID, err := tufutils.CanonicalKeyID(cert)
+		if err != nil {
+			return nil, err
+		}
+		keyIDs = append(keyIDs, keyID)
+	}
+	return keyIDs, nil
+}
+
+// keyRemoveGUN deletes all the private keys for a GUN
+func (k *keyCommander) keyRemoveGUN(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		cmd.Usage()
+		return fmt.Errorf("cannot specify both a key ID and --gun")
+	}
+
+	config, err := k.configGetter()
+	if err != nil {
+		return err
+	}
+	ks, err := k.getKeyStores(config, true, false)
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(k.removeGUN)
+
+	var rootKeyIDs []string
+	if k.removeIncludeRoot {
+		rootKeyIDs, err = cachedRootKeyIDs(config.GetString("trust_dir"), gun)
+		if err != nil {
+			return fmt.Errorf("unable to find the root keys of %s: %v", gun, err)
+		}
+	}
+	cmd.Println("")
+	err = removeGUNKeysInteractively(
+		cryptoservice.NewCryptoService(ks...), gun, rootKeyIDs, k.removeYes, k.input, cmd.OutOrStdout())
+	cmd.Println("")
+	return err
+}
+
 // keyRemove deletes a private key based on ID
 func (k *keyCommander) keyRemove(cmd *cobra.Command, args []string) error {
+	if k.removeGUN != "" {
+		return k.keyRemoveGUN(cmd, args)
+	}
+	if k.removeIncludeRoot {
+		cmd.Usage()
+		return fmt.Errorf("--include-root can only be used along with --gun")
+	}
 	if len(args) < 1 {
 		cmd.Usage()
 		return fmt.Errorf("must specify the key ID of the key to remove")
@@ -426,7 +1121,10 @@ func (k *keyCommander) keyRemove(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	keyID := args[0]
+	keyID, err := resolveKeyID(args[0], localKeyIDs(ks))
+	if err != nil {
+		return err
+	}
 
 	// This is an invalid ID
 	if len(keyID) != notary.SHA256HexSize {
@@ -454,7 +1152,10 @@ func (k *keyCommander) keyPassphraseChange(cmd *cobra.Command, args []string) er
 		return err
 	}
 
-	keyID := args[0]
+	keyID, err := resolveKeyID(args[0], localKeyIDs(ks))
+	if err != nil {
+		return err
+	}
 
 	// This is an invalid ID
 	if len(keyID) != notary.SHA256HexSize {
@@ -572,7 +1273,19 @@ func (k *keyCommander) exportKeys(cmd *cobra.Command, args []string) error {
 			return trustmanager.ExportKeysByGUN(out, fileStore, gun)
 		}
 	} else if len(k.exportKeyIDs) > 0 {
-		return trustmanager.ExportKeysByID(out, fileStore, k.exportKeyIDs)
+		var stored []string
+		for _, f := range fileStore.ListFiles() {
+			stored = append(stored, filepath.Base(f))
+		}
+		keyIDs := make([]string, 0, len(k.exportKeyIDs))
+		for _, prefix := range k.exportKeyIDs {
+			keyID, err := resolveKeyID(prefix, stored)
+			if err != nil {
+				return err
+			}
+			keyIDs = append(keyIDs, keyID)
+		}
+		return trustmanager.ExportKeysByID(out, fileStore, keyIDs)
 	}
 	// export everything
 	keys := fileStore.ListFiles()
@@ -585,6 +1298,17 @@ func (k *keyCommander) exportKeys(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// localKeyIDs returns the IDs of the keys in all the given key stores
+func localKeyIDs(keyStores []trustmanager.KeyStore) []string {
+	var keyIDs []string
+	for _, keyStore := range keyStores {
+		for keyID := range keyStore.ListKeys() {
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	return keyIDs
+}
+
 func (k *keyCommander) getKeyStores(
 	config *viper.Viper, withHardware, hardwareBackup bool) ([]trustmanager.KeyStore, error) {
 
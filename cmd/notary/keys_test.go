@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -30,6 +31,7 @@ import (
 	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
 	"github.com/theupdateframework/notary/tuf/utils"
 )
 
@@ -244,6 +246,57 @@ func TestRemoveMultikeysRemoveOnlyChosenKey(t *testing.T) {
 	}
 }
 
+// Removing the keys of a GUN removes only the keys stored with that GUN, and
+// root keys only if asked to
+func TestRemoveGUNKeys(t *testing.T) {
+	setUp(t)
+	keyStore := trustmanager.NewKeyMemoryStore(ret)
+	cs := cryptoservice.NewCryptoService(keyStore)
+
+	rootKey, err := cs.Create(data.CanonicalRootRole, "", data.ECDSAKey)
+	require.NoError(t, err)
+	gunKeyIDs := make(map[data.GUN][]string)
+	for _, gun := range []data.GUN{"gun1", "gun2"} {
+		for _, role := range []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole} {
+			key, err := cs.Create(role, gun, data.ECDSAKey)
+			require.NoError(t, err)
+			gunKeyIDs[gun] = append(gunKeyIDs[gun], key.ID())
+		}
+	}
+	require.Len(t, keyStore.ListKeys(), 5)
+
+	// declining the confirmation removes nothing
+	var out bytes.Buffer
+	require.NoError(t, removeGUNKeysInteractively(cs, "gun1", nil, false, bytes.NewBufferString("no\n"), &out))
+	require.Contains(t, out.String(), "Are you sure")
+	require.Contains(t, out.String(), "Aborting action")
+	require.Len(t, keyStore.ListKeys(), 5)
+
+	// confirming removes only the keys of the GUN, and not the root key
+	out.Reset()
+	require.NoError(t, removeGUNKeysInteractively(cs, "gun1", nil, false, bytes.NewBufferString("yes\n"), &out))
+	require.Contains(t, out.String(), "Deleted 2 key(s) for gun1")
+	require.NotContains(t, out.String(), rootKey.ID())
+	for _, keyID := range gunKeyIDs["gun1"] {
+		require.Contains(t, out.String(), keyID)
+		require.Nil(t, cs.GetKey(keyID))
+	}
+	for _, keyID := range append(gunKeyIDs["gun2"], rootKey.ID()) {
+		require.NotNil(t, cs.GetKey(keyID))
+	}
+
+	// there is nothing left to remove for the GUN
+	err = removeGUNKeysInteractively(cs, "gun1", nil, true, nil, &out)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no keys for gun1 found")
+
+	// the root key is removed along with the GUN's other keys when its ID is given
+	out.Reset()
+	require.NoError(t, removeGUNKeysInteractively(cs, "gun2", []string{rootKey.ID()}, true, nil, &out))
+	require.Contains(t, out.String(), "Deleted 3 key(s) for gun2")
+	require.Len(t, keyStore.ListKeys(), 0)
+}
+
 // Non-roles and delegation keys can't be rotated with the command line
 func TestRotateKeyInvalidRoles(t *testing.T) {
 	setUp(t)
@@ -503,6 +556,109 @@ func TestRotateKeyRootIsInteractive(t *testing.T) {
 	require.Len(t, allKeys, 3)
 }
 
+// A dry run of a key rotation prints the change it would make, but does not
+// generate or import any keys, or stage or publish any changes
+func TestRotateKeyDryRun(t *testing.T) {
+	setUp(t)
+	// Temporary directory where test files will be created
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	defer os.RemoveAll(tempBaseDir)
+	require.NoError(t, err, "failed to create a temporary directory: %s", err)
+	var gun data.GUN = "docker.com/notary"
+
+	ts, initialKeys := setUpRepo(t, tempBaseDir, gun, ret)
+	defer ts.Close()
+
+	repo, err := client.NewFileCachedRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, ret, trustpinning.TrustPinConfig{})
+	require.NoError(t, err, "error creating repo: %s", err)
+	require.NoError(t, repo.Publish())
+
+	var oldTargetsKeyID string
+	for keyID, role := range initialKeys {
+		if role == data.CanonicalTargetsRole {
+			oldTargetsKeyID = keyID
+		}
+	}
+
+	// a key file to rotate to, which should not be imported
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalTargetsRole, gun, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(tempBaseDir, "new-targets.key")
+	require.NoError(t, ioutil.WriteFile(keyFile, pemBytes, 0600))
+
+	runDryRun := func(role data.RoleName, serverManaged bool, keyFiles ...string) string {
+		k := &keyCommander{
+			configGetter: func() (*viper.Viper, error) {
+				v := viper.New()
+				v.SetDefault("trust_dir", tempBaseDir)
+				v.SetDefault("remote_server.url", ts.URL)
+				return v, nil
+			},
+			getRetriever:           func() notary.PassRetriever { return ret },
+			rotateKeyServerManaged: serverManaged,
+			rotateKeyFiles:         keyFiles,
+			rotateKeyDryRun:        true,
+		}
+		c := &cobra.Command{}
+		out := bytes.NewBuffer(nil)
+		c.SetOutput(out)
+		require.NoError(t, k.keysRotate(c, []string{gun.String(), role.String()}))
+		return out.String()
+	}
+
+	out := runDryRun(data.CanonicalTargetsRole, false)
+	require.Contains(t, out, "remove key "+oldTargetsKeyID)
+	require.Contains(t, out, "add a new key generated locally")
+	require.Contains(t, out, "threshold of 1")
+	require.Contains(t, out, "dry run")
+
+	out = runDryRun(data.CanonicalTargetsRole, false, keyFile)
+	require.Contains(t, out, "remove key "+oldTargetsKeyID)
+	require.Contains(t, out, "add key "+privKey.ID())
+
+	out = runDryRun(data.CanonicalTimestampRole, true)
+	require.Contains(t, out, "add a new key generated and managed by the remote server")
+
+	// root rotations are not interactive in a dry run
+	out = runDryRun(data.CanonicalRootRole, false)
+	require.Contains(t, out, "Rotating the root key")
+
+	// no keys were created, imported or removed
+	require.Equal(t, initialKeys, repo.GetCryptoService().ListAllKeys())
+
+	// nothing was staged
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 0)
+
+	// nor published: the targets role still has its original key
+	roles, err := repo.ListRoles()
+	require.NoError(t, err)
+	for _, role := range roles {
+		if role.Name == data.CanonicalTargetsRole {
+			require.Equal(t, []string{oldTargetsKeyID}, role.KeyIDs)
+		}
+	}
+
+	// invalid rotations are still rejected in a dry run
+	k := &keyCommander{
+		configGetter: func() (*viper.Viper, error) {
+			v := viper.New()
+			v.SetDefault("trust_dir", tempBaseDir)
+			v.SetDefault("remote_server.url", ts.URL)
+			return v, nil
+		},
+		getRetriever:           func() notary.PassRetriever { return ret },
+		rotateKeyServerManaged: true,
+		rotateKeyDryRun:        true,
+	}
+	err = k.keysRotate(&cobra.Command{}, []string{gun.String(), data.CanonicalTargetsRole.String()})
+	require.Error(t, err)
+	require.IsType(t, client.ErrInvalidRemoteRole{}, err)
+}
+
 func TestChangeKeyPassphraseInvalidID(t *testing.T) {
 	setUp(t)
 	k := &keyCommander{
@@ -836,3 +992,404 @@ func TestKeyGeneration(t *testing.T) {
 	_, err = runCommand(t, tempDir, "key", "import", filepath.Join(tempDir, "testkeys-key.pem"))
 	require.EqualError(t, err, "failed to import all keys: invalid key pem block")
 }
+
+// A pool of distinct keys can be generated at once, into the key stores or to files
+func TestKeyGenerationCount(t *testing.T) {
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	output, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "targets", "--count", "3")
+	require.NoError(t, err)
+	_, signing := assertNumKeys(t, tempDir, 0, 3, false)
+	for _, keyID := range signing {
+		require.Contains(t, output, "with keyID: "+keyID)
+	}
+
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--count", "2", "-o", filepath.Join(tempDir, "testkeys"))
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 0, 3, false)
+	keyIDs := make(map[string]bool)
+	for _, n := range []string{"1", "2"} {
+		priv, err := ioutil.ReadFile(filepath.Join(tempDir, "testkeys-"+n+"-key.pem"))
+		require.NoError(t, err)
+		privK, err := utils.ParsePEMPrivateKey(priv, testPassphrase)
+		require.NoError(t, err)
+		keyIDs[privK.ID()] = true
+	}
+	require.Len(t, keyIDs, 2)
+
+	for _, args := range [][]string{{"--count", "0"}, {"--count", "2", "--paper"}} {
+		_, err = runCommand(t, tempDir, append([]string{"key", "generate"}, args...)...)
+		require.Error(t, err)
+	}
+	assertNumKeys(t, tempDir, 0, 3, false)
+}
+
+// Keys can only be generated for the canonical and delegation roles, and root
+// keys can't be generated for a GUN
+func TestKeyGenerateRoleValidation(t *testing.T) {
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "releases")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid role")
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "targets/../releases", "--gun", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid role")
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--gun", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "root key")
+	assertNumKeys(t, tempDir, 0, 0, true)
+
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "targets", "--gun", "gun")
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 0, 1, true)
+}
+
+// A key can be labeled when it's generated, and the label is listed with the
+// key, including after it is exported and imported elsewhere
+func TestKeyGenerationLabel(t *testing.T) {
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	// without labels, there is no label column
+	_, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "targets/unlabeled")
+	require.NoError(t, err)
+	output, err := runCommand(t, tempDir, "key", "list")
+	require.NoError(t, err)
+	require.NotContains(t, output, "LABEL")
+
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "targets/releases", "--label", "release signing")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "key", "list")
+	require.NoError(t, err)
+	require.Contains(t, output, "LABEL")
+	require.Regexp(t, "targets/releases +[0-9a-f]{64} +.* +release signing", output)
+
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--label", "two\nlines")
+	require.Error(t, err)
+
+	// the label is written to the key file too
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--label", "offline", "-o", filepath.Join(tempDir, "labeled"))
+	require.NoError(t, err)
+	priv, err := ioutil.ReadFile(filepath.Join(tempDir, "labeled-key.pem"))
+	require.NoError(t, err)
+	require.Equal(t, "offline", utils.ExtractPrivateKeyLabel(priv))
+
+	exported := filepath.Join(tempDir, "exported.pem")
+	_, err = runCommand(t, tempDir, "key", "export", "-o", exported)
+	require.NoError(t, err)
+
+	importDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(importDir)
+	_, err = runCommand(t, importDir, "key", "import", exported)
+	require.NoError(t, err)
+	output, err = runCommand(t, importDir, "key", "list")
+	require.NoError(t, err)
+	require.Regexp(t, "targets/releases +[0-9a-f]{64} +.* +release signing", output)
+}
+
+// When generating a pool of keys, the passphrase is asked for once and used for
+// every key, unless it is asked for each key
+func TestKeyGenerationCountPassphrases(t *testing.T) {
+	for _, perKey := range []bool{false, true} {
+		tempDir := tempDirWithConfig(t, "{}")
+		defer os.RemoveAll(tempDir)
+
+		// like the prompting retriever, each retriever only asks once per alias
+		var asked int
+		k := &keyCommander{
+			configGetter: func() (*viper.Viper, error) {
+				v := viper.New()
+				v.SetDefault("trust_dir", tempDir)
+				return v, nil
+			},
+			getRetriever: func() notary.PassRetriever {
+				cached := make(map[string]bool)
+				return func(_, alias string, _ bool, _ int) (string, bool, error) {
+					if !cached[alias] {
+						cached[alias] = true
+						asked++
+					}
+					return testPassphrase, false, nil
+				}
+			},
+		}
+		cmd := k.GetCommand()
+		args := []string{"generate", data.ECDSAKey, "--role", "targets", "--count", "3"}
+		if perKey {
+			args = append(args, "--passphrase-per-key")
+		}
+		cmd.SetArgs(args)
+		cmd.SetOutput(new(bytes.Buffer))
+		require.NoError(t, cmd.Execute())
+
+		assertNumKeys(t, tempDir, 0, 3, false)
+		if perKey {
+			require.Equal(t, 3, asked)
+		} else {
+			require.Equal(t, 1, asked)
+		}
+	}
+}
+
+// extractPaperBackup returns the paper backup printed in the command output
+func extractPaperBackup(t *testing.T, output string) string {
+	start := strings.Index(output, "-----BEGIN NOTARY PAPER KEY BACKUP-----")
+	end := strings.Index(output, "-----END NOTARY PAPER KEY BACKUP-----")
+	require.True(t, start >= 0 && end > start, "no paper backup in output: %s", output)
+	return output[start:]
+}
+
+func TestKeyGenerationPaperBackup(t *testing.T) {
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	output, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--paper")
+	require.NoError(t, err)
+	rootIDs, _ := assertNumKeys(t, tempDir, 1, 0, true)
+	backupFile := filepath.Join(tempDir, "backup.txt")
+	require.NoError(t, ioutil.WriteFile(backupFile, []byte(extractPaperBackup(t, output)), 0600))
+
+	// lose the key, and recover it from the backup
+	require.NoError(t, os.Remove(filepath.Join(tempDir, notary.PrivDir, rootIDs[0]+".key")))
+	assertNumKeys(t, tempDir, 0, 0, true)
+	output, err = runCommand(t, tempDir, "key", "recover", backupFile)
+	require.NoError(t, err)
+	require.Contains(t, output, rootIDs[0])
+	assertNumKeys(t, tempDir, 1, 0, true)
+
+	// the recovered key is encrypted with the original passphrase, and signs
+	fileStore, err := trustmanager.NewKeyFileStore(tempDir, passphrase.ConstantRetriever(testPassphrase))
+	require.NoError(t, err)
+	privKey, role, err := fileStore.GetKey(rootIDs[0])
+	require.NoError(t, err)
+	require.Equal(t, data.CanonicalRootRole, role)
+
+	msg := []byte("sign me")
+	sig, err := privKey.Sign(rand.Reader, msg, nil)
+	require.NoError(t, err)
+	pubKey := data.PublicKeyFromPrivate(privKey)
+	require.NoError(t, signed.Verifiers[data.ECDSASignature].Verify(pubKey, sig, msg))
+
+	// a corrupted backup is rejected
+	backup, err := ioutil.ReadFile(backupFile)
+	require.NoError(t, err)
+	corrupted := strings.Replace(string(backup), "001 ", "002 ", 1)
+	require.NoError(t, ioutil.WriteFile(backupFile, []byte(corrupted), 0600))
+	_, err = runCommand(t, tempDir, "key", "recover", backupFile)
+	require.Error(t, err)
+}
+
+func TestKeyGenerationPaperBackupToFile(t *testing.T) {
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	output, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--paper", "-o", filepath.Join(tempDir, "testkeys"))
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 0, 0, false)
+	backupFile := filepath.Join(tempDir, "backup.txt")
+	require.NoError(t, ioutil.WriteFile(backupFile, []byte(extractPaperBackup(t, output)), 0600))
+
+	recoveredFile := filepath.Join(tempDir, "recovered-key.pem")
+	_, err = runCommand(t, tempDir, "key", "recover", backupFile, "-o", recoveredFile)
+	require.NoError(t, err)
+	assertNumKeys(t, tempDir, 0, 0, false)
+
+	generated, err := ioutil.ReadFile(filepath.Join(tempDir, "testkeys-key.pem"))
+	require.NoError(t, err)
+	recovered, err := ioutil.ReadFile(recoveredFile)
+	require.NoError(t, err)
+	generatedBlock, _ := pem.Decode(generated)
+	recoveredBlock, _ := pem.Decode(recovered)
+	require.Equal(t, generatedBlock.Bytes, recoveredBlock.Bytes)
+
+	privKey, err := utils.ParsePEMPrivateKey(recovered, testPassphrase)
+	require.NoError(t, err)
+	require.Equal(t, privKey.ID(), recoveredBlock.Headers["path"])
+}
+
+// The public key of a generated key, and a certificate signing request for
+// it, can be printed for enrolling the key, without exporting the private key
+func TestKeyGenerationStdoutPublic(t *testing.T) {
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	output, err := runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--role", "targets",
+		"--stdout-public", "--stdout-csr", "signer.example.com")
+	require.NoError(t, err)
+	_, signing := assertNumKeys(t, tempDir, 0, 1, false)
+	require.NotContains(t, output, "PRIVATE KEY")
+
+	fileStore, err := trustmanager.NewKeyFileStore(tempDir, passphrase.ConstantRetriever(testPassphrase))
+	require.NoError(t, err)
+	stored, _, err := fileStore.GetKey(signing[0])
+	require.NoError(t, err)
+
+	rest := []byte(output[strings.Index(output, "-----BEGIN"):])
+	pubBlock, rest := pem.Decode(rest)
+	require.NotNil(t, pubBlock)
+	require.Equal(t, "PUBLIC KEY", pubBlock.Type)
+	pubKey, err := utils.ParsePEMPublicKey(pem.EncodeToMemory(pubBlock))
+	require.NoError(t, err)
+	require.Equal(t, stored.ID(), pubKey.ID())
+	require.Equal(t, data.PublicKeyFromPrivate(stored).Public(), pubKey.Public())
+
+	csrBlock, _ := pem.Decode(rest)
+	require.NotNil(t, csrBlock)
+	require.Equal(t, "CERTIFICATE REQUEST", csrBlock.Type)
+	csr, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, csr.CheckSignature())
+	require.Equal(t, "signer.example.com", csr.Subject.CommonName)
+	csrPub, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	require.NoError(t, err)
+	require.Equal(t, pubKey.Public(), csrPub)
+
+	// the printed public key also matches a key written to a file
+	output, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--stdout-public", "-o", filepath.Join(tempDir, "testkeys"))
+	require.NoError(t, err)
+	written, err := ioutil.ReadFile(filepath.Join(tempDir, "testkeys.pem"))
+	require.NoError(t, err)
+	require.Contains(t, output, string(written))
+
+	_, err = runCommand(t, tempDir, "key", "generate", data.ECDSAKey, "--count", "2", "--stdout-public")
+	require.Error(t, err)
+}
+
+// Rotating the keys of every locally cached GUN to server-managed keys
+// requires confirmation, rotates each GUN independently of the others failing,
+// and reports the outcome for each of them
+func TestRotateKeyAllLocalToServer(t *testing.T) {
+	setUp(t)
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	defer os.RemoveAll(tempBaseDir)
+	require.NoError(t, err, "failed to create a temporary directory: %s", err)
+
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, storage.NewMemStorage())
+	ctx = context.WithValue(ctx, notary.CtxKeyKeyAlgo, data.ECDSAKey)
+	l := logrus.New()
+	l.Out = bytes.NewBuffer(nil)
+	ctx = ctxu.WithLogger(ctx, logrus.NewEntry(l))
+	ts := httptest.NewServer(server.RootHandler(ctx, nil, cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(ret)), nil, nil, nil))
+	defer ts.Close()
+
+	guns := []data.GUN{"docker.com/notary/a", "docker.com/notary/b", "docker.com/notary/c", "docker.io/d"}
+	rootKeyIDs := make(map[data.GUN]string)
+	for _, gun := range guns {
+		repo, err := client.NewFileCachedRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, ret, trustpinning.TrustPinConfig{})
+		require.NoError(t, err)
+		rootPubKey, err := repo.GetCryptoService().Create(data.CanonicalRootRole, "", data.ECDSAKey)
+		require.NoError(t, err)
+		require.NoError(t, repo.Initialize([]string{rootPubKey.ID()}))
+		require.NoError(t, repo.Publish())
+		rootKeyIDs[gun] = rootPubKey.ID()
+	}
+
+	cached, err := cachedGUNs(tempBaseDir)
+	require.NoError(t, err)
+	require.Equal(t, guns, cached)
+
+	// without its root key, the rotation of b can't be signed
+	repo, err := client.NewFileCachedRepository(tempBaseDir, guns[1], ts.URL, http.DefaultTransport, ret, trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	require.NoError(t, repo.GetCryptoService().RemoveKey(rootKeyIDs[guns[1]]))
+
+	snapshotKeys := func(gun data.GUN) int {
+		repo, err := client.NewFileCachedRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, ret, trustpinning.TrustPinConfig{})
+		require.NoError(t, err)
+		var count int
+		for keyID, role := range repo.GetCryptoService().ListAllKeys() {
+			keyInfo, err := repo.GetCryptoService().(*cryptoservice.CryptoService).GetKeyInfo(keyID)
+			require.NoError(t, err)
+			if role == data.CanonicalSnapshotRole && keyInfo.Gun == gun {
+				count++
+			}
+		}
+		return count
+	}
+
+	rotateAll := func(yes, timestamp bool) (string, error) {
+		k := &keyCommander{
+			configGetter: func() (*viper.Viper, error) {
+				v := viper.New()
+				v.SetDefault("trust_dir", tempBaseDir)
+				v.SetDefault("remote_server.url", ts.URL)
+				return v, nil
+			},
+			getRetriever:         func() notary.PassRetriever { return ret },
+			rotateAllLocal:       true,
+			rotateAllTimestamp:   timestamp,
+			rotateAllYes:         yes,
+			rotateAllConcurrency: 2,
+		}
+		c := &cobra.Command{}
+		out := bytes.NewBuffer(nil)
+		c.SetOutput(out)
+		err := k.keysRotate(c, nil)
+		return out.String(), err
+	}
+
+	// nothing is rotated without confirmation
+	out, err := rotateAll(false, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--yes")
+	for _, gun := range guns {
+		require.Contains(t, out, gun.String())
+		require.Equal(t, 1, snapshotKeys(gun))
+	}
+
+	out, err = rotateAll(true, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 of 4")
+	require.Contains(t, out, guns[1].String()+": failed")
+	for _, gun := range []data.GUN{guns[0], guns[2], guns[3]} {
+		require.Contains(t, out, gun.String()+": rotated snapshot\n")
+		require.Equal(t, 0, snapshotKeys(gun))
+	}
+
+	// with the GUN which can't be rotated forgotten, every rotation succeeds,
+	// and snapshot keys which are already server-managed are not rotated
+	// again, but the timestamp keys are
+	require.NoError(t, os.RemoveAll(filepath.Join(tempBaseDir, "tuf", filepath.FromSlash(guns[1].String()))))
+	out, err = rotateAll(true, true)
+	require.NoError(t, err)
+	for _, gun := range []data.GUN{guns[0], guns[2], guns[3]} {
+		require.Contains(t, out, gun.String()+": rotated timestamp; snapshot already server-managed\n")
+	}
+	require.NotContains(t, out, guns[1].String())
+	require.Contains(t, out, "Successfully rotated the keys of 3 GUN(s)")
+}
+
+func TestRotateKeyAllLocalToServerInvalidFlags(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	defer os.RemoveAll(tempBaseDir)
+	require.NoError(t, err)
+	configGetter := func() (*viper.Viper, error) {
+		v := viper.New()
+		v.SetDefault("trust_dir", tempBaseDir)
+		return v, nil
+	}
+
+	for _, k := range []*keyCommander{
+		{rotateKeyDryRun: true, rotateAllConcurrency: 1},
+		{rotateKeyReclaim: true, rotateAllConcurrency: 1},
+		{rotateKeyFiles: []string{"key.pem"}, rotateAllConcurrency: 1},
+		{rotateAllConcurrency: 0},
+	} {
+		k.configGetter = configGetter
+		k.rotateAllLocal = true
+		k.rotateAllYes = true
+		require.Error(t, k.keysRotate(&cobra.Command{}, nil))
+	}
+	k := &keyCommander{configGetter: configGetter, rotateAllLocal: true, rotateAllConcurrency: 1}
+	require.Error(t, k.keysRotate(&cobra.Command{}, []string{"docker.com/notary", "snapshot"}))
+
+	// with nothing cached, there is nothing to rotate
+	out := bytes.NewBuffer(nil)
+	c := &cobra.Command{}
+	c.SetOutput(out)
+	require.NoError(t, k.keysRotate(c, nil))
+	require.Contains(t, out.String(), "No GUNs are cached locally")
+}
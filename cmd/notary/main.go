@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -15,6 +16,7 @@ import (
 	"github.com/theupdateframework/notary/passphrase"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/version"
+	"golang.org/x/term"
 )
 
 const (
@@ -59,6 +61,10 @@ type notaryCommander struct {
 	// this needs to be set
 	getRetriever func() notary.PassRetriever
 
+	// this can be set to tell the time by something other than the real
+	// clock, such as in tests
+	clock data.Clock
+
 	// these are for command line parsing - no need to set
 	debug             bool
 	verbose           bool
@@ -66,6 +72,8 @@ type notaryCommander struct {
 	trustDir          string
 	configFile        string
 	remoteTrustServer string
+	noTOFU            bool
+	repin             bool
 
 	tlsCAFile   string
 	tlsCertFile string
@@ -128,6 +136,12 @@ func (n *notaryCommander) parseConfig() (*viper.Viper, error) {
 	if n.remoteTrustServer != "" {
 		config.Set("remote_server.url", n.remoteTrustServer)
 	}
+	if n.noTOFU {
+		config.Set("trust_pinning.disable_tofu", true)
+	}
+	if n.repin {
+		config.Set("trust_pinning.repin", true)
+	}
 
 	// Expands all the possible ~/ that have been given, either through -d or config
 	// Otherwise just attempt to use whatever the user gave us
@@ -153,7 +167,8 @@ func (n *notaryCommander) GetCommand() *cobra.Command {
 			cmd.Usage()
 		},
 	}
-	notaryCmd.SetOutput(os.Stdout)
+	notaryCmd.SetOut(os.Stdout)
+	notaryCmd.SetErr(os.Stderr)
 	notaryCmd.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Print the version number of notary",
@@ -174,6 +189,13 @@ func (n *notaryCommander) GetCommand() *cobra.Command {
 	notaryCmd.PersistentFlags().StringVar(&n.tlsCAFile, "tlscacert", "", "Trust certs signed only by this CA")
 	notaryCmd.PersistentFlags().StringVar(&n.tlsCertFile, "tlscert", "", "Path to TLS certificate file")
 	notaryCmd.PersistentFlags().StringVar(&n.tlsKeyFile, "tlskey", "", "Path to TLS key file")
+	notaryCmd.PersistentFlags().BoolVar(&n.noTOFU, "no-tofu", false, "Disable trust on first use, requiring trust pinning to be configured for any GUN without local trust data")
+	notaryCmd.PersistentFlags().BoolVar(&n.repin, "repin", false, "Trust the server's root on first use again if the local root was trusted on first use longer ago than trust_pinning.tofu_max_age")
+
+	clock := n.clock
+	if clock == nil {
+		clock = data.RealClock{}
+	}
 
 	cmdKeyGenerator := &keyCommander{
 		configGetter: n.parseConfig,
@@ -184,15 +206,23 @@ func (n *notaryCommander) GetCommand() *cobra.Command {
 	cmdDelegationGenerator := &delegationCommander{
 		configGetter: n.parseConfig,
 		retriever:    n.getRetriever(),
+		clock:        clock,
 	}
 
 	cmdTUFGenerator := &tufCommander{
 		configGetter: n.parseConfig,
 		retriever:    n.getRetriever(),
+		stdin:        os.Stdin,
+		clock:        clock,
 	}
 
 	notaryCmd.AddCommand(cmdKeyGenerator.GetCommand())
 	notaryCmd.AddCommand(cmdDelegationGenerator.GetCommand())
+	notaryCmd.AddCommand((&serverCommander{configGetter: n.parseConfig, retriever: n.getRetriever()}).GetCommand())
+	notaryCmd.AddCommand((&whoamiCommander{configGetter: n.parseConfig, retriever: n.getRetriever()}).GetCommand())
+	notaryCmd.AddCommand((&offlineCommander{configGetter: n.parseConfig, retriever: n.getRetriever()}).GetCommand())
+	notaryCmd.AddCommand((&cacheCommander{configGetter: n.parseConfig, retriever: n.getRetriever()}).GetCommand())
+	notaryCmd.AddCommand((&changelistCommander{configGetter: n.parseConfig, retriever: n.getRetriever(), input: os.Stdin}).GetCommand())
 
 	cmdTUFGenerator.AddToCommand(&notaryCmd)
 
@@ -224,25 +254,68 @@ func askConfirm(input io.Reader) bool {
 	return false
 }
 
+// isTerminal returns whether the given input is an interactive terminal.  Inputs
+// that are not files, such as buffers in tests, are considered interactive.
+func isTerminal(input io.Reader) bool {
+	if f, ok := input.(*os.File); ok {
+		return term.IsTerminal(int(f.Fd()))
+	}
+	return input != nil
+}
+
+// passphraseEnvVars are the environment variables holding the passphrase for
+// each alias.  The passphrase can also be read from the file named by the
+// variable with a _FILE suffix, or from the systemd credential of the same
+// name as the variable.
+var passphraseEnvVars = map[string]string{
+	"root":       "NOTARY_ROOT_PASSPHRASE",
+	"targets":    "NOTARY_TARGETS_PASSPHRASE",
+	"snapshot":   "NOTARY_SNAPSHOT_PASSPHRASE",
+	"delegation": "NOTARY_DELEGATION_PASSPHRASE",
+
+	tlsClientP12Alias: "NOTARY_TLS_CLIENT_PASSPHRASE",
+}
+
+// passphraseFileTimeout is how long reading a passphrase file, such as a named
+// pipe, may block for
+const passphraseFileTimeout = 30 * time.Second
+
 func getPassphraseRetriever() notary.PassRetriever {
-	baseRetriever := passphrase.PromptRetriever()
-	env := map[string]string{
-		"root":       os.Getenv("NOTARY_ROOT_PASSPHRASE"),
-		"targets":    os.Getenv("NOTARY_TARGETS_PASSPHRASE"),
-		"snapshot":   os.Getenv("NOTARY_SNAPSHOT_PASSPHRASE"),
-		"delegation": os.Getenv("NOTARY_DELEGATION_PASSPHRASE"),
+	env := make(map[string]string)
+	files := make(map[string]string)
+	credentialsDir := os.Getenv("CREDENTIALS_DIRECTORY")
+	for alias, envVar := range passphraseEnvVars {
+		env[alias] = os.Getenv(envVar)
+		if path := os.Getenv(envVar + "_FILE"); path != "" {
+			files[alias] = path
+		} else if credentialsDir != "" {
+			// credentials passed in by systemd's LoadCredential
+			path := filepath.Join(credentialsDir, envVar)
+			if _, err := os.Stat(path); err == nil {
+				files[alias] = path
+			}
+		}
 	}
+	baseRetriever := passphrase.FileRetriever(files, passphraseFileTimeout, passphrase.PromptRetriever())
 
 	return func(keyName string, alias string, createNew bool, numAttempts int) (string, bool, error) {
 		if v := env[alias]; v != "" {
 			return v, numAttempts > 1, nil
 		}
+		if _, ok := files[alias]; ok {
+			return baseRetriever(keyName, alias, createNew, numAttempts)
+		}
 		// For delegation roles, we can also try the "delegation" alias if it is specified
 		// Note that we don't check if the role name is for a delegation to allow for names like "user"
 		// since delegation keys can be shared across repositories
 		// This cannot be a base role or imported key, though.
-		if v := env["delegation"]; !data.IsBaseRole(data.RoleName(alias)) && v != "" {
-			return v, numAttempts > 1, nil
+		if !data.IsBaseRole(data.RoleName(alias)) && alias != tlsClientP12Alias {
+			if v := env["delegation"]; v != "" {
+				return v, numAttempts > 1, nil
+			}
+			if _, ok := files["delegation"]; ok {
+				return baseRetriever(keyName, "delegation", createNew, numAttempts)
+			}
 		}
 		return baseRetriever(keyName, alias, createNew, numAttempts)
 	}
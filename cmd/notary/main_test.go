@@ -2,9 +2,18 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
@@ -18,7 +27,9 @@ import (
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/passphrase"
 	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
 )
 
 // the default location for the config file is in ~/.notary/config.json - even if it doesn't exist.
@@ -424,6 +435,318 @@ func TestConfigFileOverridenByCmdLineFlags(t *testing.T) {
 	require.Equal(t, m.gotten[0], "repo.root")
 }
 
+// the config can provide the TLS client certificate and key as a PKCS#12 bundle,
+// whose passphrase is asked for from the passphrase retriever
+func TestConfigFileTLSClientPKCS12(t *testing.T) {
+	p12Cert, err := ioutil.ReadFile("../../fixtures/notary-client.crt")
+	require.NoError(t, err)
+	block, _ := pem.Decode(p12Cert)
+	require.NotNil(t, block)
+
+	// the server accepts any client certificate, but records the one presented
+	m := &recordingMetaStore{MemStorage: *storage.NewMemStorage()}
+	var presented [][]byte
+	handler := setupServerHandler(m)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, cert := range r.TLS.PeerCertificates {
+			presented = append(presented, cert.Raw)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s.StartTLS()
+	defer s.Close()
+
+	tempDir := tempDirWithConfig(t, fmt.Sprintf(`{
+		"remote_server": {
+			"url": "%s",
+			"root_ca": "root-ca.crt",
+			"tls_client_p12": "notary-client.p12"
+		}
+	}`, s.URL))
+	defer os.RemoveAll(tempDir)
+	configFile := filepath.Join(tempDir, "config.json")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "root-ca.crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}), 0644))
+	content, err := ioutil.ReadFile("../../fixtures/notary-client.p12")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "notary-client.p12"), content, 0600))
+
+	cmd := NewNotaryCommand()
+	cmd.SetArgs([]string{"-c", configFile, "-d", tempDir, "list", "repo"})
+	cmd.SetOutput(new(bytes.Buffer)) // eat the output
+	err = cmd.Execute()
+	require.Error(t, err, "there was no repository, so list should have failed")
+	require.NotContains(t, err.Error(), "TLS", "there was no TLS error though!")
+
+	// validate that we connected with the certificate from the bundle
+	require.Len(t, m.gotten, 1)
+	require.Equal(t, m.gotten[0], "repo.root")
+	require.NotEmpty(t, presented)
+	for _, raw := range presented {
+		require.Equal(t, block.Bytes, raw)
+	}
+
+	// a bundle cannot be used along with a client certificate and key
+	tempDir2 := tempDirWithConfig(t, fmt.Sprintf(`{
+		"remote_server": {
+			"url": "%s",
+			"tls_client_p12": "../../fixtures/notary-client.p12",
+			"tls_client_cert": "../../fixtures/notary-server.crt",
+			"tls_client_key": "../../fixtures/notary-server.key"
+		}
+	}`, s.URL))
+	defer os.RemoveAll(tempDir2)
+	cmd = NewNotaryCommand()
+	cmd.SetArgs([]string{"-c", filepath.Join(tempDir2, "config.json"), "-d", tempDir2, "list", "repo"})
+	cmd.SetOutput(new(bytes.Buffer)) // eat the output
+	err = cmd.Execute()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not both")
+}
+
+// a PKCS#12 bundle cannot be decoded without its passphrase
+func TestLoadPKCS12ClientCertWrongPassphrase(t *testing.T) {
+	p12File := "../../fixtures/notary-client.p12"
+
+	_, err := loadPKCS12ClientCert(p12File, nil)
+	require.Error(t, err)
+
+	_, err = loadPKCS12ClientCert(p12File, passphrase.ConstantRetriever("wrong"))
+	require.IsType(t, trustmanager.ErrAttemptsExceeded{}, err)
+
+	_, err = loadPKCS12ClientCert(p12File, func(string, string, bool, int) (string, bool, error) {
+		return "", true, nil
+	})
+	require.IsType(t, trustmanager.ErrPasswordInvalid{}, err)
+
+	cert, err := loadPKCS12ClientCert(p12File, passphrase.ConstantRetriever(testPassphrase))
+	require.NoError(t, err)
+	require.Len(t, cert.Certificate, 1)
+	require.NotNil(t, cert.PrivateKey)
+}
+
+// the server's certificate must match one of the pinned SPKI hashes, if any
+// are configured
+func TestConfigFilePinnedSPKI(t *testing.T) {
+	m := &recordingMetaStore{MemStorage: *storage.NewMemStorage()}
+	s := httptest.NewTLSServer(setupServerHandler(m))
+	defer s.Close()
+
+	serverPin := sha256.Sum256(s.Certificate().RawSubjectPublicKeyInfo)
+	otherPin := sha256.Sum256([]byte("not the server's key"))
+
+	runWithPins := func(pins ...string) error {
+		tempDir := tempDirWithConfig(t, fmt.Sprintf(`{
+			"remote_server": {
+				"url": "%s",
+				"root_ca": "root-ca.crt",
+				"pinned_spki": ["%s"]
+			}
+		}`, s.URL, strings.Join(pins, `", "`)))
+		defer os.RemoveAll(tempDir)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "root-ca.crt"),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}), 0644))
+
+		cmd := NewNotaryCommand()
+		cmd.SetArgs([]string{"-c", filepath.Join(tempDir, "config.json"), "-d", tempDir, "list", "repo"})
+		cmd.SetOutput(new(bytes.Buffer)) // eat the output
+		err := cmd.Execute()
+		require.Error(t, err, "there was no repository, so list should have failed")
+		return err
+	}
+
+	// a matching pin, with or without the sha256// prefix, lets the client connect
+	for _, pin := range []string{
+		base64.StdEncoding.EncodeToString(serverPin[:]),
+		"sha256//" + base64.StdEncoding.EncodeToString(serverPin[:]),
+	} {
+		m.gotten = nil
+		err := runWithPins(pin)
+		require.NotContains(t, err.Error(), "SPKI")
+		require.Equal(t, []string{"repo.root"}, m.gotten)
+	}
+
+	// any of several pins can match, so that the server's key can be rotated
+	m.gotten = nil
+	err := runWithPins(base64.StdEncoding.EncodeToString(otherPin[:]),
+		base64.StdEncoding.EncodeToString(serverPin[:]))
+	require.NotContains(t, err.Error(), "SPKI")
+	require.Equal(t, []string{"repo.root"}, m.gotten)
+
+	// a server whose key matches no pin is treated as unreachable, so nothing
+	// is requested from it
+	m.gotten = nil
+	err = runWithPins(base64.StdEncoding.EncodeToString(otherPin[:]))
+	require.Contains(t, err.Error(), "offline")
+	require.Empty(t, m.gotten)
+
+	// pins must be base64 encoded SHA-256 hashes
+	for _, pin := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		err = runWithPins(pin)
+		require.Contains(t, err.Error(), "invalid pinned SPKI hash")
+	}
+}
+
+// the pinned SPKI hashes are checked against the trust server only, and not
+// against the token server it sends the client to
+func TestConfigFilePinnedSPKITokenServer(t *testing.T) {
+	tokensIssued := 0
+	tokenServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokensIssued++
+		fmt.Fprint(w, `{"token": "token"}`)
+	}))
+	tokenCert := newLocalhostCert(t)
+	tokenServer.TLS = &tls.Config{Certificates: []tls.Certificate{tokenCert}}
+	tokenServer.StartTLS()
+	defer tokenServer.Close()
+
+	m := &recordingMetaStore{MemStorage: *storage.NewMemStorage()}
+	handler := setupServerHandler(m)
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="notary"`, tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	serverPin := sha256.Sum256(s.Certificate().RawSubjectPublicKeyInfo)
+	require.NotEqual(t, serverPin, sha256.Sum256(tokenServer.Certificate().RawSubjectPublicKeyInfo))
+
+	tempDir := tempDirWithConfig(t, fmt.Sprintf(`{
+		"remote_server": {
+			"url": "%s",
+			"root_ca": "root-ca.crt",
+			"pinned_spki": ["%s"]
+		}
+	}`, s.URL, base64.StdEncoding.EncodeToString(serverPin[:])))
+	defer os.RemoveAll(tempDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "root-ca.crt"), append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tokenCert.Certificate[0]})...), 0644))
+
+	cmd := NewNotaryCommand()
+	cmd.SetArgs([]string{"-c", filepath.Join(tempDir, "config.json"), "-d", tempDir, "list", "repo"})
+	cmd.SetOutput(new(bytes.Buffer)) // eat the output
+	err := cmd.Execute()
+	require.Error(t, err, "there was no repository, so list should have failed")
+	require.NotContains(t, err.Error(), "SPKI")
+	require.NotZero(t, tokensIssued)
+	require.Equal(t, []string{"repo.root"}, m.gotten)
+}
+
+// newLocalhostCert generates a self-signed TLS certificate for 127.0.0.1 with
+// a new key
+func newLocalhostCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template, err := utils.NewCertificate("127.0.0.1", time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// the clock skew threshold must be a positive duration if it is configured
+func TestConfigFileClockSkewThreshold(t *testing.T) {
+	s := httptest.NewServer(setupServerHandler(storage.NewMemStorage()))
+	defer s.Close()
+
+	runWithThreshold := func(threshold string) error {
+		tempDir := tempDirWithConfig(t, fmt.Sprintf(`{
+			"remote_server": {"url": "%s"},
+			"clock_skew_threshold": "%s"
+		}`, s.URL, threshold))
+		defer os.RemoveAll(tempDir)
+
+		cmd := NewNotaryCommand()
+		cmd.SetArgs([]string{"-c", filepath.Join(tempDir, "config.json"), "-d", tempDir, "list", "repo"})
+		cmd.SetOutput(new(bytes.Buffer)) // eat the output
+		err := cmd.Execute()
+		require.Error(t, err, "there was no repository, so list should have failed")
+		return err
+	}
+
+	for _, threshold := range []string{"", "10m", "1h30m"} {
+		err := runWithThreshold(threshold)
+		require.Contains(t, err.Error(), "does not have trust data")
+	}
+	for _, threshold := range []string{"ten minutes", "10", "-10m", "0s"} {
+		err := runWithThreshold(threshold)
+		require.Contains(t, err.Error(), "invalid clock_skew_threshold")
+	}
+}
+
+// the signature algorithms must map valid roles to known algorithms, in any case
+func TestConfigFileSignatureAlgorithms(t *testing.T) {
+	s := httptest.NewServer(setupServerHandler(storage.NewMemStorage()))
+	defer s.Close()
+
+	runWithAlgorithms := func(algorithms string) error {
+		tempDir := tempDirWithConfig(t, fmt.Sprintf(`{
+			"remote_server": {"url": "%s"},
+			"signature_algorithms": %s
+		}`, s.URL, algorithms))
+		defer os.RemoveAll(tempDir)
+
+		cmd := NewNotaryCommand()
+		cmd.SetArgs([]string{"-c", filepath.Join(tempDir, "config.json"), "-d", tempDir, "list", "repo"})
+		cmd.SetOutput(new(bytes.Buffer)) // eat the output
+		err := cmd.Execute()
+		require.Error(t, err, "there was no repository, so list should have failed")
+		return err
+	}
+
+	for _, algorithms := range []string{`{}`, `{"root": "ecdsa"}`, `{"root": "ECDSA", "targets/releases": "eddsa"}`} {
+		err := runWithAlgorithms(algorithms)
+		require.Contains(t, err.Error(), "does not have trust data", algorithms)
+	}
+	for _, algorithms := range []string{`{"root": "dsa"}`, `{"releases": "ecdsa"}`} {
+		err := runWithAlgorithms(algorithms)
+		require.Contains(t, err.Error(), "invalid signature_algorithms", algorithms)
+	}
+}
+
+// the config can remap the HTTP statuses returned by a gateway in front of the
+// server, such as a 403 returned instead of a 401
+func TestConfigFileStatusMapping(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server can be reached, but nothing else is allowed
+		if r.URL.Path != "/v2/" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer s.Close()
+
+	runWithMapping := func(mapping string) error {
+		tempDir := tempDirWithConfig(t, fmt.Sprintf(`{
+			"remote_server": {"url": "%s", "status_mapping": %s}
+		}`, s.URL, mapping))
+		defer os.RemoveAll(tempDir)
+
+		cmd := NewNotaryCommand()
+		cmd.SetArgs([]string{"-c", filepath.Join(tempDir, "config.json"), "-d", tempDir, "key", "rotate", "repo", "snapshot", "-r"})
+		cmd.SetOutput(new(bytes.Buffer)) // eat the output
+		err := cmd.Execute()
+		require.Error(t, err, "the server rejects every request")
+		return err
+	}
+
+	err := runWithMapping(`{}`)
+	require.Contains(t, err.Error(), "unable to reach trust server at this time: 403")
+	err = runWithMapping(`{"403": "unauthorized"}`)
+	require.Contains(t, err.Error(), "you are not authorized to perform this operation: server returned 403")
+
+	for _, mapping := range []string{`{"forbidden": "unauthorized"}`, `{"403": "forbidden"}`, `{"200": "not_found"}`} {
+		err = runWithMapping(mapping)
+		require.Contains(t, err.Error(), "invalid remote_server.status_mapping", mapping)
+	}
+}
+
 // the config can specify trust pinning settings for TOFUs, as well as pinned Certs or CA
 func TestConfigFileTrustPinning(t *testing.T) {
 	var err error
@@ -527,6 +850,51 @@ func TestConfigFileTrustPinning(t *testing.T) {
 	trustPin, err = getTrustPinning(config)
 	require.NoError(t, err)
 	require.Equal(t, "root-ca.crt", trustPin.CA["repo4"])
+
+	tempDir = tempDirWithConfig(t, fmt.Sprintf(`{
+		"trust_pinning": {
+		    "chain": {
+		        "repo5": "%s"
+		    }
+		 }
+	}`, "chain.crt"))
+	defer os.RemoveAll(tempDir)
+	commander = &notaryCommander{
+		getRetriever: func() notary.PassRetriever { return passphrase.ConstantRetriever("pass") },
+		configFile:   filepath.Join(tempDir, "config.json"),
+	}
+
+	config, err = commander.parseConfig()
+	require.NoError(t, err)
+	trustPin, err = getTrustPinning(config)
+	require.NoError(t, err)
+	require.Equal(t, "chain.crt", trustPin.Chain["repo5"])
+}
+
+// the --no-tofu flag disables TOFU even if the config file enables it, and
+// leaves the rest of the trust pinning configuration intact
+func TestNoTOFUFlagOverridesConfig(t *testing.T) {
+	tempDir := tempDirWithConfig(t, `{
+		"trust_pinning": {
+		    "disable_tofu": false,
+		    "ca": {
+		        "repo4": "root-ca.crt"
+		    }
+		}
+	}`)
+	defer os.RemoveAll(tempDir)
+	commander := &notaryCommander{
+		getRetriever: func() notary.PassRetriever { return passphrase.ConstantRetriever("pass") },
+		configFile:   filepath.Join(tempDir, "config.json"),
+		noTOFU:       true,
+	}
+
+	config, err := commander.parseConfig()
+	require.NoError(t, err)
+	trustPin, err := getTrustPinning(config)
+	require.NoError(t, err)
+	require.True(t, trustPin.DisableTOFU)
+	require.Equal(t, "root-ca.crt", trustPin.CA["repo4"])
 }
 
 // sets the env vars to empty, and returns a function to reset them at the end
@@ -536,6 +904,10 @@ func cleanupAndSetEnvVars() func() {
 		"NOTARY_TARGETS_PASSPHRASE":    "",
 		"NOTARY_SNAPSHOT_PASSPHRASE":   "",
 		"NOTARY_DELEGATION_PASSPHRASE": "",
+		"CREDENTIALS_DIRECTORY":        "",
+	}
+	for _, envVar := range passphraseEnvVars {
+		orig[envVar+"_FILE"] = ""
 	}
 	for envVar := range orig {
 		orig[envVar] = os.Getenv(envVar)
@@ -608,6 +980,52 @@ func TestPassphraseRetrieverCaching(t *testing.T) {
 	require.Equal(t, passphrase, "delegation_passphrase")
 }
 
+// Passphrases can be read from the files named by the _FILE environment
+// variables, or from systemd credentials, but the environment variables holding
+// the passphrases themselves take precedence
+func TestPassphraseRetrieverFiles(t *testing.T) {
+	defer cleanupAndSetEnvVars()()
+	tempDir, err := ioutil.TempDir("", "notary-passphrases-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	credentialsDir := filepath.Join(tempDir, "credentials")
+	require.NoError(t, os.Mkdir(credentialsDir, 0700))
+
+	for name, contents := range map[string]string{
+		"root":                                  "root_file_passphrase\n",
+		"delegation":                            "delegation_file_passphrase",
+		"credentials/NOTARY_ROOT_PASSPHRASE":    "root_credential_passphrase",
+		"credentials/NOTARY_TARGETS_PASSPHRASE": "targets_credential_passphrase\n",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, name), []byte(contents), 0600))
+	}
+	require.NoError(t, os.Setenv("NOTARY_ROOT_PASSPHRASE_FILE", filepath.Join(tempDir, "root")))
+	require.NoError(t, os.Setenv("NOTARY_DELEGATION_PASSPHRASE_FILE", filepath.Join(tempDir, "delegation")))
+	require.NoError(t, os.Setenv("CREDENTIALS_DIRECTORY", credentialsDir))
+	require.NoError(t, os.Setenv("NOTARY_SNAPSHOT_PASSPHRASE", "snapshot_passphrase"))
+
+	retriever := getPassphraseRetriever()
+	for alias, expected := range map[string]string{
+		// the _FILE variable takes precedence over the credential
+		data.CanonicalRootRole.String():     "root_file_passphrase",
+		data.CanonicalTargetsRole.String():  "targets_credential_passphrase",
+		data.CanonicalSnapshotRole.String(): "snapshot_passphrase",
+		"targets/releases":                  "delegation_file_passphrase",
+		"user":                              "delegation_file_passphrase",
+	} {
+		passphrase, giveup, err := retriever("key", alias, false, 0)
+		require.NoError(t, err)
+		require.False(t, giveup)
+		require.Equal(t, expected, passphrase, alias)
+	}
+
+	// the passphrase environment variable takes precedence over the file
+	require.NoError(t, os.Setenv("NOTARY_ROOT_PASSPHRASE", "root_passphrase"))
+	passphrase, _, err := getPassphraseRetriever()("key", data.CanonicalRootRole.String(), false, 0)
+	require.NoError(t, err)
+	require.Equal(t, "root_passphrase", passphrase)
+}
+
 func TestPassphraseRetrieverDelegationRoleCaching(t *testing.T) {
 	defer cleanupAndSetEnvVars()()
 	// Only set up one passphrase environment var first for delegations
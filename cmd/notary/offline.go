@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+var cmdOfflineTemplate = usageTemplate{
+	Use:   "offline",
+	Short: "Signs staged changes on a machine without access to the server.",
+	Long:  "Moves staged changes to a machine which holds the signing keys but cannot reach the trust server, and publishes them once they have been signed there, so that the keys never need to be online.",
+}
+
+var cmdOfflineExportTemplate = usageTemplate{
+	Use:   "export [ GUN ] [ Bundle ]",
+	Short: "Exports the staged changes to a bundle to be signed offline.",
+	Long:  "Exports the staged changes to a Globally Unique Name, with its current metadata from the trust server, to a bundle file which can be signed with \"notary offline sign\" on a machine which holds the keys. The changes stay staged until the signed bundle is imported.",
+}
+
+var cmdOfflineSignTemplate = usageTemplate{
+	Use:   "sign [ GUN ] [ Bundle ]",
+	Short: "Signs the changes in a bundle with the local keys.",
+	Long:  "Applies the changes in a bundle exported by \"notary offline export\" to its metadata and signs the result with the local keys, updating the bundle file in place. The trust server is never contacted.",
+}
+
+var cmdOfflineImportTemplate = usageTemplate{
+	Use:   "import [ GUN ] [ Bundle ]",
+	Short: "Publishes a bundle which has been signed offline.",
+	Long:  "Publishes the metadata in a bundle signed by \"notary offline sign\" to the trust server, and removes its changes from those staged. Fails if the metadata has been published again since the bundle was exported.",
+}
+
+type offlineCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+}
+
+func (o *offlineCommander) GetCommand() *cobra.Command {
+	cmd := cmdOfflineTemplate.ToCommand(nil)
+	cmd.AddCommand(cmdOfflineExportTemplate.ToCommand(o.offlineExport))
+	cmd.AddCommand(cmdOfflineSignTemplate.ToCommand(o.offlineSign))
+	cmd.AddCommand(cmdOfflineImportTemplate.ToCommand(o.offlineImport))
+	return cmd
+}
+
+// getRepo checks the arguments, and returns the repository they name and the
+// path of the bundle
+func (o *offlineCommander) getRepo(cmd *cobra.Command, args []string, online bool, permission httpAccess) (notaryclient.Repository, string, error) {
+	if len(args) != 2 {
+		cmd.Usage()
+		return nil, "", fmt.Errorf("must specify a GUN and a bundle file")
+	}
+	config, err := o.configGetter()
+	if err != nil {
+		return nil, "", err
+	}
+	nRepo, err := ConfigureRepo(config, o.retriever, online, permission)(data.GUN(args[0]))
+	if err != nil {
+		return nil, "", err
+	}
+	return nRepo, args[1], nil
+}
+
+func readOfflineBundle(bundlePath string) (*notaryclient.OfflineBundle, error) {
+	serialized, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	var bundle notaryclient.OfflineBundle
+	if err := json.Unmarshal(serialized, &bundle); err != nil {
+		return nil, fmt.Errorf("unable to parse bundle %s: %v", bundlePath, err)
+	}
+	return &bundle, nil
+}
+
+func writeOfflineBundle(bundlePath string, bundle *notaryclient.OfflineBundle) error {
+	serialized, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bundlePath, serialized, notary.PrivNoExecPerms)
+}
+
+func (o *offlineCommander) offlineExport(cmd *cobra.Command, args []string) error {
+	nRepo, bundlePath, err := o.getRepo(cmd, args, true, readOnly)
+	if err != nil {
+		return err
+	}
+	bundle, err := nRepo.ExportOfflineBundle()
+	if err != nil {
+		return err
+	}
+	if err := writeOfflineBundle(bundlePath, bundle); err != nil {
+		return err
+	}
+	cmd.Printf("Exported %d staged changes to %s\n", len(bundle.Changes), bundlePath)
+	return nil
+}
+
+func (o *offlineCommander) offlineSign(cmd *cobra.Command, args []string) error {
+	nRepo, bundlePath, err := o.getRepo(cmd, args, false, readOnly)
+	if err != nil {
+		return err
+	}
+	bundle, err := readOfflineBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	if err := nRepo.SignOfflineBundle(bundle); err != nil {
+		return err
+	}
+	if err := writeOfflineBundle(bundlePath, bundle); err != nil {
+		return err
+	}
+	cmd.Printf("Signed %d changes to %s in %s\n", len(bundle.Changes), bundle.GUN, bundlePath)
+	return nil
+}
+
+func (o *offlineCommander) offlineImport(cmd *cobra.Command, args []string) error {
+	nRepo, bundlePath, err := o.getRepo(cmd, args, true, readWrite)
+	if err != nil {
+		return err
+	}
+	bundle, err := readOfflineBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	if err := nRepo.PublishOfflineBundle(bundle); err != nil {
+		return err
+	}
+	cmd.Printf("Published %d changes to %s\n", len(bundle.Changes), bundle.GUN)
+	return nil
+}
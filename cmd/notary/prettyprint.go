@@ -5,15 +5,20 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/server/meta"
 	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/tuf/data"
 )
 
 const (
+	twoItemRow  = "%s\t%s\n"
 	fourItemRow = "%s\t%s\t%s\t%s\n"
 	fiveItemRow = "%s\t%s\t%s\t%s\t%s\n"
 )
@@ -54,6 +59,7 @@ type keyInfo struct {
 	role     data.RoleName
 	keyID    string
 	location string
+	label    string
 }
 
 // We want to sort by gun, then by role, then by keyID, then by location
@@ -94,9 +100,13 @@ func (k keyInfoSorter) Less(i, j int) bool {
 }
 
 // Given a list of KeyStores in order of listing preference, pretty-prints the
-// root keys and then the signing keys.
-func prettyPrintKeys(keyStores []trustmanager.KeyStore, writer io.Writer) {
-	var info []keyInfo
+// root keys and then the signing keys.  If short is set, the key IDs are
+// shortened to the shortest prefix which tells them apart.
+func prettyPrintKeys(keyStores []trustmanager.KeyStore, short bool, writer io.Writer) {
+	var (
+		info    []keyInfo
+		labeled bool
+	)
 
 	for _, store := range keyStores {
 		for keyID, keyIDInfo := range store.ListKeys() {
@@ -105,7 +115,9 @@ func prettyPrintKeys(keyStores []trustmanager.KeyStore, writer io.Writer) {
 				location: store.Name(),
 				gun:      keyIDInfo.Gun,
 				keyID:    keyID,
+				label:    keyIDInfo.Label,
 			})
+			labeled = labeled || keyIDInfo.Label != ""
 		}
 	}
 
@@ -116,29 +128,76 @@ func prettyPrintKeys(keyStores []trustmanager.KeyStore, writer io.Writer) {
 
 	sort.Stable(keyInfoSorter(info))
 
-	tw := initTabWriter([]string{"ROLE", "GUN", "KEY ID", "LOCATION"}, writer)
+	if short {
+		keyIDs := make([]string, 0, len(info))
+		for _, oneKeyInfo := range info {
+			keyIDs = append(keyIDs, oneKeyInfo.keyID)
+		}
+		length := shortKeyIDLength(keyIDs)
+		for i := range info {
+			info[i].keyID = shortKeyID(info[i].keyID, length)
+		}
+	}
+
+	// labels are only shown if any key has one
+	columns := []string{"ROLE", "GUN", "KEY ID", "LOCATION"}
+	if labeled {
+		columns = append(columns, "LABEL")
+	}
+	tw := initTabWriter(columns, writer)
 
 	for _, oneKeyInfo := range info {
-		fmt.Fprintf(
-			tw,
-			fourItemRow,
+		row := []interface{}{
 			oneKeyInfo.role,
 			truncateWithEllipsis(oneKeyInfo.gun.String(), maxGUNWidth, true),
 			oneKeyInfo.keyID,
 			truncateWithEllipsis(oneKeyInfo.location, maxLocWidth, true),
-		)
+		}
+		if !labeled {
+			fmt.Fprintf(tw, fourItemRow, row...)
+			continue
+		}
+		fmt.Fprintf(tw, fiveItemRow, append(row, oneKeyInfo.label)...)
 	}
 	tw.Flush()
 }
 
 // --- pretty printing targets ---
 
-type targetsSorter []*client.TargetWithRole
+// targetSortFields are the fields by which targets can be sorted.  Ties are
+// broken by the name and then the role, so that the order is deterministic.
+var targetSortFields = map[string]func(a, b *client.TargetWithRole) bool{
+	"name": targetNameLess,
+	"size": func(a, b *client.TargetWithRole) bool {
+		if a.Length != b.Length {
+			return a.Length < b.Length
+		}
+		return targetNameLess(a, b)
+	},
+	"role": func(a, b *client.TargetWithRole) bool {
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return a.Name < b.Name
+	},
+}
 
-func (t targetsSorter) Len() int      { return len(t) }
-func (t targetsSorter) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func targetNameLess(a, b *client.TargetWithRole) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Role < b.Role
+}
+
+type targetsSorter struct {
+	targets []*client.TargetWithRole
+	less    func(a, b *client.TargetWithRole) bool
+}
+
+func (t targetsSorter) Len() int      { return len(t.targets) }
+func (t targetsSorter) Swap(i, j int) { t.targets[i], t.targets[j] = t.targets[j], t.targets[i] }
 func (t targetsSorter) Less(i, j int) bool {
-	return t[i].Name < t[j].Name
+	return t.less(t.targets[i], t.targets[j])
 }
 
 // --- pretty printing roles ---
@@ -151,14 +210,23 @@ func (r roleSorter) Less(i, j int) bool {
 	return r[i].Name < r[j].Name
 }
 
-// Pretty-prints the sorted list of TargetWithRoles.
-func prettyPrintTargets(ts []*client.TargetWithRole, writer io.Writer) {
+// Pretty-prints the list of TargetWithRoles, sorted by the given field (one of
+// targetSortFields, defaulting to the name) and optionally in reverse.
+func prettyPrintTargets(ts []*client.TargetWithRole, sortBy string, reverse bool, writer io.Writer) {
 	if len(ts) == 0 {
 		writer.Write([]byte("\nNo targets present in this repository.\n\n"))
 		return
 	}
 
-	sort.Stable(targetsSorter(ts))
+	less, ok := targetSortFields[sortBy]
+	if !ok {
+		less = targetNameLess
+	}
+	var sorter sort.Interface = targetsSorter{targets: ts, less: less}
+	if reverse {
+		sorter = sort.Reverse(sorter)
+	}
+	sort.Sort(sorter)
 
 	tw := initTabWriter([]string{"NAME", "DIGEST", "SIZE (BYTES)", "ROLE"}, writer)
 
@@ -175,6 +243,34 @@ func prettyPrintTargets(ts []*client.TargetWithRole, writer io.Writer) {
 	tw.Flush()
 }
 
+// Pretty-prints the targets as they would be after publishing, sorted by
+// name, marking those which come from unpublished changes
+func prettyPrintEffectiveTargets(ts []effectiveTarget, writer io.Writer) {
+	if len(ts) == 0 {
+		writer.Write([]byte("\nNo targets present in this repository.\n\n"))
+		return
+	}
+	sort.Slice(ts, func(i, j int) bool { return targetNameLess(ts[i].TargetWithRole, ts[j].TargetWithRole) })
+
+	tw := initTabWriter([]string{"NAME", "DIGEST", "SIZE (BYTES)", "ROLE", "STATUS"}, writer)
+	for _, t := range ts {
+		status := "published"
+		if t.staged {
+			status = "unpublished"
+		}
+		fmt.Fprintf(
+			tw,
+			fiveItemRow,
+			t.Name,
+			hex.EncodeToString(t.Hashes["sha256"]),
+			fmt.Sprintf("%d", t.Length),
+			t.Role,
+			status,
+		)
+	}
+	tw.Flush()
+}
+
 // Pretty-prints the list of provided Roles
 func prettyPrintRoles(rs []data.Role, writer io.Writer, roleType string) {
 	if len(rs) == 0 {
@@ -207,6 +303,41 @@ func prettyPrintRoles(rs []data.Role, writer io.Writer, roleType string) {
 		printExtraRoleRows(tw, pp, r.KeyIDs)
 	}
 	tw.Flush()
+
+	for _, r := range rs {
+		if r.Custom != nil {
+			fmt.Fprintf(writer, "\nCustom data for %s: %s\n", r.Name, string(*r.Custom))
+		}
+	}
+}
+
+// prettyPrintRoleColumn prints only one column of the roles alongside their
+// names, such as their key IDs or paths, with each value of the column on its
+// own row
+func prettyPrintRoleColumn(rs []data.Role, writer io.Writer, roleType, column string, values func(data.Role) []string) {
+	if len(rs) == 0 {
+		writer.Write([]byte(fmt.Sprintf("\nNo %s present in this repository.\n\n", roleType)))
+		return
+	}
+
+	sort.Stable(roleSorter(rs))
+
+	tw := initTabWriter([]string{"ROLE", column}, writer)
+	for _, r := range rs {
+		vals := values(r)
+		if len(vals) == 0 {
+			fmt.Fprintf(tw, twoItemRow, r.Name, "")
+			continue
+		}
+		for i, val := range vals {
+			name := ""
+			if i == 0 {
+				name = r.Name.String()
+			}
+			fmt.Fprintf(tw, twoItemRow, name, val)
+		}
+	}
+	tw.Flush()
 }
 
 func printExtraRoleRows(tw *tabwriter.Writer, paths, keyIDs []string) {
@@ -235,6 +366,155 @@ func printExtraRoleRows(tw *tabwriter.Writer, paths, keyIDs []string) {
 	}
 }
 
+// Pretty-prints the list of staged changes, numbered in changelist order
+func prettyPrintChanges(changes []changelist.Change, writer io.Writer) {
+	prettyPrintChangesFrom(changes, 0, writer)
+}
+
+// prettyPrintChangesFrom is prettyPrintChanges for changes which start at
+// index first of the changelist, so that they are numbered as in the whole
+// changelist
+func prettyPrintChangesFrom(changes []changelist.Change, first int, writer io.Writer) {
+	tw := initTabWriter(
+		[]string{"#", "ACTION", "SCOPE", "TYPE", "PATH"},
+		writer,
+	)
+	for i, ch := range changes {
+		fmt.Fprintf(
+			tw,
+			fiveItemRow,
+			fmt.Sprintf("%d", first+i),
+			ch.Action(),
+			ch.Scope(),
+			ch.Type(),
+			ch.Path(),
+		)
+	}
+	tw.Flush()
+}
+
+// porcelainEscaper escapes the characters which would otherwise break up the
+// fields or lines of porcelain output
+var porcelainEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// printPorcelainChanges prints the changes in a stable format for scripts:
+// one line per change of the tab-separated fields index, action, scope, type
+// and path, in that order.  Backslashes, tabs, newlines and carriage returns
+// in a field are escaped as \\, \t, \n and \r.  The format is stable, so
+// must not change between versions.
+func printPorcelainChanges(changes []changelist.Change, writer io.Writer) {
+	for i, ch := range changes {
+		fields := []string{strconv.Itoa(i), ch.Action(), ch.Scope().String(), ch.Type(), ch.Path()}
+		for j, field := range fields {
+			fields[j] = porcelainEscaper.Replace(field)
+		}
+		fmt.Fprintln(writer, strings.Join(fields, "\t"))
+	}
+}
+
+// Pretty-prints the validity of each key of a delegation, sorted by key ID.
+// The validity window is only printed for keys backed by certificates.
+func prettyPrintDelegationKeys(statuses []delegationKeyStatus, writer io.Writer) {
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].keyID < statuses[j].keyID })
+
+	tw := initTabWriter(
+		[]string{"KEY ID", "ALGORITHM", "NOT BEFORE", "NOT AFTER", "STATUS"},
+		writer,
+	)
+	for _, s := range statuses {
+		var notBefore, notAfter string
+		if !s.notAfter.IsZero() {
+			notBefore = s.notBefore.UTC().Format(time.RFC3339)
+			notAfter = s.notAfter.UTC().Format(time.RFC3339)
+		}
+		status := "valid"
+		if s.problem != "" {
+			status = s.problem
+		}
+		fmt.Fprintf(
+			tw,
+			fiveItemRow,
+			s.keyID,
+			s.algorithm,
+			notBefore,
+			notAfter,
+			status,
+		)
+	}
+	tw.Flush()
+}
+
+// Pretty-prints the result of verifying each target listed in a manifest,
+// sorted by target name
+func prettyPrintManifestStatuses(statuses []manifestTargetStatus, writer io.Writer) {
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].name < statuses[j].name })
+
+	tw := initTabWriter([]string{"TARGET", "ROLE", "HASHES", "STATUS"}, writer)
+	for _, s := range statuses {
+		status := "verified"
+		if s.problem != "" {
+			status = s.problem
+		}
+		fmt.Fprintf(
+			tw,
+			fourItemRow,
+			s.name,
+			s.role,
+			strings.Join(s.algorithms, ", "),
+			status,
+		)
+	}
+	tw.Flush()
+}
+
+// Pretty-prints when the metadata of each role expires, in the order given,
+// and whether it has already expired at the given time
+func prettyPrintRoleExpiries(expiries []client.RoleExpiry, now time.Time, writer io.Writer) {
+	tw := initTabWriter([]string{"ROLE", "VERSION", "EXPIRES", "STATUS"}, writer)
+	for _, e := range expiries {
+		status := "expiring"
+		if e.Expired(now) {
+			status = "expired"
+		}
+		fmt.Fprintf(
+			tw,
+			fourItemRow,
+			e.Role,
+			fmt.Sprintf("%d", e.Version),
+			e.Expires.UTC().Format(time.RFC3339),
+			status,
+		)
+	}
+	tw.Flush()
+}
+
+// Pretty-prints the keys of each version of a root, marking those that the
+// version added, followed by those that it removed
+func prettyPrintRootHistory(history []client.RootVersion, writer io.Writer) {
+	tw := initTabWriter([]string{"VERSION", "THRESHOLD", "KEY ID", "CHANGE"}, writer)
+	for _, v := range history {
+		version, threshold := strconv.Itoa(v.Version), strconv.Itoa(v.Threshold)
+		added := make(map[string]bool, len(v.Added))
+		for _, keyID := range v.Added {
+			added[keyID] = true
+		}
+		for _, keyID := range v.KeyIDs {
+			change := ""
+			if added[keyID] {
+				change = "added"
+			}
+			fmt.Fprintf(tw, fourItemRow, version, threshold, keyID, change)
+		}
+		for _, keyID := range v.Removed {
+			fmt.Fprintf(tw, fourItemRow, version, threshold, keyID, "removed")
+		}
+	}
+	tw.Flush()
+	if len(history) > 0 && history[0].Version > 1 {
+		fmt.Fprintf(writer, "\nVersions before %d of the root are no longer available from the server.\n", history[0].Version)
+	}
+}
+
 // Pretty-formats a list of delegation paths, and ensures the empty string is printed as "" in the console
 func prettyPaths(paths []string) []string {
 	// sort paths first
@@ -249,3 +529,25 @@ func prettyPaths(paths []string) []string {
 	}
 	return pp
 }
+
+// Pretty-prints the size of the metadata of each role of each GUN, followed by
+// the totals of each GUN and of the whole server
+func prettyPrintMetaSizes(sizes meta.Sizes, writer io.Writer) {
+	if len(sizes.GUNs) == 0 {
+		writer.Write([]byte("\nNo metadata present on the server.\n\n"))
+		return
+	}
+
+	tw := initTabWriter([]string{"GUN", "ROLE", "VERSIONS", "CURRENT (BYTES)", "TOTAL (BYTES)"}, writer)
+	for _, gun := range sizes.GUNs {
+		for _, role := range gun.Roles {
+			fmt.Fprintf(tw, fiveItemRow, gun.GUN, role.Role, strconv.Itoa(role.Versions),
+				strconv.FormatInt(role.CurrentBytes, 10), strconv.FormatInt(role.TotalBytes, 10))
+		}
+		fmt.Fprintf(tw, fiveItemRow, gun.GUN, "(all roles)", "",
+			strconv.FormatInt(gun.CurrentBytes, 10), strconv.FormatInt(gun.TotalBytes, 10))
+	}
+	fmt.Fprintf(tw, fiveItemRow, "(all GUNs)", "", "",
+		strconv.FormatInt(sizes.CurrentBytes, 10), strconv.FormatInt(sizes.TotalBytes, 10))
+	tw.Flush()
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/passphrase"
 	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -71,7 +72,7 @@ func TestPrettyPrintZeroKeys(t *testing.T) {
 	emptyKeyStore := trustmanager.NewKeyMemoryStore(ret)
 
 	var b bytes.Buffer
-	prettyPrintKeys([]trustmanager.KeyStore{emptyKeyStore}, &b)
+	prettyPrintKeys([]trustmanager.KeyStore{emptyKeyStore}, false, &b)
 	text, err := ioutil.ReadAll(&b)
 	require.NoError(t, err)
 
@@ -121,7 +122,7 @@ func TestPrettyPrintRootAndSigningKeys(t *testing.T) {
 	}
 
 	var b bytes.Buffer
-	prettyPrintKeys(keyStores, &b)
+	prettyPrintKeys(keyStores, false, &b)
 	text, err := ioutil.ReadAll(&b)
 	require.NoError(t, err)
 
@@ -142,13 +143,36 @@ func TestPrettyPrintRootAndSigningKeys(t *testing.T) {
 	}
 }
 
+// With short key IDs, each key ID is shortened to the same prefix length,
+// which tells apart all the key IDs listed
+func TestPrettyPrintShortKeyIDs(t *testing.T) {
+	keyStore := trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("pass"))
+	var keyIDs []string
+	for _, role := range []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole} {
+		key, err := utils.GenerateED25519Key(rand.Reader)
+		require.NoError(t, err)
+		require.NoError(t, keyStore.AddKey(trustmanager.KeyInfo{Role: role, Gun: "gun"}, key))
+		keyIDs = append(keyIDs, key.ID())
+	}
+	length := shortKeyIDLength(keyIDs)
+
+	var b bytes.Buffer
+	prettyPrintKeys([]trustmanager.KeyStore{keyStore}, true, &b)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 4)
+	for i, line := range lines[2:] {
+		fields := strings.Fields(line)
+		require.Equal(t, shortKeyID(keyIDs[i], length), fields[len(fields)-2])
+	}
+}
+
 // --- tests for pretty printing targets ---
 
 // If there are no targets, no table is printed, only a line saying that there
 // are no targets.
 func TestPrettyPrintZeroTargets(t *testing.T) {
 	var b bytes.Buffer
-	prettyPrintTargets([]*client.TargetWithRole{}, &b)
+	prettyPrintTargets([]*client.TargetWithRole{}, "name", false, &b)
 	text, err := ioutil.ReadAll(&b)
 	require.NoError(t, err)
 
@@ -175,7 +199,7 @@ func TestPrettyPrintSortedTargets(t *testing.T) {
 	}
 
 	var b bytes.Buffer
-	prettyPrintTargets(unsorted, &b)
+	prettyPrintTargets(unsorted, "name", false, &b)
 	text, err := ioutil.ReadAll(&b)
 	require.NoError(t, err)
 
@@ -199,6 +223,45 @@ func TestPrettyPrintSortedTargets(t *testing.T) {
 	}
 }
 
+// Targets can be sorted by name, size or role, in either order, and ties are
+// broken by name and then role.
+func TestPrettyPrintTargetsSortFields(t *testing.T) {
+	hashes := data.Hashes{"sha256": []byte{0xa0}}
+	targets := []*client.TargetWithRole{
+		{Target: client.Target{Name: "zebra", Hashes: hashes, Length: 5}, Role: "targets"},
+		{Target: client.Target{Name: "aardvark", Hashes: hashes, Length: 8}, Role: "targets/b"},
+		{Target: client.Target{Name: "bee", Hashes: hashes, Length: 5}, Role: "targets/a"},
+		{Target: client.Target{Name: "bee", Hashes: hashes, Length: 1}, Role: "targets"},
+	}
+
+	testCases := []struct {
+		sortBy   string
+		reverse  bool
+		expected []string
+	}{
+		{"name", false, []string{"aardvark 8 targets/b", "bee 1 targets", "bee 5 targets/a", "zebra 5 targets"}},
+		{"name", true, []string{"zebra 5 targets", "bee 5 targets/a", "bee 1 targets", "aardvark 8 targets/b"}},
+		{"size", false, []string{"bee 1 targets", "bee 5 targets/a", "zebra 5 targets", "aardvark 8 targets/b"}},
+		{"size", true, []string{"aardvark 8 targets/b", "zebra 5 targets", "bee 5 targets/a", "bee 1 targets"}},
+		{"role", false, []string{"bee 1 targets", "zebra 5 targets", "bee 5 targets/a", "aardvark 8 targets/b"}},
+		{"role", true, []string{"aardvark 8 targets/b", "bee 5 targets/a", "zebra 5 targets", "bee 1 targets"}},
+	}
+	for _, tc := range testCases {
+		// start from the same order each time
+		ts := append([]*client.TargetWithRole{}, targets...)
+		var b bytes.Buffer
+		prettyPrintTargets(ts, tc.sortBy, tc.reverse, &b)
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		require.Len(t, lines, len(tc.expected)+2)
+		for i, line := range lines[2:] {
+			fields := strings.Fields(line)
+			require.Equal(t, tc.expected[i], strings.Join([]string{fields[0], fields[2], fields[3]}, " "),
+				"sorting by %s (reverse: %v)", tc.sortBy, tc.reverse)
+		}
+	}
+}
+
 // --- tests for pretty printing roles ---
 
 // If there are no roles, no table is printed, only a line saying that there
@@ -253,3 +316,82 @@ func TestPrettyPrintSortedRoles(t *testing.T) {
 		require.Equal(t, expected[i], splitted)
 	}
 }
+
+// Projecting a single column prints only the roles' names and that column,
+// sorted by name, with extra values on extra rows
+func TestPrettyPrintRoleColumn(t *testing.T) {
+	unsorted := []data.Role{
+		{Name: "targets/zebra", Paths: []string{"stripes", "black"}, RootRole: data.RootRole{KeyIDs: []string{"101"}, Threshold: 1}},
+		{Name: "targets/bee", Paths: []string{""}, RootRole: data.RootRole{KeyIDs: []string{"246", "468"}, Threshold: 2}},
+		{Name: "targets/empty", RootRole: data.RootRole{Threshold: 1}},
+	}
+
+	var b bytes.Buffer
+	prettyPrintRoleColumn(unsorted, &b, "delegations", "KEY IDS", func(r data.Role) []string { return r.KeyIDs })
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 6)
+	require.Equal(t, []string{"ROLE", "KEY", "IDS"}, strings.Fields(lines[0]))
+	var rows [][]string
+	for _, line := range lines[2:] {
+		rows = append(rows, strings.Fields(line))
+	}
+	require.Equal(t, [][]string{{"targets/bee", "246"}, {"468"}, {"targets/empty"}, {"targets/zebra", "101"}}, rows)
+
+	b.Reset()
+	prettyPrintRoleColumn(unsorted, &b, "delegations", "PATHS", func(r data.Role) []string { return prettyPaths(r.Paths) })
+	lines = strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 6)
+	require.Equal(t, []string{"ROLE", "PATHS"}, strings.Fields(lines[0]))
+	rows = nil
+	for _, line := range lines[2:] {
+		rows = append(rows, strings.Fields(line))
+	}
+	require.Equal(t, [][]string{{"targets/bee", `""`, "<all", "paths>"}, {"targets/empty"}, {"targets/zebra", "black"}, {"stripes"}}, rows)
+
+	b.Reset()
+	prettyPrintRoleColumn(nil, &b, "delegations", "PATHS", func(r data.Role) []string { return r.Paths })
+	require.Equal(t, "No delegations present in this repository.", strings.TrimSpace(b.String()))
+}
+
+// --- tests for porcelain changes ---
+
+func TestPrintPorcelainChanges(t *testing.T) {
+	var b bytes.Buffer
+	printPorcelainChanges(nil, &b)
+	require.Empty(t, b.String())
+
+	changes := []changelist.Change{
+		changelist.NewTUFChange(changelist.ActionCreate, data.CanonicalTargetsRole, changelist.TypeTargetsTarget, "app", nil),
+		changelist.NewTUFChange(changelist.ActionDelete, "targets/releases", changelist.TypeTargetsTarget, "with\ttab\nand\\slash", nil),
+		changelist.NewTUFChange(changelist.ActionUpdate, "targets/releases", changelist.TypeTargetsDelegation, "", nil),
+	}
+	printPorcelainChanges(changes, &b)
+	require.Equal(t, "0\tcreate\ttargets\ttarget\tapp\n"+
+		"1\tdelete\ttargets/releases\ttarget\twith\\ttab\\nand\\\\slash\n"+
+		"2\tupdate\ttargets/releases\tdelegation\t\n", b.String())
+}
+
+// The keys of each version of a root are printed, marking those it added,
+// followed by those it removed
+func TestPrettyPrintRootHistory(t *testing.T) {
+	var b bytes.Buffer
+	prettyPrintRootHistory([]client.RootVersion{
+		{Version: 2, Threshold: 1, KeyIDs: []string{"a", "b"}, Added: nil},
+		{Version: 3, Threshold: 2, KeyIDs: []string{"b", "c"}, Added: []string{"c"}, Removed: []string{"a"}},
+	}, &b)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 9)
+	require.Equal(t, []string{"VERSION", "THRESHOLD", "KEY", "ID", "CHANGE"}, strings.Fields(lines[0]))
+	expected := [][]string{
+		{"2", "1", "a"},
+		{"2", "1", "b"},
+		{"3", "2", "b"},
+		{"3", "2", "c", "added"},
+		{"3", "2", "a", "removed"},
+	}
+	for i, fields := range expected {
+		require.Equal(t, fields, strings.Fields(lines[i+2]))
+	}
+	require.Equal(t, "Versions before 2 of the root are no longer available from the server.", lines[8])
+}
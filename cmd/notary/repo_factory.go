@@ -1,15 +1,25 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/spf13/viper"
 
 	"net/http"
 
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/storage"
 	"github.com/theupdateframework/notary/tuf/data"
 )
 
+const (
+	// remoteServerTypeNotary is the default remote_server.type, a notary server
+	remoteServerTypeNotary = "notary"
+	// remoteServerTypeOCI reads trust data from an OCI registry's referrers API
+	remoteServerTypeOCI = "oci"
+)
+
 // RepoFactory takes a GUN and returns an initialized client.Repository, or an error.
 type RepoFactory func(gun data.GUN) (client.Repository, error)
 
@@ -24,12 +34,40 @@ func ConfigureRepo(v *viper.Viper, retriever notary.PassRetriever, onlineOperati
 			return nil, err
 		}
 		if onlineOperation {
-			rt, err = getTransport(v, gun, permission)
+			rt, err = getTransport(v, gun, permission, retriever)
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch serverType := v.GetString("remote_server.type"); serverType {
+		case "", remoteServerTypeNotary:
+		case remoteServerTypeOCI:
+			remoteStore, err := storage.NewOCIStore(
+				getRemoteTrustServer(v),
+				gun.String(),
+				v.GetString("remote_server.oci_subject_tag"),
+				rt,
+			)
+			if err != nil {
+				return nil, err
+			}
+			repo, err := client.NewFileCachedRepositoryWithRemoteStore(
+				v.GetString("trust_dir"),
+				gun,
+				getRemoteTrustServer(v),
+				remoteStore,
+				retriever,
+				trustPin,
+			)
 			if err != nil {
 				return nil, err
 			}
+			return repo, applyRepoConfig(v, repo)
+		default:
+			return nil, fmt.Errorf("unknown remote_server.type %q: must be %q or %q",
+				serverType, remoteServerTypeNotary, remoteServerTypeOCI)
 		}
-		return client.NewFileCachedRepository(
+		repo, err := client.NewFileCachedRepository(
 			v.GetString("trust_dir"),
 			gun,
 			getRemoteTrustServer(v),
@@ -37,7 +75,37 @@ func ConfigureRepo(v *viper.Viper, retriever notary.PassRetriever, onlineOperati
 			retriever,
 			trustPin,
 		)
+		if err != nil {
+			return nil, err
+		}
+		return repo, applyRepoConfig(v, repo)
 	}
 
 	return localRepo
 }
+
+// applyRepoConfig sets the options in the configuration which apply to
+// repositories once they have been created
+func applyRepoConfig(v *viper.Viper, repo client.Repository) error {
+	clockSkewThreshold, err := getClockSkewThreshold(v)
+	if err != nil {
+		return err
+	}
+	repo.SetClockSkewThreshold(clockSkewThreshold)
+	repo.SetCacheCompression(v.GetBool("cache.compress"))
+	if err := repo.SetServerVersion(v.GetString("remote_server.version")); err != nil {
+		return fmt.Errorf("invalid remote_server.version: %w", err)
+	}
+	signatureAlgorithms, err := getSignatureAlgorithms(v)
+	if err != nil {
+		return err
+	}
+	if err := repo.SetSignatureAlgorithms(signatureAlgorithms); err != nil {
+		return err
+	}
+	statusMapping, err := getStatusMapping(v)
+	if err != nil {
+		return err
+	}
+	return repo.SetStatusMapping(statusMapping)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// roleChainLink is one of the roles that established trust in a verified
+// target: which keys it trusts, how many of them must sign, and which of them
+// signed its metadata
+type roleChainLink struct {
+	Role      data.RoleName `json:"role"`
+	KeyIDs    []string      `json:"key_ids"`
+	Threshold int           `json:"threshold"`
+	SignedBy  []string      `json:"signed_by"`
+	Paths     []string      `json:"paths,omitempty"`
+}
+
+// roleChain is the audit record of how a verified target came to be trusted:
+// the root, each role traversed from the base targets role down to the
+// delegation which listed the target, and that vouching role
+type roleChain struct {
+	GUN          data.GUN        `json:"gun"`
+	Target       string          `json:"target"`
+	Hashes       data.Hashes     `json:"hashes"`
+	Length       int64           `json:"length"`
+	Root         roleChainLink   `json:"root"`
+	Chain        []roleChainLink `json:"chain"`
+	VouchingRole data.RoleName   `json:"vouching_role"`
+}
+
+// getRoleChain returns the chain of roles which established trust in the
+// target, which was found in the role given by target.Role
+func getRoleChain(roles []client.RoleWithSignatures, gun data.GUN, target *client.TargetWithRole) (*roleChain, error) {
+	byName := make(map[data.RoleName]client.RoleWithSignatures, len(roles))
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+	link := func(name data.RoleName) (roleChainLink, error) {
+		role, ok := byName[name]
+		if !ok {
+			return roleChainLink{}, fmt.Errorf("role %s, which vouches for %s, is not in the trusted collection %s", name, target.Name, gun)
+		}
+		return newRoleChainLink(role), nil
+	}
+
+	root, err := link(data.CanonicalRootRole)
+	if err != nil {
+		return nil, err
+	}
+	// delegations are named for their place in the tree, so the roles
+	// traversed to reach one are the delegations it is nested in
+	var chain []roleChainLink
+	for name := target.Role; ; name = name.Parent() {
+		l, err := link(name)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]roleChainLink{l}, chain...)
+		if !data.IsDelegation(name) {
+			break
+		}
+	}
+	return &roleChain{
+		GUN:          gun,
+		Target:       target.Name,
+		Hashes:       target.Hashes,
+		Length:       target.Length,
+		Root:         root,
+		Chain:        chain,
+		VouchingRole: target.Role,
+	}, nil
+}
+
+func newRoleChainLink(role client.RoleWithSignatures) roleChainLink {
+	trusted := make(map[string]bool, len(role.KeyIDs))
+	for _, keyID := range role.KeyIDs {
+		trusted[keyID] = true
+	}
+	signedBy := []string{}
+	for _, sig := range role.Signatures {
+		if trusted[sig.KeyID] {
+			signedBy = append(signedBy, sig.KeyID)
+		}
+	}
+	keyIDs := append([]string{}, role.KeyIDs...)
+	sort.Strings(keyIDs)
+	sort.Strings(signedBy)
+	return roleChainLink{
+		Role:      role.Name,
+		KeyIDs:    keyIDs,
+		Threshold: role.Threshold,
+		SignedBy:  signedBy,
+		Paths:     role.Paths,
+	}
+}
+
+// writeRoleChain writes the chain of roles which established trust in the
+// verified target to the file given by --output-role-chain, if any
+func writeRoleChain(t *tufCommander, nRepo client.Repository, gun data.GUN, target *client.TargetWithRole) error {
+	if t.roleChainFile == "" {
+		return nil
+	}
+	roles, err := nRepo.ListRoles()
+	if err != nil {
+		return err
+	}
+	chain, err := getRoleChain(roles, gun, target)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(chain, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(t.roleChainFile, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing the role chain to %s: %w", t.roleChainFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/meta"
+)
+
+var cmdServerTemplate = usageTemplate{
+	Use:   "server",
+	Short: "Operates on the remote trust server.",
+	Long:  "Administrative operations on the remote trust server.",
+}
+
+var cmdServerGCTemplate = usageTemplate{
+	Use:   "gc",
+	Short: "Removes orphaned metadata from the remote trust server.",
+	Long:  "Removes metadata that is not referenced by the current timestamp and snapshot of any Global Unique Name from the remote trust server, such as versions left behind by partial publishes or roles of deleted delegations. Requires admin access to the server.",
+}
+
+var cmdServerExportDBTemplate = usageTemplate{
+	Use:   "export-db",
+	Short: "Exports all metadata from the remote trust server.",
+	Long:  "Exports every version of every role of every Global Unique Name stored by the remote trust server, one JSON object per line, in a form which does not depend on the server's storage backend.  The export can be restored into a server with any storage backend by running notary-server with -import.  Requires admin access to the server.",
+}
+
+var cmdServerReindexTemplate = usageTemplate{
+	Use:   "reindex",
+	Short: "Rebuilds the changefeed of the remote trust server.",
+	Long:  "Rebuilds the changefeed of the remote trust server from its stored metadata, if it has become inconsistent, for instance after its database was edited by hand.  Every stored version of a timestamp gets exactly one change, and the changes are renumbered in the order they were made, with new IDs following on from the highest existing one so that changefeed consumers keep their place.  Only supported by storage backends which number their changes, such as MySQL, PostgreSQL and SQLite.  Requires admin access to the server.",
+}
+
+var cmdServerSizesTemplate = usageTemplate{
+	Use:   "sizes",
+	Short: "Reports the size of the metadata on the remote trust server.",
+	Long:  "Reports the size of the metadata stored by the remote trust server for each role of each Global Unique Name, both of its current version and of all its stored versions, along with the totals of each Global Unique Name and of the whole server.  Requires admin access to the server.",
+}
+
+var cmdServerConfigTemplate = usageTemplate{
+	Use:   "config",
+	Short: "Operates on the configuration of the remote trust server.",
+	Long:  "Operates on the configuration of the remote trust server.",
+}
+
+var cmdServerConfigDumpTemplate = usageTemplate{
+	Use:   "dump",
+	Short: "Prints the effective configuration of the remote trust server.",
+	Long:  "Prints the effective configuration of the remote trust server as JSON, as loaded from its configuration file, environment and defaults, for support and debugging.  Secrets, such as passwords, keys and the credentials in database URLs, are redacted by the server.  Requires admin access to the server.",
+}
+
+var cmdServerMetricsTemplate = usageTemplate{
+	Use:   "metrics",
+	Short: "Operates on the metrics of the remote trust server.",
+	Long:  "Operates on the metrics of the remote trust server.",
+}
+
+var cmdServerMetricsSnapshotTemplate = usageTemplate{
+	Use:   "snapshot",
+	Short: "Prints a snapshot of the operational metrics of the remote trust server.",
+	Long:  "Prints a point-in-time snapshot of the operational metrics of the remote trust server as JSON, for support tickets: the rate, error counts and latency of the requests for each operation, the latency of each storage operation, the number of updates rejected by validation and the number of Global Unique Names published to since the server started.  Requires admin access to the server.",
+}
+
+type serverCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+
+	dryRun bool
+	output string
+	pretty bool
+}
+
+// prettyNotice labels pretty-printed output, which is for display only
+const prettyNotice = "pretty-printed for display only: this is not canonical JSON, so it must not be signed, verified or imported"
+
+// prettyMeta is a stored version of a role, with its metadata indented for
+// review rather than in the canonical form it was signed in.  Compacting the
+// metadata gives back the signed bytes, whose checksum is SHA256.
+type prettyMeta struct {
+	Notice string `json:"_notice"`
+	meta.Record
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+type reindexResult struct {
+	DryRun          bool `json:"dry_run"`
+	NumberOfChanges int  `json:"count"`
+	Renumbered      int  `json:"renumbered"`
+	Added           int  `json:"added"`
+	Removed         int  `json:"removed"`
+}
+
+type gcResult struct {
+	DryRun          bool          `json:"dry_run"`
+	NumberOfRecords int           `json:"count"`
+	Records         []meta.Record `json:"records"`
+}
+
+func (s *serverCommander) GetCommand() *cobra.Command {
+	cmd := cmdServerTemplate.ToCommand(nil)
+
+	cmdGC := cmdServerGCTemplate.ToCommand(s.serverGC)
+	cmdGC.Flags().BoolVar(&s.dryRun, "dry-run", false, "Report the metadata that would be removed, without removing it")
+	cmd.AddCommand(cmdGC)
+
+	cmdReindex := cmdServerReindexTemplate.ToCommand(s.serverReindex)
+	cmdReindex.Flags().BoolVar(&s.dryRun, "dry-run", false, "Report how the changefeed would be rebuilt, without changing it")
+	cmd.AddCommand(cmdReindex)
+
+	cmdExportDB := cmdServerExportDBTemplate.ToCommand(s.serverExportDB)
+	cmdExportDB.Flags().StringVarP(&s.output, "output", "o", "", "Write the export to a file, instead of STDOUT")
+	cmdExportDB.Flags().BoolVar(&s.pretty, "pretty", false, "Pretty-print the metadata for review. The output is not canonical JSON, so it cannot be imported")
+	cmd.AddCommand(cmdExportDB)
+
+	cmd.AddCommand(cmdServerSizesTemplate.ToCommand(s.serverSizes))
+
+	cmdConfig := cmdServerConfigTemplate.ToCommand(nil)
+	cmdConfig.AddCommand(cmdServerConfigDumpTemplate.ToCommand(s.serverConfigDump))
+	cmd.AddCommand(cmdConfig)
+
+	cmdMetrics := cmdServerMetricsTemplate.ToCommand(nil)
+	cmdMetrics.AddCommand(cmdServerMetricsSnapshotTemplate.ToCommand(s.serverMetricsSnapshot))
+	cmd.AddCommand(cmdMetrics)
+
+	return cmd
+}
+
+// serverRequest sends an admin request to the given path on the remote trust
+// server, and returns the response if it was successful
+func (s *serverCommander) serverRequest(method, subPath string, query url.Values, body io.Reader) (*http.Response, error) {
+	config, err := s.configGetter()
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := getTransport(config, "", admin, s.retriever)
+	if err != nil {
+		return nil, err
+	}
+	if rt == nil {
+		return nil, fmt.Errorf("could not reach trust server %s", getRemoteTrustServer(config))
+	}
+
+	endpoint, err := url.Parse(getRemoteTrustServer(config))
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = path.Join(endpoint.Path, subPath)
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, endpoint.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("trust server returned %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func (s *serverCommander) serverGC(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return fmt.Errorf("gc does not take any arguments")
+	}
+
+	var query url.Values
+	if s.dryRun {
+		query = url.Values{"dry_run": []string{"true"}}
+	}
+	resp, err := s.serverRequest("POST", "/v2/_trust/gc", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var result gcResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("could not parse response from trust server: %v", err)
+	}
+
+	out := cmd.OutOrStdout()
+	verb := "Removed"
+	if result.DryRun {
+		verb = "Would remove"
+	}
+	fmt.Fprintf(out, "%s %d orphaned metadata record(s)\n", verb, result.NumberOfRecords)
+	for _, r := range result.Records {
+		fmt.Fprintf(out, "%s\t%s\tversion %d\t%s\n", r.GUN, r.Role, r.Version, r.SHA256)
+	}
+	return nil
+}
+
+func (s *serverCommander) serverReindex(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return fmt.Errorf("reindex does not take any arguments")
+	}
+
+	var query url.Values
+	if s.dryRun {
+		query = url.Values{"dry_run": []string{"true"}}
+	}
+	resp, err := s.serverRequest("POST", "/v2/_trust/changefeed/reindex", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result reindexResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("could not parse response from trust server: %v", err)
+	}
+
+	verb := "Reindexed"
+	if result.DryRun {
+		verb = "Would reindex"
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s changefeed of %d change(s): %d renumbered, %d added, %d duplicate(s) removed\n",
+		verb, result.NumberOfChanges, result.Renumbered, result.Added, result.Removed)
+	return nil
+}
+
+func (s *serverCommander) serverExportDB(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return fmt.Errorf("export-db does not take any arguments")
+	}
+
+	resp, err := s.serverRequest("GET", "/v2/_trust/export", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out := cmd.OutOrStdout()
+	if s.output != "" {
+		f, err := os.OpenFile(s.output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, notary.PrivNoExecPerms)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	// re-encode each record as it arrives, so that a truncated or garbled
+	// export is reported rather than silently written out
+	dec := json.NewDecoder(resp.Body)
+	enc := json.NewEncoder(out)
+	if s.pretty {
+		// only whitespace may differ from the signed metadata
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+	}
+	count := 0
+	for {
+		var exported meta.ExportedMeta
+		if err := dec.Decode(&exported); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("export from trust server failed after %d record(s): %v", count, err)
+		}
+		var record interface{} = exported
+		if s.pretty {
+			if !json.Valid(exported.Data) {
+				return fmt.Errorf("cannot pretty-print %s %s version %d, which is not JSON", exported.GUN, exported.Role, exported.Version)
+			}
+			record = prettyMeta{Notice: prettyNotice, Record: exported.Record, Metadata: exported.Data}
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if s.output != "" {
+		cmd.Printf("Exported %d metadata record(s) to %s\n", count, s.output)
+	}
+	return nil
+}
+
+func (s *serverCommander) serverSizes(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return fmt.Errorf("sizes does not take any arguments")
+	}
+
+	resp, err := s.serverRequest("GET", "/v2/_trust/sizes", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var sizes meta.Sizes
+	if err := json.NewDecoder(resp.Body).Decode(&sizes); err != nil {
+		return fmt.Errorf("could not parse response from trust server: %v", err)
+	}
+	prettyPrintMetaSizes(sizes, cmd.OutOrStdout())
+	return nil
+}
+
+func (s *serverCommander) serverConfigDump(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return fmt.Errorf("dump does not take any arguments")
+	}
+
+	resp, err := s.serverRequest("GET", "/v2/_trust/config", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var config map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return fmt.Errorf("could not parse response from trust server: %v", err)
+	}
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(config)
+}
+
+func (s *serverCommander) serverMetricsSnapshot(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return fmt.Errorf("snapshot does not take any arguments")
+	}
+
+	resp, err := s.serverRequest("GET", "/v2/_trust/metrics", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the snapshot is indented as it is, so that its fields keep their order
+	var snapshot json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return fmt.Errorf("could not parse response from trust server: %v", err)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, snapshot, "", "  "); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err = out.WriteTo(cmd.OutOrStdout())
+	return err
+}
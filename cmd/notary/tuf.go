@@ -2,17 +2,25 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,13 +35,17 @@ import (
 	"github.com/spf13/viper"
 	"github.com/theupdateframework/notary"
 	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/cryptoservice"
 	"github.com/theupdateframework/notary/passphrase"
+	store "github.com/theupdateframework/notary/storage"
 	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
 	tufutils "github.com/theupdateframework/notary/tuf/utils"
 	"github.com/theupdateframework/notary/utils"
+	"golang.org/x/crypto/pkcs12"
 )
 
 var cmdTUFListTemplate = usageTemplate{
@@ -72,6 +84,12 @@ var cmdTUFLookupTemplate = usageTemplate{
 	Long:  "Looks up a specific target in a remote trusted collection identified by the Globally Unique Name.",
 }
 
+var cmdTUFRootHistoryTemplate = usageTemplate{
+	Use:   "root-history [ GUN ]",
+	Short: "Shows how the root keys of a remote trusted collection have changed.",
+	Long:  "Shows the keys of each version of the root of the remote trusted collection identified by the Globally Unique Name, and which keys each version added and removed, for audit.  The past versions of the root are downloaded from the server, and each must be signed by the keys of the version before it.  This is an online operation.",
+}
+
 var cmdTUFPublishTemplate = usageTemplate{
 	Use:   "publish [ GUN ]",
 	Short: "Publishes the local trusted collection.",
@@ -93,7 +111,7 @@ var cmdTUFResetTemplate = usageTemplate{
 var cmdTUFVerifyTemplate = usageTemplate{
 	Use:   "verify [ GUN ] <target>",
 	Short: "Verifies if the content is included in the remote trusted collection",
-	Long:  "Verifies if the data passed in STDIN is included in the remote trusted collection identified by the Globally Unique Name.",
+	Long:  "Verifies if the data passed in STDIN, or the object at the given URL, is included in the remote trusted collection identified by the Globally Unique Name.",
 }
 
 var cmdWitnessTemplate = usageTemplate{
@@ -102,6 +120,12 @@ var cmdWitnessTemplate = usageTemplate{
 	Long:  "Marks roles to be re-signed the next time they're published. Currently will always bump version and expiry for role. N.B. behaviour may change when thresholding is introduced.",
 }
 
+var cmdVerifySignatureTemplate = usageTemplate{
+	Use:   "verify-signature [ GUN ] [ Role ]",
+	Short: "Verifies a detached signature over a file against the keys of a role",
+	Long:  "Verifies signatures over the file given by --data, read as JSON TUF signatures from the file given by --sig, against the keys of a role of the remote trusted collection identified by the Globally Unique Name. Succeeds if the signatures by distinct keys of the role meet its threshold.",
+}
+
 var cmdTUFDeleteTemplate = usageTemplate{
 	Use:   "delete [ GUN ]",
 	Short: "Deletes all content for a trusted collection",
@@ -112,56 +136,105 @@ type tufCommander struct {
 	// these need to be set
 	configGetter func() (*viper.Viper, error)
 	retriever    notary.PassRetriever
+	stdin        io.Reader
+	clock        data.Clock
 
 	// these are for command line parsing - no need to set
-	roles    []string
-	sha256   string
-	sha512   string
-	rootKey  string
-	rootCert string
-	custom   string
-
-	input  string
-	output string
-	quiet  bool
+	roles       []string
+	sha256      string
+	sha512      string
+	rootKey     string
+	targetsKey  string
+	rootCert    string
+	initialRoot string
+	keyAlgo     string
+	custom      string
+	customMerge bool
+	hashAlgos   []string
+
+	initInteractive bool
+
+	input         string
+	output        string
+	quiet         bool
+	fromURL       string
+	headers       []string
+	printRole     bool
+	roleChainFile string
+	strictHashes  bool
+	manifest      string
+	atVersion     int
+	sortBy        string
+	sortReverse   bool
+
+	diffRemote     bool
+	expiredOnly    bool
+	expiringWithin time.Duration
+	porcelain      bool
 
 	resetAll          bool
+	resetInteractive  bool
 	deleteIdx         []int
+	keepIdx           []int
 	archiveChangelist string
 
 	deleteRemote bool
 
-	autoPublish bool
+	dataFile string
+	sigFile  string
+
+	autoPublish  bool
+	publishRoles []string
 }
 
 func (t *tufCommander) AddToCommand(cmd *cobra.Command) {
 	//
 	cmdTUFInit := cmdTUFInitTemplate.ToCommand(t.tufInit)
 	cmdTUFInit.Flags().StringVar(&t.rootKey, "rootkey", "", "Root key to initialize the repository with")
+	cmdTUFInit.Flags().StringVar(&t.targetsKey, "targetskey", "", "Existing targets key to initialize the repository with, instead of generating one")
 	cmdTUFInit.Flags().StringVar(&t.rootCert, "rootcert", "", "Root certificate must match root key if a root key is supplied, otherwise it must match a key present in keystore")
+	cmdTUFInit.Flags().StringVar(&t.keyAlgo, "key-algorithm", "", "Algorithm of the keys the server generates for the snapshot and timestamp roles (ecdsa or ed25519). Defaults to the server's configured algorithm")
 	cmdTUFInit.Flags().BoolVarP(&t.autoPublish, "publish", "p", false, htAutoPublish)
+	cmdTUFInit.Flags().BoolVarP(&t.initInteractive, "interactive", "i", false, "Prompt step by step for the root key, the root expiry, delegations to add and whether to publish, instead of passing flags")
+	cmdTUFInit.Flags().StringVar(&t.initialRoot, "initial-root", "", "Signed root.json, or JSON array of signed root.json files ordered by version, to trust for an existing repository instead of trusting the server's root on first use")
 	cmd.AddCommand(cmdTUFInit)
 
-	cmd.AddCommand(cmdTUFStatusTemplate.ToCommand(t.tufStatus))
+	cmdTUFStatus := cmdTUFStatusTemplate.ToCommand(t.tufStatus)
+	cmdTUFStatus.Flags().BoolVar(&t.diffRemote, "diff-remote", false, "Also list the targets as they would be after publishing, by applying the unpublished changes to the remote trusted collection")
+	cmdTUFStatus.Flags().BoolVar(&t.expiredOnly, "expired-only", false, "Instead of the unpublished changes, list only the roles whose published metadata has expired and needs re-signing")
+	cmdTUFStatus.Flags().DurationVar(&t.expiringWithin, "expiring-within", 0, "With --expired-only, also list the roles whose metadata expires within this duration, such as 720h")
+	cmdTUFStatus.Flags().BoolVar(&t.porcelain, "porcelain", false, "List the unpublished changes in a stable format for scripts: one line per change of tab-separated index, action, scope, type and path")
+	cmd.AddCommand(cmdTUFStatus)
 
 	cmdReset := cmdTUFResetTemplate.ToCommand(t.tufReset)
 	cmdReset.Flags().IntSliceVarP(&t.deleteIdx, "number", "n", nil, "Numbers of specific changes to exclusively reset, as shown in status list")
 	cmdReset.Flags().BoolVar(&t.resetAll, "all", false, "Reset all changes shown in the status list")
+	cmdReset.Flags().IntSliceVar(&t.keepIdx, "keep", nil, "Numbers of specific changes to keep, as shown in status list, resetting all the others")
+	cmdReset.Flags().BoolVarP(&t.resetInteractive, "interactive", "i", false, "Prompt for each change in the status list whether it should be reset")
 	cmd.AddCommand(cmdReset)
 
-	cmd.AddCommand(cmdTUFPublishTemplate.ToCommand(t.tufPublish))
+	cmdTUFPublish := cmdTUFPublishTemplate.ToCommand(t.tufPublish)
+	cmdTUFPublish.Flags().BoolVarP(&t.quiet, "quiet", "q", false, "Do not report the progress of the publish")
+	cmdTUFPublish.Flags().StringSliceVar(&t.publishRoles, "roles", nil, "Only publish the staged changes to these roles, leaving changes to other roles staged")
+	cmd.AddCommand(cmdTUFPublish)
 
 	cmd.AddCommand(cmdTUFLookupTemplate.ToCommand(t.tufLookup))
 
+	cmd.AddCommand(cmdTUFRootHistoryTemplate.ToCommand(t.tufRootHistory))
+
 	cmdTUFList := cmdTUFListTemplate.ToCommand(t.tufList)
 	cmdTUFList.Flags().StringSliceVarP(
 		&t.roles, "roles", "r", nil, "Delegation roles to list targets for (will shadow targets role)")
+	cmdTUFList.Flags().StringVar(&t.sortBy, "sort", "name", "Field to sort the targets by: name, size or role")
+	cmdTUFList.Flags().BoolVar(&t.sortReverse, "reverse", false, "List the targets in reverse order")
 	cmd.AddCommand(cmdTUFList)
 
 	cmdTUFAdd := cmdTUFAddTemplate.ToCommand(t.tufAdd)
 	cmdTUFAdd.Flags().StringSliceVarP(&t.roles, "roles", "r", nil, "Delegation roles to add this target to")
 	cmdTUFAdd.Flags().BoolVarP(&t.autoPublish, "publish", "p", false, htAutoPublish)
 	cmdTUFAdd.Flags().StringVar(&t.custom, "custom", "", "Path to the file containing custom data for this target")
+	cmdTUFAdd.Flags().BoolVar(&t.customMerge, "custom-merge", false, htCustomMerge)
+	cmdTUFAdd.Flags().StringSliceVar(&t.hashAlgos, "hash-algos", nil, "Hash algorithms to compute for the target, from sha256 and sha512 (default all of them)")
 	cmd.AddCommand(cmdTUFAdd)
 
 	cmdTUFRemove := cmdTUFRemoveTemplate.ToCommand(t.tufRemove)
@@ -175,18 +248,31 @@ func (t *tufCommander) AddToCommand(cmd *cobra.Command) {
 	cmdTUFAddHash.Flags().StringVar(&t.sha512, notary.SHA512, "", "hex encoded sha512 of the target to add")
 	cmdTUFAddHash.Flags().BoolVarP(&t.autoPublish, "publish", "p", false, htAutoPublish)
 	cmdTUFAddHash.Flags().StringVar(&t.custom, "custom", "", "Path to the file containing custom data for this target")
+	cmdTUFAddHash.Flags().BoolVar(&t.customMerge, "custom-merge", false, htCustomMerge)
 	cmd.AddCommand(cmdTUFAddHash)
 
 	cmdTUFVerify := cmdTUFVerifyTemplate.ToCommand(t.tufVerify)
 	cmdTUFVerify.Flags().StringVarP(&t.input, "input", "i", "", "Read from a file, instead of STDIN")
 	cmdTUFVerify.Flags().StringVarP(&t.output, "output", "o", "", "Write to a file, instead of STDOUT")
 	cmdTUFVerify.Flags().BoolVarP(&t.quiet, "quiet", "q", false, "No output except for errors")
+	cmdTUFVerify.Flags().StringVar(&t.fromURL, "from-url", "", "Verify the object at this URL, instead of reading from STDIN. A dropped download is resumed with a range request, or restarted if the server does not support ranges")
+	cmdTUFVerify.Flags().StringSliceVarP(&t.headers, "header", "H", nil, "Header to send when fetching from --from-url, in the form \"Name: value\", e.g. for authorization")
+	cmdTUFVerify.Flags().BoolVar(&t.printRole, "print-role", false, "Report the role that authorized the verified target on STDERR, even with --quiet")
+	cmdTUFVerify.Flags().StringVar(&t.roleChainFile, "output-role-chain", "", "Write the chain of roles and keys that established trust in the verified target to this file as JSON, for audit records")
+	cmdTUFVerify.Flags().BoolVar(&t.strictHashes, "strict-hashes", false, "Require the target to have both sha256 and sha512 hashes, and every hash to match")
+	cmdTUFVerify.Flags().IntVar(&t.atVersion, "at-version", 0, "Verify against the trusted collection as it was at this version of its snapshot, instead of as it is now")
+	cmdTUFVerify.Flags().StringVar(&t.manifest, "manifest", "", "Verify that every target listed in this manifest of target names and hashes is in the trusted collection with matching hashes, instead of verifying a single target")
 	cmd.AddCommand(cmdTUFVerify)
 
 	cmdWitness := cmdWitnessTemplate.ToCommand(t.tufWitness)
 	cmdWitness.Flags().BoolVarP(&t.autoPublish, "publish", "p", false, htAutoPublish)
 	cmd.AddCommand(cmdWitness)
 
+	cmdVerifySignature := cmdVerifySignatureTemplate.ToCommand(t.verifySignature)
+	cmdVerifySignature.Flags().StringVar(&t.dataFile, "data", "", "Path to the file which was signed")
+	cmdVerifySignature.Flags().StringVar(&t.sigFile, "sig", "", "Path to the signature, as a JSON TUF signature or array of signatures")
+	cmd.AddCommand(cmdVerifySignature)
+
 	cmdTUFDeleteGUN := cmdTUFDeleteTemplate.ToCommand(t.tufDeleteGUN)
 	cmdTUFDeleteGUN.Flags().BoolVar(&t.deleteRemote, "remote", false, "Delete remote data for GUN in addition to local cache")
 	cmd.AddCommand(cmdTUFDeleteGUN)
@@ -205,7 +291,7 @@ func (t *tufCommander) tufWitness(cmd *cobra.Command, args []string) error {
 	gun := data.GUN(args[0])
 	roles := data.NewRoleList(args[1:])
 
-	fact := ConfigureRepo(config, t.retriever, false, readOnly)
+	fact := t.configureRepo(config, false, readOnly)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
@@ -221,7 +307,7 @@ func (t *tufCommander) tufWitness(cmd *cobra.Command, args []string) error {
 		strings.Join(data.RolesListToStringList(success), "\n\t- "),
 	)
 
-	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever)
+	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever, t.clock)
 }
 
 func getTargetHashes(t *tufCommander) (data.Hashes, error) {
@@ -266,6 +352,83 @@ func getTargetCustom(targetCustomFilename string) (*canonicaljson.RawMessage, er
 	return targetCustom, nil
 }
 
+// mergeWithPublishedCustom deep merges the custom data into that of the target
+// with the same name already published in the given roles, if there is one.
+// Objects are merged key by key, but any other values which differ conflict.
+func mergeWithPublishedCustom(nRepo notaryclient.Repository, targetName string, roles []data.RoleName,
+	targetCustom *canonicaljson.RawMessage) (*canonicaljson.RawMessage, error) {
+
+	existing, err := nRepo.GetTargetByName(targetName, roles...)
+	if err != nil {
+		if _, ok := err.(notaryclient.ErrNoSuchTarget); ok {
+			return targetCustom, nil
+		}
+		return nil, err
+	}
+	if existing.Custom == nil {
+		return targetCustom, nil
+	}
+
+	existingValue, err := decodeCustom(*existing.Custom)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the published custom data of target %s: %v", targetName, err)
+	}
+	newValue, err := decodeCustom(*targetCustom)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := mergeCustom(existingValue, newValue, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to merge custom data into target %s: %v", targetName, err)
+	}
+	mergedJSON, err := canonicaljson.MarshalCanonical(merged)
+	if err != nil {
+		return nil, err
+	}
+	mergedCustom := canonicaljson.RawMessage(mergedJSON)
+	return &mergedCustom, nil
+}
+
+// decodeCustom decodes custom JSON data, keeping numbers as they were written
+func decodeCustom(raw []byte) (interface{}, error) {
+	var value interface{}
+	dec := canonicaljson.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// mergeCustom recursively merges src into dst.  path is the location of the
+// values within the custom data, for reporting conflicts.
+func mergeCustom(dst, src interface{}, path string) (interface{}, error) {
+	dstObject, dstIsObject := dst.(map[string]interface{})
+	srcObject, srcIsObject := src.(map[string]interface{})
+	if !dstIsObject || !srcIsObject {
+		if reflect.DeepEqual(dst, src) {
+			return dst, nil
+		}
+		if path == "" {
+			return nil, fmt.Errorf("the existing and new custom data conflict, and are not both JSON objects")
+		}
+		return nil, fmt.Errorf("the existing and new values of %s conflict", path)
+	}
+	for key, srcValue := range srcObject {
+		dstValue, ok := dstObject[key]
+		if !ok {
+			dstObject[key] = srcValue
+			continue
+		}
+		merged, err := mergeCustom(dstValue, srcValue, path+"/"+key)
+		if err != nil {
+			return nil, err
+		}
+		dstObject[key] = merged
+	}
+	return dstObject, nil
+}
+
 func (t *tufCommander) tufAddByHash(cmd *cobra.Command, args []string) error {
 	if len(args) < 3 || t.sha256 == "" && t.sha512 == "" {
 		cmd.Usage()
@@ -287,19 +450,31 @@ func (t *tufCommander) tufAddByHash(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if t.customMerge && t.custom == "" {
+		return fmt.Errorf("--custom-merge requires custom data to merge, given with --custom")
+	}
+
 	targetInt64Len, err := strconv.ParseInt(targetSize, 0, 64)
 	if err != nil {
 		return err
 	}
 
-	// no online operations are performed by add so the transport argument
-	// should be nil
-	fact := ConfigureRepo(config, t.retriever, false, readWrite)
+	// no online operations are performed by add, unless the custom data is to
+	// be merged into that of the published target, so otherwise the transport
+	// argument should be nil
+	fact := t.configureRepo(config, t.customMerge, readWrite)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
 
+	if t.customMerge {
+		targetCustom, err = mergeWithPublishedCustom(nRepo, targetName, data.NewRoleList(t.roles), targetCustom)
+		if err != nil {
+			return err
+		}
+	}
+
 	targetHashes, err := getTargetHashes(t)
 	if err != nil {
 		return err
@@ -324,7 +499,7 @@ func (t *tufCommander) tufAddByHash(cmd *cobra.Command, args []string) error {
 		"Addition of target \"%s\" by %s hash to repository \"%s\" staged for next publish.\n",
 		targetName, strings.Join(hashesUsed, ", "), gun)
 
-	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever)
+	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever, t.clock)
 }
 
 func (t *tufCommander) tufAdd(cmd *cobra.Command, args []string) error {
@@ -348,15 +523,32 @@ func (t *tufCommander) tufAdd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// no online operations are performed by add so the transport argument
-	// should be nil
-	fact := ConfigureRepo(config, t.retriever, false, readWrite)
+	if t.customMerge && t.custom == "" {
+		return fmt.Errorf("--custom-merge requires custom data to merge, given with --custom")
+	}
+
+	hashAlgorithms, err := getHashAlgorithms(t.hashAlgos)
+	if err != nil {
+		return err
+	}
+
+	// no online operations are performed by add, unless the custom data is to
+	// be merged into that of the published target, so otherwise the transport
+	// argument should be nil
+	fact := t.configureRepo(config, t.customMerge, readWrite)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
 
-	target, err := notaryclient.NewTarget(targetName, targetPath, targetCustom)
+	if t.customMerge {
+		targetCustom, err = mergeWithPublishedCustom(nRepo, targetName, data.NewRoleList(t.roles), targetCustom)
+		if err != nil {
+			return err
+		}
+	}
+
+	target, err := notaryclient.NewTarget(targetName, targetPath, targetCustom, hashAlgorithms...)
 	if err != nil {
 		return err
 	}
@@ -367,7 +559,7 @@ func (t *tufCommander) tufAdd(cmd *cobra.Command, args []string) error {
 
 	cmd.Printf("Addition of target \"%s\" to repository \"%s\" staged for next publish.\n", targetName, gun)
 
-	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever)
+	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever, t.clock)
 }
 
 func (t *tufCommander) tufDeleteGUN(cmd *cobra.Command, args []string) error {
@@ -386,7 +578,7 @@ func (t *tufCommander) tufDeleteGUN(cmd *cobra.Command, args []string) error {
 	var rt http.RoundTripper
 	var remoteDeleteInfo string
 	if t.deleteRemote {
-		rt, err = getTransport(config, gun, admin)
+		rt, err = getTransport(config, gun, admin, t.retriever)
 		if err != nil {
 			return err
 		}
@@ -440,6 +632,36 @@ func importRootKey(cmd *cobra.Command, rootKey string, nRepo notaryclient.Reposi
 	return []string{}, nil
 }
 
+// importTargetsKey imports an existing targets key for the GUN from path,
+// checking that the file is a private key which, if it is labelled with a role
+// or GUN, is labelled as a targets key of the GUN.  It returns the key's ID.
+func importTargetsKey(cmd *cobra.Command, targetsKey string, gun data.GUN, nRepo notaryclient.Repository, retriever notary.PassRetriever) (string, error) {
+	pemBytes, err := ioutil.ReadFile(targetsKey)
+	if err != nil {
+		return "", fmt.Errorf("error reading targets key file: %v", err)
+	}
+	role, keyGUN, err := tufutils.ExtractPrivateKeyAttributes(pemBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid targets key file %s: %v", targetsKey, err)
+	}
+	if role != "" && role != data.CanonicalTargetsRole {
+		return "", fmt.Errorf("%s holds a %s key, not a targets key", targetsKey, role)
+	}
+	if keyGUN != "" && keyGUN != gun {
+		return "", fmt.Errorf("%s holds a targets key for %s, not %s", targetsKey, keyGUN, gun)
+	}
+
+	privKey, err := readKey(data.CanonicalTargetsRole, targetsKey, retriever)
+	if err != nil {
+		return "", err
+	}
+	if err := nRepo.GetCryptoService().AddKey(data.CanonicalTargetsRole, gun, privKey); err != nil {
+		return "", fmt.Errorf("error importing key: %w", err)
+	}
+	cmd.Printf("Targets key found, using: %s\n", privKey.ID())
+	return privKey.ID(), nil
+}
+
 // importRootCert imports the base64 encoded public certificate corresponding to the root key
 // returns empty slice if path is empty
 func importRootCert(certFilePath string) ([]data.PublicKey, error) {
@@ -481,32 +703,106 @@ func (t *tufCommander) tufInit(cmd *cobra.Command, args []string) error {
 	}
 	gun := data.GUN(args[0])
 
-	fact := ConfigureRepo(config, t.retriever, true, readWrite)
+	if t.initialRoot != "" {
+		if t.rootKey != "" || t.targetsKey != "" || t.rootCert != "" || t.keyAlgo != "" || t.autoPublish || t.initInteractive {
+			return fmt.Errorf("--initial-root cannot be used with --rootkey, --targetskey, --rootcert, --key-algorithm, --publish or --interactive")
+		}
+		return t.seedInitialRoot(cmd, config, gun)
+	}
+
+	keyAlgo := strings.ToLower(t.keyAlgo)
+	switch keyAlgo {
+	case "", data.ECDSAKey, data.ED25519Key:
+	default:
+		return fmt.Errorf("invalid key algorithm %q: must be one of ecdsa or ed25519", t.keyAlgo)
+	}
+
+	fact := t.configureRepo(config, true, readWrite)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
 
-	rootKeyIDs, err := importRootKey(cmd, t.rootKey, nRepo, t.retriever)
-	if err != nil {
-		return err
+	choices := &initChoices{rootKey: t.rootKey, rootCert: t.rootCert, publish: t.autoPublish}
+	if t.initInteractive {
+		if !isTerminal(t.stdin) {
+			cmd.Println("Input is not a terminal, skipping guided setup")
+		} else {
+			existingRootKeys := nRepo.GetCryptoService().ListKeys(data.CanonicalRootRole)
+			choices, err = promptInit(gun, existingRootKeys, t, t.stdin, cmd.OutOrStdout())
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	rootCerts, err := importRootCert(t.rootCert)
+	var rootKeyIDs []string
+	if choices.newRootKey {
+		rootKey, err := nRepo.GetCryptoService().Create(data.CanonicalRootRole, "", data.ECDSAKey)
+		if err != nil {
+			return err
+		}
+		cmd.Printf("Generated root key: %s\n", rootKey.ID())
+		rootKeyIDs = []string{rootKey.ID()}
+	} else {
+		rootKeyIDs, err = importRootKey(cmd, choices.rootKey, nRepo, t.retriever)
+		if err != nil {
+			return err
+		}
+	}
+
+	rootCerts, err := importRootCert(choices.rootCert)
 	if err != nil {
 		return err
 	}
 
+	opts := notaryclient.InitOptions{RootCerts: rootCerts, RemoteKeyAlgorithm: keyAlgo, RootExpiry: choices.rootExpiry}
+	if t.targetsKey != "" {
+		opts.TargetsKeyID, err = importTargetsKey(cmd, t.targetsKey, gun, nRepo, t.retriever)
+		if err != nil {
+			return err
+		}
+	}
+
 	// if key is not defined but cert is, then clear the key to allow key to be searched in keystore
-	if t.rootKey == "" && t.rootCert != "" {
+	if choices.rootKey == "" && choices.rootCert != "" {
 		rootKeyIDs = []string{}
 	}
 
-	if err = nRepo.InitializeWithCertificate(rootKeyIDs, rootCerts); err != nil {
+	if err = nRepo.InitializeWithOptions(rootKeyIDs, opts); err != nil {
 		return err
 	}
 
-	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever)
+	for _, delegation := range choices.delegations {
+		if err := nRepo.AddDelegation(delegation.role, delegation.pubKeys, delegation.paths); err != nil {
+			return fmt.Errorf("failed to create delegation %s: %w", delegation.role, err)
+		}
+		cmd.Printf("Addition of delegation role %s to repository \"%s\" staged for next publish.\n", delegation.role, gun)
+	}
+
+	return maybeAutoPublish(cmd, choices.publish, gun, config, t.retriever, t.clock)
+}
+
+// seedInitialRoot validates the root bundle given by --initial-root against the
+// trust pinning configuration and caches it, so that the first fetch of the
+// existing repository is already trusted.  This is an offline operation.
+func (t *tufCommander) seedInitialRoot(cmd *cobra.Command, config *viper.Viper, gun data.GUN) error {
+	bundle, err := ioutil.ReadFile(t.initialRoot)
+	if err != nil {
+		return fmt.Errorf("error reading initial root %s: %w", t.initialRoot, err)
+	}
+
+	fact := t.configureRepo(config, false, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+	root, err := nRepo.SeedRoot(bundle)
+	if err != nil {
+		return fmt.Errorf("initial root %s is not trusted for %s: %w", t.initialRoot, gun, err)
+	}
+	cmd.Printf("Trusting version %d of the root of %s from %s\n", root.Signed.Version, gun, t.initialRoot)
+	return nil
 }
 
 // Attempt to read a role key from a file, and return it as a data.PrivateKey
@@ -514,7 +810,7 @@ func (t *tufCommander) tufInit(cmd *cobra.Command, args []string) error {
 func readKey(role data.RoleName, keyFilename string, retriever notary.PassRetriever) (data.PrivateKey, error) {
 	pemBytes, err := ioutil.ReadFile(keyFilename)
 	if err != nil {
-		return nil, fmt.Errorf("error reading input root key file: %v", err)
+		return nil, fmt.Errorf("error reading input key file: %v", err)
 	}
 	isEncrypted := true
 	if err = cryptoservice.CheckRootKeyIsEncrypted(pemBytes); err != nil {
@@ -525,7 +821,7 @@ func readKey(role data.RoleName, keyFilename string, retriever notary.PassRetrie
 	}
 	var privKey data.PrivateKey
 	if isEncrypted {
-		privKey, _, err = trustmanager.GetPasswdDecryptBytes(retriever, pemBytes, "", data.CanonicalRootRole.String())
+		privKey, _, err = trustmanager.GetPasswdDecryptBytes(retriever, pemBytes, "", role.String())
 	} else {
 		privKey, err = tufutils.ParsePEMPrivateKey(pemBytes, "")
 	}
@@ -541,13 +837,16 @@ func (t *tufCommander) tufList(cmd *cobra.Command, args []string) error {
 		cmd.Usage()
 		return fmt.Errorf("must specify a GUN")
 	}
+	if _, ok := targetSortFields[t.sortBy]; !ok {
+		return fmt.Errorf("cannot sort targets by %q: must be one of name, size or role", t.sortBy)
+	}
 	config, err := t.configGetter()
 	if err != nil {
 		return err
 	}
 	gun := data.GUN(args[0])
 
-	fact := ConfigureRepo(config, t.retriever, true, readOnly)
+	fact := t.configureRepo(config, true, readOnly)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
@@ -559,7 +858,7 @@ func (t *tufCommander) tufList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	prettyPrintTargets(targetList, cmd.OutOrStdout())
+	prettyPrintTargets(targetList, t.sortBy, t.sortReverse, cmd.OutOrStdout())
 	return nil
 }
 
@@ -576,7 +875,7 @@ func (t *tufCommander) tufLookup(cmd *cobra.Command, args []string) error {
 	gun := data.GUN(args[0])
 	targetName := args[1]
 
-	fact := ConfigureRepo(config, t.retriever, true, readOnly)
+	fact := t.configureRepo(config, true, readOnly)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
@@ -587,7 +886,32 @@ func (t *tufCommander) tufLookup(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	cmd.Println(target.Name, fmt.Sprintf("sha256:%x", target.Hashes["sha256"]), target.Length)
+	cmd.Println(target.Name, fmt.Sprintf("sha256:%x", target.Hashes["sha256"]), target.Length, target.Role)
+	return nil
+}
+
+func (t *tufCommander) tufRootHistory(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("must specify a GUN")
+	}
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	fact := t.configureRepo(config, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	history, err := nRepo.RootHistory()
+	if err != nil {
+		return err
+	}
+	prettyPrintRootHistory(history, cmd.OutOrStdout())
 	return nil
 }
 
@@ -597,56 +921,170 @@ func (t *tufCommander) tufStatus(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("must specify a GUN")
 	}
 
+	if t.expiredOnly && t.diffRemote {
+		cmd.Usage()
+		return fmt.Errorf("--expired-only cannot be combined with --diff-remote")
+	}
+	if t.expiringWithin != 0 && !t.expiredOnly {
+		cmd.Usage()
+		return fmt.Errorf("--expiring-within can only be used with --expired-only")
+	}
+	if t.expiringWithin < 0 {
+		return fmt.Errorf("--expiring-within must not be negative")
+	}
+	if t.porcelain && (t.diffRemote || t.expiredOnly) {
+		cmd.Usage()
+		return fmt.Errorf("--porcelain cannot be combined with --diff-remote or --expired-only")
+	}
+
 	config, err := t.configGetter()
 	if err != nil {
 		return err
 	}
 	gun := data.GUN(args[0])
 
-	fact := ConfigureRepo(config, t.retriever, false, readOnly)
+	fact := t.configureRepo(config, t.diffRemote || t.expiredOnly, readOnly)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
+	if t.expiredOnly {
+		return t.printExpiredRoles(cmd, gun, nRepo)
+	}
 
 	cl, err := nRepo.GetChangelist()
 	if err != nil {
 		return err
 	}
 
+	if t.porcelain {
+		printPorcelainChanges(cl.List(), cmd.OutOrStdout())
+		return nil
+	}
 	if len(cl.List()) == 0 {
 		cmd.Printf("No unpublished changes for %s\n", gun)
+	} else {
+		cmd.Printf("Unpublished changes for %s:\n\n", gun)
+		prettyPrintChanges(cl.List(), cmd.OutOrStdout())
+	}
+	if !t.diffRemote {
 		return nil
 	}
 
-	cmd.Printf("Unpublished changes for %s:\n\n", gun)
-	tw := initTabWriter(
-		[]string{"#", "ACTION", "SCOPE", "TYPE", "PATH"},
-		cmd.OutOrStdout(),
-	)
-	for i, ch := range cl.List() {
-		fmt.Fprintf(
-			tw,
-			fiveItemRow,
-			fmt.Sprintf("%d", i),
-			ch.Action(),
-			ch.Scope(),
-			ch.Type(),
-			ch.Path(),
-		)
-	}
-	tw.Flush()
+	published, err := nRepo.ListTargets()
+	if err != nil {
+		if _, ok := err.(notaryclient.ErrRepositoryNotExist); !ok {
+			return err
+		}
+		// nothing has been published yet, so only the changes take effect
+		published = nil
+	}
+	effective, err := overlayTargetChanges(published, cl.List())
+	if err != nil {
+		return err
+	}
+	cmd.Printf("\nTargets of %s after publishing:\n", gun)
+	prettyPrintEffectiveTargets(effective, cmd.OutOrStdout())
+	return nil
+}
+
+// printExpiredRoles lists the roles of the published trusted collection whose
+// metadata has expired, or expires within t.expiringWithin
+func (t *tufCommander) printExpiredRoles(cmd *cobra.Command, gun data.GUN, nRepo notaryclient.Repository) error {
+	expiries, err := nRepo.ListRoleExpiries()
+	if err != nil {
+		return err
+	}
+	now := t.clock.Now()
+	var stale []notaryclient.RoleExpiry
+	for _, expiry := range expiries {
+		if expiry.Expired(now.Add(t.expiringWithin)) {
+			stale = append(stale, expiry)
+		}
+	}
+	if len(stale) == 0 {
+		if t.expiringWithin > 0 {
+			cmd.Printf("No roles of %s expire within %s\n", gun, t.expiringWithin)
+		} else {
+			cmd.Printf("No roles of %s have expired\n", gun)
+		}
+		return nil
+	}
+	cmd.Printf("Roles of %s which need re-signing:\n\n", gun)
+	prettyPrintRoleExpiries(stale, now, cmd.OutOrStdout())
 	return nil
 }
 
+// effectiveTarget is a target as it would be after publishing, and whether
+// it comes from an unpublished change
+type effectiveTarget struct {
+	*notaryclient.TargetWithRole
+	staged bool
+}
+
+// overlayTargetChanges applies the unpublished target changes, in the order
+// they were made, to the published targets, giving the targets by name as they
+// would be after publishing.  A target added by a change takes precedence over
+// a published target of the same name, and a target removed by a change is
+// only removed if it was listed from the role the change removes it from.
+// Changes to anything other than targets are ignored.
+func overlayTargetChanges(published []*notaryclient.TargetWithRole, changes []changelist.Change) ([]effectiveTarget, error) {
+	targets := make(map[string]effectiveTarget, len(published))
+	for _, target := range published {
+		targets[target.Name] = effectiveTarget{TargetWithRole: target}
+	}
+	for _, c := range changes {
+		if c.Type() != changelist.TypeTargetsTarget {
+			continue
+		}
+		switch c.Action() {
+		case changelist.ActionCreate:
+			meta := &data.FileMeta{}
+			if err := json.Unmarshal(c.Content(), meta); err != nil {
+				return nil, fmt.Errorf("invalid unpublished change to %s: %v", c.Path(), err)
+			}
+			targets[c.Path()] = effectiveTarget{
+				TargetWithRole: &notaryclient.TargetWithRole{
+					Target: notaryclient.Target{
+						Name:   c.Path(),
+						Hashes: meta.Hashes,
+						Length: meta.Length,
+						Custom: meta.Custom,
+					},
+					Role: c.Scope(),
+				},
+				staged: true,
+			}
+		case changelist.ActionDelete:
+			if target, ok := targets[c.Path()]; ok && target.Role == c.Scope() {
+				delete(targets, c.Path())
+			}
+		}
+	}
+
+	effective := make([]effectiveTarget, 0, len(targets))
+	for _, target := range targets {
+		effective = append(effective, target)
+	}
+	return effective, nil
+}
+
 func (t *tufCommander) tufReset(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
 		cmd.Usage()
 		return fmt.Errorf("must specify a GUN")
 	}
-	if !t.resetAll && len(t.deleteIdx) < 1 {
+	if t.resetInteractive && (t.resetAll || len(t.deleteIdx) > 0) {
+		cmd.Usage()
+		return fmt.Errorf("--interactive cannot be combined with -n or the --all flag")
+	}
+	if len(t.keepIdx) > 0 && (t.resetAll || t.resetInteractive || len(t.deleteIdx) > 0) {
+		cmd.Usage()
+		return fmt.Errorf("--keep cannot be combined with -n, the --all flag or the --interactive flag")
+	}
+	if !t.resetAll && !t.resetInteractive && len(t.deleteIdx) < 1 && len(t.keepIdx) < 1 {
 		cmd.Usage()
-		return fmt.Errorf("must specify changes to reset with -n or the --all flag")
+		return fmt.Errorf("must specify changes to reset with -n, --keep, the --all flag or the --interactive flag")
 	}
 
 	config, err := t.configGetter()
@@ -655,7 +1093,7 @@ func (t *tufCommander) tufReset(cmd *cobra.Command, args []string) error {
 	}
 	gun := data.GUN(args[0])
 
-	fact := ConfigureRepo(config, t.retriever, false, admin)
+	fact := t.configureRepo(config, false, admin)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
@@ -666,10 +1104,33 @@ func (t *tufCommander) tufReset(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	deleteIdx := t.deleteIdx
+	if len(t.keepIdx) > 0 {
+		deleteIdx, err = complementChanges(len(cl.List()), t.keepIdx)
+		if err != nil {
+			return err
+		}
+		if len(deleteIdx) == 0 {
+			cmd.Printf("All changes are kept, so none were reset for repository %s\n", gun)
+			return nil
+		}
+	}
+	if t.resetInteractive {
+		if !isTerminal(t.stdin) {
+			cmd.Println("Input is not a terminal, skipping interactive reset")
+			return nil
+		}
+		deleteIdx = selectChangesInteractively(cl.List(), t.stdin, cmd.OutOrStdout())
+		if len(deleteIdx) == 0 {
+			cmd.Printf("No changes selected to reset for repository %s\n", gun)
+			return nil
+		}
+	}
+
 	if t.resetAll {
 		err = cl.Clear(t.archiveChangelist)
 	} else {
-		err = cl.Remove(t.deleteIdx)
+		err = cl.Remove(deleteIdx)
 	}
 	// If it was a success, print to terminal
 	if err == nil {
@@ -678,6 +1139,43 @@ func (t *tufCommander) tufReset(cmd *cobra.Command, args []string) error {
 	return err
 }
 
+// complementChanges returns the indices of the changes, of the given number
+// of staged changes, which are not among those to keep.  Every change to keep
+// must exist, so that a mistyped number doesn't reset a change it was meant
+// to keep.
+func complementChanges(numChanges int, keepIdx []int) ([]int, error) {
+	keep := make(map[int]bool, len(keepIdx))
+	for _, i := range keepIdx {
+		if i < 0 || i >= numChanges {
+			return nil, fmt.Errorf("cannot keep change %d: there are only %d staged changes, numbered from 0", i, numChanges)
+		}
+		keep[i] = true
+	}
+	var deleteIdx []int
+	for i := 0; i < numChanges; i++ {
+		if !keep[i] {
+			deleteIdx = append(deleteIdx, i)
+		}
+	}
+	return deleteIdx, nil
+}
+
+// selectChangesInteractively displays each staged change and asks whether it
+// should be reset, returning the indices of the changes the user chose to drop
+func selectChangesInteractively(changes []changelist.Change, in io.Reader, out io.Writer) []int {
+	var deleteIdx []int
+	for i, ch := range changes {
+		fmt.Fprintln(out)
+		prettyPrintChangesFrom(changes[i:i+1], i, out)
+		fmt.Fprintf(out, "Reset change #%d (%s %s)?  (yes/no)  ", i, ch.Action(), ch.Path())
+		if askConfirm(in) {
+			deleteIdx = append(deleteIdx, i)
+		}
+	}
+	fmt.Fprintln(out)
+	return deleteIdx
+}
+
 func (t *tufCommander) tufPublish(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
 		cmd.Usage()
@@ -692,13 +1190,17 @@ func (t *tufCommander) tufPublish(cmd *cobra.Command, args []string) error {
 
 	cmd.Println("Pushing changes to", gun)
 
-	fact := ConfigureRepo(config, t.retriever, true, readWrite)
+	fact := t.configureRepo(config, true, readWrite)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
 
-	return publishAndPrintToCLI(cmd, nRepo)
+	roles := make([]data.RoleName, 0, len(t.publishRoles))
+	for _, role := range t.publishRoles {
+		roles = append(roles, data.RoleName(role))
+	}
+	return publishAndPrintToCLI(cmd, nRepo, t.quiet, roles...)
 }
 
 func (t *tufCommander) tufRemove(cmd *cobra.Command, args []string) error {
@@ -713,7 +1215,7 @@ func (t *tufCommander) tufRemove(cmd *cobra.Command, args []string) error {
 	gun := data.GUN(args[0])
 	targetName := args[1]
 
-	fact := ConfigureRepo(config, t.retriever, false, admin)
+	fact := t.configureRepo(config, false, admin)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
@@ -726,13 +1228,16 @@ func (t *tufCommander) tufRemove(cmd *cobra.Command, args []string) error {
 
 	cmd.Printf("Removal of %s from %s staged for next publish.\n", targetName, gun)
 
-	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever)
+	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever, t.clock)
 }
 
-func (t *tufCommander) tufVerify(cmd *cobra.Command, args []string) error {
+func (t *tufCommander) verifySignature(cmd *cobra.Command, args []string) error {
 	if len(args) < 2 {
 		cmd.Usage()
-		return fmt.Errorf("must specify a GUN and target")
+		return fmt.Errorf("must specify a GUN and role")
+	}
+	if t.dataFile == "" || t.sigFile == "" {
+		return fmt.Errorf("must specify the signed file with --data and the signature with --sig")
 	}
 
 	config, err := t.configGetter()
@@ -740,34 +1245,329 @@ func (t *tufCommander) tufVerify(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	payload, err := getPayload(t)
+	msg, err := ioutil.ReadFile(t.dataFile)
+	if err != nil {
+		return err
+	}
+	sigJSON, err := ioutil.ReadFile(t.sigFile)
 	if err != nil {
 		return err
 	}
+	sigs, err := parseDetachedSignatures(sigJSON)
+	if err != nil {
+		return fmt.Errorf("unable to parse signature %s: %v", t.sigFile, err)
+	}
+
+	gun := data.GUN(args[0])
+	role := data.RoleName(args[1])
+
+	fact := t.configureRepo(config, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	validIDs, err := nRepo.VerifyDetachedSignature(role, msg, sigs)
+	if err != nil {
+		return fmt.Errorf("signature over %s is not valid for %s: %v", t.dataFile, role, err)
+	}
+	cmd.Printf("Signature over %s is valid for %s, signed by key IDs: %s\n", t.dataFile, role, strings.Join(validIDs, ", "))
+	return nil
+}
+
+// parseDetachedSignatures parses either a single TUF signature or an array of
+// them, as JSON
+func parseDetachedSignatures(sigJSON []byte) ([]data.Signature, error) {
+	var sigs []data.Signature
+	if err := json.Unmarshal(sigJSON, &sigs); err == nil {
+		return sigs, nil
+	}
+	var sig data.Signature
+	if err := json.Unmarshal(sigJSON, &sig); err != nil {
+		return nil, err
+	}
+	return []data.Signature{sig}, nil
+}
+
+func (t *tufCommander) tufVerify(cmd *cobra.Command, args []string) error {
+	if t.atVersion < 0 {
+		return fmt.Errorf("--at-version must be a snapshot version of at least 1")
+	}
+	if t.atVersion > 0 && t.roleChainFile != "" {
+		return fmt.Errorf("--at-version cannot be used with --output-role-chain")
+	}
+	if t.manifest != "" {
+		return t.tufVerifyManifest(cmd, args)
+	}
+	if len(args) < 2 {
+		cmd.Usage()
+		return fmt.Errorf("must specify a GUN and target")
+	}
+
+	if t.fromURL != "" && (t.input != "" || t.output != "") {
+		return fmt.Errorf("--from-url cannot be used with --input or --output")
+	}
+	if t.fromURL == "" && len(t.headers) > 0 {
+		return fmt.Errorf("--header can only be used with --from-url")
+	}
+
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+
+	// the length of an input file is checked before it is read, so that a
+	// large file of the wrong length is rejected without hashing it
+	var payload []byte
+	var inputSize int64 = -1
+	if t.input != "" {
+		info, err := os.Stat(t.input)
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			inputSize = info.Size()
+		}
+	} else if t.fromURL == "" {
+		payload, err = getPayload(t)
+		if err != nil {
+			return err
+		}
+	}
 
 	gun := data.GUN(args[0])
 	targetName := args[1]
 
-	fact := ConfigureRepo(config, t.retriever, true, readOnly)
+	fact := t.configureRepo(config, true, readOnly)
 	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
+	reader, err := t.verifiedCollection(nRepo)
+	if err != nil {
+		return err
+	}
 
-	target, err := nRepo.GetTargetByName(targetName)
+	target, err := reader.GetTargetByName(targetName)
 	if err != nil {
 		return fmt.Errorf("error retrieving target by name:%s, error:%v", targetName, err)
 	}
 
+	if t.strictHashes {
+		if err := data.CheckStrictHashes(targetName, target.Hashes); err != nil {
+			return fmt.Errorf("data not present in the trusted collection, %v", err)
+		}
+	}
+
+	if t.fromURL != "" {
+		meta, err := getRemoteFileMeta(t.fromURL, t.headers, target.Length)
+		if err != nil {
+			return err
+		}
+		if meta.Length != target.Length {
+			return fmt.Errorf("data not present in the trusted collection, expected length %d but got %d", target.Length, meta.Length)
+		}
+		if err := data.CompareMultiHashes(target.Hashes, meta.Hashes); err != nil {
+			return fmt.Errorf("data not present in the trusted collection, %v", err)
+		}
+		if !t.quiet {
+			cmd.Printf("%s matches %s in %s\n", t.fromURL, targetName, gun)
+		}
+		printVerifiedRole(cmd, t, target)
+		return writeRoleChain(t, nRepo, gun, target)
+	}
+
+	if t.input != "" {
+		if inputSize >= 0 && inputSize != target.Length {
+			return fmt.Errorf("data not present in the trusted collection, length of %s did not match: expected %d bytes but got %d", t.input, target.Length, inputSize)
+		}
+		if payload, err = getPayload(t); err != nil {
+			return err
+		}
+	}
 	if err := data.CheckHashes(payload, targetName, target.Hashes); err != nil {
 		return fmt.Errorf("data not present in the trusted collection, %v", err)
 	}
 
+	printVerifiedRole(cmd, t, target)
+	if err := writeRoleChain(t, nRepo, gun, target); err != nil {
+		return err
+	}
 	return feedback(t, payload)
 }
 
+// verifiedCollection returns the trusted collection to verify against: the
+// current one, or the one at the snapshot version given by --at-version
+func (t *tufCommander) verifiedCollection(nRepo notaryclient.Repository) (notaryclient.ReadOnly, error) {
+	if t.atVersion == 0 {
+		return nRepo, nil
+	}
+	reader, err := nRepo.AtSnapshotVersion(t.atVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the trusted collection at snapshot version %d: %v", t.atVersion, err)
+	}
+	return reader, nil
+}
+
+// printVerifiedRole reports the role, either the base targets role or a
+// delegation, which authorized the verified target if --print-role was given.
+// It writes to STDERR, since STDOUT may be carrying the verified payload.
+func printVerifiedRole(cmd *cobra.Command, t *tufCommander, target *notaryclient.TargetWithRole) {
+	if t.printRole {
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s authorized by role %s\n", target.Name, target.Role)
+	}
+}
+
+// tufVerifyManifest verifies every target listed in a manifest against the
+// trusted collection, reporting each discrepancy rather than stopping at the
+// first one
+func (t *tufCommander) tufVerifyManifest(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("must specify a GUN, and no target, with --manifest")
+	}
+	if t.fromURL != "" || t.input != "" || t.output != "" || t.roleChainFile != "" {
+		return fmt.Errorf("--manifest cannot be used with --from-url, --input, --output or --output-role-chain")
+	}
+
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+	expected, err := readTargetManifest(t.manifest)
+	if err != nil {
+		return err
+	}
+
+	gun := data.GUN(args[0])
+	fact := t.configureRepo(config, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+	reader, err := t.verifiedCollection(nRepo)
+	if err != nil {
+		return err
+	}
+	targets, err := reader.ListTargets()
+	if err != nil {
+		return err
+	}
+
+	statuses := verifyTargetManifest(expected, targets, t.strictHashes)
+	mismatched := 0
+	for _, s := range statuses {
+		if s.problem != "" {
+			mismatched++
+		}
+	}
+	if !t.quiet || mismatched > 0 {
+		cmd.Println("")
+		prettyPrintManifestStatuses(statuses, cmd.OutOrStdout())
+		cmd.Println("")
+	}
+	if mismatched > 0 {
+		return fmt.Errorf("%d of the %d targets in %s do not match the trusted collection %s",
+			mismatched, len(statuses), t.manifest, gun)
+	}
+	return nil
+}
+
+// readTargetManifest reads a manifest of the targets expected in a trusted
+// collection.  It is a JSON object mapping each target name to its expected
+// hashes, which map a hash algorithm to the hex-encoded digest, in the form
+// in-toto uses for the materials and products of a step:
+//
+//	{"path/to/target": {"sha256": "<hex digest>"}}
+func readTargetManifest(path string) (map[string]data.Hashes, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %w", path, err)
+	}
+	var manifest map[string]map[string]string
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if len(manifest) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no targets", path)
+	}
+	expected := make(map[string]data.Hashes, len(manifest))
+	for name, digests := range manifest {
+		hashes := make(data.Hashes, len(digests))
+		for alg, digest := range digests {
+			if hashes[alg], err = hex.DecodeString(digest); err != nil {
+				return nil, fmt.Errorf("invalid %s hash of %s in manifest %s", alg, name, path)
+			}
+		}
+		if err := data.CheckValidHashStructures(hashes); err != nil {
+			return nil, fmt.Errorf("invalid hashes of %s in manifest %s: %v", name, path, err)
+		}
+		expected[name] = hashes
+	}
+	return expected, nil
+}
+
+// manifestTargetStatus is the result of verifying a target listed in a
+// manifest.  problem is empty if the target matched.
+type manifestTargetStatus struct {
+	name       string
+	role       data.RoleName
+	algorithms []string
+	problem    string
+}
+
+// verifyTargetManifest checks that every target in the manifest is one of the
+// trusted targets, and that the hashes it shares with the trusted target match.
+// If strictHashes is set, the trusted target must also have both sha256 and
+// sha512 hashes, both of which the manifest must list.
+func verifyTargetManifest(expected map[string]data.Hashes, targets []*notaryclient.TargetWithRole, strictHashes bool) []manifestTargetStatus {
+	trusted := make(map[string]*notaryclient.TargetWithRole, len(targets))
+	for _, target := range targets {
+		trusted[target.Name] = target
+	}
+
+	statuses := make([]manifestTargetStatus, 0, len(expected))
+	for name, hashes := range expected {
+		status := manifestTargetStatus{name: name}
+		for alg := range hashes {
+			status.algorithms = append(status.algorithms, alg)
+		}
+		sort.Strings(status.algorithms)
+
+		if target, ok := trusted[name]; ok {
+			status.role = target.Role
+			status.problem = compareManifestHashes(name, hashes, target.Hashes, strictHashes)
+		} else {
+			status.problem = "not present in the trusted collection"
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// compareManifestHashes describes how the hashes listed for a target in a
+// manifest differ from its trusted hashes, or returns an empty string if they
+// match
+func compareManifestHashes(name string, listed, trusted data.Hashes, strictHashes bool) string {
+	if strictHashes {
+		if err := data.CheckStrictHashes(name, trusted); err != nil {
+			return err.Error()
+		}
+		if err := data.CheckStrictHashes(name, listed); err != nil {
+			return "manifest must list both sha256 and sha512 hashes"
+		}
+	}
+	if err := data.CompareMultiHashes(trusted, listed); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
 type passwordStore struct {
 	anonymous bool
+	// credentialHelper is the name of an external credential helper to query
+	// for credentials before falling back to the environment or a prompt
+	credentialHelper string
 }
 
 func getUsername(input chan string, buf *bufio.Reader) {
@@ -785,6 +1585,14 @@ func (ps passwordStore) Basic(u *url.URL) (string, string) {
 		return "", ""
 	}
 
+	if ps.credentialHelper != "" {
+		username, password, err := getHelperCredentials(ps.credentialHelper, u)
+		if err == nil {
+			return username, password
+		}
+		logrus.Debugf("could not get credentials for %s from credential helper: %s", u.Host, err)
+	}
+
 	auth := os.Getenv("NOTARY_AUTH")
 	if auth != "" {
 		dec, err := base64.StdEncoding.DecodeString(auth)
@@ -860,11 +1668,12 @@ const (
 // The readOnly flag indicates if the operation should be performed as an
 // anonymous read only operation. If the command entered requires write
 // permissions on the server, readOnly must be false
-func getTransport(config *viper.Viper, gun data.GUN, permission httpAccess) (http.RoundTripper, error) {
+func getTransport(config *viper.Viper, gun data.GUN, permission httpAccess, retriever notary.PassRetriever) (http.RoundTripper, error) {
 	// Attempt to get a root CA from the config file. Nil is the host defaults.
 	rootCAFile := utils.GetPathRelativeToConfig(config, "remote_server.root_ca")
 	clientCert := utils.GetPathRelativeToConfig(config, "remote_server.tls_client_cert")
 	clientKey := utils.GetPathRelativeToConfig(config, "remote_server.tls_client_key")
+	clientP12 := utils.GetPathRelativeToConfig(config, "remote_server.tls_client_p12")
 
 	insecureSkipVerify := false
 	if config.IsSet("remote_server.skipTLSVerify") {
@@ -874,6 +1683,9 @@ func getTransport(config *viper.Viper, gun data.GUN, permission httpAccess) (htt
 	if clientCert == "" && clientKey != "" || clientCert != "" && clientKey == "" {
 		return nil, fmt.Errorf("either pass both client key and cert, or neither")
 	}
+	if clientP12 != "" && clientCert != "" {
+		return nil, fmt.Errorf("pass either a client key and cert, or a PKCS#12 bundle, but not both")
+	}
 
 	tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
 		CAFile:             rootCAFile,
@@ -885,7 +1697,13 @@ func getTransport(config *viper.Viper, gun data.GUN, permission httpAccess) (htt
 	if err != nil {
 		return nil, fmt.Errorf("unable to configure TLS: %s", err.Error())
 	}
-
+	if clientP12 != "" {
+		cert, err := loadPKCS12ClientCert(clientP12, retriever)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load TLS client certificate from %s: %v", clientP12, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
 	base := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		Dial: (&net.Dialer{
@@ -897,17 +1715,143 @@ func getTransport(config *viper.Viper, gun data.GUN, permission httpAccess) (htt
 		TLSClientConfig:     tlsConfig,
 		DisableKeepAlives:   true,
 	}
+	// the pins are for the trust server only, and the token server it sends
+	// the client to usually has a different key
+	tokenBase := base
+	if pins := config.GetStringSlice("remote_server.pinned_spki"); len(pins) > 0 {
+		verify, err := pinnedSPKIVerifier(pins)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure TLS: %s", err.Error())
+		}
+		tokenBase = base.Clone()
+		base.TLSClientConfig.VerifyPeerCertificate = verify
+	}
+	maxRetryWait, err := getMaxRetryWait(config)
+	if err != nil {
+		return nil, err
+	}
 	trustServerURL := getRemoteTrustServer(config)
-	return tokenAuth(trustServerURL, base, gun, permission)
+	credentialHelper := config.GetString("remote_server.credential_helper")
+	rt, err := tokenAuth(trustServerURL, base, tokenBase, gun, permission, credentialHelper)
+	if rt == nil || err != nil || maxRetryWait == 0 {
+		return rt, err
+	}
+	return store.NewRetryAfterTransport(rt, maxRetryWait), nil
+}
+
+// getMaxRetryWait reads the longest the client waits before retrying a request
+// which the server asks to be retried later, which is zero if retrying is
+// turned off
+func getMaxRetryWait(config *viper.Viper) (time.Duration, error) {
+	configured := config.GetString("remote_server.max_retry_wait")
+	if configured == "" {
+		return store.DefaultMaxRetryWait, nil
+	}
+	maxWait, err := time.ParseDuration(configured)
+	if err != nil || maxWait < 0 {
+		return 0, fmt.Errorf("invalid remote_server.max_retry_wait %q: must be a duration such as \"30s\", or \"0\" to never retry", configured)
+	}
+	return maxWait, nil
+}
+
+// pinnedSPKIVerifier returns a function which checks that the certificate
+// presented by the server has a public key matching one of the given pins,
+// each of which is the base64 encoded SHA-256 hash of a DER encoded
+// SubjectPublicKeyInfo, optionally prefixed with "sha256//".  More than one pin
+// can be given so that the server's key can be rotated.
+func pinnedSPKIVerifier(pins []string) (func([][]byte, [][]*x509.Certificate) error, error) {
+	pinned := make(map[[sha256.Size]byte]bool, len(pins))
+	for _, pin := range pins {
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256//"))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid pinned SPKI hash %q: must be a base64 encoded SHA-256 hash", pin)
+		}
+		var key [sha256.Size]byte
+		copy(key[:], hash)
+		pinned[key] = true
+	}
+
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		// only the server's own certificate is checked, since any other
+		// certificates presented are chosen by the server
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server presented no certificate to check against the pinned SPKI hashes")
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		if !pinned[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+			return fmt.Errorf("server certificate's public key does not match any pinned SPKI hash")
+		}
+		return nil
+	}, nil
 }
 
-func tokenAuth(trustServerURL string, baseTransport *http.Transport, gun data.GUN,
-	permission httpAccess) (http.RoundTripper, error) {
+// loadPKCS12ClientCert reads a client certificate, its private key and any
+// intermediate certificates from a PKCS#12 bundle.  If the bundle is protected
+// by a passphrase, it is asked for from the retriever.
+func loadPKCS12ClientCert(p12File string, retriever notary.PassRetriever) (tls.Certificate, error) {
+	p12, err := ioutil.ReadFile(p12File)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	// bundles are often not protected at all, so try that before asking
+	blocks, err := pkcs12.ToPEM(p12, "")
+	for attempts := 0; err == pkcs12.ErrIncorrectPassword; attempts++ {
+		if retriever == nil {
+			return tls.Certificate{}, err
+		}
+		if attempts > 10 {
+			return tls.Certificate{}, trustmanager.ErrAttemptsExceeded{}
+		}
+		passwd, giveup, retErr := retriever("", tlsClientP12Alias, false, attempts)
+		if giveup || retErr != nil {
+			return tls.Certificate{}, trustmanager.ErrPasswordInvalid{}
+		}
+		blocks, err = pkcs12.ToPEM(p12, passwd)
+	}
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	// the client certificate is the one which shares a local key ID with the
+	// private key, and must come first
+	var keyBlock *pem.Block
+	for _, block := range blocks {
+		if block.Type == "PRIVATE KEY" {
+			keyBlock = block
+			break
+		}
+	}
+	if keyBlock == nil {
+		return tls.Certificate{}, fmt.Errorf("no private key found")
+	}
+	var leafPEM, chainPEM []byte
+	for _, block := range blocks {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if leafPEM == nil && block.Headers["localKeyId"] == keyBlock.Headers["localKeyId"] {
+			leafPEM = pem.EncodeToMemory(block)
+		} else {
+			chainPEM = append(chainPEM, pem.EncodeToMemory(block)...)
+		}
+	}
+	return tls.X509KeyPair(append(leafPEM, chainPEM...), pem.EncodeToMemory(keyBlock))
+}
+
+// tokenAuth returns a round tripper which authenticates to the trust server
+// over baseTransport, fetching tokens from the token server it names over
+// tokenTransport
+func tokenAuth(trustServerURL string, baseTransport, tokenTransport *http.Transport, gun data.GUN,
+	permission httpAccess, credentialHelper string) (http.RoundTripper, error) {
 
 	// TODO(dmcgowan): add notary specific headers
-	authTransport := transport.NewTransport(baseTransport)
+	authTransport := transport.NewTransport(tokenTransport)
 	pingClient := &http.Client{
-		Transport: authTransport,
+		Transport: transport.NewTransport(baseTransport),
 		Timeout:   5 * time.Second,
 	}
 	endpoint, err := url.Parse(trustServerURL)
@@ -949,7 +1893,7 @@ func tokenAuth(trustServerURL string, baseTransport *http.Transport, gun data.GU
 		return nil, err
 	}
 
-	ps := passwordStore{anonymous: permission == readOnly}
+	ps := passwordStore{anonymous: permission == readOnly, credentialHelper: credentialHelper}
 
 	var actions []string
 	switch permission {
@@ -963,7 +1907,7 @@ func tokenAuth(trustServerURL string, baseTransport *http.Transport, gun data.GU
 		return nil, fmt.Errorf("invalid permission requested for token authentication of gun %s", gun)
 	}
 
-	tokenHandler := auth.NewTokenHandler(authTransport, ps, gun.String(), actions...)
+	tokenHandler := newTokenHandler(authTransport, ps, gun, actions...)
 	basicHandler := auth.NewBasicHandler(ps)
 
 	modifier := auth.NewAuthorizer(challengeManager, tokenHandler, basicHandler)
@@ -974,7 +1918,24 @@ func tokenAuth(trustServerURL string, baseTransport *http.Transport, gun data.GU
 
 	// Try to authenticate read only repositories using basic username/password authentication
 	return newAuthRoundTripper(transport.NewTransport(baseTransport, modifier),
-		transport.NewTransport(baseTransport, auth.NewAuthorizer(challengeManager, auth.NewTokenHandler(authTransport, passwordStore{anonymous: false}, gun.String(), actions...)))), nil
+		transport.NewTransport(baseTransport, auth.NewAuthorizer(challengeManager, newTokenHandler(authTransport, passwordStore{anonymous: false, credentialHelper: credentialHelper}, gun, actions...)))), nil
+}
+
+// newTokenHandler returns a token handler requesting the given actions on the
+// repository for the gun, or on the registry catalog if the gun is empty, as
+// required by server endpoints which do not operate on a single repository
+func newTokenHandler(authTransport http.RoundTripper, creds auth.CredentialStore, gun data.GUN, actions ...string) auth.AuthenticationHandler {
+	if gun != "" {
+		return auth.NewTokenHandler(authTransport, creds, gun.String(), actions...)
+	}
+	return auth.NewTokenHandlerWithOptions(auth.TokenHandlerOptions{
+		Transport:   authTransport,
+		Credentials: creds,
+		Scopes: []auth.Scope{auth.RegistryScope{
+			Name:    "catalog",
+			Actions: actions,
+		}},
+	})
 }
 
 func getRemoteTrustServer(config *viper.Viper) string {
@@ -1004,13 +1965,81 @@ func getTrustPinning(config *viper.Viper) (trustpinning.TrustPinConfig, error) {
 		}
 		resultCertMap[gun] = certsForGun
 	}
+	var tofuMaxAge time.Duration
+	if configured := config.GetString("trust_pinning.tofu_max_age"); configured != "" {
+		var err error
+		tofuMaxAge, err = time.ParseDuration(configured)
+		if err != nil || tofuMaxAge <= 0 {
+			return trustpinning.TrustPinConfig{}, fmt.Errorf("invalid trust_pinning.tofu_max_age %q: must be a positive duration such as \"720h\"", configured)
+		}
+	}
 	return trustpinning.TrustPinConfig{
 		DisableTOFU: config.GetBool("trust_pinning.disable_tofu"),
 		CA:          config.GetStringMapString("trust_pinning.ca"),
+		Chain:       config.GetStringMapString("trust_pinning.chain"),
 		Certs:       resultCertMap,
+		TSACA:       utils.GetPathRelativeToConfig(config, "trust_pinning.tsa_ca"),
+		NotFound:    config.GetStringMapString("trust_pinning.not_found"),
+		TOFUMaxAge:  tofuMaxAge,
+		Repin:       config.GetBool("trust_pinning.repin"),
 	}, nil
 }
 
+// getClockSkewThreshold reads how far the local clock may be ahead of the
+// server's before expired metadata is blamed on the local clock, which is zero
+// if it isn't configured so that the client's default applies
+func getClockSkewThreshold(config *viper.Viper) (time.Duration, error) {
+	configured := config.GetString("clock_skew_threshold")
+	if configured == "" {
+		return 0, nil
+	}
+	threshold, err := time.ParseDuration(configured)
+	if err != nil || threshold <= 0 {
+		return 0, fmt.Errorf("invalid clock_skew_threshold %q: must be a positive duration such as \"10m\"", configured)
+	}
+	return threshold, nil
+}
+
+// getStatusMapping reads how HTTP statuses returned by the remote server are
+// interpreted, mapping statuses to error categories, which is nil if it isn't
+// configured so that the client's defaults apply
+func getStatusMapping(config *viper.Viper) (store.StatusMapping, error) {
+	configured := config.GetStringMapString("remote_server.status_mapping")
+	if len(configured) == 0 {
+		return nil, nil
+	}
+	mapping := make(store.StatusMapping, len(configured))
+	for status, category := range configured {
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote_server.status_mapping: %q is not an HTTP status", status)
+		}
+		mapping[code] = store.ErrorCategory(category)
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid remote_server.status_mapping: %v", err)
+	}
+	return mapping, nil
+}
+
+// getSignatureAlgorithms reads the signature algorithm that each role must be
+// signed with, which is nil if it isn't configured so that roles may be signed
+// with any algorithm
+func getSignatureAlgorithms(config *viper.Viper) (signed.AlgorithmPolicy, error) {
+	configured := config.GetStringMapString("signature_algorithms")
+	if len(configured) == 0 {
+		return nil, nil
+	}
+	policy := make(signed.AlgorithmPolicy, len(configured))
+	for role, algorithm := range configured {
+		policy[data.RoleName(role)] = data.SigAlgorithm(strings.ToLower(algorithm))
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid signature_algorithms: %v", err)
+	}
+	return policy, nil
+}
+
 // authRoundTripper tries to authenticate the requests via multiple HTTP transactions (until first succeed)
 type authRoundTripper struct {
 	trippers []http.RoundTripper
@@ -1042,14 +2071,28 @@ func (a *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	return resp, nil
 }
 
-func maybeAutoPublish(cmd *cobra.Command, doPublish bool, gun data.GUN, config *viper.Viper, passRetriever notary.PassRetriever) error {
+// configureRepo is ConfigureRepo for the tuf commands, whose repositories tell
+// the time by the commander's clock
+func (t *tufCommander) configureRepo(v *viper.Viper, onlineOperation bool, permission httpAccess) RepoFactory {
+	fact := ConfigureRepo(v, t.retriever, onlineOperation, permission)
+	return func(gun data.GUN) (notaryclient.Repository, error) {
+		repo, err := fact(gun)
+		if err != nil {
+			return nil, err
+		}
+		repo.SetClock(t.clock)
+		return repo, nil
+	}
+}
+
+func maybeAutoPublish(cmd *cobra.Command, doPublish bool, gun data.GUN, config *viper.Viper, passRetriever notary.PassRetriever, clock data.Clock) error {
 
 	if !doPublish {
 		return nil
 	}
 
 	// We need to set up a http RoundTripper when publishing
-	rt, err := getTransport(config, gun, readWrite)
+	rt, err := getTransport(config, gun, readWrite, passRetriever)
 	if err != nil {
 		return err
 	}
@@ -1064,15 +2107,50 @@ func maybeAutoPublish(cmd *cobra.Command, doPublish bool, gun data.GUN, config *
 	if err != nil {
 		return err
 	}
+	if err := applyRepoConfig(config, nRepo); err != nil {
+		return err
+	}
+	nRepo.SetClock(clock)
 
 	cmd.Println("Auto-publishing changes to", nRepo.GetGUN())
-	return publishAndPrintToCLI(cmd, nRepo)
+	return publishAndPrintToCLI(cmd, nRepo, false)
 }
 
-func publishAndPrintToCLI(cmd *cobra.Command, nRepo notaryclient.Repository) error {
-	if err := nRepo.Publish(); err != nil {
+// publishAndPrintToCLI publishes the repository's changes, or only those to the
+// given roles if any are given, reporting each stage of the publish unless
+// quiet is set
+func publishAndPrintToCLI(cmd *cobra.Command, nRepo notaryclient.Repository, quiet bool, roles ...data.RoleName) error {
+	if !quiet {
+		nRepo.SetPublishProgress(func(event notaryclient.PublishEvent) {
+			printPublishProgress(cmd, event)
+		})
+	}
+	if err := nRepo.PublishRoles(roles...); err != nil {
+		var unsupported notaryclient.ErrUnsupportedByServer
+		if errors.As(err, &unsupported) {
+			return fmt.Errorf("%v: the changes are still staged, to publish once the field is removed, or once the server is upgraded and remote_server.version is raised or unset", err)
+		}
 		return err
 	}
 	cmd.Printf("Successfully published changes for repository %s\n", nRepo.GetGUN())
 	return nil
 }
+
+// printPublishProgress reports a stage of a publish.  Like the rest of the
+// messages about publishing, it is written to STDERR.
+func printPublishProgress(cmd *cobra.Command, event notaryclient.PublishEvent) {
+	switch event.Stage {
+	case notaryclient.PublishLoadingChangelist:
+		cmd.Printf("Loading changelist: %d change(s) to publish\n", event.Changes)
+	case notaryclient.PublishBuildingMetadata:
+		cmd.Println("Building metadata")
+	case notaryclient.PublishUploading:
+		roles := make([]string, 0, len(event.Roles))
+		for _, role := range event.Roles {
+			roles = append(roles, role.String())
+		}
+		cmd.Printf("Uploading metadata for %s\n", strings.Join(roles, ", "))
+	case notaryclient.PublishConfirming:
+		cmd.Println("Confirming publish")
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,12 +14,18 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/passphrase"
+	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
 )
 
 // TestImportRootCert does the following
@@ -99,7 +108,7 @@ func TestTokenAuth(t *testing.T) {
 		baseTransport          = &http.Transport{}
 		gun           data.GUN = "test"
 	)
-	auth, err := tokenAuth("https://localhost:9999", baseTransport, gun, readOnly)
+	auth, err := tokenAuth("https://localhost:9999", baseTransport, baseTransport, gun, readOnly, "")
 	require.NoError(t, err)
 	require.Nil(t, auth)
 }
@@ -109,7 +118,7 @@ func TestAdminTokenAuth(t *testing.T) {
 		baseTransport          = &http.Transport{}
 		gun           data.GUN = "test"
 	)
-	auth, err := tokenAuth("https://localhost:9999", baseTransport, gun, admin)
+	auth, err := tokenAuth("https://localhost:9999", baseTransport, baseTransport, gun, admin, "")
 	require.NoError(t, err)
 	require.Nil(t, auth)
 }
@@ -122,7 +131,7 @@ func TestTokenAuth200Status(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(NotAuthorizedTestHandler))
 	defer s.Close()
 
-	auth, err := tokenAuth(s.URL, baseTransport, gun, readOnly)
+	auth, err := tokenAuth(s.URL, baseTransport, baseTransport, gun, readOnly, "")
 	require.NoError(t, err)
 	require.NotNil(t, auth)
 }
@@ -135,7 +144,7 @@ func TestAdminTokenAuth200Status(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(NotAuthorizedTestHandler))
 	defer s.Close()
 
-	auth, err := tokenAuth(s.URL, baseTransport, gun, admin)
+	auth, err := tokenAuth(s.URL, baseTransport, baseTransport, gun, admin, "")
 	require.NoError(t, err)
 	require.NotNil(t, auth)
 }
@@ -152,7 +161,7 @@ func TestTokenAuth401Status(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(NotAuthorizedTestHandler))
 	defer s.Close()
 
-	auth, err := tokenAuth(s.URL, baseTransport, gun, readOnly)
+	auth, err := tokenAuth(s.URL, baseTransport, baseTransport, gun, readOnly, "")
 	require.NoError(t, err)
 	require.NotNil(t, auth)
 }
@@ -165,7 +174,7 @@ func TestAdminTokenAuth401Status(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(NotAuthorizedTestHandler))
 	defer s.Close()
 
-	auth, err := tokenAuth(s.URL, baseTransport, gun, admin)
+	auth, err := tokenAuth(s.URL, baseTransport, baseTransport, gun, admin, "")
 	require.NoError(t, err)
 	require.NotNil(t, auth)
 }
@@ -182,7 +191,7 @@ func TestTokenAuthNon200Non401Status(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(NotFoundTestHandler))
 	defer s.Close()
 
-	auth, err := tokenAuth(s.URL, baseTransport, gun, readOnly)
+	auth, err := tokenAuth(s.URL, baseTransport, baseTransport, gun, readOnly, "")
 	require.NoError(t, err)
 	require.Nil(t, auth)
 }
@@ -195,7 +204,7 @@ func TestAdminTokenAuthNon200Non401Status(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(NotFoundTestHandler))
 	defer s.Close()
 
-	auth, err := tokenAuth(s.URL, baseTransport, gun, admin)
+	auth, err := tokenAuth(s.URL, baseTransport, baseTransport, gun, admin, "")
 	require.NoError(t, err)
 	require.Nil(t, auth)
 }
@@ -270,6 +279,41 @@ func TestConfigureRepoAdmin(t *testing.T) {
 	repo.ListRoles()
 }
 
+// status --porcelain lists each staged change on a line of its own, in the
+// order they were staged, as tab-separated fields
+func TestStatusPorcelain(t *testing.T) {
+	setUp(t)
+	tempBaseDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempBaseDir)
+
+	out, err := runCommand(t, tempBaseDir, "status", "gun", "--porcelain")
+	require.NoError(t, err)
+	require.Equal(t, "", out)
+
+	_, err = runCommand(t, tempBaseDir, "addhash", "gun", "app", "100", "--sha256",
+		"88b76b34ab83a9e4d5abe3697950fb73f940aab1aa5b534f80cf9de9708942be")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempBaseDir, "addhash", "gun", "lib/app", "100", "--sha256",
+		"4a7c203ce63b036a1999ea74eebd307c338368eb2b32218b722de6c5fdc7f016", "--roles", "targets/releases")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempBaseDir, "remove", "gun", "old")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempBaseDir, "delegation", "remove", "gun", "targets/releases", "--paths", "lib", "-y")
+	require.NoError(t, err)
+
+	out, err = runCommand(t, tempBaseDir, "status", "gun", "--porcelain")
+	require.NoError(t, err)
+	require.Equal(t, "0\tcreate\ttargets\ttarget\tapp\n"+
+		"1\tcreate\ttargets/releases\ttarget\tlib/app\n"+
+		"2\tdelete\ttargets\ttarget\told\n"+
+		"3\tupdate\ttargets/releases\tdelegation\t\n", out)
+
+	_, err = runCommand(t, tempBaseDir, "status", "gun", "--porcelain", "--diff-remote")
+	require.Error(t, err)
+	_, err = runCommand(t, tempBaseDir, "status", "gun", "--porcelain", "--expired-only")
+	require.Error(t, err)
+}
+
 func TestStatusUnstageAndReset(t *testing.T) {
 	setUp(t)
 	tempBaseDir := tempDirWithConfig(t, "{}")
@@ -331,6 +375,221 @@ func TestStatusUnstageAndReset(t *testing.T) {
 
 }
 
+func TestResetInteractive(t *testing.T) {
+	setUp(t)
+	tempBaseDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempBaseDir)
+
+	tc := &tufCommander{
+		configGetter: func() (*viper.Viper, error) {
+			v := viper.New()
+			v.SetDefault("trust_dir", tempBaseDir)
+			return v, nil
+		},
+	}
+
+	for i, sha := range []string{
+		"88b76b34ab83a9e4d5abe3697950fb73f940aab1aa5b534f80cf9de9708942be",
+		"4a7c203ce63b036a1999ea74eebd307c338368eb2b32218b722de6c5fdc7f016",
+		"64bd0565907a6a55fc66fd828a71dbadd976fa875d0a3869f53d02eb8710ecb4",
+		"9d9e890af64dd0f44b8a1538ff5fa0511cc31bf1ab89f3a3522a9a581a70fad8",
+	} {
+		tc.sha256 = sha
+		require.NoError(t, tc.tufAddByHash(&cobra.Command{}, []string{"gun", fmt.Sprintf("test%d", i+1), "100"}))
+	}
+
+	// interactive cannot be combined with explicit selections
+	tc.resetInteractive = true
+	tc.resetAll = true
+	require.Error(t, tc.tufReset(&cobra.Command{}, []string{"gun"}))
+	tc.resetAll = false
+
+	// drop the second and fourth changes, keep the rest
+	var out bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOutput(&out)
+	tc.stdin = bytes.NewBufferString("no\nyes\nn\ny\n")
+	require.NoError(t, tc.tufReset(cmd, []string{"gun"}))
+	require.Contains(t, out.String(), "Reset change #0")
+	require.Contains(t, out.String(), "Reset change #3")
+	// each change is listed with its index in the changelist
+	require.Regexp(t, `(?m)^\s*3\s+create\s+.*test4\s*$`, out.String())
+
+	status, err := runCommand(t, tempBaseDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, status, "test1")
+	require.NotContains(t, status, "test2")
+	require.Contains(t, status, "test3")
+	require.NotContains(t, status, "test4")
+
+	// running out of input keeps the remaining changes
+	tc.stdin = bytes.NewBufferString("yes\n")
+	require.NoError(t, tc.tufReset(&cobra.Command{}, []string{"gun"}))
+	status, err = runCommand(t, tempBaseDir, "status", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, status, "test1")
+	require.Contains(t, status, "test3")
+
+	// a non-terminal file skips the prompt and resets nothing
+	devNull, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer devNull.Close()
+	tc.stdin = devNull
+	require.NoError(t, tc.tufReset(&cobra.Command{}, []string{"gun"}))
+	status, err = runCommand(t, tempBaseDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, status, "test3")
+}
+
+func TestResetKeep(t *testing.T) {
+	setUp(t)
+	tempBaseDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempBaseDir)
+
+	tc := &tufCommander{
+		configGetter: func() (*viper.Viper, error) {
+			v := viper.New()
+			v.SetDefault("trust_dir", tempBaseDir)
+			return v, nil
+		},
+	}
+
+	for i, sha := range []string{
+		"88b76b34ab83a9e4d5abe3697950fb73f940aab1aa5b534f80cf9de9708942be",
+		"4a7c203ce63b036a1999ea74eebd307c338368eb2b32218b722de6c5fdc7f016",
+		"64bd0565907a6a55fc66fd828a71dbadd976fa875d0a3869f53d02eb8710ecb4",
+		"9d9e890af64dd0f44b8a1538ff5fa0511cc31bf1ab89f3a3522a9a581a70fad8",
+	} {
+		tc.sha256 = sha
+		require.NoError(t, tc.tufAddByHash(&cobra.Command{}, []string{"gun", fmt.Sprintf("test%d", i+1), "100"}))
+	}
+
+	// --keep cannot be combined with other selections
+	_, err := runCommand(t, tempBaseDir, "reset", "gun", "--keep", "0", "-n", "1")
+	require.Error(t, err)
+	_, err = runCommand(t, tempBaseDir, "reset", "gun", "--keep", "0", "--all")
+	require.Error(t, err)
+
+	// every change to keep must exist, or nothing is reset
+	for _, invalid := range []string{"0,4", "-1"} {
+		_, err = runCommand(t, tempBaseDir, "reset", "gun", "--keep", invalid)
+		require.Error(t, err, invalid)
+	}
+	status, err := runCommand(t, tempBaseDir, "status", "gun")
+	require.NoError(t, err)
+	for _, target := range []string{"test1", "test2", "test3", "test4"} {
+		require.Contains(t, status, target)
+	}
+
+	_, err = runCommand(t, tempBaseDir, "reset", "gun", "--keep", "1,3")
+	require.NoError(t, err)
+	status, err = runCommand(t, tempBaseDir, "status", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, status, "test1")
+	require.Contains(t, status, "test2")
+	require.NotContains(t, status, "test3")
+	require.Contains(t, status, "test4")
+
+	// keeping every change resets none of them
+	out, err := runCommand(t, tempBaseDir, "reset", "gun", "--keep", "0,1")
+	require.NoError(t, err)
+	require.Contains(t, out, "All changes are kept")
+	status, err = runCommand(t, tempBaseDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, status, "test2")
+	require.Contains(t, status, "test4")
+}
+
+func TestInitInteractive(t *testing.T) {
+	setUp(t)
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+	server := setupServer()
+	defer server.Close()
+
+	cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	certFile := filepath.Join(tempDir, "delegation.crt")
+	require.NoError(t, ioutil.WriteFile(certFile, utils.CertToPEM(cert), 0644))
+
+	tc := &tufCommander{
+		configGetter: func() (*viper.Viper, error) {
+			v := viper.New()
+			v.SetDefault("trust_dir", tempDir)
+			v.SetDefault("remote_server.url", server.URL)
+			return v, nil
+		},
+		retriever:       passphrase.ConstantRetriever(testPassphrase),
+		initInteractive: true,
+	}
+
+	var out bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOutput(&out)
+	tc.stdin = bytes.NewBufferString(strings.Join([]string{
+		"",    // generate a new root key
+		"30",  // too short an expiry, so asked again
+		"730", // days until the root expires
+		"maybe",
+		"yes",      // add a delegation
+		"releases", // not a delegation role, so asked again
+		"targets/releases",
+		filepath.Join(tempDir, "missing.crt"), // asked again
+		certFile,
+		"releases/, beta/",
+		"no",  // no more delegations
+		"yes", // publish
+	}, "\n") + "\n")
+	require.NoError(t, tc.tufInit(cmd, []string{"gun"}))
+	require.Contains(t, out.String(), "Please enter a number of days")
+	require.Contains(t, out.String(), "Please answer yes or no")
+	require.Contains(t, out.String(), `"releases" is not a valid delegation role name`)
+
+	// the root expiry only applied to this repository
+	require.WithinDuration(t, time.Now().Add(notary.NotaryRootExpiry), data.DefaultExpires(data.CanonicalRootRole), time.Minute)
+
+	repo, err := client.NewFileCachedRepository(tempDir, "gun", server.URL, http.DefaultTransport, nil, trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	delegations, err := repo.GetDelegationRoles()
+	require.NoError(t, err)
+	require.Len(t, delegations, 1)
+	require.EqualValues(t, "targets/releases", delegations[0].Name)
+	require.Equal(t, []string{"releases/", "beta/"}, delegations[0].Paths)
+	require.Len(t, delegations[0].KeyIDs, 1)
+	canonicalID, err := utils.CanonicalKeyID(utils.CertToKey(cert))
+	require.NoError(t, err)
+	require.Equal(t, keyID, canonicalID)
+
+	rawRoot, err := ioutil.ReadFile(filepath.Join(tempDir, "tuf", "gun", "metadata", "root.json"))
+	require.NoError(t, err)
+	signedRoot := &data.Signed{}
+	require.NoError(t, json.Unmarshal(rawRoot, signedRoot))
+	root, err := data.RootFromSigned(signedRoot)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().AddDate(0, 0, 730), root.Signed.Expires, time.Minute)
+
+	// a root key in the keystore can be reused, but running out of input
+	// stops before anything is initialized
+	out.Reset()
+	tc.stdin = bytes.NewBufferString("yes\n")
+	require.Error(t, tc.tufInit(cmd, []string{"gun2"}))
+	require.Contains(t, out.String(), "Reuse the root key")
+	_, err = os.Stat(filepath.Join(tempDir, "tuf", "gun2", "metadata", "root.json"))
+	require.True(t, os.IsNotExist(err))
+
+	// a non-terminal input skips the prompts, and initializes without publishing
+	devNull, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer devNull.Close()
+	out.Reset()
+	tc.stdin = devNull
+	require.NoError(t, tc.tufInit(cmd, []string{"gun3"}))
+	require.Contains(t, out.String(), "skipping guided setup")
+	_, err = os.Stat(filepath.Join(tempDir, "tuf", "gun3", "metadata", "root.json"))
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun3")
+	require.Error(t, err)
+}
+
 func TestGetTrustPinningErrors(t *testing.T) {
 	setUp(t)
 	invalidTrustPinConfig := tempDirWithConfig(t, `{
@@ -366,6 +625,34 @@ func TestGetTrustPinningErrors(t *testing.T) {
 	require.Error(t, tc.tufAddByHash(&cobra.Command{}, []string{"gun", "test1", "100"}))
 }
 
+// An encrypted key is decrypted with the passphrase for the role it is read for
+func TestReadKeyPassphraseAlias(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "notary-cmd-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	pemPrivKey, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalTargetsRole, "gun", "passphrase")
+	require.NoError(t, err)
+	keyFilename := filepath.Join(tempDir, "targets.key")
+	require.NoError(t, ioutil.WriteFile(keyFilename, pemPrivKey, 0600))
+
+	var aliases []string
+	retriever := func(_, alias string, _ bool, _ int) (string, bool, error) {
+		aliases = append(aliases, alias)
+		return "passphrase", false, nil
+	}
+	read, err := readKey(data.CanonicalTargetsRole, keyFilename, retriever)
+	require.NoError(t, err)
+	require.Equal(t, privKey.ID(), read.ID())
+	require.Equal(t, []string{data.CanonicalTargetsRole.String()}, aliases)
+
+	_, err = readKey(data.CanonicalTargetsRole, filepath.Join(tempDir, "missing.key"), retriever)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "root")
+}
+
 func TestPasswordStore(t *testing.T) {
 	myurl, err := url.Parse("https://docker.io")
 	require.NoError(t, err)
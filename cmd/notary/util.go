@@ -1,15 +1,36 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
 )
 
 const (
 	// The help text of auto publish
 	htAutoPublish string = "Automatically attempt to publish after staging the change. Will also publish existing staged changes."
+
+	// The passphrase alias of the PKCS#12 bundle holding the TLS client
+	// certificate, as given to the passphrase retriever
+	tlsClientP12Alias = "tls_client"
+
+	// The help text of custom merge
+	htCustomMerge string = "Deep merge the custom data into that of the published target, instead of replacing it. This is an online operation."
 )
 
 // getPayload is a helper function to get the content used to be verified
@@ -36,6 +57,205 @@ func getPayload(t *tufCommander) ([]byte, error) {
 	return payload, nil
 }
 
+// maxFetchAttempts is how many requests are made for the object at a URL
+// before giving up, when the connection keeps dropping
+const maxFetchAttempts = 5
+
+// fetchRetryDelay is how long to wait before requesting the rest of an object
+// after the connection fetching it dropped
+var fetchRetryDelay = time.Second
+
+// errRestartFetch is returned when a fetch could not be resumed, because the
+// server does not support range requests or the object has changed, so the
+// object is being fetched again from its start
+var errRestartFetch = errors.New("fetch restarted from the start of the object")
+
+// getRemoteFileMeta fetches the object at the given URL, sending the given
+// "Name: value" headers, and streams it through the hashers to generate its
+// FileMeta without holding the whole object in memory.  If the connection
+// drops, the rest of the object is requested with a range request, so that
+// the bytes already hashed are not fetched again, or the object is hashed
+// again from its start if the server does not support ranges.  No more than
+// one byte beyond the trusted length of the object is read, and the fetch
+// fails as soon as the server reports a different length.
+func getRemoteFileMeta(url string, headers []string, length int64) (data.FileMeta, error) {
+	body := &resumableBody{url: url, headers: headers, length: length}
+	defer body.Close()
+	if err := body.open(); err != nil {
+		return data.FileMeta{}, fmt.Errorf("error fetching content from %s: %w", url, err)
+	}
+	for {
+		meta, err := data.NewFileMeta(io.LimitReader(body, length+1), data.NotaryDefaultHashes...)
+		if err == errRestartFetch {
+			continue
+		}
+		if err != nil {
+			return data.FileMeta{}, fmt.Errorf("error reading content from %s: %w", url, err)
+		}
+		if meta.Length > length {
+			return data.FileMeta{}, fmt.Errorf("data not present in the trusted collection, content from %s is longer than the expected %d bytes", url, length)
+		}
+		return meta, nil
+	}
+}
+
+// resumableBody reads the object at a URL, tracking how much of it has been
+// read so that it can resume from there if the connection drops
+type resumableBody struct {
+	url     string
+	headers []string
+	length  int64
+
+	resp      *http.Response
+	offset    int64
+	validator string
+	attempts  int
+	lastErr   error
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		if b.resp == nil {
+			if err := b.open(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := b.resp.Body.Read(p)
+		b.offset += int64(n)
+		if err != nil && err != io.EOF {
+			logrus.Debugf("fetching %s dropped after %d bytes: %v", b.url, b.offset, err)
+			b.resp.Body.Close()
+			b.resp = nil
+			b.lastErr = err
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close closes the response being read, if any
+func (b *resumableBody) Close() error {
+	if b.resp == nil {
+		return nil
+	}
+	return b.resp.Body.Close()
+}
+
+// open requests the object, or the rest of it if some has already been read.
+// errRestartFetch is returned if the server sent the whole object when asked
+// for the rest of it.
+func (b *resumableBody) open() error {
+	for {
+		if b.attempts >= maxFetchAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", b.attempts, b.lastErr)
+		}
+		if b.attempts > 0 {
+			time.Sleep(fetchRetryDelay)
+		}
+		b.attempts++
+
+		req, err := http.NewRequest("GET", b.url, nil)
+		if err != nil {
+			return err
+		}
+		if err := addHeaders(req, b.headers); err != nil {
+			return err
+		}
+		if b.offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+			if b.validator != "" {
+				// the rest of the object is only sent if it hasn't changed
+				req.Header.Set("If-Range", b.validator)
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			logrus.Debugf("error fetching %s: %v", b.url, err)
+			b.lastErr = err
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			if resp.ContentLength >= 0 && resp.ContentLength != b.length {
+				resp.Body.Close()
+				return fmt.Errorf("data not present in the trusted collection, expected %d bytes but the server reported %d", b.length, resp.ContentLength)
+			}
+			b.resp = resp
+			b.validator = resp.Header.Get("ETag")
+			if b.validator == "" {
+				b.validator = resp.Header.Get("Last-Modified")
+			}
+			if b.offset > 0 {
+				logrus.Debugf("%s could not be resumed after %d bytes, fetching it again", b.url, b.offset)
+				b.offset = 0
+				return errRestartFetch
+			}
+			return nil
+		case resp.StatusCode == http.StatusPartialContent && b.offset > 0:
+			var start int64
+			contentRange := resp.Header.Get("Content-Range")
+			if _, err := fmt.Sscanf(contentRange, "bytes %d-", &start); err != nil || start != b.offset {
+				resp.Body.Close()
+				return fmt.Errorf("asked for the content from byte %d, got %q", b.offset, contentRange)
+			}
+			if i := strings.LastIndex(contentRange, "/"); i >= 0 && contentRange[i+1:] != "*" {
+				if total, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err != nil || total != b.length {
+					resp.Body.Close()
+					return fmt.Errorf("data not present in the trusted collection, expected %d bytes but the server reported %q", b.length, contentRange)
+				}
+			}
+			logrus.Debugf("resuming %s after %d bytes", b.url, b.offset)
+			b.resp = resp
+			return nil
+		default:
+			resp.Body.Close()
+			return errors.New(resp.Status)
+		}
+	}
+}
+
+// addHeaders adds headers given on the command line in the form
+// "Name: value" to the request
+func addHeaders(req *http.Request, headers []string) error {
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("invalid header %q, must be in the form \"Name: value\"", header)
+		}
+		req.Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return nil
+}
+
+// getHashAlgorithms validates the hash algorithms given on the command line,
+// ignoring case and repeats, and returns them in the order of
+// data.NotaryDefaultHashes.  No algorithms means all of them.
+func getHashAlgorithms(algos []string) ([]string, error) {
+	if len(algos) == 0 {
+		return data.NotaryDefaultHashes, nil
+	}
+	requested := make(map[string]bool, len(algos))
+	for _, algo := range algos {
+		algo = strings.ToLower(strings.TrimSpace(algo))
+		if !utils.StrSliceContains(data.NotaryDefaultHashes, algo) {
+			return nil, fmt.Errorf("unsupported hash algorithm %q, must be one of: %s",
+				algo, strings.Join(data.NotaryDefaultHashes, ", "))
+		}
+		requested[algo] = true
+	}
+	hashAlgorithms := make([]string, 0, len(requested))
+	for _, algo := range data.NotaryDefaultHashes {
+		if requested[algo] {
+			hashAlgorithms = append(hashAlgorithms, algo)
+		}
+	}
+	return hashAlgorithms, nil
+}
+
 // feedback is a helper function to print the payload to a file or STDOUT or keep quiet
 // due to the value of flag "quiet" and "output".
 func feedback(t *tufCommander, payload []byte) error {
@@ -62,3 +282,80 @@ func homeExpand(homeDir, path string) string {
 	}
 	return filepath.Join(homeDir, path[1:])
 }
+
+const (
+	// minShortKeyIDLength is the length key IDs are shortened to for display,
+	// unless a longer prefix is needed to tell them apart
+	minShortKeyIDLength = 7
+
+	// minKeyIDPrefixLength is the shortest prefix by which a key ID can be
+	// given on the command line
+	minKeyIDPrefixLength = 4
+)
+
+// useShortKeyIDs says whether key IDs should be shortened for display: the
+// flag wins if it was given, and otherwise the keys.short_ids configuration
+// decides
+func useShortKeyIDs(cmd *cobra.Command, flag bool, config *viper.Viper) bool {
+	if cmd.Flags().Changed("short") {
+		return flag
+	}
+	return config.GetBool("keys.short_ids")
+}
+
+// shortKeyIDLength returns the length, of at least minShortKeyIDLength, at
+// which the prefixes of all the distinct key IDs given are distinct
+func shortKeyIDLength(keyIDs []string) int {
+	length := minShortKeyIDLength
+	for {
+		seen := make(map[string]string)
+		clash := false
+		for _, keyID := range keyIDs {
+			prefix := shortKeyID(keyID, length)
+			if other, ok := seen[prefix]; ok && other != keyID {
+				clash = true
+				break
+			}
+			seen[prefix] = keyID
+		}
+		if !clash {
+			return length
+		}
+		length++
+	}
+}
+
+// shortKeyID returns the prefix of the key ID of the given length
+func shortKeyID(keyID string, length int) string {
+	if len(keyID) <= length {
+		return keyID
+	}
+	return keyID[:length]
+}
+
+// resolveKeyID returns the one key ID of those known which starts with the
+// given prefix.  A full key ID, a prefix shorter than minKeyIDPrefixLength
+// or a prefix which matches no key ID is returned unchanged, so that the
+// caller reports it as it would any unknown key ID.  It is an error for a
+// prefix to match more than one key ID.
+func resolveKeyID(prefix string, known []string) (string, error) {
+	if len(prefix) >= notary.SHA256HexSize || len(prefix) < minKeyIDPrefixLength {
+		return prefix, nil
+	}
+	var matches []string
+	seen := make(map[string]bool)
+	for _, keyID := range known {
+		if strings.HasPrefix(keyID, prefix) && !seen[keyID] {
+			seen[keyID] = true
+			matches = append(matches, keyID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return prefix, nil
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", fmt.Errorf("key ID prefix %s is ambiguous, it matches: %s", prefix, strings.Join(matches, ", "))
+}
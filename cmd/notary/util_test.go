@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
 )
 
 func TestGetPayload(t *testing.T) {
@@ -61,3 +69,168 @@ func TestHomeExpand(t *testing.T) {
 	require.Equal(t, homeExpand("home", "~cyli"), "~cyli")
 	require.Equal(t, homeExpand(string(os.PathSeparator)+"home", filepath.Join("~", "test")), string(os.PathSeparator)+filepath.Join("home", "test"))
 }
+
+func TestShortKeyIDLength(t *testing.T) {
+	require.Equal(t, minShortKeyIDLength, shortKeyIDLength(nil))
+	require.Equal(t, minShortKeyIDLength, shortKeyIDLength([]string{"abcdef0123", "abcdef1123"}))
+	// the same key ID listed twice doesn't need a longer prefix
+	require.Equal(t, minShortKeyIDLength, shortKeyIDLength([]string{"abcdef0123", "abcdef0123"}))
+	require.Equal(t, 9, shortKeyIDLength([]string{"abcdef0123", "abcdef0133", "1234567890"}))
+}
+
+func TestResolveKeyID(t *testing.T) {
+	full := func(prefix string) string {
+		return prefix + strings.Repeat("0", notary.SHA256HexSize-len(prefix))
+	}
+	known := []string{full("abcd1"), full("abcd2"), full("ef01"), full("ef01")}
+
+	// a unique prefix resolves to the full key ID, even if the key is known
+	// more than once
+	for prefix, keyID := range map[string]string{"abcd1": known[0], "abcd2": known[1], "ef01": known[2]} {
+		resolved, err := resolveKeyID(prefix, known)
+		require.NoError(t, err)
+		require.Equal(t, keyID, resolved)
+	}
+
+	// full key IDs, prefixes that are too short and unknown prefixes are
+	// left for the caller to report
+	for _, keyID := range []string{full("abcd"), "abc", "9999"} {
+		resolved, err := resolveKeyID(keyID, known)
+		require.NoError(t, err)
+		require.Equal(t, keyID, resolved)
+	}
+
+	// an ambiguous prefix is an error which lists the key IDs it matches
+	_, err := resolveKeyID("abcd", known)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ambiguous")
+	require.Contains(t, err.Error(), known[0])
+	require.Contains(t, err.Error(), known[1])
+}
+
+// droppingServer serves the content, supporting range requests, but drops
+// the connection after sending dropAfter bytes of the first response.  Each
+// request's Range header is recorded.
+func droppingServer(content []byte, dropAfter int, supportRanges bool, ranges *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		if !supportRanges {
+			r.Header.Del("Range")
+		}
+		if len(*ranges) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:dropAfter])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("ETag", `"content"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestGetRemoteFileMetaResumes(t *testing.T) {
+	defer func(delay time.Duration) { fetchRetryDelay = delay }(fetchRetryDelay)
+	fetchRetryDelay = 0
+
+	content := bytes.Repeat([]byte("resumable content "), 1<<12)
+	expected, err := data.NewFileMeta(bytes.NewReader(content), data.NotaryDefaultHashes...)
+	require.NoError(t, err)
+
+	// the rest of the content is requested from where the connection dropped
+	var ranges []string
+	server := droppingServer(content, 1000, true, &ranges)
+	defer server.Close()
+	meta, err := getRemoteFileMeta(server.URL, nil, int64(len(content)))
+	require.NoError(t, err)
+	require.Equal(t, expected, meta)
+	require.Equal(t, []string{"", "bytes=1000-"}, ranges)
+
+	// the content is hashed again from its start if ranges are not supported
+	ranges = nil
+	server = droppingServer(content, 1000, false, &ranges)
+	defer server.Close()
+	meta, err = getRemoteFileMeta(server.URL, nil, int64(len(content)))
+	require.NoError(t, err)
+	require.Equal(t, expected, meta)
+	require.Equal(t, []string{"", "bytes=1000-"}, ranges)
+}
+
+func TestGetRemoteFileMetaGivesUp(t *testing.T) {
+	defer func(delay time.Duration) { fetchRetryDelay = delay }(fetchRetryDelay)
+	fetchRetryDelay = 0
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	_, err := getRemoteFileMeta(server.URL, nil, 100)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), fmt.Sprintf("giving up after %d attempts", maxFetchAttempts))
+	require.Equal(t, maxFetchAttempts, requests)
+}
+
+func TestGetRemoteFileMetaBoundsLength(t *testing.T) {
+	defer func(delay time.Duration) { fetchRetryDelay = delay }(fetchRetryDelay)
+	fetchRetryDelay = 0
+
+	// content without a reported length is read no further than one byte
+	// beyond the expected length, however much the server sends
+	var sent int64
+	endless := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := bytes.Repeat([]byte("x"), 1024)
+		for {
+			n, err := w.Write(chunk)
+			sent += int64(n)
+			if err != nil || sent > 1<<30 {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer endless.Close()
+	_, err := getRemoteFileMeta(endless.URL, nil, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "longer than the expected 10 bytes")
+	endless.Close()
+	require.True(t, sent < 1<<30, "the whole response was read")
+
+	// a reported length which is not the expected one fails before hashing
+	requests := 0
+	oversized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Length", "100")
+		w.Write(bytes.Repeat([]byte("x"), 100))
+	}))
+	defer oversized.Close()
+	_, err = getRemoteFileMeta(oversized.URL, nil, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected 10 bytes but the server reported 100")
+	require.Equal(t, 1, requests)
+
+	// so does a resumed range of an object of another length
+	content := bytes.Repeat([]byte("x"), 2000)
+	requests = 0
+	resumed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:1000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 1000-4999/%d", 5000))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(bytes.Repeat([]byte("x"), 4000))
+	}))
+	defer resumed.Close()
+	_, err = getRemoteFileMeta(resumed.URL, nil, int64(len(content)))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `expected 2000 bytes but the server reported "bytes 1000-4999/5000"`)
+	require.Equal(t, 2, requests)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+var cmdWhoamiTemplate = usageTemplate{
+	Use:   "whoami [ server ] [ GUN ]",
+	Short: "Reports the identity and scopes obtained from the trust server.",
+	Long:  "Authenticates with the trust server, and reports the identity and scopes that were granted, either for the Globally Unique Name or, if none is given, for the server catalog. The token itself is never printed.",
+}
+
+type whoamiCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+}
+
+// tokenAccess is a single scope granted by a token, as in the docker token
+// authentication specification
+type tokenAccess struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// tokenClaims are the claims of a token which describe its identity and scopes
+type tokenClaims struct {
+	Issuer    string        `json:"iss"`
+	Subject   string        `json:"sub"`
+	ExpiresAt int64         `json:"exp"`
+	Access    []tokenAccess `json:"access"`
+}
+
+func (w *whoamiCommander) GetCommand() *cobra.Command {
+	return cmdWhoamiTemplate.ToCommand(w.whoami)
+}
+
+func (w *whoamiCommander) whoami(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Usage()
+		return fmt.Errorf("must specify a server, and optionally a GUN")
+	}
+
+	config, err := w.configGetter()
+	if err != nil {
+		return err
+	}
+	config.Set("remote_server.url", args[0])
+
+	var gun data.GUN
+	permission := admin
+	if len(args) == 2 {
+		gun = data.GUN(args[1])
+		permission = readWrite
+	}
+
+	rt, err := getTransport(config, gun, permission, w.retriever)
+	if err != nil {
+		return err
+	}
+	if rt == nil {
+		return fmt.Errorf("could not reach trust server %s", args[0])
+	}
+
+	endpoint, err := url.Parse(args[0])
+	if err != nil {
+		return err
+	}
+	if gun == "" {
+		endpoint.Path = path.Join(endpoint.Path, "/v2") + "/"
+	} else {
+		endpoint.Path = path.Join(endpoint.Path, "/v2", gun.String(), "_trust/tuf/root.json")
+	}
+
+	resp, err := (&http.Client{Transport: rt}).Get(endpoint.String())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("unable to authenticate with trust server %s", args[0])
+	}
+
+	// the request which was eventually sent carries the credentials obtained
+	// by the auth flow
+	var authorization string
+	if resp.Request != nil {
+		authorization = resp.Request.Header.Get("Authorization")
+	}
+	return printIdentity(cmd.OutOrStdout(), authorization)
+}
+
+// printIdentity describes the identity in an Authorization header, without
+// printing any secrets it contains
+func printIdentity(out io.Writer, authorization string) error {
+	scheme, credentials := authorization, ""
+	if i := strings.Index(authorization, " "); i >= 0 {
+		scheme, credentials = authorization[:i], strings.TrimSpace(authorization[i+1:])
+	}
+
+	switch strings.ToLower(scheme) {
+	case "":
+		fmt.Fprintln(out, "Authentication: none (anonymous access)")
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return fmt.Errorf("could not decode basic auth credentials: %v", err)
+		}
+		username := strings.SplitN(string(decoded), ":", 2)[0]
+		fmt.Fprintln(out, "Authentication: basic")
+		fmt.Fprintf(out, "Username: %s\n", username)
+	case "bearer":
+		fmt.Fprintln(out, "Authentication: token")
+		claims, err := decodeTokenClaims(credentials)
+		if err != nil {
+			fmt.Fprintf(out, "Token is opaque, so its identity and scopes are unknown: %v\n", err)
+			return nil
+		}
+		fmt.Fprintf(out, "Subject: %s\n", claims.Subject)
+		if claims.Issuer != "" {
+			fmt.Fprintf(out, "Issuer: %s\n", claims.Issuer)
+		}
+		if claims.ExpiresAt != 0 {
+			fmt.Fprintf(out, "Expires: %s\n", time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339))
+		}
+		if len(claims.Access) == 0 {
+			fmt.Fprintln(out, "Scopes: none")
+			return nil
+		}
+		fmt.Fprintln(out, "Scopes:")
+		for _, access := range claims.Access {
+			fmt.Fprintf(out, "  %s:%s:%s\n", access.Type, access.Name, strings.Join(access.Actions, ","))
+		}
+	default:
+		fmt.Fprintf(out, "Authentication: %s\n", scheme)
+	}
+	return nil
+}
+
+// decodeTokenClaims decodes the claims of a JWT bearer token, without
+// verifying its signature, which is the trust server's job
+func decodeTokenClaims(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("not a JSON web token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode token claims: %v", err)
+	}
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("could not parse token claims: %v", err)
+	}
+	return claims, nil
+}
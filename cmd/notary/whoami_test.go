@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testTokenSignature = "not-a-real-signature"
+
+// fakeAuthServer issues JWTs to alice, granting exactly the requested scope
+func fakeAuthServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var access []tokenAccess
+		for _, scope := range r.URL.Query()["scope"] {
+			parts := strings.SplitN(scope, ":", 3)
+			require.Len(t, parts, 3)
+			access = append(access, tokenAccess{Type: parts[0], Name: parts[1], Actions: strings.Split(parts[2], ",")})
+		}
+		claims, err := json.Marshal(tokenClaims{Issuer: "fake-auth", Subject: user, ExpiresAt: 4102444800, Access: access})
+		require.NoError(t, err)
+		token := strings.Join([]string{
+			base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)),
+			base64.RawURLEncoding.EncodeToString(claims),
+			testTokenSignature,
+		}, ".")
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	}))
+}
+
+// fakeTrustServer challenges any request without an Authorization header of
+// the given scheme
+func fakeTrustServer(scheme, challenge string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scheme != "" && !strings.HasPrefix(r.Header.Get("Authorization"), scheme+" ") {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func setNotaryAuth(creds string) func() {
+	orig := os.Getenv("NOTARY_AUTH")
+	os.Setenv("NOTARY_AUTH", base64.StdEncoding.EncodeToString([]byte(creds)))
+	return func() { os.Setenv("NOTARY_AUTH", orig) }
+}
+
+func TestWhoamiToken(t *testing.T) {
+	defer setNotaryAuth("alice:secret")()
+
+	authServer := fakeAuthServer(t)
+	defer authServer.Close()
+	server := fakeTrustServer("Bearer", fmt.Sprintf(`Bearer realm="%s/token",service="notary"`, authServer.URL))
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	output, err := runCommand(t, tempDir, "whoami", server.URL, "docker.com/notary")
+	require.NoError(t, err)
+	require.Contains(t, output, "Authentication: token")
+	require.Contains(t, output, "Subject: alice")
+	require.Contains(t, output, "Issuer: fake-auth")
+	require.Contains(t, output, "Expires: 2100-01-01T00:00:00Z")
+	require.Contains(t, output, "repository:docker.com/notary:push,pull")
+	require.NotContains(t, output, testTokenSignature)
+	require.NotContains(t, output, "secret")
+
+	// without a GUN, the catalog scope is requested
+	output, err = runCommand(t, tempDir, "whoami", server.URL)
+	require.NoError(t, err)
+	require.Contains(t, output, "Subject: alice")
+	require.Contains(t, output, "registry:catalog:*")
+	require.NotContains(t, output, "repository:")
+}
+
+func TestWhoamiTokenBadCredentials(t *testing.T) {
+	defer setNotaryAuth("alice:wrong")()
+
+	authServer := fakeAuthServer(t)
+	defer authServer.Close()
+	server := fakeTrustServer("Bearer", fmt.Sprintf(`Bearer realm="%s/token",service="notary"`, authServer.URL))
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	_, err := runCommand(t, tempDir, "whoami", server.URL, "docker.com/notary")
+	require.Error(t, err)
+}
+
+func TestWhoamiBasic(t *testing.T) {
+	defer setNotaryAuth("alice:secret")()
+
+	server := fakeTrustServer("Basic", `Basic realm="notary"`)
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	output, err := runCommand(t, tempDir, "whoami", server.URL, "docker.com/notary")
+	require.NoError(t, err)
+	require.Contains(t, output, "Authentication: basic")
+	require.Contains(t, output, "Username: alice")
+	require.NotContains(t, output, "secret")
+}
+
+func TestWhoamiAnonymous(t *testing.T) {
+	server := fakeTrustServer("", "")
+	defer server.Close()
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	output, err := runCommand(t, tempDir, "whoami", server.URL)
+	require.NoError(t, err)
+	require.Contains(t, output, "Authentication: none")
+
+	_, err = runCommand(t, tempDir, "whoami")
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "whoami", server.URL, "gun", "extra")
+	require.Error(t, err)
+}
+
+func TestPrintIdentityOpaqueToken(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, printIdentity(&out, "Bearer opaque-secret-token"))
+	require.Contains(t, out.String(), "Token is opaque")
+	require.NotContains(t, out.String(), "opaque-secret-token")
+}
@@ -10,6 +10,10 @@ const (
 	MaxDownloadSize int64 = 100 << 20
 	// MaxTimestampSize is the maximum size of timestamp metadata - 1MiB.
 	MaxTimestampSize int64 = 1 << 20
+	// DefaultMaxRequestBodySize is the maximum size of a metadata update that the
+	// server will accept if no limit is configured - 256MiB, which leaves room
+	// for several roles of up to MaxDownloadSize each.
+	DefaultMaxRequestBodySize int64 = 256 << 20
 	// MinRSABitSize is the minimum bit size for RSA keys allowed in notary
 	MinRSABitSize = 2048
 	// MinThreshold requires a minimum of one threshold for roles; currently we do not support a higher threshold
@@ -22,6 +26,18 @@ const (
 	SHA256 = "sha256"
 	// SHA512 is the name of SHA512 hash algorithm
 	SHA512 = "sha512"
+	// SHA3_256 is the name of the SHA3-256 hash algorithm, which is verified
+	// but not generated
+	SHA3_256 = "sha3-256"
+	// SHA3_512 is the name of the SHA3-512 hash algorithm, which is verified
+	// but not generated
+	SHA3_512 = "sha3-512"
+	// BLAKE2b256 is the name of the BLAKE2b-256 hash algorithm, which is
+	// verified but not generated
+	BLAKE2b256 = "blake2b-256"
+	// BLAKE2b512 is the name of the BLAKE2b-512 hash algorithm, which is
+	// verified but not generated
+	BLAKE2b512 = "blake2b-512"
 	// TrustedCertsDir is the directory, under the notary repo base directory, where trusted certs are stored
 	TrustedCertsDir = "trusted_certificates"
 	// PrivDir is the directory, under the notary repo base directory, where private keys are stored
@@ -45,6 +61,11 @@ const (
 	NotarySnapshotExpiry  = 3 * Year
 	NotaryTimestampExpiry = 14 * Day
 
+	// DefaultClockSkewThreshold is how far the local clock may be ahead of a
+	// notary server's before metadata which appears expired is blamed on the
+	// local clock rather than on the metadata
+	DefaultClockSkewThreshold = 5 * time.Minute
+
 	ConsistentMetadataCacheMaxAge = 30 * Day
 	CurrentMetadataCacheMaxAge    = 5 * time.Minute
 	// CacheMaxAgeLimit is the generally recommended maximum age for Cache-Control headers
@@ -75,6 +96,10 @@ const (
 
 	// DefaultPageSize is the default number of records to return from the changefeed
 	DefaultPageSize = 100
+
+	// NotFoundNonceHeader is the request header carrying the nonce which a
+	// server's signed statement that a GUN does not exist must echo
+	NotFoundNonceHeader = "X-Notary-Not-Found-Nonce"
 )
 
 // enum to use for setting and retrieving values from contexts
@@ -83,6 +108,15 @@ const (
 	CtxKeyKeyAlgo
 	CtxKeyCryptoSvc
 	CtxKeyRepo
+	CtxKeyMaxRequestBodySize
+	CtxKeyTimestampAuthority
+	CtxKeyPublicRoot
+	CtxKeyServerManagedSnapshot
+	CtxKeyWebhooks
+	CtxKeyCustomSchemas
+	CtxKeyNotFoundSigner
+	CtxKeyServerConfig
+	CtxKeyAuthorizer
 )
 
 // NotarySupportedBackends contains the backends we would like to support at present
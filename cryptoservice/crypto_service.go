@@ -99,6 +99,13 @@ func (cs *CryptoService) RemoveKey(keyID string) (err error) {
 // AddKey adds a private key to a specified role.
 // The GUN is inferred from the cryptoservice itself for non-root roles
 func (cs *CryptoService) AddKey(role data.RoleName, gun data.GUN, key data.PrivateKey) (err error) {
+	return cs.AddKeyWithInfo(trustmanager.KeyInfo{Role: role, Gun: gun}, key)
+}
+
+// AddKeyWithInfo adds a private key to the role given by the key info, along
+// with the rest of the key info, such as its label
+func (cs *CryptoService) AddKeyWithInfo(info trustmanager.KeyInfo, key data.PrivateKey) (err error) {
+	role := info.Role
 	// First check if this key already exists in any of our keystores
 	for _, ks := range cs.keyStores {
 		if keyInfo, err := ks.GetKeyInfo(key.ID()); err == nil {
@@ -112,7 +119,7 @@ func (cs *CryptoService) AddKey(role data.RoleName, gun data.GUN, key data.Priva
 	// If the key didn't exist in any of our keystores, add and return on the first successful keystore
 	for _, ks := range cs.keyStores {
 		// Try to add to this keystore, return if successful
-		if err = ks.AddKey(trustmanager.KeyInfo{Role: role, Gun: gun}, key); err == nil {
+		if err = ks.AddKey(info, key); err == nil {
 			return nil
 		}
 	}
@@ -168,6 +168,26 @@ EOL
         rm "${selfsigned}.cnf" "${selfsigned}.csr" "${selfsigned}.key"
 done
 
+# generate a self-signed TLS client certificate, bundled with its key as a
+# PKCS#12 file protected by the passphrase "passphrase".  Legacy algorithms are
+# used because golang.org/x/crypto/pkcs12 cannot decode the newer ones.
+openssl ecparam -name prime256v1 -genkey -out "notary-client.key"
+openssl req -new -key "notary-client.key" -out "notary-client.csr" -sha256 -subj '/O=Docker/CN=notary-client'
+cat > "notary-client.cnf" <<EOL
+[notary_client]
+basicConstraints = critical,CA:FALSE
+keyUsage = critical, digitalSignature, keyEncipherment
+extendedKeyUsage = clientAuth
+subjectKeyIdentifier = hash
+EOL
+
+openssl x509 -req -days 36500 -in "notary-client.csr" -signkey "notary-client.key" \
+        -out "notary-client.crt" -extfile "notary-client.cnf" -extensions notary_client
+openssl pkcs12 -export -in "notary-client.crt" -inkey "notary-client.key" -out "notary-client.p12" \
+        -passout pass:passphrase -certpbe PBE-SHA1-3DES -keypbe PBE-SHA1-3DES -macalg sha1
+
+rm "notary-client.cnf" "notary-client.csr" "notary-client.key"
+
 # Postgresql keys for testing server/client auth
 
 command -v cfssljson  >/dev/null 2>&1 || {
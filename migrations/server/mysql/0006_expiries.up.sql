@@ -0,0 +1,8 @@
+CREATE TABLE `tuf_expiries` (
+	  `id` int(11) NOT NULL AUTO_INCREMENT,
+	  `gun` varchar(255) NOT NULL,
+	  `role` varchar(255) NOT NULL,
+	  `expiry_seconds` bigint NOT NULL,
+	  PRIMARY KEY (`id`),
+	  UNIQUE KEY `gun` (`gun`,`role`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
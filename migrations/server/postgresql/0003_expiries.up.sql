@@ -0,0 +1,7 @@
+CREATE TABLE "tuf_expiries" (
+  "id" serial PRIMARY KEY,
+  "gun" varchar(255) NOT NULL,
+  "role" varchar(255) NOT NULL,
+  "expiry_seconds" bigint NOT NULL,
+  UNIQUE ("gun","role")
+);
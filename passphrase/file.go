@@ -0,0 +1,113 @@
+package passphrase
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/theupdateframework/notary"
+)
+
+// maxPassphraseFileSize is the most that is read from a passphrase file
+const maxPassphraseFileSize = 4 << 10
+
+// ErrPassphraseFileTimeout is returned if a passphrase file, such as a named
+// pipe which nothing writes to, could not be read before the timeout
+type ErrPassphraseFileTimeout struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (err ErrPassphraseFileTimeout) Error() string {
+	return fmt.Sprintf("timed out after %s reading passphrase from %s", err.Timeout, err.Path)
+}
+
+type fileRetriever struct {
+	paths    map[string]string
+	timeout  time.Duration
+	fallback notary.PassRetriever
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// FileRetriever returns a new Retriever which reads the passphrase for a key
+// alias from the file at the path given for the alias in paths, such as a
+// named pipe or a credential exported by systemd's LoadCredential.  The file
+// is read up to EOF, and a trailing newline is dropped.  Each file is only
+// read once, since a named pipe can't be read again, and the passphrase is
+// cached such that subsequent retrievals produce the same passphrase.
+//
+// Opening and reading a file may block, for instance until something writes to
+// a named pipe, so both must finish within timeout.  Passphrases for aliases
+// which have no path are retrieved from fallback.
+func FileRetriever(paths map[string]string, timeout time.Duration, fallback notary.PassRetriever) notary.PassRetriever {
+	fr := &fileRetriever{
+		paths:    paths,
+		timeout:  timeout,
+		fallback: fallback,
+		cache:    make(map[string]string),
+	}
+	return fr.getPassphrase
+}
+
+func (fr *fileRetriever) getPassphrase(keyName, alias string, createNew bool, numAttempts int) (string, bool, error) {
+	path, ok := fr.paths[alias]
+	if !ok {
+		return fr.fallback(keyName, alias, createNew, numAttempts)
+	}
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	pass, ok := fr.cache[path]
+	if !ok {
+		var err error
+		if pass, err = readPassphraseFile(path, fr.timeout); err != nil {
+			return "", true, err
+		}
+		fr.cache[path] = pass
+	}
+	// the passphrase can't change, so give up if it was wrong
+	return pass, numAttempts > 1, nil
+}
+
+// readPassphraseFile reads a passphrase from a file, which may be a named pipe
+// that blocks until it is written to
+func readPassphraseFile(path string, timeout time.Duration) (string, error) {
+	type result struct {
+		contents []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// opening a named pipe blocks until it is opened for writing, so it
+		// must be done in the background as well as the read
+		f, err := os.Open(path)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer f.Close()
+		contents, err := ioutil.ReadAll(io.LimitReader(f, maxPassphraseFileSize))
+		done <- result{contents: contents, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return "", fmt.Errorf("unable to read passphrase from %s: %w", path, res.err)
+		}
+		pass := bytes.TrimSuffix(res.contents, []byte("\n"))
+		pass = bytes.TrimSuffix(pass, []byte("\r"))
+		if len(pass) == 0 {
+			return "", fmt.Errorf("no passphrase in %s", path)
+		}
+		return string(pass), nil
+	case <-time.After(timeout):
+		return "", ErrPassphraseFileTimeout{Path: path, Timeout: timeout}
+	}
+}
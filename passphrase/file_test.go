@@ -0,0 +1,121 @@
+// +build !windows
+
+package passphrase
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeFIFO(t *testing.T, dir, name string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, syscall.Mkfifo(path, 0600))
+	return path
+}
+
+// The passphrase is read from a named pipe once, and then cached
+func TestFileRetrieverReadsFIFOOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-passphrase-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fifo := makeFIFO(t, dir, "root")
+
+	written := make(chan error, 1)
+	go func() {
+		// blocks until the retriever opens the pipe for reading
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			written <- err
+			return
+		}
+		_, err = f.WriteString("fifopassphrase\n")
+		f.Close()
+		written <- err
+	}()
+
+	retriever := FileRetriever(map[string]string{"root": fifo}, 5*time.Second,
+		ConstantRetriever("fallback"))
+
+	pass, giveUp, err := retriever("key", "root", false, 0)
+	require.NoError(t, err)
+	require.False(t, giveUp)
+	require.Equal(t, "fifopassphrase", pass)
+	require.NoError(t, <-written)
+
+	// nothing writes to the pipe again, so this would time out if the pipe
+	// were read again
+	pass, giveUp, err = retriever("key", "root", false, 1)
+	require.NoError(t, err)
+	require.False(t, giveUp)
+	require.Equal(t, "fifopassphrase", pass)
+
+	// the passphrase can't change, so retrying again gives up
+	_, giveUp, err = retriever("key", "root", false, 2)
+	require.NoError(t, err)
+	require.True(t, giveUp)
+
+	// aliases without a file use the fallback
+	pass, _, err = retriever("key", "targets", false, 0)
+	require.NoError(t, err)
+	require.Equal(t, "fallback", pass)
+}
+
+// Reading a named pipe which nothing writes to times out
+func TestFileRetrieverTimesOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-passphrase-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fifo := makeFIFO(t, dir, "root")
+
+	retriever := FileRetriever(map[string]string{"root": fifo}, 50*time.Millisecond,
+		ConstantRetriever("fallback"))
+	_, giveUp, err := retriever("key", "root", false, 0)
+	require.Error(t, err)
+	require.True(t, giveUp)
+	require.Equal(t, ErrPassphraseFileTimeout{Path: fifo, Timeout: 50 * time.Millisecond}, err)
+
+	// unblock the background open, so that it finishes with EOF
+	f, err := os.OpenFile(fifo, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	require.NoError(t, err)
+	f.Close()
+}
+
+// A credential file, such as one exported by systemd's LoadCredential, may
+// or may not end in a newline, but must not be empty
+func TestFileRetrieverReadsCredentialFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-passphrase-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	paths := map[string]string{
+		"root":     filepath.Join(dir, "root"),
+		"targets":  filepath.Join(dir, "targets"),
+		"snapshot": filepath.Join(dir, "snapshot"),
+		"missing":  filepath.Join(dir, "missing"),
+	}
+	require.NoError(t, ioutil.WriteFile(paths["root"], []byte("rootpassphrase"), 0600))
+	require.NoError(t, ioutil.WriteFile(paths["targets"], []byte("targets passphrase\r\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(paths["snapshot"], nil, 0600))
+
+	retriever := FileRetriever(paths, time.Second, ConstantRetriever("fallback"))
+
+	pass, _, err := retriever("key", "root", false, 0)
+	require.NoError(t, err)
+	require.Equal(t, "rootpassphrase", pass)
+
+	pass, _, err = retriever("key", "targets", true, 0)
+	require.NoError(t, err)
+	require.Equal(t, "targets passphrase", pass)
+
+	for _, alias := range []string{"snapshot", "missing"} {
+		_, giveUp, err := retriever("key", alias, false, 0)
+		require.Error(t, err)
+		require.True(t, giveUp)
+	}
+}
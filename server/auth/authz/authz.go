@@ -0,0 +1,69 @@
+// Package authz provides authorization of notary-server's operations by
+// method, GUN and caller identity, once the caller has been authenticated by
+// the server's access controller.  Authorizers are registered by name, so
+// that the server configuration can select one.
+package authz
+
+import (
+	"fmt"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// Request is an operation which a caller asks the server to perform
+type Request struct {
+	// Method is the name of the server operation, such as "UpdateTUF"
+	Method string
+	// GUN is the GUN operated on, which is empty for operations on the whole
+	// server
+	GUN data.GUN
+	// Identity is the authenticated identity of the caller, which is empty
+	// for anonymous callers
+	Identity string
+}
+
+// Authorizer decides whether a caller may perform an operation
+type Authorizer interface {
+	// Authorize returns nil if the request is allowed, and otherwise an error
+	// saying why it is denied
+	Authorize(req Request) error
+}
+
+// InitFunc creates an Authorizer from its configuration options
+type InitFunc func(options map[string]interface{}) (Authorizer, error)
+
+var authorizers = make(map[string]InitFunc)
+
+// Register makes an Authorizer available by name
+func Register(name string, initFunc InitFunc) error {
+	if _, exists := authorizers[name]; exists {
+		return fmt.Errorf("authorizer %q is already registered", name)
+	}
+	authorizers[name] = initFunc
+	return nil
+}
+
+// New creates the Authorizer registered by name with the given options
+func New(name string, options map[string]interface{}) (Authorizer, error) {
+	initFunc, ok := authorizers[name]
+	if !ok {
+		return nil, fmt.Errorf("no authorizer registered with name %q", name)
+	}
+	return initFunc(options)
+}
+
+// ErrDenied is returned when a request is not authorized
+type ErrDenied struct {
+	Request
+}
+
+func (err ErrDenied) Error() string {
+	identity := err.Identity
+	if identity == "" {
+		identity = "anonymous"
+	}
+	if err.GUN == "" {
+		return fmt.Sprintf("%s may not %s", identity, err.Method)
+	}
+	return fmt.Sprintf("%s may not %s %s", identity, err.Method, err.GUN)
+}
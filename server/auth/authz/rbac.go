@@ -0,0 +1,128 @@
+package authz
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/theupdateframework/notary/utils"
+)
+
+// RBACName is the name which the role-based Authorizer is registered as
+const RBACName = "rbac"
+
+// binding grants the methods of roles to callers whose identities match, on
+// the GUNs which match
+type binding struct {
+	identities []string
+	guns       []string
+	roles      []string
+}
+
+// rbac authorizes requests by roles, which are sets of methods, bound to
+// callers' identities for some GUNs.  A request is denied unless a binding
+// allows it.
+type rbac struct {
+	roles    map[string][]string
+	bindings []binding
+}
+
+var _ Authorizer = &rbac{}
+
+// newRBAC creates the role-based Authorizer from options of the form:
+//
+//	{
+//	  "roles": {"publisher": ["GetRole", "GetKey", "UpdateTUF"]},
+//	  "bindings": [{
+//	    "identities": ["ci-*"],
+//	    "guns": ["docker.io/library/*"],
+//	    "roles": ["publisher"]
+//	  }]
+//	}
+//
+// Methods, identities and GUNs may end in a "*" wildcard.  Operations on the
+// whole server have an empty GUN, and anonymous callers an empty identity,
+// so that only the "*" pattern matches them.  Role names are case-insensitive,
+// since the configuration's keys are.
+func newRBAC(options map[string]interface{}) (Authorizer, error) {
+	rawRoles, ok := options["roles"].(map[string]interface{})
+	if !ok || len(rawRoles) == 0 {
+		return nil, fmt.Errorf(`"roles" must map role names to lists of methods`)
+	}
+	a := &rbac{roles: make(map[string][]string, len(rawRoles))}
+	for name, rawMethods := range rawRoles {
+		methods, err := patterns(rawMethods)
+		if err != nil || len(methods) == 0 {
+			return nil, fmt.Errorf("invalid methods for role %q", name)
+		}
+		a.roles[strings.ToLower(name)] = methods
+	}
+
+	rawBindings, ok := options["bindings"].([]interface{})
+	if !ok || len(rawBindings) == 0 {
+		return nil, fmt.Errorf(`"bindings" must be a list of role bindings`)
+	}
+	for i, rawBinding := range rawBindings {
+		fields, ok := rawBinding.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid role binding %d", i)
+		}
+		var b binding
+		var err error
+		if b.identities, err = patterns(fields["identities"]); err != nil || len(b.identities) == 0 {
+			return nil, fmt.Errorf("invalid identities for role binding %d", i)
+		}
+		if b.guns, err = patterns(fields["guns"]); err != nil || len(b.guns) == 0 {
+			return nil, fmt.Errorf("invalid GUNs for role binding %d", i)
+		}
+		if b.roles, err = patterns(fields["roles"]); err != nil || len(b.roles) == 0 {
+			return nil, fmt.Errorf("invalid roles for role binding %d", i)
+		}
+		for j, role := range b.roles {
+			b.roles[j] = strings.ToLower(role)
+			if _, ok := a.roles[b.roles[j]]; !ok {
+				return nil, fmt.Errorf("role binding %d binds undefined role %q", i, role)
+			}
+		}
+		a.bindings = append(a.bindings, b)
+	}
+	return a, nil
+}
+
+// patterns converts a list from the configuration to patterns, each of which
+// may only have a "*" wildcard at its end
+func patterns(raw interface{}) ([]string, error) {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a list")
+	}
+	patterns := make([]string, 0, len(list))
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok || !utils.ValidGUNPattern(pattern) {
+			return nil, fmt.Errorf("invalid pattern %v", item)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Authorize allows the request if a binding matching the caller's identity
+// and the GUN grants a role with the method
+func (a *rbac) Authorize(req Request) error {
+	for _, b := range a.bindings {
+		if !utils.MatchGUNPattern(req.Identity, b.identities) || !utils.MatchGUNPattern(req.GUN.String(), b.guns) {
+			continue
+		}
+		for _, role := range b.roles {
+			if utils.MatchGUNPattern(req.Method, a.roles[role]) {
+				return nil
+			}
+		}
+	}
+	return ErrDenied{Request: req}
+}
+
+// init registers the role-based authorizer
+func init() {
+	Register(RBACName, newRBAC)
+}
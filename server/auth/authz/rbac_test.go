@@ -0,0 +1,81 @@
+package authz
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func rbacOptions(t *testing.T, raw string) map[string]interface{} {
+	var options map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(raw), &options))
+	return options
+}
+
+func TestRBACAllowsAndDeniesMethodsOnGUNs(t *testing.T) {
+	authorizer, err := New(RBACName, rbacOptions(t, `{
+		"roles": {
+			"reader": ["GetRole", "GetRoleByHash", "GetRoleByVersion", "Changefeed"],
+			"Publisher": ["GetKey", "UpdateTUF"],
+			"admin": ["*"]
+		},
+		"bindings": [
+			{"identities": ["*"], "guns": ["docker.io/library/*"], "roles": ["reader"]},
+			{"identities": ["ci-*"], "guns": ["docker.io/library/*"], "roles": ["reader", "publisher"]},
+			{"identities": ["ops"], "guns": ["*"], "roles": ["admin"]}
+		]
+	}`))
+	require.NoError(t, err)
+
+	allowed := []Request{
+		{Method: "GetRole", GUN: "docker.io/library/alpine"},
+		{Method: "GetRole", GUN: "docker.io/library/alpine", Identity: "someone"},
+		{Method: "UpdateTUF", GUN: "docker.io/library/alpine", Identity: "ci-build"},
+		{Method: "DeleteTUF", GUN: "example.com/app", Identity: "ops"},
+		{Method: "GarbageCollect", Identity: "ops"},
+	}
+	denied := []Request{
+		{Method: "GetRole", GUN: "example.com/app"},
+		{Method: "UpdateTUF", GUN: "docker.io/library/alpine"},
+		{Method: "UpdateTUF", GUN: "docker.io/library/alpine", Identity: "someone"},
+		{Method: "UpdateTUF", GUN: "example.com/app", Identity: "ci-build"},
+		{Method: "DeleteTUF", GUN: "docker.io/library/alpine", Identity: "ci-build"},
+		{Method: "GarbageCollect", Identity: "ci-build"},
+	}
+	for _, req := range allowed {
+		require.NoError(t, authorizer.Authorize(req), "expected %v to be allowed", req)
+	}
+	for _, req := range denied {
+		err := authorizer.Authorize(req)
+		require.IsType(t, ErrDenied{}, err, "expected %v to be denied", req)
+		require.Equal(t, req, err.(ErrDenied).Request)
+	}
+}
+
+func TestRBACInvalidOptions(t *testing.T) {
+	invalids := []string{
+		`{}`,
+		`{"roles": {}, "bindings": [{"identities": ["*"], "guns": ["*"], "roles": ["reader"]}]}`,
+		`{"roles": {"reader": []}, "bindings": [{"identities": ["*"], "guns": ["*"], "roles": ["reader"]}]}`,
+		`{"roles": {"reader": ["Get*Role"]}, "bindings": [{"identities": ["*"], "guns": ["*"], "roles": ["reader"]}]}`,
+		`{"roles": {"reader": ["GetRole"]}}`,
+		`{"roles": {"reader": ["GetRole"]}, "bindings": []}`,
+		`{"roles": {"reader": ["GetRole"]}, "bindings": ["reader"]}`,
+		`{"roles": {"reader": ["GetRole"]}, "bindings": [{"guns": ["*"], "roles": ["reader"]}]}`,
+		`{"roles": {"reader": ["GetRole"]}, "bindings": [{"identities": ["*"], "roles": ["reader"]}]}`,
+		`{"roles": {"reader": ["GetRole"]}, "bindings": [{"identities": ["*"], "guns": [""], "roles": ["reader"]}]}`,
+		`{"roles": {"reader": ["GetRole"]}, "bindings": [{"identities": ["*"], "guns": ["*"]}]}`,
+		`{"roles": {"reader": ["GetRole"]}, "bindings": [{"identities": ["*"], "guns": ["*"], "roles": ["writer"]}]}`,
+	}
+	for _, invalid := range invalids {
+		_, err := New(RBACName, rbacOptions(t, invalid))
+		require.Error(t, err, "expected error with %s", invalid)
+	}
+}
+
+func TestNewUnregisteredAuthorizer(t *testing.T) {
+	_, err := New("unregistered", nil)
+	require.Error(t, err)
+	require.Error(t, Register(RBACName, newRBAC))
+}
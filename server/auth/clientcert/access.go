@@ -0,0 +1,112 @@
+// Package clientcert provides an auth.AccessController which allows anyone to
+// pull, but only clients which presented a certificate that was verified
+// during the TLS handshake to push, delete or use the admin endpoints.
+//
+// It is meant to be used with a server TLS configuration which verifies client
+// certificates if they are given, rather than requiring them, so that
+// anonymous clients can still connect to read.
+package clientcert
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/theupdateframework/notary/utils"
+)
+
+// Name is the auth type which this access controller is registered as
+const Name = "client_cert"
+
+// accessController authorizes reads for everyone and writes for clients with a
+// verified certificate, optionally restricted to certain identities
+type accessController struct {
+	// writers are the identities which may write - an identity ending in "*"
+	// matches every identity it is a prefix of.  If there are none, any
+	// verified client may write.
+	writers []string
+}
+
+var _ auth.AccessController = &accessController{}
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	ac := &accessController{}
+	raw, ok := options["writers"]
+	if !ok {
+		return ac, nil
+	}
+	writers, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf(`"writers" must be a list of client certificate identities`)
+	}
+	for _, w := range writers {
+		writer, ok := w.(string)
+		if !ok || !utils.ValidGUNPattern(writer) {
+			return nil, fmt.Errorf("invalid client certificate writer %v", w)
+		}
+		ac.writers = append(ac.writers, writer)
+	}
+	return ac, nil
+}
+
+// Authorized lets any request which only pulls through, and requires a
+// verified client certificate for everything else.  The identity of the
+// client certificate, if any, is added to the context as the user.
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity string
+	verified := req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0
+	if verified {
+		identity = Identity(req.TLS.VerifiedChains[0][0])
+		ctx = auth.WithUser(ctx, auth.UserInfo{Name: identity})
+		ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(ctx, auth.UserNameKey, auth.UserKey))
+	}
+
+	for _, access := range accessRecords {
+		if access.Action == "pull" {
+			continue
+		}
+		if !verified {
+			return nil, fmt.Errorf("a verified client certificate is required to %s", access.Action)
+		}
+		if !ac.mayWrite(identity) {
+			return nil, fmt.Errorf("client certificate %q may not %s", identity, access.Action)
+		}
+	}
+	return ctx, nil
+}
+
+// mayWrite returns whether the client certificate identity is one of the
+// configured writers
+func (ac *accessController) mayWrite(identity string) bool {
+	if len(ac.writers) == 0 {
+		return true
+	}
+	return utils.MatchGUNPattern(identity, ac.writers)
+}
+
+// Identity returns the name a client certificate is identified by: its
+// common name, or if it has none, its first URI or else DNS subject
+// alternative name
+func Identity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// init registers the client certificate auth backend.
+func init() {
+	auth.Register(Name, auth.InitFunc(newAccessController))
+}
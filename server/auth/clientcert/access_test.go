@@ -0,0 +1,112 @@
+package clientcert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func requestContext(cert *x509.Certificate) context.Context {
+	req := httptest.NewRequest("POST", "/v2/docker.io/notary/_trust/tuf/", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return dcontext.WithRequest(context.Background(), req)
+}
+
+func access(actions ...string) []auth.Access {
+	records := make([]auth.Access, 0, len(actions))
+	for _, action := range actions {
+		records = append(records, auth.Access{
+			Resource: auth.Resource{Type: "repository", Name: "docker.io/notary"},
+			Action:   action,
+		})
+	}
+	return records
+}
+
+func TestAuthorized(t *testing.T) {
+	ac, err := auth.GetAccessController(Name, nil)
+	require.NoError(t, err)
+
+	// anyone may pull
+	_, err = ac.Authorized(requestContext(nil), access("pull")...)
+	require.NoError(t, err)
+	_, err = ac.Authorized(requestContext(nil))
+	require.NoError(t, err)
+
+	// only clients with a verified certificate may do anything else
+	for _, actions := range [][]string{{"push", "pull"}, {"*"}} {
+		_, err = ac.Authorized(requestContext(nil), access(actions...)...)
+		require.Error(t, err)
+
+		ctx, err := ac.Authorized(requestContext(&x509.Certificate{Subject: pkix.Name{CommonName: "publisher"}}), access(actions...)...)
+		require.NoError(t, err)
+		require.Equal(t, "publisher", dcontext.GetStringValue(ctx, auth.UserNameKey))
+	}
+}
+
+func TestAuthorizedWriters(t *testing.T) {
+	ac, err := auth.GetAccessController(Name, map[string]interface{}{
+		"writers": []interface{}{"publisher", "ci-*"},
+	})
+	require.NoError(t, err)
+
+	for identity, allowed := range map[string]bool{
+		"publisher":   true,
+		"ci-release":  true,
+		"ci-":         true,
+		"publisher-2": false,
+		"reader":      false,
+	} {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: identity}}
+		_, err := ac.Authorized(requestContext(cert), access("push", "pull")...)
+		if allowed {
+			require.NoError(t, err, identity)
+		} else {
+			require.Error(t, err, identity)
+		}
+		// everyone can still read
+		_, err = ac.Authorized(requestContext(cert), access("pull")...)
+		require.NoError(t, err, identity)
+	}
+}
+
+func TestNewAccessControllerInvalidWriters(t *testing.T) {
+	for _, writers := range []interface{}{
+		"publisher",
+		[]interface{}{""},
+		[]interface{}{1},
+		[]interface{}{"ci-*-release"},
+	} {
+		_, err := auth.GetAccessController(Name, map[string]interface{}{"writers": writers})
+		require.Error(t, err, "%v", writers)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	uri, err := url.Parse("spiffe://example.com/publisher")
+	require.NoError(t, err)
+
+	require.Equal(t, "publisher", Identity(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "publisher"},
+		URIs:     []*url.URL{uri},
+		DNSNames: []string{"publisher.example.com"},
+	}))
+	require.Equal(t, "spiffe://example.com/publisher", Identity(&x509.Certificate{
+		URIs:     []*url.URL{uri},
+		DNSNames: []string{"publisher.example.com"},
+	}))
+	require.Equal(t, "publisher.example.com", Identity(&x509.Certificate{
+		DNSNames: []string{"publisher.example.com"},
+	}))
+	require.Equal(t, "", Identity(&x509.Certificate{}))
+}
@@ -68,6 +68,12 @@ var (
 		Description:    "The user uploaded new TUF data and the server was unable to parse it as multipart/form-data.",
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+	ErrRequestTooLarge = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "REQUEST_TOO_LARGE",
+		Message:        "The body of your request is too large.",
+		Description:    "The user uploaded new TUF data which exceeds the maximum request body size configured on the server.",
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+	})
 	ErrGenericNotFound = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:          "GENERIC_NOT_FOUND",
 		Message:        "You have requested a resource that does not exist.",
@@ -98,5 +104,17 @@ var (
 		Description:    "The parameters provided are not valid.",
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+	ErrNotSupported = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "NOT_SUPPORTED",
+		Message:        "The storage backend does not support this operation.",
+		Description:    "The storage backend does not support this operation.",
+		HTTPStatusCode: http.StatusNotImplemented,
+	})
+	ErrSigningUnavailable = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "SIGNING_UNAVAILABLE",
+		Message:        "The server is too busy signing to sign for this request.",
+		Description:    "The request needed the server to sign metadata, but timed out waiting for other signing operations to finish.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	})
 	ErrUnknown = errcode.ErrorCodeUnknown
 )
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	ctxu "github.com/docker/distribution/context"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+)
+
+// redacted replaces the value of a secret in the served configuration
+const redacted = "xxxxx"
+
+// secretNames are the parts of a configuration key's name which mark its value
+// as a secret
+var secretNames = []string{"password", "passphrase", "secret", "token", "api_key", "private_key", "credential"}
+
+// dsnPassword matches the password of a key=value database connection string,
+// as taken by PostgreSQL
+var dsnPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('[^']*'|\S+)`)
+
+// ConfigHandler returns the effective configuration of the server, as loaded
+// from its configuration file, environment and defaults, with secrets such as
+// passwords, keys and the credentials in database URLs redacted.
+func ConfigHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	logger := ctxu.GetLogger(ctx)
+	settings, ok := ctx.Value(notary.CtxKeyServerConfig).(map[string]interface{})
+	if !ok {
+		logger.Errorf("%d GET unable to retrieve server configuration", http.StatusInternalServerError)
+		return errors.ErrUnknown.WithDetail("server configuration is not available")
+	}
+	out, err := json.Marshal(RedactConfig(settings))
+	if err != nil {
+		logger.Errorf("%d GET could not json.Marshal server configuration", http.StatusInternalServerError)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+	return nil
+}
+
+// RedactConfig returns a copy of the configuration settings in which the
+// values of secrets are replaced, so that they can be shown to an admin.  A
+// secret which is not set is left empty, so that it can be seen not to be.
+func RedactConfig(settings map[string]interface{}) map[string]interface{} {
+	return redactValue("", settings).(map[string]interface{})
+}
+
+func redactValue(name string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			copied[key] = redactValue(key, val)
+		}
+		return copied
+	case map[interface{}]interface{}:
+		// as read from YAML, which can't be marshalled to JSON as it is
+		copied := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			copied[fmt.Sprint(key)] = redactValue(fmt.Sprint(key), val)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, val := range v {
+			copied[i] = redactValue(name, val)
+		}
+		return copied
+	}
+	if isSecretName(name) {
+		if value == nil || value == "" {
+			return value
+		}
+		return redacted
+	}
+	if s, ok := value.(string); ok {
+		if strings.Contains(s, "PRIVATE KEY-----") {
+			return redacted
+		}
+		if strings.HasSuffix(strings.ToLower(name), "url") {
+			return redactURL(s)
+		}
+	}
+	return value
+}
+
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL redacts the password in a URL or database connection string,
+// which may be a URL, a MySQL DSN such as user:password@tcp(host)/db, or a
+// PostgreSQL key=value string
+func redactURL(s string) string {
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return redacted
+		}
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+		}
+		query := u.Query()
+		for key := range query {
+			if isSecretName(key) {
+				query.Set(key, redacted)
+				u.RawQuery = query.Encode()
+			}
+		}
+		return u.String()
+	}
+	if at := strings.LastIndex(s, "@"); at >= 0 {
+		if colon := strings.Index(s[:at], ":"); colon >= 0 {
+			return s[:colon+1] + redacted + s[at:]
+		}
+		return s
+	}
+	return dsnPassword.ReplaceAllString(s, "${1}"+redacted)
+}
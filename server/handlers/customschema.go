@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/validation"
+	"github.com/theupdateframework/notary/utils"
+)
+
+// CustomSchemaRule requires the custom metadata of the targets of the GUNs
+// matching its patterns to conform to a schema
+type CustomSchemaRule struct {
+	// GUNs are the GUNs the rule applies to, each either an exact GUN or a
+	// prefix followed by "*"
+	GUNs   []string
+	Schema *CustomSchema
+}
+
+// customSchemaFor returns the schema of the first rule which applies to the
+// GUN, or nil if none do
+func customSchemaFor(gun data.GUN, rules []CustomSchemaRule) *CustomSchema {
+	for _, rule := range rules {
+		if utils.MatchGUNPattern(gun.String(), rule.GUNs) {
+			return rule.Schema
+		}
+	}
+	return nil
+}
+
+// CustomSchema is a JSON schema for the custom metadata of targets.  Only the
+// subset of JSON Schema needed to describe such metadata is supported: the
+// "type", "enum", "properties", "required", "additionalProperties", "items",
+// "minItems", "maxItems", "pattern", "minLength", "maxLength", "format" (only
+// "uri"), "minimum" and "maximum" keywords.  Annotations such as "title" and
+// "description" are ignored, and any other keyword is refused, so that a
+// schema is never silently enforced less strictly than it reads.
+type CustomSchema struct {
+	types                []string
+	enum                 []interface{}
+	properties           map[string]*CustomSchema
+	required             []string
+	additionalProperties *CustomSchema
+	noAdditional         bool
+	items                *CustomSchema
+	minItems, maxItems   *int
+	pattern              *regexp.Regexp
+	minLength, maxLength *int
+	format               string
+	minimum, maximum     *float64
+}
+
+var schemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true,
+	"description": true, "default": true, "examples": true,
+}
+
+// ParseCustomSchema parses a JSON schema for the custom metadata of targets
+func ParseCustomSchema(raw []byte) (*CustomSchema, error) {
+	var doc interface{}
+	if err := stdjson.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %v", err)
+	}
+	return parseSchema(doc, "#")
+}
+
+func parseSchema(doc interface{}, at string) (*CustomSchema, error) {
+	fields, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema at %s must be an object", at)
+	}
+	s := &CustomSchema{}
+	for keyword, value := range fields {
+		var err error
+		switch keyword {
+		case "type":
+			err = s.parseTypes(value)
+		case "enum":
+			values, ok := value.([]interface{})
+			if !ok || len(values) == 0 {
+				err = fmt.Errorf("must be a non-empty array")
+			}
+			s.enum = values
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an object")
+				break
+			}
+			s.properties = make(map[string]*CustomSchema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = parseSchema(prop, at+"/properties/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			names, ok := value.([]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an array of strings")
+				break
+			}
+			for _, name := range names {
+				str, ok := name.(string)
+				if !ok {
+					err = fmt.Errorf("must be an array of strings")
+					break
+				}
+				s.required = append(s.required, str)
+			}
+		case "additionalProperties":
+			if allowed, ok := value.(bool); ok {
+				s.noAdditional = !allowed
+			} else if s.additionalProperties, err = parseSchema(value, at+"/additionalProperties"); err != nil {
+				return nil, err
+			}
+		case "items":
+			if s.items, err = parseSchema(value, at+"/items"); err != nil {
+				return nil, err
+			}
+		case "minItems":
+			s.minItems, err = parseCount(value)
+		case "maxItems":
+			s.maxItems, err = parseCount(value)
+		case "minLength":
+			s.minLength, err = parseCount(value)
+		case "maxLength":
+			s.maxLength, err = parseCount(value)
+		case "pattern":
+			str, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("must be a string")
+				break
+			}
+			s.pattern, err = regexp.Compile(str)
+		case "format":
+			if value != "uri" {
+				err = fmt.Errorf("only the \"uri\" format is supported")
+			}
+			s.format = "uri"
+		case "minimum", "maximum":
+			number, ok := value.(float64)
+			if !ok {
+				err = fmt.Errorf("must be a number")
+			} else if keyword == "minimum" {
+				s.minimum = &number
+			} else {
+				s.maximum = &number
+			}
+		default:
+			if !schemaAnnotations[keyword] {
+				err = fmt.Errorf("is not supported")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("schema keyword %q at %s %v", keyword, at, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *CustomSchema) parseTypes(value interface{}) error {
+	switch t := value.(type) {
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			str, ok := name.(string)
+			if !ok {
+				return fmt.Errorf("must be a string or an array of strings")
+			}
+			s.types = append(s.types, str)
+		}
+	default:
+		return fmt.Errorf("must be a string or an array of strings")
+	}
+	for _, name := range s.types {
+		if !schemaTypes[name] {
+			return fmt.Errorf("has unknown type %q", name)
+		}
+	}
+	return nil
+}
+
+func parseCount(value interface{}) (*int, error) {
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != float64(int(number)) {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	count := int(number)
+	return &count, nil
+}
+
+// typeOf returns the JSON schema type of a value decoded from JSON
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Validate checks that the custom metadata, as JSON, conforms to the schema
+func (s *CustomSchema) Validate(custom []byte) error {
+	var value interface{}
+	if len(custom) > 0 {
+		if err := stdjson.Unmarshal(custom, &value); err != nil {
+			return err
+		}
+	}
+	return s.validate(value, "custom")
+}
+
+func (s *CustomSchema) validate(value interface{}, at string) error {
+	if len(s.types) > 0 {
+		actual, matched := typeOf(value), false
+		for _, t := range s.types {
+			// integers are also numbers
+			if t == actual || t == "number" && actual == "integer" {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s must be of type %s, not %s", at, strings.Join(s.types, " or "), actual)
+		}
+	}
+	if len(s.enum) > 0 {
+		matched := false
+		for _, allowed := range s.enum {
+			if reflect.DeepEqual(allowed, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s must be one of the values the schema enumerates", at)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s is missing the required property %q", at, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.properties[name]
+			switch {
+			case ok:
+			case s.noAdditional:
+				return fmt.Errorf("%s has the property %q, which the schema does not allow", at, name)
+			case s.additionalProperties != nil:
+				prop = s.additionalProperties
+			default:
+				continue
+			}
+			if err := prop.validate(v[name], at+"."+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			return fmt.Errorf("%s must have at least %d items", at, *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			return fmt.Errorf("%s must have at most %d items", at, *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				if err := s.items.validate(item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.minLength != nil && length < *s.minLength {
+			return fmt.Errorf("%s must be at least %d characters long", at, *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			return fmt.Errorf("%s must be at most %d characters long", at, *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%s must match the pattern %q", at, s.pattern.String())
+		}
+		if s.format == "uri" {
+			if u, err := url.Parse(v); err != nil || !u.IsAbs() {
+				return fmt.Errorf("%s must be an absolute URI", at)
+			}
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			return fmt.Errorf("%s must be at least %v", at, *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			return fmt.Errorf("%s must be at most %v", at, *s.maximum)
+		}
+	}
+	return nil
+}
+
+// enforceCustomSchema rejects an update which adds or changes a target whose
+// custom metadata doesn't conform to the schema.  Targets which are
+// unchanged from those currently stored are not checked again, so that a
+// schema can be introduced without every existing target having to conform
+// before the role can be updated.  Malformed targets are left for
+// validateUpdate to reject.
+func enforceCustomSchema(schema *CustomSchema, gun data.GUN, updates []storage.MetaUpdate, store storage.MetaStore) error {
+	for _, update := range updates {
+		if update.Role != data.CanonicalTargetsRole && !data.IsDelegation(update.Role) {
+			continue
+		}
+		targets := &data.SignedTargets{}
+		if err := json.Unmarshal(update.Data, targets); err != nil {
+			continue
+		}
+		previous := &data.SignedTargets{}
+		_, currentJSON, err := store.GetCurrent(gun, update.Role)
+		if err == nil {
+			json.Unmarshal(currentJSON, previous)
+		} else if _, ok := err.(storage.ErrNotFound); !ok {
+			return err
+		}
+
+		names := make([]string, 0, len(targets.Signed.Targets))
+		for name := range targets.Signed.Targets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			meta := targets.Signed.Targets[name]
+			if old, ok := previous.Signed.Targets[name]; ok && old.Equals(meta) {
+				continue
+			}
+			var custom []byte
+			if meta.Custom != nil {
+				custom = *meta.Custom
+			}
+			if err := schema.Validate(custom); err != nil {
+				return validation.ErrBadTargets{
+					Msg: fmt.Sprintf("the custom metadata of target %s in %s does not conform to the schema: %v", name, update.Role, err)}
+			}
+		}
+	}
+	return nil
+}
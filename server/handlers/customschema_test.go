@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/storage"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/testutils"
+	"github.com/theupdateframework/notary/tuf/validation"
+)
+
+const sbomSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "Targets must link to their SBOM",
+	"type": "object",
+	"required": ["sbom"],
+	"properties": {
+		"sbom": {"type": "string", "format": "uri"},
+		"tier": {"enum": ["gold", "silver"]},
+		"tags": {"type": "array", "items": {"type": "string", "minLength": 1}, "maxItems": 2},
+		"size": {"type": "integer", "minimum": 0}
+	},
+	"additionalProperties": false
+}`
+
+func TestParseCustomSchema(t *testing.T) {
+	_, err := ParseCustomSchema([]byte(sbomSchema))
+	require.NoError(t, err)
+
+	for _, invalid := range []string{
+		`not json`,
+		`[]`,
+		`{"type": "document"}`,
+		`{"type": 1}`,
+		`{"properties": {"sbom": {"pattern": "("}}}`,
+		`{"properties": {"sbom": {"format": "email"}}}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"required": "sbom"}`,
+		`{"minLength": -1}`,
+		`{"enum": []}`,
+	} {
+		_, err := ParseCustomSchema([]byte(invalid))
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestCustomSchemaValidate(t *testing.T) {
+	schema, err := ParseCustomSchema([]byte(sbomSchema))
+	require.NoError(t, err)
+
+	for _, valid := range []string{
+		`{"sbom": "https://sbom.example.com/app.spdx.json"}`,
+		`{"sbom": "https://sbom.example.com/app.spdx.json", "tier": "gold", "tags": ["a", "b"], "size": 3}`,
+	} {
+		require.NoError(t, schema.Validate([]byte(valid)), valid)
+	}
+
+	for invalid, reason := range map[string]string{
+		``:                           "must be of type object, not null",
+		`"https://sbom.example.com"`: "must be of type object, not string",
+		`{}`:                         `missing the required property "sbom"`,
+		`{"sbom": 1}`:                "custom.sbom must be of type string",
+		`{"sbom": "app.spdx.json"}`:  "custom.sbom must be an absolute URI",
+		`{"sbom": "https://sbom.example.com", "tier": "bronze"}`:        "custom.tier must be one of",
+		`{"sbom": "https://sbom.example.com", "tags": ["a", ""]}`:       "custom.tags[1] must be at least 1 characters long",
+		`{"sbom": "https://sbom.example.com", "tags": ["a", "b", "c"]}`: "custom.tags must have at most 2 items",
+		`{"sbom": "https://sbom.example.com", "size": 1.5}`:             "custom.size must be of type integer",
+		`{"sbom": "https://sbom.example.com", "size": -1}`:              "custom.size must be at least 0",
+		`{"sbom": "https://sbom.example.com", "owner": "me"}`:           `property "owner", which the schema does not allow`,
+	} {
+		err := schema.Validate([]byte(invalid))
+		require.Error(t, err, invalid)
+		require.Contains(t, err.Error(), reason)
+	}
+}
+
+// postCustomSchemaUpdate posts the metadata for the given roles of a repo to
+// the atomic update handler, with custom metadata of the targets of the given
+// GUN patterns required to conform to the schema
+func postCustomSchemaUpdate(t *testing.T, state handlerState, gun data.GUN, rules []CustomSchemaRule, metas map[data.RoleName][]byte) error {
+	parts := make(map[string][]byte, len(metas))
+	for role, meta := range metas {
+		parts[role.String()] = meta
+	}
+	req, err := store.NewMultiPartMetaRequest("", parts)
+	require.NoError(t, err)
+	ctx := context.WithValue(getContext(state), notary.CtxKeyCustomSchemas, rules)
+	return atomicUpdateHandler(ctx, httptest.NewRecorder(), req, map[string]string{"gun": gun.String()})
+}
+
+// addCustomTarget adds a target with the given custom metadata to the repo,
+// and returns the signed root and targets
+func addCustomTarget(t *testing.T, repo *tuf.Repo, name, custom string) (root, targets []byte) {
+	meta := data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}
+	if custom != "" {
+		raw := json.RawMessage(custom)
+		meta.Custom = &raw
+	}
+	_, err := repo.AddTargets(data.CanonicalTargetsRole, data.Files{name: meta})
+	require.NoError(t, err)
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	root, targets, _, _, err = testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	return root, targets
+}
+
+func TestCustomSchemaEnforced(t *testing.T) {
+	var gun data.GUN = "docker.io/library/alpine"
+	schema, err := ParseCustomSchema([]byte(sbomSchema))
+	require.NoError(t, err)
+	rules := []CustomSchemaRule{{GUNs: []string{"docker.io/library/*"}, Schema: schema}}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	state := handlerState{
+		store:  storage.NewMemStorage(),
+		crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole),
+	}
+
+	// a target without custom metadata, when the schema requires it
+	rs, tgs := addCustomTarget(t, repo, "legacy", "")
+	err = postCustomSchemaUpdate(t, state, gun, rules, map[data.RoleName][]byte{
+		data.CanonicalRootRole:    rs,
+		data.CanonicalTargetsRole: tgs,
+	})
+	requireInvalidUpdate(t, err, validation.ErrBadTargets{})
+
+	// is accepted for a GUN which doesn't match
+	require.NoError(t, postCustomSchemaUpdate(t, state, gun, []CustomSchemaRule{
+		{GUNs: []string{"docker.io/other/*"}, Schema: schema},
+	}, map[data.RoleName][]byte{
+		data.CanonicalRootRole:    rs,
+		data.CanonicalTargetsRole: tgs,
+	}))
+
+	// the existing target isn't checked again when another is added, but
+	// the new target is
+	repo.Targets[data.CanonicalTargetsRole].Signed.Version++
+	_, tgs = addCustomTarget(t, repo, "app", `{"sbom": "app.spdx.json"}`)
+	err = postCustomSchemaUpdate(t, state, gun, rules, map[data.RoleName][]byte{data.CanonicalTargetsRole: tgs})
+	requireInvalidUpdate(t, err, validation.ErrBadTargets{})
+
+	_, tgs = addCustomTarget(t, repo, "app", `{"sbom": "https://sbom.example.com/app.spdx.json"}`)
+	require.NoError(t, postCustomSchemaUpdate(t, state, gun, rules, map[data.RoleName][]byte{data.CanonicalTargetsRole: tgs}))
+}
@@ -9,6 +9,7 @@ import (
 	"mime"
 	"net/http"
 	"strings"
+	"time"
 
 	ctxu "github.com/docker/distribution/context"
 	"github.com/gorilla/mux"
@@ -16,9 +17,11 @@ import (
 
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/signlimit"
 	"github.com/theupdateframework/notary/server/snapshot"
 	"github.com/theupdateframework/notary/server/storage"
 	"github.com/theupdateframework/notary/server/timestamp"
+	"github.com/theupdateframework/notary/server/webhook"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 	"github.com/theupdateframework/notary/tuf/validation"
@@ -55,6 +58,10 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		logger.Error("500 POST unable to retrieve storage")
 		return errors.ErrNoStorage.WithDetail(nil)
 	}
+	// the update is validated against, and the snapshot and timestamp are
+	// generated from, the metadata it will be written after, which a read
+	// replica may not have yet
+	store = storage.Primary(store)
 	cryptoServiceVal := ctx.Value(notary.CtxKeyCryptoSvc)
 	cryptoService, ok := cryptoServiceVal.(signed.CryptoService)
 	if !ok {
@@ -62,6 +69,12 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return errors.ErrNoCryptoService.WithDetail(nil)
 	}
 
+	body, err := limitRequestBody(ctx, w, r)
+	if err != nil {
+		logger.Infof("413 POST request body of %d bytes is too large", r.ContentLength)
+		return err
+	}
+
 	reader, err := r.MultipartReader()
 	if err != nil {
 		logger.Info("400 POST unable to parse TUF data")
@@ -73,6 +86,14 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			if body.exceeded() {
+				logger.Infof("413 POST request body larger than %d bytes", body.max)
+				return errors.ErrRequestTooLarge.WithDetail(nil)
+			}
+			logger.Infof("400 POST unable to read TUF data: %s", err)
+			return errors.ErrMalformedUpload.WithDetail(nil)
+		}
 		_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
 		if err != nil {
 			logger.Infof("400 POST error parsing Content-Disposition header: %s", err)
@@ -92,6 +113,10 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		dec := json.NewDecoder(io.TeeReader(part, inBuf))
 		err = dec.Decode(meta)
 		if err != nil {
+			if body.exceeded() {
+				logger.Infof("413 POST request body larger than %d bytes", body.max)
+				return errors.ErrRequestTooLarge.WithDetail(nil)
+			}
 			logger.Info("400 POST malformed update JSON")
 			return errors.ErrMalformedJSON.WithDetail(nil)
 		}
@@ -102,7 +127,31 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 			Data:    inBuf.Bytes(),
 		})
 	}
-	updates, err = validateUpdate(cryptoService, gun, updates, store)
+	// the same publish may be submitted more than once, such as by two clients
+	// publishing identical metadata at the same time, in which case there is
+	// nothing to do
+	submitted := updates
+	if isDuplicateUpdate(store, gun, submitted) {
+		logger.Info("200 POST update is identical to the current metadata")
+		return nil
+	}
+	if patterns, _ := ctx.Value(notary.CtxKeyServerManagedSnapshot).([]string); requiresServerManagedSnapshot(gun, patterns) {
+		err = enforceServerManagedSnapshot(cryptoService, gun, updates)
+	}
+	if err == nil {
+		rules, _ := ctx.Value(notary.CtxKeyCustomSchemas).([]CustomSchemaRule)
+		if schema := customSchemaFor(gun, rules); schema != nil {
+			err = enforceCustomSchema(schema, gun, updates, store)
+		}
+	}
+	if err == nil {
+		authority, _ := ctx.Value(notary.CtxKeyTimestampAuthority).(*timestamp.Authority)
+		updates, err = validateUpdate(cryptoService, gun, updates, store, authority)
+	}
+	if _, ok := err.(signlimit.ErrQueueTimeout); ok {
+		logger.Errorf("503 POST %v", err)
+		return errors.ErrSigningUnavailable.WithDetail(nil)
+	}
 	if err != nil {
 		serializable, serializableError := validation.NewSerializableError(err)
 		if serializableError != nil {
@@ -115,6 +164,11 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 	if err != nil {
 		// If we have an old version error, surface to user with error code
 		if _, ok := err.(storage.ErrOldVersion); ok {
+			// an identical update may have been applied since we checked
+			if isDuplicateUpdate(store, gun, submitted) {
+				logger.Info("200 POST update is identical to the current metadata")
+				return nil
+			}
 			logger.Info("400 POST old version error")
 			return errors.ErrOldVersion.WithDetail(err)
 		}
@@ -124,10 +178,67 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 
 	logTS(logger, gun.String(), updates)
+	countPublish(gun)
+
+	// webhooks are delivered in the background, and failing to deliver them
+	// doesn't fail the update, which has already been applied
+	notifier, _ := ctx.Value(notary.CtxKeyWebhooks).(*webhook.Notifier)
+	notifier.Notify(updateEvent(gun, updates))
 
 	return nil
 }
 
+// limitedBody counts the bytes read from a request body, so that a failure to
+// read past the limit of the http.MaxBytesReader wrapping it can be told apart
+// from a malformed upload
+type limitedBody struct {
+	io.ReadCloser
+	max  int64
+	read int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// exceeded returns whether more than the maximum number of bytes were read
+func (l *limitedBody) exceeded() bool {
+	return l.read > l.max
+}
+
+// limitRequestBody caps the size of the request body at the maximum configured
+// in the context, or notary.DefaultMaxRequestBodySize if none is configured.
+// It errors immediately if the request declares a larger content length.
+func limitRequestBody(ctx context.Context, w http.ResponseWriter, r *http.Request) (*limitedBody, error) {
+	maxSize := notary.DefaultMaxRequestBodySize
+	if size, ok := ctx.Value(notary.CtxKeyMaxRequestBodySize).(int64); ok && size > 0 {
+		maxSize = size
+	}
+	if r.ContentLength > maxSize {
+		return nil, errors.ErrRequestTooLarge.WithDetail(nil)
+	}
+	body := &limitedBody{ReadCloser: r.Body, max: maxSize}
+	r.Body = http.MaxBytesReader(w, body, maxSize)
+	return body, nil
+}
+
+// isDuplicateUpdate returns whether the data of every update is byte-identical
+// to that of the current version of its role
+func isDuplicateUpdate(store storage.MetaStore, gun data.GUN, updates []storage.MetaUpdate) bool {
+	if len(updates) == 0 {
+		return false
+	}
+	for _, update := range updates {
+		_, current, err := store.GetCurrent(gun, update.Role)
+		if err != nil || !bytes.Equal(current, update.Data) {
+			return false
+		}
+	}
+	return true
+}
+
 // logTS logs the timestamp update at Info level
 func logTS(logger ctxu.Logger, gun string, updates []storage.MetaUpdate) {
 	for _, update := range updates {
@@ -140,6 +251,20 @@ func logTS(logger ctxu.Logger, gun string, updates []storage.MetaUpdate) {
 	}
 }
 
+// updateEvent describes the new versions of the roles in an update for webhooks
+func updateEvent(gun data.GUN, updates []storage.MetaUpdate) webhook.Event {
+	event := webhook.Event{GUN: gun, Action: webhook.ActionUpdate, Timestamp: time.Now().UTC()}
+	for _, update := range updates {
+		checksum := sha256.Sum256(update.Data)
+		event.Roles = append(event.Roles, webhook.RoleUpdate{
+			Role:    update.Role,
+			Version: update.Version,
+			SHA256:  hex.EncodeToString(checksum[:]),
+		})
+	}
+	return event
+}
+
 // GetHandler returns the json for a specified role and GUN.
 func GetHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	defer r.Body.Close()
@@ -165,6 +290,10 @@ func getHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, var
 	lastModified, output, err := getRole(ctx, store, gun, data.RoleName(tufRole), checksum, version)
 	if err != nil {
 		logger.Infof("404 GET %s role", tufRole)
+		if data.RoleName(tufRole) == data.CanonicalRootRole && checksum == "" && version == "" {
+			// without a root the GUN does not exist at all
+			return signNotFound(ctx, r, gun, err)
+		}
 		return err
 	}
 	if lastModified != nil {
@@ -198,11 +327,15 @@ func DeleteHandler(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		return errors.ErrUnknown.WithDetail(err)
 	}
 	logger.Infof("trust data deleted for %s", gun)
+
+	notifier, _ := ctx.Value(notary.CtxKeyWebhooks).(*webhook.Notifier)
+	notifier.Notify(webhook.Event{GUN: gun, Action: webhook.ActionDeletion, Timestamp: time.Now().UTC()})
 	return nil
 }
 
 // GetKeyHandler returns a public key for the specified role, creating a new key-pair
-// it if it doesn't yet exist
+// it if it doesn't yet exist.  The optional "algorithm" query parameter chooses the
+// algorithm of a newly created key in place of the server's configured one.
 func GetKeyHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	defer r.Body.Close()
 	vars := mux.Vars(r)
@@ -311,6 +444,23 @@ func setupKeyHandler(ctx context.Context, w http.ResponseWriter, r *http.Request
 		logger.Errorf("500 %s key algorithm not configured", actionVerb)
 		return "", "", "", nil, nil, errors.ErrNoKeyAlgorithm.WithDetail(nil)
 	}
+	// the client may ask for a specific algorithm, which is only used if a
+	// new key has to be generated.  RSA keys can't be generated, only imported.
+	// It is only read from the query, never from the request body.
+	var requested string
+	if r.URL != nil {
+		requested = r.URL.Query().Get("algorithm")
+	}
+	if requested != "" {
+		switch requested {
+		case data.ECDSAKey, data.ED25519Key:
+			keyAlgo = requested
+		default:
+			logger.Infof("400 %s unsupported key algorithm %s", actionVerb, requested)
+			return "", "", "", nil, nil, errors.ErrInvalidParams.WithDetail(
+				"unsupported key algorithm: " + requested)
+		}
+	}
 
 	return role, gun, keyAlgo, store, crypto, nil
 }
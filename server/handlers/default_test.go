@@ -2,23 +2,34 @@ package handlers
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	ctxu "github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/signlimit"
 	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/server/webhook"
 	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 	"github.com/theupdateframework/notary/tuf/testutils"
@@ -197,6 +208,38 @@ func TestKeyHandlersInvalidKeyAlgo(t *testing.T) {
 	}
 }
 
+// Getting or rotating the key uses the algorithm requested by the client in
+// place of the configured one, and rejects unsupported algorithms
+func TestKeyHandlersRequestedKeyAlgo(t *testing.T) {
+	roles := []string{data.CanonicalTimestampRole.String(), data.CanonicalSnapshotRole.String()}
+	for _, keyHandler := range []simplerHandler{getKeyHandler, rotateKeyHandler} {
+		for _, role := range roles {
+			vars := map[string]string{"gun": "gun", "tufRole": role}
+			state := defaultState()
+			// the ED25519 crypto service cannot generate ECDSA keys, so this
+			// only succeeds if the requested algorithm is used
+			state.keyAlgo = data.ECDSAKey
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/?algorithm="+data.ED25519Key, nil)
+			require.NoError(t, keyHandler(getContext(state), recorder, req, vars))
+			key, err := data.UnmarshalPublicKey(recorder.Body.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, data.ED25519Key, key.Algorithm())
+
+			req = httptest.NewRequest("GET", "/?algorithm=notactuallyakeyalgorithm", nil)
+			err = keyHandler(getContext(state), httptest.NewRecorder(), req, vars)
+			requireErrorCode(t, errors.ErrInvalidParams, err)
+
+			// the algorithm is only read from the query, not from a form body
+			req = httptest.NewRequest("POST", "/", strings.NewReader("algorithm=notactuallyakeyalgorithm"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			err = keyHandler(getContext(defaultState()), httptest.NewRecorder(), req, vars)
+			require.NoError(t, err)
+		}
+	}
+}
+
 // Rotating the key for a valid role and gun succeeds
 func TestRotateKeyHandlerSuccessfulRotation(t *testing.T) {
 	state := defaultState()
@@ -412,6 +455,95 @@ func TestAtomicUpdateValidationFailurePropagated(t *testing.T) {
 	require.IsType(t, validation.ErrBadHierarchy{}, serializable.Error)
 }
 
+// busyCryptoService is a crypto service whose signing operations always time
+// out waiting for others to finish
+type busyCryptoService struct {
+	signed.CryptoService
+}
+
+func (cs busyCryptoService) GetPrivateKey(keyID string) (data.PrivateKey, data.RoleName, error) {
+	privKey, role, err := cs.CryptoService.GetPrivateKey(keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	return busyPrivateKey{privKey}, role, nil
+}
+
+type busyPrivateKey struct {
+	data.PrivateKey
+}
+
+func (busyPrivateKey) Sign(_ io.Reader, _ []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return nil, signlimit.ErrQueueTimeout{Limit: 1, Timeout: time.Second}
+}
+
+// an update which needs the server to sign, but for which the server times out
+// waiting to sign, is rejected as the server being unavailable
+func TestAtomicUpdateSigningQueueTimeout(t *testing.T) {
+	metaStore := storage.NewMemStorage()
+	var gun data.GUN = "testGUN"
+	vars := map[string]string{"gun": gun.String()}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+
+	state := handlerState{store: metaStore, crypto: busyCryptoService{mustCopyKeys(t, cs, data.CanonicalTimestampRole)}}
+
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+
+	req, err := store.NewMultiPartMetaRequest("", map[string][]byte{
+		data.CanonicalRootRole.String():     rs,
+		data.CanonicalTargetsRole.String():  tgs,
+		data.CanonicalSnapshotRole.String(): sns,
+	})
+	require.NoError(t, err)
+
+	err = atomicUpdateHandler(getContext(state), httptest.NewRecorder(), req, vars)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrSigningUnavailable, errorObj.Code)
+	require.Equal(t, http.StatusServiceUnavailable, errorObj.Code.Descriptor().HTTPStatusCode)
+
+	// nothing was written
+	_, _, err = metaStore.GetCurrent(gun, data.CanonicalRootRole)
+	require.IsType(t, storage.ErrNotFound{}, err)
+}
+
+// a timestamp which must be re-signed, but for which the server times out
+// waiting to sign, is not served because the server is unavailable
+func TestGetHandlerTimestampSigningQueueTimeout(t *testing.T) {
+	metaStore := storage.NewMemStorage()
+	repo, cs, err := testutils.EmptyRepo("gun")
+	require.NoError(t, err)
+
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	ts, err = repo.SignTimestamp(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	rs, tgs, sns, tss, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	require.NoError(t, metaStore.UpdateMany("gun", []storage.MetaUpdate{
+		{Role: data.CanonicalRootRole, Version: 1, Data: rs},
+		{Role: data.CanonicalTargetsRole, Version: 1, Data: tgs},
+		{Role: data.CanonicalSnapshotRole, Version: 1, Data: sns},
+		{Role: data.CanonicalTimestampRole, Version: 1, Data: tss},
+	}))
+
+	ctx := getContext(handlerState{store: metaStore, crypto: busyCryptoService{cs}})
+	vars := map[string]string{"gun": "gun", "tufRole": data.CanonicalTimestampRole.String()}
+	req := &http.Request{Body: ioutil.NopCloser(bytes.NewBuffer(nil))}
+
+	err = getHandler(ctx, httptest.NewRecorder(), req, vars)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrSigningUnavailable, errorObj.Code)
+}
+
 type failStore struct {
 	storage.MetaStore
 }
@@ -496,3 +628,357 @@ func TestAtomicUpdateVersionErrorPropagated(t *testing.T) {
 	require.Equal(t, errors.ErrOldVersion, errorObj.Code)
 	require.Equal(t, storage.ErrOldVersion{}, errorObj.Detail)
 }
+
+// racedStore applies another update, by calling race, just before applying
+// the first update it is given, as if another request had got there first
+type racedStore struct {
+	storage.MetaStore
+	race func()
+	once sync.Once
+}
+
+func (s *racedStore) UpdateMany(gun data.GUN, updates []storage.MetaUpdate) error {
+	s.once.Do(s.race)
+	return s.MetaStore.UpdateMany(gun, updates)
+}
+
+// identical updates submitted at the same time all succeed, and only the first
+// to be applied changes the stored metadata
+func TestAtomicUpdateIdenticalConcurrentUpdates(t *testing.T) {
+	metaStore := storage.NewMemStorage()
+	var gun data.GUN = "testGUN"
+	vars := map[string]string{"gun": gun.String()}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	state := handlerState{store: metaStore, crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole)}
+
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	update := map[string][]byte{
+		data.CanonicalRootRole.String():     rs,
+		data.CanonicalTargetsRole.String():  tgs,
+		data.CanonicalSnapshotRole.String(): sns,
+	}
+	submit := func(state handlerState) error {
+		req, err := store.NewMultiPartMetaRequest("", update)
+		require.NoError(t, err)
+		return atomicUpdateHandler(getContext(state), httptest.NewRecorder(), req, vars)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = submit(state)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	_, timestamp, err := metaStore.GetCurrent(gun, data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	storedTS := &data.SignedTimestamp{}
+	require.NoError(t, json.Unmarshal(timestamp, storedTS))
+	require.Equal(t, 1, storedTS.Signed.Version)
+	for role, meta := range update {
+		_, current, err := metaStore.GetCurrent(gun, data.RoleName(role))
+		require.NoError(t, err)
+		require.Equal(t, meta, current)
+	}
+
+	// an identical update which is applied after this one is checked for being
+	// a duplicate, but before this one is applied, still succeeds
+	racedGUN := data.GUN("racedGUN")
+	racedVars := map[string]string{"gun": racedGUN.String()}
+	repo, cs, err = testutils.EmptyRepo(racedGUN)
+	require.NoError(t, err)
+	r, tg, sn, ts, err = testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err = testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	update = map[string][]byte{
+		data.CanonicalRootRole.String():     rs,
+		data.CanonicalTargetsRole.String():  tgs,
+		data.CanonicalSnapshotRole.String(): sns,
+	}
+	crypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
+	raced := &racedStore{MetaStore: metaStore}
+	raced.race = func() {
+		req, err := store.NewMultiPartMetaRequest("", update)
+		require.NoError(t, err)
+		require.NoError(t, atomicUpdateHandler(getContext(handlerState{store: metaStore, crypto: crypto}), httptest.NewRecorder(), req, racedVars))
+	}
+	req, err := store.NewMultiPartMetaRequest("", update)
+	require.NoError(t, err)
+	require.NoError(t, atomicUpdateHandler(getContext(handlerState{store: raced, crypto: crypto}), httptest.NewRecorder(), req, racedVars))
+	_, timestamp, err = metaStore.GetCurrent(racedGUN, data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(timestamp, storedTS))
+	require.Equal(t, 1, storedTS.Signed.Version)
+
+	// an update which is not identical is still rejected as an old version
+	repo.Targets[data.CanonicalTargetsRole].Signed.Expires = time.Now().Add(time.Hour)
+	r, tg, sn, ts, err = testutils.Sign(repo)
+	require.NoError(t, err)
+	_, tgs, _, _, err = testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	update[data.CanonicalTargetsRole.String()] = tgs
+	req, err = store.NewMultiPartMetaRequest("", update)
+	require.NoError(t, err)
+	err = atomicUpdateHandler(getContext(handlerState{store: metaStore, crypto: crypto}), httptest.NewRecorder(), req, racedVars)
+	require.Error(t, err)
+}
+
+// laggingStore reads from a replica which lags behind the primary that it
+// writes to, and which its Primary view reads from
+type laggingStore struct {
+	*storage.MemStorage
+	primary *storage.MemStorage
+}
+
+func (s *laggingStore) UpdateCurrent(gun data.GUN, update storage.MetaUpdate) error {
+	return s.primary.UpdateCurrent(gun, update)
+}
+
+func (s *laggingStore) UpdateMany(gun data.GUN, updates []storage.MetaUpdate) error {
+	return s.primary.UpdateMany(gun, updates)
+}
+
+func (s *laggingStore) Primary() storage.MetaStore {
+	return s.primary
+}
+
+// an update is validated against the metadata on the primary, so one which
+// is only valid for the metadata a lagging replica still has is rejected as
+// invalid
+func TestAtomicUpdateValidatedAgainstPrimary(t *testing.T) {
+	replica, primary := storage.NewMemStorage(), storage.NewMemStorage()
+	var gun data.GUN = "testGUN"
+	vars := map[string]string{"gun": gun.String()}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	state := handlerState{store: &laggingStore{MemStorage: replica, primary: primary}, crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole)}
+
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, tss, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	original := []storage.MetaUpdate{
+		{Role: data.CanonicalRootRole, Version: 1, Data: rs},
+		{Role: data.CanonicalTargetsRole, Version: 1, Data: tgs},
+		{Role: data.CanonicalSnapshotRole, Version: 1, Data: sns},
+		{Role: data.CanonicalTimestampRole, Version: 1, Data: tss},
+	}
+	require.NoError(t, replica.UpdateMany(gun, original))
+	require.NoError(t, primary.UpdateMany(gun, original))
+
+	// a client which has only seen the original root still signs targets
+	// with the original targets key
+	staleCS := mustCopyKeys(t, cs, data.CanonicalTargetsRole, data.CanonicalSnapshotRole)
+	builder := tuf.NewRepoBuilder(gun, staleCS, trustpinning.TrustPinConfig{})
+	for _, update := range original {
+		require.NoError(t, builder.Load(update.Role, update.Data, 1, false))
+	}
+	staleRepo, _, err := builder.Finish()
+	require.NoError(t, err)
+
+	// the root is rotated to a new targets key on the primary only
+	newTargetsKey, err := testutils.CreateKey(cs, gun, data.CanonicalTargetsRole, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.ReplaceBaseKeys(data.CanonicalTargetsRole, newTargetsKey))
+	r, tg, sn, ts, err = testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, tss, err = testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	require.NoError(t, primary.UpdateMany(gun, []storage.MetaUpdate{
+		{Role: data.CanonicalRootRole, Version: 2, Data: rs},
+		{Role: data.CanonicalTargetsRole, Version: 2, Data: tgs},
+		{Role: data.CanonicalSnapshotRole, Version: 2, Data: sns},
+		{Role: data.CanonicalTimestampRole, Version: 2, Data: tss},
+	}))
+
+	staleRepo.Targets[data.CanonicalTargetsRole].Signed.Version = 2
+	staleRepo.Snapshot.Signed.Version = 2
+	_, err = staleRepo.AddTargets(data.CanonicalTargetsRole, data.Files{"latest": data.FileMeta{
+		Length: 1, Hashes: data.Hashes{notary.SHA256: make([]byte, sha256.Size)}}})
+	require.NoError(t, err)
+	tg, err = staleRepo.SignTargets(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	sn, err = staleRepo.SignSnapshot(data.DefaultExpires(data.CanonicalSnapshotRole))
+	require.NoError(t, err)
+	_, tgs, sns, _, err = testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+
+	req, err := store.NewMultiPartMetaRequest("", map[string][]byte{
+		data.CanonicalTargetsRole.String():  tgs,
+		data.CanonicalSnapshotRole.String(): sns,
+	})
+	require.NoError(t, err)
+	err = atomicUpdateHandler(getContext(state), httptest.NewRecorder(), req, vars)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrInvalidUpdate, errorObj.Code)
+	serializable, ok := errorObj.Detail.(*validation.SerializableError)
+	require.True(t, ok, "Expected a SerializableObject, got %v", errorObj.Detail)
+	require.IsType(t, validation.ErrBadTargets{}, serializable.Error)
+
+	_, current, err := primary.GetCurrent(gun, data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	currentTargets := &data.SignedTargets{}
+	require.NoError(t, json.Unmarshal(current, currentTargets))
+	require.Equal(t, 2, currentTargets.Signed.Version)
+}
+
+// update requests are only accepted up to the configured maximum body size,
+// whether or not the client declares the length of the body up front
+func TestAtomicUpdateMaxRequestBodySize(t *testing.T) {
+	var gun data.GUN = "testGUN"
+	vars := map[string]string{"gun": gun.String()}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+
+	newRequest := func(declareLength bool) *http.Request {
+		req, err := store.NewMultiPartMetaRequest("", map[string][]byte{
+			data.CanonicalRootRole.String():     rs,
+			data.CanonicalTargetsRole.String():  tgs,
+			data.CanonicalSnapshotRole.String(): sns,
+		})
+		require.NoError(t, err)
+		require.True(t, req.ContentLength > 0)
+		if !declareLength {
+			req.ContentLength = -1
+		}
+		return req
+	}
+	bodySize := newRequest(true).ContentLength
+
+	for _, declareLength := range []bool{true, false} {
+		for _, maxSize := range []int64{bodySize - 1, bodySize / 2} {
+			state := handlerState{store: storage.NewMemStorage(), crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole)}
+			ctx := context.WithValue(getContext(state), notary.CtxKeyMaxRequestBodySize, maxSize)
+
+			err = atomicUpdateHandler(ctx, httptest.NewRecorder(), newRequest(declareLength), vars)
+			require.Error(t, err)
+			errorObj, ok := err.(errcode.Error)
+			require.True(t, ok, "Expected an errcode.Error, got %v", err)
+			require.Equal(t, errors.ErrRequestTooLarge, errorObj.Code)
+			require.Equal(t, http.StatusRequestEntityTooLarge, errorObj.Code.Descriptor().HTTPStatusCode)
+		}
+
+		for _, maxSize := range []int64{bodySize, bodySize + 1} {
+			state := handlerState{store: storage.NewMemStorage(), crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole)}
+			ctx := context.WithValue(getContext(state), notary.CtxKeyMaxRequestBodySize, maxSize)
+
+			err = atomicUpdateHandler(ctx, httptest.NewRecorder(), newRequest(declareLength), vars)
+			require.NoError(t, err)
+		}
+	}
+}
+
+// without a configured maximum, the default maximum body size applies
+func TestAtomicUpdateDefaultMaxRequestBodySize(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(nil))
+	req.ContentLength = notary.DefaultMaxRequestBodySize + 1
+
+	err := atomicUpdateHandler(getContext(defaultState()), httptest.NewRecorder(), req, map[string]string{"gun": "testGUN"})
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrRequestTooLarge, errorObj.Code)
+}
+
+// A successful update, and a deletion, are delivered to the webhooks, and a
+// webhook which can't be delivered to doesn't fail the update
+func TestWebhooksNotifiedOfChanges(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []webhook.Event
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	defer receiver.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	notifier := webhook.NewNotifier([]webhook.Hook{{URL: receiver.URL}, {URL: down.URL}}, 2, time.Millisecond)
+
+	var gun data.GUN = "testGUN"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+
+	metaStore := storage.NewMemStorage()
+	state := handlerState{store: metaStore, crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole)}
+	ctx := context.WithValue(getContext(state), notary.CtxKeyWebhooks, notifier)
+
+	req, err := store.NewMultiPartMetaRequest("", map[string][]byte{
+		data.CanonicalRootRole.String():     rs,
+		data.CanonicalTargetsRole.String():  tgs,
+		data.CanonicalSnapshotRole.String(): sns,
+	})
+	require.NoError(t, err)
+	require.NoError(t, atomicUpdateHandler(ctx, httptest.NewRecorder(), req, map[string]string{"gun": gun.String()}))
+	notifier.Wait()
+
+	mu.Lock()
+	require.Len(t, events, 1)
+	require.Equal(t, gun, events[0].GUN)
+	require.Equal(t, webhook.ActionUpdate, events[0].Action)
+	published := make(map[data.RoleName]webhook.RoleUpdate)
+	for _, role := range events[0].Roles {
+		published[role.Role] = role
+	}
+	// the timestamp generated by the server is included
+	for _, role := range data.BaseRoles {
+		_, stored, err := metaStore.GetCurrent(gun, role)
+		require.NoError(t, err)
+		checksum := sha256.Sum256(stored)
+		require.Equal(t, hex.EncodeToString(checksum[:]), published[role].SHA256, role.String())
+		require.Equal(t, 1, published[role].Version)
+	}
+	mu.Unlock()
+
+	deleteReq := mux.SetURLVars(&http.Request{Body: ioutil.NopCloser(bytes.NewBuffer(nil))}, map[string]string{"gun": gun.String()})
+	require.NoError(t, DeleteHandler(ctx, httptest.NewRecorder(), deleteReq))
+	notifier.Wait()
+
+	mu.Lock()
+	require.Len(t, events, 2)
+	require.Equal(t, gun, events[1].GUN)
+	require.Equal(t, webhook.ActionDeletion, events[1].Action)
+	require.Empty(t, events[1].Roles)
+	mu.Unlock()
+
+	failed := 0
+	for _, delivery := range notifier.Deliveries() {
+		if delivery.URL == down.URL {
+			failed++
+			require.Equal(t, 2, delivery.Attempts)
+			require.NotEmpty(t, delivery.Err)
+		}
+	}
+	require.Equal(t, 2, failed)
+}
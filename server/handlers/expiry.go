@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// The bounds of the expiry which can be set for the snapshot or timestamp of
+// a GUN.  Anything shorter would leave clients with metadata which expires
+// before they can use it, and anything longer defeats the point of the
+// server re-signing the role.
+const (
+	MinExpiry = time.Hour
+	MaxExpiry = notary.NotarySnapshotExpiry
+)
+
+type expiryRequest struct {
+	Expiry string `json:"expiry"`
+}
+
+type expiryResponse struct {
+	Role data.RoleName `json:"role"`
+	// Expiry is how long the role is valid for when the server signs it, or
+	// empty if the server's default applies
+	Expiry string `json:"expiry,omitempty"`
+}
+
+// GetExpiryHandler returns the expiry set for the snapshot or timestamp of a
+// GUN, which is empty if the server's default applies
+func GetExpiryHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return getExpiryHandler(ctx, w, r, mux.Vars(r))
+}
+
+func getExpiryHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	role, gun, store, err := setupExpiryHandler(ctx, vars, http.MethodGet)
+	if err != nil {
+		return err
+	}
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+	expiry, err := store.GetExpiry(gun, role)
+	if err != nil {
+		logger.Errorf("500 GET %s expiry: %v", role, err)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	return writeExpiry(ctx, w, gun, role, expiry, http.MethodGet)
+}
+
+// SetExpiryHandler sets how long the snapshot or timestamp of a GUN is valid
+// for when the server signs it, overriding the server's default.  The expiry
+// is given as a duration such as "48h", and must lie between MinExpiry and
+// MaxExpiry.
+func SetExpiryHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	return setExpiryHandler(ctx, w, r, mux.Vars(r))
+}
+
+func setExpiryHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	role, gun, store, err := setupExpiryHandler(ctx, vars, http.MethodPut)
+	if err != nil {
+		return err
+	}
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+
+	var req expiryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Infof("400 PUT %s expiry: invalid request body: %v", role, err)
+		return errors.ErrInvalidParams.WithDetail("invalid request body: " + err.Error())
+	}
+	expiry, err := time.ParseDuration(req.Expiry)
+	if err != nil {
+		logger.Infof("400 PUT %s expiry: %v", role, err)
+		return errors.ErrInvalidParams.WithDetail("invalid expiry: " + err.Error())
+	}
+	if expiry < MinExpiry || expiry > MaxExpiry {
+		logger.Infof("400 PUT %s expiry: %s out of bounds", role, expiry)
+		return errors.ErrInvalidParams.WithDetail(
+			"expiry must be between " + MinExpiry.String() + " and " + MaxExpiry.String())
+	}
+
+	if err := store.SetExpiry(gun, role, expiry); err != nil {
+		logger.Errorf("500 PUT %s expiry: %v", role, err)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	logger.Infof("set %s expiry to %s", role, expiry)
+	return writeExpiry(ctx, w, gun, role, expiry, http.MethodPut)
+}
+
+// DeleteExpiryHandler removes the expiry set for the snapshot or timestamp
+// of a GUN, so that the server's default applies again
+func DeleteExpiryHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return deleteExpiryHandler(ctx, w, r, mux.Vars(r))
+}
+
+func deleteExpiryHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	role, gun, store, err := setupExpiryHandler(ctx, vars, http.MethodDelete)
+	if err != nil {
+		return err
+	}
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+	if err := store.SetExpiry(gun, role, 0); err != nil {
+		logger.Errorf("500 DELETE %s expiry: %v", role, err)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	logger.Infof("removed %s expiry", role)
+	return writeExpiry(ctx, w, gun, role, 0, http.MethodDelete)
+}
+
+// To be called before any of the expiry handlers
+func setupExpiryHandler(ctx context.Context, vars map[string]string, actionVerb string) (data.RoleName, data.GUN, storage.MetaStore, error) {
+	gun := data.GUN(vars["gun"])
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+	if gun == "" {
+		logger.Infof("400 %s no gun in request", actionVerb)
+		return "", "", nil, errors.ErrUnknown.WithDetail("no gun")
+	}
+
+	role := data.RoleName(vars["tufRole"])
+	if role != data.CanonicalSnapshotRole && role != data.CanonicalTimestampRole {
+		logger.Infof("400 %s expiry for invalid role %s", actionVerb, role)
+		return "", "", nil, errors.ErrInvalidRole.WithDetail(role)
+	}
+
+	store, ok := ctx.Value(notary.CtxKeyMetaStore).(storage.MetaStore)
+	if !ok || store == nil {
+		logger.Errorf("500 %s storage not configured", actionVerb)
+		return "", "", nil, errors.ErrNoStorage.WithDetail(nil)
+	}
+	return role, gun, store, nil
+}
+
+func writeExpiry(ctx context.Context, w http.ResponseWriter, gun data.GUN, role data.RoleName, expiry time.Duration, actionVerb string) error {
+	resp := expiryResponse{Role: role}
+	if expiry != 0 {
+		resp.Expiry = expiry.String()
+	}
+	out, err := json.Marshal(resp)
+	if err != nil {
+		ctxu.GetLoggerWithField(ctx, gun, "gun").Errorf("500 %s %s expiry", actionVerb, role)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Write(out)
+	return nil
+}
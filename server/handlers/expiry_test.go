@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func requireErrorCode(t *testing.T, expected errcode.ErrorCode, err error) {
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, expected, errorObj.Code)
+}
+
+func putExpiry(state handlerState, vars map[string]string, body string) (*httptest.ResponseRecorder, error) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/", bytes.NewBufferString(body))
+	return rec, setExpiryHandler(getContext(state), rec, req, vars)
+}
+
+func TestExpiryHandlersInvalidRoleOrNoStorage(t *testing.T) {
+	noStorage := defaultState()
+	noStorage.store = nil
+	for _, handler := range []func(map[string]string, handlerState) error{
+		func(vars map[string]string, state handlerState) error {
+			return getExpiryHandler(getContext(state), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), vars)
+		},
+		func(vars map[string]string, state handlerState) error {
+			_, err := putExpiry(state, vars, `{"expiry": "48h"}`)
+			return err
+		},
+		func(vars map[string]string, state handlerState) error {
+			return deleteExpiryHandler(getContext(state), httptest.NewRecorder(), httptest.NewRequest("DELETE", "/", nil), vars)
+		},
+	} {
+		for _, role := range []string{"root", "targets", "targets/a", ""} {
+			err := handler(map[string]string{"gun": "gun", "tufRole": role}, defaultState())
+			requireErrorCode(t, errors.ErrInvalidRole, err)
+		}
+		err := handler(map[string]string{"gun": "gun", "tufRole": "snapshot"}, noStorage)
+		requireErrorCode(t, errors.ErrNoStorage, err)
+	}
+}
+
+// Expiries outside the bounds, or which cannot be parsed, are rejected
+// without being stored
+func TestSetExpiryHandlerValidatesExpiry(t *testing.T) {
+	state := defaultState()
+	vars := map[string]string{"gun": "gun", "tufRole": "snapshot"}
+	for _, body := range []string{
+		`{"expiry": "59m"}`,
+		`{"expiry": "-48h"}`,
+		`{"expiry": "0s"}`,
+		`{"expiry": "` + (MaxExpiry + time.Hour).String() + `"}`,
+		`{"expiry": "two days"}`,
+		`{"expiry": 172800}`,
+		`not json`,
+	} {
+		_, err := putExpiry(state, vars, body)
+		requireErrorCode(t, errors.ErrInvalidParams, err)
+	}
+
+	expiry, err := state.store.(storage.MetaStore).GetExpiry("gun", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Zero(t, expiry)
+}
+
+// An expiry can be set, read back and removed for each server-signed role
+func TestExpiryHandlersSetGetDelete(t *testing.T) {
+	state := defaultState()
+	store := state.store.(storage.MetaStore)
+
+	getExpiry := func(vars map[string]string) expiryResponse {
+		rec := httptest.NewRecorder()
+		require.NoError(t, getExpiryHandler(getContext(state), rec, httptest.NewRequest("GET", "/", nil), vars))
+		var resp expiryResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	for _, role := range []data.RoleName{data.CanonicalSnapshotRole, data.CanonicalTimestampRole} {
+		vars := map[string]string{"gun": "gun", "tufRole": role.String()}
+
+		// the server's default applies to start with
+		require.Equal(t, expiryResponse{Role: role}, getExpiry(vars))
+
+		rec, err := putExpiry(state, vars, `{"expiry": "48h"}`)
+		require.NoError(t, err)
+		var resp expiryResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, expiryResponse{Role: role, Expiry: "48h0m0s"}, resp)
+		require.Equal(t, resp, getExpiry(vars))
+
+		expiry, err := store.GetExpiry("gun", role)
+		require.NoError(t, err)
+		require.Equal(t, 48*time.Hour, expiry)
+
+		// the bounds themselves are allowed
+		for _, bound := range []time.Duration{MinExpiry, MaxExpiry} {
+			_, err := putExpiry(state, vars, `{"expiry": "`+bound.String()+`"}`)
+			require.NoError(t, err)
+		}
+
+		rec = httptest.NewRecorder()
+		require.NoError(t, deleteExpiryHandler(getContext(state), rec, httptest.NewRequest("DELETE", "/", nil), vars))
+		require.Equal(t, expiryResponse{Role: role}, getExpiry(vars))
+		expiry, err = store.GetExpiry("gun", role)
+		require.NoError(t, err)
+		require.Zero(t, expiry)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	ctxu "github.com/docker/distribution/context"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+// trackingWriter records whether anything has been written through it
+type trackingWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// ExportHandler streams every stored version of every role of every GUN, as
+// written by storage.ExportMeta
+func ExportHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	logger := ctxu.GetLogger(ctx)
+	store, ok := ctx.Value(notary.CtxKeyMetaStore).(storage.MetaStore)
+	if !ok {
+		logger.Errorf("%d GET unable to retrieve storage", http.StatusInternalServerError)
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	out := &trackingWriter{ResponseWriter: w}
+	count, err := storage.ExportMeta(store, out)
+	if err != nil {
+		if !out.written {
+			logger.Errorf("%d GET could not export metadata: %s", http.StatusInternalServerError, err.Error())
+			return errors.ErrUnknown.WithDetail(err)
+		}
+		// the status has already been sent, so abort the response to let the
+		// client know the export is incomplete
+		logger.Errorf("export of metadata failed after %d records: %s", count, err.Error())
+		panic(http.ErrAbortHandler)
+	}
+	logger.Infof("exported %d metadata records", count)
+	return nil
+}
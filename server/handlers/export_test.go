@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+func TestExportHandlerNoStorage(t *testing.T) {
+	state := defaultState()
+	state.store = nil
+
+	err := ExportHandler(getContext(state), httptest.NewRecorder(), httptest.NewRequest("GET", "/v2/_trust/export", nil))
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrNoStorage, errorObj.Code)
+}
+
+func TestExportHandlerRoundTrip(t *testing.T) {
+	from := storage.NewMemStorage()
+	require.NoError(t, from.UpdateMany("gun", []storage.MetaUpdate{
+		{Role: "targets", Version: 1, Data: []byte("1")},
+		{Role: "targets", Version: 2, Data: []byte("2")},
+	}))
+	state := defaultState()
+	state.store = from
+
+	exported := httptest.NewRecorder()
+	require.NoError(t, ExportHandler(getContext(state), exported, httptest.NewRequest("GET", "/v2/_trust/export", nil)))
+
+	to := storage.NewMemStorage()
+	count, err := storage.ImportMeta(to, bytes.NewReader(exported.Body.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	_, data, err := to.GetVersion("gun", "targets", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), data)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	ctxu "github.com/docker/distribution/context"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+type gcResponse struct {
+	DryRun          bool                 `json:"dry_run"`
+	NumberOfRecords int                  `json:"count"`
+	Records         []storage.MetaRecord `json:"records"`
+}
+
+// GarbageCollectHandler removes metadata which is no longer referenced by the
+// current timestamp and snapshot of any GUN, and returns the records removed.
+// If the dry_run query parameter is true, nothing is removed.
+func GarbageCollectHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	logger := ctxu.GetLogger(ctx)
+	store, ok := ctx.Value(notary.CtxKeyMetaStore).(storage.MetaStore)
+	if !ok {
+		logger.Errorf("%d POST unable to retrieve storage", http.StatusInternalServerError)
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+
+	var dryRun bool
+	if qs := r.URL.Query().Get("dry_run"); qs != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(qs); err != nil {
+			logger.Errorf("%d POST invalid dry_run: %s", http.StatusBadRequest, qs)
+			return errors.ErrInvalidParams.WithDetail("invalid dry_run parameter: " + err.Error())
+		}
+	}
+
+	records, err := store.GarbageCollect(dryRun)
+	if _, ok := err.(storage.ErrGCNotSupported); ok {
+		logger.Errorf("%d POST %s", http.StatusNotImplemented, err.Error())
+		return errors.ErrNotSupported.WithDetail(err.Error())
+	} else if err != nil {
+		logger.Errorf("%d POST could not garbage collect metadata: %s", http.StatusInternalServerError, err.Error())
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	if records == nil {
+		records = []storage.MetaRecord{}
+	}
+	out, err := json.Marshal(&gcResponse{
+		DryRun:          dryRun,
+		NumberOfRecords: len(records),
+		Records:         records,
+	})
+	if err != nil {
+		logger.Errorf("%d POST could not json.Marshal gcResponse", http.StatusInternalServerError)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	if !dryRun {
+		logger.Infof("garbage collected %d metadata records", len(records))
+	}
+	w.Write(out)
+	return nil
+}
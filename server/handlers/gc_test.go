@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+func TestGarbageCollectHandlerNoStorage(t *testing.T) {
+	state := defaultState()
+	state.store = nil
+
+	req := httptest.NewRequest("POST", "/v2/_trust/gc", nil)
+	err := GarbageCollectHandler(getContext(state), httptest.NewRecorder(), req)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrNoStorage, errorObj.Code)
+}
+
+func TestGarbageCollectHandlerInvalidDryRun(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v2/_trust/gc?dry_run=maybe", nil)
+	err := GarbageCollectHandler(getContext(defaultState()), httptest.NewRecorder(), req)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrInvalidParams, errorObj.Code)
+}
+
+type noGCStore struct {
+	*storage.MemStorage
+}
+
+func (s noGCStore) GarbageCollect(dryRun bool) ([]storage.MetaRecord, error) {
+	return nil, storage.ErrGCNotSupported{}
+}
+
+func TestGarbageCollectHandlerUnsupported(t *testing.T) {
+	state := defaultState()
+	state.store = noGCStore{storage.NewMemStorage()}
+
+	req := httptest.NewRequest("POST", "/v2/_trust/gc", nil)
+	err := GarbageCollectHandler(getContext(state), httptest.NewRecorder(), req)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrNotSupported, errorObj.Code)
+}
+
+func TestGarbageCollectHandlerReportsRecords(t *testing.T) {
+	// with no timestamp the GUN's current state is unknown, so nothing is
+	// collected
+	s := storage.NewMemStorage()
+	require.NoError(t, s.UpdateCurrent("gun", storage.MetaUpdate{Role: "targets", Version: 1, Data: []byte("1")}))
+	state := defaultState()
+	state.store = s
+
+	for _, dryRun := range []bool{true, false} {
+		url := "/v2/_trust/gc"
+		if dryRun {
+			url += "?dry_run=true"
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, GarbageCollectHandler(getContext(state), rec, httptest.NewRequest("POST", url, nil)))
+
+		var resp gcResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, dryRun, resp.DryRun)
+		require.Equal(t, 0, resp.NumberOfRecords)
+		require.NotNil(t, resp.Records)
+	}
+}
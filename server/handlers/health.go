@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution/health"
+	"github.com/sirupsen/logrus"
+)
+
+// HealthHandler returns a handler which runs every check in the registry and
+// responds with a JSON map of the name of each failing check to its error.  The
+// status is 503 if any check fails, and 200 otherwise.
+func HealthHandler(registry *health.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := registry.CheckStatus()
+		status := http.StatusOK
+		if len(checks) != 0 {
+			status = http.StatusServiceUnavailable
+		}
+
+		out, err := json.Marshal(checks)
+		if err != nil {
+			logrus.Errorf("error serializing health status: %v", err)
+			http.Error(w, "could not serialize health status", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Length", fmt.Sprint(len(out)))
+		w.WriteHeader(status)
+		w.Write(out)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/health"
+	"github.com/stretchr/testify/require"
+)
+
+// unreliableDB stands in for a storage backend whose health check fails while
+// it is unavailable
+type unreliableDB struct {
+	available bool
+}
+
+func (db *unreliableDB) CheckHealth() error {
+	if !db.available {
+		return fmt.Errorf("cannot reach the database")
+	}
+	return nil
+}
+
+func getHealth(t *testing.T, handler http.Handler) (int, map[string]string) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var checks map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &checks))
+	return rec.Code, checks
+}
+
+func TestHealthHandlerReadinessFollowsDB(t *testing.T) {
+	db := &unreliableDB{available: true}
+	readiness := health.NewRegistry()
+	readiness.RegisterFunc("DB operational", db.CheckHealth)
+	ready := HealthHandler(readiness)
+	live := HealthHandler(health.NewRegistry())
+
+	for _, available := range []bool{true, false, true} {
+		db.available = available
+
+		status, checks := getHealth(t, ready)
+		if available {
+			require.Equal(t, http.StatusOK, status)
+			require.Empty(t, checks)
+		} else {
+			require.Equal(t, http.StatusServiceUnavailable, status)
+			require.Equal(t, map[string]string{"DB operational": "cannot reach the database"}, checks)
+		}
+
+		// the process is up regardless of the database
+		status, checks = getHealth(t, live)
+		require.Equal(t, http.StatusOK, status)
+		require.Empty(t, checks)
+	}
+}
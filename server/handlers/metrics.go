@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/validation"
+)
+
+// The reasons for which an update can be rejected, used as the "reason" label
+// of the rejection counter
+const (
+	rejectionSignature = "signature"
+	rejectionThreshold = "threshold"
+	rejectionExpired   = "expired"
+	rejectionHierarchy = "hierarchy"
+)
+
+// updateRejections counts the updates which failed validation, by the class
+// of the failure, so that operators can alert on them
+var updateRejections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "notary_server",
+		Subsystem: "validation",
+		Name:      "rejections_total",
+		Help:      "Number of updates rejected by validation, by reason.",
+	},
+	[]string{"reason"},
+)
+
+// activeGUNs is the number of distinct GUNs which have been published to
+// since the server started, which are remembered in publishedGUNs
+var activeGUNs = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "notary_server",
+		Subsystem: "updates",
+		Name:      "active_guns",
+		Help:      "Number of distinct GUNs published to since the server started.",
+	},
+)
+
+var (
+	publishedGUNsMu sync.Mutex
+	publishedGUNs   = make(map[data.GUN]struct{})
+)
+
+func init() {
+	prometheus.MustRegister(updateRejections)
+	prometheus.MustRegister(activeGUNs)
+}
+
+// rejectionReason classifies an error from loading or generating metadata,
+// returning an empty string if it does not belong to any of the classes
+// which are counted
+func rejectionReason(err error) string {
+	switch err.(type) {
+	case signed.ErrRoleThreshold, signed.ErrInsufficientSignatures:
+		return rejectionThreshold
+	case signed.ErrExpired:
+		return rejectionExpired
+	case signed.ErrInvalidKeyID, signed.ErrInvalidKeyType,
+		*trustpinning.ErrValidationFail, *trustpinning.ErrRootRotationFail:
+		return rejectionSignature
+	case data.ErrInvalidRole, validation.ErrBadHierarchy:
+		return rejectionHierarchy
+	}
+	if err == signed.ErrNoSignatures {
+		return rejectionSignature
+	}
+	return ""
+}
+
+// countRejection increments the rejection counter for the class of the error,
+// if it is one that is counted
+func countRejection(err error) {
+	if reason := rejectionReason(err); reason != "" {
+		updateRejections.WithLabelValues(reason).Inc()
+	}
+}
+
+// countPublish records that an update to the given GUN has been applied, so
+// that it is counted as active
+func countPublish(gun data.GUN) {
+	publishedGUNsMu.Lock()
+	defer publishedGUNsMu.Unlock()
+	if _, ok := publishedGUNs[gun]; !ok {
+		publishedGUNs[gun] = struct{}{}
+		activeGUNs.Set(float64(len(publishedGUNs)))
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/server/storage"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/testutils"
+)
+
+// rejectionCount gets the current value of the rejection counter for a reason
+// from the metrics which would be served by the metrics endpoint
+func rejectionCount(t *testing.T, reason string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "notary_server_validation_rejections_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "reason" && label.GetValue() == reason {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// postUpdate sends the given metadata to the atomic update handler, which is
+// expected to reject it
+func postUpdate(t *testing.T, cs interface{}, gun data.GUN, r, tg, sn *data.Signed) {
+	toPost := map[string][]byte{}
+	for role, s := range map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:     r,
+		data.CanonicalTargetsRole:  tg,
+		data.CanonicalSnapshotRole: sn,
+	} {
+		if s == nil {
+			continue
+		}
+		serialized, err := json.Marshal(s)
+		require.NoError(t, err)
+		toPost[role.String()] = serialized
+	}
+	req, err := store.NewMultiPartMetaRequest("", toPost)
+	require.NoError(t, err)
+
+	state := handlerState{store: storage.NewMemStorage(), crypto: cs}
+	err = atomicUpdateHandler(getContext(state), httptest.NewRecorder(), req, map[string]string{"gun": gun.String()})
+	require.Error(t, err)
+}
+
+// assertRejectionCounted checks that making an update increments the
+// rejection counter for the given reason, and no other
+func assertRejectionCounted(t *testing.T, reason string, update func()) {
+	reasons := []string{rejectionSignature, rejectionThreshold, rejectionExpired, rejectionHierarchy}
+	before := make(map[string]float64)
+	for _, r := range reasons {
+		before[r] = rejectionCount(t, r)
+	}
+	update()
+	for _, r := range reasons {
+		expected := before[r]
+		if r == reason {
+			expected++
+		}
+		require.Equal(t, expected, rejectionCount(t, r), "unexpected count for %s rejections", r)
+	}
+}
+
+func TestRejectionCountedSignature(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, sn, _, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	r.Signatures = nil
+
+	assertRejectionCounted(t, rejectionSignature, func() {
+		postUpdate(t, mustCopyKeys(t, cs, data.CanonicalTimestampRole), gun, r, tg, sn)
+	})
+}
+
+func TestRejectionCountedThreshold(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, sn, _, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	// corrupt the only signature, so the threshold of 1 is not met
+	require.Len(t, tg.Signatures, 1)
+	tg.Signatures[0].Signature[0] ^= 0xff
+
+	assertRejectionCounted(t, rejectionThreshold, func() {
+		postUpdate(t, mustCopyKeys(t, cs, data.CanonicalTimestampRole), gun, r, tg, sn)
+	})
+}
+
+func TestRejectionCountedExpired(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, _, sn, _, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	tg, err := repo.SignTargets(data.CanonicalTargetsRole, time.Now().AddDate(0, 0, -1))
+	require.NoError(t, err)
+
+	assertRejectionCounted(t, rejectionExpired, func() {
+		postUpdate(t, mustCopyKeys(t, cs, data.CanonicalTimestampRole), gun, r, tg, sn)
+	})
+}
+
+func TestRejectionCountedHierarchy(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, _, _, err := testutils.Sign(repo)
+	require.NoError(t, err)
+
+	// no snapshot is provided, and the server does not have the snapshot key
+	assertRejectionCounted(t, rejectionHierarchy, func() {
+		postUpdate(t, mustCopyKeys(t, cs, data.CanonicalTimestampRole), gun, r, tg, nil)
+	})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary/server/errors"
+)
+
+// The names of the metrics which are summarized in a snapshot
+const (
+	requestsMetric       = "notary_server_http_requests_total"
+	requestLatencyMetric = "notary_server_http_request_duration_microseconds"
+	storeLatencyMetric   = "notary_server_storage_operation_duration_microseconds"
+	rejectionsMetric     = "notary_server_validation_rejections_total"
+	activeGUNsMetric     = "notary_server_updates_active_guns"
+)
+
+// startTime is when the server started, from which request rates are computed
+var startTime = time.Now()
+
+// MetricsSnapshot is a point-in-time summary of the server's in-process
+// metrics, which are otherwise scraped by Prometheus from /metrics
+type MetricsSnapshot struct {
+	Time          time.Time         `json:"time"`
+	UptimeSeconds float64           `json:"uptime_seconds"`
+	Requests      []RequestStats    `json:"requests"`
+	Rejections    map[string]uint64 `json:"rejections"`
+	Storage       []LatencyStats    `json:"storage"`
+	ActiveGUNs    int               `json:"active_guns"`
+}
+
+// RequestStats summarizes the requests served by the server for an operation
+// since it started
+type RequestStats struct {
+	LatencyStats
+	ClientErrors  uint64  `json:"client_errors"`
+	ServerErrors  uint64  `json:"server_errors"`
+	RatePerSecond float64 `json:"rate_per_second"`
+}
+
+// LatencyStats summarizes how long an operation has taken since the server
+// started.  The quantiles, keyed by quantile, only cover recent operations.
+type LatencyStats struct {
+	Operation               string             `json:"operation"`
+	Count                   uint64             `json:"count"`
+	MeanLatencyMicroseconds float64            `json:"mean_latency_microseconds"`
+	LatencyQuantiles        map[string]float64 `json:"latency_quantiles_microseconds,omitempty"`
+}
+
+// MetricsSnapshotHandler returns a snapshot of the server's request rates,
+// error counts, storage latencies and number of active GUNs, as JSON
+func MetricsSnapshotHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	logger := ctxu.GetLogger(ctx)
+	snapshot, err := SnapshotMetrics(prometheus.DefaultGatherer, time.Now())
+	if err != nil {
+		logger.Errorf("%d GET could not gather metrics: %s", http.StatusInternalServerError, err.Error())
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	out, err := json.Marshal(&snapshot)
+	if err != nil {
+		logger.Errorf("%d GET could not json.Marshal metrics snapshot", http.StatusInternalServerError)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+	return nil
+}
+
+// SnapshotMetrics summarizes the metrics gathered by the given gatherer at the
+// given time.  Operations are sorted by name.
+func SnapshotMetrics(gatherer prometheus.Gatherer, now time.Time) (MetricsSnapshot, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return MetricsSnapshot{}, err
+	}
+
+	uptime := now.Sub(startTime).Seconds()
+	snapshot := MetricsSnapshot{
+		Time:          now.UTC(),
+		UptimeSeconds: uptime,
+		Requests:      []RequestStats{},
+		Rejections:    make(map[string]uint64),
+		Storage:       []LatencyStats{},
+	}
+	requests := make(map[string]*RequestStats)
+	getRequests := func(operation string) *RequestStats {
+		if _, ok := requests[operation]; !ok {
+			requests[operation] = &RequestStats{LatencyStats: LatencyStats{Operation: operation}}
+		}
+		return requests[operation]
+	}
+
+	for _, family := range families {
+		switch family.GetName() {
+		case requestsMetric:
+			for _, metric := range family.GetMetric() {
+				stats := getRequests(labelValue(metric, "operation"))
+				count := uint64(metric.GetCounter().GetValue())
+				stats.Count += count
+				code, _ := strconv.Atoi(labelValue(metric, "code"))
+				switch {
+				case code >= http.StatusInternalServerError:
+					stats.ServerErrors += count
+				case code >= http.StatusBadRequest:
+					stats.ClientErrors += count
+				}
+			}
+		case requestLatencyMetric:
+			for _, metric := range family.GetMetric() {
+				stats := getRequests(labelValue(metric, "operation"))
+				latency := summarizeLatency(stats.Operation, metric.GetSummary())
+				stats.MeanLatencyMicroseconds = latency.MeanLatencyMicroseconds
+				stats.LatencyQuantiles = latency.LatencyQuantiles
+			}
+		case storeLatencyMetric:
+			for _, metric := range family.GetMetric() {
+				snapshot.Storage = append(snapshot.Storage,
+					summarizeLatency(labelValue(metric, "operation"), metric.GetSummary()))
+			}
+		case rejectionsMetric:
+			for _, metric := range family.GetMetric() {
+				snapshot.Rejections[labelValue(metric, "reason")] = uint64(metric.GetCounter().GetValue())
+			}
+		case activeGUNsMetric:
+			for _, metric := range family.GetMetric() {
+				snapshot.ActiveGUNs = int(metric.GetGauge().GetValue())
+			}
+		}
+	}
+
+	for _, stats := range requests {
+		if uptime > 0 {
+			stats.RatePerSecond = float64(stats.Count) / uptime
+		}
+		snapshot.Requests = append(snapshot.Requests, *stats)
+	}
+	sort.Slice(snapshot.Requests, func(i, j int) bool {
+		return snapshot.Requests[i].Operation < snapshot.Requests[j].Operation
+	})
+	sort.Slice(snapshot.Storage, func(i, j int) bool {
+		return snapshot.Storage[i].Operation < snapshot.Storage[j].Operation
+	})
+	return snapshot, nil
+}
+
+// labelValue returns the value of the named label of a metric, or an empty
+// string if it does not have the label
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// summarizeLatency summarizes a latency summary, leaving out the quantiles
+// for which there have been no recent observations
+func summarizeLatency(operation string, summary *dto.Summary) LatencyStats {
+	stats := LatencyStats{
+		Operation: operation,
+		Count:     summary.GetSampleCount(),
+	}
+	if stats.Count > 0 {
+		stats.MeanLatencyMicroseconds = summary.GetSampleSum() / float64(stats.Count)
+	}
+	for _, q := range summary.GetQuantile() {
+		if math.IsNaN(q.GetValue()) {
+			continue
+		}
+		if stats.LatencyQuantiles == nil {
+			stats.LatencyQuantiles = make(map[string]float64)
+		}
+		key := strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+		stats.LatencyQuantiles[key] = q.GetValue()
+	}
+	return stats
+}
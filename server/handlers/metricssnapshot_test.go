@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/server/storage"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/testutils"
+)
+
+// getMetricsSnapshot gets a snapshot of the metrics from the handler
+func getMetricsSnapshot(t *testing.T) MetricsSnapshot {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v2/_trust/metrics", nil)
+	require.NoError(t, MetricsSnapshotHandler(getContext(defaultState()), rec, req))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var snapshot MetricsSnapshot
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snapshot))
+	return snapshot
+}
+
+func findRequestStats(snapshot MetricsSnapshot, operation string) (RequestStats, bool) {
+	for _, stats := range snapshot.Requests {
+		if stats.Operation == operation {
+			return stats, true
+		}
+	}
+	return RequestStats{}, false
+}
+
+func findStorageStats(snapshot MetricsSnapshot, operation string) (LatencyStats, bool) {
+	for _, stats := range snapshot.Storage {
+		if stats.Operation == operation {
+			return stats, true
+		}
+	}
+	return LatencyStats{}, false
+}
+
+func TestMetricsSnapshotHandler(t *testing.T) {
+	before := getMetricsSnapshot(t)
+
+	// requests are instrumented as the server instruments them, one of which
+	// fails
+	instrumented := prometheus.InstrumentHandlerWithOpts(prometheus.SummaryOpts{ //lint:ignore SA1019 TODO update prometheus API
+		Namespace:   "notary_server",
+		Subsystem:   "http",
+		ConstLabels: prometheus.Labels{"operation": "SnapshotTest"},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	for _, path := range []string{"/", "/", "/fail"} {
+		instrumented.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// an update is published through a metered store, and another is rejected
+	var gun data.GUN = "docker.com/metrics-snapshot"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+	req, err := store.NewMultiPartMetaRequest("", map[string][]byte{
+		data.CanonicalRootRole.String():     rs,
+		data.CanonicalTargetsRole.String():  tgs,
+		data.CanonicalSnapshotRole.String(): sns,
+	})
+	require.NoError(t, err)
+	state := handlerState{
+		store:  storage.NewMeteredMetaStore(storage.NewMemStorage()),
+		crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole),
+	}
+	require.NoError(t, atomicUpdateHandler(getContext(state), httptest.NewRecorder(), req, map[string]string{"gun": gun.String()}))
+
+	r.Signatures = nil
+	postUpdate(t, mustCopyKeys(t, cs, data.CanonicalTimestampRole), gun, r, tg, sn)
+
+	after := getMetricsSnapshot(t)
+	require.True(t, after.UptimeSeconds > 0)
+	require.WithinDuration(t, time.Now(), after.Time, time.Minute)
+
+	stats, ok := findRequestStats(after, "SnapshotTest")
+	require.True(t, ok, "no stats for the instrumented operation")
+	require.EqualValues(t, 3, stats.Count)
+	require.EqualValues(t, 1, stats.ServerErrors)
+	require.EqualValues(t, 0, stats.ClientErrors)
+	require.True(t, stats.RatePerSecond > 0)
+	require.True(t, stats.MeanLatencyMicroseconds > 0)
+	require.NotEmpty(t, stats.LatencyQuantiles)
+
+	updateMany, ok := findStorageStats(after, "UpdateMany")
+	require.True(t, ok, "no stats for the storage operation")
+	previous, _ := findStorageStats(before, "UpdateMany")
+	require.Equal(t, previous.Count+1, updateMany.Count)
+	require.True(t, updateMany.MeanLatencyMicroseconds > 0)
+
+	require.Equal(t, before.Rejections[rejectionSignature]+1, after.Rejections[rejectionSignature])
+	require.Equal(t, before.ActiveGUNs+1, after.ActiveGUNs)
+}
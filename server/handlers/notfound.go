@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"net/http"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/utils"
+)
+
+// maxNotFoundNonceLength is the longest client nonce which is echoed in a
+// signed not-found statement
+const maxNotFoundNonceLength = 64
+
+// NotFoundSigner signs statements that the GUNs matching its patterns do not
+// exist, so that clients which have pinned its key can tell a repository
+// which really doesn't exist from a 404 spoofed to hide it
+type NotFoundSigner struct {
+	// GUNs are the GUNs statements are signed for, each either an exact GUN
+	// or a prefix followed by "*"
+	GUNs []string
+	Key  data.PrivateKey
+}
+
+// sign returns a statement that the GUN does not exist, echoing the nonce the
+// client sent, or nil if the GUN isn't covered by the signer
+func (s *NotFoundSigner) sign(gun data.GUN, nonce string) (*data.Signed, error) {
+	if s == nil || !utils.MatchGUNPattern(gun.String(), s.GUNs) {
+		return nil, nil
+	}
+	if len(nonce) > maxNotFoundNonceLength {
+		nonce = ""
+	}
+	nf := &data.SignedNotFound{
+		Signed: data.NotFound{
+			Type:  data.NotFoundType,
+			GUN:   gun,
+			Nonce: nonce,
+			Time:  time.Now().UTC(),
+		},
+	}
+	signed, err := nf.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.Key.Sign(rand.Reader, *signed.Signed, nil)
+	if err != nil {
+		return nil, err
+	}
+	signed.Signatures = []data.Signature{{
+		KeyID:     s.Key.ID(),
+		Method:    s.Key.SignatureAlgorithm(),
+		Signature: sig,
+	}}
+	return signed, nil
+}
+
+// signNotFound replaces the error for a root which does not exist with one
+// whose detail is a signed statement that the GUN does not exist, if the
+// server is configured to sign such statements for the GUN
+func signNotFound(ctx context.Context, r *http.Request, gun data.GUN, err error) error {
+	if notFound, ok := err.(errcode.Error); !ok || notFound.Code != errors.ErrMetadataNotFound {
+		return err
+	}
+	signer, _ := ctx.Value(notary.CtxKeyNotFoundSigner).(*NotFoundSigner)
+	statement, signErr := signer.sign(gun, r.Header.Get(notary.NotFoundNonceHeader))
+	if signErr != nil {
+		ctxu.GetLoggerWithField(ctx, gun, "gun").Errorf("could not sign not-found statement: %v", signErr)
+		return err
+	}
+	if statement == nil {
+		return err
+	}
+	return errors.ErrMetadataNotFound.WithDetail(statement)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	canonicaljson "github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+func getRootWithNonce(ctx context.Context, gun, nonce string) error {
+	req := httptest.NewRequest("GET", "/", nil)
+	if nonce != "" {
+		req.Header.Set(notary.NotFoundNonceHeader, nonce)
+	}
+	return getHandler(ctx, httptest.NewRecorder(), req, map[string]string{"gun": gun, "tufRole": "root"})
+}
+
+// A root which does not exist gets a signed statement that its GUN does not
+// exist, if the GUN matches the signer's patterns
+func TestGetHandlerSignsNotFound(t *testing.T) {
+	key, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	metaStore := storage.NewMemStorage()
+	require.NoError(t, metaStore.UpdateCurrent("signed/exists", storage.MetaUpdate{Role: "root", Version: 1, Data: []byte("{}")}))
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, metaStore)
+	ctx = context.WithValue(ctx, notary.CtxKeyNotFoundSigner, &NotFoundSigner{GUNs: []string{"signed/*"}, Key: key})
+
+	err = getRootWithNonce(ctx, "signed/missing", "abc123")
+	requireErrorCode(t, errors.ErrMetadataNotFound, err)
+	statement, ok := err.(errcode.Error).Detail.(*data.Signed)
+	require.True(t, ok, "expected a signed statement, got %v", err.(errcode.Error).Detail)
+
+	// the statement survives being served as JSON, and verifies
+	serialized, err := json.Marshal(err)
+	require.NoError(t, err)
+	var served data.Signed
+	require.NoError(t, json.Unmarshal(serialized, &struct {
+		Detail *data.Signed `json:"detail"`
+	}{&served}))
+	require.Equal(t, statement.Signatures, served.Signatures)
+	var decoded map[string]interface{}
+	require.NoError(t, canonicaljson.Unmarshal(*served.Signed, &decoded))
+	msg, err := canonicaljson.MarshalCanonical(decoded)
+	require.NoError(t, err)
+	pubKey := data.PublicKeyFromPrivate(key)
+	_, err = signed.VerifyDetached(msg, served.Signatures, data.BaseRole{Keys: data.Keys{pubKey.ID(): pubKey}, Threshold: 1})
+	require.NoError(t, err)
+
+	notFound, err := data.NotFoundFromSigned(&served)
+	require.NoError(t, err)
+	require.Equal(t, data.NotFoundType, notFound.Signed.Type)
+	require.Equal(t, data.GUN("signed/missing"), notFound.Signed.GUN)
+	require.Equal(t, "abc123", notFound.Signed.Nonce)
+	require.False(t, notFound.Signed.Time.IsZero())
+
+	// an over-long nonce is not echoed
+	err = getRootWithNonce(ctx, "signed/missing", strings.Repeat("a", maxNotFoundNonceLength+1))
+	notFound, err = data.NotFoundFromSigned(err.(errcode.Error).Detail.(*data.Signed))
+	require.NoError(t, err)
+	require.Empty(t, notFound.Signed.Nonce)
+
+	// a GUN which exists is served as usual
+	require.NoError(t, getRootWithNonce(ctx, "signed/exists", "abc123"))
+}
+
+// Without a signer, or for a GUN which doesn't match its patterns or for a
+// role other than the root, the not found error is left as is
+func TestGetHandlerNotFoundFallback(t *testing.T) {
+	key, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, storage.NewMemStorage())
+
+	err = getRootWithNonce(ctx, "signed/missing", "abc123")
+	requireErrorCode(t, errors.ErrMetadataNotFound, err)
+	require.IsType(t, storage.ErrNotFound{}, err.(errcode.Error).Detail)
+
+	ctx = context.WithValue(ctx, notary.CtxKeyNotFoundSigner, &NotFoundSigner{GUNs: []string{"signed/*"}, Key: key})
+	err = getRootWithNonce(ctx, "unsigned/missing", "abc123")
+	requireErrorCode(t, errors.ErrMetadataNotFound, err)
+	require.IsType(t, storage.ErrNotFound{}, err.(errcode.Error).Detail)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	err = getHandler(ctx, httptest.NewRecorder(), req, map[string]string{"gun": "signed/missing", "tufRole": "targets"})
+	requireErrorCode(t, errors.ErrMetadataNotFound, err)
+	require.IsType(t, storage.ErrNotFound{}, err.(errcode.Error).Detail)
+}
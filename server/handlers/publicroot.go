@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// PublicRootHandler returns the current root.json of a GUN without requiring
+// authentication, so that a client can fetch it to verify against pins it has
+// obtained out of band before trusting the repository.  No other role is
+// served.  Unless the server is configured to serve it, it responds as if the
+// root did not exist.
+func PublicRootHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	if enabled, _ := ctx.Value(notary.CtxKeyPublicRoot).(bool); !enabled {
+		return errors.ErrMetadataNotFound.WithDetail(nil)
+	}
+	vars := map[string]string{
+		"gun":     mux.Vars(r)["gun"],
+		"tufRole": data.CanonicalRootRole.String(),
+	}
+	return getHandler(ctx, w, r, vars)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/testutils"
+)
+
+func publicRootRequest(gun string) *http.Request {
+	req := &http.Request{
+		Body: ioutil.NopCloser(bytes.NewBuffer(nil)),
+	}
+	return mux.SetURLVars(req, map[string]string{"gun": gun})
+}
+
+// The root is only served if the server is configured to serve it
+func TestPublicRootHandler(t *testing.T) {
+	metaStore := storage.NewMemStorage()
+	repo, _, err := testutils.EmptyRepo("gun")
+	require.NoError(t, err)
+
+	root, err := repo.SignRoot(data.DefaultExpires("root"), nil)
+	require.NoError(t, err)
+	rootJSON, err := json.Marshal(root)
+	require.NoError(t, err)
+	require.NoError(t, metaStore.UpdateCurrent("gun", storage.MetaUpdate{Role: "root", Version: 1, Data: rootJSON}))
+
+	targets, err := repo.SignTargets(data.CanonicalTargetsRole, data.DefaultExpires("targets"))
+	require.NoError(t, err)
+	targetsJSON, err := json.Marshal(targets)
+	require.NoError(t, err)
+	require.NoError(t, metaStore.UpdateCurrent("other", storage.MetaUpdate{Role: "targets", Version: 1, Data: targetsJSON}))
+
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, metaStore)
+
+	// off unless configured
+	for _, off := range []context.Context{ctx, context.WithValue(ctx, notary.CtxKeyPublicRoot, false)} {
+		rw := httptest.NewRecorder()
+		err := PublicRootHandler(off, rw, publicRootRequest("gun"))
+		requireErrorCode(t, errors.ErrMetadataNotFound, err)
+		require.Empty(t, rw.Body.Bytes())
+	}
+
+	ctx = context.WithValue(ctx, notary.CtxKeyPublicRoot, true)
+	rw := httptest.NewRecorder()
+	require.NoError(t, PublicRootHandler(ctx, rw, publicRootRequest("gun")))
+	require.Equal(t, rootJSON, rw.Body.Bytes())
+	require.NotEmpty(t, rw.Header().Get("Last-Modified"))
+
+	// only the root is served, even for a GUN with other metadata
+	rw = httptest.NewRecorder()
+	err = PublicRootHandler(ctx, rw, publicRootRequest("other"))
+	requireErrorCode(t, errors.ErrMetadataNotFound, err)
+	require.Empty(t, rw.Body.Bytes())
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	ctxu "github.com/docker/distribution/context"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+type reindexResponse struct {
+	DryRun bool `json:"dry_run"`
+	storage.ReindexResult
+}
+
+// ReindexChangefeedHandler rebuilds the changefeed from the stored timestamps,
+// renumbering it in the order the changes were made, for storage backends
+// which support it.  If the dry_run query parameter is true, the changefeed
+// is not changed.
+func ReindexChangefeedHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	logger := ctxu.GetLogger(ctx)
+	store, ok := ctx.Value(notary.CtxKeyMetaStore).(storage.MetaStore)
+	if !ok || store == nil {
+		logger.Errorf("%d POST unable to retrieve storage", http.StatusInternalServerError)
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+	reindexer, ok := store.(storage.ChangefeedReindexer)
+	if !ok {
+		logger.Errorf("%d POST storage does not support reindexing the changefeed", http.StatusNotImplemented)
+		return errors.ErrNotSupported.WithDetail(storage.ErrReindexNotSupported{}.Error())
+	}
+
+	var dryRun bool
+	if qs := r.URL.Query().Get("dry_run"); qs != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(qs); err != nil {
+			logger.Errorf("%d POST invalid dry_run: %s", http.StatusBadRequest, qs)
+			return errors.ErrInvalidParams.WithDetail("invalid dry_run parameter: " + err.Error())
+		}
+	}
+
+	result, err := reindexer.ReindexChanges(dryRun)
+	if _, ok := err.(storage.ErrReindexNotSupported); ok {
+		logger.Errorf("%d POST %s", http.StatusNotImplemented, err.Error())
+		return errors.ErrNotSupported.WithDetail(err.Error())
+	} else if err != nil {
+		logger.Errorf("%d POST could not reindex changefeed: %s", http.StatusInternalServerError, err.Error())
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	out, err := json.Marshal(&reindexResponse{DryRun: dryRun, ReindexResult: result})
+	if err != nil {
+		logger.Errorf("%d POST could not json.Marshal reindexResponse", http.StatusInternalServerError)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	if !dryRun {
+		logger.Infof("reindexed changefeed of %d changes: %d renumbered, %d added, %d removed",
+			result.NumberOfChanges, result.Renumbered, result.Added, result.Removed)
+	}
+	w.Write(out)
+	return nil
+}
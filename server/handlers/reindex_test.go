@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+func TestReindexChangefeedHandlerNoStorageOrUnsupported(t *testing.T) {
+	state := defaultState()
+	state.store = nil
+	req := httptest.NewRequest("POST", "/v2/_trust/changefeed/reindex", nil)
+	err := ReindexChangefeedHandler(getContext(state), httptest.NewRecorder(), req)
+	requireErrorCode(t, errors.ErrNoStorage, err)
+
+	// a TUFMetaStorage can be reindexed only if the store it wraps can be
+	state.store = storage.NewTUFMetaStorage(storage.NewRethinkDBStorage("db", "user", "pass", nil))
+	err = ReindexChangefeedHandler(getContext(state), httptest.NewRecorder(), req)
+	requireErrorCode(t, errors.ErrNotSupported, err)
+}
+
+func TestReindexChangefeedHandlerInvalidDryRun(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v2/_trust/changefeed/reindex?dry_run=maybe", nil)
+	err := ReindexChangefeedHandler(getContext(defaultState()), httptest.NewRecorder(), req)
+	requireErrorCode(t, errors.ErrInvalidParams, err)
+}
+
+func TestReindexChangefeedHandlerReportsResult(t *testing.T) {
+	s := storage.NewMemStorage()
+	require.NoError(t, s.UpdateCurrent("gun", storage.MetaUpdate{Role: "timestamp", Version: 1, Data: []byte("1")}))
+	state := defaultState()
+	state.store = storage.NewTUFMetaStorage(s)
+
+	for _, dryRun := range []bool{true, false} {
+		url := "/v2/_trust/changefeed/reindex"
+		if dryRun {
+			url += "?dry_run=true"
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, ReindexChangefeedHandler(getContext(state), rec, httptest.NewRequest("POST", url, nil)))
+
+		var resp reindexResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, reindexResponse{DryRun: dryRun, ReindexResult: storage.ReindexResult{NumberOfChanges: 1}}, resp)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/signlimit"
 	"github.com/theupdateframework/notary/server/storage"
 	"github.com/theupdateframework/notary/server/timestamp"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -76,11 +77,17 @@ func getMaybeServerSigned(ctx context.Context, store storage.MetaStore, gun data
 	if role != data.CanonicalTimestampRole && role != data.CanonicalSnapshotRole {
 		return nil, nil, fmt.Errorf("role %s cannot be server signed", role.String())
 	}
-	lastModified, out, err = timestamp.GetOrCreateTimestamp(gun, store, cryptoService)
+	// a new timestamp or snapshot is generated from, and written after, the
+	// metadata on the primary, which a read replica may not have yet
+	store = storage.Primary(store)
+	authority, _ := ctx.Value(notary.CtxKeyTimestampAuthority).(*timestamp.Authority)
+	lastModified, out, err = timestamp.GetOrCreateTimestamp(gun, store, cryptoService, authority)
 	if err != nil {
 		switch err.(type) {
 		case *storage.ErrNoKey, storage.ErrNotFound:
 			return nil, nil, errors.ErrMetadataNotFound.WithDetail(err)
+		case signlimit.ErrQueueTimeout:
+			return nil, nil, errors.ErrSigningUnavailable.WithDetail(nil)
 		default:
 			return nil, nil, errors.ErrUnknown.WithDetail(err)
 		}
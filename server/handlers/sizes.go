@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ctxu "github.com/docker/distribution/context"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+)
+
+// MetaSizesHandler returns the size of the metadata stored for each role of
+// each GUN, along with totals per GUN and for the whole store
+func MetaSizesHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	logger := ctxu.GetLogger(ctx)
+	store, ok := ctx.Value(notary.CtxKeyMetaStore).(storage.MetaStore)
+	if !ok {
+		logger.Errorf("%d GET unable to retrieve storage", http.StatusInternalServerError)
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+
+	sizes, err := storage.ComputeMetaSizes(store)
+	if err != nil {
+		logger.Errorf("%d GET could not compute metadata sizes: %s", http.StatusInternalServerError, err.Error())
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	out, err := json.Marshal(&sizes)
+	if err != nil {
+		logger.Errorf("%d GET could not json.Marshal metadata sizes", http.StatusInternalServerError)
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Write(out)
+	return nil
+}
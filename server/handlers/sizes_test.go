@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func TestMetaSizesHandlerNoStorage(t *testing.T) {
+	state := defaultState()
+	state.store = nil
+
+	req := httptest.NewRequest("GET", "/v2/_trust/sizes", nil)
+	err := MetaSizesHandler(getContext(state), httptest.NewRecorder(), req)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrNoStorage, errorObj.Code)
+}
+
+func TestMetaSizesHandlerReportsSizes(t *testing.T) {
+	s := storage.NewMemStorage()
+	require.NoError(t, s.UpdateMany("gun", []storage.MetaUpdate{
+		{Role: data.CanonicalRootRole, Version: 1, Data: []byte("root")},
+		{Role: data.CanonicalTargetsRole, Version: 1, Data: []byte("targets")},
+		{Role: data.CanonicalTargetsRole, Version: 2, Data: []byte("targets 2")},
+	}))
+	state := defaultState()
+	state.store = s
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, MetaSizesHandler(getContext(state), rec, httptest.NewRequest("GET", "/v2/_trust/sizes", nil)))
+
+	var resp storage.MetaSizes
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.GUNs, 1)
+	require.Equal(t, data.GUN("gun"), resp.GUNs[0].GUN)
+	require.Equal(t, []storage.RoleSize{
+		{Role: data.CanonicalRootRole, Versions: 1, CurrentBytes: 4, TotalBytes: 4},
+		{Role: data.CanonicalTargetsRole, Versions: 2, CurrentBytes: 9, TotalBytes: 16},
+	}, resp.GUNs[0].Roles)
+	require.EqualValues(t, 13, resp.GUNs[0].CurrentBytes)
+	require.EqualValues(t, 20, resp.GUNs[0].TotalBytes)
+	require.EqualValues(t, 13, resp.CurrentBytes)
+	require.EqualValues(t, 20, resp.TotalBytes)
+}
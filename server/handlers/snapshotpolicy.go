@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/validation"
+	"github.com/theupdateframework/notary/utils"
+)
+
+// requiresServerManagedSnapshot returns whether the snapshot of the GUN must
+// be managed by the server.  Each pattern is either a GUN, or a GUN prefix
+// followed by "*".
+func requiresServerManagedSnapshot(gun data.GUN, patterns []string) bool {
+	return utils.MatchGUNPattern(gun.String(), patterns)
+}
+
+// enforceServerManagedSnapshot rejects an update which would leave the
+// snapshot of a GUN managed by the client, when it must be managed by the
+// server: either an update which includes a snapshot, or one with a root
+// which delegates the snapshot role to a key not held by the server.
+// Malformed roots are left for validateUpdate to reject.
+func enforceServerManagedSnapshot(cs signed.CryptoService, gun data.GUN, updates []storage.MetaUpdate) error {
+	for _, update := range updates {
+		if update.Role != data.CanonicalRootRole {
+			continue
+		}
+		root := &data.SignedRoot{}
+		if err := json.Unmarshal(update.Data, root); err != nil {
+			continue
+		}
+		snapshotRole, ok := root.Signed.Roles[data.CanonicalSnapshotRole]
+		if !ok {
+			continue
+		}
+		for _, keyID := range snapshotRole.KeyIDs {
+			if cs.GetKey(keyID) == nil {
+				return validation.ErrBadRoot{
+					Msg: fmt.Sprintf("the snapshot of %s must be managed by the server, but the root delegates it to key %s, which the server does not hold", gun, keyID)}
+			}
+		}
+	}
+	for _, update := range updates {
+		if update.Role == data.CanonicalSnapshotRole {
+			return validation.ErrBadSnapshot{
+				Msg: fmt.Sprintf("the snapshot of %s must be managed by the server, so it cannot be uploaded", gun)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/testutils"
+	"github.com/theupdateframework/notary/tuf/validation"
+)
+
+func TestRequiresServerManagedSnapshot(t *testing.T) {
+	patterns := []string{"docker.io/library/*", "example.com/app"}
+	for gun, required := range map[data.GUN]bool{
+		"docker.io/library/alpine": true,
+		"docker.io/library/":       true,
+		"docker.io/other/alpine":   false,
+		"example.com/app":          true,
+		"example.com/app2":         false,
+		"example.com":              false,
+	} {
+		require.Equal(t, required, requiresServerManagedSnapshot(gun, patterns), gun.String())
+	}
+	require.False(t, requiresServerManagedSnapshot("example.com/app", nil))
+}
+
+// postSnapshotPolicyUpdate posts the metadata for the given roles of a repo to the atomic
+// update handler, with snapshots of the given GUN patterns required to be
+// managed by the server
+func postSnapshotPolicyUpdate(t *testing.T, state handlerState, gun data.GUN, patterns []string, metas map[data.RoleName][]byte) error {
+	parts := make(map[string][]byte, len(metas))
+	for role, meta := range metas {
+		parts[role.String()] = meta
+	}
+	req, err := store.NewMultiPartMetaRequest("", parts)
+	require.NoError(t, err)
+	ctx := context.WithValue(getContext(state), notary.CtxKeyServerManagedSnapshot, patterns)
+	return atomicUpdateHandler(ctx, httptest.NewRecorder(), req, map[string]string{"gun": gun.String()})
+}
+
+func requireInvalidUpdate(t *testing.T, err error, expected interface{}) {
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok, "Expected an errcode.Error, got %v", err)
+	require.Equal(t, errors.ErrInvalidUpdate, errorObj.Code)
+	serializable, ok := errorObj.Detail.(*validation.SerializableError)
+	require.True(t, ok, "Expected a SerializableObject, got %v", errorObj.Detail)
+	require.IsType(t, expected, serializable.Error)
+}
+
+// A GUN whose snapshot must be managed by the server can't be initialized,
+// rotated or updated with a snapshot managed by the client
+func TestServerManagedSnapshotEnforced(t *testing.T) {
+	var gun data.GUN = "docker.io/library/alpine"
+	patterns := []string{"docker.io/library/*"}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+
+	metaStore := storage.NewMemStorage()
+	state := handlerState{store: metaStore, crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole)}
+
+	// initializing with a snapshot key held by the client
+	err = postSnapshotPolicyUpdate(t, state, gun, patterns, map[data.RoleName][]byte{
+		data.CanonicalRootRole:     rs,
+		data.CanonicalTargetsRole:  tgs,
+		data.CanonicalSnapshotRole: sns,
+	})
+	requireInvalidUpdate(t, err, validation.ErrBadRoot{})
+
+	// the same update is accepted for a GUN which doesn't match
+	require.NoError(t, postSnapshotPolicyUpdate(t, state, gun, []string{"docker.io/other/*"}, map[data.RoleName][]byte{
+		data.CanonicalRootRole:     rs,
+		data.CanonicalTargetsRole:  tgs,
+		data.CanonicalSnapshotRole: sns,
+	}))
+
+	// once enforced, neither an update with a snapshot made by the client,
+	// nor a rotation of the root which keeps the client's snapshot key, is accepted
+	repo.Root.Signed.Version++
+	repo.Targets[data.CanonicalTargetsRole].Signed.Version++
+	repo.Snapshot.Signed.Version++
+	r, tg, sn, ts, err = testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, sns, _, err = testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+
+	err = postSnapshotPolicyUpdate(t, state, gun, patterns, map[data.RoleName][]byte{
+		data.CanonicalTargetsRole:  tgs,
+		data.CanonicalSnapshotRole: sns,
+	})
+	requireInvalidUpdate(t, err, validation.ErrBadSnapshot{})
+
+	err = postSnapshotPolicyUpdate(t, state, gun, patterns, map[data.RoleName][]byte{
+		data.CanonicalRootRole:     rs,
+		data.CanonicalTargetsRole:  tgs,
+		data.CanonicalSnapshotRole: sns,
+	})
+	requireInvalidUpdate(t, err, validation.ErrBadRoot{})
+}
+
+// A GUN whose snapshot must be managed by the server is updated as normal
+// when the server holds its snapshot key
+func TestServerManagedSnapshotAllowed(t *testing.T) {
+	var gun data.GUN = "docker.io/library/alpine"
+	patterns := []string{"docker.io/library/*"}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	rs, tgs, _, _, err := testutils.Serialize(r, tg, sn, ts)
+	require.NoError(t, err)
+
+	metaStore := storage.NewMemStorage()
+	state := handlerState{
+		store:  metaStore,
+		crypto: mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole),
+	}
+
+	require.NoError(t, postSnapshotPolicyUpdate(t, state, gun, patterns, map[data.RoleName][]byte{
+		data.CanonicalRootRole:    rs,
+		data.CanonicalTargetsRole: tgs,
+	}))
+	_, _, err = metaStore.GetCurrent(gun, data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+}
@@ -7,7 +7,9 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/docker/go/canonical/json"
+	"github.com/theupdateframework/notary/server/signlimit"
 	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/server/timestamp"
 	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -21,8 +23,9 @@ import (
 // A list of possibly modified updates are returned if all
 // validation was successful. This allows the snapshot to be
 // created and added if snapshotting has been delegated to the
-// server
-func validateUpdate(cs signed.CryptoService, gun data.GUN, updates []storage.MetaUpdate, store storage.MetaStore) ([]storage.MetaUpdate, error) {
+// server.  If authority is not nil, the generated timestamp carries a token
+// from that timestamping authority for the snapshot.
+func validateUpdate(cs signed.CryptoService, gun data.GUN, updates []storage.MetaUpdate, store storage.MetaStore, authority *timestamp.Authority) ([]storage.MetaUpdate, error) {
 
 	// some delegated targets role may be invalid based on other updates
 	// that have been made by other clients. We'll rebuild the slice of
@@ -49,6 +52,7 @@ func validateUpdate(cs signed.CryptoService, gun data.GUN, updates []storage.Met
 		}
 		builder = builder.BootstrapNewBuilder()
 		if err := builder.Load(data.CanonicalRootRole, rootUpdate.Data, currentRootVersion, false); err != nil {
+			countRejection(err)
 			return nil, validation.ErrBadRoot{Msg: err.Error()}
 		}
 
@@ -72,6 +76,7 @@ func validateUpdate(cs signed.CryptoService, gun data.GUN, updates []storage.Met
 	// At this point, root and targets must have been loaded into the repo
 	if snapshotUpdate, ok := roles[data.CanonicalSnapshotRole]; ok {
 		if err := builder.Load(data.CanonicalSnapshotRole, snapshotUpdate.Data, 1, false); err != nil {
+			countRejection(err)
 			return nil, validation.ErrBadSnapshot{Msg: err.Error()}
 		}
 		logrus.Debug("Successfully validated snapshot")
@@ -91,7 +96,7 @@ func validateUpdate(cs signed.CryptoService, gun data.GUN, updates []storage.Met
 	}
 
 	// generate a timestamp immediately
-	update, err := generateTimestamp(gun, builder, store)
+	update, err := generateTimestamp(gun, builder, store, authority)
 	if err != nil {
 		return nil, err
 	}
@@ -138,6 +143,7 @@ func loadAndValidateTargets(gun data.GUN, builder tuf.RepoBuilder, roles map[dat
 
 		if err := builder.Load(roleName, roles[roleName].Data, 1, false); err != nil {
 			logrus.Error("ErrBadTargets: ", err.Error())
+			countRejection(err)
 			return nil, validation.ErrBadTargets{Msg: err.Error()}
 		}
 		updatesToApply = append(updatesToApply, roles[roleName])
@@ -164,6 +170,12 @@ func generateSnapshot(gun data.GUN, builder tuf.RepoBuilder, store storage.MetaS
 		return nil, err
 	}
 
+	expiry, err := store.GetExpiry(gun, data.CanonicalSnapshotRole)
+	if err != nil {
+		return nil, err
+	}
+	builder.SetExpiry(data.CanonicalSnapshotRole, expiry)
+
 	meta, ver, err := builder.GenerateSnapshot(prev)
 
 	switch err.(type) {
@@ -176,9 +188,13 @@ func generateSnapshot(gun data.GUN, builder tuf.RepoBuilder, store storage.MetaS
 	case signed.ErrInsufficientSignatures, signed.ErrNoKeys, signed.ErrRoleThreshold:
 		// If we cannot sign the snapshot, then we don't have keys for the snapshot,
 		// and the client should have submitted a snapshot
-		return nil, validation.ErrBadHierarchy{
+		err := validation.ErrBadHierarchy{
 			Missing: data.CanonicalSnapshotRole.String(),
 			Msg:     "no snapshot was included in update and server does not hold current snapshot key for repository"}
+		countRejection(err)
+		return nil, err
+	case signlimit.ErrQueueTimeout:
+		return nil, err
 	default:
 		return nil, validation.ErrValidation{Msg: err.Error()}
 	}
@@ -186,7 +202,7 @@ func generateSnapshot(gun data.GUN, builder tuf.RepoBuilder, store storage.MetaS
 
 // generateTimestamp generates a new timestamp from the previous one in the store - this assumes all
 // the other roles have already been set on the repo, and will set the generated timestamp on the repo as well
-func generateTimestamp(gun data.GUN, builder tuf.RepoBuilder, store storage.MetaStore) (*storage.MetaUpdate, error) {
+func generateTimestamp(gun data.GUN, builder tuf.RepoBuilder, store storage.MetaStore, authority *timestamp.Authority) (*storage.MetaUpdate, error) {
 	var prev *data.SignedTimestamp
 	_, currentJSON, err := store.GetCurrent(gun, data.CanonicalTimestampRole)
 
@@ -203,7 +219,13 @@ func generateTimestamp(gun data.GUN, builder tuf.RepoBuilder, store storage.Meta
 		return nil, err
 	}
 
-	meta, ver, err := builder.GenerateTimestamp(prev)
+	expiry, err := store.GetExpiry(gun, data.CanonicalTimestampRole)
+	if err != nil {
+		return nil, err
+	}
+	builder.SetExpiry(data.CanonicalTimestampRole, expiry)
+
+	meta, ver, err := builder.GenerateTimestampWithCustom(prev, authority.SnapshotCustom)
 
 	switch err.(type) {
 	case nil:
@@ -218,6 +240,8 @@ func generateTimestamp(gun data.GUN, builder tuf.RepoBuilder, store storage.Meta
 		return nil, validation.ErrBadRoot{
 			Msg: "no timestamp keys exist on the server",
 		}
+	case signlimit.ErrQueueTimeout:
+		return nil, err
 	default:
 		return nil, validation.ErrValidation{Msg: err.Error()}
 	}
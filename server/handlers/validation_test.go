@@ -90,7 +90,7 @@ func TestValidateEmptyNew(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	updates, err = validateUpdate(serverCrypto, gun, updates, store)
+	updates, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 
 	// we generated our own timestamp, and did not take the other timestamp,
@@ -129,7 +129,7 @@ func TestValidateRootCanContainOnlyx509KeysWithRightGun(t *testing.T) {
 
 	_, err = validateUpdate(serverCrypto, gun,
 		[]storage.MetaUpdate{root, targets, snapshot, timestamp},
-		storage.NewMemStorage())
+		storage.NewMemStorage(), nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 
@@ -146,7 +146,7 @@ func TestValidateRootCanContainOnlyx509KeysWithRightGun(t *testing.T) {
 
 	_, err = validateUpdate(serverCrypto, gun,
 		[]storage.MetaUpdate{root, targets, snapshot, timestamp},
-		storage.NewMemStorage())
+		storage.NewMemStorage(), nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -167,7 +167,7 @@ func TestValidatePrevTimestamp(t *testing.T) {
 	store.UpdateCurrent(gun, timestamp)
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	updates, err = validateUpdate(serverCrypto, gun, updates, store)
+	updates, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 
 	// we generated our own timestamp, and did not take the other timestamp,
@@ -203,7 +203,7 @@ func TestValidatePreviousTimestampCorrupt(t *testing.T) {
 	store.UpdateCurrent(gun, timestamp)
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, &json.SyntaxError{}, err)
 }
@@ -226,7 +226,7 @@ func TestValidateGetCurrentTimestampBroken(t *testing.T) {
 	}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, data.ErrNoSuchRole{}, err)
 }
@@ -246,7 +246,7 @@ func TestValidateNoNewRoot(t *testing.T) {
 	updates := []storage.MetaUpdate{targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 }
 
@@ -265,7 +265,7 @@ func TestValidateNoNewTargets(t *testing.T) {
 	updates := []storage.MetaUpdate{root, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 }
 
@@ -286,7 +286,7 @@ func TestValidateOnlySnapshot(t *testing.T) {
 	updates := []storage.MetaUpdate{snapshot}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 }
 
@@ -305,7 +305,7 @@ func TestValidateOldRoot(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 }
 
@@ -329,7 +329,7 @@ func TestValidateOldRootCorrupt(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, &json.SyntaxError{}, err)
 }
@@ -362,7 +362,7 @@ func TestValidateOldRootCorruptRootRole(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, data.ErrInvalidMetadata{}, err)
 }
@@ -388,7 +388,7 @@ func TestValidateRootGetCurrentRootBroken(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, data.ErrNoSuchRole{}, err)
 }
@@ -424,7 +424,7 @@ func TestValidateRootRotationWithOldSigs(t *testing.T) {
 	root.Version = repo.Root.Signed.Version
 	snapshot.Version = repo.Snapshot.Signed.Version
 
-	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.NoError(t, err)
 	require.NoError(t, store.UpdateMany(gun, updates))
 
@@ -448,7 +448,7 @@ func TestValidateRootRotationWithOldSigs(t *testing.T) {
 	require.NoError(t, err)
 	root.Version = repo.Root.Signed.Version
 	snapshot.Version = repo.Snapshot.Signed.Version
-	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.NoError(t, err)
 	require.NoError(t, store.UpdateMany(gun, updates))
 
@@ -480,7 +480,7 @@ func TestValidateRootRotationWithOldSigs(t *testing.T) {
 	require.NoError(t, err)
 	root.Version = repo.Root.Signed.Version
 	snapshot.Version = repo.Snapshot.Signed.Version
-	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.NoError(t, err)
 }
 
@@ -549,7 +549,7 @@ func TestValidateRootRotationMultipleKeysThreshold1(t *testing.T) {
 	require.NoError(t, err)
 	root.Version = repo.Root.Signed.Version
 	snapshot.Version = repo.Snapshot.Signed.Version
-	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.NoError(t, err)
 }
 
@@ -607,7 +607,7 @@ func TestRootRotationNotSignedWithOldKeysForOldRole(t *testing.T) {
 	root, _, snapshot, _, err = getUpdates(r, tg, sn, ts)
 	require.NoError(t, err)
 
-	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "could not rotate trust to a new trusted root")
 
@@ -627,7 +627,7 @@ func TestRootRotationNotSignedWithOldKeysForOldRole(t *testing.T) {
 	root, _, snapshot, _, err = getUpdates(r, tg, sn, ts)
 	require.NoError(t, err)
 
-	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.NoError(t, err)
 }
 
@@ -662,13 +662,13 @@ func TestRootRotationVersionIncrement(t *testing.T) {
 	// Wrong root version
 	root.Version = repo.Root.Signed.Version + 1
 
-	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Root modifications must increment the version")
 
 	// correct root version
 	root.Version = root.Version - 1
-	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
+	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store, nil)
 	require.NoError(t, err)
 	require.NoError(t, store.UpdateMany(gun, updates))
 }
@@ -688,7 +688,7 @@ func TestValidateNoRoot(t *testing.T) {
 	updates := []storage.MetaUpdate{targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrValidation{}, err)
 }
@@ -707,7 +707,7 @@ func TestValidateSnapshotMissingNoSnapshotKey(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadHierarchy{}, err)
 }
@@ -726,7 +726,7 @@ func TestValidateSnapshotGenerateNoPrev(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 }
 
@@ -751,7 +751,7 @@ func TestValidateSnapshotGenerateWithPrev(t *testing.T) {
 	require.NoError(t, err)
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
-	updates, err = validateUpdate(serverCrypto, gun, updates, store)
+	updates, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 
 	for _, u := range updates {
@@ -785,7 +785,7 @@ func TestValidateSnapshotGeneratePrevCorrupt(t *testing.T) {
 	store.UpdateCurrent(gun, snapshot)
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, &json.SyntaxError{}, err)
 }
@@ -808,7 +808,7 @@ func TestValidateSnapshotGenerateStoreGetCurrentSnapshotBroken(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, data.ErrNoSuchRole{}, err)
 }
@@ -827,7 +827,7 @@ func TestValidateSnapshotGenerateNoTargets(t *testing.T) {
 	updates := []storage.MetaUpdate{root}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 }
 
@@ -847,7 +847,7 @@ func TestValidateSnapshotGenerate(t *testing.T) {
 	store.UpdateCurrent(gun, root)
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.NoError(t, err)
 }
 
@@ -869,7 +869,7 @@ func TestValidateRootNoTimestampKey(t *testing.T) {
 
 	// do not copy the targets key to the storage, and try to update the root
 	serverCrypto := signed.NewEd25519()
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 
@@ -899,7 +899,7 @@ func TestValidateRootInvalidTimestampKey(t *testing.T) {
 	_, err = serverCrypto.Create(data.CanonicalTimestampRole, gun, data.ED25519Key)
 	require.NoError(t, err)
 
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -926,7 +926,7 @@ func TestValidateRootInvalidTimestampThreshold(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -950,7 +950,7 @@ func TestValidateRootInvalidZeroThreshold(t *testing.T) {
 		updates := []storage.MetaUpdate{root, targets, snapshot}
 
 		serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-		_, err = validateUpdate(serverCrypto, gun, updates, store)
+		_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "invalid threshold")
 	}
@@ -975,7 +975,7 @@ func TestValidateRootRoleMissing(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -996,7 +996,7 @@ func TestValidateTargetsRoleMissing(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -1017,7 +1017,7 @@ func TestValidateSnapshotRoleMissing(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -1044,7 +1044,7 @@ func TestValidateRootSigMissing(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -1066,7 +1066,7 @@ func TestValidateTargetsSigMissing(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadTargets{}, err)
 }
@@ -1088,7 +1088,7 @@ func TestValidateSnapshotSigMissing(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadSnapshot{}, err)
 }
@@ -1113,7 +1113,7 @@ func TestValidateRootCorrupt(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -1135,7 +1135,7 @@ func TestValidateTargetsCorrupt(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadTargets{}, err)
 }
@@ -1157,7 +1157,7 @@ func TestValidateSnapshotCorrupt(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadSnapshot{}, err)
 }
@@ -1186,7 +1186,7 @@ func TestValidateRootModifiedSize(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadRoot{}, err)
 }
@@ -1209,7 +1209,7 @@ func TestValidateTargetsModifiedSize(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadSnapshot{}, err)
 }
@@ -1239,7 +1239,7 @@ func TestValidateRootModifiedHash(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadSnapshot{}, err)
 }
@@ -1266,7 +1266,7 @@ func TestValidateTargetsModifiedHash(t *testing.T) {
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
 
 	serverCrypto := mustCopyKeys(t, cs, data.CanonicalTimestampRole)
-	_, err = validateUpdate(serverCrypto, gun, updates, store)
+	_, err = validateUpdate(serverCrypto, gun, updates, store, nil)
 	require.Error(t, err)
 	require.IsType(t, validation.ErrBadSnapshot{}, err)
 }
@@ -0,0 +1,47 @@
+// Package meta defines the descriptions of stored TUF metadata which
+// notary-server sends to admin clients.  It does not depend on any storage
+// backend, so that clients can use it without linking them in.
+package meta
+
+import "github.com/theupdateframework/notary/tuf/data"
+
+// Record identifies a single stored version of a TUF role for a GUN
+type Record struct {
+	GUN     data.GUN      `json:"gun"`
+	Role    data.RoleName `json:"role"`
+	Version int           `json:"version"`
+	SHA256  string        `json:"sha256"`
+}
+
+// ExportedMeta is a single stored version of a TUF role for a GUN, along with
+// its data, in a form which does not depend on the storage backend
+type ExportedMeta struct {
+	Record
+	Data []byte `json:"data"`
+}
+
+// RoleSize is the size of the metadata stored for a role of a GUN
+type RoleSize struct {
+	Role data.RoleName `json:"role"`
+	// Versions is the number of versions of the role that are stored
+	Versions int `json:"versions"`
+	// CurrentBytes is the size of the latest version of the role
+	CurrentBytes int64 `json:"current_bytes"`
+	// TotalBytes is the size of every stored version of the role
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// GUNSize is the size of the metadata stored for a GUN, per role and in total
+type GUNSize struct {
+	GUN          data.GUN   `json:"gun"`
+	Roles        []RoleSize `json:"roles"`
+	CurrentBytes int64      `json:"current_bytes"`
+	TotalBytes   int64      `json:"total_bytes"`
+}
+
+// Sizes is the size of the metadata stored for every GUN in a store
+type Sizes struct {
+	GUNs         []GUNSize `json:"guns"`
+	CurrentBytes int64     `json:"current_bytes"`
+	TotalBytes   int64     `json:"total_bytes"`
+}
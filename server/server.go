@@ -7,14 +7,19 @@ import (
 	"net/http"
 	"strings"
 
+	ctxu "github.com/docker/distribution/context"
 	"github.com/docker/distribution/health"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/auth"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/auth/authz"
+	"github.com/theupdateframework/notary/server/auth/clientcert"
 	"github.com/theupdateframework/notary/server/errors"
 	"github.com/theupdateframework/notary/server/handlers"
+	"github.com/theupdateframework/notary/tracing"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 	"github.com/theupdateframework/notary/utils"
@@ -33,10 +38,19 @@ func prometheusOpts(operation string) prometheus.SummaryOpts {
 	}
 }
 
+// LivenessChecks holds the checks that the notary-server process itself is
+// healthy, which are served at /_notary_server/health/live.  The checks that
+// it can serve requests, such as that its storage backend and signer are
+// reachable, are registered in the default health registry instead and served
+// at /_notary_server/health/ready, so that an orchestrator can stop routing
+// requests to a server whose database is down without restarting it.
+var LivenessChecks = health.NewRegistry()
+
 // Config tells Run how to configure a server
 type Config struct {
 	Addr                         string
 	TLSConfig                    *tls.Config
+	StopTLSReload                func()
 	Trust                        signed.CryptoService
 	AuthMethod                   string
 	AuthOpts                     interface{}
@@ -49,6 +63,9 @@ type Config struct {
 // given configuration. The context it is passed is the context it should
 // use directly for the TLS server, and generate children off for requests
 func Run(ctx context.Context, conf Config) error {
+	if conf.StopTLSReload != nil {
+		defer conf.StopTLSReload()
+	}
 	tcpAddr, err := net.ResolveTCPAddr("tcp", conf.Addr)
 	if err != nil {
 		return err
@@ -65,7 +82,8 @@ func Run(ctx context.Context, conf Config) error {
 	}
 
 	var ac auth.AccessController
-	if conf.AuthMethod == "token" {
+	switch conf.AuthMethod {
+	case "token":
 		authOptions, ok := conf.AuthOpts.(map[string]interface{})
 		if !ok {
 			return fmt.Errorf("auth.options must be a map[string]interface{}")
@@ -74,6 +92,16 @@ func Run(ctx context.Context, conf Config) error {
 		if err != nil {
 			return err
 		}
+	case clientcert.Name:
+		// the client certificate auth options are optional
+		authOptions, ok := conf.AuthOpts.(map[string]interface{})
+		if !ok && conf.AuthOpts != nil {
+			return fmt.Errorf("auth.options must be a map[string]interface{}")
+		}
+		ac, err = auth.GetAccessController(conf.AuthMethod, authOptions)
+		if err != nil {
+			return err
+		}
 	}
 
 	svr := http.Server{
@@ -116,14 +144,41 @@ func filterImagePrefixes(requiredPrefixes []string, err error, handler http.Hand
 	})
 }
 
-// CreateHandler creates a server handler, wrapping with auth, caching, and monitoring
+// authorize wraps a handler so that, if there is an authorizer in the
+// context, the operation is only performed if the authenticated caller is
+// authorized to perform it on the requested GUN
+func authorize(operationName string, handler utils.ContextHandler) utils.ContextHandler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		authorizer, ok := ctx.Value(notary.CtxKeyAuthorizer).(authz.Authorizer)
+		if !ok {
+			return handler(ctx, w, r)
+		}
+		err := authorizer.Authorize(authz.Request{
+			Method:   operationName,
+			GUN:      data.GUN(mux.Vars(r)["gun"]),
+			Identity: ctxu.GetStringValue(ctx, auth.UserNameKey),
+		})
+		if err != nil {
+			ctxu.GetLogger(ctx).Infof("%d %s %s", http.StatusForbidden, r.Method, err.Error())
+			return errcode.ErrorCodeDenied.WithDetail(err.Error())
+		}
+		return handler(ctx, w, r)
+	}
+}
+
+// CreateHandler creates a server handler, wrapping with auth, caching, and monitoring.
+// Operations which require permissions are also authorized by name.
 func CreateHandler(operationName string, serverHandler utils.ContextHandler, errorIfGUNInvalid error, includeCacheHeaders bool, cacheControlConfig utils.CacheControlConfig, permissionsRequired []string, authWrapper utils.AuthWrapper, repoPrefixes []string) http.Handler {
+	if len(permissionsRequired) > 0 {
+		serverHandler = authorize(operationName, serverHandler)
+	}
 	var wrapped http.Handler
 	wrapped = authWrapper(serverHandler, permissionsRequired...)
 	if includeCacheHeaders {
 		wrapped = utils.WrapWithCacheHandler(cacheControlConfig, wrapped)
 	}
 	wrapped = filterImagePrefixes(repoPrefixes, errorIfGUNInvalid, wrapped)
+	wrapped = tracing.HTTPHandler("notary.server."+operationName, wrapped)
 	return prometheus.InstrumentHandlerWithOpts(prometheusOpts(operationName), wrapped) //lint:ignore SA1019 TODO update prometheus API
 }
 
@@ -133,6 +188,7 @@ func RootHandler(ctx context.Context, ac auth.AccessController, trust signed.Cry
 	consistent, current utils.CacheControlConfig, repoPrefixes []string) http.Handler {
 
 	authWrapper := utils.RootHandlerFactory(ctx, ac, trust)
+	noAuthWrapper := utils.RootHandlerFactory(ctx, nil, trust)
 
 	invalidGUNErr := errors.ErrInvalidGUN.WithDetail(fmt.Sprintf("Require GUNs with prefix: %v", repoPrefixes))
 	notFoundError := errors.ErrMetadataNotFound.WithDetail(nil)
@@ -179,6 +235,16 @@ func RootHandler(ctx context.Context, ac auth.AccessController, trust signed.Cry
 		authWrapper,
 		repoPrefixes,
 	))
+	r.Methods("GET").Path("/v2/{gun:[^*]+}/_trust/public/root.json").Handler(CreateHandler(
+		"GetPublicRoot",
+		handlers.PublicRootHandler,
+		notFoundError,
+		true,
+		current,
+		nil,
+		noAuthWrapper,
+		repoPrefixes,
+	))
 	r.Methods("GET").Path(
 		"/v2/{gun:[^*]+}/_trust/tuf/{tufRole:snapshot|timestamp}.key").Handler(CreateHandler(
 		"GetKey",
@@ -201,6 +267,39 @@ func RootHandler(ctx context.Context, ac auth.AccessController, trust signed.Cry
 		authWrapper,
 		repoPrefixes,
 	))
+	r.Methods("GET").Path(
+		"/v2/{gun:[^*]+}/_trust/tuf/{tufRole:snapshot|timestamp}.expiry").Handler(CreateHandler(
+		"GetExpiry",
+		handlers.GetExpiryHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("PUT").Path(
+		"/v2/{gun:[^*]+}/_trust/tuf/{tufRole:snapshot|timestamp}.expiry").Handler(CreateHandler(
+		"SetExpiry",
+		handlers.SetExpiryHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("DELETE").Path(
+		"/v2/{gun:[^*]+}/_trust/tuf/{tufRole:snapshot|timestamp}.expiry").Handler(CreateHandler(
+		"DeleteExpiry",
+		handlers.DeleteExpiryHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
 	r.Methods("DELETE").Path("/v2/{gun:[^*]+}/_trust/tuf/").Handler(CreateHandler(
 		"DeleteTUF",
 		handlers.DeleteHandler,
@@ -231,7 +330,69 @@ func RootHandler(ctx context.Context, ac auth.AccessController, trust signed.Cry
 		authWrapper,
 		repoPrefixes,
 	))
+	r.Methods("POST").Path("/v2/_trust/gc").Handler(CreateHandler(
+		"GarbageCollect",
+		handlers.GarbageCollectHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("POST").Path("/v2/_trust/changefeed/reindex").Handler(CreateHandler(
+		"ReindexChangefeed",
+		handlers.ReindexChangefeedHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("GET").Path("/v2/_trust/export").Handler(CreateHandler(
+		"Export",
+		handlers.ExportHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("GET").Path("/v2/_trust/sizes").Handler(CreateHandler(
+		"MetaSizes",
+		handlers.MetaSizesHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("GET").Path("/v2/_trust/config").Handler(CreateHandler(
+		"GetConfig",
+		handlers.ConfigHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("GET").Path("/v2/_trust/metrics").Handler(CreateHandler(
+		"MetricsSnapshot",
+		handlers.MetricsSnapshotHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
 	r.Methods("GET").Path("/_notary_server/health").HandlerFunc(health.StatusHandler)
+	r.Methods("GET").Path("/_notary_server/health/live").HandlerFunc(handlers.HealthHandler(LivenessChecks))
+	r.Methods("GET").Path("/_notary_server/health/ready").HandlerFunc(handlers.HealthHandler(health.DefaultRegistry))
 	r.Methods("GET").Path("/metrics").Handler(prometheus.Handler()) //lint:ignore SA1019 TODO update prometheus API
 	r.Methods("GET", "POST", "PUT", "HEAD", "DELETE").Path("/{other:.*}").Handler(
 		authWrapper(handlers.NotFoundHandler))
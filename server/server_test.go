@@ -3,6 +3,9 @@ package server
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -12,9 +15,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/docker/distribution/registry/auth"
 	_ "github.com/docker/distribution/registry/auth/silly"
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/auth/authz"
+	"github.com/theupdateframework/notary/server/auth/clientcert"
 	"github.com/theupdateframework/notary/server/storage"
 	store "github.com/theupdateframework/notary/storage"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -151,6 +157,55 @@ func TestMetricsEndpoint(t *testing.T) {
 	require.Equal(t, http.StatusOK, res.StatusCode)
 }
 
+func TestHealthEndpoints(t *testing.T) {
+	handler := RootHandler(context.Background(), nil, signed.NewEd25519(),
+		nil, nil, nil)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	for _, endpoint := range []string{"health", "health/live", "health/ready"} {
+		res, err := http.Get(ts.URL + "/_notary_server/" + endpoint)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode, endpoint)
+	}
+}
+
+// The expiry endpoints support only the timestamp and snapshot roles, and the
+// expiry they set is used by the store
+func TestExpiryEndpoints(t *testing.T) {
+	s := storage.NewMemStorage()
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, s)
+
+	handler := RootHandler(ctx, nil, signed.NewEd25519(), nil, nil, nil)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	do := func(method string, role data.RoleName, body string) int {
+		req, err := http.NewRequest(method,
+			fmt.Sprintf("%s/v2/gun/_trust/tuf/%s.expiry", ts.URL, role), bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	require.Equal(t, http.StatusOK, do("PUT", data.CanonicalSnapshotRole, `{"expiry": "48h"}`))
+	require.Equal(t, http.StatusOK, do("GET", data.CanonicalSnapshotRole, ""))
+	expiry, err := s.GetExpiry("gun", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Equal(t, 48*time.Hour, expiry)
+
+	require.Equal(t, http.StatusBadRequest, do("PUT", data.CanonicalTimestampRole, `{"expiry": "1m"}`))
+	require.Equal(t, http.StatusNotFound, do("PUT", data.CanonicalTargetsRole, `{"expiry": "48h"}`))
+	require.Equal(t, http.StatusNotFound, do("PUT", data.CanonicalRootRole, `{"expiry": "48h"}`))
+
+	require.Equal(t, http.StatusOK, do("DELETE", data.CanonicalSnapshotRole, ""))
+	expiry, err = s.GetExpiry("gun", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Zero(t, expiry)
+}
+
 // GetKeys supports only the timestamp and snapshot key endpoints
 func TestGetKeysEndpoint(t *testing.T) {
 	ctx := context.WithValue(
@@ -354,6 +409,150 @@ func TestGetCurrentRole(t *testing.T) {
 }
 
 // Verifies that the body is as expected  and that there are cache control headers
+// The public root endpoint serves root.json, with cache headers, without
+// authentication, but only if the server is configured to serve it.  Every
+// other role still requires authentication.
+func TestGetPublicRoot(t *testing.T) {
+	var gun data.GUN = "docker.io/notary"
+	meta, _, err := testutils.NewRepoMetadata(gun)
+	require.NoError(t, err)
+	metaStore := storage.NewMemStorage()
+	for role, blob := range meta {
+		require.NoError(t, metaStore.UpdateCurrent(gun, storage.MetaUpdate{Role: role, Version: 1, Data: blob}))
+	}
+
+	ac, err := auth.GetAccessController("silly", map[string]interface{}{"realm": "realm", "service": "service"})
+	require.NoError(t, err)
+	ccc := utils.NewCacheControlConfig(10, false)
+
+	for _, enabled := range []bool{true, false} {
+		ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, metaStore)
+		ctx = context.WithValue(ctx, notary.CtxKeyPublicRoot, enabled)
+		serv := httptest.NewServer(RootHandler(ctx, ac, signed.NewEd25519(), ccc, ccc, nil))
+
+		res, err := http.Get(fmt.Sprintf("%s/v2/%s/_trust/public/root.json", serv.URL, gun))
+		require.NoError(t, err)
+		if enabled {
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			verifyGetResponse(t, res, meta[data.CanonicalRootRole])
+		} else {
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		}
+		res.Body.Close()
+
+		for _, path := range []string{"tuf/root.json", "tuf/targets.json", "public/targets.json"} {
+			res, err = http.Get(fmt.Sprintf("%s/v2/%s/_trust/%s", serv.URL, gun, path))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode, path)
+			res.Body.Close()
+		}
+		serv.Close()
+	}
+}
+
+// With client certificate auth, metadata can be read without a client
+// certificate, but publishing or deleting it requires a verified one.
+func TestClientCertAuth(t *testing.T) {
+	var gun data.GUN = "docker.io/notary"
+	meta, _, err := testutils.NewRepoMetadata(gun)
+	require.NoError(t, err)
+	metaStore := storage.NewMemStorage()
+	for role, blob := range meta {
+		require.NoError(t, metaStore.UpdateCurrent(gun, storage.MetaUpdate{Role: role, Version: 1, Data: blob}))
+	}
+
+	ac, err := auth.GetAccessController(clientcert.Name, nil)
+	require.NoError(t, err)
+	ccc := utils.NewCacheControlConfig(10, false)
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, metaStore)
+	handler := RootHandler(ctx, ac, signed.NewEd25519(), ccc, ccc, nil)
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{
+		{{Subject: pkix.Name{CommonName: "publisher"}}},
+	}}
+	serve := func(method, path string, state *tls.ConnectionState) int {
+		req := httptest.NewRequest(method, fmt.Sprintf("/v2/%s/_trust/%s", gun, path), nil)
+		req.TLS = state
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, state := range []*tls.ConnectionState{nil, {}, verified} {
+		require.Equal(t, http.StatusOK, serve("GET", "tuf/root.json", state))
+		require.Equal(t, http.StatusOK, serve("GET", "tuf/1.targets.json", state))
+	}
+
+	for _, state := range []*tls.ConnectionState{nil, {}} {
+		require.Equal(t, http.StatusUnauthorized, serve("POST", "tuf/", state))
+		require.Equal(t, http.StatusUnauthorized, serve("DELETE", "tuf/", state))
+		require.Equal(t, http.StatusUnauthorized, serve("GET", "tuf/snapshot.key", state))
+	}
+	// the request is authorized, but has no metadata to publish
+	require.Equal(t, http.StatusBadRequest, serve("POST", "tuf/", verified))
+	require.Equal(t, http.StatusOK, serve("DELETE", "tuf/", verified))
+	_, _, err = metaStore.GetCurrent(gun, data.CanonicalRootRole)
+	require.IsType(t, storage.ErrNotFound{}, err)
+}
+
+// With an authorizer, authenticated callers may only perform the operations
+// it allows them to on each GUN.
+func TestAuthorizedOperations(t *testing.T) {
+	var allowedGUN, otherGUN data.GUN = "docker.io/notary", "example.com/notary"
+	metaStore := storage.NewMemStorage()
+	for _, gun := range []data.GUN{allowedGUN, otherGUN} {
+		meta, _, err := testutils.NewRepoMetadata(gun)
+		require.NoError(t, err)
+		for role, blob := range meta {
+			require.NoError(t, metaStore.UpdateCurrent(gun, storage.MetaUpdate{Role: role, Version: 1, Data: blob}))
+		}
+	}
+
+	authorizer, err := authz.New(authz.RBACName, map[string]interface{}{
+		"roles": map[string]interface{}{
+			"reader":  []interface{}{"GetRole"},
+			"deleter": []interface{}{"DeleteTUF"},
+		},
+		"bindings": []interface{}{
+			map[string]interface{}{"identities": []interface{}{"*"}, "guns": []interface{}{"docker.io/*"}, "roles": []interface{}{"reader"}},
+			map[string]interface{}{"identities": []interface{}{"publisher"}, "guns": []interface{}{"docker.io/*"}, "roles": []interface{}{"deleter"}},
+		},
+	})
+	require.NoError(t, err)
+	ac, err := auth.GetAccessController(clientcert.Name, nil)
+	require.NoError(t, err)
+	ccc := utils.NewCacheControlConfig(10, false)
+	ctx := context.WithValue(context.Background(), notary.CtxKeyMetaStore, metaStore)
+	ctx = context.WithValue(ctx, notary.CtxKeyAuthorizer, authorizer)
+	handler := RootHandler(ctx, ac, signed.NewEd25519(), ccc, ccc, nil)
+
+	serve := func(method string, gun data.GUN, path, identity string) int {
+		req := httptest.NewRequest(method, fmt.Sprintf("/v2/%s/_trust/%s", gun, path), nil)
+		if identity != "" {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{
+				{{Subject: pkix.Name{CommonName: identity}}},
+			}}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, identity := range []string{"", "reader", "publisher"} {
+		require.Equal(t, http.StatusOK, serve("GET", allowedGUN, "tuf/root.json", identity))
+		require.Equal(t, http.StatusForbidden, serve("GET", otherGUN, "tuf/root.json", identity))
+		// not granted by any role
+		require.Equal(t, http.StatusForbidden, serve("GET", allowedGUN, "tuf/1.root.json", identity))
+	}
+	require.Equal(t, http.StatusForbidden, serve("DELETE", allowedGUN, "tuf/", "reader"))
+	require.Equal(t, http.StatusForbidden, serve("DELETE", otherGUN, "tuf/", "publisher"))
+	require.Equal(t, http.StatusOK, serve("DELETE", allowedGUN, "tuf/", "publisher"))
+	_, _, err = metaStore.GetCurrent(allowedGUN, data.CanonicalRootRole)
+	require.IsType(t, storage.ErrNotFound{}, err)
+	_, _, err = metaStore.GetCurrent(otherGUN, data.CanonicalRootRole)
+	require.NoError(t, err)
+}
+
 func verifyGetResponse(t *testing.T, r *http.Response, expectedBytes []byte) {
 	body, err := ioutil.ReadAll(r.Body)
 	require.NoError(t, err)
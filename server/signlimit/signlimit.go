@@ -0,0 +1,107 @@
+// Package signlimit bounds how many signing operations the server makes to
+// its signer at once, so that a storm of publishes queues up on the server
+// rather than overwhelming the signer.
+package signlimit
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/theupdateframework/notary/tracing"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+)
+
+// ErrQueueTimeout is returned when a signing operation waited longer than the
+// queue timeout for one of the other signing operations to finish
+type ErrQueueTimeout struct {
+	Limit   int
+	Timeout time.Duration
+}
+
+func (err ErrQueueTimeout) Error() string {
+	return fmt.Sprintf("timed out after %s waiting to sign: %d signing operations are already in progress",
+		err.Timeout, err.Limit)
+}
+
+// CryptoService is a signed.CryptoService which makes at most a limited number
+// of signing operations at once, queuing any more until one finishes
+type CryptoService struct {
+	signed.CryptoService
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// NewCryptoService wraps cs so that at most limit of the signatures made with
+// its private keys are being made at once.  Signing operations over the limit
+// wait for up to timeout for one of the others to finish, and fail with
+// ErrQueueTimeout if none does.  A timeout of 0 waits indefinitely.
+func NewCryptoService(cs signed.CryptoService, limit int, timeout time.Duration) (*CryptoService, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("the signing concurrency limit must be at least 1, not %d", limit)
+	}
+	if timeout < 0 {
+		return nil, fmt.Errorf("the signing queue timeout must not be negative")
+	}
+	return &CryptoService{
+		CryptoService: cs,
+		slots:         make(chan struct{}, limit),
+		timeout:       timeout,
+	}, nil
+}
+
+// GetPrivateKey returns the private key with the given key ID, signing with
+// which counts against the limit
+func (cs *CryptoService) GetPrivateKey(keyID string) (data.PrivateKey, data.RoleName, error) {
+	privKey, role, err := cs.CryptoService.GetPrivateKey(keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	return limitedPrivateKey{PrivateKey: privKey, cs: cs}, role, nil
+}
+
+// acquire waits for a signing operation to be allowed to start
+func (cs *CryptoService) acquire() error {
+	if cs.timeout == 0 {
+		cs.slots <- struct{}{}
+		return nil
+	}
+	timer := time.NewTimer(cs.timeout)
+	defer timer.Stop()
+	select {
+	case cs.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrQueueTimeout{Limit: cap(cs.slots), Timeout: cs.timeout}
+	}
+}
+
+func (cs *CryptoService) release() {
+	<-cs.slots
+}
+
+type limitedPrivateKey struct {
+	data.PrivateKey
+	cs *CryptoService
+}
+
+// Sign signs once fewer signing operations than the limit are in progress
+func (k limitedPrivateKey) Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.SignContext(context.Background(), rand, msg, opts)
+}
+
+// SignContext is Sign, propagating the trace of the span held by the context
+// to the key if it supports it
+func (k limitedPrivateKey) SignContext(ctx context.Context, rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := k.cs.acquire(); err != nil {
+		return nil, err
+	}
+	defer k.cs.release()
+	if traced, ok := k.PrivateKey.(tracing.ContextSigner); ok {
+		return traced.SignContext(ctx, rand, msg, opts)
+	}
+	return k.PrivateKey.Sign(rand, msg, opts)
+}
@@ -0,0 +1,144 @@
+package signlimit
+
+import (
+	"crypto"
+	"crypto/rand"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	canonicaljson "github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+// fakeSigner is a crypto service whose private keys track how many signatures
+// are being made at once, and hold each signature until released
+type fakeSigner struct {
+	signed.CryptoService
+	key     data.PrivateKey
+	release chan struct{}
+
+	mu            sync.Mutex
+	inFlight, max int
+	signed        int
+}
+
+func newFakeSigner(t *testing.T) *fakeSigner {
+	key, err := utils.GenerateED25519Key(rand.Reader)
+	require.NoError(t, err)
+	return &fakeSigner{key: key, release: make(chan struct{})}
+}
+
+func (s *fakeSigner) GetPrivateKey(keyID string) (data.PrivateKey, data.RoleName, error) {
+	return fakeKey{PrivateKey: s.key, signer: s}, data.CanonicalTimestampRole, nil
+}
+
+func (s *fakeSigner) maxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.max
+}
+
+type fakeKey struct {
+	data.PrivateKey
+	signer *fakeSigner
+}
+
+func (k fakeKey) Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s := k.signer
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.max {
+		s.max = s.inFlight
+	}
+	s.mu.Unlock()
+
+	<-s.release
+
+	s.mu.Lock()
+	s.inFlight--
+	s.signed++
+	s.mu.Unlock()
+	return k.PrivateKey.Sign(rand, msg, opts)
+}
+
+func sign(cs signed.CryptoService) error {
+	privKey, _, err := cs.GetPrivateKey("keyID")
+	if err != nil {
+		return err
+	}
+	_, err = privKey.Sign(rand.Reader, []byte("metadata"), nil)
+	return err
+}
+
+func TestCryptoServiceLimitsConcurrency(t *testing.T) {
+	fake := newFakeSigner(t)
+	cs, err := NewCryptoService(fake, 3, 0)
+	require.NoError(t, err)
+
+	const requests = 20
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() { errs <- sign(cs) }()
+	}
+
+	// only as many signatures as the limit are started, and the rest queue
+	// until they finish
+	require.Eventually(t, func() bool { return fake.maxInFlight() == 3 }, time.Second, time.Millisecond)
+	for i := 0; i < requests; i++ {
+		fake.release <- struct{}{}
+	}
+	for i := 0; i < requests; i++ {
+		require.NoError(t, <-errs)
+	}
+	require.Equal(t, 3, fake.maxInFlight())
+	require.Equal(t, requests, fake.signed)
+}
+
+func TestCryptoServiceQueueTimeout(t *testing.T) {
+	fake := newFakeSigner(t)
+	cs, err := NewCryptoService(fake, 1, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	held := make(chan error)
+	go func() { held <- sign(cs) }()
+	require.Eventually(t, func() bool { return fake.maxInFlight() == 1 }, time.Second, time.Millisecond)
+
+	// a signature queued behind the held one gives up after the timeout
+	err = sign(cs)
+	require.Equal(t, ErrQueueTimeout{Limit: 1, Timeout: 10 * time.Millisecond}, err)
+	require.Contains(t, err.Error(), "timed out after 10ms waiting to sign")
+
+	// and once the held one finishes, signing can start again
+	fake.release <- struct{}{}
+	require.NoError(t, <-held)
+	go func() { fake.release <- struct{}{} }()
+	require.NoError(t, sign(cs))
+	require.Equal(t, 2, fake.signed)
+}
+
+func TestNewCryptoServiceInvalid(t *testing.T) {
+	_, err := NewCryptoService(signed.NewEd25519(), 0, time.Second)
+	require.Error(t, err)
+	_, err = NewCryptoService(signed.NewEd25519(), 1, -time.Second)
+	require.Error(t, err)
+}
+
+// Failing to get a private key does not take up a signing slot
+func TestCryptoServiceGetPrivateKeyError(t *testing.T) {
+	cs, err := NewCryptoService(signed.NewEd25519(), 1, time.Millisecond)
+	require.NoError(t, err)
+	_, _, err = cs.GetPrivateKey("nonexistent")
+	require.Error(t, err)
+
+	key, err := cs.Create(data.CanonicalTimestampRole, "gun", data.ED25519Key)
+	require.NoError(t, err)
+	raw := canonicaljson.RawMessage("{}")
+	s := &data.Signed{Signed: &raw}
+	require.NoError(t, signed.Sign(cs, s, []data.PublicKey{key}, 1, nil))
+	require.Len(t, s.Signatures, 1)
+}
@@ -97,6 +97,12 @@ func GetOrCreateSnapshot(gun data.GUN, checksum string, store storage.MetaStore,
 		return nil, nil, err
 	}
 
+	expiry, err := store.GetExpiry(gun, data.CanonicalSnapshotRole)
+	if err != nil {
+		return nil, nil, err
+	}
+	builder.SetExpiry(data.CanonicalSnapshotRole, expiry)
+
 	meta, _, err := builder.GenerateSnapshot(prev)
 	if err != nil {
 		return nil, nil, err
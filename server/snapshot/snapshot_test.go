@@ -231,6 +231,42 @@ func TestGetSnapshotOldSnapshotExpired(t *testing.T) {
 	require.True(t, signedMeta.Signed.Expires.After(time.Now()))
 }
 
+// A newly generated snapshot expires after the expiry set for its GUN, or the
+// default for snapshots if none is set
+func TestGetSnapshotHonorsGUNExpiry(t *testing.T) {
+	for _, expiry := range []time.Duration{0, 48 * time.Hour} {
+		store := storage.NewMemStorage()
+		repo, crypto, err := testutils.EmptyRepo("gun")
+		require.NoError(t, err)
+
+		sgnd, err := repo.SignRoot(data.DefaultExpires(data.CanonicalRootRole), nil)
+		require.NoError(t, err)
+		rootJSON, err := json.Marshal(sgnd)
+		require.NoError(t, err)
+		sgnd, err = repo.SignSnapshot(time.Now().AddDate(-1, -1, -1))
+		require.NoError(t, err)
+		snapshotJSON, err := json.Marshal(sgnd)
+		require.NoError(t, err)
+		require.NoError(t, store.UpdateCurrent("gun",
+			storage.MetaUpdate{Role: data.CanonicalRootRole, Version: 0, Data: rootJSON}))
+		require.NoError(t, store.UpdateCurrent("gun",
+			storage.MetaUpdate{Role: data.CanonicalSnapshotRole, Version: 0, Data: snapshotJSON}))
+		require.NoError(t, store.SetExpiry("gun", data.CanonicalSnapshotRole, expiry))
+
+		hashBytes := sha256.Sum256(snapshotJSON)
+		_, gottenSnapshot, err := GetOrCreateSnapshot("gun", hex.EncodeToString(hashBytes[:]), store, crypto)
+		require.NoError(t, err)
+		signedMeta := &data.SignedMeta{}
+		require.NoError(t, json.Unmarshal(gottenSnapshot, signedMeta))
+
+		expected := data.DefaultExpires(data.CanonicalSnapshotRole)
+		if expiry != 0 {
+			expected = time.Now().Add(expiry)
+		}
+		require.WithinDuration(t, expected, signedMeta.Signed.Expires, time.Minute)
+	}
+}
+
 // If the root is missing or corrupt, no snapshot can be generated
 func TestCannotMakeNewSnapshotIfNoRoot(t *testing.T) {
 	repo, crypto, err := testutils.EmptyRepo("gun")
@@ -50,3 +50,21 @@ type ErrBadQuery struct {
 func (err ErrBadQuery) Error() string {
 	return fmt.Sprintf("did not recognize parameters: %s", err.msg)
 }
+
+// ErrReindexNotSupported is returned when the storage backend's changefeed
+// can't be reindexed, for instance because it is ordered by creation time
+// rather than by a sequence of change IDs
+type ErrReindexNotSupported struct{}
+
+func (err ErrReindexNotSupported) Error() string {
+	return "the storage backend does not support reindexing the changefeed"
+}
+
+// ErrGCNotSupported is returned when the storage backend can't remove
+// unreferenced metadata without racing concurrent publishes, because it
+// can't read and delete the metadata atomically
+type ErrGCNotSupported struct{}
+
+func (err ErrGCNotSupported) Error() string {
+	return "the storage backend does not support garbage collecting metadata"
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// ExportMeta writes every stored version of every role in the store to w, as
+// a stream of JSON encoded ExportedMeta, one per line.  It returns the number
+// of versions written.
+func ExportMeta(store MetaStore, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	count := 0
+	err := store.Export(func(meta ExportedMeta) error {
+		if err := enc.Encode(meta); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// importBatchSize is the most versions ImportMeta adds with a single call to
+// UpdateMany.
+const importBatchSize = 100
+
+// ImportMeta reads a stream of metadata written by ExportMeta and adds it to
+// the store, keeping its versions.  Entries are decoded one at a time, and
+// consecutive versions of the same GUN are added in batches of at most
+// importBatchSize with UpdateMany, so the export is never held in memory.
+// The versions of each role must therefore be in increasing order, as
+// ExportMeta writes them.  The checksum of every version is verified before
+// its batch is added.  If the import fails, the batches already added are
+// kept, and the number of versions imported until then is returned with the
+// error.
+func ImportMeta(store MetaStore, r io.Reader) (int, error) {
+	var (
+		gun     data.GUN
+		updates []MetaUpdate
+		count   int
+	)
+	flush := func() error {
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := store.UpdateMany(gun, updates); err != nil {
+			return fmt.Errorf("unable to import metadata for %s: %v", gun, err)
+		}
+		count += len(updates)
+		updates = updates[:0]
+		return nil
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var meta ExportedMeta
+		if err := dec.Decode(&meta); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, fmt.Errorf("unable to parse exported metadata: %v", err)
+		}
+		if meta.GUN == "" || meta.Role == "" {
+			return count, fmt.Errorf("exported metadata is missing a GUN or role")
+		}
+		checksum := sha256.Sum256(meta.Data)
+		if meta.SHA256 != hex.EncodeToString(checksum[:]) {
+			return count, fmt.Errorf("checksum of %s %s version %d does not match its data",
+				meta.GUN, meta.Role, meta.Version)
+		}
+		if meta.GUN != gun || len(updates) == importBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+			gun = meta.GUN
+		}
+		updates = append(updates, MetaUpdate{Role: meta.Role, Version: meta.Version, Data: meta.Data})
+	}
+	return count, flush()
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// checksumGetter retrieves the data of a single stored TUF file by checksum
+type checksumGetter func(gun data.GUN, role data.RoleName, checksum string) ([]byte, error)
+
+// findOrphans returns the records which are not referenced by the current
+// timestamp of their GUN, either directly or via the snapshot it references.
+// A record is considered orphaned if it is a version of a role newer than the
+// version referenced by the current snapshot (for instance left over by a
+// partial publish), or if it belongs to a delegation which the current
+// snapshot no longer lists at all.  Older versions of referenced roles are
+// kept, since clients may still request them by version or checksum.
+//
+// GUNs whose current timestamp or snapshot cannot be found are skipped
+// entirely, since there is no way to tell which of their records are current.
+func findOrphans(records []MetaRecord, getChecksum checksumGetter) ([]MetaRecord, error) {
+	byGUN := make(map[data.GUN][]MetaRecord)
+	var guns []data.GUN
+	for _, r := range records {
+		if _, ok := byGUN[r.GUN]; !ok {
+			guns = append(guns, r.GUN)
+		}
+		byGUN[r.GUN] = append(byGUN[r.GUN], r)
+	}
+
+	var orphans []MetaRecord
+	for _, gun := range guns {
+		current, err := currentVersions(gun, byGUN[gun], getChecksum)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			continue
+		}
+		for _, r := range byGUN[gun] {
+			version, ok := current[r.Role]
+			switch {
+			case ok && r.Version > version:
+				orphans = append(orphans, r)
+			case !ok && data.IsDelegation(r.Role):
+				orphans = append(orphans, r)
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// currentVersions returns the version of each role referenced by the current
+// timestamp and snapshot for a GUN, or nil if they cannot be determined
+func currentVersions(gun data.GUN, records []MetaRecord, getChecksum checksumGetter) (map[data.RoleName]int, error) {
+	var timestamp *MetaRecord
+	bySHA256 := make(map[string]MetaRecord)
+	for i, r := range records {
+		bySHA256[r.SHA256] = r
+		if r.Role == data.CanonicalTimestampRole && (timestamp == nil || r.Version > timestamp.Version) {
+			timestamp = &records[i]
+		}
+	}
+	if timestamp == nil {
+		return nil, nil
+	}
+
+	tsJSON, err := getChecksum(gun, data.CanonicalTimestampRole, timestamp.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	ts := &data.SignedTimestamp{}
+	if err := json.Unmarshal(tsJSON, ts); err != nil {
+		return nil, fmt.Errorf("could not parse current timestamp for %s: %v", gun, err)
+	}
+	snapshotMeta, err := ts.GetSnapshot()
+	if err != nil {
+		return nil, nil
+	}
+	snapshot, ok := bySHA256[hex.EncodeToString(snapshotMeta.Hashes[notary.SHA256])]
+	if !ok || snapshot.Role != data.CanonicalSnapshotRole {
+		return nil, nil
+	}
+
+	snapshotJSON, err := getChecksum(gun, data.CanonicalSnapshotRole, snapshot.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	sn := &data.SignedSnapshot{}
+	if err := json.Unmarshal(snapshotJSON, sn); err != nil {
+		return nil, fmt.Errorf("could not parse current snapshot for %s: %v", gun, err)
+	}
+
+	current := map[data.RoleName]int{
+		data.CanonicalTimestampRole: timestamp.Version,
+		data.CanonicalSnapshotRole:  snapshot.Version,
+	}
+	for role, meta := range sn.Signed.Meta {
+		r, ok := bySHA256[hex.EncodeToString(meta.Hashes[notary.SHA256])]
+		if !ok || r.Role.String() != role {
+			// the snapshot references data we don't have, so we can't
+			// safely tell which versions of this GUN are current
+			return nil, nil
+		}
+		current[r.Role] = r.Version
+	}
+	return current, nil
+}
@@ -59,4 +59,56 @@ type MetaStore interface {
 	// the given changeID.
 	// The returned []Change should always be ordered oldest to newest.
 	GetChanges(changeID string, records int, filterName string) ([]Change, error)
+
+	// GarbageCollect removes metadata that is not referenced by the current
+	// timestamp and snapshot of its GUN, such as versions left behind by
+	// partial publishes or roles belonging to deleted delegations.  It
+	// returns the records that were removed.  If dryRun is true, the records
+	// that would have been removed are returned, but nothing is removed.
+	GarbageCollect(dryRun bool) ([]MetaRecord, error)
+
+	// Export calls fn with every stored version of every role of every GUN,
+	// ordered by GUN, role and version.  It stops at, and returns, the first
+	// error returned by fn.
+	Export(fn func(ExportedMeta) error) error
+
+	// SetExpiry sets how long the server-signed snapshot or timestamp of the
+	// given GUN is valid for, overriding the server's default for the role.
+	// An expiry of zero removes the override.
+	SetExpiry(gun data.GUN, tufRole data.RoleName, expiry time.Duration) error
+
+	// GetExpiry returns the expiry set for the snapshot or timestamp of the
+	// given GUN, or zero if none is set and the server's default applies.
+	GetExpiry(gun data.GUN, tufRole data.RoleName) (time.Duration, error)
+}
+
+// PrimaryReader is implemented by MetaStores which may make reads from a read
+// replica, which can lag behind the primary
+type PrimaryReader interface {
+	// Primary returns a view of the store which makes every read from the
+	// primary, as the reads which decide what is written must be
+	Primary() MetaStore
+}
+
+// Primary returns a view of the store which makes every read from the
+// primary, or the store itself if it does not read from a replica
+func Primary(store MetaStore) MetaStore {
+	if s, ok := store.(PrimaryReader); ok {
+		return s.Primary()
+	}
+	return store
+}
+
+// ChangefeedReindexer is implemented by MetaStores whose changefeed is ordered
+// by a sequence of change IDs, which can become inconsistent with the stored
+// metadata, for instance after the database is edited by hand
+type ChangefeedReindexer interface {
+	// ReindexChanges rebuilds the changefeed from the stored metadata: every
+	// stored version of a timestamp has exactly one update change, and the
+	// changes are renumbered in the order they were made.  Change IDs are
+	// never reused or decreased, so that consumers can keep reading from the
+	// last ID they saw: renumbered changes continue after the highest
+	// existing ID.  If dryRun is true, the changefeed is not changed, but the result says how it would
+	// have been.
+	ReindexChanges(dryRun bool) (ReindexResult, error)
 }
@@ -21,6 +21,8 @@ type key struct {
 }
 
 type ver struct {
+	gun          data.GUN
+	role         data.RoleName
 	version      int
 	data         []byte
 	createupdate time.Time
@@ -44,6 +46,7 @@ type MemStorage struct {
 	keys      map[string]map[string]*key
 	checksums map[string]map[string]ver
 	changes   []Change
+	expiries  map[string]time.Duration
 }
 
 // NewMemStorage instantiates a memStorage instance
@@ -67,7 +70,7 @@ func (st *MemStorage) UpdateCurrent(gun data.GUN, update MetaUpdate) error {
 			}
 		}
 	}
-	version := ver{version: update.Version, data: update.Data, createupdate: time.Now()}
+	version := ver{gun: gun, role: update.Role, version: update.Version, data: update.Data, createupdate: time.Now()}
 	st.tufMeta[id] = append(st.tufMeta[id], version)
 	checksumBytes := sha256.Sum256(update.Data)
 	checksum := hex.EncodeToString(checksumBytes[:])
@@ -83,11 +86,30 @@ func (st *MemStorage) UpdateCurrent(gun data.GUN, update MetaUpdate) error {
 	return nil
 }
 
+// changesBefore returns how many changes have an ID lower than id
+func (st *MemStorage) changesBefore(id int) int {
+	return sort.Search(len(st.changes), func(i int) bool {
+		changeID, _ := strconv.Atoi(st.changes[i].ID)
+		return changeID >= id
+	})
+}
+
+// nextChangeID returns the ID of the next change to be written, which follows
+// on from the last one.  It must only be called by a function already holding
+// a lock on the MemStorage.
+func (st *MemStorage) nextChangeID() string {
+	if len(st.changes) == 0 {
+		return "1"
+	}
+	last, _ := strconv.Atoi(st.changes[len(st.changes)-1].ID)
+	return strconv.Itoa(last + 1)
+}
+
 // writeChange must only be called by a function already holding a lock on
 // the MemStorage. Behaviour is undefined otherwise
 func (st *MemStorage) writeChange(gun data.GUN, version int, checksum string) {
 	c := Change{
-		ID:        strconv.Itoa(len(st.changes) + 1),
+		ID:        st.nextChangeID(),
 		GUN:       gun.String(),
 		Version:   version,
 		SHA256:    checksum,
@@ -130,7 +152,7 @@ func (st *MemStorage) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
 	for _, u := range updates {
 		id := entryKey(gun, u.Role)
 
-		version := ver{version: u.Version, data: u.Data, createupdate: time.Now()}
+		version := ver{gun: gun, role: u.Role, version: u.Version, data: u.Data, createupdate: time.Now()}
 		st.tufMeta[id] = append(st.tufMeta[id], version)
 		sort.Sort(st.tufMeta[id]) // ensure that it's sorted
 		checksumBytes := sha256.Sum256(u.Data)
@@ -202,7 +224,7 @@ func (st *MemStorage) Delete(gun data.GUN) error {
 	}
 	delete(st.checksums, gun.String())
 	c := Change{
-		ID:        strconv.Itoa(len(st.changes) + 1),
+		ID:        st.nextChangeID(),
 		GUN:       gun.String(),
 		Category:  changeCategoryDeletion,
 		CreatedAt: time.Now(),
@@ -212,10 +234,9 @@ func (st *MemStorage) Delete(gun data.GUN) error {
 }
 
 // GetChanges returns a []Change starting from but excluding the record
-// identified by changeID. In the context of the memory store, changeID
-// is simply an index into st.changes. The ID of a change is its
-// index+1, both to match the SQL implementations, and so that the first
-// change can be retrieved by providing ID 0.
+// identified by changeID. IDs increase along st.changes, matching the SQL
+// implementations, so the changes after changeID are found by searching for
+// it.  The first change can be retrieved by providing ID 0.
 func (st *MemStorage) GetChanges(changeID string, records int, filterName string) ([]Change, error) {
 	var (
 		id  int64
@@ -229,13 +250,6 @@ func (st *MemStorage) GetChanges(changeID string, records int, filterName string
 			return nil, ErrBadQuery{msg: fmt.Sprintf("change ID expected to be integer, provided ID was: %s", changeID)}
 		}
 	}
-	var (
-		start     = int(id)
-		toInspect []Change
-	)
-	if err != nil {
-		return nil, err
-	}
 
 	reversed := id < 0
 	if records < 0 {
@@ -243,31 +257,24 @@ func (st *MemStorage) GetChanges(changeID string, records int, filterName string
 		records = -records
 	}
 
-	if len(st.changes) <= int(id) && !reversed {
-		// no records to return as we're essentially trying to retrieve
-		// changes that haven't happened yet.
-		return nil, nil
-	}
-
 	// technically only -1 is a valid negative input, but we're going to be
 	// broad in what we accept here to reduce the need to error and instead
 	// act in a "do what I mean not what I say" fashion. Same logic for
 	// requesting changeID < 0 but not asking for reversed, we're just going
 	// to force it to be reversed.
-	if start < 0 {
-		// need to add one so we don't later slice off the last element
-		// when calculating toInspect.
-		start = len(st.changes) + 1
+	var toInspect []Change
+	switch {
+	case id < 0:
+		toInspect = st.changes
+	case reversed:
+		toInspect = st.changes[:st.changesBefore(int(id))]
+	default:
+		toInspect = st.changes[st.changesBefore(int(id)+1):]
 	}
-	// reduce to only look at changes we're interested in
-	if reversed {
-		if start > len(st.changes) {
-			toInspect = st.changes
-		} else {
-			toInspect = st.changes[:start-1]
-		}
-	} else {
-		toInspect = st.changes[start:]
+	if len(toInspect) == 0 && !reversed {
+		// no records to return as we're essentially trying to retrieve
+		// changes that haven't happened yet.
+		return nil, nil
 	}
 
 	// if we're not doing any filtering
@@ -288,6 +295,145 @@ func (st *MemStorage) GetChanges(changeID string, records int, filterName string
 	return getFilteredChanges(toInspect, filterName, records, reversed), nil
 }
 
+// GarbageCollect removes all metadata not referenced by the current timestamp
+// and snapshot of its GUN
+func (st *MemStorage) GarbageCollect(dryRun bool) ([]MetaRecord, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	var records []MetaRecord
+	for _, space := range st.tufMeta {
+		for _, v := range space {
+			records = append(records, MetaRecord{
+				GUN:     v.gun,
+				Role:    v.role,
+				Version: v.version,
+				SHA256:  memChecksum(v.data),
+			})
+		}
+	}
+	orphans, err := findOrphans(records, func(gun data.GUN, role data.RoleName, checksum string) ([]byte, error) {
+		v, ok := st.checksums[gun.String()][checksum]
+		if !ok {
+			return nil, ErrNotFound{}
+		}
+		return v.data, nil
+	})
+	if err != nil || dryRun {
+		return orphans, err
+	}
+
+	for _, orphan := range orphans {
+		id := entryKey(orphan.GUN, orphan.Role)
+		var keep verList
+		for _, v := range st.tufMeta[id] {
+			if v.version != orphan.Version {
+				keep = append(keep, v)
+			}
+		}
+		if len(keep) == 0 {
+			delete(st.tufMeta, id)
+		} else {
+			st.tufMeta[id] = keep
+		}
+		delete(st.checksums[orphan.GUN.String()], orphan.SHA256)
+	}
+	return orphans, nil
+}
+
+// ReindexChanges rebuilds the changefeed from the stored timestamps, and
+// renumbers it in the order the changes were made
+func (st *MemStorage) ReindexChanges(dryRun bool) (ReindexResult, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	var timestamps []storedTimestamp
+	for _, space := range st.tufMeta {
+		for _, v := range space {
+			if v.role == data.CanonicalTimestampRole {
+				timestamps = append(timestamps, storedTimestamp{
+					GUN:       v.gun,
+					Version:   v.version,
+					SHA256:    memChecksum(v.data),
+					CreatedAt: v.createupdate,
+				})
+			}
+		}
+	}
+	changes, result := reindexChanges(st.changes, timestamps)
+	if !dryRun {
+		st.changes = changes
+	}
+	return result, nil
+}
+
+// Export calls fn with every stored version of every role, ordered by GUN,
+// role and version
+func (st *MemStorage) Export(fn func(ExportedMeta) error) error {
+	st.lock.Lock()
+	var rows []ExportedMeta
+	for _, space := range st.tufMeta {
+		for _, v := range space {
+			rows = append(rows, ExportedMeta{
+				Record: MetaRecord{
+					GUN:     v.gun,
+					Role:    v.role,
+					Version: v.version,
+					SHA256:  memChecksum(v.data),
+				},
+				Data: v.data,
+			})
+		}
+	}
+	st.lock.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.GUN != b.GUN {
+			return a.GUN < b.GUN
+		}
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return a.Version < b.Version
+	})
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetExpiry sets how long the server-signed snapshot or timestamp of a GUN
+// is valid for, or removes the override if expiry is zero
+func (st *MemStorage) SetExpiry(gun data.GUN, tufRole data.RoleName, expiry time.Duration) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if expiry == 0 {
+		delete(st.expiries, entryKey(gun, tufRole))
+		return nil
+	}
+	if st.expiries == nil {
+		st.expiries = make(map[string]time.Duration)
+	}
+	st.expiries[entryKey(gun, tufRole)] = expiry
+	return nil
+}
+
+// GetExpiry returns the expiry set for the snapshot or timestamp of a GUN, or
+// zero if there is none
+func (st *MemStorage) GetExpiry(gun data.GUN, tufRole data.RoleName) (time.Duration, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.expiries[entryKey(gun, tufRole)], nil
+}
+
+func memChecksum(data []byte) string {
+	checksumBytes := sha256.Sum256(data)
+	return hex.EncodeToString(checksumBytes[:])
+}
+
 func getFilteredChanges(toInspect []Change, filterName string, records int, reversed bool) []Change {
 	res := make([]Change, 0, records)
 	if reversed {
@@ -101,3 +101,33 @@ func TestGetVersion(t *testing.T) {
 	s := NewMemStorage()
 	testGetVersion(t, s)
 }
+
+func TestMemoryGarbageCollect(t *testing.T) {
+	s := NewMemStorage()
+	testGarbageCollect(t, s)
+}
+
+func TestMemoryExportImport(t *testing.T) {
+	testExportImport(t, NewMemStorage(), NewMemStorage())
+	testImportInvalid(t, NewMemStorage())
+	testImportBatches(t, NewMemStorage())
+}
+
+func TestMemoryComputeMetaSizes(t *testing.T) {
+	testComputeMetaSizes(t, NewMemStorage())
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	testExpiry(t, NewMemStorage())
+}
+
+func TestMemoryReindexChanges(t *testing.T) {
+	s := NewMemStorage()
+	testReindexChanges(t, s, func() {
+		first, second, rest := s.changes[0], s.changes[1], s.changes[3:]
+		first.ID, second.ID = second.ID, first.ID
+		duplicate := first
+		duplicate.ID = "6"
+		s.changes = append([]Change{second, first}, append(rest, duplicate)...)
+	})
+}
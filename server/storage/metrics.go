@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// storeLatencies observes how long the operations of the metadata store take,
+// by the name of the operation
+var storeLatencies = prometheus.NewSummaryVec(
+	prometheus.SummaryOpts{
+		Namespace: "notary_server",
+		Subsystem: "storage",
+		Name:      "operation_duration_microseconds",
+		Help:      "Time taken by operations of the metadata store, by operation.",
+	},
+	[]string{"operation"},
+)
+
+func init() {
+	prometheus.MustRegister(storeLatencies)
+}
+
+// observeLatency records the time taken by an operation of the store which
+// started at the given time
+func observeLatency(operation string, start time.Time) {
+	storeLatencies.WithLabelValues(operation).Observe(float64(time.Since(start).Nanoseconds()) / float64(time.Microsecond))
+}
+
+// MeteredMetaStore wraps a MetaStore in order to observe how long each of its
+// operations takes, so that slow storage can be told apart from slow requests
+type MeteredMetaStore struct {
+	MetaStore
+}
+
+// NewMeteredMetaStore instantiates a MeteredMetaStore instance
+func NewMeteredMetaStore(m MetaStore) *MeteredMetaStore {
+	return &MeteredMetaStore{
+		MetaStore: m,
+	}
+}
+
+// UpdateCurrent updates the metadata of a role, observing how long it takes
+func (mms MeteredMetaStore) UpdateCurrent(gun data.GUN, update MetaUpdate) error {
+	defer observeLatency("UpdateCurrent", time.Now())
+	return mms.MetaStore.UpdateCurrent(gun, update)
+}
+
+// UpdateMany updates the metadata of several roles, observing how long it takes
+func (mms MeteredMetaStore) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
+	defer observeLatency("UpdateMany", time.Now())
+	return mms.MetaStore.UpdateMany(gun, updates)
+}
+
+// GetCurrent gets the current metadata of a role, observing how long it takes
+func (mms MeteredMetaStore) GetCurrent(gun data.GUN, tufRole data.RoleName) (*time.Time, []byte, error) {
+	defer observeLatency("GetCurrent", time.Now())
+	return mms.MetaStore.GetCurrent(gun, tufRole)
+}
+
+// GetChecksum gets the metadata of a role by checksum, observing how long it takes
+func (mms MeteredMetaStore) GetChecksum(gun data.GUN, tufRole data.RoleName, checksum string) (*time.Time, []byte, error) {
+	defer observeLatency("GetChecksum", time.Now())
+	return mms.MetaStore.GetChecksum(gun, tufRole, checksum)
+}
+
+// GetVersion gets the metadata of a role by version, observing how long it takes
+func (mms MeteredMetaStore) GetVersion(gun data.GUN, tufRole data.RoleName, version int) (*time.Time, []byte, error) {
+	defer observeLatency("GetVersion", time.Now())
+	return mms.MetaStore.GetVersion(gun, tufRole, version)
+}
+
+// Delete removes the metadata of a GUN, observing how long it takes
+func (mms MeteredMetaStore) Delete(gun data.GUN) error {
+	defer observeLatency("Delete", time.Now())
+	return mms.MetaStore.Delete(gun)
+}
+
+// GetChanges gets changes from the changefeed, observing how long it takes
+func (mms MeteredMetaStore) GetChanges(changeID string, records int, filterName string) ([]Change, error) {
+	defer observeLatency("GetChanges", time.Now())
+	return mms.MetaStore.GetChanges(changeID, records, filterName)
+}
+
+// GarbageCollect removes unreferenced metadata, observing how long it takes
+func (mms MeteredMetaStore) GarbageCollect(dryRun bool) ([]MetaRecord, error) {
+	defer observeLatency("GarbageCollect", time.Now())
+	return mms.MetaStore.GarbageCollect(dryRun)
+}
+
+// Export calls fn with all the stored metadata, observing how long it takes
+func (mms MeteredMetaStore) Export(fn func(ExportedMeta) error) error {
+	defer observeLatency("Export", time.Now())
+	return mms.MetaStore.Export(fn)
+}
+
+// SetExpiry sets the expiry of a server-signed role, observing how long it takes
+func (mms MeteredMetaStore) SetExpiry(gun data.GUN, tufRole data.RoleName, expiry time.Duration) error {
+	defer observeLatency("SetExpiry", time.Now())
+	return mms.MetaStore.SetExpiry(gun, tufRole, expiry)
+}
+
+// GetExpiry gets the expiry of a server-signed role, observing how long it takes
+func (mms MeteredMetaStore) GetExpiry(gun data.GUN, tufRole data.RoleName) (time.Duration, error) {
+	defer observeLatency("GetExpiry", time.Now())
+	return mms.MetaStore.GetExpiry(gun, tufRole)
+}
+
+// Bootstrap the store with tables if possible
+func (mms MeteredMetaStore) Bootstrap() error {
+	if s, ok := mms.MetaStore.(storage.Bootstrapper); ok {
+		return s.Bootstrap()
+	}
+	return fmt.Errorf("store does not support bootstrapping")
+}
+
+// Primary returns a view of the store which makes every read from the primary,
+// if the wrapped store may read from a replica
+func (mms MeteredMetaStore) Primary() MetaStore {
+	return NewMeteredMetaStore(Primary(mms.MetaStore))
+}
+
+// ReindexChanges rebuilds the changefeed of the store if it supports it,
+// observing how long it takes
+func (mms MeteredMetaStore) ReindexChanges(dryRun bool) (ReindexResult, error) {
+	if s, ok := mms.MetaStore.(ChangefeedReindexer); ok {
+		defer observeLatency("ReindexChanges", time.Now())
+		return s.ReindexChanges(dryRun)
+	}
+	return ReindexResult{}, ErrReindexNotSupported{}
+}
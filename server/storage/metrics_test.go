@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// storeOperationCount gets the number of times an operation of the store has
+// been observed, from the metrics which would be served by the metrics endpoint
+func storeOperationCount(t *testing.T, operation string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "notary_server_storage_operation_duration_microseconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "operation" && label.GetValue() == operation {
+					return metric.GetSummary().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// MeteredMetaStore observes the operations of the store it wraps, without
+// changing their results
+func TestMeteredMetaStore(t *testing.T) {
+	s := NewMeteredMetaStore(NewMemStorage())
+	var gun data.GUN = "testGUN"
+
+	updates, gets := storeOperationCount(t, "UpdateCurrent"), storeOperationCount(t, "GetCurrent")
+	require.NoError(t, s.UpdateCurrent(gun, MetaUpdate{Role: data.CanonicalRootRole, Version: 1, Data: []byte("1")}))
+	_, meta, err := s.GetCurrent(gun, data.CanonicalRootRole)
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), meta)
+	_, _, err = s.GetCurrent(gun, data.CanonicalTargetsRole)
+	require.IsType(t, ErrNotFound{}, err)
+
+	require.Equal(t, updates+1, storeOperationCount(t, "UpdateCurrent"))
+	require.Equal(t, gets+2, storeOperationCount(t, "GetCurrent"))
+
+	// reindexing is passed on to the memory store, which supports it, but
+	// bootstrapping is not
+	reindexes := storeOperationCount(t, "ReindexChanges")
+	_, err = s.ReindexChanges(true)
+	require.NoError(t, err)
+	require.Equal(t, reindexes+1, storeOperationCount(t, "ReindexChanges"))
+	require.Error(t, s.Bootstrap())
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// ReindexResult describes the changefeed rebuilt by ReindexChanges
+type ReindexResult struct {
+	// NumberOfChanges is the number of changes in the rebuilt changefeed
+	NumberOfChanges int `json:"count"`
+	// Renumbered is the number of existing changes whose ID changed
+	Renumbered int `json:"renumbered"`
+	// Added is the number of changes added for stored timestamps which were
+	// missing from the changefeed
+	Added int `json:"added"`
+	// Removed is the number of duplicate changes for the same stored
+	// timestamp which were removed
+	Removed int `json:"removed"`
+}
+
+// storedTimestamp is a stored version of the timestamp of a GUN, along with
+// when it was stored
+type storedTimestamp struct {
+	GUN       data.GUN
+	Version   int
+	SHA256    string
+	CreatedAt time.Time
+}
+
+// reindexChanges rebuilds a changefeed from the stored timestamps, since an
+// update change is written whenever a timestamp is stored.  Each stored
+// timestamp gets exactly one update change, created when the timestamp was
+// stored.  Changes which don't belong to a stored timestamp, such as
+// deletions, or updates of timestamps which have since been deleted, are
+// kept as they are.  The changes are then ordered by when they were created,
+// keeping their previous order where that is the same.
+//
+// Changefeed consumers keep the ID of the last change they read, so IDs are
+// never reused or decreased: the changes up to the first one which was
+// reordered, added or altered keep their IDs, and the rest are numbered on
+// from the highest existing ID.  A consumer which had read past that point
+// then reads the rebuilt part of the changefeed again.
+//
+// changes must be in their previous order, oldest to newest.
+func reindexChanges(changes []Change, timestamps []storedTimestamp) ([]Change, ReindexResult) {
+	type changeKey struct {
+		gun    string
+		sha256 string
+	}
+	stored := make(map[changeKey]storedTimestamp, len(timestamps))
+	for _, ts := range timestamps {
+		stored[changeKey{gun: ts.GUN.String(), sha256: ts.SHA256}] = ts
+	}
+
+	var (
+		result    ReindexResult
+		reindexed = make([]Change, 0, len(changes)+len(timestamps))
+		previous  = make([]string, 0, len(changes))
+		seen      = make(map[changeKey]bool, len(timestamps))
+	)
+	for _, c := range changes {
+		if c.Category == changeCategoryUpdate {
+			k := changeKey{gun: c.GUN, sha256: c.SHA256}
+			if ts, ok := stored[k]; ok {
+				if seen[k] {
+					// a duplicate of an earlier change for the same timestamp
+					result.Removed++
+					continue
+				}
+				seen[k] = true
+				c.Version = ts.Version
+				c.CreatedAt = ts.CreatedAt
+			}
+		}
+		reindexed = append(reindexed, c)
+		previous = append(previous, c.ID)
+	}
+	for _, ts := range timestamps {
+		k := changeKey{gun: ts.GUN.String(), sha256: ts.SHA256}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		reindexed = append(reindexed, Change{
+			GUN:       ts.GUN.String(),
+			Version:   ts.Version,
+			SHA256:    ts.SHA256,
+			CreatedAt: ts.CreatedAt,
+			Category:  changeCategoryUpdate,
+		})
+		previous = append(previous, "")
+		result.Added++
+	}
+
+	// sort the positions rather than the changes, so that each change's
+	// previous ID is kept alongside it
+	order := make([]int, len(reindexed))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return reindexed[order[i]].CreatedAt.Before(reindexed[order[j]].CreatedAt)
+	})
+
+	nextID := 0
+	for _, c := range changes {
+		if id, err := strconv.Atoi(c.ID); err == nil && id > nextID {
+			nextID = id
+		}
+	}
+	unchanged := true
+	sorted := make([]Change, len(reindexed))
+	for i, pos := range order {
+		c := reindexed[pos]
+		unchanged = unchanged && i < len(changes) && sameChange(c, changes[i])
+		if !unchanged {
+			nextID++
+			c.ID = strconv.Itoa(nextID)
+		}
+		if previous[pos] != "" && previous[pos] != c.ID {
+			result.Renumbered++
+		}
+		sorted[i] = c
+	}
+	result.NumberOfChanges = len(sorted)
+	return sorted, result
+}
+
+// sameChange returns whether a and b have the same ID and describe the same
+// change.  Their creation times may differ, since a change's is corrected to
+// when its timestamp was stored without that being worth renumbering for.
+func sameChange(a, b Change) bool {
+	return a.ID == b.ID && a.GUN == b.GUN && a.Version == b.Version &&
+		a.SHA256 == b.SHA256 && a.Category == b.Category
+}
@@ -37,6 +37,7 @@ func rethinkDBSetup(t *testing.T) (RethinkDB, func()) {
 	require.NoError(t, rethinkdb.SetupDB(session, dbName, []rethinkdb.Table{
 		TUFFilesRethinkTable,
 		ChangeRethinkTable,
+		ExpiryRethinkTable,
 	}))
 	return NewRethinkDBStorage(dbName, "", "", session), cleanup
 }
@@ -156,6 +157,49 @@ func TestRethinkUpdateManyConflictRollback(t *testing.T) {
 	testUpdateManyConflictRollback(t, dbStore)
 }
 
+// GarbageCollect reports orphaned TUF metadata on a dry run, but refuses to
+// remove it
+func TestRethinkGarbageCollect(t *testing.T) {
+	dbStore, cleanup := rethinkDBSetup(t)
+	defer cleanup()
+
+	kept, orphans := storeGarbage(t, dbStore)
+
+	collected, err := dbStore.GarbageCollect(true)
+	require.NoError(t, err)
+	require.ElementsMatch(t, toMetaRecords(orphans...), collected)
+
+	_, err = dbStore.GarbageCollect(false)
+	require.IsType(t, ErrGCNotSupported{}, err)
+	assertExpectedTUFMetaInStore(t, dbStore, append(kept, orphans...), false)
+}
+
+// Per-GUN expiries can be set, replaced and removed
+func TestRethinkExpiry(t *testing.T) {
+	dbStore, cleanup := rethinkDBSetup(t)
+	defer cleanup()
+
+	testExpiry(t, dbStore)
+}
+
+// Metadata exported from memory can be imported into RethinkDB, and exported
+// again unchanged
+func TestRethinkExportImport(t *testing.T) {
+	dbStore, cleanup := rethinkDBSetup(t)
+	defer cleanup()
+
+	testExportImport(t, NewMemStorage(), dbStore)
+	testImportInvalid(t, dbStore)
+	testImportBatches(t, dbStore)
+}
+
+func TestRethinkComputeMetaSizes(t *testing.T) {
+	dbStore, cleanup := rethinkDBSetup(t)
+	defer cleanup()
+
+	testComputeMetaSizes(t, dbStore)
+}
+
 // Delete will remove all TUF metadata, all versions, associated with a gun
 func TestRethinkDeleteSuccess(t *testing.T) {
 	dbStore, cleanup := rethinkDBSetup(t)
@@ -38,6 +38,20 @@ func (r RDBTUFFile) TableName() string {
 	return TUFFileTableName
 }
 
+// RDBExpiry is the expiry set for the server-signed snapshot or timestamp of
+// a GUN
+type RDBExpiry struct {
+	GunRole []interface{} `gorethink:"gun_role"`
+	Gun     string        `gorethink:"gun"`
+	Role    string        `gorethink:"role"`
+	Seconds int64         `gorethink:"expiry_seconds"`
+}
+
+// TableName returns the table name for the record type
+func (r RDBExpiry) TableName() string {
+	return ExpiryTableName
+}
+
 // Change defines the fields required for an object in the changefeed
 type Change struct {
 	ID        string    `gorethink:"id,omitempty" gorm:"primary_key" sql:"not null"`
@@ -86,6 +100,23 @@ func rdbTUFFileFromJSON(data []byte) (interface{}, error) {
 	}, nil
 }
 
+func rdbExpiryFromJSON(data []byte) (interface{}, error) {
+	a := struct {
+		Gun     string `json:"gun"`
+		Role    string `json:"role"`
+		Seconds int64  `json:"expiry_seconds"`
+	}{}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return RDBExpiry{}, err
+	}
+	return RDBExpiry{
+		GunRole: []interface{}{a.Gun, a.Role},
+		Gun:     a.Gun,
+		Role:    a.Role,
+		Seconds: a.Seconds,
+	}, nil
+}
+
 func rdbChangeFromJSON(data []byte) (interface{}, error) {
 	res := Change{}
 	if err := json.Unmarshal(data, &res); err != nil {
@@ -295,6 +326,115 @@ func (rdb RethinkDB) Delete(gun data.GUN) error {
 	return nil
 }
 
+// GarbageCollect reports all metadata not referenced by the current timestamp
+// and snapshot of its GUN.  RethinkDB has no transactions, so a publish could
+// make metadata current between it being read and deleted: only dry runs are
+// supported, and otherwise ErrGCNotSupported is returned.
+func (rdb RethinkDB) GarbageCollect(dryRun bool) ([]MetaRecord, error) {
+	if !dryRun {
+		return nil, ErrGCNotSupported{}
+	}
+	res, err := gorethink.DB(rdb.dbName).Table(RDBTUFFile{}.TableName(), gorethink.TableOpts{ReadMode: "majority"}).Pluck(
+		"gun", "role", "version", "sha256",
+	).Run(rdb.sess)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var files []RDBTUFFile
+	if err := res.All(&files); err != nil {
+		return nil, err
+	}
+	records := make([]MetaRecord, 0, len(files))
+	for _, file := range files {
+		records = append(records, MetaRecord{
+			GUN:     data.GUN(file.Gun),
+			Role:    data.RoleName(file.Role),
+			Version: file.Version,
+			SHA256:  file.SHA256,
+		})
+	}
+	return findOrphans(records, func(gun data.GUN, role data.RoleName, checksum string) ([]byte, error) {
+		_, data, err := rdb.GetChecksum(gun, role, checksum)
+		return data, err
+	})
+}
+
+// Export calls fn with every stored version of every role, ordered by GUN,
+// role and version.  Files are read from the database one at a time.
+func (rdb RethinkDB) Export(fn func(ExportedMeta) error) error {
+	res, err := gorethink.DB(rdb.dbName).Table(RDBTUFFile{}.TableName(), gorethink.TableOpts{ReadMode: "majority"}).OrderBy(
+		gorethink.OrderByOpts{Index: "gun_role_version"},
+	).Run(rdb.sess)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	var file RDBTUFFile
+	for res.Next(&file) {
+		err := fn(ExportedMeta{
+			Record: MetaRecord{
+				GUN:     data.GUN(file.Gun),
+				Role:    data.RoleName(file.Role),
+				Version: file.Version,
+				SHA256:  file.SHA256,
+			},
+			Data: file.Data,
+		})
+		if err != nil {
+			return err
+		}
+		file = RDBTUFFile{}
+	}
+	return res.Err()
+}
+
+// SetExpiry sets how long the server-signed snapshot or timestamp of a GUN
+// is valid for, to the nearest second, or removes the override if expiry is
+// zero
+func (rdb RethinkDB) SetExpiry(gun data.GUN, tufRole data.RoleName, expiry time.Duration) error {
+	table := gorethink.DB(rdb.dbName).Table(RDBExpiry{}.TableName())
+	key := []interface{}{gun.String(), tufRole.String()}
+	if expiry == 0 {
+		_, err := table.Get(key).Delete().RunWrite(rdb.sess)
+		return err
+	}
+	_, err := table.Insert(RDBExpiry{
+		GunRole: key,
+		Gun:     gun.String(),
+		Role:    tufRole.String(),
+		Seconds: int64(expiry / time.Second),
+	}, gorethink.InsertOpts{
+		Conflict: "replace",
+	}).RunWrite(rdb.sess)
+	return err
+}
+
+// GetExpiry returns the expiry set for the snapshot or timestamp of a GUN, or
+// zero if there is none
+func (rdb RethinkDB) GetExpiry(gun data.GUN, tufRole data.RoleName) (time.Duration, error) {
+	var expiry RDBExpiry
+	res, err := gorethink.DB(rdb.dbName).Table(expiry.TableName(), gorethink.TableOpts{ReadMode: "majority"}).Get(
+		[]interface{}{gun.String(), tufRole.String()},
+	).Run(rdb.sess)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	if res.IsNil() {
+		return 0, nil
+	}
+	if err := res.One(&expiry); err != nil {
+		if err == gorethink.ErrEmptyResult {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return time.Duration(expiry.Seconds) * time.Second, nil
+}
+
 // deleteByTSChecksum removes all metadata by a timestamp checksum, used for rolling back a "transaction"
 // from a call to rethinkdb's UpdateMany
 func (rdb RethinkDB) deleteByTSChecksum(tsChecksum string) error {
@@ -313,6 +453,7 @@ func (rdb RethinkDB) Bootstrap() error {
 	if err := rethinkdb.SetupDB(rdb.sess, rdb.dbName, []rethinkdb.Table{
 		TUFFilesRethinkTable,
 		ChangeRethinkTable,
+		ExpiryRethinkTable,
 	}); err != nil {
 		return err
 	}
@@ -44,4 +44,15 @@ var (
 		},
 		JSONUnmarshaller: rdbChangeFromJSON,
 	}
+
+	// ExpiryRethinkTable is the table definition for the expiries set for
+	// the server-signed snapshot or timestamp of a GUN
+	ExpiryRethinkTable = rethinkdb.Table{
+		Name:       RDBExpiry{}.TableName(),
+		PrimaryKey: "gun_role",
+		Config: map[string]string{
+			"write_acks": "majority",
+		},
+		JSONUnmarshaller: rdbExpiryFromJSON,
+	}
 )
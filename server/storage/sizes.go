@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"github.com/theupdateframework/notary/server/meta"
+)
+
+// RoleSize is the size of the metadata stored for a role of a GUN
+type RoleSize = meta.RoleSize
+
+// GUNSize is the size of the metadata stored for a GUN, per role and in total
+type GUNSize = meta.GUNSize
+
+// MetaSizes is the size of the metadata stored for every GUN in a store
+type MetaSizes = meta.Sizes
+
+// ComputeMetaSizes adds up the size of every stored version of every role of
+// every GUN in the store.  GUNs, and the roles of each GUN, are ordered by
+// name.
+func ComputeMetaSizes(store MetaStore) (MetaSizes, error) {
+	sizes := MetaSizes{GUNs: []GUNSize{}}
+	// Export is ordered by GUN, role and version, so each GUN and role is
+	// contiguous, and the last version seen of a role is its current one
+	err := store.Export(func(meta ExportedMeta) error {
+		if n := len(sizes.GUNs); n == 0 || sizes.GUNs[n-1].GUN != meta.GUN {
+			sizes.GUNs = append(sizes.GUNs, GUNSize{GUN: meta.GUN, Roles: []RoleSize{}})
+		}
+		gun := &sizes.GUNs[len(sizes.GUNs)-1]
+		if n := len(gun.Roles); n == 0 || gun.Roles[n-1].Role != meta.Role {
+			gun.Roles = append(gun.Roles, RoleSize{Role: meta.Role})
+		}
+		role := &gun.Roles[len(gun.Roles)-1]
+		role.Versions++
+		role.CurrentBytes = int64(len(meta.Data))
+		role.TotalBytes += int64(len(meta.Data))
+		return nil
+	})
+	if err != nil {
+		return MetaSizes{}, err
+	}
+
+	for i := range sizes.GUNs {
+		gun := &sizes.GUNs[i]
+		for _, role := range gun.Roles {
+			gun.CurrentBytes += role.CurrentBytes
+			gun.TotalBytes += role.TotalBytes
+		}
+		sizes.CurrentBytes += gun.CurrentBytes
+		sizes.TotalBytes += gun.TotalBytes
+	}
+	return sizes, nil
+}
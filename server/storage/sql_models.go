@@ -17,6 +17,9 @@ const TUFFileTableName = "tuf_files"
 // ChangefeedTableName returns the name used for the changefeed table
 const ChangefeedTableName = "changefeed"
 
+// ExpiryTableName returns the name used for the table of per-GUN expiries
+const ExpiryTableName = "tuf_expiries"
+
 // TUFFile represents a TUF file in the database
 type TUFFile struct {
 	gorm.Model
@@ -47,6 +50,20 @@ func (c SQLChange) TableName() string {
 	return ChangefeedTableName
 }
 
+// TUFExpiry represents the expiry set for the server-signed snapshot or
+// timestamp of a GUN in the database
+type TUFExpiry struct {
+	ID      uint   `gorm:"primary_key" sql:"not null"`
+	Gun     string `sql:"type:varchar(255);not null"`
+	Role    string `sql:"type:varchar(255);not null"`
+	Seconds int64  `gorm:"column:expiry_seconds" sql:"not null"`
+}
+
+// TableName sets a specific table name for TUFExpiry
+func (e TUFExpiry) TableName() string {
+	return ExpiryTableName
+}
+
 // CreateTUFTable creates the DB table for TUFFile
 func CreateTUFTable(db *gorm.DB) error {
 	// TODO: gorm
@@ -64,3 +81,14 @@ func CreateChangefeedTable(db *gorm.DB) error {
 	query := db.AutoMigrate(&SQLChange{})
 	return query.Error
 }
+
+// CreateExpiryTable creates the DB table for TUFExpiry
+func CreateExpiryTable(db *gorm.DB) error {
+	query := db.AutoMigrate(&TUFExpiry{})
+	if query.Error != nil {
+		return query.Error
+	}
+	query = db.Model(&TUFExpiry{}).AddUniqueIndex(
+		"idx_expiry_gun", "gun", "role")
+	return query.Error
+}
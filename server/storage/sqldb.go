@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -18,8 +19,24 @@ import (
 // See server/storage/models.go
 type SQLStorage struct {
 	*gorm.DB
+
+	// replica, if set, is a read replica of the DB that GetCurrent,
+	// GetChecksum and GetChanges are served from, depending on readPreference
+	replica        *gorm.DB
+	readPreference ReadPreference
 }
 
+// ReadPreference is which DB the reads a replica can serve are made from
+type ReadPreference string
+
+const (
+	// ReadPrimary makes every read from the primary DB, even if there is a replica
+	ReadPrimary ReadPreference = "primary"
+	// ReadReplica makes the reads a replica can serve from the replica.  It is
+	// the default once a replica is set.
+	ReadReplica ReadPreference = "replica"
+)
+
 // NewSQLStorage is a convenience method to create a SQLStorage
 func NewSQLStorage(dialect string, args ...interface{}) (*SQLStorage, error) {
 	gormDB, err := gorm.Open(dialect, args...)
@@ -31,6 +48,45 @@ func NewSQLStorage(dialect string, args ...interface{}) (*SQLStorage, error) {
 	}, nil
 }
 
+// SetReplica sets a read replica of the DB.  Every write is still made to
+// the primary DB, as are the reads of the view returned by Primary.
+func (db *SQLStorage) SetReplica(replica *gorm.DB) {
+	db.replica = replica
+}
+
+// Primary returns a view of the store which makes every read from the primary
+// DB, regardless of the read preference
+func (db *SQLStorage) Primary() MetaStore {
+	if !db.readsReplica() {
+		return db
+	}
+	return &SQLStorage{DB: db.DB}
+}
+
+// SetReadPreference sets which DB the reads a replica can serve are made from
+func (db *SQLStorage) SetReadPreference(preference ReadPreference) error {
+	switch preference {
+	case ReadPrimary, ReadReplica:
+		db.readPreference = preference
+		return nil
+	default:
+		return fmt.Errorf("unknown read preference %q: must be %q or %q", preference, ReadPrimary, ReadReplica)
+	}
+}
+
+// readsReplica reports whether the reads a replica can serve are made from it
+func (db *SQLStorage) readsReplica() bool {
+	return db.replica != nil && db.readPreference != ReadPrimary
+}
+
+// reader returns the DB that the reads a replica can serve are made from
+func (db *SQLStorage) reader() *gorm.DB {
+	if db.readsReplica() {
+		return db.replica
+	}
+	return db.DB
+}
+
 // translateOldVersionError captures DB errors, and attempts to translate
 // duplicate entry
 func translateOldVersionError(err error) error {
@@ -209,8 +265,18 @@ func (db *SQLStorage) writeChangefeed(tx *gorm.DB, gun data.GUN, version int, ch
 	return tx.Create(c).Error
 }
 
-// GetCurrent gets a specific TUF record
+// GetCurrent gets a specific TUF record.  A record the replica does not have
+// yet is read from the primary, but the replica may still return an older
+// version than the primary has if it is lagging.
 func (db *SQLStorage) GetCurrent(gun data.GUN, tufRole data.RoleName) (*time.Time, []byte, error) {
+	updated, meta, err := getCurrent(db.reader(), gun, tufRole)
+	if _, ok := err.(ErrNotFound); ok && db.readsReplica() {
+		return getCurrent(db.DB, gun, tufRole)
+	}
+	return updated, meta, err
+}
+
+func getCurrent(db *gorm.DB, gun data.GUN, tufRole data.RoleName) (*time.Time, []byte, error) {
 	var row TUFFile
 	q := db.Select("updated_at, data").Where(
 		&TUFFile{Gun: gun.String(), Role: tufRole.String()}).Order("version desc").Take(&row)
@@ -220,8 +286,17 @@ func (db *SQLStorage) GetCurrent(gun data.GUN, tufRole data.RoleName) (*time.Tim
 	return &(row.UpdatedAt), row.Data, nil
 }
 
-// GetChecksum gets a specific TUF record by its hex checksum
+// GetChecksum gets a specific TUF record by its hex checksum.  A record the
+// replica does not have yet is read from the primary.
 func (db *SQLStorage) GetChecksum(gun data.GUN, tufRole data.RoleName, checksum string) (*time.Time, []byte, error) {
+	created, meta, err := getChecksum(db.reader(), gun, tufRole, checksum)
+	if _, ok := err.(ErrNotFound); ok && db.readsReplica() {
+		return getChecksum(db.DB, gun, tufRole, checksum)
+	}
+	return created, meta, err
+}
+
+func getChecksum(db *gorm.DB, gun data.GUN, tufRole data.RoleName, checksum string) (*time.Time, []byte, error) {
 	var row TUFFile
 	q := db.Select("created_at, data").Where(
 		&TUFFile{
@@ -289,6 +364,232 @@ func (db *SQLStorage) Delete(gun data.GUN) error {
 	return tx.Commit().Error
 }
 
+// lockForRewrite returns tx set up so that none of the given tables can be
+// written by other transactions, from the first read until tx ends, so that
+// tx can rewrite them based on what it reads without losing concurrent
+// writes.  SQLite transactions need no locks, since a write which would
+// conflict with data another connection has since changed fails instead.
+func lockForRewrite(tx *gorm.DB, tables ...string) (*gorm.DB, error) {
+	switch tx.Dialect().GetName() {
+	case "mysql":
+		// reads lock the rows they scan, and the gaps between them, so that
+		// no rows can be inserted between them either
+		return tx.Set("gorm:query_option", "FOR UPDATE"), nil
+	case "postgres":
+		// row locks do not stop new rows being inserted
+		err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", strings.Join(tables, ", "))).Error
+		return tx, err
+	}
+	return tx, nil
+}
+
+// GarbageCollect removes all metadata not referenced by the current timestamp
+// and snapshot of its GUN.  As with Delete, this is a hard delete.  The
+// metadata is read and deleted in a single transaction, so metadata which
+// becomes current in the meantime is not deleted.
+func (db *SQLStorage) GarbageCollect(dryRun bool) ([]MetaRecord, error) {
+	tx, rb, err := db.getTransaction()
+	if err != nil {
+		return nil, err
+	}
+	orphans, err := func() ([]MetaRecord, error) {
+		locked, err := lockForRewrite(tx, TUFFileTableName)
+		if err != nil {
+			return nil, err
+		}
+		var rows []TUFFile
+		if err := locked.Select("gun, role, version, sha256").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		records := make([]MetaRecord, 0, len(rows))
+		for _, row := range rows {
+			records = append(records, MetaRecord{
+				GUN:     data.GUN(row.Gun),
+				Role:    data.RoleName(row.Role),
+				Version: row.Version,
+				SHA256:  row.SHA256,
+			})
+		}
+		orphans, err := findOrphans(records, func(gun data.GUN, role data.RoleName, checksum string) ([]byte, error) {
+			_, data, err := getChecksum(locked, gun, role, checksum)
+			return data, err
+		})
+		if err != nil || dryRun {
+			return orphans, err
+		}
+		for _, orphan := range orphans {
+			err := tx.Unscoped().Where(
+				"gun = ? and role = ? and version = ?",
+				orphan.GUN.String(), orphan.Role.String(), orphan.Version,
+			).Delete(TUFFile{}).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+		return orphans, nil
+	}()
+	if err != nil {
+		return nil, rb(err)
+	}
+	if dryRun {
+		return orphans, rb(nil)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// ReindexChanges rebuilds the changefeed from the stored timestamps, and
+// renumbers it in the order the changes were made.  The timestamps and
+// changefeed are read, and the whole changefeed rewritten, in a single
+// transaction which keeps other transactions from writing either of them.
+func (db *SQLStorage) ReindexChanges(dryRun bool) (ReindexResult, error) {
+	tx, rb, err := db.getTransaction()
+	if err != nil {
+		return ReindexResult{}, err
+	}
+	result, err := func() (ReindexResult, error) {
+		locked, err := lockForRewrite(tx, TUFFileTableName, ChangefeedTableName)
+		if err != nil {
+			return ReindexResult{}, err
+		}
+		var rows []TUFFile
+		err = locked.Select("gun, version, sha256, created_at").
+			Where("role = ?", data.CanonicalTimestampRole.String()).Find(&rows).Error
+		if err != nil {
+			return ReindexResult{}, err
+		}
+		timestamps := make([]storedTimestamp, 0, len(rows))
+		for _, row := range rows {
+			timestamps = append(timestamps, storedTimestamp{
+				GUN:       data.GUN(row.Gun),
+				Version:   row.Version,
+				SHA256:    row.SHA256,
+				CreatedAt: row.CreatedAt,
+			})
+		}
+
+		var changes []Change
+		if err := locked.Order("id asc").Find(&changes).Error; err != nil {
+			return ReindexResult{}, err
+		}
+		changes, result := reindexChanges(changes, timestamps)
+		if dryRun {
+			return result, nil
+		}
+
+		if err := tx.Delete(SQLChange{}).Error; err != nil {
+			return ReindexResult{}, err
+		}
+		for _, c := range changes {
+			id, err := strconv.ParseUint(c.ID, 10, 32)
+			if err != nil {
+				return ReindexResult{}, err
+			}
+			err = tx.Create(&SQLChange{
+				ID:        uint(id),
+				CreatedAt: c.CreatedAt,
+				GUN:       c.GUN,
+				Version:   c.Version,
+				SHA256:    c.SHA256,
+				Category:  c.Category,
+			}).Error
+			if err != nil {
+				return ReindexResult{}, err
+			}
+		}
+		if tx.Dialect().GetName() == "postgres" {
+			// explicitly inserted IDs don't advance the sequence which numbers
+			// new changes
+			err := tx.Exec(fmt.Sprintf(
+				"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM %[1]s), false)",
+				ChangefeedTableName)).Error
+			if err != nil {
+				return ReindexResult{}, err
+			}
+		}
+		return result, nil
+	}()
+	if err != nil {
+		return ReindexResult{}, rb(err)
+	}
+	if dryRun {
+		return result, rb(nil)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return ReindexResult{}, err
+	}
+	return result, nil
+}
+
+// Export calls fn with every stored version of every role, ordered by GUN,
+// role and version.  Rows are read from the database one at a time.
+func (db *SQLStorage) Export(fn func(ExportedMeta) error) error {
+	rows, err := db.Model(&TUFFile{}).Order("gun, role, version").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row TUFFile
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		err := fn(ExportedMeta{
+			Record: MetaRecord{
+				GUN:     data.GUN(row.Gun),
+				Role:    data.RoleName(row.Role),
+				Version: row.Version,
+				SHA256:  row.SHA256,
+			},
+			Data: row.Data,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SetExpiry sets how long the server-signed snapshot or timestamp of a GUN
+// is valid for, to the nearest second, or removes the override if expiry is
+// zero
+func (db *SQLStorage) SetExpiry(gun data.GUN, tufRole data.RoleName, expiry time.Duration) error {
+	tx, rb, err := db.getTransaction()
+	if err != nil {
+		return err
+	}
+	err = tx.Where("gun = ? and role = ?", gun.String(), tufRole.String()).Delete(TUFExpiry{}).Error
+	if err != nil {
+		return rb(err)
+	}
+	if expiry != 0 {
+		err = tx.Create(&TUFExpiry{
+			Gun:     gun.String(),
+			Role:    tufRole.String(),
+			Seconds: int64(expiry / time.Second),
+		}).Error
+		if err != nil {
+			return rb(err)
+		}
+	}
+	return tx.Commit().Error
+}
+
+// GetExpiry returns the expiry set for the snapshot or timestamp of a GUN, or
+// zero if there is none
+func (db *SQLStorage) GetExpiry(gun data.GUN, tufRole data.RoleName) (time.Duration, error) {
+	var row TUFExpiry
+	q := db.Where("gun = ? and role = ?", gun.String(), tufRole.String()).Take(&row)
+	if q.RecordNotFound() {
+		return 0, nil
+	} else if q.Error != nil {
+		return 0, q.Error
+	}
+	return time.Duration(row.Seconds) * time.Second, nil
+}
+
 // CheckHealth asserts that the tuf_files table is present
 func (db *SQLStorage) CheckHealth() (err error) {
 	defer func() {
@@ -297,6 +598,18 @@ func (db *SQLStorage) CheckHealth() (err error) {
 		}
 	}()
 
+	if err := checkTable(db.DB); err != nil {
+		return err
+	}
+	if db.replica != nil {
+		if err := checkTable(db.replica); err != nil {
+			return fmt.Errorf("replica: %s", err)
+		}
+	}
+	return nil
+}
+
+func checkTable(db *gorm.DB) error {
 	tableOk := db.HasTable(&TUFFile{})
 	if db.Error != nil {
 		return db.Error
@@ -308,13 +621,13 @@ func (db *SQLStorage) CheckHealth() (err error) {
 	return nil
 }
 
-// GetChanges returns up to pageSize changes starting from changeID.
+// GetChanges returns up to pageSize changes starting from changeID.  If the
+// replica does not have the change to start from yet, the changes are read
+// from the primary.
 func (db *SQLStorage) GetChanges(changeID string, records int, filterName string) ([]Change, error) {
 	var (
-		changes []Change
-		query   = db.DB
-		id      int64
-		err     error
+		id  int64
+		err error
 	)
 	if changeID == "" {
 		id = 0
@@ -325,6 +638,24 @@ func (db *SQLStorage) GetChanges(changeID string, records int, filterName string
 		}
 	}
 
+	changes, err := getChanges(db.reader(), id, records, filterName)
+	if err != nil || len(changes) > 0 || id <= 0 || !db.readsReplica() {
+		return changes, err
+	}
+	// a client paging forward from a change the replica has not got yet would
+	// otherwise never see the changes after it until the replica caught up
+	var start Change
+	if q := db.replica.Select("id").Where("id = ?", id).Take(&start); q.RecordNotFound() {
+		return getChanges(db.DB, id, records, filterName)
+	} else if q.Error != nil {
+		return nil, q.Error
+	}
+	return changes, nil
+}
+
+func getChanges(query *gorm.DB, id int64, records int, filterName string) ([]Change, error) {
+	var changes []Change
+
 	// do what I mean, not what I said, i.e. if I passed a negative number for the ID
 	// it's assumed I mean "start from latest and go backwards"
 	reversed := id < 0
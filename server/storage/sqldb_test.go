@@ -22,6 +22,7 @@ func SetupSQLDB(t *testing.T, dbtype, dburl string) *SQLStorage {
 	// Create the DB tables
 	require.NoError(t, CreateTUFTable(dbStore.DB))
 	require.NoError(t, CreateChangefeedTable(dbStore.DB))
+	require.NoError(t, CreateExpiryTable(dbStore.DB))
 
 	// verify that the tables are empty
 	var count int
@@ -243,3 +244,167 @@ func TestSQLDBGetVersion(t *testing.T) {
 
 	testGetVersion(t, dbStore)
 }
+
+// TestSQLGarbageCollect asserts that GarbageCollect removes only orphaned
+// TUF metadata
+func TestSQLGarbageCollect(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+
+	testGarbageCollect(t, dbStore)
+}
+
+// TestSQLReindexChanges asserts that ReindexChanges rebuilds a changefeed
+// which has been edited out of order
+func TestSQLReindexChanges(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+
+	testReindexChanges(t, dbStore, func() {
+		var first SQLChange
+		require.NoError(t, dbStore.Where("id = ?", 1).Take(&first).Error)
+		for _, stmt := range []string{
+			"UPDATE changefeed SET id = 100 WHERE id = 1",
+			"UPDATE changefeed SET id = 1 WHERE id = 2",
+			"UPDATE changefeed SET id = 2 WHERE id = 100",
+			"DELETE FROM changefeed WHERE id = 3",
+		} {
+			require.NoError(t, dbStore.Exec(stmt).Error)
+		}
+		first.ID = 0
+		require.NoError(t, dbStore.Create(&first).Error)
+	})
+}
+
+// TestSQLExpiry asserts that per-GUN expiries can be set, replaced and removed
+func TestSQLExpiry(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+
+	testExpiry(t, dbStore)
+}
+
+// TestSQLExportImport asserts that metadata can be moved between the memory
+// and SQL stores, in either direction, keeping its versions and checksums
+func TestSQLExportImport(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+	testExportImport(t, NewMemStorage(), dbStore)
+
+	otherDBStore, otherCleanup := sqldbSetup(t)
+	defer otherCleanup()
+	testExportImport(t, otherDBStore, NewMemStorage())
+	testImportInvalid(t, dbStore)
+	testImportBatches(t, dbStore)
+}
+
+func TestSQLComputeMetaSizes(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+
+	testComputeMetaSizes(t, dbStore)
+}
+
+// TestSQLReplicaReadRouting asserts that with a read replica, writes go to the
+// primary and GetCurrent, GetChecksum and GetChanges read from the replica,
+// falling back on the primary for what the replica does not have yet
+func TestSQLReplicaReadRouting(t *testing.T) {
+	primary, cleanup := sqldbSetup(t)
+	defer cleanup()
+	replica, replicaCleanup := sqldbSetup(t)
+	defer replicaCleanup()
+	primary.SetReplica(replica.DB)
+
+	timestamp := func(version int, tufdata string) MetaUpdate {
+		return MetaUpdate{Role: data.CanonicalTimestampRole, Version: version, Data: []byte(tufdata)}
+	}
+	checksum := func(tufdata string) string {
+		sum := sha256.Sum256([]byte(tufdata))
+		return hex.EncodeToString(sum[:])
+	}
+
+	// the replica has caught up to version 1, but not version 2, of one GUN,
+	// and has none of the other
+	require.NoError(t, replica.UpdateCurrent("replicated", timestamp(1, "replica 1")))
+	require.NoError(t, primary.UpdateCurrent("replicated", timestamp(1, "primary 1")))
+	require.NoError(t, primary.UpdateCurrent("replicated", timestamp(2, "primary 2")))
+	require.NoError(t, primary.UpdateCurrent("unreplicated", timestamp(1, "primary unreplicated")))
+
+	// writes were not made to the replica
+	_, replicaData, err := replica.GetCurrent("replicated", data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.Equal(t, "replica 1", string(replicaData))
+	_, _, err = replica.GetCurrent("unreplicated", data.CanonicalTimestampRole)
+	require.IsType(t, ErrNotFound{}, err)
+
+	// reads come from the replica, even when it lags behind the primary
+	_, current, err := primary.GetCurrent("replicated", data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.Equal(t, "replica 1", string(current))
+	_, byChecksum, err := primary.GetChecksum("replicated", data.CanonicalTimestampRole, checksum("replica 1"))
+	require.NoError(t, err)
+	require.Equal(t, "replica 1", string(byChecksum))
+
+	// unless the replica does not have the record yet
+	_, current, err = primary.GetCurrent("unreplicated", data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.Equal(t, "primary unreplicated", string(current))
+	_, byChecksum, err = primary.GetChecksum("replicated", data.CanonicalTimestampRole, checksum("primary 2"))
+	require.NoError(t, err)
+	require.Equal(t, "primary 2", string(byChecksum))
+	_, _, err = primary.GetCurrent("nonexistent", data.CanonicalTimestampRole)
+	require.IsType(t, ErrNotFound{}, err)
+
+	// the replica only has the first change, so paging from it reads the
+	// replica, and paging from a later change reads the primary
+	changes, err := primary.GetChanges("0", 10, "")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, checksum("replica 1"), changes[0].SHA256)
+	changes, err = primary.GetChanges("1", 10, "")
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	changes, err = primary.GetChanges("2", 10, "")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, checksum("primary unreplicated"), changes[0].SHA256)
+
+	// reading from the primary ignores the replica
+	require.NoError(t, primary.SetReadPreference(ReadPrimary))
+	_, current, err = primary.GetCurrent("replicated", data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.Equal(t, "primary 2", string(current))
+	changes, err = primary.GetChanges("0", 10, "")
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+
+	require.NoError(t, primary.SetReadPreference(ReadReplica))
+	_, current, err = primary.GetCurrent("replicated", data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.Equal(t, "replica 1", string(current))
+	require.Error(t, primary.SetReadPreference("nearest"))
+
+	// as does the primary view of the store, even when wrapped, whatever the
+	// read preference
+	for _, store := range []MetaStore{primary, NewMeteredMetaStore(*NewTUFMetaStorage(primary))} {
+		_, current, err = Primary(store).GetCurrent("replicated", data.CanonicalTimestampRole)
+		require.NoError(t, err)
+		require.Equal(t, "primary 2", string(current))
+		_, _, err = Primary(store).GetChecksum("replicated", data.CanonicalTimestampRole, checksum("primary 2"))
+		require.NoError(t, err)
+	}
+}
+
+// TestSQLDBCheckHealthReplica asserts that the health check also fails if the
+// replica is not connectable
+func TestSQLDBCheckHealthReplica(t *testing.T) {
+	primary, cleanup := sqldbSetup(t)
+	defer cleanup()
+	replica, replicaCleanup := sqldbSetup(t)
+	defer replicaCleanup()
+	primary.SetReplica(replica.DB)
+
+	require.NoError(t, primary.CheckHealth())
+	replica.DropTable(&TUFFile{})
+	require.Error(t, primary.CheckHealth())
+}
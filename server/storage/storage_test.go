@@ -1,13 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/docker/go/canonical/json"
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/tuf/data"
 )
 
@@ -458,3 +462,367 @@ func testGetChanges(t *testing.T, s MetaStore) {
 	require.NotEqual(t, "alpine", c[0].GUN)
 
 }
+
+// sampleReferencingTUFObj creates a timestamp or snapshot which references
+// the given TUF objects by checksum
+func sampleReferencingTUFObj(t *testing.T, gun data.GUN, role data.RoleName, version int, refs ...StoredTUFMeta) StoredTUFMeta {
+	meta := make(data.Files)
+	for _, ref := range refs {
+		checksum, err := hex.DecodeString(ref.SHA256)
+		require.NoError(t, err)
+		meta[ref.Role.String()] = data.FileMeta{
+			Length: int64(len(ref.Data)),
+			Hashes: data.Hashes{notary.SHA256: checksum},
+		}
+	}
+	signed := data.Timestamp{
+		SignedCommon: data.SignedCommon{Type: data.TUFTypes[role], Version: version},
+		Meta:         meta,
+	}
+	tufdata, err := json.Marshal(data.SignedTimestamp{Signed: signed})
+	require.NoError(t, err)
+	return SampleCustomTUFObj(gun, role, version, tufdata)
+}
+
+func toMetaRecords(tufObjs ...StoredTUFMeta) []MetaRecord {
+	records := make([]MetaRecord, 0, len(tufObjs))
+	for _, tufObj := range tufObjs {
+		records = append(records, MetaRecord{
+			GUN:     tufObj.Gun,
+			Role:    tufObj.Role,
+			Version: tufObj.Version,
+			SHA256:  tufObj.SHA256,
+		})
+	}
+	return records
+}
+
+// storeGarbage stores the current and previous metadata of a GUN, along with
+// metadata which is referenced by neither, and returns the metadata which is
+// kept and which is orphaned
+func storeGarbage(t *testing.T, s MetaStore) (kept, orphans []StoredTUFMeta) {
+	gun := data.GUN("testGUN")
+	root := SampleCustomTUFObj(gun, data.CanonicalRootRole, 1, nil)
+	targets1 := SampleCustomTUFObj(gun, data.CanonicalTargetsRole, 1, nil)
+	targets2 := SampleCustomTUFObj(gun, data.CanonicalTargetsRole, 2, nil)
+	delegation := SampleCustomTUFObj(gun, "targets/a", 1, nil)
+	snapshot1 := sampleReferencingTUFObj(t, gun, data.CanonicalSnapshotRole, 1, root, targets1, delegation)
+	snapshot2 := sampleReferencingTUFObj(t, gun, data.CanonicalSnapshotRole, 2, root, targets2, delegation)
+	timestamp1 := sampleReferencingTUFObj(t, gun, data.CanonicalTimestampRole, 1, snapshot1)
+	timestamp2 := sampleReferencingTUFObj(t, gun, data.CanonicalTimestampRole, 2, snapshot2)
+
+	// left behind by a partial publish, and by a deleted delegation
+	targets3 := SampleCustomTUFObj(gun, data.CanonicalTargetsRole, 3, nil)
+	snapshot3 := sampleReferencingTUFObj(t, gun, data.CanonicalSnapshotRole, 3, root, targets3, delegation)
+	deleted := SampleCustomTUFObj(gun, "targets/deleted", 1, nil)
+
+	// a GUN without a timestamp has no current state, so is left alone
+	incomplete := SampleCustomTUFObj("incompleteGUN", "targets/a", 1, nil)
+
+	for _, tufObj := range []StoredTUFMeta{
+		root, targets1, delegation, deleted, snapshot1, timestamp1,
+		targets2, snapshot2, timestamp2, targets3, snapshot3, incomplete,
+	} {
+		require.NoError(t, s.UpdateCurrent(tufObj.Gun, MakeUpdate(tufObj)))
+	}
+	return []StoredTUFMeta{root, targets1, targets2, delegation, snapshot1, snapshot2, timestamp1, timestamp2, incomplete},
+		[]StoredTUFMeta{targets3, snapshot3, deleted}
+}
+
+// GarbageCollect removes only the metadata not referenced by the current
+// timestamp and snapshot of its GUN, and removes nothing on a dry run
+func testGarbageCollect(t *testing.T, s MetaStore) {
+	kept, orphans := storeGarbage(t, s)
+
+	collected, err := s.GarbageCollect(true)
+	require.NoError(t, err)
+	require.ElementsMatch(t, toMetaRecords(orphans...), collected)
+	assertExpectedTUFMetaInStore(t, s, append(kept, orphans...), false)
+
+	collected, err = s.GarbageCollect(false)
+	require.NoError(t, err)
+	require.ElementsMatch(t, toMetaRecords(orphans...), collected)
+	assertExpectedTUFMetaInStore(t, s, kept, false)
+	for _, tufObj := range orphans {
+		_, _, err := s.GetChecksum(tufObj.Gun, tufObj.Role, tufObj.SHA256)
+		require.IsType(t, ErrNotFound{}, err)
+	}
+
+	// the current metadata is the metadata referenced by the current timestamp
+	_, current, err := s.GetCurrent("testGUN", data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Equal(t, kept[2].Data, current)
+
+	collected, err = s.GarbageCollect(false)
+	require.NoError(t, err)
+	require.Empty(t, collected)
+}
+
+// Exporting metadata from one store and importing it into another, empty,
+// store preserves every version and checksum of every role
+func testExportImport(t *testing.T, from, to MetaStore) {
+	var stored []StoredTUFMeta
+	for _, gun := range []data.GUN{"testGUN", "otherGUN"} {
+		for _, role := range []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole, "targets/a"} {
+			for version := 1; version <= 2; version++ {
+				tufObj := SampleCustomTUFObj(gun, role, version, nil)
+				require.NoError(t, from.UpdateCurrent(gun, MakeUpdate(tufObj)))
+				stored = append(stored, tufObj)
+			}
+		}
+	}
+
+	var exported bytes.Buffer
+	count, err := ExportMeta(from, &exported)
+	require.NoError(t, err)
+	require.Equal(t, len(stored), count)
+
+	// the export is ordered by GUN, role and version
+	var records []MetaRecord
+	require.NoError(t, from.Export(func(meta ExportedMeta) error {
+		records = append(records, meta.Record)
+		return nil
+	}))
+	require.Len(t, records, len(stored))
+	require.True(t, sort.SliceIsSorted(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.GUN != b.GUN {
+			return a.GUN < b.GUN
+		}
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return a.Version < b.Version
+	}))
+	require.ElementsMatch(t, toMetaRecords(stored...), records)
+
+	count, err = ImportMeta(to, bytes.NewReader(exported.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, len(stored), count)
+	assertExpectedTUFMetaInStore(t, to, stored, false)
+	for _, tufObj := range stored {
+		_, tufdata, err := to.GetVersion(tufObj.Gun, tufObj.Role, tufObj.Version)
+		require.NoError(t, err)
+		require.Equal(t, tufObj.Data, tufdata)
+	}
+
+	// exporting again gives exactly the same data
+	var reexported bytes.Buffer
+	_, err = ExportMeta(to, &reexported)
+	require.NoError(t, err)
+	require.Equal(t, exported.String(), reexported.String())
+
+	// the data can't be imported twice, since the versions already exist
+	_, err = ImportMeta(to, bytes.NewReader(exported.Bytes()))
+	require.Error(t, err)
+}
+
+// Importing fails without adding anything if any data does not match its
+// checksum, or can't be parsed
+func testImportInvalid(t *testing.T, s MetaStore) {
+	tufObj := SampleCustomTUFObj("invalidGUN", data.CanonicalRootRole, 1, nil)
+	meta := ExportedMeta{
+		Record: MetaRecord{GUN: tufObj.Gun, Role: tufObj.Role, Version: tufObj.Version, SHA256: tufObj.SHA256},
+		Data:   []byte("not the data"),
+	}
+	line, err := json.Marshal(meta)
+	require.NoError(t, err)
+	_, err = ImportMeta(s, bytes.NewReader(line))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not match")
+
+	_, err = ImportMeta(s, bytes.NewReader([]byte("{not json")))
+	require.Error(t, err)
+
+	_, _, err = s.GetCurrent(tufObj.Gun, tufObj.Role)
+	require.IsType(t, ErrNotFound{}, err)
+}
+
+// The size of a seeded GUN's metadata is reported per role, for the current
+// version and for all stored versions, and totalled per GUN and store
+func testComputeMetaSizes(t *testing.T, s MetaStore) {
+	sizes, err := ComputeMetaSizes(s)
+	require.NoError(t, err)
+	require.Equal(t, MetaSizes{GUNs: []GUNSize{}}, sizes)
+
+	seed := []MetaUpdate{
+		{Role: data.CanonicalRootRole, Version: 1, Data: []byte("root1")},
+		{Role: data.CanonicalTargetsRole, Version: 1, Data: []byte("targets1")},
+		{Role: data.CanonicalTargetsRole, Version: 2, Data: []byte("targets22")},
+		{Role: "targets/a", Version: 1, Data: []byte("a")},
+	}
+	require.NoError(t, s.UpdateMany("sizedGUN", seed))
+	require.NoError(t, s.UpdateCurrent("otherGUN", MetaUpdate{Role: data.CanonicalRootRole, Version: 1, Data: []byte("root")}))
+
+	sizes, err = ComputeMetaSizes(s)
+	require.NoError(t, err)
+	require.Equal(t, MetaSizes{
+		GUNs: []GUNSize{
+			{
+				GUN:          "otherGUN",
+				Roles:        []RoleSize{{Role: data.CanonicalRootRole, Versions: 1, CurrentBytes: 4, TotalBytes: 4}},
+				CurrentBytes: 4,
+				TotalBytes:   4,
+			},
+			{
+				GUN: "sizedGUN",
+				Roles: []RoleSize{
+					{Role: data.CanonicalRootRole, Versions: 1, CurrentBytes: 5, TotalBytes: 5},
+					{Role: data.CanonicalTargetsRole, Versions: 2, CurrentBytes: 9, TotalBytes: 17},
+					{Role: "targets/a", Versions: 1, CurrentBytes: 1, TotalBytes: 1},
+				},
+				CurrentBytes: 15,
+				TotalBytes:   23,
+			},
+		},
+		CurrentBytes: 19,
+		TotalBytes:   27,
+	}, sizes)
+}
+
+// Expiries are set per GUN and role, replaced when set again, and removed by
+// setting them to zero
+func testExpiry(t *testing.T, s MetaStore) {
+	expiry, err := s.GetExpiry("testGUN", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Zero(t, expiry)
+
+	require.NoError(t, s.SetExpiry("testGUN", data.CanonicalSnapshotRole, 48*time.Hour))
+	require.NoError(t, s.SetExpiry("testGUN", data.CanonicalTimestampRole, 2*time.Hour))
+	require.NoError(t, s.SetExpiry("otherGUN", data.CanonicalSnapshotRole, time.Hour))
+
+	expiry, err = s.GetExpiry("testGUN", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Equal(t, 48*time.Hour, expiry)
+	expiry, err = s.GetExpiry("testGUN", data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, expiry)
+
+	// setting an expiry again replaces it
+	require.NoError(t, s.SetExpiry("testGUN", data.CanonicalSnapshotRole, 72*time.Hour))
+	expiry, err = s.GetExpiry("testGUN", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Equal(t, 72*time.Hour, expiry)
+
+	// setting an expiry of zero removes it, without affecting other GUNs
+	require.NoError(t, s.SetExpiry("testGUN", data.CanonicalSnapshotRole, 0))
+	expiry, err = s.GetExpiry("testGUN", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Zero(t, expiry)
+	expiry, err = s.GetExpiry("otherGUN", data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, expiry)
+
+	// removing an expiry which is not set is not an error
+	require.NoError(t, s.SetExpiry("testGUN", data.CanonicalSnapshotRole, 0))
+}
+
+// changeSummary is the part of a change which reindexing determines, other
+// than when it was made
+type changeSummary struct {
+	ID       string
+	GUN      string
+	Version  int
+	Category string
+}
+
+func summarizeChanges(t *testing.T, s MetaStore) []changeSummary {
+	changes, err := s.GetChanges("0", 100, "")
+	require.NoError(t, err)
+	summaries := make([]changeSummary, 0, len(changes))
+	for _, c := range changes {
+		summaries = append(summaries, changeSummary{ID: c.ID, GUN: c.GUN, Version: c.Version, Category: c.Category})
+	}
+	return summaries
+}
+
+// Reindexing rebuilds a changefeed whose order has become inconsistent with
+// the stored timestamps, and does nothing on a dry run.  scramble must swap
+// the IDs of the first two changes, remove the third, and duplicate the first
+// at the end of the changefeed.
+func testReindexChanges(t *testing.T, s ChangefeedReindexer, scramble func()) {
+	store := s.(MetaStore)
+	for _, update := range []struct {
+		gun     data.GUN
+		version int
+	}{{"alpine", 1}, {"busybox", 1}, {"alpine", 2}, {"debian", 1}} {
+		tufObj := SampleCustomTUFObj(update.gun, data.CanonicalTimestampRole, update.version, nil)
+		require.NoError(t, store.UpdateCurrent(tufObj.Gun, MakeUpdate(tufObj)))
+	}
+	require.NoError(t, store.Delete("debian"))
+
+	consistent := []changeSummary{
+		{ID: "1", GUN: "alpine", Version: 1, Category: changeCategoryUpdate},
+		{ID: "2", GUN: "busybox", Version: 1, Category: changeCategoryUpdate},
+		{ID: "3", GUN: "alpine", Version: 2, Category: changeCategoryUpdate},
+		{ID: "4", GUN: "debian", Version: 1, Category: changeCategoryUpdate},
+		{ID: "5", GUN: "debian", Category: changeCategoryDeletion},
+	}
+	require.Equal(t, consistent, summarizeChanges(t, store))
+
+	// a consistent changefeed is left as it is
+	result, err := s.ReindexChanges(false)
+	require.NoError(t, err)
+	require.Equal(t, ReindexResult{NumberOfChanges: 5}, result)
+	require.Equal(t, consistent, summarizeChanges(t, store))
+
+	scramble()
+	scrambled := summarizeChanges(t, store)
+	require.NotEqual(t, consistent, scrambled)
+
+	// every change from the first one out of order is numbered on from the
+	// highest ID, 6, so that no consumer's position in the changefeed is lost
+	expected := ReindexResult{NumberOfChanges: 5, Renumbered: 4, Added: 1, Removed: 1}
+	result, err = s.ReindexChanges(true)
+	require.NoError(t, err)
+	require.Equal(t, expected, result)
+	require.Equal(t, scrambled, summarizeChanges(t, store))
+
+	result, err = s.ReindexChanges(false)
+	require.NoError(t, err)
+	require.Equal(t, expected, result)
+	rebuilt := make([]changeSummary, 0, len(consistent))
+	for i, c := range consistent {
+		c.ID = fmt.Sprint(7 + i)
+		rebuilt = append(rebuilt, c)
+	}
+	require.Equal(t, rebuilt, summarizeChanges(t, store))
+	changes, err := store.GetChanges("6", 10, "")
+	require.NoError(t, err)
+	require.Len(t, changes, len(rebuilt))
+
+	// new changes follow on from the rebuilt changefeed
+	tufObj := SampleCustomTUFObj("alpine", data.CanonicalTimestampRole, 3, nil)
+	require.NoError(t, store.UpdateCurrent(tufObj.Gun, MakeUpdate(tufObj)))
+	changes, err = store.GetChanges("11", 10, "")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, "alpine", changes[0].GUN)
+	require.Equal(t, 3, changes[0].Version)
+}
+
+// Importing more versions than fit in one batch adds them all, and if a later
+// entry is invalid, the batches before it are kept and counted
+func testImportBatches(t *testing.T, s MetaStore) {
+	var (
+		stored []StoredTUFMeta
+		lines  bytes.Buffer
+	)
+	enc := json.NewEncoder(&lines)
+	for version := 1; version <= importBatchSize+1; version++ {
+		tufObj := SampleCustomTUFObj("batchGUN", data.CanonicalTargetsRole, version, nil)
+		stored = append(stored, tufObj)
+		require.NoError(t, enc.Encode(ExportedMeta{
+			Record: MetaRecord{GUN: tufObj.Gun, Role: tufObj.Role, Version: tufObj.Version, SHA256: tufObj.SHA256},
+			Data:   tufObj.Data,
+		}))
+	}
+	lines.WriteString("{not json")
+
+	count, err := ImportMeta(s, &lines)
+	require.Error(t, err)
+	require.Equal(t, importBatchSize, count)
+	assertExpectedTUFMetaInStore(t, s, stored[:importBatchSize], false)
+	_, _, err = s.GetVersion("batchGUN", data.CanonicalTargetsRole, importBatchSize+1)
+	require.IsType(t, ErrNotFound{}, err)
+}
@@ -91,3 +91,17 @@ func (tms TUFMetaStorage) Bootstrap() error {
 	}
 	return fmt.Errorf("store does not support bootstrapping")
 }
+
+// Primary returns a view of the store which makes every read from the primary,
+// if the wrapped store may read from a replica
+func (tms TUFMetaStorage) Primary() MetaStore {
+	return NewTUFMetaStorage(Primary(tms.MetaStore))
+}
+
+// ReindexChanges rebuilds the changefeed of the store if it supports it
+func (tms TUFMetaStorage) ReindexChanges(dryRun bool) (ReindexResult, error) {
+	if s, ok := tms.MetaStore.(ChangefeedReindexer); ok {
+		return s.ReindexChanges(dryRun)
+	}
+	return ReindexResult{}, ErrReindexNotSupported{}
+}
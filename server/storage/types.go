@@ -1,6 +1,9 @@
 package storage
 
-import "github.com/theupdateframework/notary/tuf/data"
+import (
+	"github.com/theupdateframework/notary/server/meta"
+	"github.com/theupdateframework/notary/tuf/data"
+)
 
 // MetaUpdate packages up the fields required to update a TUF record
 type MetaUpdate struct {
@@ -8,3 +11,10 @@ type MetaUpdate struct {
 	Version int
 	Data    []byte
 }
+
+// MetaRecord identifies a single stored version of a TUF role for a GUN
+type MetaRecord = meta.Record
+
+// ExportedMeta is a single stored version of a TUF role for a GUN, along with
+// its data
+type ExportedMeta = meta.ExportedMeta
@@ -0,0 +1,50 @@
+package timestamp
+
+import (
+	"fmt"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tsa"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// Authority is an external timestamping authority which countersigns the
+// snapshot referenced by each timestamp the server generates
+type Authority struct {
+	Client *tsa.Client
+	// Required causes timestamp generation to fail if a token cannot be
+	// obtained, rather than generating a timestamp without one
+	Required bool
+}
+
+// SnapshotCustom obtains a token for the snapshot metadata from the timestamping
+// authority, and returns it as custom data to attach to that metadata.  It is
+// safe to call on a nil Authority, in which case no custom data is returned.
+func (a *Authority) SnapshotCustom(meta data.FileMeta) (*json.RawMessage, error) {
+	if a == nil {
+		return nil, nil
+	}
+	custom, err := a.snapshotCustom(meta)
+	if err != nil {
+		if a.Required {
+			return nil, err
+		}
+		logrus.Warnf("generating timestamp without a timestamping authority token: %v", err)
+		return nil, nil
+	}
+	return custom, nil
+}
+
+func (a *Authority) snapshotCustom(meta data.FileMeta) (*json.RawMessage, error) {
+	digest, ok := meta.Hashes[notary.SHA256]
+	if !ok {
+		return nil, data.ErrMissingMeta{Role: data.CanonicalSnapshotRole.String()}
+	}
+	token, err := a.Client.Timestamp(digest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain timestamping authority token: %w", err)
+	}
+	return tsa.NewCustom(token)
+}
@@ -70,8 +70,9 @@ func RotateTimestampKey(gun data.GUN, store storage.MetaStore, crypto signed.Cry
 // a new timestamp is generated either because none exists, or because the current
 // one has expired. Once generated, the timestamp is saved in the store.
 // Additionally, if we had to generate a new snapshot for this timestamp,
-// it is also saved in the store
-func GetOrCreateTimestamp(gun data.GUN, store storage.MetaStore, cryptoService signed.CryptoService) (
+// it is also saved in the store.  If authority is not nil, a newly generated
+// timestamp carries a token from that timestamping authority for its snapshot.
+func GetOrCreateTimestamp(gun data.GUN, store storage.MetaStore, cryptoService signed.CryptoService, authority *Authority) (
 	*time.Time, []byte, error) {
 
 	updates := []storage.MetaUpdate{}
@@ -116,7 +117,7 @@ func GetOrCreateTimestamp(gun data.GUN, store storage.MetaStore, cryptoService s
 		return lastModified, timestampJSON, nil
 	}
 
-	tsUpdate, err := createTimestamp(gun, prev, snapshot, store, cryptoService)
+	tsUpdate, err := createTimestamp(gun, prev, snapshot, store, cryptoService, authority)
 	if err != nil {
 		logrus.Error("Failed to create a new timestamp")
 		return nil, nil, err
@@ -150,7 +151,7 @@ func snapshotExpired(ts *data.SignedTimestamp, snapshot []byte) bool {
 // version number one higher than prev. The store is used to lookup the current
 // snapshot, this function does not save the newly generated timestamp.
 func createTimestamp(gun data.GUN, prev *data.SignedTimestamp, snapshot []byte, store storage.MetaStore,
-	cryptoService signed.CryptoService) (*storage.MetaUpdate, error) {
+	cryptoService signed.CryptoService, authority *Authority) (*storage.MetaUpdate, error) {
 
 	builder := tuf.NewRepoBuilder(gun, cryptoService, trustpinning.TrustPinConfig{})
 
@@ -171,7 +172,13 @@ func createTimestamp(gun data.GUN, prev *data.SignedTimestamp, snapshot []byte,
 		return nil, err
 	}
 
-	meta, ver, err := builder.GenerateTimestamp(prev)
+	expiry, err := store.GetExpiry(gun, data.CanonicalTimestampRole)
+	if err != nil {
+		return nil, err
+	}
+	builder.SetExpiry(data.CanonicalTimestampRole, expiry)
+
+	meta, ver, err := builder.GenerateTimestampWithCustom(prev, authority.SnapshotCustom)
 	if err != nil {
 		return nil, err
 	}
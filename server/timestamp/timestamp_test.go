@@ -3,12 +3,17 @@ package timestamp
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/docker/go/canonical/json"
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tsa"
+	tsatestutils "github.com/theupdateframework/notary/tsa/testutils"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 	"github.com/theupdateframework/notary/tuf/testutils"
@@ -78,7 +83,7 @@ func TestGetTimestampNoPreviousTimestamp(t *testing.T) {
 					storage.MetaUpdate{Role: data.CanonicalTimestampRole, Version: 0, Data: timestampJSON}))
 		}
 
-		_, _, err = GetOrCreateTimestamp(gun, store, crypto)
+		_, _, err = GetOrCreateTimestamp(gun, store, crypto, nil)
 		require.Error(t, err, "GetTimestamp should have failed")
 		if timestampJSON == nil {
 			require.IsType(t, storage.ErrNotFound{}, err)
@@ -103,7 +108,7 @@ func TestGetTimestampReturnsPreviousTimestampIfUnexpired(t *testing.T) {
 	require.NoError(t, store.UpdateCurrent("gun",
 		storage.MetaUpdate{Role: data.CanonicalTimestampRole, Version: 0, Data: meta[data.CanonicalTimestampRole]}))
 
-	_, gottenTimestamp, err := GetOrCreateTimestamp("gun", store, crypto)
+	_, gottenTimestamp, err := GetOrCreateTimestamp("gun", store, crypto, nil)
 	require.NoError(t, err, "GetTimestamp should not have failed")
 	require.True(t, bytes.Equal(meta[data.CanonicalTimestampRole], gottenTimestamp))
 }
@@ -131,7 +136,7 @@ func TestGetTimestampOldTimestampExpired(t *testing.T) {
 	require.NoError(t, store.UpdateCurrent("gun",
 		storage.MetaUpdate{Role: data.CanonicalTimestampRole, Version: 1, Data: timestampJSON}))
 
-	_, gottenTimestamp, err := GetOrCreateTimestamp("gun", store, crypto)
+	_, gottenTimestamp, err := GetOrCreateTimestamp("gun", store, crypto, nil)
 	require.NoError(t, err, "GetTimestamp errored")
 
 	require.False(t, bytes.Equal(timestampJSON, gottenTimestamp),
@@ -143,6 +148,97 @@ func TestGetTimestampOldTimestampExpired(t *testing.T) {
 	require.True(t, signedMeta.Signed.Expires.After(time.Now()))
 }
 
+// setupExpiredTimestamp stores metadata for a repo whose timestamp has expired, so
+// that GetOrCreateTimestamp has to generate a new one
+func setupExpiredTimestamp(t *testing.T) (*storage.MemStorage, signed.CryptoService) {
+	store := storage.NewMemStorage()
+	repo, crypto, err := testutils.EmptyRepo("gun")
+	require.NoError(t, err)
+
+	meta, err := testutils.SignAndSerialize(repo)
+	require.NoError(t, err)
+
+	_, err = repo.SignTimestamp(time.Now().AddDate(-1, -1, -1))
+	require.NoError(t, err)
+	timestampJSON, err := json.Marshal(repo.Timestamp)
+	require.NoError(t, err)
+
+	require.NoError(t, store.UpdateCurrent("gun",
+		storage.MetaUpdate{Role: data.CanonicalRootRole, Version: 0, Data: meta[data.CanonicalRootRole]}))
+	require.NoError(t, store.UpdateCurrent("gun",
+		storage.MetaUpdate{Role: data.CanonicalSnapshotRole, Version: 0, Data: meta[data.CanonicalSnapshotRole]}))
+	require.NoError(t, store.UpdateCurrent("gun",
+		storage.MetaUpdate{Role: data.CanonicalTimestampRole, Version: 1, Data: timestampJSON}))
+	return store, crypto
+}
+
+// A newly generated timestamp expires after the expiry set for its GUN, or the
+// default for timestamps if none is set
+func TestGetTimestampHonorsGUNExpiry(t *testing.T) {
+	for _, expiry := range []time.Duration{0, 2 * time.Hour} {
+		store, crypto := setupExpiredTimestamp(t)
+		require.NoError(t, store.SetExpiry("gun", data.CanonicalTimestampRole, expiry))
+		// the expiry of other GUNs and roles is ignored
+		require.NoError(t, store.SetExpiry("gun", data.CanonicalSnapshotRole, 5*time.Hour))
+		require.NoError(t, store.SetExpiry("other", data.CanonicalTimestampRole, 5*time.Hour))
+
+		_, gottenTimestamp, err := GetOrCreateTimestamp("gun", store, crypto, nil)
+		require.NoError(t, err)
+		signedMeta := &data.SignedMeta{}
+		require.NoError(t, json.Unmarshal(gottenTimestamp, signedMeta))
+
+		expected := data.DefaultExpires(data.CanonicalTimestampRole)
+		if expiry != 0 {
+			expected = time.Now().Add(expiry)
+		}
+		require.WithinDuration(t, expected, signedMeta.Signed.Expires, time.Minute)
+	}
+}
+
+// A newly generated timestamp carries a verifiable token from the timestamping
+// authority for its snapshot
+func TestGetTimestampWithAuthority(t *testing.T) {
+	store, crypto := setupExpiredTimestamp(t)
+
+	fake, err := tsatestutils.NewFakeTSA()
+	require.NoError(t, err)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	authority := &Authority{Client: &tsa.Client{URL: server.URL}, Required: true}
+	_, gottenTimestamp, err := GetOrCreateTimestamp("gun", store, crypto, authority)
+	require.NoError(t, err)
+
+	ts := &data.SignedTimestamp{}
+	require.NoError(t, json.Unmarshal(gottenTimestamp, ts))
+	snapshotMeta := ts.Signed.Meta[data.CanonicalSnapshotRole.String()]
+	token, err := tsa.TokenFromCustom(snapshotMeta.Custom)
+	require.NoError(t, err)
+
+	_, err = tsa.Verify(token, snapshotMeta.Hashes[notary.SHA256], fake.Roots())
+	require.NoError(t, err)
+}
+
+// If the timestamping authority is unreachable, timestamp generation fails only
+// if a token is required
+func TestGetTimestampWithUnreachableAuthority(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := &tsa.Client{URL: server.URL}
+
+	store, crypto := setupExpiredTimestamp(t)
+	_, _, err := GetOrCreateTimestamp("gun", store, crypto, &Authority{Client: client, Required: true})
+	require.Error(t, err)
+
+	_, gottenTimestamp, err := GetOrCreateTimestamp("gun", store, crypto, &Authority{Client: client})
+	require.NoError(t, err)
+
+	ts := &data.SignedTimestamp{}
+	require.NoError(t, json.Unmarshal(gottenTimestamp, ts))
+	require.True(t, ts.Signed.Expires.After(time.Now()))
+	require.Nil(t, ts.Signed.Meta[data.CanonicalSnapshotRole.String()].Custom)
+}
+
 // If the root or snapshot is missing or corrupt, no timestamp can be generated
 func TestCannotMakeNewTimestampIfNoRootOrSnapshot(t *testing.T) {
 	repo, crypto, err := testutils.EmptyRepo("gun")
@@ -193,7 +289,7 @@ func TestCannotMakeNewTimestampIfNoRootOrSnapshot(t *testing.T) {
 		require.NoError(t, store.UpdateCurrent("gun",
 			storage.MetaUpdate{Role: data.CanonicalTimestampRole, Version: 1, Data: timestampJSON}))
 
-		_, _, err := GetOrCreateTimestamp("gun", store, crypto)
+		_, _, err := GetOrCreateTimestamp("gun", store, crypto, nil)
 		require.Error(t, err, "GetTimestamp errored")
 		require.IsType(t, test.err, err)
 	}
@@ -223,7 +319,7 @@ func TestCreateTimestampNoKeyInCrypto(t *testing.T) {
 		storage.MetaUpdate{Role: data.CanonicalTimestampRole, Version: 1, Data: timestampJSON}))
 
 	// pass it a new cryptoservice without the key
-	_, _, err = GetOrCreateTimestamp("gun", store, signed.NewEd25519())
+	_, _, err = GetOrCreateTimestamp("gun", store, signed.NewEd25519(), nil)
 	require.Error(t, err)
 	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
 }
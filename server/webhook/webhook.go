@@ -0,0 +1,224 @@
+// Package webhook notifies configured HTTP endpoints when the metadata of a
+// GUN changes on the server, so that they needn't poll the changefeed.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/utils"
+)
+
+const (
+	// ActionUpdate is the action of an event for new metadata being published
+	ActionUpdate = "update"
+	// ActionDeletion is the action of an event for all the metadata of a GUN
+	// being deleted
+	ActionDeletion = "deletion"
+
+	// SignatureHeader holds the HMAC-SHA256 of the payload, keyed by the secret
+	// of the hook, as "sha256=<hex digest>"
+	SignatureHeader = "X-Notary-Signature"
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	defaultTimeout     = 10 * time.Second
+	// deliveryLogSize bounds the number of deliveries kept in the log
+	deliveryLogSize = 100
+)
+
+// Hook is an endpoint which is sent a POST request for every change to the
+// metadata of the GUNs it is interested in
+type Hook struct {
+	URL string
+	// GUNs are the GUNs the hook is interested in, each either an exact GUN
+	// or a prefix followed by "*".  No GUNs means every GUN.
+	GUNs []string
+	// Secret, if set, signs the payload sent to the hook
+	Secret string
+}
+
+func (h Hook) matches(gun data.GUN) bool {
+	if len(h.GUNs) == 0 {
+		return true
+	}
+	return utils.MatchGUNPattern(gun.String(), h.GUNs)
+}
+
+// RoleUpdate describes the new version of a role in an update
+type RoleUpdate struct {
+	Role    data.RoleName `json:"role"`
+	Version int           `json:"version"`
+	SHA256  string        `json:"sha256"`
+}
+
+// Event is the JSON payload sent to a hook
+type Event struct {
+	GUN       data.GUN     `json:"gun"`
+	Action    string       `json:"action"`
+	Roles     []RoleUpdate `json:"roles,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Delivery records the outcome of sending an event to a hook
+type Delivery struct {
+	URL      string
+	GUN      data.GUN
+	Action   string
+	Attempts int
+	// StatusCode is that of the last response, or 0 if there was none
+	StatusCode int
+	// Err is why the delivery failed, or empty if it succeeded
+	Err  string
+	Time time.Time
+}
+
+// Notifier sends events to hooks in the background, retrying failed
+// deliveries with an exponential backoff
+type Notifier struct {
+	hooks       []Hook
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+// NewNotifier returns a Notifier for the given hooks.  Each delivery is tried
+// up to maxAttempts times, waiting backoff after the first failure and twice
+// as long after each further one.  Values which aren't positive take the
+// defaults of 5 attempts and a second.
+func NewNotifier(hooks []Hook, maxAttempts int, backoff time.Duration) *Notifier {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	return &Notifier{
+		hooks:       hooks,
+		client:      &http.Client{Timeout: defaultTimeout},
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+}
+
+// Notify sends the event to every hook interested in its GUN, without waiting
+// for the deliveries to finish.  It is safe to call on a nil Notifier, which
+// does nothing.
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logrus.Errorf("unable to serialize webhook event for %s: %v", event.GUN, err)
+		return
+	}
+	for _, hook := range n.hooks {
+		if !hook.matches(event.GUN) {
+			continue
+		}
+		n.wg.Add(1)
+		go func(hook Hook) {
+			defer n.wg.Done()
+			n.record(n.deliver(hook, event, payload))
+		}(hook)
+	}
+}
+
+// Wait blocks until every delivery which has been started has either
+// succeeded or run out of attempts
+func (n *Notifier) Wait() {
+	if n != nil {
+		n.wg.Wait()
+	}
+}
+
+// Deliveries returns the most recent deliveries, oldest first
+func (n *Notifier) Deliveries() []Delivery {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Delivery(nil), n.deliveries...)
+}
+
+func (n *Notifier) record(delivery Delivery) {
+	if delivery.Err == "" {
+		logrus.Infof("delivered webhook %s for %s to %s after %d attempt(s)",
+			delivery.Action, delivery.GUN, delivery.URL, delivery.Attempts)
+	} else {
+		logrus.Warnf("unable to deliver webhook %s for %s to %s after %d attempt(s): %s",
+			delivery.Action, delivery.GUN, delivery.URL, delivery.Attempts, delivery.Err)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries = append(n.deliveries, delivery)
+	if len(n.deliveries) > deliveryLogSize {
+		n.deliveries = n.deliveries[len(n.deliveries)-deliveryLogSize:]
+	}
+}
+
+func (n *Notifier) deliver(hook Hook, event Event, payload []byte) Delivery {
+	delivery := Delivery{URL: hook.URL, GUN: event.GUN, Action: event.Action}
+	wait := n.backoff
+	for {
+		delivery.Attempts++
+		status, err := post(n.client, hook, payload)
+		delivery.StatusCode = status
+		delivery.Time = time.Now()
+		if err == nil {
+			delivery.Err = ""
+			return delivery
+		}
+		delivery.Err = err.Error()
+		if delivery.Attempts >= n.maxAttempts {
+			return delivery
+		}
+		logrus.Debugf("retrying webhook %s for %s to %s in %s: %v", event.Action, event.GUN, hook.URL, wait, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func post(client *http.Client, hook Hook, payload []byte) (int, error) {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, payload))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the value of the SignatureHeader for a payload sent to a hook
+// with the given secret, so that receivers can check the payload came from
+// the server
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
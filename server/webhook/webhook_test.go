@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// fakeReceiver records the requests it is sent, and fails the first few of them
+type fakeReceiver struct {
+	mu       sync.Mutex
+	failures int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (f *fakeReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bodies = append(f.bodies, body)
+	f.headers = append(f.headers, r.Header)
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (f *fakeReceiver) received() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.bodies)
+}
+
+func TestHookMatches(t *testing.T) {
+	hook := Hook{GUNs: []string{"docker.io/library/*", "example.com/app"}}
+	for gun, matches := range map[data.GUN]bool{
+		"docker.io/library/alpine": true,
+		"docker.io/other/alpine":   false,
+		"example.com/app":          true,
+		"example.com/app2":         false,
+	} {
+		require.Equal(t, matches, hook.matches(gun), gun.String())
+	}
+	require.True(t, Hook{}.matches("anything"))
+}
+
+// Events are delivered, signed with the secret of the hook, only to the hooks
+// interested in the GUN
+func TestNotifyDelivers(t *testing.T) {
+	interested, uninterested := &fakeReceiver{}, &fakeReceiver{}
+	interestedServer := httptest.NewServer(interested)
+	defer interestedServer.Close()
+	uninterestedServer := httptest.NewServer(uninterested)
+	defer uninterestedServer.Close()
+
+	n := NewNotifier([]Hook{
+		{URL: interestedServer.URL, GUNs: []string{"docker.io/*"}, Secret: "s3cr3t"},
+		{URL: uninterestedServer.URL, GUNs: []string{"example.com/app"}},
+	}, 1, time.Millisecond)
+
+	event := Event{
+		GUN:       "docker.io/library/alpine",
+		Action:    ActionUpdate,
+		Roles:     []RoleUpdate{{Role: data.CanonicalTimestampRole, Version: 2, SHA256: "abcd"}},
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	n.Notify(event)
+	n.Wait()
+
+	require.Equal(t, 0, uninterested.received())
+	require.Equal(t, 1, interested.received())
+	var received Event
+	require.NoError(t, json.Unmarshal(interested.bodies[0], &received))
+	require.Equal(t, event, received)
+	require.Equal(t, "application/json", interested.headers[0].Get("Content-Type"))
+	require.Equal(t, Sign("s3cr3t", interested.bodies[0]), interested.headers[0].Get(SignatureHeader))
+	require.NotEqual(t, Sign("wrong", interested.bodies[0]), interested.headers[0].Get(SignatureHeader))
+
+	deliveries := n.Deliveries()
+	require.Len(t, deliveries, 1)
+	require.Equal(t, interestedServer.URL, deliveries[0].URL)
+	require.Equal(t, event.GUN, deliveries[0].GUN)
+	require.Equal(t, 1, deliveries[0].Attempts)
+	require.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+	require.Empty(t, deliveries[0].Err)
+}
+
+// Failed deliveries are retried until they succeed or run out of attempts
+func TestNotifyRetries(t *testing.T) {
+	flaky := &fakeReceiver{failures: 2}
+	flakyServer := httptest.NewServer(flaky)
+	defer flakyServer.Close()
+	down := &fakeReceiver{failures: 10}
+	downServer := httptest.NewServer(down)
+	defer downServer.Close()
+
+	n := NewNotifier([]Hook{{URL: flakyServer.URL}, {URL: downServer.URL}}, 3, time.Millisecond)
+	n.Notify(Event{GUN: "docker.io/library/alpine", Action: ActionDeletion})
+	n.Wait()
+
+	require.Equal(t, 3, flaky.received())
+	require.Equal(t, 3, down.received())
+
+	deliveries := make(map[string]Delivery)
+	for _, delivery := range n.Deliveries() {
+		deliveries[delivery.URL] = delivery
+	}
+	require.Len(t, deliveries, 2)
+	require.Equal(t, 3, deliveries[flakyServer.URL].Attempts)
+	require.Empty(t, deliveries[flakyServer.URL].Err)
+	require.Equal(t, 3, deliveries[downServer.URL].Attempts)
+	require.Equal(t, http.StatusInternalServerError, deliveries[downServer.URL].StatusCode)
+	require.NotEmpty(t, deliveries[downServer.URL].Err)
+}
+
+// The delivery log only keeps the most recent deliveries
+func TestDeliveryLogIsBounded(t *testing.T) {
+	receiver := &fakeReceiver{}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+
+	n := NewNotifier([]Hook{{URL: ts.URL}}, 1, time.Millisecond)
+	for i := 0; i < deliveryLogSize+10; i++ {
+		n.Notify(Event{GUN: "docker.io/library/alpine", Action: ActionUpdate})
+	}
+	n.Wait()
+	require.Equal(t, deliveryLogSize+10, receiver.received())
+	require.Len(t, n.Deliveries(), deliveryLogSize)
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	n.Notify(Event{GUN: "docker.io/library/alpine", Action: ActionUpdate})
+	n.Wait()
+	require.Empty(t, n.Deliveries())
+}
@@ -7,6 +7,7 @@ import (
 
 	ctxu "github.com/docker/distribution/context"
 	"github.com/theupdateframework/notary/signer"
+	"github.com/theupdateframework/notary/tracing"
 	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/tuf/data"
 	"golang.org/x/net/context"
@@ -95,7 +96,13 @@ func (s *KeyManagementServer) GetKeyInfo(ctx context.Context, keyID *pb.KeyID) (
 }
 
 //Sign signs a message and returns the signature using a private key associate with the KeyID from the SignatureRequest
-func (s *SignerServer) Sign(ctx context.Context, sr *pb.SignatureRequest) (*pb.Signature, error) {
+func (s *SignerServer) Sign(ctx context.Context, sr *pb.SignatureRequest) (_ *pb.Signature, err error) {
+	_, span := tracing.Start(tracing.ExtractGRPC(ctx), "notary.signer.sign")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	privKey, _, err := findKeyByID(s.CryptoServices, sr.KeyID)
 
 	logger := ctxu.GetLogger(ctx)
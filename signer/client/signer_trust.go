@@ -14,6 +14,7 @@ import (
 
 	"github.com/theupdateframework/notary"
 	pb "github.com/theupdateframework/notary/proto"
+	"github.com/theupdateframework/notary/tracing"
 	"github.com/theupdateframework/notary/tuf/data"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -61,13 +62,20 @@ func (pk *RemotePrivateKey) Private() []byte {
 // Sign calls a remote service to sign a message.
 func (pk *RemotePrivateKey) Sign(rand io.Reader, msg []byte,
 	opts crypto.SignerOpts) ([]byte, error) {
+	return pk.SignContext(context.Background(), rand, msg, opts)
+}
+
+// SignContext is Sign, propagating the trace of the span held by the context
+// to the signer
+func (pk *RemotePrivateKey) SignContext(ctx context.Context, rand io.Reader, msg []byte,
+	opts crypto.SignerOpts) ([]byte, error) {
 
 	keyID := pb.KeyID{ID: pk.ID()}
 	sr := &pb.SignatureRequest{
 		Content: msg,
 		KeyID:   &keyID,
 	}
-	sig, err := pk.sClient.Sign(context.Background(), sr)
+	sig, err := pk.sClient.Sign(tracing.InjectGRPC(ctx), sr)
 	if err != nil {
 		return nil, err
 	}
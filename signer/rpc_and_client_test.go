@@ -17,6 +17,7 @@ import (
 	"github.com/theupdateframework/notary/signer"
 	"github.com/theupdateframework/notary/signer/api"
 	"github.com/theupdateframework/notary/signer/client"
+	"github.com/theupdateframework/notary/tracing"
 	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
@@ -279,6 +280,40 @@ func TestGetPrivateKeyAndSignWithExistingKey(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// Signing with a remote key propagates the trace of the span in the context
+// to the signer, whose signing is its child
+func TestSignPropagatesTrace(t *testing.T) {
+	key, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err, "could not generate key")
+
+	memStore := trustmanager.NewKeyMemoryStore(constPass)
+	err = memStore.AddKey(trustmanager.KeyInfo{Role: data.CanonicalTimestampRole, Gun: "gun"}, key)
+	require.NoError(t, err, "could not add key to store")
+
+	signerClient, _, cleanup := setUpSignerClient(t, setUpSignerServer(t, memStore))
+	defer cleanup()
+
+	recorder := tracing.NewRecorder()
+	tracing.SetTracer(recorder)
+	defer tracing.SetTracer(nil)
+
+	privKey, _, err := signerClient.GetPrivateKey(key.ID())
+	require.NoError(t, err)
+	remoteKey, ok := privKey.(tracing.ContextSigner)
+	require.True(t, ok)
+
+	ctx, span := tracing.Start(context.Background(), "server")
+	_, err = remoteKey.SignContext(ctx, rand.Reader, []byte("message!"), nil)
+	require.NoError(t, err)
+	span.End()
+
+	spans := recorder.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "notary.signer.sign", spans[0].Name)
+	require.Equal(t, span.SpanContext(), spans[0].Parent)
+	require.NoError(t, spans[0].Err)
+}
+
 func TestCannotSignWithKeyThatDoesntExist(t *testing.T) {
 	memStore := trustmanager.NewKeyMemoryStore(constPass)
 
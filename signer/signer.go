@@ -42,6 +42,7 @@ type Signer interface {
 type Config struct {
 	GRPCAddr       string
 	TLSConfig      *tls.Config
+	StopTLSReload  func()
 	CryptoServices CryptoServiceIndex
 	PendingKeyFunc func(trustmanager.KeyInfo) (data.PublicKey, error)
 }
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/theupdateframework/notary"
+)
+
+// gzipMagic begins every gzip stream, and can't begin JSON metadata
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// CompressedStore wraps a MetadataStore, such as the FilesystemStore caching
+// metadata on disk, gzip-compressing metadata before it is stored when
+// compression is turned on, trading CPU for space.  Metadata is transparently
+// decompressed when it is read whether or not compression is on, so that
+// metadata stored before compression was turned on or off can still be read.
+type CompressedStore struct {
+	MetadataStore
+
+	mu       sync.RWMutex
+	compress bool
+}
+
+// NewCompressedStore returns a CompressedStore wrapping the given store
+func NewCompressedStore(store MetadataStore, compress bool) *CompressedStore {
+	return &CompressedStore{
+		MetadataStore: store,
+		compress:      compress,
+	}
+}
+
+// SetCompression sets whether metadata is compressed when it is stored
+func (c *CompressedStore) SetCompression(compress bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compress = compress
+}
+
+func (c *CompressedStore) compressing() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.compress
+}
+
+// GetSized returns the decompressed meta for the given name, up to size bytes
+// of it.  If size is "NoSizeLimit", we cut off at a predefined threshold
+// "notary.MaxDownloadSize".  If the decompressed meta is larger than size we
+// return ErrMaliciousServer for consistency with the FilesystemStore.
+func (c *CompressedStore) GetSized(name string, size int64) ([]byte, error) {
+	if size == NoSizeLimit {
+		size = notary.MaxDownloadSize
+	}
+	// the size of compressed meta says nothing about the size of the meta, so
+	// the limit is only applied once it has been decompressed
+	blob, err := c.MetadataStore.GetSized(name, NoSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(blob, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
+		}
+		if blob, err = ioutil.ReadAll(io.LimitReader(zr, size+1)); err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(blob)) > size {
+		return nil, ErrMaliciousServer{}
+	}
+	return blob, nil
+}
+
+// Set compresses the meta for a single role, if compression is on, and stores it
+func (c *CompressedStore) Set(name string, blob []byte) error {
+	blob, err := c.maybeCompress(blob)
+	if err != nil {
+		return err
+	}
+	return c.MetadataStore.Set(name, blob)
+}
+
+// SetMulti compresses the metadata for multiple roles, if compression is on,
+// and stores them in one operation
+func (c *CompressedStore) SetMulti(metas map[string][]byte) error {
+	compressed := make(map[string][]byte, len(metas))
+	for role, blob := range metas {
+		blob, err := c.maybeCompress(blob)
+		if err != nil {
+			return err
+		}
+		compressed[role] = blob
+	}
+	return c.MetadataStore.SetMulti(compressed)
+}
+
+func (c *CompressedStore) maybeCompress(blob []byte) ([]byte, error) {
+	if !c.compressing() {
+		return blob, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(blob); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newCompressedFileStore(t *testing.T, compress bool) (*CompressedStore, string) {
+	testDir, err := ioutil.TempDir("", "testdir")
+	require.NoError(t, err)
+	s, err := NewFileStore(filepath.Join(testDir, "metadata"), "json")
+	require.NoError(t, err)
+	return NewCompressedStore(s, compress), testDir
+}
+
+// Metadata is stored compressed, and read back identical to what was stored
+func TestCompressedStoreSetAndGet(t *testing.T) {
+	s, testDir := newCompressedFileStore(t, true)
+	defer os.RemoveAll(testDir)
+
+	metas := map[string][]byte{
+		"root":    bytes.Repeat([]byte(`{"signed":{"_type":"Root"}}`), 100),
+		"targets": bytes.Repeat([]byte(`{"signed":{"_type":"Targets"}}`), 100),
+		"a/b":     []byte(`{}`),
+	}
+	require.NoError(t, s.Set("root", metas["root"]))
+	require.NoError(t, s.SetMulti(map[string][]byte{"targets": metas["targets"], "a/b": metas["a/b"]}))
+
+	for name, meta := range metas {
+		onDisk, err := ioutil.ReadFile(filepath.Join(testDir, "metadata", name+".json"))
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(onDisk, gzipMagic), "%s was not compressed", name)
+		if len(meta) > 1000 {
+			require.True(t, len(onDisk) < len(meta), "%s was not made smaller", name)
+		}
+
+		read, err := s.GetSized(name, NoSizeLimit)
+		require.NoError(t, err)
+		require.Equal(t, meta, read)
+
+		// the size limit applies to the decompressed metadata
+		read, err = s.GetSized(name, int64(len(meta)))
+		require.NoError(t, err)
+		require.Equal(t, meta, read)
+		_, err = s.GetSized(name, int64(len(meta)-1))
+		require.IsType(t, ErrMaliciousServer{}, err)
+	}
+
+	_, err := s.GetSized("missing", NoSizeLimit)
+	require.IsType(t, ErrMetaNotFound{}, err)
+}
+
+// Metadata stored before compression was turned on or off can still be read
+func TestCompressedStoreReadsEitherWay(t *testing.T) {
+	s, testDir := newCompressedFileStore(t, false)
+	defer os.RemoveAll(testDir)
+
+	plain := []byte(`{"signed":{"_type":"Root"}}`)
+	require.NoError(t, s.Set("plain", plain))
+	onDisk, err := ioutil.ReadFile(filepath.Join(testDir, "metadata", "plain.json"))
+	require.NoError(t, err)
+	require.Equal(t, plain, onDisk)
+
+	s.SetCompression(true)
+	compressed := []byte(`{"signed":{"_type":"Targets"}}`)
+	require.NoError(t, s.Set("compressed", compressed))
+
+	for _, compress := range []bool{true, false} {
+		s.SetCompression(compress)
+		read, err := s.GetSized("plain", NoSizeLimit)
+		require.NoError(t, err)
+		require.Equal(t, plain, read)
+		read, err = s.GetSized("compressed", NoSizeLimit)
+		require.NoError(t, err)
+		require.Equal(t, compressed, read)
+	}
+
+	_, err = s.GetSized("plain", int64(len(plain)-1))
+	require.IsType(t, ErrMaliciousServer{}, err)
+}
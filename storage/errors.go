@@ -3,6 +3,8 @@ package storage
 import (
 	"errors"
 	"fmt"
+
+	"github.com/theupdateframework/notary/tuf/data"
 )
 
 var (
@@ -15,6 +17,12 @@ var (
 // of metadata in the store
 type ErrMetaNotFound struct {
 	Resource string
+	// Nonce is the nonce which the request for the resource asked the server
+	// to echo in a signed statement that the GUN does not exist
+	Nonce string
+	// NotFound is the signed statement that the GUN does not exist which the
+	// server responded with, if any.  Its signatures have not been verified.
+	NotFound *data.Signed
 }
 
 func (err ErrMetaNotFound) Error() string {
@@ -12,6 +12,9 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,9 +24,12 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tracing"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/validation"
 )
@@ -33,12 +39,19 @@ const (
 	MaxErrorResponseSize int64 = 1 << 10
 	// MaxKeySize is the maximum size for a stored TUF key - 256KiB
 	MaxKeySize = 256 << 10
+
+	// maxNotFoundResponseSize is the maximum size for a 404 response carrying
+	// a signed statement that the GUN does not exist - 4KiB
+	maxNotFoundResponseSize = 4 << 10
 )
 
 // ErrServerUnavailable indicates an error from the server. code allows us to
 // populate the http error we received
 type ErrServerUnavailable struct {
 	code int
+	// unauthorized is set if the status is interpreted as the operation not
+	// being authorized, even if it isn't 401
+	unauthorized bool
 }
 
 // NetworkError represents any kind of network error when attempting to make a request
@@ -66,8 +79,8 @@ func (n NetworkError) Error() string {
 }
 
 func (err ErrServerUnavailable) Error() string {
-	if err.code == 401 {
-		return "you are not authorized to perform this operation: server returned 401."
+	if err.code == 401 || err.unauthorized {
+		return fmt.Sprintf("you are not authorized to perform this operation: server returned %d.", err.code)
 	}
 	return fmt.Sprintf("unable to reach trust server at this time: %d.", err.code)
 }
@@ -109,6 +122,39 @@ type HTTPStore struct {
 	metaExtension string
 	keyExtension  string
 	roundTrip     http.RoundTripper
+	clock         *serverClock
+	statusMapping StatusMapping
+}
+
+// serverClock records the time on the remote server's clock, going by the
+// Date header of the server's most recent response
+type serverClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	known bool
+}
+
+func (c *serverClock) record(resp *http.Response) {
+	if c == nil {
+		return
+	}
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = serverTime
+	c.known = true
+}
+
+func (c *serverClock) get() (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now, c.known
 }
 
 // NewNotaryServerStore returns a new HTTPStore against a URL which should represent a notary
@@ -143,6 +189,7 @@ func NewHTTPStore(baseURL, metaPrefix, metaExtension, keyExtension string, round
 		metaExtension: metaExtension,
 		keyExtension:  keyExtension,
 		roundTrip:     roundTrip,
+		clock:         &serverClock{},
 	}, nil
 }
 
@@ -170,17 +217,55 @@ func tryUnmarshalError(resp *http.Response, defaultError error) error {
 	return err
 }
 
-func translateStatusToError(resp *http.Response, resource string) error {
-	switch resp.StatusCode {
-	case http.StatusOK:
+// newNotFoundNonce returns a random nonce for the server to echo in a signed
+// statement that the GUN does not exist
+func newNotFoundNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// tryUnmarshalNotFound returns the signed statement that the GUN does not
+// exist in the detail of a 404 response, or nil if there isn't one
+func tryUnmarshalNotFound(resp *http.Response) *data.Signed {
+	bodyBytes, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxNotFoundResponseSize))
+	if err != nil {
+		return nil
+	}
+	var parsedErrors struct {
+		Errors []struct {
+			Detail *data.Signed `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(bodyBytes, &parsedErrors); err != nil || len(parsedErrors.Errors) != 1 {
+		return nil
+	}
+	notFound := parsedErrors.Errors[0].Detail
+	if notFound == nil || notFound.Signed == nil {
 		return nil
-	case http.StatusNotFound:
-		return ErrMetaNotFound{Resource: resource}
-	case http.StatusBadRequest:
-		return tryUnmarshalError(resp, ErrInvalidOperation{})
-	default:
-		return ErrServerUnavailable{code: resp.StatusCode}
 	}
+	return notFound
+}
+
+func translateStatusToError(resp *http.Response, resource string) error {
+	return translateStatus(resp, resource, DefaultStatusMapping)
+}
+
+// SetStatusMapping sets how the HTTP statuses returned by the server are
+// interpreted, for statuses other than those in DefaultStatusMapping or to
+// override it
+func (s *HTTPStore) SetStatusMapping(mapping StatusMapping) error {
+	if err := mapping.Validate(); err != nil {
+		return err
+	}
+	s.statusMapping = mapping
+	return nil
+}
+
+func (s HTTPStore) translateStatusToError(resp *http.Response, resource string) error {
+	return translateStatus(resp, resource, s.statusMapping)
 }
 
 // GetSized downloads the named meta file with the given size. A short body
@@ -197,13 +282,28 @@ func (s HTTPStore) GetSized(name string, size int64) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	// a GUN without a root does not exist, which the server may prove with
+	// a signed statement echoing this nonce
+	var nonce string
+	if name == data.CanonicalRootRole.String() {
+		if nonce, err = newNotFoundNonce(); err != nil {
+			return nil, err
+		}
+		req.Header.Set(notary.NotFoundNonceHeader, nonce)
+	}
 	resp, err := s.roundTrip.RoundTrip(req)
 	if err != nil {
 		return nil, NetworkError{Wrapped: err}
 	}
 	defer resp.Body.Close()
-	if err := translateStatusToError(resp, name); err != nil {
+	s.clock.record(resp)
+	if err := s.translateStatusToError(resp, name); err != nil {
 		logrus.Debugf("received HTTP status %d when requesting %s.", resp.StatusCode, name)
+		if notFound, ok := err.(ErrMetaNotFound); ok && nonce != "" {
+			notFound.Nonce = nonce
+			notFound.NotFound = tryUnmarshalNotFound(resp)
+			return nil, notFound
+		}
 		return nil, err
 	}
 	if size == NoSizeLimit {
@@ -221,6 +321,13 @@ func (s HTTPStore) GetSized(name string, size int64) ([]byte, error) {
 	return body, nil
 }
 
+// ServerTime returns the time on the server's clock, going by the Date header
+// of the last metadata downloaded, or false if no metadata has been downloaded
+// yet
+func (s HTTPStore) ServerTime() (time.Time, bool) {
+	return s.clock.get()
+}
+
 // Set sends a single piece of metadata to the TUF server
 func (s HTTPStore) Set(name string, blob []byte) error {
 	return s.SetMulti(map[string][]byte{name: blob})
@@ -263,6 +370,12 @@ func NewMultiPartMetaRequest(url string, metas map[string][]byte) (*http.Request
 // This should be preferred for updating a remote server as it enable the server
 // to remain consistent, either accepting or rejecting the complete update.
 func (s HTTPStore) SetMulti(metas map[string][]byte) error {
+	return s.SetMultiContext(context.Background(), metas)
+}
+
+// SetMultiContext is SetMulti, with the trace of the span held by the context,
+// if any, propagated to the server
+func (s HTTPStore) SetMultiContext(ctx context.Context, metas map[string][]byte) error {
 	url, err := s.buildMetaURL("")
 	if err != nil {
 		return err
@@ -271,13 +384,14 @@ func (s HTTPStore) SetMulti(metas map[string][]byte) error {
 	if err != nil {
 		return err
 	}
+	tracing.InjectHTTP(ctx, req.Header)
 	resp, err := s.roundTrip.RoundTrip(req)
 	if err != nil {
 		return NetworkError{Wrapped: err}
 	}
 	defer resp.Body.Close()
 	// if this 404's something is pretty wrong
-	return translateStatusToError(resp, "POST metadata endpoint")
+	return s.translateStatusToError(resp, "POST metadata endpoint")
 }
 
 // RemoveAll will attempt to delete all TUF metadata for a GUN
@@ -295,7 +409,7 @@ func (s HTTPStore) RemoveAll() error {
 		return NetworkError{Wrapped: err}
 	}
 	defer resp.Body.Close()
-	return translateStatusToError(resp, "DELETE metadata for GUN endpoint")
+	return s.translateStatusToError(resp, "DELETE metadata for GUN endpoint")
 }
 
 func (s HTTPStore) buildMetaURL(name string) (*url.URL, error) {
@@ -323,11 +437,21 @@ func (s HTTPStore) buildURL(uri string) (*url.URL, error) {
 
 // GetKey retrieves a public key from the remote server
 func (s HTTPStore) GetKey(role data.RoleName) ([]byte, error) {
-	url, err := s.buildKeyURL(role)
+	return s.GetKeyWithAlgorithm(role, "")
+}
+
+// GetKeyWithAlgorithm retrieves a public key from the remote server, asking
+// for it to be generated with the given algorithm if the server has no key
+// for the role yet.  An empty algorithm leaves the choice to the server.
+func (s HTTPStore) GetKeyWithAlgorithm(role data.RoleName, algorithm string) ([]byte, error) {
+	keyURL, err := s.buildKeyURL(role)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("GET", url.String(), nil)
+	if algorithm != "" {
+		keyURL.RawQuery = url.Values{"algorithm": {algorithm}}.Encode()
+	}
+	req, err := http.NewRequest("GET", keyURL.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -336,7 +460,7 @@ func (s HTTPStore) GetKey(role data.RoleName) ([]byte, error) {
 		return nil, NetworkError{Wrapped: err}
 	}
 	defer resp.Body.Close()
-	if err := translateStatusToError(resp, role.String()+" key"); err != nil {
+	if err := s.translateStatusToError(resp, role.String()+" key"); err != nil {
 		return nil, err
 	}
 	b := io.LimitReader(resp.Body, MaxKeySize)
@@ -362,7 +486,7 @@ func (s HTTPStore) RotateKey(role data.RoleName) ([]byte, error) {
 		return nil, NetworkError{Wrapped: err}
 	}
 	defer resp.Body.Close()
-	if err := translateStatusToError(resp, role.String()+" key"); err != nil {
+	if err := s.translateStatusToError(resp, role.String()+" key"); err != nil {
 		return nil, err
 	}
 	b := io.LimitReader(resp.Body, MaxKeySize)
@@ -11,9 +11,11 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/go/canonical/json"
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/validation"
 )
@@ -179,6 +181,45 @@ func Test404Error(t *testing.T) {
 	testErrorCode(t, http.StatusNotFound, ErrMetaNotFound{})
 }
 
+// A 404 for the root records the nonce sent with the request, and any signed
+// statement that the GUN does not exist
+func Test404ErrorSignedNotFound(t *testing.T) {
+	var body string
+	var nonces []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, r.Header.Get(notary.NotFoundNonceHeader))
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(body))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "key", &http.Transport{})
+	require.NoError(t, err)
+
+	body = `{"errors":[{"code":"METADATA_NOT_FOUND","detail":{"signed":{"_type":"NotFound","gun":"gun"},"signatures":[{"keyid":"abc","method":"ecdsa","sig":"c2ln"}]}}]}`
+	_, err = store.GetSized(data.CanonicalRootRole.String(), NoSizeLimit)
+	notFound, ok := err.(ErrMetaNotFound)
+	require.True(t, ok)
+	require.Len(t, nonces, 1)
+	require.NotEmpty(t, nonces[0])
+	require.Equal(t, nonces[0], notFound.Nonce)
+	require.NotNil(t, notFound.NotFound)
+	require.Equal(t, `{"_type":"NotFound","gun":"gun"}`, string(*notFound.NotFound.Signed))
+	require.Equal(t, "abc", notFound.NotFound.Signatures[0].KeyID)
+
+	// each request has its own nonce
+	body = `{"errors":[{"code":"METADATA_NOT_FOUND","detail":{}}]}`
+	_, err = store.GetSized(data.CanonicalRootRole.String(), NoSizeLimit)
+	notFound = err.(ErrMetaNotFound)
+	require.Nil(t, notFound.NotFound)
+	require.NotEqual(t, nonces[0], nonces[1])
+
+	// no nonce is sent for other roles
+	_, err = store.GetSized(data.CanonicalTargetsRole.String(), NoSizeLimit)
+	require.Equal(t, ErrMetaNotFound{Resource: data.CanonicalTargetsRole.String()}, err)
+	require.Empty(t, nonces[2])
+}
+
 func Test50XErrors(t *testing.T) {
 	fiveHundreds := []int{
 		http.StatusInternalServerError,
@@ -348,6 +389,68 @@ func TestHTTPStoreGetKey(t *testing.T) {
 	require.Equal(t, "FAIL", err.Error())
 }
 
+// The requested algorithm is passed to the server as a query parameter, and
+// omitted if none is requested
+func TestHTTPStoreGetKeyWithAlgorithm(t *testing.T) {
+	var algorithms []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "GET", r.Method)
+		require.Equal(t, "/metadata/snapshot.key", r.URL.Path)
+		algorithms = append(algorithms, r.URL.RawQuery)
+		w.Write([]byte(testRootKey))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "key", http.DefaultTransport)
+	require.NoError(t, err)
+	keyStore, ok := store.(KeyAlgorithmStore)
+	require.True(t, ok)
+
+	pubKeyBytes, err := keyStore.GetKeyWithAlgorithm(data.CanonicalSnapshotRole, data.RSAKey)
+	require.NoError(t, err)
+	require.Equal(t, pubKeyBytes, []byte(testRootKey))
+	_, err = keyStore.GetKeyWithAlgorithm(data.CanonicalSnapshotRole, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"algorithm=rsa", ""}, algorithms)
+}
+
+// The server time is taken from the Date header of the last metadata download,
+// whether or not the metadata was found
+func TestHTTPStoreServerTime(t *testing.T) {
+	serverTime := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	laterTime := serverTime.Add(time.Hour)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata/missing.json" {
+			w.Header().Set("Date", laterTime.Format(http.TimeFormat))
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		w.Write([]byte(testRoot))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "key", http.DefaultTransport)
+	require.NoError(t, err)
+	reporter, ok := store.(ServerTimeReporter)
+	require.True(t, ok)
+
+	_, known := reporter.ServerTime()
+	require.False(t, known)
+
+	_, err = store.GetSized("root", NoSizeLimit)
+	require.NoError(t, err)
+	now, known := reporter.ServerTime()
+	require.True(t, known)
+	require.True(t, serverTime.Equal(now))
+
+	_, err = store.GetSized("missing", NoSizeLimit)
+	require.IsType(t, ErrMetaNotFound{}, err)
+	now, known = reporter.ServerTime()
+	require.True(t, known)
+	require.True(t, laterTime.Equal(now))
+}
+
 func TestHTTPStoreGetRotateKeySizeLimited(t *testing.T) {
 	tooLarge := make([]byte, MaxKeySize+10)
 	for i := range tooLarge {
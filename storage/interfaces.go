@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/theupdateframework/notary/tuf/data"
 )
 
@@ -24,6 +26,20 @@ type PublicKeyStore interface {
 	RotateKey(role data.RoleName) ([]byte, error)
 }
 
+// KeyAlgorithmStore is implemented by a key service which can be asked to
+// generate a key with a particular algorithm
+type KeyAlgorithmStore interface {
+	GetKeyWithAlgorithm(role data.RoleName, algorithm string) ([]byte, error)
+}
+
+// ServerTimeReporter is implemented by a remote store which can tell the time
+// on the remote server's clock, so that the local clock can be compared to it
+type ServerTimeReporter interface {
+	// ServerTime returns the time on the remote server's clock when it last
+	// responded, or false if this isn't known yet
+	ServerTime() (time.Time, bool)
+}
+
 // RemoteStore is similar to LocalStore with the added expectation that it should
 // provide a way to download targets once located
 type RemoteStore interface {
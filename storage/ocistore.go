@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+const (
+	// OCIArtifactType is the artifact type of the OCI artifacts which carry
+	// notary metadata and keys
+	OCIArtifactType = "application/vnd.notary.tuf.v1+json"
+	// OCINameAnnotation is the manifest annotation naming the metadata file or key
+	// an OCI artifact carries, e.g. "root", "2.root", "snapshot.<checksum>" or
+	// "timestamp.key"
+	OCINameAnnotation = "org.theupdateframework.notary.name"
+	// OCICreatedAnnotation is the standard manifest annotation recording when an
+	// OCI artifact was created.  If there are several artifacts with the same
+	// name, the most recently created one is used.
+	OCICreatedAnnotation = "org.opencontainers.image.created"
+	// DefaultOCISubjectTag is the tag of the manifest, in the repository named
+	// by the GUN, that the OCI artifacts carrying notary metadata refer to
+	DefaultOCISubjectTag = "_notary"
+
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	// MaxOCIManifestSize is the maximum size of an OCI manifest or referrers
+	// index - 4MiB, the limit registries are required to accept
+	MaxOCIManifestSize int64 = 4 << 20
+)
+
+// ociDescriptor describes content in an OCI registry
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// ociIndex is the response of the referrers API
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI image manifest, whose single layer is the metadata
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// OCIStore is a read-only RemoteStore which downloads notary metadata stored
+// as OCI artifacts in a registry.  The artifacts all refer, via the registry's
+// referrers API, to the manifest with the subject tag in the repository named
+// by the GUN, and are told apart by their OCINameAnnotation.  Each artifact's
+// manifest has a single layer, which is the metadata file or key.
+type OCIStore struct {
+	baseURL    url.URL
+	repository string
+	subjectTag string
+	roundTrip  http.RoundTripper
+}
+
+// NewOCIStore returns a new OCIStore for the repository in the registry at
+// registryURL.  If subjectTag is empty, DefaultOCISubjectTag is used.
+//
+// In case of a nil `roundTrip`, a default offline store is used instead.
+func NewOCIStore(registryURL, repository, subjectTag string, roundTrip http.RoundTripper) (RemoteStore, error) {
+	base, err := url.Parse(registryURL)
+	if err != nil {
+		return nil, err
+	}
+	if !base.IsAbs() {
+		return nil, errors.New("OCIStore requires an absolute registry URL")
+	}
+	if repository == "" {
+		return nil, errors.New("OCIStore requires a repository")
+	}
+	if roundTrip == nil {
+		return &OfflineStore{}, nil
+	}
+	if subjectTag == "" {
+		subjectTag = DefaultOCISubjectTag
+	}
+	return &OCIStore{
+		baseURL:    *base,
+		repository: repository,
+		subjectTag: subjectTag,
+		roundTrip:  roundTrip,
+	}, nil
+}
+
+// GetSized downloads the named meta file with the given size. A short body
+// is acceptable because in the case of timestamp.json, the size is a cap,
+// not an exact length.
+// If size is "NoSizeLimit", this corresponds to "infinite," but we cut off at a
+// predefined threshold "notary.MaxDownloadSize".
+func (s OCIStore) GetSized(name string, size int64) ([]byte, error) {
+	if size == NoSizeLimit {
+		size = notary.MaxDownloadSize
+	}
+	return s.getArtifact(name, size)
+}
+
+// GetKey retrieves a public key stored in the registry
+func (s OCIStore) GetKey(role data.RoleName) ([]byte, error) {
+	return s.getArtifact(role.String()+".key", MaxKeySize)
+}
+
+// getArtifact finds the most recent artifact with the given name which refers
+// to the subject, and downloads its content, up to size bytes
+func (s OCIStore) getArtifact(name string, size int64) ([]byte, error) {
+	subject, err := s.resolveSubject(name)
+	if err != nil {
+		return nil, err
+	}
+	artifact, err := s.findReferrer(subject, name)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestBytes, err := s.get("manifests/"+artifact.Digest, nil, ociManifestMediaType, name, MaxOCIManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyOCIDigest(artifact.Digest, manifestBytes); err != nil {
+		return nil, err
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid OCI manifest for %s: %v", name, err)
+	}
+	if len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("invalid OCI manifest for %s: expected 1 layer, found %d", name, len(manifest.Layers))
+	}
+	layer := manifest.Layers[0]
+	if layer.Size > size {
+		return nil, ErrMaliciousServer{}
+	}
+
+	blob, err := s.get("blobs/"+layer.Digest, nil, "", name, layer.Size)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyOCIDigest(layer.Digest, blob); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// resolveSubject returns the digest of the manifest with the subject tag
+func (s OCIStore) resolveSubject(name string) (string, error) {
+	req, err := s.newRequest("HEAD", "manifests/"+s.subjectTag, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Accept", ociManifestMediaType)
+	req.Header.Add("Accept", ociIndexMediaType)
+	resp, err := s.roundTrip.RoundTrip(req)
+	if err != nil {
+		return "", NetworkError{Wrapped: err}
+	}
+	defer resp.Body.Close()
+	if err := translateStatusToError(resp, name); err != nil {
+		logrus.Debugf("received HTTP status %d when resolving %s:%s.", resp.StatusCode, s.repository, s.subjectTag)
+		return "", err
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s:%s", s.repository, s.subjectTag)
+	}
+	return digest, nil
+}
+
+// findReferrer returns the most recently created notary artifact with the given
+// name which refers to the subject
+func (s OCIStore) findReferrer(subject, name string) (*ociDescriptor, error) {
+	indexBytes, err := s.get("referrers/"+subject, url.Values{"artifactType": {OCIArtifactType}},
+		ociIndexMediaType, name, MaxOCIManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	var index ociIndex
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("invalid OCI referrers response for %s: %v", name, err)
+	}
+
+	var (
+		found   *ociDescriptor
+		created time.Time
+	)
+	for i, desc := range index.Manifests {
+		// registries may ignore the artifact type filter
+		if desc.ArtifactType != OCIArtifactType || desc.Annotations[OCINameAnnotation] != name {
+			continue
+		}
+		descCreated, _ := time.Parse(time.RFC3339, desc.Annotations[OCICreatedAnnotation])
+		if found == nil || descCreated.After(created) {
+			found, created = &index.Manifests[i], descCreated
+		}
+	}
+	if found == nil {
+		return nil, ErrMetaNotFound{Resource: name}
+	}
+	return found, nil
+}
+
+// get downloads up to size bytes from the given path under the repository
+func (s OCIStore) get(uri string, query url.Values, accept, name string, size int64) ([]byte, error) {
+	req, err := s.newRequest("GET", uri, query)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := s.roundTrip.RoundTrip(req)
+	if err != nil {
+		return nil, NetworkError{Wrapped: err}
+	}
+	defer resp.Body.Close()
+	if err := translateStatusToError(resp, name); err != nil {
+		logrus.Debugf("received HTTP status %d when requesting %s.", resp.StatusCode, req.URL.Path)
+		return nil, err
+	}
+	if resp.ContentLength > size {
+		return nil, ErrMaliciousServer{}
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, size))
+}
+
+func (s OCIStore) newRequest(method, uri string, query url.Values) (*http.Request, error) {
+	sub := &url.URL{Path: path.Join("/v2", s.repository, uri), RawQuery: query.Encode()}
+	return http.NewRequest(method, s.baseURL.ResolveReference(sub).String(), nil)
+}
+
+// verifyOCIDigest checks that the content matches the sha256 digest, which is
+// the only digest algorithm supported
+func verifyOCIDigest(digest string, content []byte) error {
+	expected := strings.TrimPrefix(digest, "sha256:")
+	if expected == digest {
+		return fmt.Errorf("unsupported OCI digest %s", digest)
+	}
+	actual := sha256.Sum256(content)
+	if hex.EncodeToString(actual[:]) != expected {
+		return ErrMaliciousServer{}
+	}
+	return nil
+}
+
+// Set fails, because the OCIStore is read-only
+func (s OCIStore) Set(name string, blob []byte) error {
+	return ErrInvalidOperation{msg: "cannot publish metadata to an OCI registry"}
+}
+
+// SetMulti fails, because the OCIStore is read-only
+func (s OCIStore) SetMulti(metas map[string][]byte) error {
+	return ErrInvalidOperation{msg: "cannot publish metadata to an OCI registry"}
+}
+
+// Remove fails, because the OCIStore is read-only
+func (s OCIStore) Remove(name string) error {
+	return ErrInvalidOperation{msg: "cannot delete metadata from an OCI registry"}
+}
+
+// RemoveAll fails, because the OCIStore is read-only
+func (s OCIStore) RemoveAll() error {
+	return ErrInvalidOperation{msg: "cannot delete metadata from an OCI registry"}
+}
+
+// RotateKey fails, because registries do not manage keys
+func (s OCIStore) RotateKey(role data.RoleName) ([]byte, error) {
+	return nil, ErrInvalidOperation{msg: "cannot rotate keys in an OCI registry"}
+}
+
+// Location returns a human readable name for the storage location
+func (s OCIStore) Location() string {
+	return s.baseURL.Host
+}
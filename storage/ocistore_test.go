@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/storage/testutils"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func setUpOCIStore(t *testing.T) (*testutils.FakeOCIRegistry, string, storage.RemoteStore, func()) {
+	registry := testutils.NewFakeOCIRegistry()
+	server := httptest.NewServer(registry)
+	subject := registry.Tag("example/app", storage.DefaultOCISubjectTag)
+	s, err := storage.NewOCIStore(server.URL, "example/app", "", http.DefaultTransport)
+	require.NoError(t, err)
+	return registry, subject, s, server.Close
+}
+
+func TestOCIStoreGetSized(t *testing.T) {
+	registry, subject, s, cleanup := setUpOCIStore(t)
+	defer cleanup()
+
+	now := time.Now()
+	registry.Push("example/app", subject, "root", []byte("old root"), now.Add(-time.Hour))
+	registry.Push("example/app", subject, "root", []byte("new root"), now)
+	registry.Push("example/app", subject, "2.root", []byte("versioned root"), now.Add(-time.Hour))
+	registry.Push("example/app", subject, "timestamp.key", []byte("public key"), now)
+
+	// the most recently created artifact with the name is used
+	b, err := s.GetSized("root", storage.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, "new root", string(b))
+
+	b, err = s.GetSized("2.root", storage.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, "versioned root", string(b))
+
+	b, err = s.GetKey(data.CanonicalTimestampRole)
+	require.NoError(t, err)
+	require.Equal(t, "public key", string(b))
+
+	// metadata with no artifact is not found
+	_, err = s.GetSized("targets", storage.NoSizeLimit)
+	require.IsType(t, storage.ErrMetaNotFound{}, err)
+
+	// metadata bigger than the requested size is rejected
+	_, err = s.GetSized("root", 3)
+	require.IsType(t, storage.ErrMaliciousServer{}, err)
+
+	// as is content which does not match its digest
+	registry.CorruptBlobs()
+	_, err = s.GetSized("root", storage.NoSizeLimit)
+	require.IsType(t, storage.ErrMaliciousServer{}, err)
+}
+
+func TestOCIStoreNoSubject(t *testing.T) {
+	registry := testutils.NewFakeOCIRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	subject := registry.Tag("example/app", "other")
+	registry.Push("example/app", subject, "root", []byte("root"), time.Now())
+
+	// the default subject tag does not exist
+	s, err := storage.NewOCIStore(server.URL, "example/app", "", http.DefaultTransport)
+	require.NoError(t, err)
+	_, err = s.GetSized("root", storage.NoSizeLimit)
+	require.IsType(t, storage.ErrMetaNotFound{}, err)
+
+	// but a custom one does
+	s, err = storage.NewOCIStore(server.URL, "example/app", "other", http.DefaultTransport)
+	require.NoError(t, err)
+	b, err := s.GetSized("root", storage.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, "root", string(b))
+	require.Contains(t, registry.Requests, "/v2/example/app/referrers/"+subject)
+}
+
+func TestOCIStoreIsReadOnly(t *testing.T) {
+	_, _, s, cleanup := setUpOCIStore(t)
+	defer cleanup()
+
+	require.IsType(t, storage.ErrInvalidOperation{}, s.Set("root", []byte("root")))
+	require.IsType(t, storage.ErrInvalidOperation{}, s.SetMulti(map[string][]byte{"root": []byte("root")}))
+	require.IsType(t, storage.ErrInvalidOperation{}, s.Remove("root"))
+	require.IsType(t, storage.ErrInvalidOperation{}, s.RemoveAll())
+	_, err := s.RotateKey(data.CanonicalTimestampRole)
+	require.IsType(t, storage.ErrInvalidOperation{}, err)
+}
+
+func TestNewOCIStore(t *testing.T) {
+	_, err := storage.NewOCIStore("registry.example.com", "example/app", "", http.DefaultTransport)
+	require.Error(t, err)
+	_, err = storage.NewOCIStore("https://registry.example.com", "", "", http.DefaultTransport)
+	require.Error(t, err)
+
+	s, err := storage.NewOCIStore("https://registry.example.com", "example/app", "", nil)
+	require.NoError(t, err)
+	require.IsType(t, &storage.OfflineStore{}, s)
+
+	s, err = storage.NewOCIStore("https://registry.example.com", "example/app", "", http.DefaultTransport)
+	require.NoError(t, err)
+	require.Equal(t, "registry.example.com", s.Location())
+}
@@ -42,6 +42,11 @@ func (es OfflineStore) GetKey(role data.RoleName) ([]byte, error) {
 	return nil, err
 }
 
+// GetKeyWithAlgorithm returns ErrOffline
+func (es OfflineStore) GetKeyWithAlgorithm(role data.RoleName, algorithm string) ([]byte, error) {
+	return nil, err
+}
+
 // RotateKey returns ErrOffline
 func (es OfflineStore) RotateKey(role data.RoleName) ([]byte, error) {
 	return nil, err
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxRetryWait is the longest a RetryAfterTransport waits before
+	// retrying a request, unless configured otherwise
+	DefaultMaxRetryWait = time.Minute
+	// DefaultMaxRetries is how many times a RetryAfterTransport retries a
+	// request, unless configured otherwise
+	DefaultMaxRetries = 3
+)
+
+// RetryAfterTransport retries idempotent requests which the server rejects
+// with 429 Too Many Requests or 503 Service Unavailable and a Retry-After
+// header, after waiting as long as the header asks, so that a rate limited
+// client backs off rather than hammering the server.  A wait is cut short if
+// the context of the request is done.
+type RetryAfterTransport struct {
+	Base http.RoundTripper
+	// MaxWait bounds how long any single wait may be.  A response asking for
+	// a longer wait is returned as it is, without retrying.
+	MaxWait time.Duration
+	// MaxRetries bounds how many times a request is retried
+	MaxRetries int
+
+	// sleep waits for the duration, or until the context is done
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetryAfterTransport wraps base so that idempotent requests are retried
+// when the server asks for them to be, waiting at most maxWait each time
+func NewRetryAfterTransport(base http.RoundTripper, maxWait time.Duration) *RetryAfterTransport {
+	return &RetryAfterTransport{
+		Base:       base,
+		MaxWait:    maxWait,
+		MaxRetries: DefaultMaxRetries,
+		sleep:      sleepWithContext,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return resp, err
+	}
+	for retries := 0; err == nil && retries < t.MaxRetries; retries++ {
+		wait, ok := retryAfter(resp, time.Now())
+		if !ok || wait > t.MaxWait {
+			break
+		}
+		logrus.Debugf("%s returned %d, retrying in %s", req.URL, resp.StatusCode, wait)
+		resp.Body.Close()
+		if err := t.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		resp, err = t.Base.RoundTrip(req)
+	}
+	return resp, err
+}
+
+// retryAfter returns how long the response asks for the request to be retried
+// after, if it is a 429 or 503 with a Retry-After header of either a number of
+// seconds or an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	header := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
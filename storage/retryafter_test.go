@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// rateLimitedServer rejects the first limited requests with the status and
+// Retry-After header given, and serves testRoot after that
+func rateLimitedServer(limited int, status int, retryAfter string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= limited {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(testRoot))
+	}))
+	return server, &requests
+}
+
+// testRetryTransport returns a RetryAfterTransport which records the waits it
+// is asked to make rather than making them
+func testRetryTransport(maxWait time.Duration) (*RetryAfterTransport, *[]time.Duration) {
+	var waits []time.Duration
+	rt := NewRetryAfterTransport(http.DefaultTransport, maxWait)
+	rt.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	return rt, &waits
+}
+
+// A request rejected with a Retry-After header is retried after the wait it
+// asks for, for both 429 and 503
+func TestRetryAfterTransportRetries(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		server, requests := rateLimitedServer(2, status, "2")
+		defer server.Close()
+		rt, waits := testRetryTransport(time.Minute)
+
+		store, err := NewHTTPStore(server.URL, "metadata", "json", "key", rt)
+		require.NoError(t, err)
+		meta, err := store.GetSized(data.CanonicalRootRole.String(), NoSizeLimit)
+		require.NoError(t, err)
+		require.Equal(t, testRoot, string(meta))
+		require.Equal(t, 3, *requests)
+		require.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second}, *waits)
+	}
+}
+
+// Responses which can't or shouldn't be retried are returned as they are
+func TestRetryAfterTransportDoesNotRetry(t *testing.T) {
+	for _, tc := range []struct {
+		status     int
+		retryAfter string
+		method     string
+	}{
+		{status: http.StatusTooManyRequests, method: "GET"},                              // no Retry-After
+		{status: http.StatusInternalServerError, retryAfter: "1", method: "GET"},         // not rate limited
+		{status: http.StatusTooManyRequests, retryAfter: "120", method: "GET"},           // too long a wait
+		{status: http.StatusTooManyRequests, retryAfter: "soon", method: "GET"},          // unparseable
+		{status: http.StatusServiceUnavailable, retryAfter: "1", method: "POST"},         // not idempotent
+		{status: http.StatusServiceUnavailable, retryAfter: "1", method: http.MethodPut}, // not idempotent
+	} {
+		server, requests := rateLimitedServer(1, tc.status, tc.retryAfter)
+		rt, waits := testRetryTransport(time.Minute)
+
+		req, err := http.NewRequest(tc.method, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, tc.status, resp.StatusCode, "%+v", tc)
+		require.Equal(t, 1, *requests, "%+v", tc)
+		require.Empty(t, *waits, "%+v", tc)
+		server.Close()
+	}
+}
+
+// A request is only retried so many times, after which the last response is
+// returned
+func TestRetryAfterTransportMaxRetries(t *testing.T) {
+	server, requests := rateLimitedServer(10, http.StatusTooManyRequests, "0")
+	defer server.Close()
+	rt, waits := testRetryTransport(time.Minute)
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, DefaultMaxRetries+1, *requests)
+	require.Len(t, *waits, DefaultMaxRetries)
+}
+
+// A wait is cut short once the context of the request is done
+func TestRetryAfterTransportContext(t *testing.T) {
+	server, requests := rateLimitedServer(1, http.StatusServiceUnavailable, "30")
+	defer server.Close()
+	rt := NewRetryAfterTransport(http.DefaultTransport, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = rt.RoundTrip(req.WithContext(ctx))
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(start) < 10*time.Second)
+	require.Equal(t, 1, *requests)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	response := func(status int, retryAfter string) *http.Response {
+		return &http.Response{StatusCode: status, Header: http.Header{"Retry-After": []string{retryAfter}}}
+	}
+
+	wait, ok := retryAfter(response(http.StatusTooManyRequests, "5"), now)
+	require.True(t, ok)
+	require.Equal(t, 5*time.Second, wait)
+
+	wait, ok = retryAfter(response(http.StatusServiceUnavailable, now.Add(90*time.Second).Format(http.TimeFormat)), now)
+	require.True(t, ok)
+	require.Equal(t, 90*time.Second, wait)
+
+	// a date in the past asks for an immediate retry
+	wait, ok = retryAfter(response(http.StatusServiceUnavailable, now.Add(-time.Hour).Format(http.TimeFormat)), now)
+	require.True(t, ok)
+	require.Equal(t, time.Duration(0), wait)
+
+	for _, invalid := range []*http.Response{
+		response(http.StatusTooManyRequests, ""),
+		response(http.StatusTooManyRequests, "-1"),
+		response(http.StatusTooManyRequests, "tomorrow"),
+		response(http.StatusOK, "5"),
+	} {
+		_, ok := retryAfter(invalid, now)
+		require.False(t, ok)
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrorCategory is the kind of error that an HTTP status returned by the
+// server is interpreted as
+type ErrorCategory string
+
+const (
+	// CategoryNotFound statuses are returned as ErrMetaNotFound
+	CategoryNotFound ErrorCategory = "not_found"
+	// CategoryInvalidOperation statuses are returned as ErrInvalidOperation,
+	// or the validation error in the body of the response if there is one
+	CategoryInvalidOperation ErrorCategory = "invalid_operation"
+	// CategoryUnauthorized statuses are returned as an ErrServerUnavailable
+	// which reports that the operation is not authorized
+	CategoryUnauthorized ErrorCategory = "unauthorized"
+	// CategoryUnavailable statuses are returned as ErrServerUnavailable
+	CategoryUnavailable ErrorCategory = "unavailable"
+)
+
+// StatusMapping maps the HTTP statuses returned by the server to the category
+// of error they are interpreted as.  It is for servers behind gateways that
+// rewrite statuses, for instance returning 403 instead of 401.
+type StatusMapping map[int]ErrorCategory
+
+// DefaultStatusMapping is how the statuses returned by a notary server are
+// interpreted.  Any other status, apart from 200, is CategoryUnavailable.
+var DefaultStatusMapping = StatusMapping{
+	http.StatusNotFound:     CategoryNotFound,
+	http.StatusBadRequest:   CategoryInvalidOperation,
+	http.StatusUnauthorized: CategoryUnauthorized,
+}
+
+// Validate checks that every status is an error status, and is mapped to a
+// known category
+func (m StatusMapping) Validate() error {
+	for status, category := range m {
+		if status < 300 || status > 599 {
+			return fmt.Errorf("cannot map HTTP status %d to an error", status)
+		}
+		switch category {
+		case CategoryNotFound, CategoryInvalidOperation, CategoryUnauthorized, CategoryUnavailable:
+		default:
+			return fmt.Errorf("unknown error category %q for HTTP status %d", category, status)
+		}
+	}
+	return nil
+}
+
+// category returns the category of error the status is interpreted as,
+// falling back on DefaultStatusMapping for statuses which are not mapped
+func (m StatusMapping) category(status int) ErrorCategory {
+	if category, ok := m[status]; ok {
+		return category
+	}
+	if category, ok := DefaultStatusMapping[status]; ok {
+		return category
+	}
+	return CategoryUnavailable
+}
+
+// translateStatus returns the error that the response's status is
+// interpreted as using the mapping, or nil if the request succeeded
+func translateStatus(resp *http.Response, resource string, mapping StatusMapping) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	switch mapping.category(resp.StatusCode) {
+	case CategoryNotFound:
+		return ErrMetaNotFound{Resource: resource}
+	case CategoryInvalidOperation:
+		return tryUnmarshalError(resp, ErrInvalidOperation{})
+	case CategoryUnauthorized:
+		return ErrServerUnavailable{code: resp.StatusCode, unauthorized: true}
+	default:
+		return ErrServerUnavailable{code: resp.StatusCode}
+	}
+}
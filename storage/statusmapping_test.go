@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// statusServer serves every request with the given status
+func statusServer(t *testing.T, status int) (*httptest.Server, *HTTPStore) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	s, err := NewHTTPStore(server.URL, "metadata", "json", "key", &http.Transport{})
+	require.NoError(t, err)
+	return server, s.(*HTTPStore)
+}
+
+// Statuses are interpreted as the categories they are mapped to, falling back
+// on the default mapping for statuses which aren't mapped
+func TestHTTPStoreStatusMapping(t *testing.T) {
+	mapping := StatusMapping{
+		http.StatusForbidden:           CategoryUnauthorized,
+		http.StatusConflict:            CategoryNotFound,
+		http.StatusUnprocessableEntity: CategoryInvalidOperation,
+		http.StatusNotFound:            CategoryUnavailable,
+	}
+
+	for status, expected := range map[int]error{
+		http.StatusForbidden:           ErrServerUnavailable{code: http.StatusForbidden, unauthorized: true},
+		http.StatusConflict:            ErrMetaNotFound{Resource: data.CanonicalTargetsRole.String()},
+		http.StatusUnprocessableEntity: ErrInvalidOperation{},
+		http.StatusNotFound:            ErrServerUnavailable{code: http.StatusNotFound},
+		http.StatusUnauthorized:        ErrServerUnavailable{code: http.StatusUnauthorized, unauthorized: true},
+		http.StatusBadRequest:          ErrInvalidOperation{},
+		http.StatusBadGateway:          ErrServerUnavailable{code: http.StatusBadGateway},
+	} {
+		server, s := statusServer(t, status)
+		require.NoError(t, s.SetStatusMapping(mapping))
+
+		_, err := s.GetSized(data.CanonicalTargetsRole.String(), NoSizeLimit)
+		require.Equal(t, expected, err, "status %d", status)
+		server.Close()
+	}
+}
+
+// Without a mapping, a gateway's 403 is reported as the server being
+// unavailable, and with one, as the operation not being authorized
+func TestHTTPStoreStatusMappingUnauthorized(t *testing.T) {
+	server, s := statusServer(t, http.StatusForbidden)
+	defer server.Close()
+
+	err := s.SetMulti(map[string][]byte{"targets": []byte("{}")})
+	require.IsType(t, ErrServerUnavailable{}, err)
+	require.Contains(t, err.Error(), "unable to reach trust server")
+
+	require.NoError(t, s.SetStatusMapping(StatusMapping{http.StatusForbidden: CategoryUnauthorized}))
+	err = s.SetMulti(map[string][]byte{"targets": []byte("{}")})
+	require.IsType(t, ErrServerUnavailable{}, err)
+	require.Equal(t, "you are not authorized to perform this operation: server returned 403.", err.Error())
+
+	// the mapping can be cleared again
+	require.NoError(t, s.SetStatusMapping(nil))
+	_, err = s.GetSized(data.CanonicalRootRole.String(), NoSizeLimit)
+	require.Contains(t, err.Error(), "unable to reach trust server")
+}
+
+func TestStatusMappingValidate(t *testing.T) {
+	require.NoError(t, DefaultStatusMapping.Validate())
+	require.NoError(t, StatusMapping(nil).Validate())
+
+	for _, invalid := range []StatusMapping{
+		{http.StatusOK: CategoryNotFound},
+		{99: CategoryUnavailable},
+		{600: CategoryUnavailable},
+		{http.StatusForbidden: "forbidden"},
+		{http.StatusForbidden: ""},
+	} {
+		require.Error(t, invalid.Validate(), fmt.Sprintf("%v", invalid))
+
+		server, s := statusServer(t, http.StatusForbidden)
+		require.Error(t, s.SetStatusMapping(invalid))
+		server.Close()
+	}
+}
@@ -0,0 +1,200 @@
+package testutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theupdateframework/notary/storage"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+)
+
+type descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Subject       *descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// FakeOCIRegistry is an in-memory OCI registry serving the subset of the
+// distribution API used by storage.OCIStore: the base endpoint, resolving tags,
+// the referrers API, and fetching manifests and blobs
+type FakeOCIRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	tags      map[string]string
+	referrers map[string][]descriptor
+	// Requests records the path of every request served
+	Requests []string
+}
+
+// NewFakeOCIRegistry returns an empty FakeOCIRegistry
+func NewFakeOCIRegistry() *FakeOCIRegistry {
+	return &FakeOCIRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		tags:      make(map[string]string),
+		referrers: make(map[string][]descriptor),
+	}
+}
+
+func digestOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Tag stores an empty manifest in the repository under the tag, to which
+// notary artifacts can then refer, and returns its digest
+func (r *FakeOCIRegistry) Tag(repository, tag string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, _ := json.Marshal(manifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        r.addBlob([]byte("{}"), "application/vnd.oci.empty.v1+json"),
+		Layers:        []descriptor{},
+	})
+	digest := digestOf(m)
+	r.manifests[repository+"@"+digest] = m
+	r.tags[repository+":"+tag] = digest
+	return digest
+}
+
+// Push stores content as a notary artifact with the given name, created at the
+// given time, which refers to the manifest with the given digest
+func (r *FakeOCIRegistry) Push(repository, subject, name string, content []byte, created time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	annotations := map[string]string{
+		storage.OCINameAnnotation:    name,
+		storage.OCICreatedAnnotation: created.UTC().Format(time.RFC3339),
+	}
+	m, _ := json.Marshal(manifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  storage.OCIArtifactType,
+		Config:        r.addBlob([]byte("{}"), "application/vnd.oci.empty.v1+json"),
+		Layers:        []descriptor{r.addBlob(content, "application/json")},
+		Subject:       &descriptor{MediaType: ociManifestMediaType, Digest: subject},
+		Annotations:   annotations,
+	})
+	digest := digestOf(m)
+	r.manifests[repository+"@"+digest] = m
+	r.referrers[repository+"@"+subject] = append(r.referrers[repository+"@"+subject], descriptor{
+		MediaType:    ociManifestMediaType,
+		Digest:       digest,
+		Size:         int64(len(m)),
+		ArtifactType: storage.OCIArtifactType,
+		Annotations:  annotations,
+	})
+}
+
+// PushAll pushes every named piece of content as a notary artifact
+func (r *FakeOCIRegistry) PushAll(repository, subject string, contents map[string][]byte, created time.Time) {
+	for name, content := range contents {
+		r.Push(repository, subject, name, content, created)
+	}
+}
+
+// CorruptBlobs replaces the content of every blob without changing its digest
+func (r *FakeOCIRegistry) CorruptBlobs() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for digest, blob := range r.blobs {
+		r.blobs[digest] = append([]byte("corrupt"), blob...)
+	}
+}
+
+// addBlob must be called with the lock held
+func (r *FakeOCIRegistry) addBlob(content []byte, mediaType string) descriptor {
+	digest := digestOf(content)
+	r.blobs[digest] = content
+	return descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+}
+
+// ServeHTTP serves the distribution API
+func (r *FakeOCIRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Requests = append(r.Requests, req.URL.Path)
+
+	// the base endpoint tells clients the registry supports the v2 API
+	if req.URL.Path == "/v2/" {
+		w.Write([]byte("{}"))
+		return
+	}
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	for _, endpoint := range []string{"/manifests/", "/blobs/", "/referrers/"} {
+		i := strings.LastIndex(p, endpoint)
+		if i < 0 {
+			continue
+		}
+		repository, ref := p[:i], p[i+len(endpoint):]
+		switch endpoint {
+		case "/manifests/":
+			digest := ref
+			if !strings.HasPrefix(ref, "sha256:") {
+				digest = r.tags[repository+":"+ref]
+			}
+			m, ok := r.manifests[repository+"@"+digest]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Header().Set("Content-Length", fmt.Sprint(len(m)))
+			if req.Method != "HEAD" {
+				w.Write(m)
+			}
+		case "/blobs/":
+			blob, ok := r.blobs[ref]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write(blob)
+		case "/referrers/":
+			var matching []descriptor
+			artifactType := req.URL.Query().Get("artifactType")
+			for _, desc := range r.referrers[repository+"@"+ref] {
+				if artifactType == "" || desc.ArtifactType == artifactType {
+					matching = append(matching, desc)
+				}
+			}
+			if matching == nil {
+				matching = []descriptor{}
+			}
+			index, _ := json.Marshal(struct {
+				SchemaVersion int          `json:"schemaVersion"`
+				MediaType     string       `json:"mediaType"`
+				Manifests     []descriptor `json:"manifests"`
+			}{2, ociIndexMediaType, matching})
+			w.Header().Set("Content-Type", ociIndexMediaType)
+			w.Write(index)
+		}
+		return
+	}
+	http.NotFound(w, req)
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// TraceparentHeader is the W3C trace context header, and gRPC metadata key,
+// in which the span context is propagated to other processes
+const TraceparentHeader = "traceparent"
+
+// FormatTraceparent returns the W3C traceparent value for the span context
+func FormatTraceparent(sc SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+// ParseTraceparent parses a W3C traceparent value
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	var sc SpanContext
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace ID in traceparent %q", value)
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid span ID in traceparent %q", value)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("expected %d lowercase hex characters", hex.EncodedLen(len(dst)))
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// InjectHTTP sets the traceparent header to the span context held by the
+// context, if any
+func InjectHTTP(ctx context.Context, header http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		header.Set(TraceparentHeader, FormatTraceparent(sc))
+	}
+}
+
+// ExtractHTTP returns a context holding the span context in the traceparent
+// header, if there is a valid one
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	return extract(ctx, header.Get(TraceparentHeader))
+}
+
+// InjectGRPC returns a context whose outgoing gRPC metadata carries the span
+// context held by the context, if any
+func InjectGRPC(ctx context.Context) context.Context {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		return metadata.AppendToOutgoingContext(ctx, TraceparentHeader, FormatTraceparent(sc))
+	}
+	return ctx
+}
+
+// ExtractGRPC returns a context holding the span context in the incoming
+// gRPC metadata, if there is a valid one
+func ExtractGRPC(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	values := md.Get(TraceparentHeader)
+	if len(values) == 0 {
+		return ctx
+	}
+	return extract(ctx, values[0])
+}
+
+func extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// HTTPHandler wraps the handler so that each request it serves is a span with
+// the given name, which is the child of the span in the request's traceparent
+// header, if any.  The span is held by the request's context.
+func HTTPHandler(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := Start(ExtractHTTP(r.Context(), r.Header), name)
+		defer span.End()
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RecordedSpan is a span which has ended, as recorded by a Recorder
+type RecordedSpan struct {
+	Name        string
+	SpanContext SpanContext
+	// Parent is the context of the span's parent, which is not valid if the
+	// span is the first of its trace
+	Parent SpanContext
+	Start  time.Time
+	End    time.Time
+	Err    error
+}
+
+// Recorder is a Tracer which keeps the spans it creates in memory once they
+// end, for tests and debugging
+type Recorder struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewRecorder returns a Recorder which has recorded no spans
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start starts a span which is recorded once it ends
+func (r *Recorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	span := &recordingSpan{
+		recorder: r,
+		span: RecordedSpan{
+			Name:        name,
+			SpanContext: NewSpanContext(parent),
+			Parent:      parent,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpanContext(ctx, span.span.SpanContext), span
+}
+
+// Spans returns the spans which have ended, in the order they ended
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+// Reset forgets the spans which have been recorded
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+type recordingSpan struct {
+	recorder *Recorder
+	once     sync.Once
+	span     RecordedSpan
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.span.SpanContext
+}
+
+func (s *recordingSpan) SetError(err error) {
+	if err != nil {
+		s.span.Err = err
+	}
+}
+
+func (s *recordingSpan) End() {
+	s.once.Do(func() {
+		s.span.End = time.Now()
+		s.recorder.mu.Lock()
+		defer s.recorder.mu.Unlock()
+		s.recorder.spans = append(s.recorder.spans, s.span)
+	})
+}
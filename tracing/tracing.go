@@ -0,0 +1,142 @@
+// Package tracing provides optional spans around the major operations of the
+// notary client, server and signer, such as publishing, fetching and signing,
+// so that the latency of a request can be followed from the client through
+// the server to the signer.
+//
+// Spans are created by the Tracer set with SetTracer, which by default does
+// nothing.  A Tracer can adapt any tracing system, such as OpenTelemetry, and
+// the trace is propagated between processes in the W3C traceparent header
+// of HTTP requests and the metadata of gRPC requests.
+package tracing
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+)
+
+// TraceID identifies a trace, which is made up of all the spans of a request
+type TraceID [16]byte
+
+// String returns the hex encoding of the trace ID
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the hex encoding of the span ID
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext identifies a span, whether created in this process or received
+// from another process, so that spans started from it are its children
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// IsValid returns whether the span context identifies a span, which it
+// doesn't if either of its IDs are all zeroes
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// NewSpanContext returns the context of a new span which is a child of the
+// parent, or the first span of a new trace if the parent is not valid
+func NewSpanContext(parent SpanContext) SpanContext {
+	sc := SpanContext{TraceID: parent.TraceID}
+	if !parent.IsValid() {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	return sc
+}
+
+// Span is an operation being traced, which lasts until End is called
+type Span interface {
+	// SpanContext returns the context of the span, which spans started
+	// within it are the children of
+	SpanContext() SpanContext
+	// SetError records that the operation failed with the error, if it isn't nil
+	SetError(err error)
+	// End ends the span
+	End()
+}
+
+// Tracer creates spans
+type Tracer interface {
+	// Start starts a span with the given name as a child of the span in the
+	// context, if any, and returns it along with a context holding it
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a context holding the span context, so that
+// spans started from the context are its children.  Tracers use it to hold
+// the spans they start.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context held by the context, which
+// is not valid if the context doesn't hold one
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// NoopTracer is the default Tracer, which creates spans that do nothing.  A
+// span context received from another process is still passed on to any
+// requests made within it, so that tracing a request isn't interrupted by a
+// process which doesn't trace.
+type NoopTracer struct{}
+
+// Start returns the context unchanged, and a span which does nothing
+func (NoopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{sc: SpanContextFromContext(ctx)}
+}
+
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (s noopSpan) SpanContext() SpanContext { return s.sc }
+func (noopSpan) SetError(error)             {}
+func (noopSpan) End()                       {}
+
+var (
+	tracerMu sync.RWMutex
+	tracer   Tracer = NoopTracer{}
+)
+
+// SetTracer replaces the Tracer which creates spans.  A nil Tracer restores
+// the NoopTracer.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = NoopTracer{}
+	}
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	tracer = t
+}
+
+// Start starts a span with the Tracer set by SetTracer
+func Start(ctx context.Context, name string) (context.Context, Span) {
+	tracerMu.RLock()
+	t := tracer
+	tracerMu.RUnlock()
+	return t.Start(ctx, name)
+}
+
+// ContextSigner is a private key which can propagate the trace of the span
+// held by the context to a remote service which makes its signatures
+type ContextSigner interface {
+	SignContext(ctx context.Context, rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error)
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	require.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", FormatTraceparent(sc))
+
+	// later versions may have more fields
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	require.NoError(t, err)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+// Spans recorded by a Recorder are the children of the span in the context
+// they are started with
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder()
+	ctx, parent := recorder.Start(context.Background(), "parent")
+	childCtx, child := recorder.Start(ctx, "child")
+	_, grandchild := recorder.Start(childCtx, "grandchild")
+	grandchild.SetError(errors.New("failed"))
+	grandchild.End()
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := recorder.Spans()
+	require.Len(t, spans, 3)
+	require.Equal(t, "grandchild", spans[0].Name)
+	require.EqualError(t, spans[0].Err, "failed")
+	require.Equal(t, spans[1].SpanContext, spans[0].Parent)
+	require.Equal(t, "child", spans[1].Name)
+	require.Equal(t, spans[2].SpanContext, spans[1].Parent)
+	require.Equal(t, "parent", spans[2].Name)
+	require.False(t, spans[2].Parent.IsValid())
+	for _, span := range spans {
+		require.True(t, span.SpanContext.IsValid())
+		require.Equal(t, spans[2].SpanContext.TraceID, span.SpanContext.TraceID)
+	}
+
+	recorder.Reset()
+	require.Empty(t, recorder.Spans())
+}
+
+// The default tracer creates no spans, but passes on a span context received
+// from another process
+func TestNoopTracerPropagates(t *testing.T) {
+	SetTracer(nil)
+	ctx, span := Start(context.Background(), "nothing")
+	span.End()
+	require.False(t, SpanContextFromContext(ctx).IsValid())
+
+	header := http.Header{}
+	InjectHTTP(ctx, header)
+	require.Empty(t, header.Get(TraceparentHeader))
+
+	remote := NewSpanContext(SpanContext{})
+	header.Set(TraceparentHeader, FormatTraceparent(remote))
+	ctx, span = Start(ExtractHTTP(context.Background(), header), "nothing")
+	require.Equal(t, remote, span.SpanContext())
+
+	md, ok := metadata.FromOutgoingContext(InjectGRPC(ctx))
+	require.True(t, ok)
+	require.Equal(t, []string{FormatTraceparent(remote)}, md.Get(TraceparentHeader))
+}
+
+// A span context is carried from an HTTP client to the handler, and from a
+// gRPC client to the server
+func TestPropagation(t *testing.T) {
+	recorder := NewRecorder()
+	SetTracer(recorder)
+	defer SetTracer(nil)
+
+	var handled SpanContext
+	server := httptest.NewServer(HTTPHandler("server", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = SpanContextFromContext(r.Context())
+	})))
+	defer server.Close()
+
+	ctx, client := Start(context.Background(), "client")
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	InjectHTTP(ctx, req.Header)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	client.End()
+
+	spans := recorder.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "server", spans[0].Name)
+	require.Equal(t, client.SpanContext(), spans[0].Parent)
+	require.Equal(t, spans[0].SpanContext, handled)
+
+	// gRPC metadata is sent as the incoming metadata of the server
+	md, _ := metadata.FromOutgoingContext(InjectGRPC(ctx))
+	incoming := metadata.NewIncomingContext(context.Background(), md)
+	require.Equal(t, client.SpanContext(), SpanContextFromContext(ExtractGRPC(incoming)))
+
+	// invalid or missing span contexts are ignored
+	require.False(t, SpanContextFromContext(ExtractGRPC(context.Background())).IsValid())
+	header := http.Header{}
+	header.Set(TraceparentHeader, "garbage")
+	require.False(t, SpanContextFromContext(ExtractHTTP(context.Background(), header)).IsValid())
+}
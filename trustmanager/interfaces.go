@@ -37,6 +37,12 @@ type Storage interface {
 type KeyInfo struct {
 	Gun  data.GUN
 	Role data.RoleName
+	// Label is an optional note for people of what the key is for
+	Label string
+	// KeepGun is set when a delegation key is generated for a particular GUN.
+	// Otherwise the Gun of a delegation key is not stored, since the key may
+	// be shared between repositories.
+	KeepGun bool
 }
 
 // KeyStore is a generic interface for private key storage
@@ -139,6 +139,12 @@ func ImportKeys(from io.Reader, to []Importer, fallbackRole string, fallbackGUN
 			if err != nil {
 				return errors.New("failed to encrypt key with given passphrase")
 			}
+			// keep the label through the encryption
+			if label := block.Headers["label"]; label != "" {
+				if blockBytes, err = utils.LabelPrivateKey(blockBytes, label); err != nil {
+					return err
+				}
+			}
 		}
 
 		if loc != writeTo {
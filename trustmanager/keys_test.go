@@ -559,3 +559,32 @@ func TestEncryption(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, originalKey, privKey.Private())
 }
+
+// A key's label survives exporting and importing it, whether or not the key
+// needs to be encrypted on import
+func TestExportImportKeepsLabel(t *testing.T) {
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, passphrase := range []string{cannedPassphrase, ""} {
+		pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, "targets/releases", "", passphrase)
+		require.NoError(t, err)
+		pemBytes, err = utils.LabelPrivateKey(pemBytes, "release signing")
+		require.NoError(t, err)
+
+		exportStore := NewTestExportStore()
+		exportStore.data[privKey.ID()] = pemBytes
+		var exported bytes.Buffer
+		require.NoError(t, ExportKeys(&exported, exportStore, privKey.ID()))
+
+		s := NewTestImportStore()
+		require.NoError(t, ImportKeys(&exported, []Importer{s}, "", "", passphraseRetriever))
+		imported := s.data[privKey.ID()]
+		require.Equal(t, "release signing", utils.ExtractPrivateKeyLabel(imported))
+
+		// the imported key is encrypted either way
+		decrypted, err := utils.ParsePEMPrivateKey(imported, cannedPassphrase)
+		require.NoError(t, err)
+		require.Equal(t, privKey.Private(), decrypted.Private())
+	}
+}
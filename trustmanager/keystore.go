@@ -99,9 +99,10 @@ func (s *GenericKeyStore) AddKey(keyInfo KeyInfo, privKey data.PrivateKey) error
 	)
 	s.Lock()
 	defer s.Unlock()
-	if keyInfo.Role == data.CanonicalRootRole || data.IsDelegation(keyInfo.Role) || !data.ValidRole(keyInfo.Role) {
+	if keyInfo.Role == data.CanonicalRootRole || data.IsDelegation(keyInfo.Role) && !keyInfo.KeepGun || !data.ValidRole(keyInfo.Role) {
 		keyInfo.Gun = ""
 	}
+	keyInfo.KeepGun = false
 	keyID := privKey.ID()
 	for attempts := 0; ; attempts++ {
 		chosenPassphrase, giveup, err = s.PassRetriever(keyID, keyInfo.Role.String(), true, attempts)
@@ -118,6 +119,11 @@ func (s *GenericKeyStore) AddKey(keyInfo KeyInfo, privKey data.PrivateKey) error
 	if err != nil {
 		return err
 	}
+	if keyInfo.Label != "" {
+		if pemPrivKey, err = utils.LabelPrivateKey(pemPrivKey, keyInfo.Label); err != nil {
+			return err
+		}
+	}
 
 	s.cachedKeys[keyID] = &cachedKey{role: keyInfo.Role, key: privKey}
 	err = s.store.Set(keyID, pemPrivKey)
@@ -190,7 +196,7 @@ func (s *GenericKeyStore) Name() string {
 func copyKeyInfoMap(keyInfoMap map[string]KeyInfo) map[string]KeyInfo {
 	copyMap := make(map[string]KeyInfo)
 	for keyID, keyInfo := range keyInfoMap {
-		copyMap[keyID] = KeyInfo{Role: keyInfo.Role, Gun: keyInfo.Gun}
+		copyMap[keyID] = KeyInfo{Role: keyInfo.Role, Gun: keyInfo.Gun, Label: keyInfo.Label}
 	}
 	return copyMap
 }
@@ -202,7 +208,7 @@ func KeyInfoFromPEM(pemBytes []byte, filename string) (string, KeyInfo, error) {
 	if err != nil {
 		return "", KeyInfo{}, err
 	}
-	return keyID, KeyInfo{Gun: gun, Role: role}, nil
+	return keyID, KeyInfo{Gun: gun, Role: role, Label: utils.ExtractPrivateKeyLabel(pemBytes)}, nil
 }
 
 // getKeyRole finds the role for the given keyID. It attempts to look
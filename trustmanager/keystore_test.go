@@ -71,6 +71,42 @@ func testAddKeyWithRole(t *testing.T, role data.RoleName) {
 	}
 }
 
+// A key's label is stored with the key, so it is listed by a new store
+// reading the same directory
+func TestAddKeyWithLabel(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err, "failed to create a temporary directory")
+	defer os.RemoveAll(tempBaseDir)
+	store, err := NewKeyFileStore(tempBaseDir, passphraseRetriever)
+	require.NoError(t, err, "failed to create new key filestore")
+
+	labeled, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	unlabeled, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, store.AddKey(KeyInfo{Role: "targets/releases", Label: "release signing"}, labeled))
+	require.NoError(t, store.AddKey(KeyInfo{Role: "targets/releases"}, unlabeled))
+	require.Error(t, store.AddKey(KeyInfo{Role: "targets/releases", Label: "two\nlines"}, unlabeled))
+
+	reloaded, err := NewKeyFileStore(tempBaseDir, passphraseRetriever)
+	require.NoError(t, err)
+	for _, s := range []*GenericKeyStore{store, reloaded} {
+		keys := s.ListKeys()
+		require.Len(t, keys, 2)
+		require.Equal(t, "release signing", keys[labeled.ID()].Label)
+		require.Equal(t, "", keys[unlabeled.ID()].Label)
+
+		info, err := s.GetKeyInfo(labeled.ID())
+		require.NoError(t, err)
+		require.Equal(t, "release signing", info.Label)
+	}
+
+	// the label doesn't get in the way of using the key
+	privKey, _, err := reloaded.GetKey(labeled.ID())
+	require.NoError(t, err)
+	require.Equal(t, labeled.Private(), privKey.Private())
+}
+
 func TestKeyStoreInternalState(t *testing.T) {
 	// Temporary directory where test files will be created
 	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
@@ -427,6 +463,17 @@ func TestAddGetKeyInfoMemStore(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, "targets/delegation", delgInfo.Role)
 	require.EqualValues(t, "", delgInfo.Gun)
+
+	gunDelgKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err, "could not generate private key")
+
+	// A delegation key generated for a particular GUN keeps it
+	err = store.AddKey(KeyInfo{Role: "targets/delegation", Gun: gun, KeepGun: true}, gunDelgKey)
+	require.NoError(t, err, "failed to add key to store")
+
+	gunDelgInfo, err := store.GetKeyInfo(gunDelgKey.ID())
+	require.NoError(t, err)
+	require.Equal(t, KeyInfo{Role: "targets/delegation", Gun: gun}, gunDelgInfo)
 }
 
 func TestGetDecryptedWithTamperedCipherText(t *testing.T) {
@@ -0,0 +1,219 @@
+package trustmanager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	paperBackupBegin   = "-----BEGIN NOTARY PAPER KEY BACKUP-----"
+	paperBackupEnd     = "-----END NOTARY PAPER KEY BACKUP-----"
+	paperBackupVersion = "1"
+
+	// paperGroupSize and paperGroupsPerLine determine how the encoded key is
+	// laid out, so that it can be easily read and typed back in
+	paperGroupSize     = 4
+	paperGroupsPerLine = 8
+	// paperLineChecksumSize is the number of hex characters of the checksum
+	// at the end of each line, which allows transcription errors to be found
+	paperLineChecksumSize = 4
+)
+
+// paperEncoding only uses upper case letters and the digits 2-7, which are
+// hard to confuse with one another when written down
+var paperEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EncodePaperBackup encodes a single (encrypted) private key PEM block in a
+// printable format suitable for offline storage, such as on paper.  The key is
+// never decrypted: the backup encodes exactly the bytes and headers of the PEM
+// block, and DecodePaperBackup returns the same PEM block.  The encoding is
+// deterministic, so the same PEM block always produces the same backup.
+func EncodePaperBackup(pemBytes []byte) (string, error) {
+	block, rest := pem.Decode(pemBytes)
+	if block == nil {
+		return "", fmt.Errorf("no PEM block found")
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return "", fmt.Errorf("only a single PEM block can be backed up")
+	}
+	if block.Type != "ENCRYPTED PRIVATE KEY" {
+		return "", fmt.Errorf("only encrypted private keys can be backed up, got %s", block.Type)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, paperBackupBegin)
+	fmt.Fprintf(&buf, "Version: %s\n", paperBackupVersion)
+	fmt.Fprintf(&buf, "Type: %s\n", block.Type)
+	for _, name := range sortedHeaderNames(block) {
+		fmt.Fprintf(&buf, "Header: %s: %s\n", name, block.Headers[name])
+	}
+	fmt.Fprintln(&buf)
+
+	encoded := paperEncoding.EncodeToString(block.Bytes)
+	lineSize := paperGroupSize * paperGroupsPerLine
+	for lineNum := 1; len(encoded) > 0; lineNum++ {
+		n := lineSize
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		line := encoded[:n]
+		encoded = encoded[n:]
+
+		var groups []string
+		for len(line) > 0 {
+			g := paperGroupSize
+			if g > len(line) {
+				g = len(line)
+			}
+			groups = append(groups, line[:g])
+			line = line[g:]
+		}
+		fmt.Fprintf(&buf, "%03d %s %s\n", lineNum, strings.Join(groups, " "),
+			paperLineChecksum(lineNum, strings.Join(groups, "")))
+	}
+
+	fmt.Fprintln(&buf)
+	fmt.Fprintf(&buf, "Checksum: %s\n", paperBlockChecksum(block))
+	fmt.Fprintln(&buf, paperBackupEnd)
+	return buf.String(), nil
+}
+
+// DecodePaperBackup reconstructs the PEM block encoded by EncodePaperBackup.
+// Lines are checked individually so that transcription errors can be located,
+// and the whole backup is checked once it has been decoded.
+func DecodePaperBackup(backup string) ([]byte, error) {
+	var (
+		started, ended bool
+		version        string
+		checksum       string
+		encoded        strings.Builder
+		expectedLine   = 1
+		block          = &pem.Block{Headers: map[string]string{}}
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(backup))
+	for scanner.Scan() {
+		// tolerate extra whitespace and changes of case introduced when the
+		// backup is typed back in
+		line := strings.Join(strings.Fields(scanner.Text()), " ")
+		switch {
+		case strings.EqualFold(line, paperBackupBegin):
+			started = true
+			continue
+		case !started || line == "":
+			continue
+		case strings.EqualFold(line, paperBackupEnd):
+			ended = true
+		}
+		if ended {
+			break
+		}
+
+		if key, value, ok := cutPaperField(line); ok {
+			switch strings.Title(strings.ToLower(key)) {
+			case "Version":
+				version = value
+			case "Type":
+				block.Type = strings.ToUpper(value)
+			case "Header":
+				name, headerValue, ok := cutPaperField(value)
+				if !ok {
+					return nil, fmt.Errorf("invalid header in backup: %s", value)
+				}
+				block.Headers[name] = headerValue
+			case "Checksum":
+				checksum = strings.ToLower(value)
+			default:
+				return nil, fmt.Errorf("unknown field in backup: %s", key)
+			}
+			continue
+		}
+
+		fields := strings.Fields(strings.ToUpper(line))
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid line in backup: %s", line)
+		}
+		lineNum, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid line number in backup: %s", fields[0])
+		}
+		if lineNum != expectedLine {
+			return nil, fmt.Errorf("expected line %d of the backup, but found line %d", expectedLine, lineNum)
+		}
+		data := strings.Join(fields[1:len(fields)-1], "")
+		if !strings.EqualFold(fields[len(fields)-1], paperLineChecksum(lineNum, data)) {
+			return nil, fmt.Errorf("checksum mismatch on line %d of the backup, please check it for typos", lineNum)
+		}
+		encoded.WriteString(data)
+		expectedLine++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !started || !ended {
+		return nil, fmt.Errorf("no complete paper key backup found")
+	}
+	if version != paperBackupVersion {
+		return nil, fmt.Errorf("unsupported paper key backup version: %q", version)
+	}
+	if block.Type == "" || checksum == "" {
+		return nil, fmt.Errorf("paper key backup is missing its type or checksum")
+	}
+
+	var err error
+	block.Bytes, err = paperEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not decode backup: %v", err)
+	}
+	if paperBlockChecksum(block) != checksum {
+		return nil, fmt.Errorf("checksum mismatch for the backup, please check it for typos or missing lines")
+	}
+	if len(block.Headers) == 0 {
+		block.Headers = nil
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// cutPaperField splits a "Name: value" line, returning false if the line is
+// not of that form
+func cutPaperField(line string) (string, string, bool) {
+	i := strings.Index(line, ": ")
+	if i <= 0 || strings.Contains(line[:i], " ") {
+		return "", "", false
+	}
+	return line[:i], line[i+2:], true
+}
+
+func paperLineChecksum(lineNum int, data string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", lineNum, data)))
+	return strings.ToUpper(hex.EncodeToString(sum[:])[:paperLineChecksumSize])
+}
+
+// paperBlockChecksum covers the type, headers and bytes of the PEM block
+func paperBlockChecksum(block *pem.Block) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", block.Type)
+	for _, name := range sortedHeaderNames(block) {
+		fmt.Fprintf(h, "%s: %s\n", name, block.Headers[name])
+	}
+	h.Write(block.Bytes)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func sortedHeaderNames(block *pem.Block) []string {
+	names := make([]string, 0, len(block.Headers))
+	for name := range block.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,138 @@
+package trustmanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+func generateEncryptedRootPEM(t *testing.T) (data.PrivateKey, []byte) {
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalRootRole, "", "passphrase")
+	require.NoError(t, err)
+
+	// add the path header, as on export
+	block, _ := pem.Decode(pemBytes)
+	block.Headers["path"] = privKey.ID()
+	return privKey, pem.EncodeToMemory(block)
+}
+
+func TestPaperBackupRoundTrip(t *testing.T) {
+	privKey, pemBytes := generateEncryptedRootPEM(t)
+
+	backup, err := EncodePaperBackup(pemBytes)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(backup, paperBackupBegin))
+	require.Contains(t, backup, "Header: role: root")
+	require.Contains(t, backup, "Header: path: "+privKey.ID())
+
+	// the encoding is deterministic
+	again, err := EncodePaperBackup(pemBytes)
+	require.NoError(t, err)
+	require.Equal(t, backup, again)
+
+	recovered, err := DecodePaperBackup(backup)
+	require.NoError(t, err)
+	require.Equal(t, pemBytes, recovered)
+
+	// whitespace, the case of the encoded data and surrounding text don't matter
+	var sloppy []string
+	for _, line := range strings.Split(backup, "\n") {
+		line = strings.Replace(line, " ", "  ", -1)
+		if len(line) > 0 && line[0] >= '0' && line[0] <= '9' {
+			line = strings.ToLower(line)
+		}
+		sloppy = append(sloppy, "  "+line)
+	}
+	sloppyBackup := "my root key backup\n\n" + strings.Join(sloppy, "\n") + "\nstored in the safe\n"
+	recovered, err = DecodePaperBackup(sloppyBackup)
+	require.NoError(t, err)
+	require.Equal(t, pemBytes, recovered)
+
+	// the recovered key is still encrypted, and can sign once decrypted
+	_, err = utils.ParsePEMPrivateKey(recovered, "")
+	require.Error(t, err)
+	recoveredKey, err := utils.ParsePEMPrivateKey(recovered, "passphrase")
+	require.NoError(t, err)
+	require.Equal(t, privKey.ID(), recoveredKey.ID())
+
+	msg := []byte("sign me")
+	sig, err := recoveredKey.Sign(rand.Reader, msg, nil)
+	require.NoError(t, err)
+	// ECDSA signatures are the concatenation of r and s
+	pubKey, ok := privKey.CryptoSigner().Public().(*ecdsa.PublicKey)
+	require.True(t, ok)
+	digest := sha256.Sum256(msg)
+	r, s := new(big.Int).SetBytes(sig[:len(sig)/2]), new(big.Int).SetBytes(sig[len(sig)/2:])
+	require.True(t, ecdsa.Verify(pubKey, digest[:], r, s))
+}
+
+func TestPaperBackupDetectsErrors(t *testing.T) {
+	_, pemBytes := generateEncryptedRootPEM(t)
+	backup, err := EncodePaperBackup(pemBytes)
+	require.NoError(t, err)
+	lines := strings.Split(backup, "\n")
+
+	// find the first line of encoded data
+	dataIdx := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "001 ") {
+			dataIdx = i
+			break
+		}
+	}
+	require.NotEqual(t, -1, dataIdx)
+
+	// a typo is reported with its line number
+	typo := append([]string{}, lines...)
+	c := "A"
+	if typo[dataIdx][4:5] == "A" {
+		c = "B"
+	}
+	typo[dataIdx] = typo[dataIdx][:4] + c + typo[dataIdx][5:]
+	_, err = DecodePaperBackup(strings.Join(typo, "\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 1")
+
+	// as is a missing line
+	missing := append(append([]string{}, lines[:dataIdx]...), lines[dataIdx+1:]...)
+	_, err = DecodePaperBackup(strings.Join(missing, "\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected line 1")
+
+	// and a changed header, which is only covered by the overall checksum
+	changed := strings.Replace(backup, "Header: role: root", "Header: role: targets", 1)
+	_, err = DecodePaperBackup(changed)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum mismatch for the backup")
+
+	// a truncated backup is rejected
+	_, err = DecodePaperBackup(strings.Join(lines[:dataIdx+1], "\n"))
+	require.Error(t, err)
+}
+
+func TestPaperBackupOnlyEncryptedKeys(t *testing.T) {
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	unencrypted, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalRootRole, "", "")
+	require.NoError(t, err)
+
+	_, err = EncodePaperBackup(unencrypted)
+	require.Error(t, err)
+
+	_, err = EncodePaperBackup([]byte("not a pem"))
+	require.Error(t, err)
+
+	_, encrypted := generateEncryptedRootPEM(t)
+	_, err = EncodePaperBackup(append(encrypted, encrypted...))
+	require.Error(t, err)
+}
@@ -0,0 +1,377 @@
+//go:build yubihsm
+// +build yubihsm
+
+// the transport to the YubiHSM 2: commands are framed and posted to the
+// yubihsm-connector, and, once a session is authenticated, wrapped in SCP03
+// secure messages which are encrypted and MACed with keys derived from the
+// password of an authentication key
+
+package yubihsm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// command codes of the YubiHSM 2
+const (
+	cmdCreateSession         byte = 0x03
+	cmdAuthenticateSession   byte = 0x04
+	cmdSessionMessage        byte = 0x05
+	cmdCloseSession          byte = 0x40
+	cmdPutAsymmetricKey      byte = 0x45
+	cmdGenerateAsymmetricKey byte = 0x46
+	cmdListObjects           byte = 0x48
+	cmdGetObjectInfo         byte = 0x4e
+	cmdGetPublicKey          byte = 0x54
+	cmdSignECDSA             byte = 0x56
+	cmdDeleteObject          byte = 0x58
+
+	// responses have the code of their command with the high bit set, or
+	// this code if the command failed
+	responseFlag byte = 0x80
+	responseErr  byte = 0x7f
+)
+
+// SCP03 derivation constants
+const (
+	derivationCardCryptogram byte = 0x00
+	derivationHostCryptogram byte = 0x01
+	derivationEncryption     byte = 0x04
+	derivationMAC            byte = 0x06
+	derivationRMAC           byte = 0x07
+)
+
+const (
+	challengeSize = 8
+	macSize       = 8
+	// authKeySalt and authKeyIterations derive an authentication key from
+	// its password, as the YubiHSM tools do
+	authKeySalt       = "Yubico"
+	authKeyIterations = 10000
+)
+
+var deviceErrors = map[byte]string{
+	0x01: "invalid command",
+	0x02: "invalid data",
+	0x03: "invalid session",
+	0x04: "authentication failed",
+	0x05: "no free sessions",
+	0x06: "session failed",
+	0x07: "storage failed",
+	0x08: "wrong length",
+	0x09: "insufficient permissions",
+	0x0a: "log full",
+	0x0b: "object not found",
+	0x0c: "invalid ID",
+	0x0d: "invalid OTP",
+	0x0e: "demo mode",
+	0x0f: "command unexecuted",
+}
+
+// ErrDevice is an error reported by the YubiHSM for a command
+type ErrDevice struct {
+	Code byte
+}
+
+func (err ErrDevice) Error() string {
+	if msg, ok := deviceErrors[err.Code]; ok {
+		return "yubihsm: " + msg
+	}
+	return fmt.Sprintf("yubihsm: error code %d", err.Code)
+}
+
+// errWrongPassword is returned when the YubiHSM's cryptogram doesn't match
+// the one derived from the password of the authentication key
+var errWrongPassword = errors.New("yubihsm: wrong password for the authentication key")
+
+// connector posts framed commands to a yubihsm-connector
+type connector struct {
+	url    string
+	client *http.Client
+}
+
+func newConnector(url string) *connector {
+	return &connector{
+		url:    strings.TrimSuffix(url, "/") + "/connector/api",
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func frame(cmd byte, payload []byte) []byte {
+	msg := make([]byte, 3, 3+len(payload))
+	msg[0] = cmd
+	binary.BigEndian.PutUint16(msg[1:], uint16(len(payload)))
+	return append(msg, payload...)
+}
+
+// parseResponse checks that a framed response is the response to the
+// command, and returns its payload
+func parseResponse(cmd byte, msg []byte) ([]byte, error) {
+	if len(msg) < 3 {
+		return nil, fmt.Errorf("yubihsm: response of %d bytes is too short", len(msg))
+	}
+	length := int(binary.BigEndian.Uint16(msg[1:3]))
+	if len(msg) < 3+length {
+		return nil, fmt.Errorf("yubihsm: response is truncated")
+	}
+	payload := msg[3 : 3+length]
+	switch msg[0] {
+	case cmd | responseFlag:
+		return payload, nil
+	case responseErr:
+		if length != 1 {
+			return nil, fmt.Errorf("yubihsm: malformed error response")
+		}
+		return nil, ErrDevice{Code: payload[0]}
+	default:
+		return nil, fmt.Errorf("yubihsm: unexpected response 0x%02x to command 0x%02x", msg[0], cmd)
+	}
+}
+
+// send posts a command and returns the payload of its response
+func (c *connector) send(cmd byte, payload []byte) ([]byte, error) {
+	resp, err := c.client.Post(c.url, "application/octet-stream", bytes.NewReader(frame(cmd, payload)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("yubihsm: connector responded with %s", resp.Status)
+	}
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(cmd, msg)
+}
+
+// authKeysFromPassword derives the encryption and MAC keys of an
+// authentication key from its password
+func authKeysFromPassword(password string) (encKey, macKey []byte) {
+	keys := pbkdf2.Key([]byte(password), []byte(authKeySalt), authKeyIterations, 2*aes.BlockSize, sha256.New)
+	return keys[:aes.BlockSize], keys[aes.BlockSize:]
+}
+
+// session is an authenticated SCP03 session with the YubiHSM
+type session struct {
+	conn     *connector
+	id       byte
+	encKey   []byte
+	macKey   []byte
+	rmacKey  []byte
+	macChain []byte
+	counter  uint32
+}
+
+// openSession creates and authenticates a session using an authentication
+// key, given the keys derived from its password
+func openSession(conn *connector, authKeyID uint16, encKey, macKey []byte) (*session, error) {
+	hostChallenge := make([]byte, challengeSize)
+	if _, err := rand.Read(hostChallenge); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 2, 2+challengeSize)
+	binary.BigEndian.PutUint16(payload, authKeyID)
+	resp, err := conn.send(cmdCreateSession, append(payload, hostChallenge...))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 1+2*challengeSize {
+		return nil, fmt.Errorf("yubihsm: malformed response creating a session")
+	}
+
+	s := &session{conn: conn, id: resp[0], macChain: make([]byte, aes.BlockSize)}
+	challenges := append(append([]byte{}, hostChallenge...), resp[1:1+challengeSize]...)
+	if s.encKey, err = deriveKey(encKey, derivationEncryption, challenges, 128); err != nil {
+		return nil, err
+	}
+	if s.macKey, err = deriveKey(macKey, derivationMAC, challenges, 128); err != nil {
+		return nil, err
+	}
+	if s.rmacKey, err = deriveKey(macKey, derivationRMAC, challenges, 128); err != nil {
+		return nil, err
+	}
+
+	cardCryptogram, err := deriveKey(s.macKey, derivationCardCryptogram, challenges, 64)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(cardCryptogram, resp[1+challengeSize:]) {
+		return nil, errWrongPassword
+	}
+	hostCryptogram, err := deriveKey(s.macKey, derivationHostCryptogram, challenges, 64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.sendMAC(cmdAuthenticateSession, hostCryptogram); err != nil {
+		return nil, err
+	}
+	s.counter = 1
+	return s, nil
+}
+
+// sendMAC sends a command for the session, MACed as part of the chain of
+// the session's messages, and returns the payload of its response.  The
+// responses to secure messages are MACed in turn, and that MAC is checked.
+func (s *session) sendMAC(cmd byte, data []byte) ([]byte, error) {
+	msg := make([]byte, 4, 4+len(data))
+	msg[0] = cmd
+	binary.BigEndian.PutUint16(msg[1:], uint16(1+len(data)+macSize))
+	msg[3] = s.id
+	msg = append(msg, data...)
+	mac, err := cmac(s.macKey, append(append([]byte{}, s.macChain...), msg...))
+	if err != nil {
+		return nil, err
+	}
+	s.macChain = mac
+
+	resp, err := s.conn.send(cmd, append(msg[3:], mac[:macSize]...))
+	if err != nil || cmd != cmdSessionMessage {
+		return resp, err
+	}
+
+	if len(resp) < 1+macSize || resp[0] != s.id {
+		return nil, fmt.Errorf("yubihsm: malformed secure message response")
+	}
+	body := resp[:len(resp)-macSize]
+	header := []byte{cmd | responseFlag, 0, 0}
+	binary.BigEndian.PutUint16(header[1:], uint16(len(resp)))
+	rmac, err := cmac(s.rmacKey, append(append(append([]byte{}, s.macChain...), header...), body...))
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(rmac[:macSize], resp[len(body):]) {
+		return nil, fmt.Errorf("yubihsm: secure message response has an invalid MAC")
+	}
+	return body[1:], nil
+}
+
+// send sends a command encrypted within a secure message, and returns the
+// payload of its response
+func (s *session) send(cmd byte, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(s.encKey)
+	if err != nil {
+		return nil, err
+	}
+	// the IV is the encrypted counter of the session's messages
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv[aes.BlockSize-4:], s.counter)
+	block.Encrypt(iv, iv)
+	s.counter++
+
+	plaintext := pad(frame(cmd, payload))
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plaintext)
+
+	resp, err := s.sendMAC(cmdSessionMessage, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 || len(resp)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("yubihsm: secure message response is not a whole number of blocks")
+	}
+	decrypted := make([]byte, len(resp))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, resp)
+	return parseResponse(cmd, decrypted)
+}
+
+// close closes the session on the YubiHSM, which otherwise only frees it
+// once it times out
+func (s *session) close() {
+	s.send(cmdCloseSession, nil)
+}
+
+// pad pads a message to a whole number of blocks with 0x80 followed by
+// zeros, as in ISO/IEC 9797-1 padding method 2
+func pad(msg []byte) []byte {
+	padded := append(append([]byte{}, msg...), 0x80)
+	for len(padded)%aes.BlockSize != 0 {
+		padded = append(padded, 0)
+	}
+	return padded
+}
+
+// deriveKey derives a key, or a cryptogram, of the given number of bits from
+// a key and the challenges of a session, with the SCP03 key derivation
+// function: NIST SP 800-108 in counter mode, with AES-CMAC as the PRF
+func deriveKey(key []byte, constant byte, challenges []byte, bits int) ([]byte, error) {
+	input := make([]byte, 11, 16+len(challenges))
+	input = append(input, constant, 0, byte(bits>>8), byte(bits), 1)
+	input = append(input, challenges...)
+	mac, err := cmac(key, input)
+	if err != nil {
+		return nil, err
+	}
+	return mac[:bits/8], nil
+}
+
+// cmac computes the AES-CMAC of a message, as specified by RFC 4493
+func cmac(key, msg []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	subkey1 := make([]byte, aes.BlockSize)
+	block.Encrypt(subkey1, subkey1)
+	subkey1 = doubleSubkey(subkey1)
+	subkey2 := doubleSubkey(subkey1)
+
+	blocks := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	if blocks == 0 {
+		blocks = 1
+	}
+	last := make([]byte, aes.BlockSize)
+	rest := msg[(blocks-1)*aes.BlockSize:]
+	copy(last, rest)
+	if len(rest) == aes.BlockSize {
+		xorBlock(last, subkey1)
+	} else {
+		last[len(rest)] = 0x80
+		xorBlock(last, subkey2)
+	}
+
+	mac := make([]byte, aes.BlockSize)
+	for i := 0; i < blocks-1; i++ {
+		xorBlock(mac, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(mac, mac)
+	}
+	xorBlock(mac, last)
+	block.Encrypt(mac, mac)
+	return mac, nil
+}
+
+// doubleSubkey returns the block multiplied by x in GF(2^128), which
+// generates the CMAC subkeys
+func doubleSubkey(b []byte) []byte {
+	doubled := make([]byte, len(b))
+	for i := range b {
+		doubled[i] = b[i] << 1
+		if i+1 < len(b) {
+			doubled[i] |= b[i+1] >> 7
+		}
+	}
+	if b[0]&0x80 != 0 {
+		doubled[len(doubled)-1] ^= 0x87
+	}
+	return doubled
+}
+
+func xorBlock(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
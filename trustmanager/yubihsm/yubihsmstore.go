@@ -0,0 +1,467 @@
+//go:build yubihsm
+// +build yubihsm
+
+package yubihsm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+const (
+	// DefaultConnectorURL is where the yubihsm-connector listens by default
+	DefaultConnectorURL = "http://localhost:12345"
+	// DefaultAuthKeyID is the ID of the authentication key a YubiHSM 2 is
+	// shipped with, whose password is "password"
+	DefaultAuthKeyID uint16 = 1
+
+	// the type of asymmetric key objects, and the algorithm and size of the
+	// keys notary stores
+	objectTypeAsymmetricKey byte = 0x03
+	algorithmECP256         byte = 0x0c
+	ecdsaPrivateKeySize          = 32
+
+	// keys are created in the first domain, and may only sign ECDSA
+	keyDomains               uint16 = 0x0001
+	capabilitySignECDSA      uint64 = 0x80
+	labelSize                       = 40
+	labelPrefix                     = "notary:"
+	listFilterType           byte   = 0x02
+	objectInfoSize                  = 66
+	objectInfoAlgorithmIndex        = 15
+	objectInfoLabelOffset           = 18
+)
+
+// ErrBackupFailed is returned when a YubiHSMStore fails to back up a key that
+// is added
+type ErrBackupFailed struct {
+	err string
+}
+
+func (err ErrBackupFailed) Error() string {
+	return fmt.Sprintf("Failed to backup private key to: %s", err.err)
+}
+
+type hsmKey struct {
+	role     data.RoleName
+	objectID uint16
+}
+
+// YubiHSMStore is a KeyStore for private keys inside a YubiHSM 2, which it
+// reaches through the yubihsm-connector.  Only ECDSA P-256 keys are
+// supported, and the keys notary stores are labelled with their role.
+type YubiHSMStore struct {
+	conn          *connector
+	authKeyID     uint16
+	passRetriever notary.PassRetriever
+	backupStore   trustmanager.KeyStore
+
+	mu sync.Mutex
+	// the keys derived from the authentication key's password, once it has
+	// been used to open a session
+	encKey, macKey []byte
+	keys           map[string]hsmKey
+}
+
+// NewYubiHSMStore returns a YubiHSMStore which opens sessions through the
+// connector at the given URL with the given authentication key, whose
+// password is asked of the passphrase retriever.  Any keys added are also
+// written to the backup store, if one is given.  The YubiHSM isn't contacted
+// until the store is used.
+func NewYubiHSMStore(connectorURL string, authKeyID uint16, backupStore trustmanager.KeyStore,
+	passphraseRetriever notary.PassRetriever) (*YubiHSMStore, error) {
+
+	u, err := url.Parse(connectorURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid yubihsm-connector URL %q", connectorURL)
+	}
+	return &YubiHSMStore{
+		conn:          newConnector(connectorURL),
+		authKeyID:     authKeyID,
+		passRetriever: passphraseRetriever,
+		backupStore:   backupStore,
+		keys:          make(map[string]hsmKey),
+	}, nil
+}
+
+// Name returns a user friendly name for the location this store
+// keeps its data
+func (s *YubiHSMStore) Name() string {
+	return "yubihsm"
+}
+
+// withSession runs f with a new session, which is closed afterwards.  The
+// password of the authentication key is only asked for until a session has
+// been opened with it.
+func (s *YubiHSMStore) withSession(f func(*session) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.encKey != nil {
+		sess, err := openSession(s.conn, s.authKeyID, s.encKey, s.macKey)
+		if err != nil {
+			return err
+		}
+		defer sess.close()
+		return f(sess)
+	}
+
+	for attempts := 0; ; attempts++ {
+		passwd, giveup, err := s.passRetriever(fmt.Sprintf("authentication key %d", s.authKeyID), "yubihsm", false, attempts)
+		// Check if the passphrase retriever got an error or if it is telling us to give up
+		if giveup || err != nil {
+			return trustmanager.ErrPasswordInvalid{}
+		}
+		if attempts > 2 {
+			return trustmanager.ErrAttemptsExceeded{}
+		}
+
+		encKey, macKey := authKeysFromPassword(passwd)
+		sess, err := openSession(s.conn, s.authKeyID, encKey, macKey)
+		if err == errWrongPassword {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.encKey, s.macKey = encKey, macKey
+		defer sess.close()
+		return f(sess)
+	}
+}
+
+// ListKeys returns a list of keys in the YubiHSM
+func (s *YubiHSMStore) ListKeys() map[string]trustmanager.KeyInfo {
+	var keys map[string]hsmKey
+	err := s.withSession(func(sess *session) error {
+		var err error
+		keys, err = listKeys(sess)
+		return err
+	})
+	if err != nil {
+		logrus.Debugf("Failed to list keys in the yubihsm: %s", err.Error())
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	res := make(map[string]trustmanager.KeyInfo, len(keys))
+	for keyID, key := range keys {
+		res[keyID] = trustmanager.KeyInfo{Role: key.role}
+	}
+	return res
+}
+
+// lookup returns the key with the given ID, listing the keys in the YubiHSM
+// if it isn't already known
+func (s *YubiHSMStore) lookup(keyID string) (hsmKey, bool) {
+	s.mu.Lock()
+	key, ok := s.keys[keyID]
+	s.mu.Unlock()
+	if ok {
+		return key, true
+	}
+	s.ListKeys()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok = s.keys[keyID]
+	return key, ok
+}
+
+// AddKey puts a key inside the YubiHSM, as well as writing it to the backup
+// store
+func (s *YubiHSMStore) AddKey(keyInfo trustmanager.KeyInfo, privKey data.PrivateKey) error {
+	if key, ok := s.lookup(privKey.ID()); ok && key.role == keyInfo.Role {
+		return nil
+	}
+	if privKey.Algorithm() != data.ECDSAKey {
+		return fmt.Errorf("yubihsm only supports storing ECDSA keys, got %s for key: %s", privKey.Algorithm(), privKey.ID())
+	}
+	ecdsaPrivKey, err := x509.ParseECPrivateKey(privKey.Private())
+	if err != nil {
+		return err
+	}
+	if ecdsaPrivKey.Curve != elliptic.P256() {
+		return fmt.Errorf("yubihsm only supports storing P-256 keys, got key: %s", privKey.ID())
+	}
+
+	// the private scalar, left-padded to the size of the curve
+	private := ecdsaPrivKey.D.Bytes()
+	scalar := append(make([]byte, ecdsaPrivateKeySize-len(private), ecdsaPrivateKeySize), private...)
+	var objectID uint16
+	err = s.withSession(func(sess *session) error {
+		var err error
+		objectID, err = createKey(sess, cmdPutAsymmetricKey, keyInfo.Role, scalar)
+		return err
+	})
+	if err != nil {
+		logrus.Debugf("Failed to add key to yubihsm: %v", err)
+		return err
+	}
+	s.mu.Lock()
+	s.keys[privKey.ID()] = hsmKey{role: keyInfo.Role, objectID: objectID}
+	s.mu.Unlock()
+
+	if s.backupStore != nil {
+		if err := s.backupStore.AddKey(keyInfo, privKey); err != nil {
+			defer s.RemoveKey(privKey.ID())
+			return ErrBackupFailed{err: err.Error()}
+		}
+	}
+	return nil
+}
+
+// GenerateKey generates an ECDSA P-256 key for the role inside the YubiHSM,
+// and returns its public key.  The private key never leaves the YubiHSM, so
+// unlike keys which are added it has no backup.
+func (s *YubiHSMStore) GenerateKey(role data.RoleName) (data.PublicKey, error) {
+	var pubKey *data.ECDSAPublicKey
+	var objectID uint16
+	err := s.withSession(func(sess *session) error {
+		var err error
+		if objectID, err = createKey(sess, cmdGenerateAsymmetricKey, role, nil); err != nil {
+			return err
+		}
+		pubKey, err = getPublicKey(sess, objectID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[pubKey.ID()] = hsmKey{role: role, objectID: objectID}
+	return pubKey, nil
+}
+
+// GetKey retrieves a key from the YubiHSM only (it does not look inside the
+// backup store)
+func (s *YubiHSMStore) GetKey(keyID string) (data.PrivateKey, data.RoleName, error) {
+	key, ok := s.lookup(keyID)
+	if !ok {
+		return nil, "", trustmanager.ErrKeyNotFound{KeyID: keyID}
+	}
+	var pubKey *data.ECDSAPublicKey
+	err := s.withSession(func(sess *session) error {
+		var err error
+		pubKey, err = getPublicKey(sess, key.objectID)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	// Check to see if we're returning the intended keyID
+	if pubKey.ID() != keyID {
+		return nil, "", fmt.Errorf("expected key: %s, but found: %s", keyID, pubKey.ID())
+	}
+	return &YubiHSMPrivateKey{ECDSAPublicKey: *pubKey, store: s, objectID: key.objectID}, key.role, nil
+}
+
+// GetKeyInfo returns the role of a key in the YubiHSM
+func (s *YubiHSMStore) GetKeyInfo(keyID string) (trustmanager.KeyInfo, error) {
+	key, ok := s.lookup(keyID)
+	if !ok {
+		return trustmanager.KeyInfo{}, trustmanager.ErrKeyNotFound{KeyID: keyID}
+	}
+	return trustmanager.KeyInfo{Role: key.role}, nil
+}
+
+// RemoveKey deletes a key from the YubiHSM only (it does not remove it from
+// the backup store)
+func (s *YubiHSMStore) RemoveKey(keyID string) error {
+	key, ok := s.lookup(keyID)
+	if !ok {
+		return errors.New("Key not present in yubihsm")
+	}
+	err := s.withSession(func(sess *session) error {
+		payload := make([]byte, 3)
+		binary.BigEndian.PutUint16(payload, key.objectID)
+		payload[2] = objectTypeAsymmetricKey
+		_, err := sess.send(cmdDeleteObject, payload)
+		return err
+	})
+	if err != nil {
+		logrus.Debugf("Failed to remove from the yubihsm KeyID %s: %v", keyID, err)
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, keyID)
+	return nil
+}
+
+// createKey puts or generates an ECDSA P-256 key labelled with the role,
+// letting the YubiHSM choose its object ID, which is returned
+func createKey(sess *session, cmd byte, role data.RoleName, private []byte) (uint16, error) {
+	label := labelPrefix + role.String()
+	if len(label) > labelSize {
+		return 0, fmt.Errorf("role %s is too long to label a yubihsm key with", role)
+	}
+	payload := make([]byte, 2+labelSize+2+8, 2+labelSize+2+8+1+len(private))
+	copy(payload[2:], label)
+	binary.BigEndian.PutUint16(payload[2+labelSize:], keyDomains)
+	binary.BigEndian.PutUint64(payload[2+labelSize+2:], capabilitySignECDSA)
+	payload = append(append(payload, algorithmECP256), private...)
+
+	resp, err := sess.send(cmd, payload)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 2 {
+		return 0, fmt.Errorf("yubihsm: malformed response creating a key")
+	}
+	return binary.BigEndian.Uint16(resp), nil
+}
+
+// listKeys returns the ECDSA P-256 keys labelled by notary, by key ID
+func listKeys(sess *session) (map[string]hsmKey, error) {
+	objects, err := sess.send(cmdListObjects, []byte{listFilterType, objectTypeAsymmetricKey})
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]hsmKey)
+	// each object is listed as its ID, type and sequence number
+	for i := 0; i+4 <= len(objects); i += 4 {
+		objectID := binary.BigEndian.Uint16(objects[i:])
+		info, err := sess.send(cmdGetObjectInfo, []byte{objects[i], objects[i+1], objectTypeAsymmetricKey})
+		if err != nil {
+			return nil, err
+		}
+		if len(info) != objectInfoSize || info[objectInfoAlgorithmIndex] != algorithmECP256 {
+			continue
+		}
+		label := strings.TrimRight(string(info[objectInfoLabelOffset:objectInfoLabelOffset+labelSize]), "\x00")
+		if !strings.HasPrefix(label, labelPrefix) {
+			continue
+		}
+		pubKey, err := getPublicKey(sess, objectID)
+		if err != nil {
+			return nil, err
+		}
+		keys[pubKey.ID()] = hsmKey{role: data.RoleName(strings.TrimPrefix(label, labelPrefix)), objectID: objectID}
+	}
+	return keys, nil
+}
+
+// getPublicKey returns the public key of an ECDSA P-256 key
+func getPublicKey(sess *session, objectID uint16) (*data.ECDSAPublicKey, error) {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, objectID)
+	resp, err := sess.send(cmdGetPublicKey, payload)
+	if err != nil {
+		return nil, err
+	}
+	// the algorithm is followed by the coordinates of the point
+	if len(resp) != 1+2*ecdsaPrivateKeySize || resp[0] != algorithmECP256 {
+		return nil, fmt.Errorf("yubihsm object %d is not an ECDSA P-256 key", objectID)
+	}
+	pubKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(resp[1 : 1+ecdsaPrivateKeySize]),
+		Y:     new(big.Int).SetBytes(resp[1+ecdsaPrivateKeySize:]),
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return data.NewECDSAPublicKey(pubBytes), nil
+}
+
+// YubiHSMPrivateKey represents a private key inside of a YubiHSM
+type YubiHSMPrivateKey struct {
+	data.ECDSAPublicKey
+	store    *YubiHSMStore
+	objectID uint16
+}
+
+// yubiHSMSigner wraps a YubiHSMPrivateKey and implements the crypto.Signer
+// interface, signing digests rather than messages
+type yubiHSMSigner struct {
+	YubiHSMPrivateKey
+}
+
+// Public is a required method of the crypto.Signer interface
+func (ys *yubiHSMSigner) Public() crypto.PublicKey {
+	publicKey, err := x509.ParsePKIXPublicKey(ys.YubiHSMPrivateKey.Public())
+	if err != nil {
+		return nil
+	}
+	return publicKey
+}
+
+// Sign returns the ASN.1 encoded ECDSA signature of a digest, as the
+// crypto.Signer interface requires
+func (ys *yubiHSMSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return ys.signDigest(digest)
+}
+
+// CryptoSigner returns a crypto.Signer that wraps the YubiHSMPrivateKey.
+// Needed for Certificate generation only
+func (y *YubiHSMPrivateKey) CryptoSigner() crypto.Signer {
+	return &yubiHSMSigner{YubiHSMPrivateKey: *y}
+}
+
+// Private is not implemented in hardware keys
+func (y *YubiHSMPrivateKey) Private() []byte {
+	// We cannot return the private material from a YubiHSM
+	return nil
+}
+
+// SignatureAlgorithm returns which algorithm this key uses to sign - currently
+// hardcoded to ECDSA
+func (y YubiHSMPrivateKey) SignatureAlgorithm() data.SigAlgorithm {
+	return data.ECDSASignature
+}
+
+// Sign is a required method of the crypto.Signer interface and the data.PrivateKey
+// interface.  It signs the SHA256 digest of the message, and returns the
+// signature as the concatenated r and s values, as notary's ECDSA keys do.
+func (y *YubiHSMPrivateKey) Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	sigASN1, err := y.signDigest(digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign using yubihsm: %v", err)
+	}
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sigASN1, &sig); err != nil {
+		return nil, fmt.Errorf("failed to parse yubihsm signature: %v", err)
+	}
+	// left-pad r and s to the size of the curve
+	r, s := sig.R.Bytes(), sig.S.Bytes()
+	raw := make([]byte, 2*ecdsaPrivateKeySize)
+	copy(raw[ecdsaPrivateKeySize-len(r):], r)
+	copy(raw[2*ecdsaPrivateKeySize-len(s):], s)
+	return raw, nil
+}
+
+func (y *YubiHSMPrivateKey) signDigest(digest []byte) ([]byte, error) {
+	var sig []byte
+	err := y.store.withSession(func(sess *session) error {
+		payload := make([]byte, 2, 2+len(digest))
+		binary.BigEndian.PutUint16(payload, y.objectID)
+		var err error
+		sig, err = sess.send(cmdSignECDSA, append(payload, digest...))
+		return err
+	})
+	return sig, err
+}
@@ -0,0 +1,164 @@
+//go:build yubihsm
+// +build yubihsm
+
+package yubihsm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/passphrase"
+	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// the examples of RFC 4493
+func TestCMAC(t *testing.T) {
+	key := mustDecodeHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	msg := mustDecodeHex(t, "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51"+
+		"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	for length, expected := range map[int]string{
+		0:  "bb1d6929e95937287fa37d129b756746",
+		16: "070a16b46b4d4144f79bdd9dd04a287c",
+		40: "dfa66747de9ae63030ca32611497c827",
+		64: "51f0bebf7e3b9d92fc49741779363cfe",
+	} {
+		mac, err := cmac(key, msg[:length])
+		require.NoError(t, err)
+		require.Equal(t, expected, hex.EncodeToString(mac), "message of %d bytes", length)
+	}
+}
+
+func TestPad(t *testing.T) {
+	require.Equal(t, append([]byte{1, 0x80}, make([]byte, 14)...), pad([]byte{1}))
+	require.Len(t, pad(make([]byte, 16)), 32)
+}
+
+func TestParseResponse(t *testing.T) {
+	payload, err := parseResponse(cmdGetPublicKey, []byte{cmdGetPublicKey | responseFlag, 0, 2, 7, 8, 0x80, 0})
+	require.NoError(t, err)
+	require.Equal(t, []byte{7, 8}, payload)
+
+	_, err = parseResponse(cmdGetPublicKey, []byte{responseErr, 0, 1, 0x0b})
+	require.Equal(t, ErrDevice{Code: 0x0b}, err)
+	require.Contains(t, err.Error(), "object not found")
+
+	_, err = parseResponse(cmdGetPublicKey, []byte{cmdSignECDSA | responseFlag, 0, 0})
+	require.Error(t, err)
+	_, err = parseResponse(cmdGetPublicKey, []byte{cmdGetPublicKey | responseFlag, 0, 2, 7})
+	require.Error(t, err)
+}
+
+func TestNewYubiHSMStoreInvalidURL(t *testing.T) {
+	for _, invalid := range []string{"", "localhost:12345", "ftp://localhost:12345"} {
+		_, err := NewYubiHSMStore(invalid, DefaultAuthKeyID, nil, passphrase.ConstantRetriever("password"))
+		require.Error(t, err, invalid)
+	}
+}
+
+// testStore returns a store for the YubiHSM, or simulator, whose connector is
+// at the URL in NOTARY_YUBIHSM_CONNECTOR, skipping the test if it isn't set.
+// The authentication key is that in NOTARY_YUBIHSM_AUTH_KEY, by default the
+// factory default key, whose password is "password".
+func testStore(t *testing.T, backupStore trustmanager.KeyStore) *YubiHSMStore {
+	connectorURL := os.Getenv("NOTARY_YUBIHSM_CONNECTOR")
+	if connectorURL == "" {
+		t.Skip("NOTARY_YUBIHSM_CONNECTOR is not set")
+	}
+	authKeyID := DefaultAuthKeyID
+	if id := os.Getenv("NOTARY_YUBIHSM_AUTH_KEY"); id != "" {
+		parsed, err := strconv.ParseUint(id, 10, 16)
+		require.NoError(t, err)
+		authKeyID = uint16(parsed)
+	}
+	store, err := NewYubiHSMStore(connectorURL, authKeyID, backupStore, passphrase.ConstantRetriever("password"))
+	require.NoError(t, err)
+	return store
+}
+
+func requireSignsVerifiably(t *testing.T, privKey data.PrivateKey, pubKey data.PublicKey) {
+	msg := []byte("signed by the yubihsm")
+	sig, err := privKey.Sign(rand.Reader, msg, nil)
+	require.NoError(t, err)
+	verifier := signed.Verifiers[data.ECDSASignature]
+	require.NoError(t, verifier.Verify(pubKey, sig, msg))
+	require.Error(t, verifier.Verify(pubKey, sig, []byte("something else")))
+}
+
+// A key generated in the YubiHSM is listed, and signs verifiably
+func TestYubiHSMGenerateSignVerify(t *testing.T) {
+	store := testStore(t, nil)
+
+	pubKey, err := store.GenerateKey(data.CanonicalRootRole)
+	require.NoError(t, err)
+	defer store.RemoveKey(pubKey.ID())
+
+	// another store for the same YubiHSM finds the key
+	other := testStore(t, nil)
+	keys := other.ListKeys()
+	require.Contains(t, keys, pubKey.ID())
+	require.Equal(t, data.CanonicalRootRole, keys[pubKey.ID()].Role)
+
+	privKey, role, err := other.GetKey(pubKey.ID())
+	require.NoError(t, err)
+	require.Equal(t, data.CanonicalRootRole, role)
+	require.Nil(t, privKey.Private())
+	requireSignsVerifiably(t, privKey, pubKey)
+
+	require.NoError(t, other.RemoveKey(pubKey.ID()))
+	_, _, err = store.GetKey(pubKey.ID())
+	require.IsType(t, trustmanager.ErrKeyNotFound{}, err)
+}
+
+// A key generated by notary can be added to the YubiHSM, which backs it up,
+// and its signatures verify with the original public key
+func TestYubiHSMAddKey(t *testing.T) {
+	backupStore := trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("password"))
+	store := testStore(t, backupStore)
+
+	privKey, err := utils.GenerateECDSAKey(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, store.AddKey(trustmanager.KeyInfo{Role: data.CanonicalRootRole}, privKey))
+	defer store.RemoveKey(privKey.ID())
+
+	_, _, err = backupStore.GetKey(privKey.ID())
+	require.NoError(t, err)
+
+	hsmKey, _, err := store.GetKey(privKey.ID())
+	require.NoError(t, err)
+	requireSignsVerifiably(t, hsmKey, data.PublicKeyFromPrivate(privKey))
+
+	info, err := store.GetKeyInfo(privKey.ID())
+	require.NoError(t, err)
+	require.Equal(t, data.CanonicalRootRole, info.Role)
+
+	ed25519Key, err := utils.GenerateED25519Key(rand.Reader)
+	require.NoError(t, err)
+	require.Error(t, store.AddKey(trustmanager.KeyInfo{Role: data.CanonicalRootRole}, ed25519Key))
+}
+
+// A wrong password is asked for again, until the retriever gives up
+func TestYubiHSMWrongPassword(t *testing.T) {
+	store := testStore(t, nil)
+	var attempts int
+	store.passRetriever = func(_, alias string, _ bool, numAttempts int) (string, bool, error) {
+		require.Equal(t, "yubihsm", alias)
+		attempts = numAttempts + 1
+		return "wrong", numAttempts > 1, nil
+	}
+	_, err := store.GenerateKey(data.CanonicalRootRole)
+	require.Equal(t, trustmanager.ErrPasswordInvalid{}, err)
+	require.Equal(t, 3, attempts)
+}
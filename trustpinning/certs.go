@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -85,6 +86,12 @@ We shall call this: TOFUS.
 Validation failure at any step will result in an ErrValidationFailed error.
 */
 func ValidateRoot(prevRoot *data.SignedRoot, root *data.Signed, gun data.GUN, trustPinning TrustPinConfig) (*data.SignedRoot, error) {
+	return ValidateRootAt(prevRoot, root, gun, trustPinning, time.Now())
+}
+
+// ValidateRootAt is ValidateRoot, with the certificates checked for expiry at
+// the given time rather than the present time
+func ValidateRootAt(prevRoot *data.SignedRoot, root *data.Signed, gun data.GUN, trustPinning TrustPinConfig, now time.Time) (*data.SignedRoot, error) {
 	logrus.Debugf("entered ValidateRoot with dns: %s", gun)
 	signedRoot, err := data.RootFromSigned(root)
 	if err != nil {
@@ -98,8 +105,8 @@ func ValidateRoot(prevRoot *data.SignedRoot, root *data.Signed, gun data.GUN, tr
 
 	// Retrieve all the leaf and intermediate certificates in root for which the CN matches the GUN
 	allLeafCerts, allIntCerts := parseAllCerts(signedRoot)
-	certsFromRoot, err := validRootLeafCerts(allLeafCerts, gun, true)
-	validIntCerts := validRootIntCerts(allIntCerts)
+	certsFromRoot, err := validRootLeafCerts(allLeafCerts, gun, true, now)
+	validIntCerts := validRootIntCerts(allIntCerts, now)
 
 	if err != nil {
 		logrus.Debugf("error retrieving valid leaf certificates for: %s, %v", gun, err)
@@ -114,7 +121,7 @@ func ValidateRoot(prevRoot *data.SignedRoot, root *data.Signed, gun data.GUN, tr
 		// Retrieve all the trusted certificates from our previous root
 		// Note that we do not validate expiries here since our originally trusted root might have expired certs
 		allTrustedLeafCerts, allTrustedIntCerts := parseAllCerts(prevRoot)
-		trustedLeafCerts, err := validRootLeafCerts(allTrustedLeafCerts, gun, false)
+		trustedLeafCerts, err := validRootLeafCerts(allTrustedLeafCerts, gun, false, now)
 		if err != nil {
 			return nil, &ErrValidationFail{Reason: "could not retrieve trusted certs from previous root role data"}
 		}
@@ -143,7 +150,7 @@ func ValidateRoot(prevRoot *data.SignedRoot, root *data.Signed, gun data.GUN, tr
 
 	// Regardless of having a previous root or not, confirm that the new root validates against the trust pinning
 	logrus.Debugf("checking root against trust_pinning config for %s", gun)
-	trustPinCheckFunc, err := NewTrustPinChecker(trustPinning, gun, !havePrevRoot)
+	trustPinCheckFunc, err := NewTrustPinCheckerAt(trustPinning, gun, !havePrevRoot, now)
 	if err != nil {
 		return nil, &ErrValidationFail{Reason: err.Error()}
 	}
@@ -191,7 +198,7 @@ func MatchCNToGun(commonName string, gun data.GUN) bool {
 // validRootLeafCerts returns a list of possibly (if checkExpiry is true) non-expired, non-sha1 certificates
 // found in root whose Common-Names match the provided GUN. Note that this
 // "validity" alone does not imply any measure of trust.
-func validRootLeafCerts(allLeafCerts map[string]*x509.Certificate, gun data.GUN, checkExpiry bool) (map[string]*x509.Certificate, error) {
+func validRootLeafCerts(allLeafCerts map[string]*x509.Certificate, gun data.GUN, checkExpiry bool, now time.Time) (map[string]*x509.Certificate, error) {
 	validLeafCerts := make(map[string]*x509.Certificate)
 
 	// Go through every leaf certificate and check that the CN matches the gun
@@ -204,7 +211,7 @@ func validRootLeafCerts(allLeafCerts map[string]*x509.Certificate, gun data.GUN,
 		}
 		// Make sure the certificate is not expired if checkExpiry is true
 		// and warn if it hasn't expired yet but is within 6 months of expiry
-		if err := utils.ValidateCertificate(cert, checkExpiry); err != nil {
+		if err := utils.ValidateCertificateAt(cert, checkExpiry, now); err != nil {
 			logrus.Debugf("%s is invalid: %s", id, err.Error())
 			continue
 		}
@@ -224,13 +231,13 @@ func validRootLeafCerts(allLeafCerts map[string]*x509.Certificate, gun data.GUN,
 
 // validRootIntCerts filters the passed in structure of intermediate certificates to only include non-expired, non-sha1 certificates
 // Note that this "validity" alone does not imply any measure of trust.
-func validRootIntCerts(allIntCerts map[string][]*x509.Certificate) map[string][]*x509.Certificate {
+func validRootIntCerts(allIntCerts map[string][]*x509.Certificate, now time.Time) map[string][]*x509.Certificate {
 	validIntCerts := make(map[string][]*x509.Certificate)
 
 	// Go through every leaf cert ID, and build its valid intermediate certificate list
 	for leafID, intCertList := range allIntCerts {
 		for _, intCert := range intCertList {
-			if err := utils.ValidateCertificate(intCert, true); err != nil {
+			if err := utils.ValidateCertificateAt(intCert, true, now); err != nil {
 				continue
 			}
 			validIntCerts[leafID] = append(validIntCerts[leafID], intCert)
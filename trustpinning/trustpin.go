@@ -3,7 +3,9 @@ package trustpinning
 import (
 	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -18,8 +20,9 @@ import (
 // These are used with the following precedence:
 //
 // 1. Certs
-// 2. CA
-// 3. TOFUS (TOFU over HTTPS)
+// 2. Chain
+// 3. CA
+// 4. TOFUS (TOFU over HTTPS)
 //
 // Only one trust pinning option will be used to validate a particular GUN.
 type TrustPinConfig struct {
@@ -28,9 +31,31 @@ type TrustPinConfig struct {
 	CA map[string]string
 	// Certs maps a GUN to a list of certificate IDs
 	Certs map[string][]string
+	// Chain maps a GUN prefix to file paths containing the full expected
+	// certificate chain above the leaf: the intermediate CA(s) which must have
+	// issued the leaf, ordered from the leaf's issuer upwards, followed by the
+	// root CA.  Unlike CA, a leaf issued by any other intermediate is rejected,
+	// even if that intermediate was issued by the same root.
+	Chain map[string]string
+	// TSACA is the path to a file containing the root CA(s) of the timestamping
+	// authority which must have countersigned the snapshot referenced by the
+	// timestamp.  If it is empty, timestamping authority tokens are not checked.
+	TSACA string
+	// NotFound maps a GUN prefix to the path of a file containing the public
+	// key, or a certificate for it, with which the server signs statements
+	// that a GUN does not exist.  A server's claim that such a GUN does not
+	// exist is only believed if it comes with a statement signed by the key.
+	NotFound map[string]string
 	// DisableTOFU, when true, disables "Trust On First Use" of new key data
 	// This is false by default, which means new key data will always be trusted the first time it is seen.
 	DisableTOFU bool
+	// TOFUMaxAge is how long a root trusted on first use stays trusted
+	// before the GUN must be re-pinned.  Zero means a root trusted on first
+	// use is trusted indefinitely.
+	TOFUMaxAge time.Duration
+	// Repin, when true, discards a root trusted on first use which is older
+	// than TOFUMaxAge and trusts the server's root on first use again.
+	Repin bool
 }
 
 type trustPinChecker struct {
@@ -38,6 +63,8 @@ type trustPinChecker struct {
 	config        TrustPinConfig
 	pinnedCAPool  *x509.CertPool
 	pinnedCertIDs []string
+	pinnedChain   []*x509.Certificate
+	now           time.Time
 }
 
 // CertChecker is a function type that will be used to check leaf certs against pinned trust
@@ -45,7 +72,14 @@ type CertChecker func(leafCert *x509.Certificate, intCerts []*x509.Certificate)
 
 // NewTrustPinChecker returns a new certChecker function from a TrustPinConfig for a GUN
 func NewTrustPinChecker(trustPinConfig TrustPinConfig, gun data.GUN, firstBootstrap bool) (CertChecker, error) {
-	t := trustPinChecker{gun: gun, config: trustPinConfig}
+	return NewTrustPinCheckerAt(trustPinConfig, gun, firstBootstrap, time.Now())
+}
+
+// NewTrustPinCheckerAt is NewTrustPinChecker, with the pinned and checked
+// certificates required to be valid at the given time rather than the present
+// time
+func NewTrustPinCheckerAt(trustPinConfig TrustPinConfig, gun data.GUN, firstBootstrap bool, now time.Time) (CertChecker, error) {
+	t := trustPinChecker{gun: gun, config: trustPinConfig, now: now}
 	// Determine the mode, and if it's even valid
 	if pinnedCerts, ok := trustPinConfig.Certs[gun.String()]; ok {
 		logrus.Debugf("trust-pinning using Cert IDs")
@@ -58,7 +92,21 @@ func NewTrustPinChecker(trustPinConfig TrustPinConfig, gun data.GUN, firstBootst
 		return t.certsCheck, nil
 	}
 
-	if caFilepath, err := getPinnedCAFilepathByPrefix(gun, trustPinConfig); err == nil {
+	if chainFilepath, err := getPinnedFilepathByPrefix(gun, trustPinConfig.Chain); err == nil {
+		logrus.Debugf("trust-pinning using certificate chain at: %s", chainFilepath)
+
+		chain, err := utils.LoadCertBundleFromFile(chainFilepath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load certificate chain from path")
+		}
+		if err := validatePinnedChain(chain, now); err != nil {
+			return nil, fmt.Errorf("invalid certificate chain provided: %v", err)
+		}
+		t.pinnedChain = chain
+		return t.chainCheck, nil
+	}
+
+	if caFilepath, err := getPinnedFilepathByPrefix(gun, trustPinConfig.CA); err == nil {
 		logrus.Debugf("trust-pinning using root CA bundle at: %s", caFilepath)
 
 		// Try to add the CA certs from its bundle file to our certificate store,
@@ -70,7 +118,7 @@ func NewTrustPinChecker(trustPinConfig TrustPinConfig, gun data.GUN, firstBootst
 		// Now only consider certificates that are direct children from this CA cert chain
 		caRootPool := x509.NewCertPool()
 		for _, caCert := range caCerts {
-			if err = utils.ValidateCertificate(caCert, true); err != nil {
+			if err = utils.ValidateCertificateAt(caCert, true, now); err != nil {
 				logrus.Debugf("ignoring root CA certificate with CN %s in bundle: %s", caCert.Subject.CommonName, err)
 				continue
 			}
@@ -86,12 +134,46 @@ func NewTrustPinChecker(trustPinConfig TrustPinConfig, gun data.GUN, firstBootst
 
 	// If TOFUs is disabled and we don't have any previous trusted root data for this GUN, we error out
 	if trustPinConfig.DisableTOFU && firstBootstrap {
-		return nil, fmt.Errorf("invalid trust pinning specified")
+		return nil, fmt.Errorf("trust on first use is disabled and no trust pinning is configured for %s", gun)
 
 	}
 	return t.tofusCheck, nil
 }
 
+// UsesTOFU returns whether the root of the GUN is trusted on first use,
+// which is when no certificate IDs, certificate chain or CA is pinned for it
+func UsesTOFU(trustPinConfig TrustPinConfig, gun data.GUN) bool {
+	if _, ok := trustPinConfig.Certs[gun.String()]; ok {
+		return false
+	}
+	if _, ok := wildcardMatch(gun, trustPinConfig.Certs); ok {
+		return false
+	}
+	if _, err := getPinnedFilepathByPrefix(gun, trustPinConfig.Chain); err == nil {
+		return false
+	}
+	_, err := getPinnedFilepathByPrefix(gun, trustPinConfig.CA)
+	return err != nil
+}
+
+// PinnedNotFoundKey returns the key pinned for the GUN with which the server
+// must sign statements that the GUN does not exist, or nil if none is pinned
+func PinnedNotFoundKey(trustPinConfig TrustPinConfig, gun data.GUN) (data.PublicKey, error) {
+	keyFilepath, err := getPinnedFilepathByPrefix(gun, trustPinConfig.NotFound)
+	if err != nil {
+		return nil, nil
+	}
+	pemBytes, err := ioutil.ReadFile(keyFilepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load pinned not-found key: %v", err)
+	}
+	key, err := utils.ParsePEMPublicKey(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pinned not-found key: %v", err)
+	}
+	return key, nil
+}
+
 func (t trustPinChecker) certsCheck(leafCert *x509.Certificate, intCerts []*x509.Certificate) bool {
 	// reconstruct the leaf + intermediate cert chain, which is bundled as {leaf, intermediates...},
 	// in order to get the matching id in the root file
@@ -112,34 +194,102 @@ func (t trustPinChecker) caCheck(leafCert *x509.Certificate, intCerts []*x509.Ce
 	// Attempt to find a valid certificate chain from the leaf cert to CA root
 	// Use this certificate if such a valid chain exists (possibly using intermediates)
 	var err error
-	if _, err = leafCert.Verify(x509.VerifyOptions{Roots: t.pinnedCAPool, Intermediates: caIntPool}); err == nil {
+	if _, err = leafCert.Verify(x509.VerifyOptions{Roots: t.pinnedCAPool, Intermediates: caIntPool, CurrentTime: t.now}); err == nil {
 		return true
 	}
 	logrus.Debugf("unable to find a valid certificate chain from leaf cert to CA root: %s", err)
 	return false
 }
 
+func (t trustPinChecker) chainCheck(leafCert *x509.Certificate, intCerts []*x509.Certificate) bool {
+	// Only the pinned intermediates are made available, so that a leaf issued
+	// by an intermediate bundled in the root TUF metadata cannot be accepted
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(t.pinnedChain[len(t.pinnedChain)-1])
+	intPool := x509.NewCertPool()
+	for _, intCert := range t.pinnedChain[:len(t.pinnedChain)-1] {
+		intPool.AddCert(intCert)
+	}
+	// Notary leaf certificates are issued for code signing rather than for TLS
+	chains, err := leafCert.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intPool,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		CurrentTime:   t.now,
+	})
+	if err != nil {
+		logrus.Debugf("unable to find a valid certificate chain from leaf cert to pinned chain: %s", err)
+		return false
+	}
+	// The leaf must chain through every pinned certificate, so for instance a
+	// leaf issued directly by the pinned root is rejected
+	for _, chain := range chains {
+		if certsEqual(chain[1:], t.pinnedChain) {
+			return true
+		}
+	}
+	logrus.Debugf("leaf cert with CN %s does not chain through the pinned certificate chain", leafCert.Subject.CommonName)
+	return false
+}
+
 func (t trustPinChecker) tofusCheck(leafCert *x509.Certificate, intCerts []*x509.Certificate) bool {
 	return true
 }
 
-// Will return the CA filepath corresponding to the most specific (longest) entry in the map that is still a prefix
+// Will return the filepath corresponding to the most specific (longest) entry in the map that is still a prefix
 // of the provided gun.  Returns an error if no entry matches this GUN as a prefix.
-func getPinnedCAFilepathByPrefix(gun data.GUN, t TrustPinConfig) (string, error) {
+func getPinnedFilepathByPrefix(gun data.GUN, pinned map[string]string) (string, error) {
 	specificGUN := ""
-	specificCAFilepath := ""
-	foundCA := false
-	for gunPrefix, caFilepath := range t.CA {
+	specificFilepath := ""
+	found := false
+	for gunPrefix, pinnedPath := range pinned {
 		if strings.HasPrefix(gun.String(), gunPrefix) && len(gunPrefix) >= len(specificGUN) {
 			specificGUN = gunPrefix
-			specificCAFilepath = caFilepath
-			foundCA = true
+			specificFilepath = pinnedPath
+			found = true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("could not find pinned file for GUN: %s", gun)
+	}
+	return specificFilepath, nil
+}
+
+// validatePinnedChain checks that each certificate in a pinned chain is a
+// valid CA certificate issued by the next one, ending in a self-signed root
+func validatePinnedChain(chain []*x509.Certificate, now time.Time) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("no certificates found")
+	}
+	for i, cert := range chain {
+		if err := utils.ValidateCertificateAt(cert, true, now); err != nil {
+			return err
+		}
+		if !cert.IsCA {
+			return fmt.Errorf("certificate with CN %s is not a CA", cert.Subject.CommonName)
+		}
+		issuer := cert
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+		}
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("certificate with CN %s was not issued by %s: %v",
+				cert.Subject.CommonName, issuer.Subject.CommonName, err)
 		}
 	}
-	if !foundCA {
-		return "", fmt.Errorf("could not find pinned CA for GUN: %s", gun)
+	return nil
+}
+
+func certsEqual(a, b []*x509.Certificate) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	return specificCAFilepath, nil
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 // wildcardMatch will attempt to match the most specific (longest prefix) wildcarded
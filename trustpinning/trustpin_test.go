@@ -1,9 +1,20 @@
 package trustpinning
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
 )
 
 func TestWildcardMatch(t *testing.T) {
@@ -33,3 +44,142 @@ func TestWildcardMatch(t *testing.T) {
 	require.Equal(t, "def", res[0])
 	require.True(t, ok)
 }
+
+// A GUN is only trusted on first use if nothing is pinned for it
+func TestUsesTOFU(t *testing.T) {
+	config := TrustPinConfig{
+		Certs: map[string][]string{
+			"docker.io/library/ubuntu": {"abc"},
+			"docker.io/endophage/*":    {"xyz"},
+		},
+		Chain:    map[string]string{"docker.io/chain": "chain.crt"},
+		CA:       map[string]string{"docker.io/ca": "ca.crt"},
+		NotFound: map[string]string{"docker.io": "not-found.pem"},
+	}
+	for _, gun := range []data.GUN{"docker.io/library/ubuntu", "docker.io/endophage/foo", "docker.io/chain/foo", "docker.io/ca/foo"} {
+		require.False(t, UsesTOFU(config, gun), gun.String())
+	}
+	for _, gun := range []data.GUN{"docker.io/library/debian", "docker.io/other"} {
+		require.True(t, UsesTOFU(config, gun), gun.String())
+	}
+	require.True(t, UsesTOFU(TrustPinConfig{}, "docker.io/library/ubuntu"))
+}
+
+// generateTestCert creates a certificate for a new key, issued by the given
+// parent, or self-signed if there is no parent
+func generateTestCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template, err := utils.NewCertificate(cn, time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	// leave the extended key usage unset unless this is a notary leaf, so that
+	// the certificates also pass CA pinning, which checks for TLS usage
+	template.ExtKeyUsage = nil
+	if isCA {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(derBytes)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func writeTestChain(t *testing.T, dir, name string, chain ...*x509.Certificate) string {
+	chainPEM, err := utils.CertChainToPEM(chain)
+	require.NoError(t, err)
+	chainPath := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(chainPath, chainPEM, 0644))
+	return chainPath
+}
+
+// Chain pinning only accepts leaves issued through the exact pinned chain,
+// where CA pinning accepts any leaf chaining up to the root
+func TestChainPinning(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	rootCA, rootKey := generateTestCert(t, "root", true, nil, nil)
+	expectedInt, expectedIntKey := generateTestCert(t, "expected intermediate", true, rootCA, rootKey)
+	otherInt, otherIntKey := generateTestCert(t, "other intermediate", true, rootCA, rootKey)
+	goodLeaf, _ := generateTestCert(t, "docker.com/notary", false, expectedInt, expectedIntKey)
+	otherLeaf, _ := generateTestCert(t, "docker.com/notary", false, otherInt, otherIntKey)
+	rootLeaf, _ := generateTestCert(t, "docker.com/notary", false, rootCA, rootKey)
+
+	// leaf certificates as generated by notary are for code signing
+	codeSigningTemplate, err := utils.NewCertificate("docker.com/notary", time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	derBytes, err := x509.CreateCertificate(rand.Reader, codeSigningTemplate, expectedInt, leafKey.Public(), expectedIntKey)
+	require.NoError(t, err)
+	codeSigningLeaf, err := x509.ParseCertificate(derBytes)
+	require.NoError(t, err)
+
+	chainPath := writeTestChain(t, tempDir, "chain.crt", expectedInt, rootCA)
+	rootPath := writeTestChain(t, tempDir, "root.crt", rootCA)
+
+	checker, err := NewTrustPinChecker(TrustPinConfig{Chain: map[string]string{"docker.com/": chainPath}}, "docker.com/notary", true)
+	require.NoError(t, err)
+	require.True(t, checker(goodLeaf, []*x509.Certificate{expectedInt}))
+	// the intermediates bundled with the leaf are not needed
+	require.True(t, checker(goodLeaf, nil))
+	require.True(t, checker(codeSigningLeaf, nil))
+	// a leaf from a different intermediate under the same root is rejected,
+	// even if that intermediate is bundled with the leaf
+	require.False(t, checker(otherLeaf, []*x509.Certificate{otherInt}))
+	require.False(t, checker(otherLeaf, []*x509.Certificate{otherInt, expectedInt}))
+	// as is a leaf issued directly by the root
+	require.False(t, checker(rootLeaf, nil))
+
+	// by comparison, CA pinning accepts any leaf under the root
+	checker, err = NewTrustPinChecker(TrustPinConfig{CA: map[string]string{"docker.com/": rootPath}}, "docker.com/notary", true)
+	require.NoError(t, err)
+	require.True(t, checker(goodLeaf, []*x509.Certificate{expectedInt}))
+	require.True(t, checker(otherLeaf, []*x509.Certificate{otherInt}))
+
+	// chain pinning takes precedence over CA pinning
+	checker, err = NewTrustPinChecker(TrustPinConfig{
+		Chain: map[string]string{"docker.com/": chainPath},
+		CA:    map[string]string{"docker.com/": rootPath},
+	}, "docker.com/notary", true)
+	require.NoError(t, err)
+	require.False(t, checker(otherLeaf, []*x509.Certificate{otherInt}))
+
+	// a chain pinned for a different GUN prefix is not used
+	checker, err = NewTrustPinChecker(TrustPinConfig{
+		Chain: map[string]string{"docker.io/": chainPath},
+		CA:    map[string]string{"docker.com/": rootPath},
+	}, "docker.com/notary", true)
+	require.NoError(t, err)
+	require.True(t, checker(otherLeaf, []*x509.Certificate{otherInt}))
+}
+
+func TestChainPinningInvalidChain(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	rootCA, rootKey := generateTestCert(t, "root", true, nil, nil)
+	otherRootCA, _ := generateTestCert(t, "other root", true, nil, nil)
+	intermediate, _ := generateTestCert(t, "intermediate", true, rootCA, rootKey)
+	leaf, _ := generateTestCert(t, "leaf", false, rootCA, rootKey)
+
+	for name, chain := range map[string][]*x509.Certificate{
+		"wrong_order.crt": {rootCA, intermediate},
+		"wrong_root.crt":  {intermediate, otherRootCA},
+		"not_ca.crt":      {leaf, rootCA},
+	} {
+		chainPath := writeTestChain(t, tempDir, name, chain...)
+		_, err := NewTrustPinChecker(TrustPinConfig{Chain: map[string]string{"gun": chainPath}}, "gun", true)
+		require.Error(t, err, name)
+	}
+
+	_, err = NewTrustPinChecker(TrustPinConfig{Chain: map[string]string{"gun": filepath.Join(tempDir, "missing.crt")}}, "gun", true)
+	require.Error(t, err)
+}
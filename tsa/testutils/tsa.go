@@ -0,0 +1,201 @@
+package testutils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/theupdateframework/notary/tsa"
+)
+
+var oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+
+// FakeTSA is an in-process timestamping authority which grants every request,
+// signing tokens with a freshly generated self-signed certificate
+type FakeTSA struct {
+	Cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// Now returns the time to put in tokens, or time.Now if nil
+	Now func() time.Time
+	// SignatureAlgorithm is the signature algorithm claimed in tokens, or
+	// ecdsa-with-SHA256 if nil.  Tokens are always signed with ECDSA and
+	// SHA-256, whichever algorithm is claimed.
+	SignatureAlgorithm asn1.ObjectIdentifier
+}
+
+// NewFakeTSA generates a new fake timestamping authority
+func NewFakeTSA() (*FakeTSA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now().Add(-time.Hour)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake TSA"},
+		NotBefore:             start,
+		NotAfter:              start.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &FakeTSA{Cert: cert, key: key}, nil
+}
+
+// Roots returns a certificate pool containing the fake TSA's certificate
+func (f *FakeTSA) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(f.Cert)
+	return pool
+}
+
+// Token returns a DER encoded timestamp token for the SHA-256 digest
+func (f *FakeTSA) Token(digest []byte) ([]byte, error) {
+	now := time.Now
+	if f.Now != nil {
+		now = f.Now
+	}
+	info, err := asn1.Marshal(tsa.TSTInfo{
+		Version: 1,
+		Policy:  asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: tsa.MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: tsa.OIDSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		SerialNumber: big.NewInt(now().UnixNano()),
+		GenTime:      now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infoDigest := sha256.Sum256(info)
+	signedAttrs, err := marshalAttributes(
+		attribute{tsa.OIDContentType, tsa.OIDTSTInfo},
+		attribute{tsa.OIDMessageDigest, infoDigest[:]},
+	)
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(signedAttrs)
+	sig, err := ecdsa.SignASN1(rand.Reader, f.key, attrsDigest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(struct {
+		Issuer       asn1.RawValue
+		SerialNumber *big.Int
+	}{asn1.RawValue{FullBytes: f.Cert.RawIssuer}, f.Cert.SerialNumber})
+	if err != nil {
+		return nil, err
+	}
+	sha256Algo := pkix.AlgorithmIdentifier{Algorithm: tsa.OIDSHA256, Parameters: asn1.NullRawValue}
+	sigAlgo := f.SignatureAlgorithm
+	if sigAlgo == nil {
+		sigAlgo = oidECDSAWithSHA256
+	}
+	signedData, err := asn1.Marshal(tsa.SignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algo},
+		EncapContentInfo: tsa.EncapsulatedContentInfo{EContentType: tsa.OIDTSTInfo, EContent: info},
+		Certificates: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: f.Cert.Raw,
+		},
+		SignerInfos: []tsa.SignerInfo{{
+			Version:         1,
+			SID:             asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm: sha256Algo,
+			// the signed attributes carry an implicit [0] tag in the SignerInfo
+			SignedAttrs:        asn1.RawValue{FullBytes: append([]byte{0xa0}, signedAttrs[1:]...)},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlgo},
+			Signature:          sig,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(tsa.ContentInfo{
+		ContentType: tsa.OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// ServeHTTP answers RFC 3161 timestamp requests
+func (f *FakeTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req tsa.Request
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token, err := f.Token(req.MessageImprint.HashedMessage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := asn1.Marshal(tsa.Response{
+		Status:         tsa.PKIStatusInfo{Status: 0},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", tsa.ResponseContentType)
+	w.Write(resp)
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// marshalAttributes DER encodes the attributes as a SET OF Attribute, sorted
+// by their encodings as DER requires
+func marshalAttributes(attrs ...attribute) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attrs))
+	for _, a := range attrs {
+		value, err := asn1.Marshal(a.Value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(tsa.Attribute{
+			Type:   a.Type,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attr)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	var content []byte
+	for _, e := range encoded {
+		content = append(content, e...)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: content})
+}
@@ -0,0 +1,452 @@
+// Package tsa implements the subset of RFC 3161 needed to obtain timestamp
+// tokens from an external timestamping authority (TSA), and to verify them.
+//
+// A timestamp token is a CMS SignedData structure (RFC 5652), signed by the
+// TSA, whose content is a TSTInfo structure recording the time at which the
+// TSA saw a particular digest:
+//
+//	TSTInfo ::= SEQUENCE {
+//		version        INTEGER { v1(1) },
+//		policy         TSAPolicyId,
+//		messageImprint MessageImprint,
+//		serialNumber   INTEGER,
+//		genTime        GeneralizedTime,
+//		...
+//	}
+//
+// Only SHA-256 message imprints are requested, and only RSA and ECDSA signed
+// tokens with signed attributes can be verified.
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/docker/go/canonical/json"
+)
+
+const (
+	// RequestContentType is the content type of a timestamp request
+	RequestContentType = "application/timestamp-query"
+	// ResponseContentType is the content type of a timestamp response
+	ResponseContentType = "application/timestamp-reply"
+
+	// maxResponseSize is the maximum size of a timestamp response we will read
+	maxResponseSize = 1 << 20
+)
+
+// Object identifiers used in timestamp requests and tokens
+var (
+	OIDSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	OIDContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	OIDSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	OIDSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	OIDSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// MessageImprint is the digest being timestamped, and the hash algorithm used
+// to compute it
+type MessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// Request is a TimeStampReq
+type Request struct {
+	Version        int
+	MessageImprint MessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+// PKIStatusInfo is the status of a timestamp response
+type PKIStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+// Response is a TimeStampResp
+type Response struct {
+	Status         PKIStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// ContentInfo is the outer CMS structure of a timestamp token
+type ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// SignedData is the CMS signed data of a timestamp token
+type SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo EncapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []SignerInfo  `asn1:"set"`
+}
+
+// EncapsulatedContentInfo holds the DER encoded TSTInfo of a timestamp token
+type EncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+// SignerInfo is the signature of the TSA over a timestamp token
+type SignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// Attribute is a signed attribute of a SignerInfo
+type Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// IssuerAndSerialNumber identifies the certificate of the signer of a token
+type IssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// TSTInfo is the content of a timestamp token.  Only the fields up to genTime
+// are parsed, since those are the only ones that are used.
+type TSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint MessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// Client requests timestamp tokens from a timestamping authority over HTTP
+type Client struct {
+	// URL is the endpoint of the timestamping authority
+	URL string
+	// HTTPClient is used to make requests, or http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Timestamp requests a timestamp token for the SHA-256 digest from the
+// timestamping authority, returning the DER encoded token
+func (c *Client) Timestamp(digest []byte) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("expected a %d byte SHA-256 digest, got %d bytes", sha256.Size, len(digest))
+	}
+	req, err := asn1.Marshal(Request{
+		Version: 1,
+		MessageImprint: MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: OIDSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Post(c.URL, RequestContentType, bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach timestamping authority: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamping authority returned %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read timestamping authority response: %w", err)
+	}
+	return ParseResponse(body)
+}
+
+// ParseResponse parses a DER encoded timestamp response, returning the DER
+// encoded timestamp token if the request was granted
+func ParseResponse(der []byte) ([]byte, error) {
+	var resp Response
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, fmt.Errorf("malformed timestamp response: %w", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("malformed timestamp response: trailing data")
+	}
+	// 0 is granted, 1 is granted with modifications
+	if resp.Status.Status != 0 && resp.Status.Status != 1 {
+		return nil, fmt.Errorf("timestamp request rejected with status %d: %v", resp.Status.Status, resp.Status.StatusString)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("timestamp response does not contain a token")
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// Verify verifies that the DER encoded timestamp token is for the SHA-256
+// digest, and is signed by a timestamping authority whose certificate chains
+// up to one of the roots.  It returns the time asserted by the token.
+func Verify(token, digest []byte, roots *x509.CertPool) (time.Time, error) {
+	var ci ContentInfo
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp token: %w", err)
+	} else if len(rest) > 0 {
+		return time.Time{}, errors.New("malformed timestamp token: trailing data")
+	}
+	if !ci.ContentType.Equal(OIDSignedData) {
+		return time.Time{}, fmt.Errorf("timestamp token has unexpected content type %v", ci.ContentType)
+	}
+	var sd SignedData
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp token signed data: %w", err)
+	} else if len(rest) > 0 {
+		return time.Time{}, errors.New("malformed timestamp token signed data: trailing data")
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(OIDTSTInfo) {
+		return time.Time{}, fmt.Errorf("timestamp token has unexpected content type %v", sd.EncapContentInfo.EContentType)
+	}
+	var info TSTInfo
+	if rest, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp token info: %w", err)
+	} else if len(rest) > 0 {
+		return time.Time{}, errors.New("malformed timestamp token info: trailing data")
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(OIDSHA256) ||
+		!bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return time.Time{}, errors.New("timestamp token is not for the expected digest")
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp token certificates: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return time.Time{}, fmt.Errorf("expected one timestamp token signer, found %d", len(sd.SignerInfos))
+	}
+	signer := sd.SignerInfos[0]
+	cert, err := findSignerCert(signer.SID, certs)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifySignerInfo(signer, cert, sd.EncapContentInfo.EContent); err != nil {
+		return time.Time{}, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		if c != cert {
+			intermediates.AddCert(c)
+		}
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("untrusted timestamping authority: %w", err)
+	}
+	return info.GenTime, nil
+}
+
+// findSignerCert returns the certificate identified by the signer ID, which is
+// either an IssuerAndSerialNumber or a [0] tagged subject key identifier
+func findSignerCert(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("timestamp token does not contain the signer certificate")
+	}
+	var ias IssuerAndSerialNumber
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("malformed timestamp token signer identifier: %w", err)
+	}
+	for _, c := range certs {
+		if c.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) {
+			return c, nil
+		}
+	}
+	return nil, errors.New("timestamp token does not contain the signer certificate")
+}
+
+// verifySignerInfo checks that the signed attributes carry the digest of the
+// content, and that the signature over the signed attributes is valid
+func verifySignerInfo(signer SignerInfo, cert *x509.Certificate, content []byte) error {
+	hash, err := hashForOID(signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	algo, err := signatureAlgorithm(hash, signer.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if len(signer.SignedAttrs.FullBytes) == 0 {
+		return errors.New("timestamp token has no signed attributes")
+	}
+	// the signature is over the DER encoding of the signed attributes as a SET,
+	// rather than with the implicit [0] tag they carry in the SignerInfo
+	signedAttrs := append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+	var attrs []Attribute
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		return fmt.Errorf("malformed timestamp token signed attributes: %w", err)
+	}
+
+	var contentType asn1.ObjectIdentifier
+	var messageDigest []byte
+	for _, attr := range attrs {
+		switch {
+		case attr.Type.Equal(OIDContentType):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &contentType); err != nil {
+				return fmt.Errorf("malformed timestamp token content type attribute: %w", err)
+			}
+		case attr.Type.Equal(OIDMessageDigest):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &messageDigest); err != nil {
+				return fmt.Errorf("malformed timestamp token message digest attribute: %w", err)
+			}
+		}
+	}
+	if !contentType.Equal(OIDTSTInfo) {
+		return errors.New("timestamp token signed attributes have the wrong content type")
+	}
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(h.Sum(nil), messageDigest) {
+		return errors.New("timestamp token content does not match its signed digest")
+	}
+
+	if err := cert.CheckSignature(algo, signedAttrs, signer.Signature); err != nil {
+		return fmt.Errorf("invalid timestamp token signature: %w", err)
+	}
+	return nil
+}
+
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(OIDSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(OIDSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(OIDSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported timestamp token digest algorithm %v", oid)
+}
+
+var (
+	rsaSignatureAlgorithms = map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.SHA256WithRSA,
+		crypto.SHA384: x509.SHA384WithRSA,
+		crypto.SHA512: x509.SHA512WithRSA,
+	}
+	ecdsaSignatureAlgorithms = map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.ECDSAWithSHA256,
+		crypto.SHA384: x509.ECDSAWithSHA384,
+		crypto.SHA512: x509.ECDSAWithSHA512,
+	}
+)
+
+// signatureAlgorithm returns the algorithm of a signature made with the digest
+// algorithm.  Only the bare rsaEncryption and id-ecPublicKey OIDs take their
+// hash from the digest algorithm: the others name their own, which must be the
+// same one.
+func signatureAlgorithm(hash crypto.Hash, oid asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	var (
+		named crypto.Hash
+		algos = rsaSignatureAlgorithms
+	)
+	switch {
+	case oid.Equal(oidRSAEncryption):
+		named = hash
+	case oid.Equal(oidSHA256WithRSA):
+		named = crypto.SHA256
+	case oid.Equal(oidSHA384WithRSA):
+		named = crypto.SHA384
+	case oid.Equal(oidSHA512WithRSA):
+		named = crypto.SHA512
+	case oid.Equal(oidECPublicKey):
+		named, algos = hash, ecdsaSignatureAlgorithms
+	case oid.Equal(oidECDSAWithSHA256):
+		named, algos = crypto.SHA256, ecdsaSignatureAlgorithms
+	case oid.Equal(oidECDSAWithSHA384):
+		named, algos = crypto.SHA384, ecdsaSignatureAlgorithms
+	case oid.Equal(oidECDSAWithSHA512):
+		named, algos = crypto.SHA512, ecdsaSignatureAlgorithms
+	}
+	algo, ok := algos[named]
+	if !ok {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported timestamp token signature algorithm %v", oid)
+	}
+	if named != hash {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("timestamp token signature algorithm %v does not match its digest algorithm %v", oid, hash)
+	}
+	return algo, nil
+}
+
+// CustomKey is the key under which a timestamp token is stored in the custom
+// data of the snapshot metadata in a timestamp
+const CustomKey = "tsa_token"
+
+// NewCustom returns custom metadata carrying the timestamp token
+func NewCustom(token []byte) (*json.RawMessage, error) {
+	custom, err := json.MarshalCanonical(map[string][]byte{CustomKey: token})
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(custom)
+	return &raw, nil
+}
+
+// TokenFromCustom returns the timestamp token carried in the custom metadata
+func TokenFromCustom(custom *json.RawMessage) ([]byte, error) {
+	if custom == nil {
+		return nil, errors.New("no timestamp token present")
+	}
+	var fields map[string]*json.RawMessage
+	if err := json.Unmarshal(*custom, &fields); err != nil {
+		return nil, fmt.Errorf("malformed custom metadata: %w", err)
+	}
+	if fields[CustomKey] == nil {
+		return nil, errors.New("no timestamp token present")
+	}
+	var token []byte
+	if err := json.Unmarshal(*fields[CustomKey], &token); err != nil {
+		return nil, fmt.Errorf("malformed timestamp token: %w", err)
+	}
+	return token, nil
+}
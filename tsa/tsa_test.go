@@ -0,0 +1,181 @@
+package tsa_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tsa"
+	"github.com/theupdateframework/notary/tsa/testutils"
+)
+
+func TestTimestampAndVerify(t *testing.T) {
+	fake, err := testutils.NewFakeTSA()
+	require.NoError(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	fake.Now = func() time.Time { return now }
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	digest := sha256.Sum256([]byte("snapshot"))
+	client := &tsa.Client{URL: server.URL}
+	token, err := client.Timestamp(digest[:])
+	require.NoError(t, err)
+
+	genTime, err := tsa.Verify(token, digest[:], fake.Roots())
+	require.NoError(t, err)
+	require.True(t, now.Equal(genTime))
+
+	// the token does not cover a different digest
+	other := sha256.Sum256([]byte("other snapshot"))
+	_, err = tsa.Verify(token, other[:], fake.Roots())
+	require.Error(t, err)
+
+	// nor is it trusted if the TSA's certificate isn't
+	otherTSA, err := testutils.NewFakeTSA()
+	require.NoError(t, err)
+	_, err = tsa.Verify(token, digest[:], otherTSA.Roots())
+	require.Error(t, err)
+	_, err = tsa.Verify(token, digest[:], x509.NewCertPool())
+	require.Error(t, err)
+}
+
+func TestVerifyRejectsTamperedToken(t *testing.T) {
+	fake, err := testutils.NewFakeTSA()
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("snapshot"))
+	token, err := fake.Token(digest[:])
+	require.NoError(t, err)
+
+	tamper := func(i int) []byte {
+		tampered := append([]byte{}, token...)
+		tampered[i] ^= 0xff
+		return tampered
+	}
+
+	// the message imprint is covered by the signature, so it can't be swapped
+	// for a different digest
+	i := bytes.Index(token, digest[:])
+	require.True(t, i > 0)
+	otherDigest := append([]byte{}, digest[:]...)
+	otherDigest[0] ^= 0xff
+	_, err = tsa.Verify(tamper(i), otherDigest, fake.Roots())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not match its signed digest")
+
+	// and the signature, which is the last thing in the token, must be valid
+	_, err = tsa.Verify(tamper(len(token)-1), digest[:], fake.Roots())
+	require.Error(t, err)
+
+	_, err = tsa.Verify(token[:len(token)/2], digest[:], fake.Roots())
+	require.Error(t, err)
+}
+
+func TestVerifyRejectsTrailingData(t *testing.T) {
+	fake, err := testutils.NewFakeTSA()
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("snapshot"))
+	token, err := fake.Token(digest[:])
+	require.NoError(t, err)
+	_, err = tsa.Verify(token, digest[:], fake.Roots())
+	require.NoError(t, err)
+
+	// after the token
+	_, err = tsa.Verify(append(token, 0x05, 0x00), digest[:], fake.Roots())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "trailing data")
+
+	// after the signed data within the token, which the signature doesn't cover
+	var ci tsa.ContentInfo
+	_, err = asn1.Unmarshal(token, &ci)
+	require.NoError(t, err)
+	padded, err := asn1.Marshal(tsa.ContentInfo{
+		ContentType: ci.ContentType,
+		Content: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true,
+			Bytes: append(append([]byte{}, ci.Content.Bytes...), 0x05, 0x00),
+		},
+	})
+	require.NoError(t, err)
+	_, err = tsa.Verify(padded, digest[:], fake.Roots())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "trailing data")
+}
+
+func TestVerifySignatureAlgorithmMatchesDigestAlgorithm(t *testing.T) {
+	fake, err := testutils.NewFakeTSA()
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("snapshot"))
+
+	// tokens are signed with SHA-256, which the bare id-ecPublicKey OID takes
+	// from the digest algorithm
+	for _, oid := range []asn1.ObjectIdentifier{
+		{1, 2, 840, 10045, 4, 3, 2}, // ecdsa-with-SHA256
+		{1, 2, 840, 10045, 2, 1},    // id-ecPublicKey
+	} {
+		fake.SignatureAlgorithm = oid
+		token, err := fake.Token(digest[:])
+		require.NoError(t, err)
+		_, err = tsa.Verify(token, digest[:], fake.Roots())
+		require.NoError(t, err)
+	}
+
+	// but an algorithm naming another hash does not match the digest algorithm
+	for _, oid := range []asn1.ObjectIdentifier{
+		{1, 2, 840, 10045, 4, 3, 3},   // ecdsa-with-SHA384
+		{1, 2, 840, 10045, 4, 3, 4},   // ecdsa-with-SHA512
+		{1, 2, 840, 113549, 1, 1, 12}, // sha384WithRSAEncryption
+	} {
+		fake.SignatureAlgorithm = oid
+		token, err := fake.Token(digest[:])
+		require.NoError(t, err)
+		_, err = tsa.Verify(token, digest[:], fake.Roots())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not match its digest algorithm")
+	}
+}
+
+func TestTimestampErrors(t *testing.T) {
+	digest := sha256.Sum256([]byte("snapshot"))
+
+	// wrong digest size
+	_, err := (&tsa.Client{URL: "http://localhost"}).Timestamp(digest[:20])
+	require.Error(t, err)
+
+	// the TSA returns an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusInternalServerError)
+	}))
+	_, err = (&tsa.Client{URL: server.URL}).Timestamp(digest[:])
+	require.Error(t, err)
+
+	// the TSA is unreachable
+	server.Close()
+	_, err = (&tsa.Client{URL: server.URL}).Timestamp(digest[:])
+	require.Error(t, err)
+
+	// the TSA returns garbage
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a timestamp response"))
+	}))
+	defer server.Close()
+	_, err = (&tsa.Client{URL: server.URL}).Timestamp(digest[:])
+	require.Error(t, err)
+}
+
+func TestCustomRoundTrip(t *testing.T) {
+	custom, err := tsa.NewCustom([]byte("token"))
+	require.NoError(t, err)
+	token, err := tsa.TokenFromCustom(custom)
+	require.NoError(t, err)
+	require.Equal(t, []byte("token"), token)
+
+	_, err = tsa.TokenFromCustom(nil)
+	require.Error(t, err)
+}
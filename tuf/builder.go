@@ -2,6 +2,7 @@ package tuf
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/docker/go/canonical/json"
 	"github.com/theupdateframework/notary"
@@ -60,6 +61,10 @@ type RepoBuilder interface {
 	LoadRootForUpdate(content []byte, minVersion int, isFinal bool) error
 	GenerateSnapshot(prev *data.SignedSnapshot) ([]byte, int, error)
 	GenerateTimestamp(prev *data.SignedTimestamp) ([]byte, int, error)
+	GenerateTimestampWithCustom(prev *data.SignedTimestamp, snapshotCustom func(data.FileMeta) (*json.RawMessage, error)) ([]byte, int, error)
+	SetExpiry(roleName data.RoleName, validity time.Duration)
+	SetSignatureAlgorithms(policy signed.AlgorithmPolicy)
+	SetClock(clock data.Clock)
 	Finish() (*Repo, *Repo, error)
 	BootstrapNewBuilder() RepoBuilder
 	BootstrapNewBuilderWithNewTrustpin(trustpin trustpinning.TrustPinConfig) RepoBuilder
@@ -85,6 +90,15 @@ func (f finishedBuilder) GenerateSnapshot(prev *data.SignedSnapshot) ([]byte, in
 func (f finishedBuilder) GenerateTimestamp(prev *data.SignedTimestamp) ([]byte, int, error) {
 	return nil, 0, ErrBuildDone
 }
+func (f finishedBuilder) GenerateTimestampWithCustom(prev *data.SignedTimestamp, snapshotCustom func(data.FileMeta) (*json.RawMessage, error)) ([]byte, int, error) {
+	return nil, 0, ErrBuildDone
+}
+func (f finishedBuilder) SetExpiry(roleName data.RoleName, validity time.Duration) {
+}
+func (f finishedBuilder) SetSignatureAlgorithms(policy signed.AlgorithmPolicy) {
+}
+func (f finishedBuilder) SetClock(clock data.Clock) {
+}
 func (f finishedBuilder) Finish() (*Repo, *Repo, error)    { return nil, nil, ErrBuildDone }
 func (f finishedBuilder) BootstrapNewBuilder() RepoBuilder { return f }
 func (f finishedBuilder) BootstrapNewBuilderWithNewTrustpin(trustpin trustpinning.TrustPinConfig) RepoBuilder {
@@ -152,19 +166,79 @@ type repoBuilder struct {
 
 	// for bootstrapping the next builder
 	nextRootChecksum *data.FileMeta
+
+	// how long generated metadata is valid for, if not the default for the role
+	expiries map[data.RoleName]time.Duration
+
+	// tells the time that metadata is checked for expiry against, and that
+	// generated metadata is valid from
+	clock data.Clock
+}
+
+// SetExpiry sets how long the snapshot or timestamp generated for the given role
+// is valid for, instead of the default for the role.  A validity of zero
+// restores the default.
+func (rb *repoBuilder) SetExpiry(roleName data.RoleName, validity time.Duration) {
+	if validity <= 0 {
+		delete(rb.expiries, roleName)
+		return
+	}
+	if rb.expiries == nil {
+		rb.expiries = make(map[data.RoleName]time.Duration)
+	}
+	rb.expiries[roleName] = validity
+}
+
+// SetSignatureAlgorithms sets the signature algorithm that each role in the
+// policy must be signed with, both for the metadata loaded, which is rejected
+// if not enough of its valid signatures were made with the algorithm, and for
+// the metadata the built repo signs.
+func (rb *repoBuilder) SetSignatureAlgorithms(policy signed.AlgorithmPolicy) {
+	rb.repo.SetSignatureAlgorithms(policy)
+}
+
+// SetClock sets the clock which tells the time that loaded metadata is checked
+// for expiry against, and that generated metadata is valid from.  A nil clock
+// restores the real clock.
+func (rb *repoBuilder) SetClock(clock data.Clock) {
+	rb.clock = clock
+}
+
+func (rb *repoBuilder) now() time.Time {
+	if rb.clock == nil {
+		return time.Now()
+	}
+	return rb.clock.Now()
+}
+
+// expires returns the expiry time of metadata generated now for the given role
+func (rb *repoBuilder) expires(roleName data.RoleName) time.Time {
+	if validity, ok := rb.expiries[roleName]; ok {
+		return rb.now().Add(validity)
+	}
+	return data.DefaultExpiresAt(roleName, rb.now())
 }
 
 func (rb *repoBuilder) Finish() (*Repo, *Repo, error) {
 	return rb.repo, rb.invalidRoles, nil
 }
 
+// newRepo returns an empty repo for a bootstrapped builder, which keeps the
+// signature algorithm policy of this builder's repo
+func (rb *repoBuilder) newRepo() *Repo {
+	repo := NewRepo(rb.repo.cryptoService)
+	repo.SetSignatureAlgorithms(rb.repo.algorithms)
+	return repo
+}
+
 func (rb *repoBuilder) BootstrapNewBuilder() RepoBuilder {
 	return &repoBuilderWrapper{RepoBuilder: &repoBuilder{
-		repo:                 NewRepo(rb.repo.cryptoService),
+		repo:                 rb.newRepo(),
 		invalidRoles:         NewRepo(nil),
 		gun:                  rb.gun,
 		loadedNotChecksummed: make(map[data.RoleName][]byte),
 		trustpin:             rb.trustpin,
+		clock:                rb.clock,
 
 		prevRoot:                 rb.repo.Root,
 		bootstrappedRootChecksum: rb.nextRootChecksum,
@@ -173,10 +247,11 @@ func (rb *repoBuilder) BootstrapNewBuilder() RepoBuilder {
 
 func (rb *repoBuilder) BootstrapNewBuilderWithNewTrustpin(trustpin trustpinning.TrustPinConfig) RepoBuilder {
 	return &repoBuilderWrapper{RepoBuilder: &repoBuilder{
-		repo:                 NewRepo(rb.repo.cryptoService),
+		repo:                 rb.newRepo(),
 		gun:                  rb.gun,
 		loadedNotChecksummed: make(map[data.RoleName][]byte),
 		trustpin:             trustpin,
+		clock:                rb.clock,
 
 		prevRoot:                 rb.repo.Root,
 		bootstrappedRootChecksum: rb.nextRootChecksum,
@@ -345,7 +420,7 @@ func (rb *repoBuilder) GenerateSnapshot(prev *data.SignedSnapshot) ([]byte, int,
 		rb.repo.Snapshot = prev
 	}
 
-	sgnd, err := rb.repo.SignSnapshot(data.DefaultExpires(data.CanonicalSnapshotRole))
+	sgnd, err := rb.repo.SignSnapshot(rb.expires(data.CanonicalSnapshotRole))
 	if err != nil {
 		rb.repo.Snapshot = nil
 		return nil, 0, err
@@ -378,6 +453,13 @@ func (rb *repoBuilder) GenerateSnapshot(prev *data.SignedSnapshot) ([]byte, int,
 // We can't just load the previous timestamp, because it may have been signed by a different
 // timestamp key (maybe from a previous root version)
 func (rb *repoBuilder) GenerateTimestamp(prev *data.SignedTimestamp) ([]byte, int, error) {
+	return rb.GenerateTimestampWithCustom(prev, nil)
+}
+
+// GenerateTimestampWithCustom generates a new timestamp given a previous (optional)
+// timestamp, calling snapshotCustom (if not nil) with the new snapshot metadata to
+// produce custom data to attach to it, e.g. a token from a timestamping authority
+func (rb *repoBuilder) GenerateTimestampWithCustom(prev *data.SignedTimestamp, snapshotCustom func(data.FileMeta) (*json.RawMessage, error)) ([]byte, int, error) {
 	switch {
 	case rb.repo.cryptoService == nil:
 		return nil, 0, ErrInvalidBuilderInput{msg: "cannot generate timestamp without a cryptoservice"}
@@ -404,7 +486,7 @@ func (rb *repoBuilder) GenerateTimestamp(prev *data.SignedTimestamp) ([]byte, in
 		rb.repo.Timestamp = prev
 	}
 
-	sgnd, err := rb.repo.SignTimestamp(data.DefaultExpires(data.CanonicalTimestampRole))
+	sgnd, err := rb.repo.SignTimestampWithCustom(rb.expires(data.CanonicalTimestampRole), snapshotCustom)
 	if err != nil {
 		rb.repo.Timestamp = nil
 		return nil, 0, err
@@ -439,7 +521,7 @@ func (rb *repoBuilder) loadRoot(content []byte, minVersion int, allowExpired, sk
 	// itself is self-consistent with its own signatures and thresholds.
 	// This assumes that ValidateRoot calls data.RootFromSigned, which validates
 	// the metadata, rather than just unmarshalling signedObject into a SignedRoot object itself.
-	signedRoot, err := trustpinning.ValidateRoot(rb.prevRoot, signedObj, rb.gun, rb.trustpin)
+	signedRoot, err := trustpinning.ValidateRootAt(rb.prevRoot, signedObj, rb.gun, rb.trustpin, rb.now())
 	if err != nil {
 		return err
 	}
@@ -449,7 +531,7 @@ func (rb *repoBuilder) loadRoot(content []byte, minVersion int, allowExpired, sk
 	}
 
 	if !allowExpired { // check must go at the end because all other validation should pass
-		if err := signed.VerifyExpiry(&(signedRoot.Signed.SignedCommon), roleName); err != nil {
+		if err := signed.VerifyExpiryAt(&(signedRoot.Signed.SignedCommon), roleName, rb.now()); err != nil {
 			return err
 		}
 	}
@@ -458,6 +540,9 @@ func (rb *repoBuilder) loadRoot(content []byte, minVersion int, allowExpired, sk
 	if err != nil { // this should never happen since the root has been validated
 		return err
 	}
+	if err := signed.VerifyAlgorithms(signedRoot.Signatures, rootRole, rb.repo.algorithms); err != nil {
+		return err
+	}
 	rb.repo.Root = signedRoot
 	rb.repo.originalRootRole = rootRole
 	return nil
@@ -486,7 +571,7 @@ func (rb *repoBuilder) loadTimestamp(content []byte, minVersion int, allowExpire
 	}
 
 	if !allowExpired { // check must go at the end because all other validation should pass
-		if err := signed.VerifyExpiry(&(signedTimestamp.Signed.SignedCommon), roleName); err != nil {
+		if err := signed.VerifyExpiryAt(&(signedTimestamp.Signed.SignedCommon), roleName, rb.now()); err != nil {
 			return err
 		}
 	}
@@ -522,7 +607,7 @@ func (rb *repoBuilder) loadSnapshot(content []byte, minVersion int, allowExpired
 	}
 
 	if !allowExpired { // check must go at the end because all other validation should pass
-		if err := signed.VerifyExpiry(&(signedSnapshot.Signed.SignedCommon), roleName); err != nil {
+		if err := signed.VerifyExpiryAt(&(signedSnapshot.Signed.SignedCommon), roleName, rb.now()); err != nil {
 			return err
 		}
 	}
@@ -565,7 +650,7 @@ func (rb *repoBuilder) loadTargets(content []byte, minVersion int, allowExpired
 	}
 
 	if !allowExpired { // check must go at the end because all other validation should pass
-		if err := signed.VerifyExpiry(&(signedTargets.Signed.SignedCommon), roleName); err != nil {
+		if err := signed.VerifyExpiryAt(&(signedTargets.Signed.SignedCommon), roleName, rb.now()); err != nil {
 			return err
 		}
 	}
@@ -602,9 +687,13 @@ func (rb *repoBuilder) loadDelegation(roleName data.RoleName, content []byte, mi
 		rb.invalidRoles.Targets[roleName] = signedTargets
 		return err
 	}
+	if err := signed.VerifyAlgorithms(signedObj.Signatures, delegationRole.BaseRole, rb.repo.algorithms); err != nil {
+		rb.invalidRoles.Targets[roleName] = signedTargets
+		return err
+	}
 
 	if !allowExpired { // check must go at the end because all other validation should pass
-		if err := signed.VerifyExpiry(&(signedTargets.Signed.SignedCommon), roleName); err != nil {
+		if err := signed.VerifyExpiryAt(&(signedTargets.Signed.SignedCommon), roleName, rb.now()); err != nil {
 			rb.invalidRoles.Targets[roleName] = signedTargets
 			return err
 		}
@@ -701,6 +790,9 @@ func (rb *repoBuilder) bytesToSignedAndValidateSigs(role data.BaseRole, content
 	if err := signed.VerifySignatures(signedObj, role); err != nil {
 		return nil, err
 	}
+	if err := signed.VerifyAlgorithms(signedObj.Signatures, role, rb.repo.algorithms); err != nil {
+		return nil, err
+	}
 
 	return signedObj, nil
 }
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary"
@@ -402,6 +403,113 @@ func TestGenerateSnapshotInvalidOperations(t *testing.T) {
 	require.False(t, builder.IsLoaded(data.CanonicalSnapshotRole))
 }
 
+// Generated snapshots and timestamps expire after the validity set for their
+// role, or the default for the role if none is set
+func TestGenerateWithExpiry(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	meta, err := testutils.SignAndSerialize(repo)
+	require.NoError(t, err)
+
+	for _, validity := range []time.Duration{0, 2 * time.Hour} {
+		builder := tuf.NewRepoBuilder(gun, cs, trustpinning.TrustPinConfig{})
+		require.NoError(t, builder.Load(data.CanonicalRootRole, meta[data.CanonicalRootRole], 1, false))
+		require.NoError(t, builder.Load(data.CanonicalTargetsRole, meta[data.CanonicalTargetsRole], 1, false))
+		builder.SetExpiry(data.CanonicalSnapshotRole, 3*validity)
+		builder.SetExpiry(data.CanonicalTimestampRole, validity)
+
+		snapshotJSON, _, err := builder.GenerateSnapshot(nil)
+		require.NoError(t, err)
+		timestampJSON, _, err := builder.GenerateTimestamp(nil)
+		require.NoError(t, err)
+
+		for role, generated := range map[data.RoleName][]byte{
+			data.CanonicalSnapshotRole:  snapshotJSON,
+			data.CanonicalTimestampRole: timestampJSON,
+		} {
+			signedMeta := &data.SignedMeta{}
+			require.NoError(t, json.Unmarshal(generated, signedMeta))
+			expected := data.DefaultExpires(role)
+			if validity != 0 && role == data.CanonicalSnapshotRole {
+				expected = time.Now().Add(3 * validity)
+			} else if validity != 0 {
+				expected = time.Now().Add(validity)
+			}
+			require.WithinDuration(t, expected, signedMeta.Signed.Expires, time.Minute, role.String())
+		}
+	}
+}
+
+// Loaded metadata is checked for expiry against, and generated metadata is
+// valid from, the time told by the builder's clock, which is kept by the
+// builders bootstrapped from it
+func TestBuilderClock(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	meta, err := testutils.SignAndSerialize(repo)
+	require.NoError(t, err)
+	targets := &data.SignedTargets{}
+	require.NoError(t, json.Unmarshal(meta[data.CanonicalTargetsRole], targets))
+	expires := targets.Signed.Expires
+
+	for _, testCase := range []struct {
+		now     time.Time
+		expired bool
+	}{
+		{now: expires.Add(-time.Second), expired: false},
+		{now: expires.Add(time.Second), expired: true},
+	} {
+		builder := tuf.NewRepoBuilder(gun, cs, trustpinning.TrustPinConfig{})
+		builder.SetClock(data.FixedClock(testCase.now))
+		builder = builder.BootstrapNewBuilder()
+		require.NoError(t, builder.Load(data.CanonicalRootRole, meta[data.CanonicalRootRole], 1, false))
+		err := builder.Load(data.CanonicalTargetsRole, meta[data.CanonicalTargetsRole], 1, false)
+		if testCase.expired {
+			require.IsType(t, signed.ErrExpired{}, err)
+			continue
+		}
+		require.NoError(t, err)
+
+		snapshotJSON, _, err := builder.GenerateSnapshot(nil)
+		require.NoError(t, err)
+		snapshot := &data.SignedSnapshot{}
+		require.NoError(t, json.Unmarshal(snapshotJSON, snapshot))
+		require.True(t, data.DefaultExpiresAt(data.CanonicalSnapshotRole, testCase.now).Equal(snapshot.Signed.Expires))
+	}
+}
+
+// The root's certificates are checked for expiry against the time told by the
+// builder's clock, even if the root metadata itself may be expired
+func TestBuilderClockRootCertExpiry(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	meta, err := testutils.SignAndSerialize(repo)
+	require.NoError(t, err)
+	rootKeyID := repo.Root.Signed.Roles[data.CanonicalRootRole].KeyIDs[0]
+	cert, err := utils.LoadCertFromPEM(repo.Root.Signed.Keys[rootKeyID].Public())
+	require.NoError(t, err)
+
+	for _, testCase := range []struct {
+		now     time.Time
+		expired bool
+	}{
+		{now: cert.NotAfter.Add(-time.Second), expired: false},
+		{now: cert.NotAfter.Add(time.Second), expired: true},
+	} {
+		builder := tuf.NewRepoBuilder(gun, cs, trustpinning.TrustPinConfig{})
+		builder.SetClock(data.FixedClock(testCase.now))
+		err := builder.Load(data.CanonicalRootRole, meta[data.CanonicalRootRole], 1, true)
+		if testCase.expired {
+			require.IsType(t, &trustpinning.ErrValidationFail{}, err)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+}
+
 // Test the cases in which GenerateTimestamp fails
 func TestGenerateTimestampInvalidOperations(t *testing.T) {
 	var gun data.GUN = "docker.com/notary"
@@ -0,0 +1,25 @@
+package data
+
+import "time"
+
+// Clock tells the time that metadata is checked for expiry against, and that
+// newly signed metadata is valid from
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the default Clock, which tells the current time
+type RealClock struct{}
+
+// Now returns the current time
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a Clock which always tells the same time, for testing
+type FixedClock time.Time
+
+// Now returns the fixed time
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
@@ -0,0 +1,20 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedClock(t *testing.T) {
+	fixed := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, fixed, FixedClock(fixed).Now())
+	require.WithinDuration(t, time.Now(), RealClock{}.Now(), time.Minute)
+}
+
+func TestDefaultExpiresAt(t *testing.T) {
+	now := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, now.Add(defaultExpiryTimes[CanonicalTimestampRole]), DefaultExpiresAt(CanonicalTimestampRole, now))
+	require.True(t, DefaultExpiresAt("unknown", now).IsZero())
+}
@@ -31,6 +31,17 @@ func (e ErrInvalidChecksum) Error() string {
 	return fmt.Sprintf("%s checksum invalid", e.alg)
 }
 
+// ErrMissingChecksum is the error to be returned when a checksum which is
+// required is not provided
+type ErrMissingChecksum struct {
+	alg  string
+	name string
+}
+
+func (e ErrMissingChecksum) Error() string {
+	return fmt.Sprintf("no %s checksum was provided for %s", e.alg, e.name)
+}
+
 // ErrMismatchedChecksum is the error to be returned when checksum is mismatched
 type ErrMismatchedChecksum struct {
 	alg      string
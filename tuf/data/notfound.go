@@ -0,0 +1,67 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/go/canonical/json"
+)
+
+// NotFoundType is the type of a NotFound statement
+const NotFoundType = "NotFound"
+
+// SignedNotFound is a fully unpacked statement by a server that it holds no
+// trust data for a GUN
+type SignedNotFound struct {
+	Signatures []Signature
+	Signed     NotFound
+}
+
+// NotFound is the Signed component of a server's statement that it holds no
+// trust data for a GUN.  Nonce echoes the nonce the client sent with its
+// request, so that a statement can't be replayed once the GUN exists.
+type NotFound struct {
+	Type  string    `json:"_type"`
+	GUN   GUN       `json:"gun"`
+	Nonce string    `json:"nonce,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// ToSigned partially serializes a SignedNotFound for further signing
+func (nf *SignedNotFound) ToSigned() (*Signed, error) {
+	s, err := defaultSerializer.MarshalCanonical(nf.Signed)
+	if err != nil {
+		return nil, err
+	}
+	signed := json.RawMessage{}
+	if err := signed.UnmarshalJSON(s); err != nil {
+		return nil, err
+	}
+	sigs := make([]Signature, len(nf.Signatures))
+	copy(sigs, nf.Signatures)
+	return &Signed{
+		Signatures: sigs,
+		Signed:     &signed,
+	}, nil
+}
+
+// NotFoundFromSigned fully unpacks a Signed object into a SignedNotFound,
+// checking its type but not its signatures
+func NotFoundFromSigned(s *Signed) (*SignedNotFound, error) {
+	if s.Signed == nil {
+		return nil, fmt.Errorf("not-found statement has no signed content")
+	}
+	nf := NotFound{}
+	if err := defaultSerializer.Unmarshal(*s.Signed, &nf); err != nil {
+		return nil, err
+	}
+	if nf.Type != NotFoundType {
+		return nil, fmt.Errorf("expected type %s, not %s", NotFoundType, nf.Type)
+	}
+	sigs := make([]Signature, len(s.Signatures))
+	copy(sigs, s.Signatures)
+	return &SignedNotFound{
+		Signatures: sigs,
+		Signed:     nf,
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/docker/go/canonical/json"
 	"github.com/sirupsen/logrus"
 )
 
@@ -252,8 +253,9 @@ type RootRole struct {
 // Eventually should only be used for immediately before and after serialization/deserialization
 type Role struct {
 	RootRole
-	Name  RoleName `json:"name"`
-	Paths []string `json:"paths,omitempty"`
+	Name   RoleName         `json:"name"`
+	Paths  []string         `json:"paths,omitempty"`
+	Custom *json.RawMessage `json:"custom,omitempty"`
 }
 
 // NewRole creates a new Role object from the given parameters
@@ -12,11 +12,14 @@ import (
 	"io/ioutil"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/go/canonical/json"
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
 )
 
 // GUN is a Globally Unique Name. It is used to identify trust collections.
@@ -176,6 +179,73 @@ type Hashes map[string][]byte
 // NotaryDefaultHashes contains the default supported hash algorithms.
 var NotaryDefaultHashes = []string{notary.SHA256, notary.SHA512}
 
+type hashAlgorithm struct {
+	size int
+	sum  func([]byte) []byte
+}
+
+var (
+	hashFactoriesMu sync.RWMutex
+	hashFactories   = map[string]func() hash.Hash{
+		notary.SHA256: sha256.New,
+		notary.SHA512: sha512.New,
+	}
+)
+
+// SetHashFactory replaces the implementation of the sha256 or sha512 hash
+// used to compute and verify the checksums of targets and metadata, such as
+// with one which offloads hashing to hardware.  It should be called at
+// startup, before any checksums are computed.  A nil factory restores the
+// standard library implementation.
+func SetHashFactory(algorithm string, factory func() hash.Hash) error {
+	var standard func() hash.Hash
+	switch algorithm {
+	case notary.SHA256:
+		standard = sha256.New
+	case notary.SHA512:
+		standard = sha512.New
+	default:
+		return fmt.Errorf("hash implementation of %s cannot be replaced", algorithm)
+	}
+	if factory == nil {
+		factory = standard
+	}
+	hashFactoriesMu.Lock()
+	defer hashFactoriesMu.Unlock()
+	hashFactories[algorithm] = factory
+	return nil
+}
+
+// newHash returns a hash of the sha256 or sha512 algorithm from the factory
+// set by SetHashFactory
+func newHash(algorithm string) hash.Hash {
+	hashFactoriesMu.RLock()
+	defer hashFactoriesMu.RUnlock()
+	return hashFactories[algorithm]()
+}
+
+// sumWith returns the checksum of the payload with the sha256 or sha512 hash
+// set by SetHashFactory
+func sumWith(algorithm string) func([]byte) []byte {
+	return func(b []byte) []byte {
+		h := newHash(algorithm)
+		h.Write(b)
+		return h.Sum(nil)
+	}
+}
+
+// verifiableHashes are the hash algorithms whose checksums are verified.  Only
+// NotaryDefaultHashes are generated, but checksums with the others may have
+// been recorded by other tooling.
+var verifiableHashes = map[string]hashAlgorithm{
+	notary.SHA256:     {sha256.Size, sumWith(notary.SHA256)},
+	notary.SHA512:     {sha512.Size, sumWith(notary.SHA512)},
+	notary.SHA3_256:   {32, func(b []byte) []byte { s := sha3.Sum256(b); return s[:] }},
+	notary.SHA3_512:   {64, func(b []byte) []byte { s := sha3.Sum512(b); return s[:] }},
+	notary.BLAKE2b256: {blake2b.Size256, func(b []byte) []byte { s := blake2b.Sum256(b); return s[:] }},
+	notary.BLAKE2b512: {blake2b.Size, func(b []byte) []byte { s := blake2b.Sum512(b); return s[:] }},
+}
+
 // FileMeta contains the size and hashes for a metadata or target file. Custom
 // data can be optionally added.
 type FileMeta struct {
@@ -218,20 +288,14 @@ func CheckHashes(payload []byte, name string, hashes Hashes) error {
 
 	// k, v indicate the hash algorithm and the corresponding value
 	for k, v := range hashes {
-		switch k {
-		case notary.SHA256:
-			checksum := sha256.Sum256(payload)
-			if subtle.ConstantTimeCompare(checksum[:], v) == 0 {
-				return ErrMismatchedChecksum{alg: notary.SHA256, name: name, expected: hex.EncodeToString(v)}
-			}
-			cnt++
-		case notary.SHA512:
-			checksum := sha512.Sum512(payload)
-			if subtle.ConstantTimeCompare(checksum[:], v) == 0 {
-				return ErrMismatchedChecksum{alg: notary.SHA512, name: name, expected: hex.EncodeToString(v)}
-			}
-			cnt++
+		alg, ok := verifiableHashes[k]
+		if !ok {
+			continue
 		}
+		if subtle.ConstantTimeCompare(alg.sum(payload), v) == 0 {
+			return ErrMismatchedChecksum{alg: k, name: name, expected: hex.EncodeToString(v)}
+		}
+		cnt++
 	}
 
 	if cnt == 0 {
@@ -241,6 +305,33 @@ func CheckHashes(payload []byte, name string, hashes Hashes) error {
 	return nil
 }
 
+// CheckStrictHashes verifies that the hashes include a checksum for every
+// algorithm in NotaryDefaultHashes, and none for an algorithm which cannot be
+// verified, so that every checksum is checked by CheckHashes.
+func CheckStrictHashes(name string, hashes Hashes) error {
+	for _, alg := range NotaryDefaultHashes {
+		if _, ok := hashes[alg]; !ok {
+			return ErrMissingChecksum{alg: alg, name: name}
+		}
+	}
+	for alg := range hashes {
+		if _, ok := verifiableHashes[alg]; !ok {
+			return ErrInvalidChecksum{alg: alg}
+		}
+	}
+	return nil
+}
+
+// CheckHashesStrict verifies the checksums of the payload like CheckHashes, but
+// also requires the hashes to pass CheckStrictHashes, rather than only one
+// checksum to be for a supported algorithm.
+func CheckHashesStrict(payload []byte, name string, hashes Hashes) error {
+	if err := CheckStrictHashes(name, hashes); err != nil {
+		return err
+	}
+	return CheckHashes(payload, name, hashes)
+}
+
 // CompareMultiHashes verifies that the two Hashes passed in can represent the same data.
 // This means that both maps must have at least one key defined for which they map, and no conflicts.
 // Note that we check the intersection of map keys, which adds support for non-default hash algorithms in notary
@@ -281,18 +372,14 @@ func CheckValidHashStructures(hashes Hashes) error {
 	cnt := 0
 
 	for k, v := range hashes {
-		switch k {
-		case notary.SHA256:
-			if len(v) != sha256.Size {
-				return ErrInvalidChecksum{alg: notary.SHA256}
-			}
-			cnt++
-		case notary.SHA512:
-			if len(v) != sha512.Size {
-				return ErrInvalidChecksum{alg: notary.SHA512}
-			}
-			cnt++
+		alg, ok := verifiableHashes[k]
+		if !ok {
+			continue
 		}
+		if len(v) != alg.size {
+			return ErrInvalidChecksum{alg: k}
+		}
+		cnt++
 	}
 
 	if cnt == 0 {
@@ -312,10 +399,8 @@ func NewFileMeta(r io.Reader, hashAlgorithms ...string) (FileMeta, error) {
 	for _, hashAlgorithm := range hashAlgorithms {
 		var h hash.Hash
 		switch hashAlgorithm {
-		case notary.SHA256:
-			h = sha256.New()
-		case notary.SHA512:
-			h = sha512.New()
+		case notary.SHA256, notary.SHA512:
+			h = newHash(hashAlgorithm)
 		default:
 			return FileMeta{}, fmt.Errorf("unknown hash algorithm: %s", hashAlgorithm)
 		}
@@ -368,8 +453,14 @@ func SetDefaultExpiryTimes(times map[RoleName]time.Duration) {
 
 // DefaultExpires gets the default expiry time for the given role
 func DefaultExpires(role RoleName) time.Time {
+	return DefaultExpiresAt(role, time.Now())
+}
+
+// DefaultExpiresAt gets the default expiry time for the given role, counting
+// from the given time
+func DefaultExpiresAt(role RoleName, now time.Time) time.Time {
 	if d, ok := defaultExpiryTimes[role]; ok {
-		return time.Now().Add(d)
+		return now.Add(d)
 	}
 	var t time.Time
 	return t.UTC().Round(time.Second)
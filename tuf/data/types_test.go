@@ -2,7 +2,10 @@ package data
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"hash"
 	"strings"
 	"testing"
 
@@ -45,6 +48,60 @@ func TestGenerateFileMetaExplicit(t *testing.T) {
 	}
 }
 
+// countingHash is a hash which records how many times it is created and
+// written to
+type countingHash struct {
+	hash.Hash
+	writes *int
+}
+
+func (h countingHash) Write(p []byte) (int, error) {
+	*h.writes++
+	return h.Hash.Write(p)
+}
+
+// A hash implementation set with SetHashFactory is used to compute and verify
+// checksums, until the standard library implementation is restored
+func TestSetHashFactory(t *testing.T) {
+	created, writes := map[string]int{}, map[string]*int{}
+	wrap := func(algorithm string, factory func() hash.Hash) func() hash.Hash {
+		writes[algorithm] = new(int)
+		return func() hash.Hash {
+			created[algorithm]++
+			return countingHash{Hash: factory(), writes: writes[algorithm]}
+		}
+	}
+	require.NoError(t, SetHashFactory(notary.SHA256, wrap(notary.SHA256, sha256.New)))
+	require.NoError(t, SetHashFactory(notary.SHA512, wrap(notary.SHA512, sha512.New)))
+	defer func() {
+		require.NoError(t, SetHashFactory(notary.SHA256, nil))
+		require.NoError(t, SetHashFactory(notary.SHA512, nil))
+	}()
+
+	meta, err := NewFileMeta(bytes.NewReader([]byte("foo")), notary.SHA256, notary.SHA512)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{notary.SHA256: 1, notary.SHA512: 1}, created)
+	require.NotZero(t, *writes[notary.SHA256])
+	require.NotZero(t, *writes[notary.SHA512])
+	require.Equal(t, "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", hex.EncodeToString(meta.Hashes[notary.SHA256]))
+
+	require.NoError(t, CheckHashes([]byte("foo"), "foo", meta.Hashes))
+	require.Equal(t, map[string]int{notary.SHA256: 2, notary.SHA512: 2}, created)
+	require.Error(t, CheckHashes([]byte("bar"), "bar", meta.Hashes))
+
+	// only sha256 and sha512 can be replaced
+	require.Error(t, SetHashFactory(notary.SHA3_256, sha256.New))
+
+	// restoring the standard library implementation stops the wrapper being used
+	require.NoError(t, SetHashFactory(notary.SHA256, nil))
+	require.NoError(t, SetHashFactory(notary.SHA512, nil))
+	before := map[string]int{notary.SHA256: created[notary.SHA256], notary.SHA512: created[notary.SHA512]}
+	_, err = NewFileMeta(bytes.NewReader([]byte("foo")), notary.SHA256, notary.SHA512)
+	require.NoError(t, err)
+	require.NoError(t, CheckHashes([]byte("foo"), "foo", meta.Hashes))
+	require.Equal(t, before, created)
+}
+
 func TestSignatureUnmarshalJSON(t *testing.T) {
 	signatureJSON := `{"keyid":"97e8e1b51b6e7cf8720a56b5334bd8692ac5b28233c590b89fab0b0cd93eeedc","method":"RSA","sig":"2230cba525e4f5f8fc744f234221ca9a92924da4cc5faf69a778848882fcf7a20dbb57296add87f600891f2569a9c36706314c240f9361c60fd36f5a915a0e9712fc437b761e8f480868d7a4444724daa0d29a2669c0edbd4046046649a506b3d711d0aa5e70cb9d09dec7381e7de27a3168e77731e08f6ed56fcce2478855e837816fb69aff53412477748cd198dce783850080d37aeb929ad0f81460ebd31e61b772b6c7aa56977c787d4281fa45dbdefbb38d449eb5bccb2702964a52c78811545939712c8280dee0b23b2fa9fbbdd6a0c42476689ace655eba0745b4a21ba108bcd03ad00fdefff416dc74e08486a0538f8fd24989e1b9fc89e675141b7c"}`
 
@@ -141,6 +198,69 @@ func TestCheckHashes(t *testing.T) {
 		expected: "d13e2b60d74c2e6f4f449b5e536814edf9a4827f5a9f4f957fc92e77609b9c92"}, badChecksum)
 }
 
+// Checksums made by other tooling with SHA3 and BLAKE2b are verified too
+func TestCheckHashesVerifiesOtherAlgorithms(t *testing.T) {
+	raw := []byte("Bumblebee")
+	for alg, digest := range map[string]string{
+		notary.SHA3_256:   "01abc6e05a0b5adacaa670d95f458b4e317fb33a98501360ec6ac706627e8cc1",
+		notary.SHA3_512:   "66944a3c6586b6388d5fd046bb32d5488466d3c45e6e2448fb0714a4bc170cdf5fb30192fb7bb4f7b5a9af9f06428bc21d5256ac898c46420d7edf0fb2321ab1",
+		notary.BLAKE2b256: "b8faf4fcd106b2112faeda7bf6d974867cb530eecbd2eeb0b138a8631bc4dd91",
+		notary.BLAKE2b512: "58d943ff3d8cb5ad7428ae698c8865df4b6db6be3827ab264fae2a81ed4d1fdbca559d506d82a9b46e01c4591ced4bfd2876bf9667ed5281c85ee272b372648f",
+	} {
+		sum, err := hex.DecodeString(digest)
+		require.NoError(t, err)
+
+		// on its own, the checksum is enough to verify the payload
+		require.NoError(t, CheckValidHashStructures(Hashes{alg: sum}), alg)
+		require.NoError(t, CheckHashes(raw, "meta", Hashes{alg: sum}), alg)
+		require.Error(t, CheckValidHashStructures(Hashes{alg: sum[1:]}), alg)
+
+		// and a mismatch fails verification, even if the sha256 matches
+		sha256Sum, err := hex.DecodeString("d13e2b60d74c2e6f4f449b5e536814edf9a4827f5a9f4f957fc92e77609b9c92")
+		require.NoError(t, err)
+		err = CheckHashes([]byte("Optimus Prime"), "meta", Hashes{alg: sum})
+		require.Equal(t, ErrMismatchedChecksum{alg: alg, name: "meta", expected: digest}, err)
+		err = CheckHashes(raw, "meta", Hashes{notary.SHA256: sha256Sum, alg: make([]byte, len(sum))})
+		require.IsType(t, ErrMismatchedChecksum{}, err, alg)
+	}
+}
+
+func TestCheckHashesStrict(t *testing.T) {
+	raw := []byte("Bumblebee")
+	sha256Sum, err := hex.DecodeString("d13e2b60d74c2e6f4f449b5e536814edf9a4827f5a9f4f957fc92e77609b9c92")
+	require.NoError(t, err)
+	sha512Sum, err := hex.DecodeString("f2330f50d0f3ee56cf0d7f66aad8205e0cb9972c323208ffaa914ef7b3c240ae4774b5bbd1db2ce226ee967cfa9058173a853944f9b44e2e08abca385e2b7ed4")
+	require.NoError(t, err)
+
+	// both required checksums present and matching
+	require.NoError(t, CheckHashesStrict(raw, "meta", Hashes{notary.SHA256: sha256Sum, notary.SHA512: sha512Sum}))
+
+	// a partial set of checksums passes CheckHashes, but not CheckHashesStrict
+	for alg, hashes := range map[string]Hashes{
+		notary.SHA512: {notary.SHA256: sha256Sum},
+		notary.SHA256: {notary.SHA512: sha512Sum},
+	} {
+		require.NoError(t, CheckHashes(raw, "meta", hashes))
+		err = CheckHashesStrict(raw, "meta", hashes)
+		require.Equal(t, ErrMissingChecksum{alg: alg, name: "meta"}, err)
+	}
+
+	// a checksum for an algorithm which cannot be verified is rejected
+	unverifiable := Hashes{notary.SHA256: sha256Sum, notary.SHA512: sha512Sum, "sha384": []byte("sha384")}
+	require.NoError(t, CheckHashes(raw, "meta", unverifiable))
+	require.Equal(t, ErrInvalidChecksum{alg: "sha384"}, CheckHashesStrict(raw, "meta", unverifiable))
+
+	// but one for an algorithm which is verified, though not generated, is not
+	sha3Sum, err := hex.DecodeString("01abc6e05a0b5adacaa670d95f458b4e317fb33a98501360ec6ac706627e8cc1")
+	require.NoError(t, err)
+	require.NoError(t, CheckHashesStrict(raw, "meta", Hashes{notary.SHA256: sha256Sum, notary.SHA512: sha512Sum, notary.SHA3_256: sha3Sum}))
+
+	// as is any mismatched checksum
+	mismatched := Hashes{notary.SHA256: sha256Sum, notary.SHA512: []byte("malicious data")}
+	err = CheckHashesStrict(raw, "meta", mismatched)
+	require.IsType(t, ErrMismatchedChecksum{}, err)
+}
+
 func TestCheckValidHashStructures(t *testing.T) {
 	var err error
 	hashes := make(Hashes)
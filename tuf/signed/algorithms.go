@@ -0,0 +1,57 @@
+package signed
+
+import (
+	"fmt"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// AlgorithmPolicy maps roles to the signature algorithm their metadata must be
+// signed with, such as a stronger algorithm for the root role.  Roles which
+// are not in the policy may be signed with any supported algorithm.
+type AlgorithmPolicy map[data.RoleName]data.SigAlgorithm
+
+// Validate checks that every role in the policy is a valid role name, and that
+// every algorithm is one that signatures can be verified with
+func (p AlgorithmPolicy) Validate() error {
+	for role, algorithm := range p {
+		if !data.ValidRole(role) {
+			return fmt.Errorf("invalid role %q in signature algorithm policy", role)
+		}
+		if _, ok := Verifiers[algorithm]; !ok {
+			return fmt.Errorf("unknown signature algorithm %q for role %s", algorithm, role)
+		}
+	}
+	return nil
+}
+
+// Required returns the signature algorithm the role must be signed with, or an
+// empty algorithm if it may be signed with any
+func (p AlgorithmPolicy) Required(role data.RoleName) data.SigAlgorithm {
+	return p[role]
+}
+
+// VerifyAlgorithms checks that enough of the valid signatures by the role's keys
+// were made with the algorithm the policy requires for the role to meet its
+// threshold.  Signatures with other algorithms are ignored, as invalid
+// signatures are, so the signatures must already have been verified by
+// VerifySignatures.
+func VerifyAlgorithms(sigs []data.Signature, roleData data.BaseRole, policy AlgorithmPolicy) error {
+	required := policy.Required(roleData.Name)
+	if required == "" {
+		return nil
+	}
+	valid := make(map[string]struct{})
+	for _, sig := range sigs {
+		if !sig.IsValid || sig.Method != required {
+			continue
+		}
+		if _, ok := roleData.Keys[sig.KeyID]; ok {
+			valid[sig.KeyID] = struct{}{}
+		}
+	}
+	if len(valid) < roleData.Threshold {
+		return ErrSignatureAlgorithm{Role: roleData.Name, Required: required}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package signed
+
+import (
+	"testing"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/cryptoservice"
+	"github.com/theupdateframework/notary/passphrase"
+	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func TestAlgorithmPolicyValidate(t *testing.T) {
+	require.NoError(t, AlgorithmPolicy(nil).Validate())
+	require.NoError(t, AlgorithmPolicy{
+		data.CanonicalRootRole: data.ECDSASignature,
+		"targets/releases":     data.EDDSASignature,
+	}.Validate())
+
+	err := AlgorithmPolicy{data.CanonicalRootRole: "dsa"}.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown signature algorithm "dsa"`)
+
+	err = AlgorithmPolicy{"releases": data.ECDSASignature}.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid role "releases"`)
+}
+
+// With a policy for the role, only the keys which sign with the required
+// algorithm are used, and the signatures only meet the threshold if enough of
+// them are made with it
+func TestSignAndVerifyWithAlgorithmPolicy(t *testing.T) {
+	cs := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("pass")))
+	ecdsaKey, err := cs.Create(data.CanonicalRootRole, "", data.ECDSAKey)
+	require.NoError(t, err)
+	ed25519Key, err := cs.Create(data.CanonicalRootRole, "", data.ED25519Key)
+	require.NoError(t, err)
+	keys := []data.PublicKey{ecdsaKey, ed25519Key}
+	policy := AlgorithmPolicy{data.CanonicalRootRole: data.ECDSASignature}
+
+	meta := &data.SignedCommon{Type: data.TUFTypes[data.CanonicalRootRole], Version: 1,
+		Expires: data.DefaultExpires(data.CanonicalRootRole)}
+	b, err := json.MarshalCanonical(meta)
+	require.NoError(t, err)
+
+	s := &data.Signed{Signed: (*json.RawMessage)(&b)}
+	require.NoError(t, SignWithAlgorithm(cs, s, keys, 1, nil, data.ECDSASignature))
+	require.Len(t, s.Signatures, 1)
+	require.Equal(t, ecdsaKey.ID(), s.Signatures[0].KeyID)
+	require.Equal(t, data.ECDSASignature, s.Signatures[0].Method)
+
+	// there aren't enough keys which sign with the required algorithm
+	err = SignWithAlgorithm(cs, &data.Signed{Signed: (*json.RawMessage)(&b)}, keys, 2, nil, data.ECDSASignature)
+	require.Error(t, err)
+	require.IsType(t, ErrSignatureAlgorithm{}, err)
+	require.Equal(t, []string{ed25519Key.ID()}, err.(ErrSignatureAlgorithm).KeyIDs)
+
+	// both signatures are valid, but only one of them counts towards the
+	// threshold of the role when its algorithm is required
+	s = &data.Signed{Signed: (*json.RawMessage)(&b)}
+	require.NoError(t, Sign(cs, s, keys, 2, nil))
+	require.Len(t, s.Signatures, 2)
+	role := data.BaseRole{
+		Name:      data.CanonicalRootRole,
+		Keys:      data.Keys{ecdsaKey.ID(): ecdsaKey, ed25519Key.ID(): ed25519Key},
+		Threshold: 2,
+	}
+	require.NoError(t, VerifySignatures(s, role))
+	require.NoError(t, VerifyAlgorithms(s.Signatures, role, nil))
+	err = VerifyAlgorithms(s.Signatures, role, policy)
+	require.Error(t, err)
+	require.IsType(t, ErrSignatureAlgorithm{}, err)
+	require.Equal(t, data.CanonicalRootRole, err.(ErrSignatureAlgorithm).Role)
+
+	role.Threshold = 1
+	require.NoError(t, VerifyAlgorithms(s.Signatures, role, policy))
+	err = VerifyAlgorithms(s.Signatures, role, AlgorithmPolicy{data.CanonicalRootRole: data.RSAPSSSignature})
+	require.Error(t, err)
+
+	// roles which aren't in the policy may be signed with any algorithm
+	role.Name = data.CanonicalTargetsRole
+	require.NoError(t, VerifyAlgorithms(s.Signatures, role, AlgorithmPolicy{data.CanonicalRootRole: data.RSAPSSSignature}))
+}
@@ -3,6 +3,7 @@ package signed
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/theupdateframework/notary/tuf/data"
 )
@@ -29,13 +30,44 @@ func (e ErrInsufficientSignatures) Error() string {
 		e.FoundKeys, e.NeededKeys, len(e.MissingKeyIDs), candidates)
 }
 
+// ErrSignatureAlgorithm indicates that metadata is not, or could not be, signed
+// by enough keys with the signature algorithm required for its role
+type ErrSignatureAlgorithm struct {
+	Role     data.RoleName
+	Required data.SigAlgorithm
+	// KeyIDs are the signing keys which were skipped because they sign with
+	// other algorithms
+	KeyIDs []string
+}
+
+func (e ErrSignatureAlgorithm) Error() string {
+	role := ""
+	if e.Role != "" {
+		role = " for " + e.Role.String()
+	}
+	if len(e.KeyIDs) > 0 {
+		return fmt.Sprintf("not enough signing keys sign with %s, as required%s: keys %s sign with other algorithms",
+			e.Required, role, strings.Join(e.KeyIDs, ", "))
+	}
+	return fmt.Sprintf("valid signatures with %s, as required%s, did not meet threshold", e.Required, role)
+}
+
 // ErrExpired indicates a piece of metadata has expired
 type ErrExpired struct {
 	Role    data.RoleName
 	Expired string
+	// ClockSkew is how far the local clock was found to be ahead of the
+	// remote server's clock, if it is far enough ahead to be the likely
+	// reason the metadata appears expired
+	ClockSkew time.Duration
 }
 
 func (e ErrExpired) Error() string {
+	if e.ClockSkew > 0 {
+		return fmt.Sprintf(
+			"%s expired at %v according to the local clock, which is %s ahead of the server's: check the local clock is correct",
+			e.Role.String(), e.Expired, e.ClockSkew)
+	}
 	return fmt.Sprintf("%s expired at %v", e.Role.String(), e.Expired)
 }
 
@@ -31,6 +31,14 @@ import (
 // signatures produced by the previous call to Sign.
 func Sign(service CryptoService, s *data.Signed, signingKeys []data.PublicKey,
 	minSignatures int, otherWhitelistedKeys []data.PublicKey) error {
+	return SignWithAlgorithm(service, s, signingKeys, minSignatures, otherWhitelistedKeys, "")
+}
+
+// SignWithAlgorithm is Sign, except that only the signing keys which sign with
+// the given algorithm are used, so that at least minSignatures signatures are
+// made with it.  An empty algorithm allows every signing key to be used.
+func SignWithAlgorithm(service CryptoService, s *data.Signed, signingKeys []data.PublicKey,
+	minSignatures int, otherWhitelistedKeys []data.PublicKey, algorithm data.SigAlgorithm) error {
 
 	logrus.Debugf("sign called with %d/%d required keys", minSignatures, len(signingKeys))
 	signatures := make([]data.Signature, 0, len(s.Signatures)+1)
@@ -41,6 +49,7 @@ func Sign(service CryptoService, s *data.Signed, signingKeys []data.PublicKey,
 
 	// Get all the private key objects related to the public keys
 	missingKeyIDs := []string{}
+	otherAlgorithmKeyIDs := []string{}
 	for _, key := range signingKeys {
 		canonicalID, err := utils.CanonicalKeyID(key)
 		tufIDs[key.ID()] = key
@@ -55,6 +64,10 @@ func Sign(service CryptoService, s *data.Signed, signingKeys []data.PublicKey,
 			}
 			return err
 		}
+		if algorithm != "" && k.SignatureAlgorithm() != algorithm {
+			otherAlgorithmKeyIDs = append(otherAlgorithmKeyIDs, canonicalID)
+			continue
+		}
 		privKeys[key.ID()] = k
 	}
 
@@ -66,6 +79,9 @@ func Sign(service CryptoService, s *data.Signed, signingKeys []data.PublicKey,
 	}
 
 	// Check to ensure we have enough signing keys
+	if len(privKeys) < minSignatures && len(otherAlgorithmKeyIDs) > 0 {
+		return ErrSignatureAlgorithm{Required: algorithm, KeyIDs: otherAlgorithmKeyIDs}
+	}
 	if len(privKeys) < minSignatures {
 		return ErrInsufficientSignatures{FoundKeys: len(privKeys),
 			NeededKeys: minSignatures, MissingKeyIDs: missingKeyIDs}
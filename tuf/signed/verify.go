@@ -26,7 +26,13 @@ func IsExpired(t time.Time) bool {
 
 // VerifyExpiry returns ErrExpired if the metadata is expired
 func VerifyExpiry(s *data.SignedCommon, role data.RoleName) error {
-	if IsExpired(s.Expires) {
+	return VerifyExpiryAt(s, role, time.Now())
+}
+
+// VerifyExpiryAt returns ErrExpired if the metadata had expired by the given
+// time
+func VerifyExpiryAt(s *data.SignedCommon, role data.RoleName, now time.Time) error {
+	if s.Expires.Before(now) {
 		logrus.Errorf("Metadata for %s expired", role)
 		return ErrExpired{Role: role, Expired: s.Expires.Format("Mon Jan 2 15:04:05 MST 2006")}
 	}
@@ -63,6 +69,10 @@ func VerifySignatures(s *data.Signed, roleData data.BaseRole) error {
 		return err
 	}
 
+	// the version is only used to key the verification cache, so metadata
+	// without one is still verified as normal
+	version, _ := decoded["version"].(float64)
+
 	valid := make(map[string]struct{})
 	for i := range s.Signatures {
 		sig := &(s.Signatures[i])
@@ -76,10 +86,16 @@ func VerifySignatures(s *data.Signed, roleData data.BaseRole) error {
 		if key.ID() != sig.KeyID {
 			return ErrInvalidKeyID{}
 		}
+		if sigCache.verified(roleData.Name, int(version), msg, sig) {
+			sig.IsValid = true
+			valid[sig.KeyID] = struct{}{}
+			continue
+		}
 		if err := VerifySignature(msg, sig, key); err != nil {
 			logrus.Debugf("continuing b/c %s", err.Error())
 			continue
 		}
+		sigCache.add(roleData.Name, int(version), msg, sig)
 		valid[sig.KeyID] = struct{}{}
 	}
 	if len(valid) < roleData.Threshold {
@@ -91,6 +107,55 @@ func VerifySignatures(s *data.Signed, roleData data.BaseRole) error {
 	return nil
 }
 
+// VerifyDetached checks that there are sufficient valid signatures over a
+// payload which isn't TUF metadata, such as a file signed with a delegation
+// key, for the given role.  A signature may name its key either by the key
+// ID the role lists or by the key's canonical ID, which differ for keys in
+// certificates.  The IDs of the role's keys with valid signatures are
+// returned, whether or not they meet the threshold.
+func VerifyDetached(msg []byte, sigs []data.Signature, roleData data.BaseRole) ([]string, error) {
+	if len(sigs) == 0 {
+		return nil, ErrNoSignatures
+	}
+	if roleData.Threshold < 1 {
+		return nil, ErrRoleThreshold{}
+	}
+
+	keys := make(map[string]data.PublicKey, 2*len(roleData.Keys))
+	for keyID, key := range roleData.Keys {
+		keys[keyID] = key
+		if canonicalID, err := utils.CanonicalKeyID(key); err == nil {
+			keys[canonicalID] = key
+		}
+	}
+
+	valid := make(map[string]struct{})
+	var validIDs []string
+	for i := range sigs {
+		sig := &(sigs[i])
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			logrus.Debugf("continuing b/c keyid lookup was nil: %s\n", sig.KeyID)
+			continue
+		}
+		if _, ok := valid[key.ID()]; ok {
+			continue
+		}
+		if err := VerifySignature(msg, sig, key); err != nil {
+			logrus.Debugf("continuing b/c %s", err.Error())
+			continue
+		}
+		valid[key.ID()] = struct{}{}
+		validIDs = append(validIDs, key.ID())
+	}
+	if len(valid) < roleData.Threshold {
+		return validIDs, ErrRoleThreshold{
+			Msg: fmt.Sprintf("found %d of the %d valid signatures required for %s", len(valid), roleData.Threshold, roleData.Name),
+		}
+	}
+	return validIDs, nil
+}
+
 // VerifySignature checks a single signature and public key against a payload
 // If the signature is verified, the signature's is valid field will actually
 // be mutated to be equal to the boolean true
@@ -216,6 +216,18 @@ func TestVerifyExpiry(t *testing.T) {
 	require.IsType(t, ErrExpired{}, err)
 }
 
+func TestVerifyExpiryAt(t *testing.T) {
+	tufType := data.TUFTypes[data.CanonicalTimestampRole]
+	expires := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	meta := &data.SignedCommon{Type: tufType, Version: 1, Expires: expires}
+
+	require.NoError(t, VerifyExpiryAt(meta, data.CanonicalTimestampRole, expires.Add(-time.Second)))
+
+	err := VerifyExpiryAt(meta, data.CanonicalTimestampRole, expires.Add(time.Second))
+	require.Error(t, err)
+	require.IsType(t, ErrExpired{}, err)
+}
+
 func TestVerifyPublicKeyMatchesPrivateKeyHappyCase(t *testing.T) {
 	privKey, err := utils.GenerateECDSAKey(rand.Reader)
 	require.NoError(t, err)
@@ -246,3 +258,48 @@ func TestVerifyPublicKeyMatchesPrivateKeyFails(t *testing.T) {
 	require.Error(t, err, "should throw error if privKey is nil")
 
 }
+
+func TestVerifyDetached(t *testing.T) {
+	cs := NewEd25519()
+	msg := []byte("release notes")
+	keys := make([]data.PublicKey, 3)
+	sigs := make([]data.Signature, 3)
+	for i := range keys {
+		k, err := cs.Create("targets/releases", "", data.ED25519Key)
+		require.NoError(t, err)
+		privKey, _, err := cs.GetPrivateKey(k.ID())
+		require.NoError(t, err)
+		sig, err := privKey.Sign(rand.Reader, msg, nil)
+		require.NoError(t, err)
+		keys[i] = k
+		sigs[i] = data.Signature{KeyID: k.ID(), Method: privKey.SignatureAlgorithm(), Signature: sig}
+	}
+
+	single := data.NewBaseRole("targets/releases", 1, keys[0])
+	validIDs, err := VerifyDetached(msg, sigs[:1], single)
+	require.NoError(t, err)
+	require.Equal(t, []string{keys[0].ID()}, validIDs)
+
+	_, err = VerifyDetached([]byte("other notes"), sigs[:1], single)
+	require.IsType(t, ErrRoleThreshold{}, err)
+	_, err = VerifyDetached(msg, sigs[1:2], single)
+	require.IsType(t, ErrRoleThreshold{}, err, "the key is not in the role")
+	_, err = VerifyDetached(msg, nil, single)
+	require.Equal(t, ErrNoSignatures, err)
+
+	multi := data.NewBaseRole("targets/releases", 2, keys...)
+	validIDs, err = VerifyDetached(msg, sigs[1:], multi)
+	require.NoError(t, err)
+	require.Len(t, validIDs, 2)
+
+	// signatures by the same key are only counted once
+	validIDs, err = VerifyDetached(msg, []data.Signature{sigs[0], sigs[0]}, multi)
+	require.IsType(t, ErrRoleThreshold{}, err)
+	require.Equal(t, []string{keys[0].ID()}, validIDs)
+
+	corrupted := sigs[2]
+	corrupted.Signature = append([]byte{}, corrupted.Signature...)
+	corrupted.Signature[0] ^= 0xff
+	_, err = VerifyDetached(msg, []data.Signature{sigs[0], corrupted}, multi)
+	require.IsType(t, ErrRoleThreshold{}, err)
+}
@@ -0,0 +1,112 @@
+package signed
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// verificationCacheKey identifies the signature of a role by a key
+type verificationCacheKey struct {
+	role  data.RoleName
+	keyID string
+}
+
+type verificationCacheEntry struct {
+	key     verificationCacheKey
+	version int
+	// digest covers the signed message and the signature, so that any change
+	// to either, even without a change of version, misses the cache
+	digest [sha256.Size]byte
+}
+
+// verificationCache is a bounded, least recently used, cache of the
+// signatures which have been successfully verified within this process.  Each
+// role and key ID only has the signature of a single version of the role
+// cached, so a new version replaces the previous one.
+type verificationCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[verificationCacheKey]*list.Element
+	// recency orders the entries from the most to the least recently used
+	recency *list.List
+}
+
+var sigCache = &verificationCache{}
+
+// SetVerificationCacheSize bounds the number of verified signatures which are
+// cached, so that verifying the same metadata again, such as when listing or
+// verifying targets many times within one process, doesn't repeat the
+// cryptography.  Only successful verifications are cached, and only for the
+// exact message and signature which were verified.  A size of 0, the default,
+// turns the cache off.
+func SetVerificationCacheSize(size int) {
+	sigCache.mu.Lock()
+	defer sigCache.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	sigCache.size = size
+	sigCache.entries = make(map[verificationCacheKey]*list.Element)
+	sigCache.recency = list.New()
+}
+
+func verificationDigest(msg []byte, sig *data.Signature) [sha256.Size]byte {
+	h := sha256.New()
+	// length-prefix each part, so that the parts can't be shifted into one another
+	for _, part := range [][]byte{[]byte(sig.Method), sig.Signature, msg} {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(part)))
+		h.Write(length[:])
+		h.Write(part)
+	}
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
+
+// verified returns whether this exact signature of this version of the role
+// has already been verified
+func (c *verificationCache) verified(role data.RoleName, version int, msg []byte, sig *data.Signature) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		return false
+	}
+	elem, ok := c.entries[verificationCacheKey{role: role, keyID: sig.KeyID}]
+	if !ok {
+		return false
+	}
+	entry := elem.Value.(*verificationCacheEntry)
+	if entry.version != version || entry.digest != verificationDigest(msg, sig) {
+		return false
+	}
+	c.recency.MoveToFront(elem)
+	return true
+}
+
+// add records that the signature of this version of the role was verified,
+// evicting the least recently used entry if the cache is full
+func (c *verificationCache) add(role data.RoleName, version int, msg []byte, sig *data.Signature) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		return
+	}
+	key := verificationCacheKey{role: role, keyID: sig.KeyID}
+	entry := &verificationCacheEntry{key: key, version: version, digest: verificationDigest(msg, sig)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.recency.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.recency.PushFront(entry)
+	if c.recency.Len() > c.size {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(*verificationCacheEntry).key)
+	}
+}
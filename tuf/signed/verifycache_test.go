@@ -0,0 +1,153 @@
+package signed
+
+import (
+	"testing"
+
+	"github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// countingVerifier counts the signatures which are actually verified
+type countingVerifier struct {
+	Verifier
+	count *int
+}
+
+func (v countingVerifier) Verify(key data.PublicKey, sig []byte, msg []byte) error {
+	*v.count++
+	return v.Verifier.Verify(key, sig, msg)
+}
+
+// countVerifications wraps the ed25519 verifier so that it counts the
+// signatures it verifies, and returns a function which restores it
+func countVerifications(count *int) func() {
+	original := Verifiers[data.EDDSASignature]
+	Verifiers[data.EDDSASignature] = countingVerifier{Verifier: original, count: count}
+	return func() { Verifiers[data.EDDSASignature] = original }
+}
+
+func signedTargets(t testing.TB, cs *Ed25519, k data.PublicKey, version int) *data.Signed {
+	meta := &data.SignedCommon{Type: data.TUFTypes[data.CanonicalTargetsRole], Version: version,
+		Expires: data.DefaultExpires(data.CanonicalTargetsRole)}
+	b, err := json.MarshalCanonical(meta)
+	require.NoError(t, err)
+	s := &data.Signed{Signed: (*json.RawMessage)(&b)}
+	require.NoError(t, Sign(cs, s, []data.PublicKey{k}, 1, nil))
+	return s
+}
+
+// A cached verification only skips verifying the exact same signature of the
+// exact same metadata, so changes to either are still caught
+func TestVerificationCacheDoesNotMaskTampering(t *testing.T) {
+	SetVerificationCacheSize(10)
+	defer SetVerificationCacheSize(0)
+	var count int
+	defer countVerifications(&count)()
+
+	cs := NewEd25519()
+	k, err := cs.Create(data.CanonicalTargetsRole, "", data.ED25519Key)
+	require.NoError(t, err)
+	role := data.BaseRole{Name: data.CanonicalTargetsRole, Keys: data.Keys{k.ID(): k}, Threshold: 1}
+
+	s := signedTargets(t, cs, k, 1)
+	require.NoError(t, VerifySignatures(s, role))
+	require.NoError(t, VerifySignatures(s, role))
+	require.Equal(t, 1, count)
+	require.True(t, s.Signatures[0].IsValid)
+
+	// the same version with different content
+	tamperedContent := *s
+	raw := json.RawMessage(append([]byte{}, *s.Signed...))
+	raw = json.RawMessage(append(raw[:len(raw)-1], []byte(`,"extra":true}`)...))
+	tamperedContent.Signed = &raw
+	tamperedContent.Signatures = []data.Signature{s.Signatures[0]}
+	tamperedContent.Signatures[0].IsValid = false
+	require.Error(t, VerifySignatures(&tamperedContent, role))
+	require.False(t, tamperedContent.Signatures[0].IsValid)
+	require.Equal(t, 2, count)
+
+	// the same content with a different signature
+	tamperedSig := *s
+	tamperedSig.Signatures = []data.Signature{s.Signatures[0]}
+	tamperedSig.Signatures[0].IsValid = false
+	tamperedSig.Signatures[0].Signature = append([]byte{}, s.Signatures[0].Signature...)
+	tamperedSig.Signatures[0].Signature[0] ^= 0xff
+	require.Error(t, VerifySignatures(&tamperedSig, role))
+	require.Equal(t, 3, count)
+
+	// a new version replaces the cached verification of the previous one
+	s2 := signedTargets(t, cs, k, 2)
+	require.NoError(t, VerifySignatures(s2, role))
+	require.NoError(t, VerifySignatures(s2, role))
+	require.Equal(t, 4, count)
+	require.NoError(t, VerifySignatures(s, role))
+	require.Equal(t, 5, count)
+
+	// the original is still cached after the failed verifications
+	require.NoError(t, VerifySignatures(s, role))
+	require.Equal(t, 5, count)
+}
+
+// The cache never holds more verifications than its size, evicting the
+// least recently used
+func TestVerificationCacheIsBounded(t *testing.T) {
+	SetVerificationCacheSize(2)
+	defer SetVerificationCacheSize(0)
+	var count int
+	defer countVerifications(&count)()
+
+	cs := NewEd25519()
+	roles := make([]data.BaseRole, 3)
+	metas := make([]*data.Signed, 3)
+	for i := range roles {
+		k, err := cs.Create(data.CanonicalTargetsRole, "", data.ED25519Key)
+		require.NoError(t, err)
+		roles[i] = data.BaseRole{Name: data.CanonicalTargetsRole, Keys: data.Keys{k.ID(): k}, Threshold: 1}
+		metas[i] = signedTargets(t, cs, k, 1)
+	}
+
+	require.NoError(t, VerifySignatures(metas[0], roles[0]))
+	require.NoError(t, VerifySignatures(metas[1], roles[1]))
+	require.NoError(t, VerifySignatures(metas[0], roles[0]))
+	require.Equal(t, 2, count)
+
+	// evicts the verification of metas[1], which was used least recently
+	require.NoError(t, VerifySignatures(metas[2], roles[2]))
+	require.Equal(t, 2, sigCache.recency.Len())
+	require.NoError(t, VerifySignatures(metas[0], roles[0]))
+	require.Equal(t, 3, count)
+	require.NoError(t, VerifySignatures(metas[1], roles[1]))
+	require.Equal(t, 4, count)
+}
+
+// With the cache, verifying the same metadata repeatedly only verifies its
+// signature once
+func BenchmarkVerifySignatures(b *testing.B) {
+	cs := NewEd25519()
+	k, err := cs.Create(data.CanonicalTargetsRole, "", data.ED25519Key)
+	require.NoError(b, err)
+	role := data.BaseRole{Name: data.CanonicalTargetsRole, Keys: data.Keys{k.ID(): k}, Threshold: 1}
+	s := signedTargets(b, cs, k, 1)
+
+	for _, size := range []int{0, 10} {
+		name := "uncached"
+		if size > 0 {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			SetVerificationCacheSize(size)
+			defer SetVerificationCacheSize(0)
+			var count int
+			defer countVerifications(&count)()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := VerifySignatures(s, role); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(count)/float64(b.N), "verifications/op")
+		})
+	}
+}
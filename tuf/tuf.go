@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	canonicaljson "github.com/docker/go/canonical/json"
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/tuf/data"
@@ -68,6 +69,9 @@ type Repo struct {
 	// If we know what the original was, we'll if and how to handle root
 	// rotations.
 	originalRootRole data.BaseRole
+
+	// the signature algorithms that roles must be signed with
+	algorithms signed.AlgorithmPolicy
 }
 
 // NewRepo initializes a Repo instance with a CryptoService.
@@ -80,6 +84,13 @@ func NewRepo(cryptoService signed.CryptoService) *Repo {
 	}
 }
 
+// SetSignatureAlgorithms sets the signature algorithm that each role in the
+// policy must be signed with.  Only the role's keys which sign with that
+// algorithm are used to sign it.
+func (tr *Repo) SetSignatureAlgorithms(policy signed.AlgorithmPolicy) {
+	tr.algorithms = policy
+}
+
 // AddBaseKeys is used to add keys to the role in root.json
 func (tr *Repo) AddBaseKeys(role data.RoleName, keys ...data.PublicKey) error {
 	if tr.Root == nil {
@@ -323,8 +334,9 @@ func delegationUpdateVisitor(roleName data.RoleName, addKeys data.KeyList, remov
 						KeyIDs:    keyIDCopy,
 						Threshold: role.Threshold,
 					},
-					Name:  role.Name,
-					Paths: pathsCopy,
+					Name:   role.Name,
+					Paths:  pathsCopy,
+					Custom: role.Custom,
 				}
 				delgRole.RemovePaths(removePaths)
 				if clearAllPaths {
@@ -503,6 +515,155 @@ func (tr *Repo) UpdateDelegationPaths(roleName data.RoleName, addPaths, removePa
 	return nil
 }
 
+// UpdateDelegationKeysAndPaths updates the keys and the paths of an existing delegation role in its
+// parent targets metadata at once, so that either all of the changes are made or none of them are.
+func (tr *Repo) UpdateDelegationKeysAndPaths(roleName data.RoleName, addKeys data.KeyList, removeKeys, addPaths, removePaths []string, clearPaths bool) error {
+	if !data.IsDelegation(roleName) {
+		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
+	}
+	parent := roleName.Parent()
+
+	if err := tr.VerifyCanSign(parent); err != nil {
+		return err
+	}
+
+	// check the parent role's metadata
+	if _, ok := tr.Targets[parent]; !ok {
+		// a delegation must exist to be updated
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+
+	return tr.WalkTargets("", parent, delegationUpdateVisitor(roleName, addKeys, removeKeys, addPaths, removePaths, clearPaths, notary.MinThreshold))
+}
+
+// ReplaceDelegationKeysAndPaths sets the keys and the paths of a delegation role in its parent
+// targets metadata to exactly those given, creating the role if it does not exist yet.  An existing
+// role keeps its threshold, which must not be more than the number of keys given.
+func (tr *Repo) ReplaceDelegationKeysAndPaths(roleName data.RoleName, keys data.KeyList, paths []string) error {
+	if !data.IsDelegation(roleName) {
+		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
+	}
+	parent := roleName.Parent()
+
+	if err := tr.VerifyCanSign(parent); err != nil {
+		return err
+	}
+
+	// check the parent role's metadata
+	if _, ok := tr.Targets[parent]; !ok { // the parent targetfile may not exist yet - if not, then create it
+		if _, err := tr.InitTargets(parent); err != nil {
+			return err
+		}
+	}
+
+	keyIDs := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		keyIDs[k.ID()] = struct{}{}
+	}
+	replaceVisitor := func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		removeKeys := []string{}
+		threshold := notary.MinThreshold
+		if foundAt := utils.FindRoleIndex(tgt.Signed.Delegations.Roles, roleName); foundAt >= 0 {
+			role := tgt.Signed.Delegations.Roles[foundAt]
+			removeKeys = append(removeKeys, role.KeyIDs...)
+			threshold = role.Threshold
+		}
+		if threshold > len(keyIDs) {
+			return data.ErrInvalidRole{
+				Role:   roleName,
+				Reason: fmt.Sprintf("threshold of %d is more than the %d keys to replace the role's keys with", threshold, len(keyIDs)),
+			}
+		}
+		return delegationUpdateVisitor(roleName, keys, removeKeys, paths, []string{}, true, threshold)(tgt, validRole)
+	}
+	return tr.WalkTargets("", parent, replaceVisitor)
+}
+
+// UpdateDelegationCustom replaces the custom metadata stored on an existing
+// delegation role in its parent targets metadata.  A nil custom value removes
+// any existing custom metadata.
+func (tr *Repo) UpdateDelegationCustom(roleName data.RoleName, custom *canonicaljson.RawMessage) error {
+	if !data.IsDelegation(roleName) {
+		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
+	}
+	parent := roleName.Parent()
+
+	if err := tr.VerifyCanSign(parent); err != nil {
+		return err
+	}
+
+	// check the parent role's metadata
+	if _, ok := tr.Targets[parent]; !ok {
+		// a delegation must exist to attach custom metadata to it
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+
+	updated := false
+	updateCustom := func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		foundAt := utils.FindRoleIndex(tgt.Signed.Delegations.Roles, roleName)
+		if foundAt < 0 {
+			return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+		}
+		tgt.Signed.Delegations.Roles[foundAt].Custom = custom
+		tgt.Dirty = true
+		updated = true
+		return StopWalk{}
+	}
+	if err := tr.WalkTargets("", parent, updateCustom); err != nil {
+		return err
+	}
+	if !updated {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+	return nil
+}
+
+// UpdateDelegationThreshold sets the number of signatures an existing
+// delegation role requires, which must be at least 1 and at most the number of
+// keys the role has
+func (tr *Repo) UpdateDelegationThreshold(roleName data.RoleName, threshold int) error {
+	if !data.IsDelegation(roleName) {
+		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
+	}
+	parent := roleName.Parent()
+
+	if err := tr.VerifyCanSign(parent); err != nil {
+		return err
+	}
+
+	// check the parent role's metadata
+	if _, ok := tr.Targets[parent]; !ok {
+		// a delegation must exist to change its threshold
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+
+	updated := false
+	updateThreshold := func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		foundAt := utils.FindRoleIndex(tgt.Signed.Delegations.Roles, roleName)
+		if foundAt < 0 {
+			return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+		}
+		role := tgt.Signed.Delegations.Roles[foundAt]
+		if threshold < notary.MinThreshold || threshold > len(role.KeyIDs) {
+			return data.ErrInvalidRole{
+				Role:   roleName,
+				Reason: fmt.Sprintf("threshold must be between %d and the role's %d keys", notary.MinThreshold, len(role.KeyIDs)),
+			}
+		}
+		role.Threshold = threshold
+		tgt.Dirty = true
+		updated = true
+		return StopWalk{}
+	}
+	if err := tr.WalkTargets("", parent, updateThreshold); err != nil {
+		return err
+	}
+	if !updated {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+	return nil
+}
+
 // DeleteDelegation removes a delegated targets role from its parent
 // targets object. It also deletes the delegation from the snapshot.
 // DeleteDelegation will only make use of the role Name field.
@@ -1021,6 +1182,13 @@ func (tr *Repo) SignSnapshot(expires time.Time) (*data.Signed, error) {
 
 // SignTimestamp updates the timestamp based on the current snapshot then signs it
 func (tr *Repo) SignTimestamp(expires time.Time) (*data.Signed, error) {
+	return tr.SignTimestampWithCustom(expires, nil)
+}
+
+// SignTimestampWithCustom updates the timestamp based on the current snapshot then
+// signs it.  If snapshotCustom is not nil, it is called with the new snapshot metadata
+// to produce custom data to attach to that metadata before signing.
+func (tr *Repo) SignTimestampWithCustom(expires time.Time, snapshotCustom func(data.FileMeta) (*canonicaljson.RawMessage, error)) (*data.Signed, error) {
 	logrus.Debug("SignTimestamp")
 	signedSnapshot, err := tr.Snapshot.ToSigned()
 	if err != nil {
@@ -1030,6 +1198,13 @@ func (tr *Repo) SignTimestamp(expires time.Time) (*data.Signed, error) {
 	if err != nil {
 		return nil, err
 	}
+	if snapshotCustom != nil {
+		meta := tr.Timestamp.Signed.Meta[data.CanonicalSnapshotRole.String()]
+		if meta.Custom, err = snapshotCustom(meta); err != nil {
+			return nil, err
+		}
+		tr.Timestamp.Signed.Meta[data.CanonicalSnapshotRole.String()] = meta
+	}
 	tr.Timestamp.Signed.Expires = expires
 	tr.Timestamp.Signed.Version++
 	signed, err := tr.Timestamp.ToSigned()
@@ -1054,7 +1229,12 @@ func (tr Repo) sign(signedData *data.Signed, roles []data.BaseRole, optionalKeys
 	for _, r := range roles {
 		roleKeys := r.ListKeys()
 		validKeys = append(roleKeys, validKeys...)
-		if err := signed.Sign(tr.cryptoService, signedData, roleKeys, r.Threshold, validKeys); err != nil {
+		err := signed.SignWithAlgorithm(tr.cryptoService, signedData, roleKeys, r.Threshold, validKeys, tr.algorithms.Required(r.Name))
+		if algErr, ok := err.(signed.ErrSignatureAlgorithm); ok {
+			algErr.Role = r.Name
+			return nil, algErr
+		}
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	canonicaljson "github.com/docker/go/canonical/json"
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary/cryptoservice"
 	"github.com/theupdateframework/notary/passphrase"
@@ -453,6 +454,176 @@ func TestUpdateDelegationsAddKeyToRole(t *testing.T) {
 	require.True(t, r.Dirty)
 }
 
+// Updating the keys and paths of a delegation together either makes every
+// change or none of them
+func TestUpdateDelegationKeysAndPaths(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	testKey, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{testKey}, []string{}, 1)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationPaths("targets/test", []string{"test"}, []string{}, false)
+	require.NoError(t, err)
+
+	deepKey1, err := ed25519.Create("targets/test/deep", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	deepKey2, err := ed25519.Create("targets/test/deep", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/test/deep", []data.PublicKey{deepKey1, deepKey2}, []string{}, 1)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationPaths("targets/test/deep", []string{"test/deep"}, []string{}, false)
+	require.NoError(t, err)
+
+	// the path to add is outside of the parent's paths, so the key isn't removed either
+	err = repo.UpdateDelegationKeysAndPaths("targets/test/deep", nil, []string{deepKey1.ID()}, []string{"elsewhere"}, []string{}, true)
+	require.Error(t, err)
+	role, err := repo.GetDelegationRole("targets/test/deep")
+	require.NoError(t, err)
+	require.Len(t, role.Keys, 2)
+	require.Equal(t, []string{"test/deep"}, role.Paths)
+
+	err = repo.UpdateDelegationKeysAndPaths("targets/test/deep", nil, []string{deepKey1.ID()}, []string{}, []string{}, true)
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/test/deep")
+	require.NoError(t, err)
+	require.Len(t, role.Keys, 1)
+	require.Contains(t, role.Keys, deepKey2.ID())
+	require.Empty(t, role.Paths)
+	require.True(t, repo.Targets["targets/test"].Dirty)
+
+	// the delegation must already exist
+	err = repo.UpdateDelegationKeysAndPaths("targets/missing/role", nil, []string{}, []string{}, []string{}, true)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+}
+
+// Replacing the keys and paths of a delegation leaves it with exactly the keys
+// and paths given, unlike adding them
+func TestReplaceDelegationKeysAndPaths(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	oldKey1, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	oldKey2, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{oldKey1, oldKey2}, []string{}, 2)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationPaths("targets/test", []string{"old"}, []string{}, false)
+	require.NoError(t, err)
+
+	newKey1, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	newKey2, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+
+	// the role keeps its threshold of 2, so it can't be left with only 1 key
+	err = repo.ReplaceDelegationKeysAndPaths("targets/test", data.KeyList{newKey1}, []string{"new"})
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	role, err := repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.Len(t, role.Keys, 2)
+	require.Contains(t, role.Keys, oldKey1.ID())
+	require.Equal(t, []string{"old"}, role.Paths)
+
+	err = repo.ReplaceDelegationKeysAndPaths("targets/test", data.KeyList{newKey1, newKey2}, []string{"new"})
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.Len(t, role.Keys, 2)
+	require.Contains(t, role.Keys, newKey1.ID())
+	require.Contains(t, role.Keys, newKey2.ID())
+	require.Equal(t, []string{"new"}, role.Paths)
+	require.Equal(t, 2, role.Threshold)
+
+	// a delegation which doesn't exist yet is created with a threshold of 1
+	err = repo.ReplaceDelegationKeysAndPaths("targets/other", data.KeyList{newKey1}, []string{"other"})
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/other")
+	require.NoError(t, err)
+	require.Len(t, role.Keys, 1)
+	require.Equal(t, []string{"other"}, role.Paths)
+	require.Equal(t, 1, role.Threshold)
+
+	err = repo.ReplaceDelegationKeysAndPaths(data.CanonicalTargetsRole, data.KeyList{newKey1}, []string{"other"})
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+}
+
+func TestUpdateDelegationThreshold(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	testKey1, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	testKey2, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{testKey1, testKey2}, []string{}, 1)
+	require.NoError(t, err)
+	repo.Targets[data.CanonicalTargetsRole].Dirty = false
+
+	require.NoError(t, repo.UpdateDelegationThreshold("targets/test", 2))
+	role, err := repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.Equal(t, 2, role.Threshold)
+	require.True(t, repo.Targets[data.CanonicalTargetsRole].Dirty)
+
+	// the threshold must be between 1 and the number of keys
+	for _, threshold := range []int{0, 3} {
+		err = repo.UpdateDelegationThreshold("targets/test", threshold)
+		require.Error(t, err)
+		require.IsType(t, data.ErrInvalidRole{}, err)
+	}
+	role, err = repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.Equal(t, 2, role.Threshold)
+
+	// the delegation must already exist
+	err = repo.UpdateDelegationThreshold("targets/missing", 1)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	err = repo.UpdateDelegationThreshold(data.CanonicalTargetsRole, 1)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+}
+
+func TestUpdateDelegationCustom(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	custom := canonicaljson.RawMessage(`{"team":"release"}`)
+
+	// the delegation must already exist
+	err := repo.UpdateDelegationCustom("targets/test", &custom)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+
+	testKey, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{testKey}, []string{}, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.UpdateDelegationCustom("targets/test", &custom))
+
+	r, ok := repo.Targets[data.CanonicalTargetsRole]
+	require.True(t, ok)
+	require.Len(t, r.Signed.Delegations.Roles, 1)
+	require.Equal(t, &custom, r.Signed.Delegations.Roles[0].Custom)
+	require.True(t, r.Dirty)
+
+	// updating the paths and keys keeps the custom data
+	err = repo.UpdateDelegationPaths("targets/test", []string{"test"}, []string{}, false)
+	require.NoError(t, err)
+	require.Equal(t, &custom, r.Signed.Delegations.Roles[0].Custom)
+
+	// custom data can also be cleared
+	require.NoError(t, repo.UpdateDelegationCustom("targets/test", nil))
+	require.Nil(t, r.Signed.Delegations.Roles[0].Custom)
+}
+
 func TestDeleteDelegations(t *testing.T) {
 	ed25519 := signed.NewEd25519()
 	repo := initRepo(t, ed25519)
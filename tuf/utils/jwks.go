@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// jsonWebKey is the subset of the fields of a JSON Web Key (RFC 7517) which
+// are needed to get the public part of an EC or RSA key
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+
+	// EC keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+
+	// RSA keys
+	Modulus  string `json:"n"`
+	Exponent string `json:"e"`
+}
+
+func (k jsonWebKey) name(i int) string {
+	if k.KeyID != "" {
+		return fmt.Sprintf("%q", k.KeyID)
+	}
+	return fmt.Sprintf("%d", i+1)
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// ParseJWKS returns the public keys in a JSON Web Key Set (RFC 7517), in the
+// order they appear in the set.  EC and RSA keys are supported, and every key
+// in the set must be one of them and usable for signatures.
+func ParseJWKS(jwks []byte) ([]data.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("invalid JWKS: no keys")
+	}
+
+	pubKeys := make([]data.PublicKey, 0, len(set.Keys))
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			return nil, fmt.Errorf("key %s in JWKS is for %q, not signatures", jwk.name(i), jwk.Use)
+		}
+		pubKey, err := jwkToPublicKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("key %s in JWKS is invalid: %v", jwk.name(i), err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	return pubKeys, nil
+}
+
+func jwkToPublicKey(jwk jsonWebKey) (data.PublicKey, error) {
+	var (
+		keyType string
+		pub     interface{}
+	)
+	switch jwk.KeyType {
+	case "EC":
+		curve, ok := jwkCurves[jwk.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := jwkInt("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := jwkInt("y", jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", jwk.Curve)
+		}
+		keyType, pub = data.ECDSAKey, &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	case "RSA":
+		n, err := jwkInt("n", jwk.Modulus)
+		if err != nil {
+			return nil, err
+		}
+		e, err := jwkInt("e", jwk.Exponent)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported RSA exponent %s", e)
+		}
+		if n.BitLen() < notary.MinRSABitSize {
+			return nil, fmt.Errorf("RSA modulus is smaller than the minimum of %d bits", notary.MinRSABitSize)
+		}
+		keyType, pub = data.RSAKey, &rsa.PublicKey{N: n, E: int(e.Int64())}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return data.NewPublicKey(keyType, der), nil
+}
+
+// jwkInt decodes a base64url encoded, unpadded, big-endian integer
+func jwkInt(field, value string) (*big.Int, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing %q", field)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %q: %v", field, err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
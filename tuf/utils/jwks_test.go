@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// the example public keys from RFC 7517, appendix A.1
+const sampleJWKS = `{"keys": [
+	{"kty": "EC", "crv": "P-256",
+	 "x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+	 "y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM",
+	 "use": "enc", "kid": "1"},
+	{"kty": "RSA",
+	 "n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	 "e": "AQAB", "alg": "RS256", "kid": "2011-04-29"}
+]}`
+
+func jwkBase64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// Keys from a JWKS have the same key IDs as the same keys read from PEM
+func TestParseJWKS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "EC", "crv": "P-256", "x": %q, "y": %q, "use": "sig"},
+		{"kty": "RSA", "n": %q, "e": %q, "kid": "rsa"}
+	]}`, jwkBase64(ecKey.X), jwkBase64(ecKey.Y), jwkBase64(rsaKey.N), jwkBase64(big.NewInt(int64(rsaKey.E))))
+
+	pubKeys, err := ParseJWKS([]byte(jwks))
+	require.NoError(t, err)
+	require.Len(t, pubKeys, 2)
+
+	for i, pub := range []interface{}{&ecKey.PublicKey, &rsaKey.PublicKey} {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		expected, err := ParsePEMPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		require.NoError(t, err)
+		require.Equal(t, expected.ID(), pubKeys[i].ID())
+		require.Equal(t, expected.Algorithm(), pubKeys[i].Algorithm())
+	}
+}
+
+func TestParseJWKSSample(t *testing.T) {
+	// the EC key in the sample is for encryption
+	_, err := ParseJWKS([]byte(sampleJWKS))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `key "1"`)
+
+	pubKeys, err := ParseJWKS([]byte(strings.Replace(sampleJWKS, `"use": "enc", `, "", 1)))
+	require.NoError(t, err)
+	require.Len(t, pubKeys, 2)
+	require.Equal(t, data.ECDSAKey, pubKeys[0].Algorithm())
+	require.Equal(t, "bcff05bc6e4f01a6730f8d44d6ab418b4126142bea669af2f5a7bb6182cab01f", pubKeys[0].ID())
+	require.Equal(t, data.RSAKey, pubKeys[1].Algorithm())
+	require.Equal(t, "c737dc572b6d2887637ea8ae734a3016fafcbc1e2a2f939be662f660c2972f49", pubKeys[1].ID())
+}
+
+func TestParseJWKSInvalid(t *testing.T) {
+	for _, jwks := range []string{
+		``,
+		`{"keys": []}`,
+		`{"keys": [{"kty": "oct", "k": "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"}]}`,
+		`{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}]}`,
+		// not on the curve
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4", "y": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256K", "x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4", "y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "not base64!", "y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}]}`,
+		// a 512 bit modulus
+		`{"keys": [{"kty": "RSA", "n": "` + strings.Repeat("_", 86) + `", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "n": "` + strings.Repeat("_", 342) + `", "e": "AQ"}]}`,
+	} {
+		_, err := ParseJWKS([]byte(jwks))
+		require.Error(t, err, jwks)
+	}
+}
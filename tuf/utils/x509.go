@@ -14,6 +14,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -309,6 +310,12 @@ func keyTypeForPublicKey(pubKeyBytes []byte) (string, error) {
 // Currently this is only ensuring the public key has a large enough modulus if RSA,
 // using a non SHA1 signature algorithm, and an optional time expiry check
 func ValidateCertificate(c *x509.Certificate, checkExpiry bool) error {
+	return ValidateCertificateAt(c, checkExpiry, time.Now())
+}
+
+// ValidateCertificateAt is ValidateCertificate, with the optional expiry
+// check made at the given time rather than the present time
+func ValidateCertificateAt(c *x509.Certificate, checkExpiry bool, now time.Time) error {
 	if (c.NotBefore).After(c.NotAfter) {
 		return fmt.Errorf("certificate validity window is invalid")
 	}
@@ -327,14 +334,13 @@ func ValidateCertificate(c *x509.Certificate, checkExpiry bool) error {
 		}
 	}
 	if checkExpiry {
-		now := time.Now()
 		tomorrow := now.AddDate(0, 0, 1)
 		// Give one day leeway on creation "before" time, check "after" against today
 		if (tomorrow).Before(c.NotBefore) || now.After(c.NotAfter) {
 			return data.ErrCertExpired{CN: c.Subject.CommonName}
 		}
 		// If this certificate is expiring within 6 months, put out a warning
-		if (c.NotAfter).Before(time.Now().AddDate(0, 6, 0)) {
+		if (c.NotAfter).Before(now.AddDate(0, 6, 0)) {
 			logrus.Warnf("certificate with CN %s is near expiry", c.Subject.CommonName)
 		}
 	}
@@ -461,6 +467,49 @@ func extractPrivateKeyAttributes(pemBytes []byte, fips bool) (data.RoleName, dat
 	return data.RoleName(block.Headers["role"]), data.GUN(block.Headers["gun"]), nil
 }
 
+// ExtractPrivateKeyLabel returns the label of a PEM encoded private key, or
+// the empty string if it has none
+func ExtractPrivateKeyLabel(pemBytes []byte) string {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return ""
+	}
+	return block.Headers["label"]
+}
+
+// ValidateKeyLabel returns an error if the label can't be stored in the
+// headers of a PEM encoded private key
+func ValidateKeyLabel(label string) error {
+	if strings.ContainsAny(label, "\r\n") {
+		return fmt.Errorf("key label cannot contain line breaks")
+	}
+	if strings.TrimSpace(label) != label {
+		return fmt.Errorf("key label cannot start or end with whitespace")
+	}
+	return nil
+}
+
+// LabelPrivateKey sets the label of a PEM encoded private key, a note for
+// people of what the key is for, or removes it if the label is empty
+func LabelPrivateKey(pemBytes []byte, label string) ([]byte, error) {
+	if err := ValidateKeyLabel(label); err != nil {
+		return nil, err
+	}
+	block, rest := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("PEM block is empty")
+	}
+	if block.Headers == nil {
+		block.Headers = make(map[string]string)
+	}
+	if label == "" {
+		delete(block.Headers, "label")
+	} else {
+		block.Headers["label"] = label
+	}
+	return append(pem.EncodeToMemory(block), rest...), nil
+}
+
 // ConvertPrivateKeyToPKCS8 converts a data.PrivateKey to PKCS#8 Format
 func ConvertPrivateKeyToPKCS8(key data.PrivateKey, role data.RoleName, gun data.GUN, passphrase string) ([]byte, error) {
 	var (
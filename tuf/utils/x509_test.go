@@ -327,6 +327,41 @@ func testExtractPrivateKeyAttributes(t *testing.T) {
 	require.EqualValues(t, data.GUN(""), gun)
 }
 
+func TestLabelPrivateKey(t *testing.T) {
+	testPKCS8PEM := getPKCS8KeyWithRole(t, "fat", "panda")
+	require.Equal(t, "", ExtractPrivateKeyLabel(testPKCS8PEM))
+	require.Equal(t, "", ExtractPrivateKeyLabel([]byte("Knock knock; it's Bob.")))
+
+	labeled, err := LabelPrivateKey(testPKCS8PEM, "release signing: v2")
+	require.NoError(t, err)
+	require.Equal(t, "release signing: v2", ExtractPrivateKeyLabel(labeled))
+
+	// the other attributes and the key itself are unchanged
+	role, gun, err := ExtractPrivateKeyAttributes(labeled)
+	require.NoError(t, err)
+	require.EqualValues(t, "fat", role)
+	require.EqualValues(t, "panda", gun)
+	original, err := ParsePEMPrivateKey(testPKCS8PEM, "")
+	require.NoError(t, err)
+	parsed, err := ParsePEMPrivateKey(labeled, "")
+	require.NoError(t, err)
+	require.Equal(t, original.ID(), parsed.ID())
+
+	relabeled, err := LabelPrivateKey(labeled, "")
+	require.NoError(t, err)
+	require.Equal(t, "", ExtractPrivateKeyLabel(relabeled))
+	originalBlock, _ := pem.Decode(testPKCS8PEM)
+	relabeledBlock, _ := pem.Decode(relabeled)
+	require.Equal(t, originalBlock, relabeledBlock)
+
+	for _, invalid := range []string{"two\nlines", "carriage\rreturn", " padded"} {
+		_, err := LabelPrivateKey(testPKCS8PEM, invalid)
+		require.Error(t, err)
+	}
+	_, err = LabelPrivateKey([]byte("Knock knock; it's Bob."), "label")
+	require.Error(t, err)
+}
+
 func testExtractPrivateKeyAttributesWithFIPS(t *testing.T) {
 	fips := true
 
@@ -616,6 +651,33 @@ func TestValidateCertificateWithExpiredCert(t *testing.T) {
 	require.Error(t, ValidateCertificate(expiredCert, true))
 }
 
+// Certificate expiry is checked against the clock
+func TestValidateCertificateAt(t *testing.T) {
+	startTime := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.AddDate(1, 0, 0)
+	template, err := NewCertificate("something", startTime, endTime)
+	require.NoError(t, err)
+	template.SignatureAlgorithm = x509.ECDSAWithSHA256
+	template.PublicKeyAlgorithm = x509.ECDSA
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	derBytes, err := x509.CreateCertificate(
+		rand.Reader, template, template, &privKey.PublicKey, privKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(derBytes)
+	require.NoError(t, err)
+
+	// one day of leeway is given before the certificate is valid
+	require.Error(t, ValidateCertificateAt(cert, true, startTime.AddDate(0, 0, -2)))
+	require.NoError(t, ValidateCertificateAt(cert, true, startTime.AddDate(0, 0, -1).Add(time.Second)))
+
+	require.NoError(t, ValidateCertificateAt(cert, true, endTime.Add(-time.Second)))
+	require.Error(t, ValidateCertificateAt(cert, true, endTime.Add(time.Second)))
+}
+
 func TestValidateCertificateWithInvalidExpiry(t *testing.T) {
 	// Test against a cert with an invalid expiry window: from 10 years in the future to 10 years ago
 	startTime := time.Now().AddDate(10, 0, 0)
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CertReloader serves a TLS certificate and key loaded from files, and can
+// reload them when the files change so that certificates can be rotated
+// without restarting the server
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// seen is the state of the files when they were last loaded or found to
+	// be invalid, so that invalid files are only retried once they change again
+	seen fileState
+}
+
+type fileState struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+func statFiles(certFile, keyFile string) (fileState, error) {
+	// Stat follows symlinks, so this also notices a directory of symlinks,
+	// such as a mounted Kubernetes secret, being pointed at new files
+	certInfo, err := os.Stat(certFile)
+	if err != nil {
+		return fileState{}, err
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{
+		certMod:  certInfo.ModTime(),
+		keyMod:   keyInfo.ModTime(),
+		certSize: certInfo.Size(),
+		keySize:  keyInfo.Size(),
+	}, nil
+}
+
+// NewCertReloader loads the certificate and key, which must match.  As when
+// the certificate isn't reloaded, its validity period isn't checked until it
+// is replaced.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	state, err := statFiles(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &CertReloader{certFile: certFile, keyFile: keyFile, cert: &cert, seen: state}, nil
+}
+
+// loadValidKeyPair loads the certificate and key, checking that they match and
+// that the certificate is currently valid
+func loadValidKeyPair(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate %s is only valid from %s to %s",
+			certFile, leaf.NotBefore.UTC().Format(time.RFC3339), leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
+
+// GetCertificate returns the current certificate, and can be used as the
+// GetCertificate of a tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload reloads the certificate and key if the files have changed since they
+// were last loaded.  If the new certificate or key is invalid, the current
+// certificate is kept.
+func (r *CertReloader) Reload() error {
+	state, err := statFiles(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	unchanged := state == r.seen
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := loadValidKeyPair(r.certFile, r.keyFile)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen = state
+	if err != nil {
+		return fmt.Errorf("keeping the current TLS certificate: %v", err)
+	}
+	r.cert = cert
+	logrus.Infof("reloaded TLS certificate %s", r.certFile)
+	return nil
+}
+
+// Watch checks the files for changes every interval, reloading them when they
+// change, until stop is closed
+func (r *CertReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				logrus.Errorf("unable to reload TLS certificate %s: %v", r.certFile, err)
+			}
+		}
+	}
+}
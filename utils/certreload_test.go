@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair writes the certificate and key as PEM, and moves their
+// modification times forward so that the change is noticed even on
+// filesystems with a coarse timestamp granularity
+func writeKeyPair(t *testing.T, certFile, keyFile string, cert *tls.Certificate, modTime time.Time) {
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	writePEM(t, certFile, "CERTIFICATE", cert.Certificate[0])
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+// servedCert connects to a TLS server using the given configuration, and
+// returns the certificate it presents
+func servedCert(t *testing.T, serverConf *tls.Config) []byte {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tls.Server(conn, serverConf).Handshake()
+	}()
+	conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Raw
+}
+
+func TestCertReloader(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "certreload")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	certFile, keyFile := filepath.Join(tempDir, "server.crt"), filepath.Join(tempDir, "server.key")
+
+	ca := newTestCA(t, "example.org")
+	first, second := ca.issue(t), ca.issue(t)
+	modTime := time.Now()
+	writeKeyPair(t, certFile, keyFile, first, modTime)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	serverConf := &tls.Config{GetCertificate: reloader.GetCertificate}
+	require.Equal(t, first.Certificate[0], servedCert(t, serverConf))
+
+	// nothing changed, so nothing is reloaded
+	require.NoError(t, reloader.Reload())
+	require.Equal(t, first.Certificate[0], servedCert(t, serverConf))
+
+	// subsequent handshakes use the new certificate once it is reloaded
+	modTime = modTime.Add(time.Minute)
+	writeKeyPair(t, certFile, keyFile, second, modTime)
+	require.NoError(t, reloader.Reload())
+	require.Equal(t, second.Certificate[0], servedCert(t, serverConf))
+
+	// a certificate which doesn't match the key is not swapped in
+	modTime = modTime.Add(time.Minute)
+	writePEM(t, certFile, "CERTIFICATE", first.Certificate[0])
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	err = reloader.Reload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "keeping the current TLS certificate")
+	require.Equal(t, second.Certificate[0], servedCert(t, serverConf))
+
+	// nor is a certificate which isn't valid yet
+	future := *first
+	future.Certificate = [][]byte{ca.issueValidFrom(t, time.Now().Add(time.Hour), first.PrivateKey.(*ecdsa.PrivateKey))}
+	modTime = modTime.Add(time.Minute)
+	writeKeyPair(t, certFile, keyFile, &future, modTime)
+	require.Error(t, reloader.Reload())
+	require.Equal(t, second.Certificate[0], servedCert(t, serverConf))
+}
+
+// Watch reloads the certificate when the files change, without being asked
+func TestCertReloaderWatch(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "certreload")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	certFile, keyFile := filepath.Join(tempDir, "server.crt"), filepath.Join(tempDir, "server.key")
+
+	ca := newTestCA(t, "example.org")
+	first, second := ca.issue(t), ca.issue(t)
+	modTime := time.Now()
+	writeKeyPair(t, certFile, keyFile, first, modTime)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	stop := make(chan struct{})
+	defer close(stop)
+	go reloader.Watch(10*time.Millisecond, stop)
+
+	serverConf := &tls.Config{GetCertificate: reloader.GetCertificate}
+	writeKeyPair(t, certFile, keyFile, second, modTime.Add(time.Minute))
+	require.Eventually(t, func() bool {
+		cert, _ := reloader.GetCertificate(nil)
+		return string(cert.Certificate[0]) == string(second.Certificate[0])
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, second.Certificate[0], servedCert(t, serverConf))
+}
+
+func TestParseServerTLSReloadInterval(t *testing.T) {
+	for _, interval := range []string{"nope", "0s", "-1s"} {
+		_, _, err := ParseServerTLS(configure(`{"server": {"tls_cert_file": "`+Cert+`", "tls_key_file": "`+Key+`", "tls_reload_interval": "`+interval+`"}}`), true)
+		require.Error(t, err, interval)
+	}
+
+	tlsConfig, stop, err := ParseServerTLS(configure(`{"server": {"tls_cert_file": "`+Cert+`", "tls_key_file": "`+Key+`", "tls_reload_interval": "1h"}}`), true)
+	require.NoError(t, err)
+	defer stop()
+	require.Empty(t, tlsConfig.Certificates)
+	require.NotNil(t, tlsConfig.GetCertificate)
+
+	expected, err := tls.LoadX509KeyPair(Cert, Key)
+	require.NoError(t, err)
+	cert, err := tlsConfig.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, expected.Certificate, cert.Certificate)
+}
+
+// issueValidFrom returns a certificate for the key, signed by the CA, which
+// only becomes valid at notBefore
+func (ca *testCA) issueValidFrom(t *testing.T, notBefore time.Time, key *ecdsa.PrivateKey) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	return der
+}
+
+// Once stopped, the certificate parsed from the configuration is no longer
+// reloaded, and stopping again is harmless
+func TestParseServerTLSStopReloading(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "certreload")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	certFile, keyFile := filepath.Join(tempDir, "server.crt"), filepath.Join(tempDir, "server.key")
+
+	ca := newTestCA(t, "example.org")
+	first, second := ca.issue(t), ca.issue(t)
+	modTime := time.Now()
+	writeKeyPair(t, certFile, keyFile, first, modTime)
+
+	tlsConfig, stop, err := ParseServerTLS(configure(`{"server": {"tls_cert_file": "`+certFile+`", "tls_key_file": "`+keyFile+`", "tls_reload_interval": "10ms"}}`), true)
+	require.NoError(t, err)
+	stop()
+	stop()
+
+	writeKeyPair(t, certFile, keyFile, second, modTime.Add(time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	cert, err := tlsConfig.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, first.Certificate, cert.Certificate)
+}
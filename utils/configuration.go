@@ -9,6 +9,8 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	bugsnag_hook "github.com/Shopify/logrus-bugsnag"
 	"github.com/bugsnag/bugsnag-go"
@@ -24,6 +26,11 @@ import (
 type Storage struct {
 	Backend string
 	Source  string
+	// ReplicaSource is the source of a read replica of the SQL DB, if any
+	ReplicaSource string
+	// ReadPreference is whether reads are made from the replica or the
+	// primary, if there is a replica
+	ReadPreference string
 }
 
 // RethinkDBStorage is configuration about a RethinkDB backend service
@@ -49,10 +56,14 @@ func GetPathRelativeToConfig(configuration *viper.Viper, key string) string {
 	return filepath.Clean(filepath.Join(filepath.Dir(configFile), p))
 }
 
+// noStop is returned by ParseServerTLS when there is nothing to stop
+func noStop() {}
+
 // ParseServerTLS tries to parse out valid server TLS options from a Viper.
 // The cert/key files are relative to the config file used to populate the instance
-// of viper.
-func ParseServerTLS(configuration *viper.Viper, tlsRequired bool) (*tls.Config, error) {
+// of viper.  The returned function stops reloading the cert/key, if they are
+// being reloaded, and should be called once the server has stopped.
+func ParseServerTLS(configuration *viper.Viper, tlsRequired bool) (*tls.Config, func(), error) {
 	//  unmarshalling into objects does not seem to pick up env vars
 	tlsOpts := tlsconfig.Options{
 		CertFile:           GetPathRelativeToConfig(configuration, "server.tls_cert_file"),
@@ -63,20 +74,55 @@ func ParseServerTLS(configuration *viper.Viper, tlsRequired bool) (*tls.Config,
 	if tlsOpts.CAFile != "" {
 		tlsOpts.ClientAuth = tls.RequireAndVerifyClientCert
 	}
+	// client certificates may be verified only if they are given, so that
+	// clients without one can still connect
+	switch clientAuth := configuration.GetString("server.client_auth"); clientAuth {
+	case "", "require":
+	case "verify_if_given":
+		if tlsOpts.CAFile == "" {
+			return nil, nil, fmt.Errorf("a client CA file is required to verify client certificates")
+		}
+		tlsOpts.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, nil, fmt.Errorf("invalid client auth %q: must be \"require\" or \"verify_if_given\"", clientAuth)
+	}
 
 	if !tlsRequired {
 		cert, key, ca := tlsOpts.CertFile, tlsOpts.KeyFile, tlsOpts.CAFile
 		if cert == "" && key == "" && ca == "" {
-			return nil, nil
+			return nil, noStop, nil
 		}
 
 		if (cert == "" && key != "") || (cert != "" && key == "") || (cert == "" && key == "" && ca != "") {
-			return nil, fmt.Errorf(
+			return nil, nil, fmt.Errorf(
 				"either include both a cert and key file, or no TLS information at all to disable TLS")
 		}
 	}
 
-	return tlsconfig.Server(tlsOpts)
+	tlsConfig, err := tlsconfig.Server(tlsOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// optionally reload the cert/key when they change, so that they can be
+	// rotated without a restart
+	if configuration.IsSet("server.tls_reload_interval") {
+		interval, err := time.ParseDuration(configuration.GetString("server.tls_reload_interval"))
+		if err != nil || interval <= 0 {
+			return nil, nil, fmt.Errorf("invalid TLS reload interval %q", configuration.GetString("server.tls_reload_interval"))
+		}
+		reloader, err := NewCertReloader(tlsOpts.CertFile, tlsOpts.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.Certificates = nil
+		tlsConfig.GetCertificate = reloader.GetCertificate
+		stop := make(chan struct{})
+		go reloader.Watch(interval, stop)
+		var once sync.Once
+		return tlsConfig, func() { once.Do(func() { close(stop) }) }, nil
+	}
+	return tlsConfig, noStop, nil
 }
 
 // ParseLogLevel tries to parse out a log level from a Viper.  If there is no
@@ -96,8 +142,10 @@ func ParseLogLevel(configuration *viper.Viper, defaultLevel logrus.Level) (
 // a backend is not provided, an error will be returned.)
 func ParseSQLStorage(configuration *viper.Viper) (*Storage, error) {
 	store := Storage{
-		Backend: configuration.GetString("storage.backend"),
-		Source:  configuration.GetString("storage.db_url"),
+		Backend:        configuration.GetString("storage.backend"),
+		Source:         configuration.GetString("storage.db_url"),
+		ReplicaSource:  configuration.GetString("storage.replica_db_url"),
+		ReadPreference: configuration.GetString("storage.read_preference"),
 	}
 
 	switch {
@@ -122,6 +170,30 @@ func ParseSQLStorage(configuration *viper.Viper) (*Storage, error) {
 		urlConfig.ParseTime = true
 		store.Source = urlConfig.FormatDSN()
 	}
+
+	switch store.ReadPreference {
+	case "", "primary":
+	case "replica":
+		if store.ReplicaSource == "" {
+			return nil, fmt.Errorf("must provide a replica database source to read from the replica")
+		}
+	default:
+		return nil, fmt.Errorf(
+			"%s is not a supported read preference: must be primary or replica",
+			store.ReadPreference,
+		)
+	}
+	if store.ReplicaSource != "" && store.Backend == notary.MySQLBackend {
+		urlConfig, err := mysql.ParseDSN(store.ReplicaSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the replica database source for %s",
+				store.Backend,
+			)
+		}
+
+		urlConfig.ParseTime = true
+		store.ReplicaSource = urlConfig.FormatDSN()
+	}
 	return &store, nil
 }
 
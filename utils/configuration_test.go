@@ -222,6 +222,46 @@ func TestParseSQLStorageDBStore(t *testing.T) {
 	require.Equal(t, expected, *store)
 }
 
+// A replica source is parsed like the primary's, and reading from the
+// replica requires one
+func TestParseSQLStorageReplica(t *testing.T) {
+	config := configure(`{
+		"storage": {
+			"backend": "mysql",
+			"db_url": "username:passord@tcp(hostname:1234)/dbname",
+			"replica_db_url": "username:passord@tcp(replica:1234)/dbname",
+			"read_preference": "replica"
+		}
+	}`)
+
+	expected := Storage{
+		Backend:        "mysql",
+		Source:         "username:passord@tcp(hostname:1234)/dbname?parseTime=true",
+		ReplicaSource:  "username:passord@tcp(replica:1234)/dbname?parseTime=true",
+		ReadPreference: "replica",
+	}
+
+	store, err := ParseSQLStorage(config)
+	require.NoError(t, err)
+	require.Equal(t, expected, *store)
+
+	for _, invalid := range []string{
+		`"read_preference": "replica"`,
+		`"replica_db_url": "username:passord@tcp(replica:1234)/dbname", "read_preference": "nearest"`,
+		`"replica_db_url": "not a DSN"`,
+	} {
+		config := configure(fmt.Sprintf(`{
+			"storage": {
+				"backend": "mysql",
+				"db_url": "username:passord@tcp(hostname:1234)/dbname",
+				%s
+			}
+		}`, invalid))
+		_, err := ParseSQLStorage(config)
+		require.Error(t, err, invalid)
+	}
+}
+
 // ParseRethinkDBStorage will reject non rethink databases
 func TestParseRethinkStorageDBStoreInvalidBackend(t *testing.T) {
 	config := configure(`{
@@ -359,7 +399,7 @@ func TestParseTLSNoTLSWhenRequired(t *testing.T) {
 		fmt.Sprintf(`{"server": {"tls_key_file": "%s"}}`, Key),
 	}
 	for _, configJSON := range invalids {
-		_, err := ParseServerTLS(configure(configJSON), true)
+		_, _, err := ParseServerTLS(configure(configJSON), true)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "no such file or directory")
 	}
@@ -372,7 +412,7 @@ func TestParseTLSPartialTLS(t *testing.T) {
 		fmt.Sprintf(`{"server": {"tls_key_file": "%s"}}`, Key),
 	}
 	for _, configJSON := range invalids {
-		_, err := ParseServerTLS(configure(configJSON), false)
+		_, _, err := ParseServerTLS(configure(configJSON), false)
 		require.Error(t, err)
 		require.Contains(t, err.Error(),
 			"either include both a cert and key file, or no TLS information at all to disable TLS")
@@ -384,7 +424,7 @@ func TestParseTLSNoTLSNotRequired(t *testing.T) {
 		"server": {}
 	}`)
 
-	tlsConfig, err := ParseServerTLS(config, false)
+	tlsConfig, _, err := ParseServerTLS(config, false)
 	require.NoError(t, err)
 	require.Nil(t, tlsConfig)
 }
@@ -398,7 +438,7 @@ func TestParseTLSWithTLS(t *testing.T) {
 		}
 	}`, Cert, Key, Root))
 
-	tlsConfig, err := ParseServerTLS(config, false)
+	tlsConfig, _, err := ParseServerTLS(config, false)
 	require.NoError(t, err)
 
 	expectedCert, err := tls.LoadX509KeyPair(Cert, Key)
@@ -416,6 +456,35 @@ func TestParseTLSWithTLS(t *testing.T) {
 	require.Equal(t, tlsConfig.ClientAuth, tls.RequireAndVerifyClientCert)
 }
 
+func TestParseTLSClientAuth(t *testing.T) {
+	for clientAuth, expected := range map[string]tls.ClientAuthType{
+		"require":         tls.RequireAndVerifyClientCert,
+		"verify_if_given": tls.VerifyClientCertIfGiven,
+	} {
+		tlsConfig, _, err := ParseServerTLS(configure(fmt.Sprintf(`{
+			"server": {
+				"tls_cert_file": "%s",
+				"tls_key_file": "%s",
+				"client_ca_file": "%s",
+				"client_auth": "%s"
+			}
+		}`, Cert, Key, Root, clientAuth)), false)
+		require.NoError(t, err)
+		require.Equal(t, expected, tlsConfig.ClientAuth)
+		require.NotNil(t, tlsConfig.ClientCAs)
+	}
+
+	// client certificates can't be verified without a CA, and other client
+	// auth types aren't supported
+	for _, configJSON := range []string{
+		fmt.Sprintf(`{"server": {"tls_cert_file": "%s", "tls_key_file": "%s", "client_auth": "verify_if_given"}}`, Cert, Key),
+		fmt.Sprintf(`{"server": {"tls_cert_file": "%s", "tls_key_file": "%s", "client_ca_file": "%s", "client_auth": "request"}}`, Cert, Key, Root),
+	} {
+		_, _, err := ParseServerTLS(configure(configJSON), false)
+		require.Error(t, err)
+	}
+}
+
 func TestParseTLSWithTLSRelativeToConfigFile(t *testing.T) {
 	currDir, err := os.Getwd()
 	require.NoError(t, err)
@@ -429,7 +498,7 @@ func TestParseTLSWithTLSRelativeToConfigFile(t *testing.T) {
 	}`, Cert, filepath.Clean(filepath.Join(currDir, Key))))
 	config.SetConfigFile(filepath.Join(currDir, "me.json"))
 
-	tlsConfig, err := ParseServerTLS(config, false)
+	tlsConfig, _, err := ParseServerTLS(config, false)
 	require.NoError(t, err)
 
 	expectedCert, err := tls.LoadX509KeyPair(Cert, Key)
@@ -457,7 +526,7 @@ func TestParseTLSWithEnvironmentVariables(t *testing.T) {
 	setupEnvironmentVariables(t, vars)
 	defer cleanupEnvironmentVariables(t, vars)
 
-	tlsConfig, err := ParseServerTLS(config, true)
+	tlsConfig, _, err := ParseServerTLS(config, true)
 	require.NoError(t, err)
 
 	expectedCert, err := tls.LoadX509KeyPair(Cert, Key)
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"crypto"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -12,6 +14,8 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tracing"
+	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 )
 
@@ -58,7 +62,13 @@ func (root *rootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	)
 	ctx, w = ctxu.WithResponseWriter(ctx, w)
 	ctx = ctxu.WithLogger(ctx, log)
-	ctx = context.WithValue(ctx, notary.CtxKeyCryptoSvc, root.trust)
+	// carry on the trace of the span serving the request, if any
+	ctx = tracing.ContextWithSpanContext(ctx, tracing.SpanContextFromContext(r.Context()))
+	var trust signed.CryptoService
+	if root.trust != nil {
+		trust = tracedCryptoService{CryptoService: root.trust, ctx: ctx}
+	}
+	ctx = context.WithValue(ctx, notary.CtxKeyCryptoSvc, trust)
 
 	defer func(ctx context.Context) {
 		ctxu.GetResponseLogger(ctx).Info("response completed")
@@ -77,6 +87,40 @@ func (root *rootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// tracedCryptoService traces each signature made with its keys as a span
+// within the span of the request being served
+type tracedCryptoService struct {
+	signed.CryptoService
+	ctx context.Context
+}
+
+func (cs tracedCryptoService) GetPrivateKey(keyID string) (data.PrivateKey, data.RoleName, error) {
+	privKey, role, err := cs.CryptoService.GetPrivateKey(keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	return tracedPrivateKey{PrivateKey: privKey, ctx: cs.ctx}, role, nil
+}
+
+type tracedPrivateKey struct {
+	data.PrivateKey
+	ctx context.Context
+}
+
+// Sign signs within a span, which is propagated to the signer if the key is
+// held by one
+func (k tracedPrivateKey) Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) (sig []byte, err error) {
+	ctx, span := tracing.Start(k.ctx, "notary.server.sign")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	if traced, ok := k.PrivateKey.(tracing.ContextSigner); ok {
+		return traced.SignContext(ctx, rand, msg, opts)
+	}
+	return k.PrivateKey.Sign(rand, msg, opts)
+}
+
 func serveError(log ctxu.Logger, w http.ResponseWriter, err error) {
 	if httpErr, ok := err.(errcode.Error); ok {
 		// info level logging for non-5XX http errors
@@ -0,0 +1,26 @@
+package utils
+
+import "strings"
+
+// ValidGUNPattern returns whether the pattern is either a GUN, or a GUN prefix
+// followed by a "*" wildcard.  Client identities are matched by patterns of
+// the same form.
+func ValidGUNPattern(pattern string) bool {
+	return pattern != "" && !strings.Contains(strings.TrimSuffix(pattern, "*"), "*")
+}
+
+// MatchGUNPattern returns whether the name matches any of the patterns, each
+// of which is either exact or ends in a "*" wildcard which matches every name
+// it is a prefix of
+func MatchGUNPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
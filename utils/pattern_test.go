@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidGUNPattern(t *testing.T) {
+	for pattern, valid := range map[string]bool{
+		"docker.io/library/alpine": true,
+		"docker.io/library/*":      true,
+		"*":                        true,
+		"":                         false,
+		"docker.io/*/alpine":       false,
+		"docker.io/**":             false,
+	} {
+		require.Equal(t, valid, ValidGUNPattern(pattern), pattern)
+	}
+}
+
+func TestMatchGUNPattern(t *testing.T) {
+	patterns := []string{"docker.io/library/*", "example.com/app"}
+	for name, matches := range map[string]bool{
+		"docker.io/library/alpine": true,
+		"docker.io/library/":       true,
+		"docker.io/other/alpine":   false,
+		"example.com/app":          true,
+		"example.com/app2":         false,
+	} {
+		require.Equal(t, matches, MatchGUNPattern(name, patterns), name)
+	}
+	require.True(t, MatchGUNPattern("anything", []string{"*"}))
+	require.False(t, MatchGUNPattern("anything", nil))
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/viper"
+)
+
+// SVIDSource provides the X.509 SVID (SPIFFE Verifiable Identity Document) a
+// workload presents to its peers, and the trust bundle used to verify the
+// SVIDs of those peers.  It is consulted on every handshake, so that rotated
+// SVIDs and bundles are picked up without a restart.
+type SVIDSource interface {
+	GetX509SVID() (*tls.Certificate, error)
+	GetX509Bundle() (*x509.CertPool, error)
+}
+
+// FileSVIDSource is an SVIDSource which reads the SVID and the trust bundle
+// from PEM files, such as those kept up to date by the SPIFFE helper
+type FileSVIDSource struct {
+	CertFile   string
+	KeyFile    string
+	BundleFile string
+}
+
+// GetX509SVID reads the SVID and its private key
+func (f FileSVIDSource) GetX509SVID() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SVID: %v", err)
+	}
+	return &cert, nil
+}
+
+// GetX509Bundle reads the trust bundle
+func (f FileSVIDSource) GetX509Bundle() (*x509.CertPool, error) {
+	pemBytes, err := ioutil.ReadFile(f.BundleFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load trust bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no certificates in trust bundle %s", f.BundleFile)
+	}
+	return pool, nil
+}
+
+// SPIFFEID returns the SPIFFE ID of an SVID, which is its only URI SAN
+func SPIFFEID(cert *x509.Certificate) (string, error) {
+	if len(cert.URIs) != 1 {
+		return "", fmt.Errorf("an SVID must have exactly one URI SAN, found %d", len(cert.URIs))
+	}
+	id := cert.URIs[0]
+	if id.Scheme != "spiffe" || id.Host == "" {
+		return "", fmt.Errorf("%s is not a SPIFFE ID", id)
+	}
+	return id.String(), nil
+}
+
+// SPIFFEServerTLS returns a TLS configuration which presents the SVID of the
+// source, and requires clients to present an SVID, signed by the trust bundle
+// of the source, whose SPIFFE ID is one of allowedIDs
+func SPIFFEServerTLS(source SVIDSource, allowedIDs []string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return source.GetX509SVID()
+		},
+		// the client certificate is verified against the trust bundle by
+		// verifySPIFFEPeer rather than against a fixed pool of client CAs
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: verifySPIFFEPeer(source, allowedIDs),
+	}
+}
+
+// SPIFFEClientTLS returns a TLS configuration which presents the SVID of the
+// source, and requires the server to present an SVID, signed by the trust
+// bundle of the source, whose SPIFFE ID is one of allowedIDs
+func SPIFFEClientTLS(source SVIDSource, allowedIDs []string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return source.GetX509SVID()
+		},
+		// SVIDs identify workloads rather than hostnames, so the server
+		// certificate is verified by verifySPIFFEPeer instead
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifySPIFFEPeer(source, allowedIDs),
+	}
+}
+
+func verifySPIFFEPeer(source SVIDSource, allowedIDs []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("peer presented no SVID")
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("peer presented an invalid certificate: %v", err)
+			}
+			certs = append(certs, cert)
+		}
+		bundle, err := source.GetX509Bundle()
+		if err != nil {
+			return err
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         bundle,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return fmt.Errorf("unable to verify peer SVID: %v", err)
+		}
+		id, err := SPIFFEID(certs[0])
+		if err != nil {
+			return err
+		}
+		for _, allowed := range allowedIDs {
+			if id == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("SPIFFE ID %s is not allowed", id)
+	}
+}
+
+// ParseSPIFFETLS parses the optional "spiffe" subsection of the given section
+// of the configuration into a TLS configuration for either end of a
+// connection.  If there is no such subsection, it returns nil so that the
+// static certificates are used instead.  The files are relative to the
+// config file used to populate the instance of viper.
+func ParseSPIFFETLS(configuration *viper.Viper, section string, server bool) (*tls.Config, error) {
+	prefix := section + ".spiffe"
+	if !configuration.IsSet(prefix) {
+		return nil, nil
+	}
+	source := FileSVIDSource{
+		CertFile:   GetPathRelativeToConfig(configuration, prefix+".svid_cert_file"),
+		KeyFile:    GetPathRelativeToConfig(configuration, prefix+".svid_key_file"),
+		BundleFile: GetPathRelativeToConfig(configuration, prefix+".bundle_file"),
+	}
+	if source.CertFile == "" || source.KeyFile == "" || source.BundleFile == "" {
+		return nil, fmt.Errorf("SPIFFE requires an SVID cert file, an SVID key file and a bundle file")
+	}
+	allowedIDs := configuration.GetStringSlice(prefix + ".allowed_ids")
+	if len(allowedIDs) == 0 {
+		return nil, fmt.Errorf("SPIFFE requires at least one allowed SPIFFE ID")
+	}
+	// fail early on files which can't be loaded, rather than on the first handshake
+	if _, err := source.GetX509SVID(); err != nil {
+		return nil, err
+	}
+	if _, err := source.GetX509Bundle(); err != nil {
+		return nil, err
+	}
+	if server {
+		return SPIFFEServerTLS(source, allowedIDs), nil
+	}
+	return SPIFFEClientTLS(source, allowedIDs), nil
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSVIDSource hands out a fixed SVID and trust bundle
+type fakeSVIDSource struct {
+	svid   *tls.Certificate
+	bundle *x509.CertPool
+}
+
+func (f fakeSVIDSource) GetX509SVID() (*tls.Certificate, error) {
+	return f.svid, nil
+}
+
+func (f fakeSVIDSource) GetX509Bundle() (*x509.CertPool, error) {
+	return f.bundle, nil
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, trustDomain string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: trustDomain},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: trustDomain}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) bundle() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue returns an SVID for the given URI SANs signed by the CA
+func (ca *testCA) issue(t *testing.T, ids ...string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, id := range ids {
+		u, err := url.Parse(id)
+		require.NoError(t, err)
+		template.URIs = append(template.URIs, u)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake connects a client and a server over loopback using the given
+// configurations, and returns the errors of the client and the server handshakes
+func handshake(t *testing.T, clientConf, serverConf *tls.Config) (error, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverConn, err := lis.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		server := tls.Server(serverConn, serverConf)
+		err = server.Handshake()
+		if err == nil {
+			// TLS 1.3 clients only find out about a rejected certificate on
+			// their first read, so give them something to read
+			_, err = server.Write([]byte("ok"))
+		}
+		serverErr <- err
+		serverConn.Close()
+	}()
+	clientConn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	client := tls.Client(clientConn, clientConf)
+	clientErr := client.Handshake()
+	if clientErr == nil {
+		_, clientErr = client.Read(make([]byte, 2))
+	}
+	clientConn.Close()
+	return clientErr, <-serverErr
+}
+
+const (
+	signerID = "spiffe://example.org/notary-signer"
+	serverID = "spiffe://example.org/notary-server"
+)
+
+func TestSPIFFEID(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	for _, ids := range [][]string{{}, {serverID, signerID}, {"https://example.org/notary-server"}, {"spiffe:///notary-server"}} {
+		cert, err := x509.ParseCertificate(ca.issue(t, ids...).Certificate[0])
+		require.NoError(t, err)
+		_, err = SPIFFEID(cert)
+		require.Error(t, err, fmt.Sprint(ids))
+	}
+
+	cert, err := x509.ParseCertificate(ca.issue(t, serverID).Certificate[0])
+	require.NoError(t, err)
+	id, err := SPIFFEID(cert)
+	require.NoError(t, err)
+	require.Equal(t, serverID, id)
+}
+
+// Both ends accept each other's SVIDs if their SPIFFE IDs are allowed
+func TestSPIFFETLSAllowedIDs(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	serverSource := fakeSVIDSource{svid: ca.issue(t, signerID), bundle: ca.bundle()}
+	clientSource := fakeSVIDSource{svid: ca.issue(t, serverID), bundle: ca.bundle()}
+
+	clientErr, serverErr := handshake(t,
+		SPIFFEClientTLS(clientSource, []string{signerID}),
+		SPIFFEServerTLS(serverSource, []string{"spiffe://example.org/other", serverID}),
+	)
+	require.NoError(t, clientErr)
+	require.NoError(t, serverErr)
+}
+
+// The server rejects clients whose SPIFFE ID isn't allowed
+func TestSPIFFETLSDisallowedClientID(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	serverSource := fakeSVIDSource{svid: ca.issue(t, signerID), bundle: ca.bundle()}
+	clientSource := fakeSVIDSource{svid: ca.issue(t, "spiffe://example.org/intruder"), bundle: ca.bundle()}
+
+	_, serverErr := handshake(t,
+		SPIFFEClientTLS(clientSource, []string{signerID}),
+		SPIFFEServerTLS(serverSource, []string{serverID}),
+	)
+	require.Error(t, serverErr)
+	require.Contains(t, serverErr.Error(), "spiffe://example.org/intruder is not allowed")
+}
+
+// The client rejects servers whose SPIFFE ID isn't allowed
+func TestSPIFFETLSDisallowedServerID(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	serverSource := fakeSVIDSource{svid: ca.issue(t, "spiffe://example.org/impostor"), bundle: ca.bundle()}
+	clientSource := fakeSVIDSource{svid: ca.issue(t, serverID), bundle: ca.bundle()}
+
+	clientErr, _ := handshake(t,
+		SPIFFEClientTLS(clientSource, []string{signerID}),
+		SPIFFEServerTLS(serverSource, []string{serverID}),
+	)
+	require.Error(t, clientErr)
+	require.Contains(t, clientErr.Error(), "spiffe://example.org/impostor is not allowed")
+}
+
+// An SVID with an allowed SPIFFE ID is still rejected if it isn't signed by
+// the trust bundle
+func TestSPIFFETLSUntrustedSVID(t *testing.T) {
+	ca, otherCA := newTestCA(t, "example.org"), newTestCA(t, "example.org")
+	serverSource := fakeSVIDSource{svid: ca.issue(t, signerID), bundle: ca.bundle()}
+	clientSource := fakeSVIDSource{svid: otherCA.issue(t, serverID), bundle: ca.bundle()}
+
+	_, serverErr := handshake(t,
+		SPIFFEClientTLS(clientSource, []string{signerID}),
+		SPIFFEServerTLS(serverSource, []string{serverID}),
+	)
+	require.Error(t, serverErr)
+	require.Contains(t, serverErr.Error(), "unable to verify peer SVID")
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
+
+func TestParseSPIFFETLS(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "spiffe")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	ca := newTestCA(t, "example.org")
+	svid := ca.issue(t, serverID)
+	keyDER, err := x509.MarshalECPrivateKey(svid.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(tempDir, "svid.crt"), "CERTIFICATE", svid.Certificate[0])
+	writePEM(t, filepath.Join(tempDir, "svid.key"), "EC PRIVATE KEY", keyDER)
+	writePEM(t, filepath.Join(tempDir, "bundle.crt"), "CERTIFICATE", ca.cert.Raw)
+
+	// no spiffe section means the static certificates are used
+	tlsConfig, err := ParseSPIFFETLS(configure(`{"server": {}}`), "server", true)
+	require.NoError(t, err)
+	require.Nil(t, tlsConfig)
+
+	invalids := []string{
+		`{"server": {"spiffe": {"svid_key_file": "svid.key", "bundle_file": "bundle.crt", "allowed_ids": ["spiffe://example.org/notary-signer"]}}}`,
+		`{"server": {"spiffe": {"svid_cert_file": "svid.crt", "svid_key_file": "svid.key", "bundle_file": "bundle.crt"}}}`,
+		`{"server": {"spiffe": {"svid_cert_file": "nope.crt", "svid_key_file": "svid.key", "bundle_file": "bundle.crt", "allowed_ids": ["spiffe://example.org/notary-signer"]}}}`,
+		`{"server": {"spiffe": {"svid_cert_file": "svid.crt", "svid_key_file": "svid.key", "bundle_file": "svid.key", "allowed_ids": ["spiffe://example.org/notary-signer"]}}}`,
+	}
+	for _, invalid := range invalids {
+		config := configure(invalid)
+		config.SetConfigFile(filepath.Join(tempDir, "config.json"))
+		_, err := ParseSPIFFETLS(config, "server", true)
+		require.Error(t, err, invalid)
+	}
+
+	config := configure(fmt.Sprintf(
+		`{"server": {"spiffe": {"svid_cert_file": "svid.crt", "svid_key_file": "svid.key", "bundle_file": "bundle.crt", "allowed_ids": ["%s"]}}}`,
+		signerID))
+	config.SetConfigFile(filepath.Join(tempDir, "config.json"))
+
+	serverConf, err := ParseSPIFFETLS(config, "server", true)
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAnyClientCert, serverConf.ClientAuth)
+	clientConf, err := ParseSPIFFETLS(config, "server", false)
+	require.NoError(t, err)
+	require.True(t, clientConf.InsecureSkipVerify)
+
+	loaded, err := clientConf.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, svid.Certificate, loaded.Certificate)
+}